@@ -0,0 +1,135 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package channelling
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+)
+
+// Address families which can be preferred for advertised STUN and TURN
+// servers.
+const (
+	AddressFamilyIPv4 = "ipv4"
+	AddressFamilyIPv6 = "ipv6"
+)
+
+// NormalizeIP returns the canonical form of the IP address in address,
+// which may have a port, brackets or an IPv6 zone. IPv4-mapped IPv6
+// addresses, as reported by dual-stack sockets, are returned as IPv4.
+// Empty is returned if address is no IP address.
+func NormalizeIP(address string) string {
+	address = strings.TrimSpace(address)
+	if host, _, err := net.SplitHostPort(address); err == nil {
+		address = host
+	}
+	address = strings.TrimSuffix(strings.TrimPrefix(address, "["), "]")
+	if i := strings.LastIndex(address, "%"); i >= 0 {
+		address = address[:i]
+	}
+	ip := net.ParseIP(address)
+	if ip == nil {
+		return ""
+	}
+	return ip.String()
+}
+
+// AddressKey returns the key failures of address are counted under. IPv4
+// addresses are their own key, IPv6 addresses are counted for their /64
+// network, since IPv6 clients usually control a whole /64.
+func AddressKey(address string) string {
+	ip := net.ParseIP(address)
+	if ip == nil || ip.To4() != nil {
+		return address
+	}
+	return ip.Mask(net.CIDRMask(64, 128)).String() + "/64"
+}
+
+// URIHost returns the host of a STUN or TURN URI like
+// turn:host:port?transport=udp, without the brackets of IPv6 addresses.
+func URIHost(uri string) string {
+	if i := strings.Index(uri, ":"); i >= 0 {
+		uri = uri[i+1:]
+	}
+	if i := strings.Index(uri, "?"); i >= 0 {
+		uri = uri[:i]
+	}
+	if strings.HasPrefix(uri, "[") {
+		if i := strings.Index(uri, "]"); i >= 0 {
+			return uri[1:i]
+		}
+		return uri
+	}
+	if strings.Count(uri, ":") == 1 {
+		return uri[:strings.Index(uri, ":")]
+	}
+	return uri
+}
+
+// CheckURI returns an error if the host of the STUN or TURN URI is missing
+// or an IPv6 address without brackets, which clients can not tell apart
+// from the port.
+func CheckURI(uri string) error {
+	host := URIHost(uri)
+	if host == "" {
+		return fmt.Errorf("%s has no host", uri)
+	}
+	if strings.Contains(host, ":") && !strings.Contains(uri, "[") {
+		return fmt.Errorf("%s has an IPv6 address without brackets", uri)
+	}
+	return nil
+}
+
+// SortURIsByFamily orders uris so URIs with an IP address of family come
+// first and URIs with an IP address of the other family last. URIs with
+// host names stay in between, the order is kept otherwise.
+func SortURIsByFamily(uris []string, family string) {
+	if family != AddressFamilyIPv4 && family != AddressFamilyIPv6 {
+		return
+	}
+	sort.Stable(urisByFamily{uris, family})
+}
+
+type urisByFamily struct {
+	uris   []string
+	family string
+}
+
+func (list urisByFamily) Len() int      { return len(list.uris) }
+func (list urisByFamily) Swap(i, j int) { list.uris[i], list.uris[j] = list.uris[j], list.uris[i] }
+func (list urisByFamily) Less(i, j int) bool {
+	return list.rank(list.uris[i]) < list.rank(list.uris[j])
+}
+
+func (list urisByFamily) rank(uri string) int {
+	ip := net.ParseIP(URIHost(uri))
+	switch {
+	case ip == nil:
+		return 1
+	case (ip.To4() != nil) == (list.family == AddressFamilyIPv4):
+		return 0
+	default:
+		return 2
+	}
+}
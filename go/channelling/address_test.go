@@ -0,0 +1,72 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package channelling
+
+import (
+	"reflect"
+	"testing"
+)
+
+func Test_NormalizeIP(t *testing.T) {
+	for address, expected := range map[string]string{
+		"192.0.2.1":               "192.0.2.1",
+		" 192.0.2.1:1234":         "192.0.2.1",
+		"::ffff:192.0.2.1":        "192.0.2.1",
+		"[::ffff:192.0.2.1]:1234": "192.0.2.1",
+		"2001:DB8:0:0::1":         "2001:db8::1",
+		"[2001:db8::1]:443":       "2001:db8::1",
+		"[2001:db8::1]":           "2001:db8::1",
+		"fe80::1%eth0":            "fe80::1",
+		"unknown":                 "",
+	} {
+		if ip := NormalizeIP(address); ip != expected {
+			t.Errorf("Expected %q for %q, but got %q", expected, address, ip)
+		}
+	}
+}
+
+func Test_CheckURI(t *testing.T) {
+	for _, uri := range []string{"stun:stun.example.com:3478", "turn:192.0.2.1:3478?transport=udp", "turn:[2001:db8::1]:3478?transport=tcp"} {
+		if err := CheckURI(uri); err != nil {
+			t.Errorf("Unexpected error %v", err)
+		}
+	}
+	for _, uri := range []string{"turn:2001:db8::1:3478?transport=udp", "stun:"} {
+		if err := CheckURI(uri); err == nil {
+			t.Errorf("Expected error for %s", uri)
+		}
+	}
+}
+
+func Test_SortURIsByFamily(t *testing.T) {
+	uris := []string{"turn:192.0.2.1:3478", "turn:turn.example.com:3478", "turn:[2001:db8::1]:3478", "stun:198.51.100.1:3478"}
+	SortURIsByFamily(uris, AddressFamilyIPv6)
+	expected := []string{"turn:[2001:db8::1]:3478", "turn:turn.example.com:3478", "turn:192.0.2.1:3478", "stun:198.51.100.1:3478"}
+	if !reflect.DeepEqual(uris, expected) {
+		t.Errorf("Expected %v, but got %v", expected, uris)
+	}
+	SortURIsByFamily(uris, AddressFamilyIPv4)
+	expected = []string{"turn:192.0.2.1:3478", "stun:198.51.100.1:3478", "turn:turn.example.com:3478", "turn:[2001:db8::1]:3478"}
+	if !reflect.DeepEqual(uris, expected) {
+		t.Errorf("Expected %v, but got %v", expected, uris)
+	}
+}
@@ -0,0 +1,89 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package channelling
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const affinitySignatureSize = 12
+
+var affinityNodePattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// Affinity creates tokens which name the server node holding the in-memory
+// state of sessions. Tokens have the form "node.signature" so load balancers
+// can route on the plain node prefix while the server can verify them.
+type Affinity interface {
+	Node() string
+	Token() string
+	VerifyAffinityToken(token string) (string, bool)
+}
+
+type affinity struct {
+	node   string
+	secret []byte
+	token  string
+}
+
+// NewAffinity creates affinity tokens for node signed with secret. Node
+// names may only contain letters, digits, underscores and dashes.
+func NewAffinity(node string, secret []byte) (Affinity, error) {
+	if !affinityNodePattern.MatchString(node) {
+		return nil, fmt.Errorf("Invalid affinity node name: %s", node)
+	}
+	a := &affinity{node: node, secret: secret}
+	a.token = fmt.Sprintf("%s.%s", node, a.sign(node))
+	return a, nil
+}
+
+func (a *affinity) Node() string {
+	return a.node
+}
+
+func (a *affinity) Token() string {
+	return a.token
+}
+
+// VerifyAffinityToken returns the node named by a token and whether the
+// token was signed by a node sharing our secret.
+func (a *affinity) VerifyAffinityToken(token string) (string, bool) {
+	idx := strings.LastIndex(token, ".")
+	if idx <= 0 {
+		return "", false
+	}
+	node, signature := token[:idx], token[idx+1:]
+	if !hmac.Equal([]byte(signature), []byte(a.sign(node))) {
+		return "", false
+	}
+	return node, true
+}
+
+func (a *affinity) sign(node string) string {
+	mac := hmac.New(sha256.New, a.secret)
+	mac.Write([]byte(node))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil)[:affinitySignatureSize])
+}
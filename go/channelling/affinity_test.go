@@ -0,0 +1,70 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package channelling
+
+import (
+	"strings"
+	"testing"
+)
+
+var testAffinitySecret = []byte("affinity-secret-of-at-least-32-bytes")
+
+func Test_Affinity_Token_NamesNode(t *testing.T) {
+	affinity, err := NewAffinity("node-1", testAffinitySecret)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	token := affinity.Token()
+	if !strings.HasPrefix(token, "node-1.") {
+		t.Errorf("Expected token to start with the node name, but got %s", token)
+	}
+	if node, ok := affinity.VerifyAffinityToken(token); !ok || node != "node-1" {
+		t.Errorf("Expected token to verify for node-1, but got %s, %v", node, ok)
+	}
+}
+
+func Test_Affinity_VerifyAffinityToken_AcceptsOtherNodesWithSameSecret(t *testing.T) {
+	a, _ := NewAffinity("a", testAffinitySecret)
+	b, _ := NewAffinity("b", testAffinitySecret)
+	if node, ok := a.VerifyAffinityToken(b.Token()); !ok || node != "b" {
+		t.Errorf("Expected token of node b to verify, but got %s, %v", node, ok)
+	}
+}
+
+func Test_Affinity_VerifyAffinityToken_RejectsForgedTokens(t *testing.T) {
+	a, _ := NewAffinity("a", testAffinitySecret)
+	other, _ := NewAffinity("b", []byte("another-secret-of-at-least-32-bytes"))
+	signature := a.Token()[strings.Index(a.Token(), ".")+1:]
+	for _, token := range []string{"", "a", ".", "b." + signature, other.Token()} {
+		if _, ok := a.VerifyAffinityToken(token); ok {
+			t.Errorf("Expected token %q to be rejected", token)
+		}
+	}
+}
+
+func Test_NewAffinity_RejectsInvalidNodeNames(t *testing.T) {
+	for _, node := range []string{"", "a.b", "a b", "a;b"} {
+		if _, err := NewAffinity(node, testAffinitySecret); err == nil {
+			t.Errorf("Expected node name %q to be rejected", node)
+		}
+	}
+}
@@ -0,0 +1,339 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package channelling
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"log"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/strukturag/spreed-webrtc/go/randomstring"
+)
+
+const (
+	announcementTick       = time.Second    // Interval to check for due announcements.
+	announcementMotdExpiry = 24 * time.Hour // Sessions get the same message of the day again after this.
+)
+
+// ScheduledAnnouncement is an announcement which is sent at a set time,
+// repeated every Every seconds until Until if Every is set. A message of
+// the day (Motd) is instead sent once to every session which joins a room,
+// or Roomid if set, between At and Until.
+type ScheduledAnnouncement struct {
+	Id      string    `json:"id"`
+	Code    string    `json:"code,omitempty"`
+	Message string    `json:"message"`
+	Level   string    `json:"level"`
+	Roomid  string    `json:"roomid,omitempty"`
+	Userid  string    `json:"userid,omitempty"`
+	At      time.Time `json:"at"`
+	Every   int       `json:"every,omitempty"`
+	Until   time.Time `json:"until,omitempty"`
+	Motd    bool      `json:"motd,omitempty"`
+}
+
+func (scheduled *ScheduledAnnouncement) data() *DataAnnouncement {
+	return &DataAnnouncement{Type: "Announcement", Code: scheduled.Code, Message: scheduled.Message, Level: scheduled.Level}
+}
+
+func (scheduled *ScheduledAnnouncement) active(now time.Time) bool {
+	return !now.Before(scheduled.At) && (scheduled.Until.IsZero() || now.Before(scheduled.Until))
+}
+
+// AnnouncementScheduler sends scheduled announcements and messages of the
+// day through an Announcer.
+type AnnouncementScheduler interface {
+	Add(scheduled *ScheduledAnnouncement) (*ScheduledAnnouncement, error)
+	Remove(id string) bool
+	List() []*ScheduledAnnouncement
+	Motd(session *Session) []*DataAnnouncement
+	Start()
+	Stop()
+}
+
+type announcementScheduler struct {
+	sync.Mutex
+	announcer Announcer
+	path      string
+	motd      string
+	scheduled map[string]*ScheduledAnnouncement
+	next      map[string]time.Time // Map of id -> next due time of announcements which are not a motd.
+	delivered map[string]time.Time // Map of session id and motd id -> delivery time.
+	exit      chan bool
+}
+
+// NewAnnouncementScheduler creates a scheduler which sends through
+// announcer. If path is set, scheduled announcements are loaded from and
+// saved to that file. The configured motd is sent once to every session.
+func NewAnnouncementScheduler(announcer Announcer, path, motd string) (AnnouncementScheduler, error) {
+	scheduler := &announcementScheduler{
+		announcer: announcer,
+		path:      path,
+		motd:      motd,
+		scheduled: make(map[string]*ScheduledAnnouncement),
+		next:      make(map[string]time.Time),
+		delivered: make(map[string]time.Time),
+		exit:      make(chan bool),
+	}
+	if path != "" {
+		data, err := ioutil.ReadFile(path)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		if err == nil {
+			var scheduled []*ScheduledAnnouncement
+			if err := json.Unmarshal(data, &scheduled); err != nil {
+				return nil, err
+			}
+			now := time.Now()
+			for _, entry := range scheduled {
+				scheduler.add(entry, now)
+			}
+		}
+	}
+	return scheduler, nil
+}
+
+// Add validates and stores scheduled, assigning a new id.
+func (scheduler *announcementScheduler) Add(scheduled *ScheduledAnnouncement) (*ScheduledAnnouncement, error) {
+	switch scheduled.Level {
+	case "":
+		scheduled.Level = AnnouncementInfo
+	case AnnouncementInfo, AnnouncementWarning, AnnouncementError:
+	default:
+		return nil, errors.New("invalid level")
+	}
+	if scheduled.Message == "" {
+		return nil, errors.New("message is required")
+	}
+	if scheduled.Every < 0 || (scheduled.Every > 0 && scheduled.Motd) {
+		return nil, errors.New("every must be positive and is not supported for a motd")
+	}
+	now := time.Now()
+	if scheduled.At.IsZero() {
+		scheduled.At = now
+	}
+	if !scheduled.Until.IsZero() && !scheduled.Until.After(scheduled.At) {
+		return nil, errors.New("until must be after at")
+	}
+	scheduled.Id = randomstring.NewRandomString(12)
+
+	scheduler.Lock()
+	defer scheduler.Unlock()
+	scheduler.add(scheduled, now)
+	scheduler.save()
+	copied := *scheduled
+	return &copied, nil
+}
+
+func (scheduler *announcementScheduler) add(scheduled *ScheduledAnnouncement, now time.Time) {
+	if !scheduled.Until.IsZero() && !now.Before(scheduled.Until) {
+		return
+	}
+	scheduler.scheduled[scheduled.Id] = scheduled
+	if scheduled.Motd {
+		return
+	}
+	next := scheduled.At
+	if scheduled.Every > 0 && next.Before(now) {
+		// Skip repetitions which were missed while the server was down.
+		every := time.Duration(scheduled.Every) * time.Second
+		next = next.Add(now.Sub(next) / every * every)
+		if next.Before(now) {
+			next = next.Add(every)
+		}
+	}
+	scheduler.next[scheduled.Id] = next
+}
+
+func (scheduler *announcementScheduler) Remove(id string) bool {
+	scheduler.Lock()
+	defer scheduler.Unlock()
+	if _, ok := scheduler.scheduled[id]; !ok {
+		return false
+	}
+	scheduler.remove(id)
+	scheduler.save()
+	return true
+}
+
+func (scheduler *announcementScheduler) remove(id string) {
+	delete(scheduler.scheduled, id)
+	delete(scheduler.next, id)
+}
+
+// List returns all scheduled announcements ordered by their start time.
+func (scheduler *announcementScheduler) List() []*ScheduledAnnouncement {
+	scheduler.Lock()
+	defer scheduler.Unlock()
+	list := scheduler.sorted()
+	for i, scheduled := range list {
+		copied := *scheduled
+		list[i] = &copied
+	}
+	return list
+}
+
+func (scheduler *announcementScheduler) sorted() []*ScheduledAnnouncement {
+	list := make([]*ScheduledAnnouncement, 0, len(scheduler.scheduled))
+	for _, scheduled := range scheduler.scheduled {
+		list = append(list, scheduled)
+	}
+	sort.Sort(byScheduledAt(list))
+	return list
+}
+
+// Motd returns the messages of the day for all rooms and for the current
+// room of session, which were not yet sent to session.
+func (scheduler *announcementScheduler) Motd(session *Session) []*DataAnnouncement {
+	now := time.Now()
+	userid := session.Userid()
+	var announcements []*DataAnnouncement
+	scheduler.Lock()
+	defer scheduler.Unlock()
+	if scheduler.motd != "" {
+		key := session.Id + " motd"
+		if _, ok := scheduler.delivered[key]; !ok {
+			scheduler.delivered[key] = now
+			announcements = append(announcements, &DataAnnouncement{Type: "Announcement", Message: scheduler.motd, Level: AnnouncementInfo})
+		}
+	}
+	for _, scheduled := range scheduler.sorted() {
+		if !scheduled.Motd || !scheduled.active(now) || (scheduled.Roomid != "" && scheduled.Roomid != session.Roomid) {
+			continue
+		}
+		if scheduled.Userid != "" && scheduled.Userid != userid {
+			continue
+		}
+		key := session.Id + " " + scheduled.Id
+		if _, ok := scheduler.delivered[key]; ok {
+			continue
+		}
+		scheduler.delivered[key] = now
+		announcements = append(announcements, scheduled.data())
+	}
+	return announcements
+}
+
+// Start sends due announcements in the background.
+func (scheduler *announcementScheduler) Start() {
+	go func() {
+		ticker := time.NewTicker(announcementTick)
+		defer ticker.Stop()
+		for {
+			select {
+			case now := <-ticker.C:
+				scheduler.run(now)
+			case <-scheduler.exit:
+				return
+			}
+		}
+	}()
+}
+
+func (scheduler *announcementScheduler) Stop() {
+	close(scheduler.exit)
+}
+
+func (scheduler *announcementScheduler) run(now time.Time) {
+	var due []*ScheduledAnnouncement
+	scheduler.Lock()
+	changed := false
+	for id, next := range scheduler.next {
+		scheduled := scheduler.scheduled[id]
+		if !scheduled.Until.IsZero() && !now.Before(scheduled.Until) {
+			scheduler.remove(id)
+			changed = true
+			continue
+		}
+		if now.Before(next) {
+			continue
+		}
+		due = append(due, scheduled)
+		if scheduled.Every > 0 {
+			scheduler.next[id] = next.Add(time.Duration(scheduled.Every) * time.Second)
+		} else {
+			scheduler.remove(id)
+			changed = true
+		}
+	}
+	for id, scheduled := range scheduler.scheduled {
+		if scheduled.Motd && !scheduled.Until.IsZero() && !now.Before(scheduled.Until) {
+			scheduler.remove(id)
+			changed = true
+		}
+	}
+	for key, delivered := range scheduler.delivered {
+		if now.Sub(delivered) > announcementMotdExpiry {
+			delete(scheduler.delivered, key)
+		}
+	}
+	if changed {
+		scheduler.save()
+	}
+	scheduler.Unlock()
+
+	for _, scheduled := range due {
+		count := scheduler.announcer.Announce(scheduled.Roomid, scheduled.Userid, scheduled.data())
+		log.Printf("Sent scheduled announcement %s to %d sessions\n", scheduled.Id, count)
+	}
+}
+
+// save writes all scheduled announcements to the file, if any. The
+// scheduler lock must be held.
+func (scheduler *announcementScheduler) save() {
+	if scheduler.path == "" {
+		return
+	}
+	data, err := json.Marshal(scheduler.sorted())
+	if err != nil {
+		log.Println("Failed to encode scheduled announcements", err)
+		return
+	}
+	tmp := scheduler.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0600); err != nil {
+		log.Println("Failed to save scheduled announcements", err)
+		return
+	}
+	if err := os.Rename(tmp, scheduler.path); err != nil {
+		log.Println("Failed to save scheduled announcements", err)
+	}
+}
+
+type byScheduledAt []*ScheduledAnnouncement
+
+func (a byScheduledAt) Len() int {
+	return len(a)
+}
+
+func (a byScheduledAt) Swap(i, j int) {
+	a[i], a[j] = a[j], a[i]
+}
+
+func (a byScheduledAt) Less(i, j int) bool {
+	return a[i].At.Before(a[j].At)
+}
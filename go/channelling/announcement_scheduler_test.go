@@ -0,0 +1,109 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package channelling
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type testAnnouncer []string
+
+func (announcer *testAnnouncer) Announce(roomID, userid string, announcement *DataAnnouncement) int {
+	*announcer = append(*announcer, announcement.Message)
+	return 1
+}
+
+func Test_AnnouncementScheduler_SendsDueAnnouncements(t *testing.T) {
+	announcer := &testAnnouncer{}
+	scheduler, _ := NewAnnouncementScheduler(announcer, "", "")
+	now := time.Now()
+	scheduler.Add(&ScheduledAnnouncement{Message: "once", At: now.Add(time.Minute)})
+	scheduler.Add(&ScheduledAnnouncement{Message: "hourly", At: now.Add(-90 * time.Minute), Every: 3600})
+	if _, err := scheduler.Add(&ScheduledAnnouncement{Message: "bad", Level: "loud"}); err == nil {
+		t.Error("Expected invalid level to be rejected")
+	}
+
+	impl := scheduler.(*announcementScheduler)
+	impl.run(now)
+	if len(*announcer) != 0 {
+		t.Fatalf("Expected nothing to be due, but got %v", *announcer)
+	}
+	impl.run(now.Add(31 * time.Minute))
+	if len(*announcer) != 2 {
+		t.Fatalf("Expected both announcements, but got %v", *announcer)
+	}
+	if list := scheduler.List(); len(list) != 1 || list[0].Message != "hourly" {
+		t.Errorf("Expected only the recurring announcement to be left, but got %+v", list)
+	}
+	impl.run(now.Add(61 * time.Minute))
+	if len(*announcer) != 2 {
+		t.Errorf("Expected no repetition within the hour, but got %v", *announcer)
+	}
+	impl.run(now.Add(91 * time.Minute))
+	if len(*announcer) != 3 {
+		t.Errorf("Expected a repetition, but got %v", *announcer)
+	}
+}
+
+func Test_AnnouncementScheduler_SendsMotdOncePerSession(t *testing.T) {
+	scheduler, _ := NewAnnouncementScheduler(&testAnnouncer{}, "", "Welcome")
+	scheduler.Add(&ScheduledAnnouncement{Message: "Lobby rules", Roomid: "Room:lobby", Motd: true})
+
+	session := &Session{Id: "a", Roomid: "Room:other"}
+	if motd := scheduler.Motd(session); len(motd) != 1 || motd[0].Message != "Welcome" {
+		t.Errorf("Expected the configured motd, but got %+v", motd)
+	}
+	session.Roomid = "Room:lobby"
+	if motd := scheduler.Motd(session); len(motd) != 1 || motd[0].Message != "Lobby rules" {
+		t.Errorf("Expected the room motd, but got %+v", motd)
+	}
+	if motd := scheduler.Motd(session); len(motd) != 0 {
+		t.Errorf("Expected no repeated motd, but got %+v", motd)
+	}
+}
+
+func Test_AnnouncementScheduler_StoresAnnouncements(t *testing.T) {
+	dir, err := ioutil.TempDir("", "announcements")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "announcements.json")
+
+	scheduler, _ := NewAnnouncementScheduler(&testAnnouncer{}, path, "")
+	added, _ := scheduler.Add(&ScheduledAnnouncement{Message: "Maintenance", At: time.Now().Add(time.Hour)})
+
+	loaded, err := NewAnnouncementScheduler(&testAnnouncer{}, path, "")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if list := loaded.List(); len(list) != 1 || list[0].Id != added.Id {
+		t.Fatalf("Expected stored announcement, but got %+v", list)
+	}
+	if !loaded.Remove(added.Id) || len(loaded.List()) != 0 {
+		t.Error("Expected announcement to be removed")
+	}
+}
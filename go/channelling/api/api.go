@@ -32,7 +32,9 @@ const (
 	apiVersion        = 1.4 // Keep this in sync with CHANNELING-API docs.Hand
 )
 
-type channellingAPI struct {
+// Dependencies are the services used by the channelling API. Services
+// which are not configured are nil.
+type Dependencies struct {
 	RoomStatusManager channelling.RoomStatusManager
 	SessionEncoder    channelling.SessionEncoder
 	SessionManager    channelling.SessionManager
@@ -42,40 +44,62 @@ type channellingAPI struct {
 	Unicaster         channelling.Unicaster
 	BusManager        channelling.BusManager
 	PipelineManager   channelling.PipelineManager
-	config            *channelling.Config
+	RoomLinks         channelling.RoomLinks
+	StepUpManager     channelling.StepUpManager
+	AuthLimiter       channelling.AuthLimiter
+	Extensions        channelling.Extensions
+	BlobRelay         channelling.BlobRelay
+	Affinity          channelling.Affinity
+	Terms             channelling.Terms
+	Announcements     channelling.AnnouncementScheduler
+	Blocklist         channelling.Blocklist
+	SpamFilter        channelling.SpamFilter
+	ChatFilter        channelling.ChatFilter
+	BlobScanner       channelling.BlobScanner
+	LoadShedder       channelling.LoadShedder
+	DialOut           channelling.DialOut
+	CallScreener      channelling.CallScreener
+	Surveys           channelling.Surveys
+	ChatIndex         channelling.ChatIndex
+	RoomSearcher      channelling.RoomSearcher
+	UserDirectory     channelling.UserDirectory
+	Favorites         channelling.Favorites
+	PanicRecovery     channelling.PanicRecovery
+}
+
+type channellingAPI struct {
+	Dependencies
+	config         *channelling.Config
+	iceRestarts    *iceRestarts
+	screenedCalls  *screenedCalls
+	monitoredCalls *monitoredCalls
+	messageRates   *messageRates
+	handlers       map[string]messageHandler
 }
 
 // New creates and initializes a new ChannellingAPI using
 // various other services for initialization. It is intended to handle
 // incoming and outgoing channeling API events from clients.
-func New(config *channelling.Config,
-	roomStatus channelling.RoomStatusManager,
-	sessionEncoder channelling.SessionEncoder,
-	sessionManager channelling.SessionManager,
-	statsCounter channelling.StatsCounter,
-	contactManager channelling.ContactManager,
-	turnDataCreator channelling.TurnDataCreator,
-	unicaster channelling.Unicaster,
-	busManager channelling.BusManager,
-	pipelineManager channelling.PipelineManager) channelling.ChannellingAPI {
-	return &channellingAPI{
-		roomStatus,
-		sessionEncoder,
-		sessionManager,
-		statsCounter,
-		contactManager,
-		turnDataCreator,
-		unicaster,
-		busManager,
-		pipelineManager,
-		config,
+func New(config *channelling.Config, dependencies Dependencies) channelling.ChannellingAPI {
+	api := &channellingAPI{
+		Dependencies:   dependencies,
+		config:         config,
+		iceRestarts:    newIceRestarts(),
+		screenedCalls:  newScreenedCalls(),
+		monitoredCalls: newMonitoredCalls(),
+		handlers:       make(map[string]messageHandler),
 	}
+	if config != nil && len(config.MessageRates) > 0 {
+		api.messageRates = newMessageRates(config.MessageRates)
+	}
+	api.registerHandlers()
+	return api
 }
 
 func (api *channellingAPI) OnConnect(client *channelling.Client, session *channelling.Session) (interface{}, error) {
 	api.Unicaster.OnConnect(client, session)
 	self, err := api.HandleSelf(session)
-	if err == nil {
+	if err == nil && api.trackable(session, "") {
 		api.BusManager.Trigger(channelling.BusManagerConnect, session.Id, "", nil, nil)
 	}
 	return self, err
@@ -83,121 +107,259 @@ func (api *channellingAPI) OnConnect(client *channelling.Client, session *channe
 
 func (api *channellingAPI) OnDisconnect(client *channelling.Client, session *channelling.Session) {
 	api.Unicaster.OnDisconnect(client, session)
-	api.BusManager.Trigger(channelling.BusManagerDisconnect, session.Id, "", nil, nil)
+	if api.BlobRelay != nil {
+		api.BlobRelay.CleanupBlobs(session.Id)
+	}
+	api.screenedCalls.ForgetSession(session.Id)
+	if call := api.monitoredCalls.Stop(session.Id); call != nil {
+		call.remove(session.Id)
+	}
+	if api.messageRates != nil {
+		api.messageRates.forget(session.Id)
+	}
+	if api.trackable(session, "") {
+		api.BusManager.Trigger(channelling.BusManagerDisconnect, session.Id, "", nil, nil)
+	}
 }
 
-func (api *channellingAPI) OnIncoming(sender channelling.Sender, session *channelling.Session, msg *channelling.DataIncoming) (interface{}, error) {
-	var pipeline *channelling.Pipeline
-	switch msg.Type {
-	case "Self":
-		return api.HandleSelf(session)
-	case "Hello":
-		if msg.Hello == nil {
-			return nil, channelling.NewDataError("bad_request", "message did not contain Hello")
+// trackable returns false if session or the session to of this server is
+// in privacy mode, so no bus events are triggered about them.
+func (api *channellingAPI) trackable(session *channelling.Session, to string) bool {
+	if session.Private() {
+		return false
+	}
+	if to != "" && api.SessionManager != nil {
+		if peer, ok := api.SessionManager.GetSession(to); ok && peer.Private() {
+			return false
 		}
+	}
+	return true
+}
+
+func (api *channellingAPI) OnIncoming(sender channelling.Sender, session *channelling.Session, msg *channelling.DataIncoming) (interface{}, error) {
+	handler, ok := api.handlers[msg.Type]
+	if !ok {
+		// Only log the start of the type, it is controlled by clients.
+		log.Printf("OnText unhandled message type %.64q\n", msg.Type)
+		return nil, nil
+	}
 
+	return handler(sender, session, msg)
+}
+
+// handle registers handler for messages of msgType. Each message passes the
+// common middlewares for panic recovery, metrics, rate limits, schema
+// validation and extensions first and then the given middlewares in order.
+func (api *channellingAPI) handle(msgType string, handler messageHandler, middlewares ...messageMiddleware) {
+	common := []messageMiddleware{api.recoverPanics, api.countMessages, api.limitRate, validateSchema, api.checkExtensions}
+	api.handlers[msgType] = chainMiddlewares(msgType, handler, append(common, middlewares...)...)
+}
+
+func (api *channellingAPI) registerHandlers() {
+	api.handle("Self", func(sender channelling.Sender, session *channelling.Session, msg *channelling.DataIncoming) (interface{}, error) {
+		return api.HandleSelf(session)
+	})
+	api.handle("Hello", func(sender channelling.Sender, session *channelling.Session, msg *channelling.DataIncoming) (interface{}, error) {
 		return api.HandleHello(session, msg.Hello, sender)
-	case "Offer":
-		if msg.Offer == nil || msg.Offer.Offer == nil {
-			log.Println("Received invalid offer message.", msg)
-			break
-		}
-		if _, ok := msg.Offer.Offer["_token"]; !ok {
+	}, requires(func(msg *channelling.DataIncoming) bool { return msg.Hello != nil }))
+	api.handle("Offer", func(sender channelling.Sender, session *channelling.Session, msg *channelling.DataIncoming) (interface{}, error) {
+		var pipeline *channelling.Pipeline
+		if token, ok := msg.Offer.Offer["_token"]; !ok {
+			if err := api.checkPermission(session, channelling.RoomPermissionCall); err != nil {
+				return nil, err
+			}
+			if api.LoadShedder != nil && !api.LoadShedder.AllowCall() {
+				return nil, channelling.NewDataError("call_overloaded", "The server is overloaded and does not accept new calls")
+			}
+			if !api.screenCall(session, msg.Offer.To) {
+				return nil, nil
+			}
 			pipeline = api.PipelineManager.GetPipeline(channelling.PipelineNamespaceCall, sender, session, msg.Offer.To)
 			// Trigger offer event when offer has no token, so this is
 			// not triggered for peerxfer and peerscreenshare offers.
-			api.BusManager.Trigger(channelling.BusManagerOffer, session.Id, msg.Offer.To, nil, pipeline)
+			if api.trackable(session, msg.Offer.To) {
+				api.BusManager.Trigger(channelling.BusManagerOffer, session.Id, msg.Offer.To, nil, pipeline)
+			}
+		} else if tokenPermission(token) == channelling.RoomPermissionScreenshare {
+			api.limitScreenShare(session, msg.Offer.Offer)
 		}
 
 		session.Unicast(msg.Offer.To, msg.Offer, pipeline)
-	case "Candidate":
-		if msg.Candidate == nil || msg.Candidate.Candidate == nil {
-			log.Println("Received invalid candidate message.", msg)
-			break
-		}
-
-		pipeline = api.PipelineManager.GetPipeline(channelling.PipelineNamespaceCall, sender, session, msg.Candidate.To)
+		return nil, nil
+	}, ignoresInvalid(func(msg *channelling.DataIncoming) bool { return msg.Offer != nil && msg.Offer.Offer != nil }))
+	api.handle("Candidate", func(sender channelling.Sender, session *channelling.Session, msg *channelling.DataIncoming) (interface{}, error) {
+		pipeline := api.PipelineManager.GetPipeline(channelling.PipelineNamespaceCall, sender, session, msg.Candidate.To)
 		session.Unicast(msg.Candidate.To, msg.Candidate, pipeline)
-	case "Answer":
-		if msg.Answer == nil || msg.Answer.Answer == nil {
-			log.Println("Received invalid answer message.", msg)
-			break
-		}
-		if _, ok := msg.Answer.Answer["_token"]; !ok {
+		return nil, nil
+	}, ignoresInvalid(func(msg *channelling.DataIncoming) bool {
+		return msg.Candidate != nil && msg.Candidate.Candidate != nil
+	}))
+	api.handle("Answer", func(sender channelling.Sender, session *channelling.Session, msg *channelling.DataIncoming) (interface{}, error) {
+		var pipeline *channelling.Pipeline
+		if token, ok := msg.Answer.Answer["_token"]; ok {
+			// Sessions answer with a token to share their screen or files.
+			if err := api.checkPermission(session, tokenPermission(token)); err != nil {
+				return nil, err
+			}
+		} else {
 			pipeline = api.PipelineManager.GetPipeline(channelling.PipelineNamespaceCall, sender, session, msg.Answer.To)
 			// Trigger answer event when answer has no token. so this is
 			// not triggered for peerxfer and peerscreenshare answers.
-			api.BusManager.Trigger(channelling.BusManagerAnswer, session.Id, msg.Answer.To, nil, pipeline)
+			if api.trackable(session, msg.Answer.To) {
+				api.BusManager.Trigger(channelling.BusManagerAnswer, session.Id, msg.Answer.To, nil, pipeline)
+			}
+			api.addRecentCall(session, msg.Answer.To)
 		}
 
 		session.Unicast(msg.Answer.To, msg.Answer, pipeline)
-	case "Users":
+		return nil, nil
+	}, ignoresInvalid(func(msg *channelling.DataIncoming) bool { return msg.Answer != nil && msg.Answer.Answer != nil }))
+	api.handle("IceRestart", func(sender channelling.Sender, session *channelling.Session, msg *channelling.DataIncoming) (interface{}, error) {
+		return api.HandleIceRestart(sender, session, msg.IceRestart)
+	}, requires(func(msg *channelling.DataIncoming) bool { return msg.IceRestart != nil }))
+	api.handle("NetworkChange", func(sender channelling.Sender, session *channelling.Session, msg *channelling.DataIncoming) (interface{}, error) {
+		return api.HandleNetworkChange(sender, session, msg.NetworkChange)
+	}, requires(func(msg *channelling.DataIncoming) bool { return msg.NetworkChange != nil }))
+	api.handle("Users", func(sender channelling.Sender, session *channelling.Session, msg *channelling.DataIncoming) (interface{}, error) {
 		return api.HandleUsers(session)
-	case "Authentication":
-		if msg.Authentication == nil || msg.Authentication.Authentication == nil {
-			return nil, channelling.NewDataError("bad_request", "message did not contain Authentication")
-		}
-
+	})
+	api.handle("Authentication", func(sender channelling.Sender, session *channelling.Session, msg *channelling.DataIncoming) (interface{}, error) {
 		return api.HandleAuthentication(session, msg.Authentication.Authentication)
-	case "Bye":
-		if msg.Bye == nil {
-			log.Println("Received invalid bye message.", msg)
-			break
+	}, requires(func(msg *channelling.DataIncoming) bool {
+		return msg.Authentication != nil && msg.Authentication.Authentication != nil
+	}))
+	api.handle("Bye", func(sender channelling.Sender, session *channelling.Session, msg *channelling.DataIncoming) (interface{}, error) {
+		pipeline := api.PipelineManager.GetPipeline(channelling.PipelineNamespaceCall, sender, session, msg.Bye.To)
+		if api.trackable(session, msg.Bye.To) {
+			api.BusManager.Trigger(channelling.BusManagerBye, session.Id, msg.Bye.To, nil, pipeline)
+		}
+		api.screenedCalls.Forget(session.Id, msg.Bye.To)
+		if room, ok := api.RoomStatusManager.Get(session.Roomid); ok && session.Hello {
+			room.QueueCallEnded(session.Id, msg.Bye.To)
 		}
-		pipeline = api.PipelineManager.GetPipeline(channelling.PipelineNamespaceCall, sender, session, msg.Bye.To)
-		api.BusManager.Trigger(channelling.BusManagerBye, session.Id, msg.Bye.To, nil, pipeline)
 
 		session.Unicast(msg.Bye.To, msg.Bye, pipeline)
+		api.startSurvey(session, msg.Bye.To, pipeline)
 		if pipeline != nil {
-			pipeline.Close()
-		}
-	case "Status":
-		if msg.Status == nil {
-			log.Println("Received invalid status message.", msg)
-			break
+			pipeline.Close(channelling.PipelineCloseReasonBye)
 		}
-
-		//log.Println("Status", msg.Status)
+		return nil, nil
+	}, ignoresInvalid(func(msg *channelling.DataIncoming) bool { return msg.Bye != nil }))
+	api.handle("Dtmf", func(sender channelling.Sender, session *channelling.Session, msg *channelling.DataIncoming) (interface{}, error) {
+		return nil, api.HandleDtmf(sender, session, msg.Dtmf)
+	}, requires(func(msg *channelling.DataIncoming) bool { return msg.Dtmf != nil }), api.authorize(channelling.RoomPermissionCall))
+	api.handle("Status", func(sender channelling.Sender, session *channelling.Session, msg *channelling.DataIncoming) (interface{}, error) {
 		session.Update(&channelling.SessionUpdate{Types: []string{"Status"}, Status: msg.Status.Status})
 		session.BroadcastStatus()
-	case "Chat":
-		if msg.Chat == nil || msg.Chat.Chat == nil {
-			log.Println("Received invalid chat message.", msg)
-			break
-		}
-
-		api.HandleChat(session, msg.Chat)
-	case "Conference":
-		if msg.Conference == nil {
-			log.Println("Received invalid conference message.", msg)
-			break
-		}
-
+		return nil, nil
+	}, ignoresInvalid(func(msg *channelling.DataIncoming) bool { return msg.Status != nil }))
+	api.handle("Fields", func(sender channelling.Sender, session *channelling.Session, msg *channelling.DataIncoming) (interface{}, error) {
+		return nil, api.HandleFields(session, msg.Fields)
+	}, requires(func(msg *channelling.DataIncoming) bool { return msg.Fields != nil }))
+	api.handle("RoomSearch", func(sender channelling.Sender, session *channelling.Session, msg *channelling.DataIncoming) (interface{}, error) {
+		return api.HandleRoomSearch(session, msg.RoomSearch)
+	}, requires(func(msg *channelling.DataIncoming) bool { return msg.RoomSearch != nil }))
+	api.handle("Favorites", func(sender channelling.Sender, session *channelling.Session, msg *channelling.DataIncoming) (interface{}, error) {
+		return api.HandleFavorites(session, msg.Favorites)
+	}, requires(func(msg *channelling.DataIncoming) bool { return msg.Favorites != nil }))
+	api.handle("Directory", func(sender channelling.Sender, session *channelling.Session, msg *channelling.DataIncoming) (interface{}, error) {
+		return api.HandleDirectory(session, msg.Directory)
+	}, requires(func(msg *channelling.DataIncoming) bool { return msg.Directory != nil }))
+	api.handle("DirectorySearch", func(sender channelling.Sender, session *channelling.Session, msg *channelling.DataIncoming) (interface{}, error) {
+		return api.HandleDirectorySearch(session, msg.DirectorySearch)
+	}, requires(func(msg *channelling.DataIncoming) bool { return msg.DirectorySearch != nil }))
+	api.handle("ChatSearch", func(sender channelling.Sender, session *channelling.Session, msg *channelling.DataIncoming) (interface{}, error) {
+		return api.HandleChatSearch(session, msg.ChatSearch)
+	}, requires(func(msg *channelling.DataIncoming) bool { return msg.ChatSearch != nil }))
+	api.handle("Accessibility", func(sender channelling.Sender, session *channelling.Session, msg *channelling.DataIncoming) (interface{}, error) {
+		return api.HandleAccessibility(session, msg.Accessibility)
+	}, requires(func(msg *channelling.DataIncoming) bool { return msg.Accessibility != nil }))
+	api.handle("AccessibilityEvent", func(sender channelling.Sender, session *channelling.Session, msg *channelling.DataIncoming) (interface{}, error) {
+		return nil, api.HandleAccessibilityEvent(session, msg.AccessibilityEvent)
+	}, requires(func(msg *channelling.DataIncoming) bool { return msg.AccessibilityEvent != nil }))
+	api.handle("Chat", func(sender channelling.Sender, session *channelling.Session, msg *channelling.DataIncoming) (interface{}, error) {
+		return nil, api.HandleChat(session, msg.Chat)
+	}, ignoresInvalid(func(msg *channelling.DataIncoming) bool { return msg.Chat != nil && msg.Chat.Chat != nil }))
+	api.handle("Conference", func(sender channelling.Sender, session *channelling.Session, msg *channelling.DataIncoming) (interface{}, error) {
 		api.HandleConference(session, msg.Conference)
-	case "Alive":
-		return msg.Alive, nil
-	case "Sessions":
-		if msg.Sessions == nil || msg.Sessions.Sessions == nil {
-			return nil, channelling.NewDataError("bad_request", "message did not contain Sessions")
-		}
-
+		return nil, nil
+	}, ignoresInvalid(func(msg *channelling.DataIncoming) bool { return msg.Conference != nil }), api.authorize(channelling.RoomPermissionCall))
+	api.handle("Alive", func(sender channelling.Sender, session *channelling.Session, msg *channelling.DataIncoming) (interface{}, error) {
+		return api.HandleAlive(session, msg.Alive), nil
+	}, requires(func(msg *channelling.DataIncoming) bool { return msg.Alive != nil }))
+	api.handle("Sessions", func(sender channelling.Sender, session *channelling.Session, msg *channelling.DataIncoming) (interface{}, error) {
 		return api.HandleSessions(session, msg.Sessions.Sessions)
-	case "Room":
-		if msg.Room == nil {
-			return nil, channelling.NewDataError("bad_request", "message did not contain Room")
-		}
-
+	}, requires(func(msg *channelling.DataIncoming) bool { return msg.Sessions != nil && msg.Sessions.Sessions != nil }))
+	api.handle("Room", func(sender channelling.Sender, session *channelling.Session, msg *channelling.DataIncoming) (interface{}, error) {
 		return api.HandleRoom(session, msg.Room)
-	case "Leave":
-		if err := api.HandleLeave(session); err != nil {
+	}, requires(func(msg *channelling.DataIncoming) bool { return msg.Room != nil }))
+	api.handle("BlobChunk", func(sender channelling.Sender, session *channelling.Session, msg *channelling.DataIncoming) (interface{}, error) {
+		return nil, api.HandleBlobChunk(session, msg.BlobChunk)
+	}, requires(func(msg *channelling.DataIncoming) bool { return msg.BlobChunk != nil }))
+	api.handle("Follow", func(sender channelling.Sender, session *channelling.Session, msg *channelling.DataIncoming) (interface{}, error) {
+		return api.HandleFollow(session, msg.Follow)
+	}, requires(func(msg *channelling.DataIncoming) bool { return msg.Follow != nil }))
+	api.handle("Volatile", func(sender channelling.Sender, session *channelling.Session, msg *channelling.DataIncoming) (interface{}, error) {
+		return nil, api.HandleVolatile(session, msg.Volatile)
+	}, requires(func(msg *channelling.DataIncoming) bool { return msg.Volatile != nil }))
+	api.handle("MediaMode", func(sender channelling.Sender, session *channelling.Session, msg *channelling.DataIncoming) (interface{}, error) {
+		return nil, api.HandleMediaMode(session, msg.MediaMode)
+	}, requires(func(msg *channelling.DataIncoming) bool { return msg.MediaMode != nil }))
+	api.handle("Bandwidth", func(sender channelling.Sender, session *channelling.Session, msg *channelling.DataIncoming) (interface{}, error) {
+		videoCap, err := api.HandleBandwidth(session, msg.Bandwidth)
+		if videoCap == nil {
 			return nil, err
 		}
-		return nil, nil
-	default:
-		log.Println("OnText unhandled message type", msg.Type)
-	}
-
-	return nil, nil
+		return videoCap, err
+	}, requires(func(msg *channelling.DataIncoming) bool { return msg.Bandwidth != nil }))
+	api.handle("Timer", func(sender channelling.Sender, session *channelling.Session, msg *channelling.DataIncoming) (interface{}, error) {
+		return api.HandleTimer(session, msg.Timer)
+	}, requires(func(msg *channelling.DataIncoming) bool { return msg.Timer != nil }))
+	api.handle("DialOut", func(sender channelling.Sender, session *channelling.Session, msg *channelling.DataIncoming) (interface{}, error) {
+		return api.HandleDialOut(session, msg.DialOut)
+	}, requires(func(msg *channelling.DataIncoming) bool { return msg.DialOut != nil }))
+	api.handle("Monitor", func(sender channelling.Sender, session *channelling.Session, msg *channelling.DataIncoming) (interface{}, error) {
+		return api.HandleMonitor(session, msg.Monitor)
+	}, requires(func(msg *channelling.DataIncoming) bool { return msg.Monitor != nil }))
+	api.handle("Whisper", func(sender channelling.Sender, session *channelling.Session, msg *channelling.DataIncoming) (interface{}, error) {
+		return nil, api.HandleWhisper(session, msg.Whisper)
+	}, requires(func(msg *channelling.DataIncoming) bool { return msg.Whisper != nil }))
+	api.handle("SurveyResponse", func(sender channelling.Sender, session *channelling.Session, msg *channelling.DataIncoming) (interface{}, error) {
+		return nil, api.HandleSurveyResponse(session, msg.SurveyResponse)
+	}, requires(func(msg *channelling.DataIncoming) bool { return msg.SurveyResponse != nil }))
+	api.handle("QueueAgent", func(sender channelling.Sender, session *channelling.Session, msg *channelling.DataIncoming) (interface{}, error) {
+		return nil, api.HandleQueueAgent(session, msg.QueueAgent)
+	}, requires(func(msg *channelling.DataIncoming) bool { return msg.QueueAgent != nil }))
+	api.handle("Recording", func(sender channelling.Sender, session *channelling.Session, msg *channelling.DataIncoming) (interface{}, error) {
+		return api.HandleRecording(session, msg.Recording)
+	}, requires(func(msg *channelling.DataIncoming) bool { return msg.Recording != nil }))
+	api.handle("RecordingConsent", func(sender channelling.Sender, session *channelling.Session, msg *channelling.DataIncoming) (interface{}, error) {
+		return api.HandleRecordingConsent(session, msg.RecordingConsent)
+	}, requires(func(msg *channelling.DataIncoming) bool { return msg.RecordingConsent != nil }))
+	api.handle("Mute", func(sender channelling.Sender, session *channelling.Session, msg *channelling.DataIncoming) (interface{}, error) {
+		return api.HandleMute(session, msg.Mute)
+	}, requires(func(msg *channelling.DataIncoming) bool { return msg.Mute != nil }))
+	api.handle("EndRoom", func(sender channelling.Sender, session *channelling.Session, msg *channelling.DataIncoming) (interface{}, error) {
+		return api.HandleEndRoom(session, msg.EndRoom)
+	}, requires(func(msg *channelling.DataIncoming) bool { return msg.EndRoom != nil }))
+	api.handle("RoomOwner", func(sender channelling.Sender, session *channelling.Session, msg *channelling.DataIncoming) (interface{}, error) {
+		return api.HandleRoomOwner(session, msg.RoomOwner)
+	}, requires(func(msg *channelling.DataIncoming) bool { return msg.RoomOwner != nil }))
+	api.handle("RoomLink", func(sender channelling.Sender, session *channelling.Session, msg *channelling.DataIncoming) (interface{}, error) {
+		return api.HandleRoomLink(session, msg.RoomLink)
+	}, requires(func(msg *channelling.DataIncoming) bool { return msg.RoomLink != nil }))
+	api.handle("StepUp", func(sender channelling.Sender, session *channelling.Session, msg *channelling.DataIncoming) (interface{}, error) {
+		return api.HandleStepUp(session, msg.StepUp)
+	}, requires(func(msg *channelling.DataIncoming) bool { return msg.StepUp != nil }))
+	api.handle("Permissions", func(sender channelling.Sender, session *channelling.Session, msg *channelling.DataIncoming) (interface{}, error) {
+		return api.HandlePermissions(session, msg.Permissions)
+	}, requires(func(msg *channelling.DataIncoming) bool { return msg.Permissions != nil }))
+	api.handle("Block", func(sender channelling.Sender, session *channelling.Session, msg *channelling.DataIncoming) (interface{}, error) {
+		return api.HandleBlock(session, msg.Block)
+	}, requires(func(msg *channelling.DataIncoming) bool { return msg.Block != nil }))
+	api.handle("Leave", func(sender channelling.Sender, session *channelling.Session, msg *channelling.DataIncoming) (interface{}, error) {
+		return nil, api.HandleLeave(session)
+	})
 }
 
 func (api *channellingAPI) OnIncomingProcessed(sender channelling.Sender, session *channelling.Session, msg *channelling.DataIncoming, reply interface{}, err error) {
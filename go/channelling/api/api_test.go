@@ -24,12 +24,16 @@ package api
 import (
 	"errors"
 	"fmt"
+	"net"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/gorilla/securecookie"
 
 	"github.com/strukturag/spreed-webrtc/go/buffercache"
 	"github.com/strukturag/spreed-webrtc/go/channelling"
+	"github.com/strukturag/spreed-webrtc/go/plugins"
 )
 
 type fakeClient struct {
@@ -58,7 +62,7 @@ func (fake *fakeRoomManager) RoomUsers(session *channelling.Session) []*channell
 	return fake.roomUsers
 }
 
-func (fake *fakeRoomManager) JoinRoom(id, roomName, roomType string, _ *channelling.DataRoomCredentials, session *channelling.Session, sessionAuthenticated bool, _ channelling.Sender) (*channelling.DataRoom, error) {
+func (fake *fakeRoomManager) JoinRoom(id, roomName, roomType, _ string, _ *channelling.DataRoomCredentials, session *channelling.Session, sessionAuthenticated bool, _ channelling.Sender) (*channelling.DataRoom, error) {
 	fake.joinedID = id
 	return &channelling.DataRoom{Name: roomName, Type: roomType}, fake.joinError
 }
@@ -92,7 +96,10 @@ func NewTestChannellingAPI() (channelling.ChannellingAPI, *fakeClient, *channell
 	sessionNonces := securecookie.New(securecookie.GenerateRandomKey(64), nil)
 	session := channelling.NewSession(nil, nil, roomManager, roomManager, nil, sessionNonces, "", "")
 	busManager := channelling.NewBusManager(apiConsumer, "", false, "")
-	api := New(nil, roomManager, nil, nil, nil, nil, nil, nil, busManager, nil)
+	api := New(nil, Dependencies{
+		RoomStatusManager: roomManager,
+		BusManager:        busManager,
+	})
 	apiConsumer.SetChannellingAPI(api)
 	return api, client, session, roomManager
 }
@@ -241,6 +248,87 @@ func Test_ChannellingAPI_OnIncoming_RoomMessage_RespondsWithAnErrorIfUpdatingThe
 	assertDataError(t, err, "a_room_error")
 }
 
+func Test_ChannellingAPI_OnIncoming_AliveMessage_EchoesTheTimestampAndTracksLatency(t *testing.T) {
+	api, client, session, _ := NewTestChannellingAPI()
+
+	reply, err := api.OnIncoming(client, session, &channelling.DataIncoming{Type: "Alive", Alive: &channelling.DataAlive{Alive: 1389190912092, Rtt: 40}})
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	alive, ok := reply.(*channelling.DataAlive)
+	if !ok || alive.Alive != 1389190912092 || alive.Time == 0 {
+		t.Errorf("Expected Alive reply with the client and server time, but got %#v", reply)
+	}
+
+	api.OnIncoming(client, session, &channelling.DataIncoming{Type: "Alive", Alive: &channelling.DataAlive{Alive: 1389190913092, Rtt: 80}})
+	latency := session.Latency()
+	if latency == nil || latency.Samples != 2 || latency.Last != 80 || latency.Min != 40 || latency.Max != 80 {
+		t.Errorf("Unexpected latency %+v", latency)
+	}
+}
+
+func Test_ChannellingAPI_OnIncoming_IceRestartMessage_RejectsRestartsWithoutPeer(t *testing.T) {
+	api, client, session, _ := NewTestChannellingAPI()
+
+	_, err := api.OnIncoming(client, session, &channelling.DataIncoming{Type: "IceRestart", IceRestart: &channelling.DataIceRestart{Type: "IceRestart"}})
+	assertDataError(t, err, "invalid_ice_restart")
+}
+
+func Test_IceRestarts_CoalescesRequestsOfBothSides(t *testing.T) {
+	restarts := newIceRestarts()
+	now := time.Now()
+	if !restarts.Begin("a", "b", now) {
+		t.Fatal("Expected first restart to begin")
+	}
+	if restarts.Begin("b", "a", now.Add(time.Second)) {
+		t.Error("Expected restart of the peer to be coalesced")
+	}
+	if !restarts.Begin("a", "b", now.Add(iceRestartWindow)) {
+		t.Error("Expected restart after the window to begin")
+	}
+}
+
+func Test_ScreenedCalls_RemembersAllowedPairs(t *testing.T) {
+	calls := newScreenedCalls()
+	calls.Allow("a", "b")
+	calls.Allow("a", "c")
+	if !calls.Allowed("b", "a") {
+		t.Error("Expected the pair to be allowed in both directions")
+	}
+	calls.Forget("b", "a")
+	if calls.Allowed("a", "b") || !calls.Allowed("a", "c") {
+		t.Error("Expected only the forgotten pair to be screened again")
+	}
+	calls.ForgetSession("c")
+	if calls.Allowed("a", "c") || len(calls.pairs) != 0 {
+		t.Errorf("Expected all pairs of the session to be forgotten, but got %v", calls.pairs)
+	}
+}
+
+func Test_ChannellingAPI_OnIncoming_WhisperMessage_RequiresMonitoring(t *testing.T) {
+	api, client, session, _ := NewTestChannellingAPI()
+
+	_, err := api.OnIncoming(client, session, &channelling.DataIncoming{Type: "Whisper", Whisper: &channelling.DataWhisper{Type: "Whisper", To: "agent", Message: "hello"}})
+	assertDataError(t, err, "not_monitoring")
+}
+
+func Test_MonitoredCalls_TracksOneCallPerSupervisor(t *testing.T) {
+	monitored := newMonitoredCalls()
+	first := &monitoredCall{agent: "a", peer: "b"}
+	if previous := monitored.Start("s", first); previous != nil {
+		t.Errorf("Expected no previous call, got %+v", previous)
+	}
+	if !monitored.Monitors("s", "a") || monitored.Monitors("s", "b") || monitored.Monitors("x", "a") {
+		t.Error("Expected the supervisor to whisper only to the agent of its call")
+	}
+	if previous := monitored.Start("s", &monitoredCall{agent: "c", peer: "d"}); previous != first {
+		t.Errorf("Expected the first call to be replaced, got %+v", previous)
+	}
+	if call := monitored.Stop("s"); call == nil || call.agent != "c" || monitored.Monitors("s", "c") {
+		t.Errorf("Expected the call to be stopped, got %+v", call)
+	}
+}
+
 func assertDataError(t *testing.T, err error, code string) {
 	if err == nil {
 		t.Error("Expected an error, but none was returned")
@@ -257,3 +345,106 @@ func assertDataError(t *testing.T, err error, code string) {
 		t.Errorf("Expected error code to be %v, but was %v", code, dataError.Code)
 	}
 }
+
+type byeRecordingUnicaster struct {
+	channelling.Unicaster
+	mutex sync.Mutex
+	byes  []string
+}
+
+func (fake *byeRecordingUnicaster) Unicast(to string, outgoing *channelling.DataOutgoing, _ *channelling.Pipeline) {
+	if _, ok := outgoing.Data.(*channelling.DataBye); ok {
+		fake.mutex.Lock()
+		fake.byes = append(fake.byes, to)
+		fake.mutex.Unlock()
+	}
+}
+
+func Test_ChannellingAPI_HandleEndRoom_SendsOneByePerParticipantAndEmptiesTheRoom(t *testing.T) {
+	config := &channelling.Config{RoomTypeDefault: channelling.RoomTypeRoom}
+	roomManager := channelling.NewRoomManager(config, channelling.NewCodec(0, nil), nil)
+	unicaster := &byeRecordingUnicaster{}
+	sessionNonces := securecookie.New(securecookie.GenerateRandomKey(64), nil)
+	busManager := channelling.NewBusManager(channelling.NewChannellingAPIConsumer(), "", false, "")
+	api := New(config, Dependencies{
+		RoomStatusManager: roomManager,
+		BusManager:        busManager,
+	}).(*channellingAPI)
+
+	var sessions []*channelling.Session
+	for _, id := range []string{"moderator", "first", "second"} {
+		session := channelling.NewSession(nil, unicaster, roomManager, roomManager, nil, sessionNonces, id, id)
+		if _, err := session.JoinRoom("foo", "", "", nil, &fakeClient{}); err != nil {
+			t.Fatalf("Unexpected error joining room: %v", err)
+		}
+		sessions = append(sessions, session)
+	}
+	sessions[0].SetRoomRole(channelling.RoomRoleModerator)
+	room, _ := roomManager.Get(sessions[0].Roomid)
+
+	if _, err := api.HandleEndRoom(sessions[0], &channelling.DataEndRoom{}); err != nil {
+		t.Fatalf("Unexpected error ending room: %v", err)
+	}
+
+	if len(unicaster.byes) != 2 {
+		t.Errorf("Expected one bye for each other participant, but got %v", unicaster.byes)
+	}
+	for _, session := range sessions {
+		if session.Hello {
+			t.Errorf("Expected session %s to have left the room", session.Id)
+		}
+	}
+	for i := 0; len(room.Users()) > 0; i++ {
+		if i == 100 {
+			t.Fatalf("Expected room to be empty, but it has %d users", len(room.Users()))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+type recordingPolicy struct{}
+
+func (policy recordingPolicy) Authorize(request *plugins.PolicyRequest) (*plugins.Decision, error) {
+	if request.Action == channelling.PolicyActionRecord {
+		return &plugins.Decision{Reject: true, Reason: "recording not allowed"}, nil
+	}
+	return nil, nil
+}
+
+func Test_ChannellingAPI_HandleRecording_AsksPolicyEngines(t *testing.T) {
+	serverConn, clientConn := net.Pipe()
+	go plugins.ServeConn("policy", recordingPolicy{}, serverConn)
+	client, err := plugins.NewClient(clientConn, time.Second)
+	if err != nil {
+		t.Fatalf("Could not connect to plugin: %v", err)
+	}
+	host := plugins.NewHost()
+	host.Add(client)
+	defer host.Close()
+
+	config := &channelling.Config{RoomTypeDefault: channelling.RoomTypeRoom}
+	roomManager := channelling.NewRoomManager(config, channelling.NewCodec(0, nil), nil)
+	sessionNonces := securecookie.New(securecookie.GenerateRandomKey(64), nil)
+	api := New(config, Dependencies{
+		RoomStatusManager: roomManager,
+		BusManager:        channelling.NewBusManager(channelling.NewChannellingAPIConsumer(), "", false, ""),
+		Extensions:        channelling.NewPluginExtensions(host),
+	}).(*channellingAPI)
+	session := channelling.NewSession(nil, nil, roomManager, roomManager, nil, sessionNonces, "moderator", "moderator")
+	if _, err := session.JoinRoom("foo", "", "", nil, &fakeClient{}); err != nil {
+		t.Fatalf("Unexpected error joining room: %v", err)
+	}
+	session.SetRoomRole(channelling.RoomRoleModerator)
+	room, _ := roomManager.Get(session.Roomid)
+
+	_, err = api.HandleRecording(session, &channelling.DataRecording{Active: true})
+	if dataErr, ok := err.(*channelling.DataError); !ok || dataErr.Code != "not_authorized" {
+		t.Errorf("Expected not_authorized, but got %v", err)
+	}
+	if room.IsRecording() {
+		t.Error("Expected recording not to be started")
+	}
+	if _, err := api.HandleRecording(session, &channelling.DataRecording{Active: false}); err != nil {
+		t.Errorf("Expected stopping a recording to be allowed, but got %v", err)
+	}
+}
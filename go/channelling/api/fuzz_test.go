@@ -0,0 +1,125 @@
+//go:build go1.18
+// +build go1.18
+
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package api
+
+import (
+	"testing"
+	"time"
+
+	"github.com/strukturag/spreed-webrtc/go/buffercache"
+	"github.com/strukturag/spreed-webrtc/go/channelling"
+)
+
+type fuzzConnection struct{}
+
+func (conn *fuzzConnection) Index() uint64                   { return 0 }
+func (conn *fuzzConnection) Send(buffercache.Buffer)         {}
+func (conn *fuzzConnection) SendPresence(buffercache.Buffer) {}
+func (conn *fuzzConnection) Close()                          {}
+func (conn *fuzzConnection) ReadPump()                       {}
+func (conn *fuzzConnection) WritePump()                      {}
+
+// newFuzzClient wires up the services like the server does and returns a
+// connected client which decodes and dispatches incoming frames.
+func newFuzzClient() *channelling.Client {
+	secret, encryptionSecret := []byte("fuzz-session-secret"), []byte("fuzz-encryption-secret")
+	config := &channelling.Config{DefaultRoomEnabled: true}
+	codec := channelling.NewCodec(1024*1024, channelling.DefaultMessageLimits)
+	apiConsumer := channelling.NewChannellingAPIConsumer()
+	roomLinks := channelling.NewRoomLinks(secret, time.Hour)
+	roomManager := channelling.NewRoomManager(config, codec, roomLinks)
+	hub := channelling.NewHub(config, secret, encryptionSecret, nil, codec)
+	tickets := channelling.NewTickets(secret, encryptionSecret, "fuzz")
+	sessionManager := channelling.NewSessionManager(config, tickets, hub, roomManager, roomManager, channelling.NewImageCache(nil), secret)
+	busManager := channelling.NewBusManager(apiConsumer, "", false, "")
+	pipelineManager := channelling.NewPipelineManager(config, busManager, sessionManager, sessionManager, sessionManager)
+	authLimiter := channelling.NewAuthLimiter(config, busManager)
+	statsManager := channelling.NewStatsManager(hub, roomManager, sessionManager, pipelineManager, authLimiter)
+	blocklist, _ := channelling.NewBlocklist("")
+	api := New(config, Dependencies{
+		RoomStatusManager: roomManager,
+		SessionEncoder:    tickets,
+		SessionManager:    sessionManager,
+		StatsCounter:      statsManager,
+		ContactManager:    hub,
+		TurnDataCreator:   hub,
+		Unicaster:         hub,
+		BusManager:        busManager,
+		PipelineManager:   pipelineManager,
+		RoomLinks:         roomLinks,
+		StepUpManager:     channelling.NewStepUpManager(config, nil, authLimiter),
+		AuthLimiter:       authLimiter,
+		BlobRelay:         channelling.NewBlobRelay(config),
+		Terms:             channelling.NewTerms(config),
+		Blocklist:         blocklist,
+		RoomSearcher:      roomManager,
+	})
+	apiConsumer.SetChannellingAPI(api)
+
+	session := sessionManager.CreateSession(nil, "")
+	client := channelling.NewClient(codec, api, session)
+	client.OnConnect(&fuzzConnection{})
+	return client
+}
+
+var fuzzSeeds = []string{
+	`{"Type":"Self"}`,
+	`{"Type":"Hello","Hello":{"Version":"1.0","Ua":"fuzz","Name":"room","Credentials":{"PIN":"1234"}}}`,
+	`{"Type":"Offer","Offer":{"To":"a","Offer":{"type":"offer","sdp":""}}}`,
+	`{"Type":"Answer","Answer":{"To":"a","Answer":{"_token":"screenshare_a_1"}}}`,
+	`{"Type":"Candidate","Candidate":{"To":"a","Candidate":{}}}`,
+	`{"Type":"Bye","Bye":{"To":"a"}}`,
+	`{"Type":"Status","Status":{"Status":{"displayName":"fuzz"}}}`,
+	`{"Type":"Chat","Chat":{"To":"","Chat":{"Message":"hi","Mid":"1","Status":{"Typing":"start"}}}}`,
+	`{"Type":"Conference","Conference":{"Id":"c","Conference":["a","b"]}}`,
+	`{"Type":"Alive","Alive":{"Alive":1,"Rtt":10}}`,
+	`{"Type":"Sessions","Sessions":{"Sessions":{"Type":"session","Token":"x"}}}`,
+	`{"Type":"Room","Room":{"Name":"room","Credentials":{"PIN":""}}}`,
+	`{"Type":"RoomLink","RoomLink":{"Role":"guest","Ttl":60}}`,
+	`{"Type":"BlobChunk","BlobChunk":{"To":"a","Id":"b","Index":0,"Total":1,"Data":"AA=="}}`,
+	`{"Type":"Follow","Follow":{"Url":"https://example.com","Slide":1}}`,
+	`{"Type":"Volatile","Volatile":{"Key":"k","Data":1}}`,
+	`{"Type":"Bandwidth","Bandwidth":{"Send":100,"Receive":100}}`,
+	`{"Type":"Timer","Timer":{"Duration":60,"Label":"t"}}`,
+	`{"Type":"IceRestart","IceRestart":{"To":"a","Reason":"r"}}`,
+	`{"Type":"NetworkChange","NetworkChange":{"Network":"wifi","Peers":["a"]}}`,
+	`{"Type":"Permissions","Permissions":{"Chat":"users"}}`,
+	`{"Type":"Block","Block":{"Userid":"u","Block":true}}`,
+	`{"Type":"Mute","Mute":{"Audio":true}}`,
+	`{"Type":"Leave"}`,
+}
+
+func FuzzClientOnText(f *testing.F) {
+	for _, seed := range fuzzSeeds {
+		f.Add([]byte(seed))
+	}
+	client := newFuzzClient()
+	f.Fuzz(func(t *testing.T, data []byte) {
+		b := client.NewBuffer()
+		b.Write(data)
+		client.OnText(b)
+		b.Decref()
+	})
+}
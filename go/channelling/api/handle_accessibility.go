@@ -0,0 +1,60 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package api
+
+import (
+	"github.com/strukturag/spreed-webrtc/go/channelling"
+)
+
+func (api *channellingAPI) HandleAccessibility(session *channelling.Session, accessibility *channelling.DataAccessibility) (*channelling.DataAccessibility, error) {
+	kinds := []string{}
+	seen := make(map[string]bool)
+	for _, kind := range accessibility.Subscribe {
+		switch kind {
+		case channelling.AccessibilityCaption, channelling.AccessibilityDescription:
+		default:
+			return nil, channelling.NewDataError("invalid_accessibility_kind", "Unknown kind of accessibility events")
+		}
+		if !seen[kind] {
+			seen[kind] = true
+			kinds = append(kinds, kind)
+		}
+	}
+
+	session.SetAccessibility(kinds)
+	return &channelling.DataAccessibility{Type: "Accessibility", Subscribe: kinds}, nil
+}
+
+func (api *channellingAPI) HandleAccessibilityEvent(session *channelling.Session, event *channelling.DataAccessibilityEvent) error {
+	if _, ok := api.RoomStatusManager.Get(session.Roomid); !session.Hello || !ok {
+		return channelling.NewDataError("not_in_room", "Accessibility events can only be sent to the current room")
+	}
+
+	session.Broadcast(&channelling.DataAccessibilityEvent{
+		Type:     "AccessibilityEvent",
+		Kind:     event.Kind,
+		Text:     event.Text,
+		Language: event.Language,
+		Final:    event.Final,
+	})
+	return nil
+}
@@ -0,0 +1,53 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package api
+
+import (
+	"time"
+
+	"github.com/strukturag/spreed-webrtc/go/channelling"
+)
+
+// Upper bound for round trip times reported by clients in milliseconds.
+const maxAliveRtt = 60000
+
+var serverStarted = time.Now()
+
+// serverTime returns the server wall clock time and the monotonic time since
+// the server started, both in milliseconds.
+func serverTime() (int64, int64) {
+	now := time.Now()
+	return now.UnixNano() / int64(time.Millisecond), int64(now.Sub(serverStarted) / time.Millisecond)
+}
+
+func (api *channellingAPI) HandleAlive(session *channelling.Session, alive *channelling.DataAlive) *channelling.DataAlive {
+	if alive.Rtt > 0 && alive.Rtt <= maxAliveRtt {
+		session.UpdateLatency(alive.Rtt)
+	}
+
+	data := &channelling.DataAlive{
+		Type:  "Alive",
+		Alive: alive.Alive,
+	}
+	data.Time, data.Mono = serverTime()
+	return data
+}
@@ -28,7 +28,12 @@ import (
 )
 
 func (api *channellingAPI) HandleAuthentication(session *channelling.Session, st *channelling.SessionToken) (*channelling.DataSelf, error) {
-	if err := api.SessionManager.Authenticate(session, st, ""); err != nil {
+	if err := api.authAllowed(session, ""); err != nil {
+		return nil, err
+	}
+	err := api.SessionManager.Authenticate(session, st, "")
+	api.authResult(session, "", err, "invalid_session_token")
+	if err != nil {
 		log.Println("Authentication failed", err, st.Userid, st.Nonce)
 		return nil, err
 	}
@@ -41,3 +46,30 @@ func (api *channellingAPI) HandleAuthentication(session *channelling.Session, st
 
 	return self, err
 }
+
+func (api *channellingAPI) authAllowed(session *channelling.Session, roomID string) error {
+	if api.AuthLimiter == nil {
+		return nil
+	}
+	return api.AuthLimiter.AuthAllowed(session.RemoteIP, roomID)
+}
+
+// authResult reports the outcome of an authentication attempt to the
+// AuthLimiter. Only errors with one of the given codes count as failure.
+func (api *channellingAPI) authResult(session *channelling.Session, roomID string, err error, codes ...string) {
+	if api.AuthLimiter == nil {
+		return
+	}
+	if err == nil {
+		api.AuthLimiter.AuthSucceeded(session.RemoteIP, roomID)
+		return
+	}
+	if dataError, ok := err.(*channelling.DataError); ok {
+		for _, code := range codes {
+			if dataError.Code == code {
+				api.AuthLimiter.AuthFailed(session.RemoteIP, roomID, code)
+				return
+			}
+		}
+	}
+}
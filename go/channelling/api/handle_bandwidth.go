@@ -0,0 +1,51 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package api
+
+import (
+	"github.com/strukturag/spreed-webrtc/go/channelling"
+)
+
+// maxBandwidthEstimate is the largest accepted estimate in kbit/s.
+const maxBandwidthEstimate = 10000000
+
+func (api *channellingAPI) HandleBandwidth(session *channelling.Session, bandwidth *channelling.DataBandwidth) (*channelling.DataBandwidthCap, error) {
+	room, ok := api.RoomStatusManager.Get(session.Roomid)
+	if !session.Hello || !ok {
+		return nil, channelling.NewDataError("not_in_room", "Bandwidth reports can only be sent to the current room")
+	}
+	if bandwidth.Send < 0 || bandwidth.Send > maxBandwidthEstimate || bandwidth.Receive < 0 || bandwidth.Receive > maxBandwidthEstimate {
+		return nil, channelling.NewDataError("invalid_bandwidth", "The bandwidth estimate is not valid")
+	}
+
+	videoCap, changed := room.SetBandwidth(session.Id, &channelling.DataBandwidth{
+		Type:    "Bandwidth",
+		Send:    bandwidth.Send,
+		Receive: bandwidth.Receive,
+	})
+	if !changed {
+		return nil, nil
+	}
+	session.Broadcast(videoCap)
+
+	return videoCap, nil
+}
@@ -0,0 +1,83 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package api
+
+import (
+	"log"
+
+	"github.com/strukturag/spreed-webrtc/go/channelling"
+)
+
+func (api *channellingAPI) HandleBlobChunk(session *channelling.Session, chunk *channelling.DataBlobChunk) error {
+	if api.BlobRelay == nil {
+		return channelling.NewDataError("blobs_disabled", "Blobs are not enabled")
+	}
+	if err := api.checkPermission(session, channelling.RoomPermissionFileTransfer); err != nil {
+		return err
+	}
+
+	blob, err := api.BlobRelay.AddBlobChunk(session.Id, chunk)
+	if err != nil || blob == nil {
+		return err
+	}
+
+	if api.BlobScanner == nil {
+		if err := api.BlobRelay.StoreBlob(blob); err != nil {
+			return err
+		}
+		session.Unicast(blob.To, blob, nil)
+		return nil
+	}
+
+	// Recipients only receive blobs which were approved by the scanner.
+	api.sendBlobStatus(session, blob, channelling.BlobStatusScanning, "")
+	go func() {
+		result, err := api.BlobScanner.ScanBlob(session.Id, blob)
+		switch {
+		case err != nil:
+			api.sendBlobStatus(session, blob, channelling.BlobStatusFailed, "")
+		case !result.Clean:
+			log.Printf("Rejected blob %s of session %s: %s\n", blob.Id, session.Id, result.Reason)
+			api.sendBlobStatus(session, blob, channelling.BlobStatusRejected, result.Reason)
+		case api.BlobRelay.StoreBlob(blob) != nil:
+			api.sendBlobStatus(session, blob, channelling.BlobStatusFailed, "")
+		default:
+			session.Unicast(blob.To, blob, nil)
+			api.sendBlobStatus(session, blob, channelling.BlobStatusApproved, "")
+		}
+	}()
+	return nil
+}
+
+// sendBlobStatus tells the sender and the recipient of blob about its
+// scan status.
+func (api *channellingAPI) sendBlobStatus(session *channelling.Session, blob *channelling.DataBlob, status, reason string) {
+	data := &channelling.DataBlobStatus{
+		Type:   "BlobStatus",
+		Id:     blob.Id,
+		To:     blob.To,
+		Status: status,
+		Reason: reason,
+	}
+	api.Unicaster.Unicast(session.Id, &channelling.DataOutgoing{To: session.Id, Data: data}, nil)
+	session.Unicast(blob.To, data, nil)
+}
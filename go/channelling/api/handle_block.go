@@ -0,0 +1,51 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package api
+
+import (
+	"github.com/strukturag/spreed-webrtc/go/channelling"
+)
+
+func (api *channellingAPI) HandleBlock(session *channelling.Session, block *channelling.DataBlock) (*channelling.DataBlock, error) {
+	if api.Blocklist == nil {
+		return nil, channelling.NewDataError("blocking_disabled", "Blocking users is not enabled")
+	}
+	userid := session.Userid()
+	if userid == "" {
+		return nil, channelling.NewDataError("not_authenticated", "Only authenticated users can block other users")
+	}
+
+	var blocked []string
+	switch {
+	case block.Userid == "":
+		blocked = api.Blocklist.Blocked(userid)
+	case block.Block:
+		var err error
+		if blocked, err = api.Blocklist.Block(userid, block.Userid); err != nil {
+			return nil, err
+		}
+	default:
+		blocked = api.Blocklist.Unblock(userid, block.Userid)
+	}
+
+	return &channelling.DataBlock{Type: "Block", Blocked: blocked}, nil
+}
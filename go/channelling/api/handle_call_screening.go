@@ -0,0 +1,140 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package api
+
+import (
+	"log"
+	"sync"
+
+	"github.com/strukturag/spreed-webrtc/go/channelling"
+)
+
+// screenedCalls remembers the session pairs whose calls were allowed by the
+// call screening, so renegotiations of running calls are not screened
+// again. Pairs are forgotten on Bye and disconnect.
+type screenedCalls struct {
+	sync.Mutex
+	pairs map[string]map[string]bool
+}
+
+func newScreenedCalls() *screenedCalls {
+	return &screenedCalls{pairs: make(map[string]map[string]bool)}
+}
+
+func (calls *screenedCalls) Allowed(a, b string) bool {
+	calls.Lock()
+	defer calls.Unlock()
+	return calls.pairs[a][b]
+}
+
+func (calls *screenedCalls) Allow(a, b string) {
+	calls.Lock()
+	defer calls.Unlock()
+	calls.add(a, b)
+	calls.add(b, a)
+}
+
+func (calls *screenedCalls) add(a, b string) {
+	peers, ok := calls.pairs[a]
+	if !ok {
+		peers = make(map[string]bool)
+		calls.pairs[a] = peers
+	}
+	peers[b] = true
+}
+
+func (calls *screenedCalls) Forget(a, b string) {
+	calls.Lock()
+	defer calls.Unlock()
+	calls.remove(a, b)
+	calls.remove(b, a)
+}
+
+func (calls *screenedCalls) remove(a, b string) {
+	if peers, ok := calls.pairs[a]; ok {
+		delete(peers, b)
+		if len(peers) == 0 {
+			delete(calls.pairs, a)
+		}
+	}
+}
+
+func (calls *screenedCalls) ForgetSession(id string) {
+	calls.Lock()
+	defer calls.Unlock()
+	for peer := range calls.pairs[id] {
+		calls.remove(peer, id)
+	}
+	delete(calls.pairs, id)
+}
+
+// screenCall asks the call screener about the call of session to the
+// session with id to. It returns false if the offer must not be relayed,
+// the caller has been told why then.
+func (api *channellingAPI) screenCall(session *channelling.Session, to string) bool {
+	if api.CallScreener == nil || api.screenedCalls.Allowed(session.Id, to) {
+		return true
+	}
+
+	callee, _ := api.SessionManager.GetSession(to)
+	input := channelling.NewCallScreeningInput(session, callee, to)
+	room, inRoom := api.RoomStatusManager.Get(session.Roomid)
+	if inRoom {
+		input.Occupancy = len(room.SessionIDs())
+	}
+	decision := api.CallScreener.ScreenCall(input)
+	if decision.Action == channelling.CallScreeningRedirect && decision.Redirect == "" && inRoom {
+		for _, user := range room.Users() {
+			if user.Id != session.Id && user.Id != to && user.Userid() == decision.RedirectUser {
+				decision.Redirect = user.Id
+				break
+			}
+		}
+	}
+	if decision.Action == channelling.CallScreeningRedirect {
+		target, ok := api.SessionManager.GetSession(decision.Redirect)
+		if !ok || target.Id == session.Id || target.Id == to || target.Roomid != session.Roomid {
+			decision = &channelling.CallScreeningDecision{Action: channelling.CallScreeningReject, Reason: "redirect_unavailable"}
+		}
+	}
+	if decision.Action == channelling.CallScreeningAllow {
+		api.screenedCalls.Allow(session.Id, to)
+		return true
+	}
+
+	log.Printf("Call of session %s to %s screened: %s %s\n", session.Id, to, decision.Action, decision.Reason)
+	if api.trackable(session, to) {
+		api.BusManager.Trigger(channelling.BusManagerCallScreened, session.Id, to, decision, nil)
+	}
+	api.Unicaster.Unicast(session.Id, &channelling.DataOutgoing{
+		To: session.Id,
+		Data: &channelling.DataCallScreening{
+			Type:     "CallScreening",
+			To:       to,
+			Action:   decision.Action,
+			Reason:   decision.Reason,
+			Message:  decision.Message,
+			Redirect: decision.Redirect,
+		},
+	}, nil)
+	return false
+}
@@ -22,36 +22,101 @@
 package api
 
 import (
+	"fmt"
 	"log"
 	"time"
 
 	"github.com/strukturag/spreed-webrtc/go/channelling"
 )
 
-func (api *channellingAPI) HandleChat(session *channelling.Session, chat *channelling.DataChat) {
-	// TODO(longsleep): Limit sent chat messages per incoming connection.
+func (api *channellingAPI) HandleChat(session *channelling.Session, chat *channelling.DataChat) error {
 	msg := chat.Chat
 	to := chat.To
 
+	if to == "" {
+		// Room templates may disable the room chat.
+		if room, ok := api.RoomStatusManager.Get(session.Roomid); ok && !room.GetTemplate().HasFeature(channelling.RoomFeatureChat) {
+			return nil
+		}
+	}
+
+	switch {
+	case msg.Status == nil:
+		if err := api.checkPermission(session, channelling.RoomPermissionChat); err != nil {
+			return err
+		}
+	case msg.Status.FileInfo != nil:
+		if err := api.checkPermission(session, channelling.RoomPermissionFileTransfer); err != nil {
+			return err
+		}
+	}
+
+	muted := false
+	if api.SpamFilter != nil && msg.Status == nil {
+		if verdict := api.SpamFilter.Check(session.Id, msg.Message); verdict != nil {
+			if verdict.Started {
+				api.notifySpam(session, verdict)
+			}
+			if verdict.Action == channelling.SpamActionThrottle {
+				retry := verdict.Until.Sub(time.Now())/time.Second + 1
+				return channelling.NewDataError("chat_throttled", fmt.Sprintf("Too many chat messages, retry in %d seconds", retry))
+			}
+			// Muted sessions are not told, their messages are only
+			// echoed back to them.
+			muted = true
+		}
+	}
+
+	if api.ChatFilter != nil && !muted && msg.Status == nil && msg.Message != "" && api.chatFilterEnabled(session) {
+		if result := api.ChatFilter.FilterChat(session, to, msg.Message); result != nil {
+			if result.Reject {
+				return channelling.NewDataError("chat_rejected", "The chat message was rejected by the content filter")
+			}
+			if result.Message != "" {
+				msg.Message = result.Message
+			}
+			if result.Flag {
+				flag := &channelling.DataChatFlag{
+					Type:   "ChatFlag",
+					Id:     session.Id,
+					Userid: session.Userid(),
+					Reason: result.Reason,
+				}
+				if to == "" {
+					// Only room chat is shown to moderators.
+					flag.Message = msg.Message
+				}
+				log.Printf("Chat message of session %s was flagged (%s)\n", session.Id, result.Reason)
+				api.notifyModerators(session, flag)
+			}
+		}
+	}
+
 	if !msg.NoEcho {
 		session.Unicast(session.Id, chat, nil)
 	}
 	msg.Time = time.Now().Format(time.RFC3339)
+	if muted {
+		return nil
+	}
 	if to == "" {
 		// TODO(longsleep): Check if chat broadcast is allowed.
 		if session.Hello {
 			api.StatsCounter.CountBroadcastChat()
 			session.Broadcast(chat)
+			if msg.Status == nil && msg.Message != "" {
+				api.indexChat(session, msg)
+			}
 		}
 	} else {
 		if msg.Status != nil {
 			if msg.Status.ContactRequest != nil {
 				if !api.config.WithModule("contacts") {
-					return
+					return nil
 				}
 				if err := api.ContactManager.ContactrequestHandler(session, to, msg.Status.ContactRequest); err != nil {
 					log.Println("Ignoring invalid contact request.", err)
-					return
+					return nil
 				}
 				msg.Status.ContactRequest.Userid = session.Userid()
 			}
@@ -65,4 +130,41 @@ func (api *channellingAPI) HandleChat(session *channelling.Session, chat *channe
 			session.Unicast(session.Id, &channelling.DataChat{To: to, Type: "Chat", Chat: &channelling.DataChatMessage{Mid: msg.Mid, Status: &channelling.DataChatStatus{State: "sent"}}}, nil)
 		}
 	}
+
+	return nil
+}
+
+// chatFilterEnabled returns true if the room of session does not disable
+// the chat filters.
+func (api *channellingAPI) chatFilterEnabled(session *channelling.Session) bool {
+	room, ok := api.RoomStatusManager.Get(session.Roomid)
+	return !ok || room.GetTemplate().HasFeature(channelling.RoomFeatureChatFilter)
+}
+
+// notifySpam tells the moderators in the room of session about its spam
+// penalty.
+func (api *channellingAPI) notifySpam(session *channelling.Session, verdict *channelling.SpamVerdict) {
+	log.Printf("Session %s sent spam (%s), %s until %s\n", session.Id, verdict.Reason, verdict.Action, verdict.Until.Format(time.RFC3339))
+	api.notifyModerators(session, &channelling.DataSpam{
+		Type:   "Spam",
+		Id:     session.Id,
+		Userid: session.Userid(),
+		Action: verdict.Action,
+		Reason: verdict.Reason,
+		Until:  verdict.Until.Unix(),
+	})
+}
+
+// notifyModerators sends data to the moderators in the room of session,
+// except session itself.
+func (api *channellingAPI) notifyModerators(session *channelling.Session, data interface{}) {
+	room, ok := api.RoomStatusManager.Get(session.Roomid)
+	if !ok {
+		return
+	}
+	for _, id := range room.SessionIDs() {
+		if moderator, ok := api.SessionManager.GetSession(id); ok && id != session.Id && isRoomModerator(moderator, room) {
+			api.Unicaster.Unicast(id, &channelling.DataOutgoing{Data: data}, nil)
+		}
+	}
 }
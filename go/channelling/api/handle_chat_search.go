@@ -0,0 +1,69 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package api
+
+import (
+	"time"
+
+	"github.com/strukturag/spreed-webrtc/go/channelling"
+)
+
+// chatIndexEnabled returns true if the chat of the room of session is
+// indexed.
+func (api *channellingAPI) chatIndexEnabled(session *channelling.Session) bool {
+	if api.ChatIndex == nil {
+		return false
+	}
+	room, ok := api.RoomStatusManager.Get(session.Roomid)
+	return ok && room.GetTemplate() != nil && room.GetTemplate().ChatIndex
+}
+
+// indexChat adds the room chat message msg of session to the chat index,
+// if the room enables it. Chat of sessions in privacy mode is not indexed.
+func (api *channellingAPI) indexChat(session *channelling.Session, msg *channelling.DataChatMessage) {
+	if !api.chatIndexEnabled(session) || !api.trackable(session, "") {
+		return
+	}
+	api.ChatIndex.Index(&channelling.ChatIndexEntry{
+		Id:      msg.Mid,
+		Roomid:  session.Roomid,
+		From:    session.Id,
+		Userid:  session.Userid(),
+		Message: msg.Message,
+		Time:    time.Now(),
+	})
+}
+
+func (api *channellingAPI) HandleChatSearch(session *channelling.Session, search *channelling.DataChatSearch) (*channelling.DataChatSearchResult, error) {
+	if _, ok := api.RoomStatusManager.Get(session.Roomid); !session.Hello || !ok {
+		return nil, channelling.NewDataError("not_in_room", "Chat can only be searched in the current room")
+	}
+	if !api.chatIndexEnabled(session) {
+		return nil, channelling.NewDataError("chat_search_disabled", "The chat of this room is not indexed")
+	}
+
+	results, err := api.ChatIndex.Search(session.Roomid, search.Query, search.Limit)
+	if err != nil {
+		return nil, err
+	}
+	return &channelling.DataChatSearchResult{Type: "ChatSearchResult", Query: search.Query, Results: results}, nil
+}
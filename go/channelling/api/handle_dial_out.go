@@ -0,0 +1,44 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package api
+
+import (
+	"github.com/strukturag/spreed-webrtc/go/channelling"
+)
+
+func (api *channellingAPI) HandleDialOut(session *channelling.Session, dialOut *channelling.DataDialOut) (*channelling.DataDialOut, error) {
+	if api.DialOut == nil {
+		return nil, channelling.NewDataError("dialout_disabled", "Dial-out is not available")
+	}
+	room, ok := api.RoomStatusManager.Get(session.Roomid)
+	if !session.Hello || !ok {
+		return nil, channelling.NewDataError("not_in_room", "Phone numbers can only be called into the current room")
+	}
+	if !isRoomModerator(session, room) {
+		return nil, channelling.NewDataError("not_room_moderator", "Only the room owner and moderators can call phone numbers")
+	}
+	if !room.GetTemplate().HasFeature(channelling.RoomFeatureDialOut) {
+		return nil, channelling.NewDataError("feature_disabled", "Dial-out is not enabled for this room")
+	}
+
+	return api.DialOut.Dial(session, dialOut.Number)
+}
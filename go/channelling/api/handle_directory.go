@@ -0,0 +1,54 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package api
+
+import (
+	"github.com/strukturag/spreed-webrtc/go/channelling"
+)
+
+func (api *channellingAPI) HandleDirectory(session *channelling.Session, directory *channelling.DataDirectory) (*channelling.DataDirectory, error) {
+	if api.UserDirectory == nil {
+		return nil, channelling.NewDataError("directory_disabled", "The user directory is not available")
+	}
+	userid := session.Userid()
+	if userid == "" {
+		return nil, channelling.NewDataError("not_authenticated", "Only authenticated users can be listed in the user directory")
+	}
+	if !channelling.ValidDiscoverability(directory.Discoverability) {
+		return nil, channelling.NewDataError("invalid_discoverability", "Discoverability must be hidden, email or public")
+	}
+
+	api.UserDirectory.SetDiscoverability(userid, directory.Discoverability)
+	return &channelling.DataDirectory{Type: "Directory", Discoverability: api.UserDirectory.Discoverability(userid)}, nil
+}
+
+func (api *channellingAPI) HandleDirectorySearch(session *channelling.Session, search *channelling.DataDirectorySearch) (*channelling.DataDirectorySearchResult, error) {
+	if api.UserDirectory == nil {
+		return nil, channelling.NewDataError("directory_disabled", "The user directory is not available")
+	}
+
+	users, err := api.UserDirectory.Search(session.Userid(), search.Query, search.EmailHash, search.Limit)
+	if err != nil {
+		return nil, err
+	}
+	return &channelling.DataDirectorySearchResult{Type: "DirectorySearchResult", Users: users}, nil
+}
@@ -0,0 +1,43 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package api
+
+import (
+	"github.com/strukturag/spreed-webrtc/go/channelling"
+)
+
+// HandleDtmf relays DTMF tones to the peer of a call. Calls to gateways run
+// through pipelines, so the tones reach the SIP or PSTN leg and the bus
+// event is recorded with the call.
+func (api *channellingAPI) HandleDtmf(sender channelling.Sender, session *channelling.Session, dtmf *channelling.DataDtmf) error {
+	if err := channelling.NormalizeDtmf(dtmf); err != nil {
+		return err
+	}
+
+	pipeline := api.PipelineManager.GetPipeline(channelling.PipelineNamespaceCall, sender, session, dtmf.To)
+	if api.trackable(session, dtmf.To) {
+		api.BusManager.Trigger(channelling.BusManagerDtmf, session.Id, dtmf.To, dtmf.Event(), pipeline)
+	}
+
+	session.Unicast(dtmf.To, dtmf, pipeline)
+	return nil
+}
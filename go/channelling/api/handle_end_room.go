@@ -0,0 +1,90 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package api
+
+import (
+	"log"
+
+	"github.com/strukturag/spreed-webrtc/go/channelling"
+)
+
+func (api *channellingAPI) HandleEndRoom(session *channelling.Session, endRoom *channelling.DataEndRoom) (*channelling.DataEndRoom, error) {
+	room, ok := api.RoomStatusManager.Get(session.Roomid)
+	if !session.Hello || !ok {
+		return nil, channelling.NewDataError("not_in_room", "Only the current room can be ended")
+	}
+
+	if !isRoomModerator(session, room) {
+		return nil, channelling.NewDataError("not_room_moderator", "Only the room owner and moderators can end the room")
+	}
+	if api.StepUpManager != nil {
+		if err := api.StepUpManager.RequireStepUp(session, channelling.StepUpActionEndRoom); err != nil {
+			return nil, err
+		}
+	}
+
+	if endRoom.Lock {
+		room.SetLocked(true)
+	}
+
+	// Tell all participants that the room has ended and hang up their
+	// calls with one Bye for each participant rather than one for every
+	// pair, then take everyone out of the room.
+	roomID := session.Roomid
+	users := room.Users()
+	data := &channelling.DataEndRoom{Type: "EndRoom", Lock: endRoom.Lock}
+	session.Broadcast(data)
+	for _, user := range users {
+		if user.Id != session.Id {
+			session.Unicast(user.Id, &channelling.DataBye{
+				Type: "Bye",
+				To:   user.Id,
+				Bye:  map[string]interface{}{"Reason": "endroom"},
+			}, nil)
+		}
+	}
+	for _, user := range users {
+		user.Session.EndRoom(roomID)
+	}
+
+	log.Printf("Room %s ended by session %s with %d sessions\n", roomID, session.Id, len(users))
+	if api.trackable(session, "") {
+		api.BusManager.Trigger(channelling.BusManagerEndRoom, session.Id, roomID, &channelling.EndRoomEvent{
+			Roomid:   roomID,
+			From:     session.Id,
+			Userid:   session.Userid(),
+			Sessions: len(users),
+			Locked:   endRoom.Lock,
+		}, nil)
+	}
+
+	return data, nil
+}
+
+// isRoomModerator returns true if session may moderate room, which is the
+// case for the room owner and sessions with the moderator role.
+func isRoomModerator(session *channelling.Session, room channelling.RoomWorker) bool {
+	if owner := room.GetOwner(); owner != "" && owner == session.Userid() {
+		return true
+	}
+	return session.RoomRole() == channelling.RoomRoleModerator
+}
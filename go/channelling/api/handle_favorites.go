@@ -0,0 +1,86 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package api
+
+import (
+	"github.com/strukturag/spreed-webrtc/go/channelling"
+)
+
+func (api *channellingAPI) HandleFavorites(session *channelling.Session, favorites *channelling.DataFavorites) (*channelling.DataFavorites, error) {
+	if api.Favorites == nil {
+		return nil, channelling.NewDataError("favorites_disabled", "Favorites are not enabled")
+	}
+	userid := session.Userid()
+	if userid == "" {
+		return nil, channelling.NewDataError("not_authenticated", "Only authenticated users have favorites")
+	}
+
+	switch {
+	case favorites.Favorite == nil:
+		return api.Favorites.Favorites(userid), nil
+	case favorites.Pin:
+		return api.Favorites.Pin(userid, favorites.Favorite)
+	default:
+		return api.Favorites.Unpin(userid, favorites.Favorite), nil
+	}
+}
+
+// addRecentRoom records room as recent room of the user of session.
+func (api *channellingAPI) addRecentRoom(session *channelling.Session, room *channelling.DataRoom) {
+	if api.Favorites == nil || room == nil || room.Name == "" {
+		return
+	}
+	api.Favorites.AddRecent(session.Userid(), &channelling.DataFavorite{
+		Kind: channelling.FavoriteRoom,
+		Id:   room.Name,
+		Type: room.Type,
+		Name: room.Name,
+	})
+}
+
+// addRecentCall records an answered call between the users of session and
+// of the session to as recent call of both users. Calls with anonymous or
+// remote sessions are not recorded for the unknown side.
+func (api *channellingAPI) addRecentCall(session *channelling.Session, to string) {
+	if api.Favorites == nil || api.SessionManager == nil {
+		return
+	}
+	peer, ok := api.SessionManager.GetSession(to)
+	if !ok {
+		return
+	}
+	own := session.Data()
+	other := peer.Data()
+	if own.Userid == "" || other.Userid == "" || own.Userid == other.Userid {
+		return
+	}
+	api.Favorites.AddRecent(own.Userid, &channelling.DataFavorite{
+		Kind: channelling.FavoriteCall,
+		Id:   other.Userid,
+		Name: channelling.DisplayName(other),
+	})
+	api.Favorites.AddRecent(other.Userid, &channelling.DataFavorite{
+		Kind: channelling.FavoriteCall,
+		Id:   own.Userid,
+		Name: channelling.DisplayName(own),
+	})
+}
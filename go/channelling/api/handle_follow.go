@@ -0,0 +1,68 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package api
+
+import (
+	"net/url"
+
+	"github.com/strukturag/spreed-webrtc/go/channelling"
+)
+
+const maxFollowUrlLength = 2048
+
+func (api *channellingAPI) HandleFollow(session *channelling.Session, follow *channelling.DataFollow) (*channelling.DataFollow, error) {
+	room, ok := api.RoomStatusManager.Get(session.Roomid)
+	if !session.Hello || !ok {
+		return nil, channelling.NewDataError("not_in_room", "Follow requests can only be sent to the current room")
+	}
+	if !isRoomModerator(session, room) {
+		return nil, channelling.NewDataError("not_room_moderator", "Only the room owner and moderators can send follow requests")
+	}
+
+	if follow.Url != "" {
+		if len(follow.Url) > maxFollowUrlLength {
+			return nil, channelling.NewDataError("invalid_follow", "The URL is too long")
+		}
+		u, err := url.Parse(follow.Url)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, channelling.NewDataError("invalid_follow", "Only absolute http and https URLs can be followed")
+		}
+	}
+	if follow.Slide < 0 {
+		return nil, channelling.NewDataError("invalid_follow", "The slide number must not be negative")
+	}
+	if follow.Url == "" && follow.Slide == 0 {
+		return nil, channelling.NewDataError("invalid_follow", "Follow requests need a URL or a slide")
+	}
+
+	data := &channelling.DataFollow{
+		Type:  "Follow",
+		Url:   follow.Url,
+		Slide: follow.Slide,
+	}
+	if err := room.SetFollow(data, api.config.FollowInterval); err != nil {
+		return nil, err
+	}
+	session.Broadcast(data)
+
+	return data, nil
+}
@@ -28,6 +28,15 @@ import (
 func (api *channellingAPI) HandleHello(session *channelling.Session, hello *channelling.DataHello, sender channelling.Sender) (*channelling.DataWelcome, error) {
 	// TODO(longsleep): Filter room id and user agent.
 	session.Update(&channelling.SessionUpdate{Types: []string{"Ua"}, Ua: hello.Ua})
+	if hello.Locale != "" {
+		session.SetLocale(channelling.NormalizeLocale(hello.Locale))
+	}
+
+	if api.Terms != nil {
+		if err := api.Terms.Check(session, hello.Terms); err != nil {
+			return nil, err
+		}
+	}
 
 	// Compatibily for old clients.
 	roomName := hello.Name
@@ -35,20 +44,76 @@ func (api *channellingAPI) HandleHello(session *channelling.Session, hello *chan
 		roomName = hello.Id
 	}
 
-	room, err := session.JoinRoom(roomName, hello.Type, hello.Credentials, sender)
+	roomType := hello.Type
+	if hello.Template != "" && roomType == "" {
+		// Rooms created from a template get the type of the template.
+		if template, ok := api.config.RoomTemplates[hello.Template]; ok {
+			roomType = template.Type
+		}
+	}
+
+	roomID := api.RoomStatusManager.MakeRoomID(roomName, roomType)
+	// Only joins with credentials are authentication attempts. Check them
+	// first, so locked out clients do not reach the extensions.
+	if hello.Credentials != nil {
+		if err := api.authAllowed(session, roomID); err != nil {
+			return nil, err
+		}
+	}
+
+	var role string
+	if api.Extensions != nil {
+		var err error
+		if role, err = api.Extensions.CheckRoom(roomID, roomName, roomType, session); err != nil {
+			return nil, err
+		}
+	}
+
+	room, err := session.JoinRoom(roomName, roomType, hello.Template, hello.Credentials, sender)
+	if hello.Credentials != nil {
+		api.authResult(session, roomID, err, "invalid_credentials", "invalid_room_link")
+	}
 	if err != nil {
 		return nil, err
 	}
+	if role != "" {
+		session.SetRoomRole(role)
+	}
+	api.addRecentRoom(session, room)
 
-	return &channelling.DataWelcome{
+	welcome := &channelling.DataWelcome{
 		Type:  "Welcome",
 		Room:  room,
 		Users: api.RoomStatusManager.RoomUsers(session),
-	}, nil
+	}
+	welcome.Time, welcome.Mono = serverTime()
+	if api.Extensions != nil {
+		welcome.Extras = api.Extensions.Extras("Welcome", session)
+	}
+	if roomWorker, ok := api.RoomStatusManager.Get(session.Roomid); ok {
+		welcome.Mute = roomWorker.GetMute()
+		welcome.Permissions = roomWorker.GetPermissions()
+		welcome.Follow = roomWorker.GetFollow()
+		welcome.Timer = roomWorker.GetTimer()
+		welcome.Volatile = roomWorker.GetVolatile()
+		welcome.Bandwidth = roomWorker.GetBandwidthCap()
+		welcome.MediaMode = roomWorker.GetMediaMode()
+		if roomWorker.IsRecording() {
+			welcome.Recording = &channelling.DataRecording{Type: "Recording", Active: true}
+			api.checkRecordingConsents(session.Roomid, session.Id)
+		}
+	}
+
+	return welcome, nil
 }
 
 func (api *channellingAPI) HelloProcessed(sender channelling.Sender, session *channelling.Session, msg *channelling.DataIncoming, reply interface{}, err error) {
 	if err == nil {
 		api.SendConferenceRoomUpdate(session)
+		if api.Announcements != nil {
+			for _, announcement := range api.Announcements.Motd(session) {
+				api.Unicaster.Unicast(session.Id, &channelling.DataOutgoing{Data: announcement}, nil)
+			}
+		}
 	}
 }
@@ -0,0 +1,113 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package api
+
+import (
+	"sync"
+	"time"
+
+	"github.com/strukturag/spreed-webrtc/go/channelling"
+)
+
+const (
+	iceRestartWindow    = 5 * time.Second // Requests of a pair within this time are one restart.
+	maxIceRestartReason = 64
+)
+
+// iceRestarts remembers recent ICE restarts of session pairs, so requests
+// of both sides for the same network change result in a single restart.
+type iceRestarts struct {
+	sync.Mutex
+	pairs map[string]time.Time
+}
+
+func newIceRestarts() *iceRestarts {
+	return &iceRestarts{pairs: make(map[string]time.Time)}
+}
+
+// Begin returns false if a restart of the pair started within the window.
+func (restarts *iceRestarts) Begin(a, b string, now time.Time) bool {
+	if b < a {
+		a, b = b, a
+	}
+	key := a + "|" + b
+	restarts.Lock()
+	defer restarts.Unlock()
+	if started, ok := restarts.pairs[key]; ok && now.Sub(started) < iceRestartWindow {
+		return false
+	}
+	for pair, started := range restarts.pairs {
+		if now.Sub(started) >= iceRestartWindow {
+			delete(restarts.pairs, pair)
+		}
+	}
+	restarts.pairs[key] = now
+	return true
+}
+
+func (api *channellingAPI) HandleIceRestart(sender channelling.Sender, session *channelling.Session, iceRestart *channelling.DataIceRestart) (*channelling.DataIceRestart, error) {
+	if iceRestart.To == "" || iceRestart.To == session.Id {
+		return nil, channelling.NewDataError("invalid_ice_restart", "The ICE restart has no valid peer")
+	}
+	if len(iceRestart.Reason) > maxIceRestartReason {
+		return nil, channelling.NewDataError("invalid_ice_restart", "The ICE restart reason is too long")
+	}
+
+	return api.restartIce(sender, session, iceRestart.To, iceRestart.Reason), nil
+}
+
+// restartIce coordinates the ICE restart of the call between session and
+// the peer to, and returns the decision for session.
+func (api *channellingAPI) restartIce(sender channelling.Sender, session *channelling.Session, to, reason string) *channelling.DataIceRestart {
+	// The session with the lower id sends the offer, like when joining
+	// conferences. This avoids glare when both sides request a restart.
+	offerer := session.Id
+	if to < offerer {
+		offerer = to
+	}
+	reply := &channelling.DataIceRestart{
+		Type:   "IceRestart",
+		To:     to,
+		Reason: reason,
+		Offer:  offerer == session.Id,
+	}
+	if !api.iceRestarts.Begin(session.Id, to, time.Now()) {
+		// The peer already requested the restart and knows its role.
+		return reply
+	}
+
+	pipeline := api.PipelineManager.GetPipeline(channelling.PipelineNamespaceCall, sender, session, to)
+	if api.trackable(session, to) {
+		api.BusManager.Trigger(channelling.BusManagerIceRestart, session.Id, to, &channelling.IceRestartEvent{
+			Offerer: offerer,
+			Reason:  reason,
+		}, pipeline)
+	}
+	session.Unicast(to, &channelling.DataIceRestart{
+		Type:   "IceRestart",
+		To:     to,
+		Reason: reason,
+		Offer:  offerer == to,
+	}, pipeline)
+
+	return reply
+}
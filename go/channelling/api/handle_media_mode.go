@@ -0,0 +1,38 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package api
+
+import (
+	"github.com/strukturag/spreed-webrtc/go/channelling"
+)
+
+// HandleMediaMode records that the session is ready for the prepared media
+// mode switch of its room.
+func (api *channellingAPI) HandleMediaMode(session *channelling.Session, mode *channelling.DataMediaMode) error {
+	room, ok := api.RoomStatusManager.Get(session.Roomid)
+	if !session.Hello || !ok {
+		return channelling.NewDataError("not_in_room", "Media mode switches can only be confirmed for the current room")
+	}
+
+	room.SetMediaModeReady(session.Id, mode.Sequence)
+	return nil
+}
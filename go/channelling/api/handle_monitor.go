@@ -0,0 +1,142 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package api
+
+import (
+	"log"
+	"sync"
+
+	"github.com/strukturag/spreed-webrtc/go/channelling"
+)
+
+// monitoredCall is a call monitored by a supervisor through the pipelines
+// of both directions.
+type monitoredCall struct {
+	agent     string
+	peer      string
+	pipelines []*channelling.Pipeline
+}
+
+// monitoredCalls remembers the call each supervisor monitors, to allow
+// whispers to the agent and to stop monitoring on disconnect.
+type monitoredCalls struct {
+	sync.Mutex
+	calls map[string]*monitoredCall
+}
+
+func newMonitoredCalls() *monitoredCalls {
+	return &monitoredCalls{calls: make(map[string]*monitoredCall)}
+}
+
+// Start records that supervisor monitors call and returns the call it
+// monitored before, if any.
+func (monitored *monitoredCalls) Start(supervisor string, call *monitoredCall) *monitoredCall {
+	monitored.Lock()
+	defer monitored.Unlock()
+	previous := monitored.calls[supervisor]
+	monitored.calls[supervisor] = call
+	return previous
+}
+
+// Stop forgets the call monitored by supervisor and returns it, if any.
+func (monitored *monitoredCalls) Stop(supervisor string) *monitoredCall {
+	monitored.Lock()
+	defer monitored.Unlock()
+	call := monitored.calls[supervisor]
+	delete(monitored.calls, supervisor)
+	return call
+}
+
+// Monitors returns true if supervisor monitors a call of agent.
+func (monitored *monitoredCalls) Monitors(supervisor, agent string) bool {
+	monitored.Lock()
+	defer monitored.Unlock()
+	call, ok := monitored.calls[supervisor]
+	return ok && call.agent == agent
+}
+
+func (call *monitoredCall) remove(supervisor string) {
+	for _, pipeline := range call.pipelines {
+		pipeline.RemoveMonitor(supervisor)
+	}
+}
+
+func (api *channellingAPI) HandleMonitor(session *channelling.Session, monitor *channelling.DataMonitor) (*channelling.DataMonitor, error) {
+	if !monitor.Active {
+		if call := api.monitoredCalls.Stop(session.Id); call != nil {
+			call.remove(session.Id)
+			log.Printf("Audit: monitoring stopped supervisor=%s agent=%s peer=%s room=%s\n", session.Id, call.agent, call.peer, session.Roomid)
+		}
+		return &channelling.DataMonitor{Type: "Monitor", Session: monitor.Session, To: monitor.To}, nil
+	}
+
+	room, ok := api.RoomStatusManager.Get(session.Roomid)
+	if !session.Hello || !ok {
+		return nil, channelling.NewDataError("not_in_room", "Calls can only be monitored in the current room")
+	}
+	if !room.GetTemplate().HasFeature(channelling.RoomFeatureMonitoring) {
+		return nil, channelling.NewDataError("feature_disabled", "Monitoring is not enabled for this room")
+	}
+	if !isRoomModerator(session, room) {
+		return nil, channelling.NewDataError("not_room_moderator", "Only the room owner and moderators can monitor calls")
+	}
+	if monitor.Session == session.Id || monitor.To == session.Id || monitor.Session == monitor.To {
+		return nil, channelling.NewDataError("invalid_monitor", "Cannot monitor own calls")
+	}
+	agent, ok := api.SessionManager.GetSession(monitor.Session)
+	if !ok || agent.Roomid != session.Roomid {
+		return nil, channelling.NewDataError("unknown_session", "The agent is not in the room")
+	}
+	peer, ok := api.SessionManager.GetSession(monitor.To)
+	if !ok {
+		return nil, channelling.NewDataError("unknown_session", "The peer of the call is not connected")
+	}
+
+	call := &monitoredCall{agent: agent.Id, peer: peer.Id}
+	for _, pipeline := range []*channelling.Pipeline{
+		api.PipelineManager.GetPipeline(channelling.PipelineNamespaceCall, nil, agent, peer.Id),
+		api.PipelineManager.GetPipeline(channelling.PipelineNamespaceCall, nil, peer, agent.Id),
+	} {
+		if pipeline == nil || pipeline.AddMonitor(session) != nil {
+			call.remove(session.Id)
+			return nil, channelling.NewDataError("monitoring_unavailable", "Calls cannot be monitored")
+		}
+		call.pipelines = append(call.pipelines, pipeline)
+	}
+	if previous := api.monitoredCalls.Start(session.Id, call); previous != nil {
+		previous.remove(session.Id)
+		log.Printf("Audit: monitoring stopped supervisor=%s agent=%s peer=%s room=%s\n", session.Id, previous.agent, previous.peer, session.Roomid)
+	}
+	log.Printf("Audit: monitoring started supervisor=%s userid=%s agent=%s peer=%s room=%s\n", session.Id, session.Userid(), agent.Id, peer.Id, session.Roomid)
+
+	return &channelling.DataMonitor{Type: "Monitor", Session: agent.Id, To: peer.Id, Active: true}, nil
+}
+
+func (api *channellingAPI) HandleWhisper(session *channelling.Session, whisper *channelling.DataWhisper) error {
+	if !api.monitoredCalls.Monitors(session.Id, whisper.To) {
+		return channelling.NewDataError("not_monitoring", "Whispers can only be sent to agents of monitored calls")
+	}
+
+	log.Printf("Audit: whisper supervisor=%s agent=%s room=%s\n", session.Id, whisper.To, session.Roomid)
+	session.Unicast(whisper.To, &channelling.DataWhisper{Type: "Whisper", Message: whisper.Message}, nil)
+	return nil
+}
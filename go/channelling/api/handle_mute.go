@@ -0,0 +1,62 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package api
+
+import (
+	"github.com/strukturag/spreed-webrtc/go/channelling"
+)
+
+func (api *channellingAPI) HandleMute(session *channelling.Session, mute *channelling.DataMute) (*channelling.DataMute, error) {
+	room, ok := api.RoomStatusManager.Get(session.Roomid)
+	if !session.Hello || !ok {
+		return nil, channelling.NewDataError("not_in_room", "Mute requests can only be sent to the current room")
+	}
+	if !isRoomModerator(session, room) {
+		return nil, channelling.NewDataError("not_room_moderator", "Only the room owner and moderators can mute others")
+	}
+
+	data := &channelling.DataMute{
+		Type:  "Mute",
+		To:    mute.To,
+		Audio: mute.Audio,
+		Video: mute.Video,
+	}
+	if data.To == "" {
+		// Remember mute all for sessions joining later.
+		room.SetMute(data)
+		session.Broadcast(data)
+	} else {
+		found := false
+		for _, id := range room.SessionIDs() {
+			if id == data.To {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, channelling.NewDataError("no_such_session", "The session is not in the room")
+		}
+		session.Unicast(data.To, data, nil)
+	}
+
+	return data, nil
+}
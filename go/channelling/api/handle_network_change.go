@@ -0,0 +1,56 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package api
+
+import (
+	"github.com/strukturag/spreed-webrtc/go/channelling"
+)
+
+const (
+	maxNetworkLength      = 32
+	maxNetworkChangePeers = 50
+)
+
+func (api *channellingAPI) HandleNetworkChange(sender channelling.Sender, session *channelling.Session, networkChange *channelling.DataNetworkChange) (*channelling.DataNetworkChanged, error) {
+	if len(networkChange.Network) > maxNetworkLength || len(networkChange.Peers) > maxNetworkChangePeers {
+		return nil, channelling.NewDataError("invalid_network_change", "The network change is not valid")
+	}
+
+	network := session.UpdateNetwork(networkChange.Network)
+	if api.trackable(session, "") {
+		api.BusManager.Trigger(channelling.BusManagerNetworkChange, session.Id, networkChange.Network, network, nil)
+	}
+
+	// Addresses changed, so relayed candidates need fresh allocations.
+	reply := &channelling.DataNetworkChanged{
+		Type: "NetworkChanged",
+		Turn: api.TurnDataCreator.CreateTurnData(session),
+	}
+	for _, to := range networkChange.Peers {
+		if to == "" || to == session.Id {
+			continue
+		}
+		reply.IceRestart = append(reply.IceRestart, api.restartIce(sender, session, to, "network_change"))
+	}
+
+	return reply, nil
+}
@@ -0,0 +1,86 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package api
+
+import (
+	"strings"
+
+	"github.com/strukturag/spreed-webrtc/go/channelling"
+)
+
+func (api *channellingAPI) HandlePermissions(session *channelling.Session, permissions *channelling.DataPermissions) (*channelling.DataPermissions, error) {
+	room, ok := api.RoomStatusManager.Get(session.Roomid)
+	if !session.Hello || !ok {
+		return nil, channelling.NewDataError("not_in_room", "Permissions can only be changed for the current room")
+	}
+	if !isRoomModerator(session, room) {
+		return nil, channelling.NewDataError("not_room_moderator", "Only the room owner and moderators can change permissions")
+	}
+
+	data := &channelling.DataPermissions{
+		Type:         "Permissions",
+		Chat:         permissions.Chat,
+		Screenshare:  permissions.Screenshare,
+		Call:         permissions.Call,
+		Invite:       permissions.Invite,
+		FileTransfer: permissions.FileTransfer,
+	}
+	if err := data.Validate(); err != nil {
+		return nil, err
+	}
+	room.SetPermissions(data)
+	session.Broadcast(data)
+
+	return data, nil
+}
+
+// checkPermission returns an error if the room of session does not allow
+// the session to do action.
+func (api *channellingAPI) checkPermission(session *channelling.Session, action string) error {
+	room, ok := api.RoomStatusManager.Get(session.Roomid)
+	if !ok {
+		return nil
+	}
+	permissions := room.GetPermissions()
+	if permissions == nil || permissions.Allowed(action, isRoomModerator(session, room), session.Userid() != "") {
+		return nil
+	}
+	return channelling.NewDataError("permission_denied", "The room does not allow you to "+permissionDescriptions[action])
+}
+
+// tokenPermission returns the permission needed to answer a peer
+// connection with token. Screen sharing tokens are prefixed with
+// screenshare_, all other tokens are used for file transfers.
+func tokenPermission(token interface{}) string {
+	if value, ok := token.(string); ok && strings.HasPrefix(value, "screenshare_") {
+		return channelling.RoomPermissionScreenshare
+	}
+	return channelling.RoomPermissionFileTransfer
+}
+
+var permissionDescriptions = map[string]string{
+	channelling.RoomPermissionChat:         "chat",
+	channelling.RoomPermissionScreenshare:  "share your screen",
+	channelling.RoomPermissionCall:         "start calls",
+	channelling.RoomPermissionInvite:       "invite others",
+	channelling.RoomPermissionFileTransfer: "share files",
+}
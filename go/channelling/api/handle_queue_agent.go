@@ -0,0 +1,42 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package api
+
+import (
+	"github.com/strukturag/spreed-webrtc/go/channelling"
+)
+
+func (api *channellingAPI) HandleQueueAgent(session *channelling.Session, agent *channelling.DataQueueAgent) error {
+	room, ok := api.RoomStatusManager.Get(session.Roomid)
+	if !session.Hello || !ok {
+		return channelling.NewDataError("not_in_room", "Cannot take queued calls without a current room")
+	}
+	if room.GetTemplate() == nil || room.GetTemplate().Queue == "" {
+		return channelling.NewDataError("not_queue_room", "The current room has no call queue")
+	}
+	if !isRoomModerator(session, room) {
+		return channelling.NewDataError("not_room_moderator", "Only the room owner and moderators can take queued calls")
+	}
+
+	room.SetQueueAgent(session.Id, agent.State)
+	return nil
+}
@@ -0,0 +1,135 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package api
+
+import (
+	"log"
+	"time"
+
+	"github.com/strukturag/spreed-webrtc/go/channelling"
+)
+
+func (api *channellingAPI) HandleRecording(session *channelling.Session, recording *channelling.DataRecording) (*channelling.DataRecording, error) {
+	room, ok := api.RoomStatusManager.Get(session.Roomid)
+	if !session.Hello || !ok {
+		return nil, channelling.NewDataError("not_in_room", "Only the current room can be recorded")
+	}
+	if !isRoomModerator(session, room) {
+		return nil, channelling.NewDataError("not_room_moderator", "Only the room owner and moderators can record the room")
+	}
+	if !room.GetTemplate().HasFeature(channelling.RoomFeatureRecording) {
+		return nil, channelling.NewDataError("feature_disabled", "Recording is not enabled for this room")
+	}
+	if api.StepUpManager != nil {
+		if err := api.StepUpManager.RequireStepUp(session, channelling.StepUpActionRecording); err != nil {
+			return nil, err
+		}
+	}
+	if recording.Active && api.Extensions != nil {
+		if err := api.Extensions.CheckAction(channelling.PolicyActionRecord, session); err != nil {
+			return nil, err
+		}
+	}
+
+	room.SetRecording(recording.Active)
+	data := &channelling.DataRecording{Type: "Recording", Active: recording.Active}
+	session.Broadcast(data)
+
+	log.Printf("Recording of room %s set to %t by session %s\n", session.Roomid, recording.Active, session.Id)
+	if api.trackable(session, "") {
+		api.BusManager.Trigger(channelling.BusManagerRecording, session.Id, session.Roomid, &channelling.RecordingEvent{
+			Roomid:   session.Roomid,
+			Active:   recording.Active,
+			Consents: room.RecordingConsents(),
+		}, nil)
+	}
+
+	if recording.Active {
+		// The sender started the recording, so it implicitly consents.
+		room.SetRecordingConsent(session.Id, true)
+		api.checkRecordingConsents(session.Roomid, room.SessionIDs()...)
+	}
+
+	return data, nil
+}
+
+func (api *channellingAPI) HandleRecordingConsent(session *channelling.Session, consent *channelling.DataRecordingConsent) (*channelling.DataRecordingConsent, error) {
+	room, ok := api.RoomStatusManager.Get(session.Roomid)
+	if !session.Hello || !ok {
+		return nil, channelling.NewDataError("not_in_room", "Consent can only be given in the current room")
+	}
+
+	consents, err := room.SetRecordingConsent(session.Id, consent.Consent)
+	if err != nil {
+		return nil, err
+	}
+	data := &channelling.DataRecordingConsent{Type: "RecordingConsent", Id: session.Id, Consent: consent.Consent}
+	session.Broadcast(data)
+
+	if api.trackable(session, "") {
+		api.BusManager.Trigger(channelling.BusManagerRecordingConsent, session.Id, session.Roomid, &channelling.RecordingEvent{
+			Roomid:   session.Roomid,
+			Active:   true,
+			Consents: consents,
+		}, nil)
+	}
+
+	if !consent.Consent && api.config.RecordingConsentEject {
+		api.ejectFromRecording(session)
+	}
+
+	return data, nil
+}
+
+// checkRecordingConsents ejects the sessions with the given ids which did
+// not consent to the recording of the room once the consent timeout has
+// passed. Nothing happens unless ejecting is enabled in the configuration.
+func (api *channellingAPI) checkRecordingConsents(roomID string, sessionIDs ...string) {
+	if !api.config.RecordingConsentEject || api.config.RecordingConsentTimeout <= 0 {
+		return
+	}
+
+	time.AfterFunc(api.config.RecordingConsentTimeout, func() {
+		room, ok := api.RoomStatusManager.Get(roomID)
+		if !ok || !room.IsRecording() {
+			return
+		}
+		consents := room.RecordingConsents()
+		pending := make(map[string]bool, len(sessionIDs))
+		for _, id := range sessionIDs {
+			if !consents[id] {
+				pending[id] = true
+			}
+		}
+		for _, user := range room.Users() {
+			if pending[user.Id] {
+				api.ejectFromRecording(user.Session)
+			}
+		}
+	})
+}
+
+func (api *channellingAPI) ejectFromRecording(session *channelling.Session) {
+	log.Printf("Session %s did not consent to the recording of room %s\n", session.Id, session.Roomid)
+	session.Unicast(session.Id, &channelling.DataEjected{Type: "Ejected", Reason: "recording_consent"}, nil)
+	session.LeaveRoom()
+}
@@ -0,0 +1,69 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package api
+
+import (
+	"time"
+
+	"github.com/strukturag/spreed-webrtc/go/channelling"
+)
+
+func (api *channellingAPI) HandleRoomLink(session *channelling.Session, roomLink *channelling.DataRoomLink) (*channelling.DataRoomLink, error) {
+	if api.RoomLinks == nil {
+		return nil, channelling.NewDataError("room_links_disabled", "Room links are not enabled")
+	}
+
+	room, ok := api.RoomStatusManager.Get(session.Roomid)
+	if !session.Hello || !ok {
+		return nil, channelling.NewDataError("not_in_room", "Room links can only be created for the current room")
+	}
+	if err := api.checkPermission(session, channelling.RoomPermissionInvite); err != nil {
+		return nil, err
+	}
+
+	// Sessions which joined through a moderator link may share links for
+	// their room, all others need to be signed in. Only moderators can
+	// hand out moderator links.
+	role := session.RoomRole()
+	if role != channelling.RoomRoleModerator {
+		if session.Userid() == "" {
+			return nil, channelling.NewDataError("room_link_requires_account", "Room links can only be created by users")
+		}
+		if roomLink.Role == channelling.RoomRoleModerator {
+			return nil, channelling.NewDataError("room_link_forbidden", "Only moderators can create moderator links")
+		}
+	}
+
+	token, link, err := api.RoomLinks.SignRoomLink(room.GetName(), room.GetType(), roomLink.Role, time.Duration(roomLink.Ttl)*time.Second)
+	if err != nil {
+		return nil, err
+	}
+
+	return &channelling.DataRoomLink{
+		Type:     "RoomLink",
+		Name:     link.Name,
+		RoomType: link.Type,
+		Role:     link.Role,
+		Link:     token,
+		Expires:  link.Expires,
+	}, nil
+}
@@ -0,0 +1,56 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package api
+
+import (
+	"github.com/strukturag/spreed-webrtc/go/channelling"
+)
+
+func (api *channellingAPI) HandleRoomOwner(session *channelling.Session, roomOwner *channelling.DataRoomOwner) (*channelling.DataRoom, error) {
+	room, ok := api.RoomStatusManager.Get(session.Roomid)
+	if !session.Hello || !ok {
+		return nil, channelling.NewDataError("not_in_room", "Ownership can only be transferred for the current room")
+	}
+	if roomOwner.Owner == "" {
+		return nil, channelling.NewDataError("bad_request", "RoomOwner did not contain an owner")
+	}
+
+	// Only the owner can transfer the room. Rooms without owner can be
+	// assigned by moderators.
+	if owner := room.GetOwner(); owner != "" {
+		if owner != session.Userid() {
+			return nil, channelling.NewDataError("not_room_owner", "Only the room owner can transfer the room")
+		}
+	} else if session.RoomRole() != channelling.RoomRoleModerator {
+		return nil, channelling.NewDataError("not_room_owner", "Only moderators can assign an owner to this room")
+	}
+
+	room.SetOwner(roomOwner.Owner)
+	data := &channelling.DataRoom{
+		Type:  room.GetType(),
+		Name:  room.GetName(),
+		Owner: roomOwner.Owner,
+	}
+	session.Broadcast(data)
+
+	return data, nil
+}
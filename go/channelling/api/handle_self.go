@@ -46,8 +46,17 @@ func (api *channellingAPI) HandleSelf(session *channelling.Session) (*channellin
 		ApiVersion: apiVersion,
 		Turn:       api.TurnDataCreator.CreateTurnData(session),
 		Stun:       api.config.StunURIs,
+		Private:    session.Private(),
+	}
+	if api.Affinity != nil {
+		self.Affinity = api.Affinity.Token()
+	}
+	if api.Extensions != nil {
+		self.Extras = api.Extensions.Extras("Self", session)
+	}
+	if api.trackable(session, "") {
+		api.BusManager.Trigger(channelling.BusManagerSession, session.Id, session.Userid(), nil, nil)
 	}
-	api.BusManager.Trigger(channelling.BusManagerSession, session.Id, session.Userid(), nil, nil)
 
 	return self, nil
 }
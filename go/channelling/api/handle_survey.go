@@ -0,0 +1,59 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package api
+
+import (
+	"github.com/strukturag/spreed-webrtc/go/channelling"
+)
+
+// startSurvey sends the survey to both parties of the call of session with
+// to, which was ended by a Bye.
+func (api *channellingAPI) startSurvey(session *channelling.Session, to string, pipeline *channelling.Pipeline) {
+	if api.Surveys == nil || !session.Hello {
+		return
+	}
+	call := ""
+	if pipeline != nil {
+		call = pipeline.GetID()
+	}
+	survey := api.Surveys.Start(session, to, call)
+	if survey == nil {
+		return
+	}
+	api.Unicaster.Unicast(session.Id, &channelling.DataOutgoing{To: session.Id, Data: survey}, nil)
+	session.Unicast(to, survey, nil)
+}
+
+func (api *channellingAPI) HandleSurveyResponse(session *channelling.Session, response *channelling.DataSurveyResponse) error {
+	if api.Surveys == nil {
+		return channelling.NewDataError("survey_unknown", "The survey is closed")
+	}
+	result, err := api.Surveys.Respond(session, response)
+	if err != nil {
+		return err
+	}
+
+	if api.trackable(session, result.Peer) {
+		api.BusManager.Trigger(channelling.BusManagerSurvey, session.Id, result.Peer, result, nil)
+	}
+	return nil
+}
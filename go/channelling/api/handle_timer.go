@@ -0,0 +1,67 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package api
+
+import (
+	"time"
+
+	"github.com/strukturag/spreed-webrtc/go/channelling"
+)
+
+const (
+	maxTimerDuration    = 24 * 60 * 60
+	maxTimerLabelLength = 200
+)
+
+func (api *channellingAPI) HandleTimer(session *channelling.Session, timer *channelling.DataTimer) (*channelling.DataTimer, error) {
+	room, ok := api.RoomStatusManager.Get(session.Roomid)
+	if !session.Hello || !ok {
+		return nil, channelling.NewDataError("not_in_room", "Timers can only be set for the current room")
+	}
+	if !isRoomModerator(session, room) {
+		return nil, channelling.NewDataError("not_room_moderator", "Only the room owner and moderators can set timers")
+	}
+	if timer.Duration < 0 || timer.Duration > maxTimerDuration {
+		return nil, channelling.NewDataError("invalid_timer", "The timer duration is not valid")
+	}
+	if len(timer.Label) > maxTimerLabelLength {
+		return nil, channelling.NewDataError("invalid_timer", "The timer label is too long")
+	}
+
+	now := time.Now().UnixNano() / int64(time.Millisecond)
+	data := &channelling.DataTimer{
+		Type:     "Timer",
+		Duration: timer.Duration,
+		Now:      now,
+	}
+	if timer.Duration > 0 {
+		data.Label = timer.Label
+		data.Started = now
+		data.Ends = now + int64(timer.Duration)*1000
+		room.SetTimer(data)
+	} else {
+		room.SetTimer(nil)
+	}
+	session.Broadcast(data)
+
+	return data, nil
+}
@@ -0,0 +1,50 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package api
+
+import (
+	"github.com/strukturag/spreed-webrtc/go/channelling"
+)
+
+const maxVolatileKeyLength = 64
+
+func (api *channellingAPI) HandleVolatile(session *channelling.Session, volatile *channelling.DataVolatile) error {
+	room, ok := api.RoomStatusManager.Get(session.Roomid)
+	if !session.Hello || !ok {
+		return channelling.NewDataError("not_in_room", "Volatile messages can only be sent to the current room")
+	}
+	if volatile.Key == "" || len(volatile.Key) > maxVolatileKeyLength {
+		return channelling.NewDataError("invalid_volatile", "The volatile key is not valid")
+	}
+
+	data := &channelling.DataVolatile{
+		Type: "Volatile",
+		Key:  volatile.Key,
+		Data: volatile.Data,
+	}
+	if err := room.SetVolatile(session.Id, data); err != nil {
+		return err
+	}
+	session.Broadcast(data)
+
+	return nil
+}
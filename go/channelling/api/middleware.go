@@ -0,0 +1,213 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package api
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/strukturag/spreed-webrtc/go/channelling"
+)
+
+// messageHandler handles an incoming channelling message of session.
+type messageHandler func(sender channelling.Sender, session *channelling.Session, msg *channelling.DataIncoming) (interface{}, error)
+
+// messageMiddleware wraps the handler of messages of msgType, to run checks
+// before passing messages on to next or to observe the result.
+type messageMiddleware func(msgType string, next messageHandler) messageHandler
+
+// chainMiddlewares wraps handler with middlewares. The first middleware is
+// the outermost one and sees messages first.
+func chainMiddlewares(msgType string, handler messageHandler, middlewares ...messageMiddleware) messageHandler {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		handler = middlewares[i](msgType, handler)
+	}
+	return handler
+}
+
+// requires rejects messages for which present returns false with a
+// bad_request error.
+func requires(present func(msg *channelling.DataIncoming) bool) messageMiddleware {
+	return func(msgType string, next messageHandler) messageHandler {
+		return func(sender channelling.Sender, session *channelling.Session, msg *channelling.DataIncoming) (interface{}, error) {
+			if !present(msg) {
+				return nil, channelling.NewDataError("bad_request", "message did not contain "+msgType)
+			}
+			return next(sender, session, msg)
+		}
+	}
+}
+
+// ignoresInvalid silently drops messages for which valid returns false.
+func ignoresInvalid(valid func(msg *channelling.DataIncoming) bool) messageMiddleware {
+	return func(msgType string, next messageHandler) messageHandler {
+		return func(sender channelling.Sender, session *channelling.Session, msg *channelling.DataIncoming) (interface{}, error) {
+			if !valid(msg) {
+				log.Printf("Received invalid %s message. %v\n", strings.ToLower(msgType), msg)
+				return nil, nil
+			}
+			return next(sender, session, msg)
+		}
+	}
+}
+
+// validateSchema rejects messages whose payload does not match the validate
+// tags of its type.
+func validateSchema(msgType string, next messageHandler) messageHandler {
+	return func(sender channelling.Sender, session *channelling.Session, msg *channelling.DataIncoming) (interface{}, error) {
+		if err := channelling.ValidateIncoming(msg); err != nil {
+			return nil, err
+		}
+		return next(sender, session, msg)
+	}
+}
+
+// authorize rejects messages of sessions which lack the room permission
+// for action.
+func (api *channellingAPI) authorize(action string) messageMiddleware {
+	return func(msgType string, next messageHandler) messageHandler {
+		return func(sender channelling.Sender, session *channelling.Session, msg *channelling.DataIncoming) (interface{}, error) {
+			if err := api.checkPermission(session, action); err != nil {
+				return nil, err
+			}
+			return next(sender, session, msg)
+		}
+	}
+}
+
+// checkExtensions lets the extensions veto messages.
+func (api *channellingAPI) checkExtensions(msgType string, next messageHandler) messageHandler {
+	if api.Extensions == nil {
+		return next
+	}
+	return func(sender channelling.Sender, session *channelling.Session, msg *channelling.DataIncoming) (interface{}, error) {
+		if err := api.Extensions.CheckMessage(session, msg); err != nil {
+			return nil, err
+		}
+		return next(sender, session, msg)
+	}
+}
+
+// recoverPanics recovers panics of the handler and closes the connection of
+// the sender, as the state of its session may be inconsistent.
+func (api *channellingAPI) recoverPanics(msgType string, next messageHandler) messageHandler {
+	if api.PanicRecovery == nil {
+		return next
+	}
+	return func(sender channelling.Sender, session *channelling.Session, msg *channelling.DataIncoming) (reply interface{}, err error) {
+		sessionID := session.Id
+		if session.Private() {
+			sessionID = ""
+		}
+		defer api.PanicRecovery.Recover("message:"+msgType, sessionID, func() {
+			if closer, ok := sender.(interface {
+				Close()
+			}); ok {
+				closer.Close()
+			}
+			reply, err = nil, channelling.NewDataError("internal_error", "Internal server error")
+		})
+		return next(sender, session, msg)
+	}
+}
+
+// countMessages counts handled messages and failures per type, and records
+// the failures for the admin dashboard.
+func (api *channellingAPI) countMessages(msgType string, next messageHandler) messageHandler {
+	if api.StatsCounter == nil {
+		return next
+	}
+	return func(sender channelling.Sender, session *channelling.Session, msg *channelling.DataIncoming) (interface{}, error) {
+		reply, err := next(sender, session, msg)
+		api.StatsCounter.CountMessage(msgType, err != nil)
+		if err != nil {
+			sessionID := session.Id
+			if session.Private() {
+				sessionID = ""
+			}
+			api.StatsCounter.RecordError(msgType, sessionID, err)
+		}
+		return reply, err
+	}
+}
+
+// limitRate rejects messages of sessions which exceed the configured rate
+// of msgType.
+func (api *channellingAPI) limitRate(msgType string, next messageHandler) messageHandler {
+	if api.messageRates == nil || api.messageRates.limits[msgType] <= 0 {
+		return next
+	}
+	return func(sender channelling.Sender, session *channelling.Session, msg *channelling.DataIncoming) (interface{}, error) {
+		if !api.messageRates.allow(session.Id, msgType, time.Now()) {
+			return nil, channelling.NewDataError("rate_limited", fmt.Sprintf("Too many %s messages, retry later", msgType))
+		}
+		return next(sender, session, msg)
+	}
+}
+
+// messageRates counts the messages of each session and type per minute.
+type messageRates struct {
+	sync.Mutex
+	limits  map[string]int
+	windows map[string]map[string]*messageWindow
+}
+
+type messageWindow struct {
+	start time.Time
+	count int
+}
+
+func newMessageRates(limits map[string]int) *messageRates {
+	return &messageRates{
+		limits:  limits,
+		windows: make(map[string]map[string]*messageWindow),
+	}
+}
+
+// allow counts a message of msgType from sessionID and returns false if
+// the session exceeded the limit for the current minute.
+func (rates *messageRates) allow(sessionID, msgType string, now time.Time) bool {
+	rates.Lock()
+	defer rates.Unlock()
+	windows, ok := rates.windows[sessionID]
+	if !ok {
+		windows = make(map[string]*messageWindow)
+		rates.windows[sessionID] = windows
+	}
+	window, ok := windows[msgType]
+	if !ok || now.Sub(window.start) >= time.Minute {
+		window = &messageWindow{start: now}
+		windows[msgType] = window
+	}
+	window.count++
+	return window.count <= rates.limits[msgType]
+}
+
+// forget drops the counters of sessionID.
+func (rates *messageRates) forget(sessionID string) {
+	rates.Lock()
+	delete(rates.windows, sessionID)
+	rates.Unlock()
+}
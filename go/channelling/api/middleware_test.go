@@ -0,0 +1,170 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package api
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/strukturag/spreed-webrtc/go/channelling"
+)
+
+type fakeStatsCounter struct {
+	messages map[string]int
+	errors   map[string]int
+}
+
+func (fake *fakeStatsCounter) CountBroadcastChat() {}
+
+func (fake *fakeStatsCounter) CountUnicastChat() {}
+
+func (fake *fakeStatsCounter) CountMessage(msgType string, failed bool) {
+	fake.messages[msgType]++
+	if failed {
+		fake.errors[msgType]++
+	}
+}
+
+func (fake *fakeStatsCounter) RecordError(msgType, sessionID string, err error) {}
+
+func Test_ChainMiddlewares_RunsMiddlewaresInOrder(t *testing.T) {
+	var calls []string
+	middleware := func(name string) messageMiddleware {
+		return func(msgType string, next messageHandler) messageHandler {
+			return func(sender channelling.Sender, session *channelling.Session, msg *channelling.DataIncoming) (interface{}, error) {
+				calls = append(calls, name+":"+msgType)
+				return next(sender, session, msg)
+			}
+		}
+	}
+	handler := chainMiddlewares("Test", func(sender channelling.Sender, session *channelling.Session, msg *channelling.DataIncoming) (interface{}, error) {
+		calls = append(calls, "handler")
+		return nil, nil
+	}, middleware("a"), middleware("b"))
+
+	handler(nil, nil, &channelling.DataIncoming{Type: "Test"})
+
+	if result := strings.Join(calls, " "); result != "a:Test b:Test handler" {
+		t.Errorf("Expected middlewares to run in order, but got %s", result)
+	}
+}
+
+func Test_ChannellingAPI_OnIncoming_RejectsMessageWithoutData(t *testing.T) {
+	api, client, session, _ := NewTestChannellingAPI()
+
+	_, err := api.OnIncoming(client, session, &channelling.DataIncoming{Type: "Follow"})
+
+	assertDataError(t, err, "bad_request")
+}
+
+func Test_ChannellingAPI_OnIncoming_IgnoresInvalidMessage(t *testing.T) {
+	api, client, session, _ := NewTestChannellingAPI()
+
+	reply, err := api.OnIncoming(client, session, &channelling.DataIncoming{Type: "Offer"})
+	if reply != nil || err != nil {
+		t.Errorf("Expected invalid offer to be ignored, but got %v and %v", reply, err)
+	}
+}
+
+func Test_ChannellingAPI_OnIncoming_CountsMessagesPerType(t *testing.T) {
+	api, client, session, _ := NewTestChannellingAPI()
+	stats := &fakeStatsCounter{make(map[string]int), make(map[string]int)}
+	api.(*channellingAPI).StatsCounter = stats
+	api.(*channellingAPI).registerHandlers()
+
+	api.OnIncoming(client, session, &channelling.DataIncoming{Type: "Follow"})
+	api.OnIncoming(client, session, &channelling.DataIncoming{Type: "Unknown"})
+
+	if stats.messages["Follow"] != 1 || stats.errors["Follow"] != 1 {
+		t.Errorf("Expected one failed Follow message, but got %d with %d errors", stats.messages["Follow"], stats.errors["Follow"])
+	}
+	if _, ok := stats.messages["Unknown"]; ok {
+		t.Error("Expected unknown message types not to be counted")
+	}
+}
+
+func Test_ChannellingAPI_OnIncoming_LimitsMessageRate(t *testing.T) {
+	api, client, session, _ := NewTestChannellingAPI()
+	api.(*channellingAPI).messageRates = newMessageRates(map[string]int{"Leave": 2})
+	api.(*channellingAPI).registerHandlers()
+
+	for i := 0; i < 2; i++ {
+		if _, err := api.OnIncoming(client, session, &channelling.DataIncoming{Type: "Leave"}); err != nil {
+			t.Fatalf("Expected message %d to be allowed, but got %v", i, err)
+		}
+	}
+	_, err := api.OnIncoming(client, session, &channelling.DataIncoming{Type: "Leave"})
+	assertDataError(t, err, "rate_limited")
+}
+
+type closingClient struct {
+	fakeClient
+	closed bool
+}
+
+func (fake *closingClient) Close() {
+	fake.closed = true
+}
+
+func Test_ChannellingAPI_RecoverPanics_ClosesConnectionOfSender(t *testing.T) {
+	api, _, session, _ := NewTestChannellingAPI()
+	recovery := channelling.NewPanicRecovery(nil)
+	api.(*channellingAPI).PanicRecovery = recovery
+	client := &closingClient{}
+	handler := chainMiddlewares("Test", func(sender channelling.Sender, session *channelling.Session, msg *channelling.DataIncoming) (interface{}, error) {
+		panic("broken handler")
+	}, api.(*channellingAPI).recoverPanics)
+
+	_, err := handler(client, session, &channelling.DataIncoming{Type: "Test"})
+
+	assertDataError(t, err, "internal_error")
+	if !client.closed {
+		t.Error("Expected the connection of the sender to be closed")
+	}
+	if count := recovery.Panics()["message:Test"]; count != 1 {
+		t.Errorf("Expected one recovered panic, but got %d", count)
+	}
+}
+
+func Test_MessageRates_ResetsAfterAMinute(t *testing.T) {
+	rates := newMessageRates(map[string]int{"Chat": 1})
+	now := time.Now()
+
+	if !rates.allow("a", "Chat", now) {
+		t.Error("Expected first message to be allowed")
+	}
+	if rates.allow("a", "Chat", now.Add(time.Second)) {
+		t.Error("Expected second message to be rejected")
+	}
+	if !rates.allow("b", "Chat", now.Add(time.Second)) {
+		t.Error("Expected other sessions to be counted separately")
+	}
+	if !rates.allow("a", "Chat", now.Add(time.Minute)) {
+		t.Error("Expected message to be allowed after a minute")
+	}
+
+	rates.forget("a")
+	if _, ok := rates.windows["a"]; ok {
+		t.Error("Expected counters of forgotten session to be removed")
+	}
+}
@@ -0,0 +1,263 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package channelling
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	BusManagerAuthFailure = "authfailure"
+	BusManagerAuthLockout = "authlockout"
+)
+
+// AuthLimiter tracks failed authentication attempts by remote address, by
+// room and by user and locks addresses and users out with exponential
+// backoff. Failures of rooms are only counted and audited, as a lockout
+// of a room would lock out everyone trying to get into it.
+type AuthLimiter interface {
+	AuthStats
+	AuthAllowed(remoteIP, roomID string) error
+	AuthFailed(remoteIP, roomID, reason string)
+	AuthSucceeded(remoteIP, roomID string)
+	UserAuthAllowed(userid string) error
+	UserAuthFailed(userid, reason string)
+	UserAuthSucceeded(userid string)
+}
+
+type AuthStats interface {
+	AuthInfo() *AuthStat
+}
+
+type AuthStat struct {
+	Failures uint64 `json:"failures"`
+	Lockouts uint64 `json:"lockouts"`
+	Locked   int    `json:"locked"`
+}
+
+// AuthEvent is sent as trigger data for authentication failures and
+// lockouts.
+type AuthEvent struct {
+	RemoteIP string `json:",omitempty"`
+	Roomid   string `json:",omitempty"`
+	Userid   string `json:",omitempty"`
+	Reason   string `json:",omitempty"`
+	Failures int
+	Until    int64 `json:",omitempty"` // Unix time when the lockout ends.
+}
+
+type authAttempts struct {
+	failures    int
+	last        time.Time
+	lockedUntil time.Time
+}
+
+type authLimiter struct {
+	failures   uint64
+	lockouts   uint64
+	mutex      sync.Mutex
+	busManager BusManager
+	attempts   map[string]*authAttempts
+	threshold  int
+	lockout    time.Duration
+	maxLockout time.Duration
+	lastExpire time.Time
+}
+
+// NewAuthLimiter returns an AuthLimiter which locks out after
+// config.AuthLimitThreshold failures. Failures are still counted and
+// audited when the threshold is not positive, but nothing gets locked.
+func NewAuthLimiter(config *Config, busManager BusManager) AuthLimiter {
+	limiter := &authLimiter{
+		busManager: busManager,
+		attempts:   make(map[string]*authAttempts),
+		threshold:  config.AuthLimitThreshold,
+		lockout:    config.AuthLimitLockout,
+		maxLockout: config.AuthLimitMaxLockout,
+	}
+	if limiter.lockout <= 0 {
+		limiter.lockout = 30 * time.Second
+	}
+	if limiter.maxLockout < limiter.lockout {
+		limiter.maxLockout = limiter.lockout
+	}
+	return limiter
+}
+
+func authLimiterKeys(remoteIP, roomID string) []string {
+	keys := make([]string, 0, 2)
+	if remoteIP != "" {
+		keys = append(keys, "ip:"+AddressKey(remoteIP))
+	}
+	if roomID != "" {
+		keys = append(keys, "room:"+roomID)
+	}
+	return keys
+}
+
+func (limiter *authLimiter) AuthAllowed(remoteIP, roomID string) error {
+	return limiter.allowed(authLimiterKeys(remoteIP, roomID))
+}
+
+func (limiter *authLimiter) AuthFailed(remoteIP, roomID, reason string) {
+	failures, until := limiter.failed(authLimiterKeys(remoteIP, roomID))
+
+	log.Printf("Audit: authentication failed ip=%s room=%s reason=%s failures=%d\n", remoteIP, roomID, reason, failures)
+	limiter.trigger(BusManagerAuthFailure, &AuthEvent{RemoteIP: remoteIP, Roomid: roomID, Reason: reason, Failures: failures})
+	if until > 0 {
+		log.Printf("Audit: authentication locked ip=%s room=%s until=%d\n", remoteIP, roomID, until)
+		limiter.trigger(BusManagerAuthLockout, &AuthEvent{RemoteIP: remoteIP, Roomid: roomID, Reason: reason, Failures: failures, Until: until})
+	}
+}
+
+func (limiter *authLimiter) AuthSucceeded(remoteIP, roomID string) {
+	limiter.mutex.Lock()
+	// Only reset the address, failures of a room are shared by everyone
+	// trying to get into it.
+	if remoteIP != "" {
+		delete(limiter.attempts, "ip:"+AddressKey(remoteIP))
+	}
+	limiter.mutex.Unlock()
+}
+
+// UserAuthAllowed returns an error while userid is locked out, e.g. after
+// too many wrong second factor codes.
+func (limiter *authLimiter) UserAuthAllowed(userid string) error {
+	return limiter.allowed([]string{"user:" + userid})
+}
+
+func (limiter *authLimiter) UserAuthFailed(userid, reason string) {
+	failures, until := limiter.failed([]string{"user:" + userid})
+
+	log.Printf("Audit: authentication failed user=%s reason=%s failures=%d\n", userid, reason, failures)
+	limiter.trigger(BusManagerAuthFailure, &AuthEvent{Userid: userid, Reason: reason, Failures: failures})
+	if until > 0 {
+		log.Printf("Audit: authentication locked user=%s until=%d\n", userid, until)
+		limiter.trigger(BusManagerAuthLockout, &AuthEvent{Userid: userid, Reason: reason, Failures: failures, Until: until})
+	}
+}
+
+func (limiter *authLimiter) UserAuthSucceeded(userid string) {
+	limiter.mutex.Lock()
+	delete(limiter.attempts, "user:"+userid)
+	limiter.mutex.Unlock()
+}
+
+func (limiter *authLimiter) allowed(keys []string) error {
+	now := time.Now()
+	limiter.mutex.Lock()
+	defer limiter.mutex.Unlock()
+
+	for _, key := range keys {
+		if attempts, ok := limiter.attempts[key]; ok && now.Before(attempts.lockedUntil) {
+			retry := attempts.lockedUntil.Sub(now)/time.Second + 1
+			return NewDataError("auth_locked", fmt.Sprintf("Too many failed attempts, retry in %d seconds", retry))
+		}
+	}
+	return nil
+}
+
+// failed counts a failure for keys and returns the highest number of
+// failures and the Unix time when the resulting lockout ends, or 0 if
+// nothing got locked.
+func (limiter *authLimiter) failed(keys []string) (failures int, until int64) {
+	atomic.AddUint64(&limiter.failures, 1)
+	now := time.Now()
+
+	limiter.mutex.Lock()
+	limiter.expire(now)
+	for _, key := range keys {
+		attempts, ok := limiter.attempts[key]
+		if !ok {
+			attempts = &authAttempts{}
+			limiter.attempts[key] = attempts
+		}
+		attempts.failures++
+		attempts.last = now
+		if attempts.failures > failures {
+			failures = attempts.failures
+		}
+		if limiter.threshold > 0 && attempts.failures >= limiter.threshold && !strings.HasPrefix(key, "room:") {
+			// Double the lockout for every further failure.
+			duration := limiter.lockout
+			for i := limiter.threshold; i < attempts.failures && duration < limiter.maxLockout; i++ {
+				duration *= 2
+			}
+			if duration > limiter.maxLockout {
+				duration = limiter.maxLockout
+			}
+			attempts.lockedUntil = now.Add(duration)
+			if attempts.lockedUntil.Unix() > until {
+				until = attempts.lockedUntil.Unix()
+			}
+		}
+	}
+	limiter.mutex.Unlock()
+
+	if until > 0 {
+		atomic.AddUint64(&limiter.lockouts, 1)
+	}
+	return
+}
+
+func (limiter *authLimiter) AuthInfo() *AuthStat {
+	now := time.Now()
+	locked := 0
+	limiter.mutex.Lock()
+	for _, attempts := range limiter.attempts {
+		if now.Before(attempts.lockedUntil) {
+			locked++
+		}
+	}
+	limiter.mutex.Unlock()
+
+	return &AuthStat{
+		Failures: atomic.LoadUint64(&limiter.failures),
+		Lockouts: atomic.LoadUint64(&limiter.lockouts),
+		Locked:   locked,
+	}
+}
+
+// expire removes attempts which had no failures for the maximum lockout
+// duration. Needs to be called with the mutex locked.
+func (limiter *authLimiter) expire(now time.Time) {
+	if now.Sub(limiter.lastExpire) < limiter.lockout {
+		return
+	}
+	limiter.lastExpire = now
+	for key, attempts := range limiter.attempts {
+		if now.Sub(attempts.last) > limiter.maxLockout && now.After(attempts.lockedUntil) {
+			delete(limiter.attempts, key)
+		}
+	}
+}
+
+func (limiter *authLimiter) trigger(name string, event *AuthEvent) {
+	if limiter.busManager != nil {
+		limiter.busManager.Trigger(name, "", "", event, nil)
+	}
+}
@@ -0,0 +1,85 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package channelling
+
+import (
+	"testing"
+	"time"
+)
+
+func Test_AuthLimiter_LocksOutAfterThreshold(t *testing.T) {
+	limiter := NewAuthLimiter(&Config{AuthLimitThreshold: 3, AuthLimitLockout: time.Minute, AuthLimitMaxLockout: time.Hour}, nil)
+
+	for i := 0; i < 2; i++ {
+		limiter.AuthFailed("192.0.2.1", "Room:foo", "invalid_credentials")
+	}
+	if err := limiter.AuthAllowed("192.0.2.1", "Room:foo"); err != nil {
+		t.Fatalf("Unexpected error %v before reaching the threshold", err)
+	}
+
+	limiter.AuthFailed("192.0.2.1", "Room:foo", "invalid_credentials")
+	assertDataError(t, limiter.AuthAllowed("192.0.2.1", ""), "auth_locked")
+	assertDataError(t, limiter.AuthAllowed("192.0.2.1", "Room:bar"), "auth_locked")
+	if err := limiter.AuthAllowed("192.0.2.2", "Room:foo"); err != nil {
+		t.Errorf("Unexpected error %v for other address and the same room", err)
+	}
+
+	stat := limiter.AuthInfo()
+	if stat.Failures != 3 || stat.Lockouts != 1 || stat.Locked != 1 {
+		t.Errorf("Unexpected stats %+v", stat)
+	}
+}
+
+func Test_AuthLimiter_DisabledNeverLocks(t *testing.T) {
+	limiter := NewAuthLimiter(&Config{}, nil)
+	for i := 0; i < 100; i++ {
+		limiter.AuthFailed("192.0.2.1", "", "invalid_session_token")
+	}
+	if err := limiter.AuthAllowed("192.0.2.1", ""); err != nil {
+		t.Errorf("Unexpected error %v with lockouts disabled", err)
+	}
+}
+
+func Test_AuthLimiter_CountsIPv6Networks(t *testing.T) {
+	limiter := NewAuthLimiter(&Config{AuthLimitThreshold: 2, AuthLimitLockout: time.Minute, AuthLimitMaxLockout: time.Hour}, nil)
+
+	limiter.AuthFailed("2001:db8::1", "", "invalid_credentials")
+	limiter.AuthFailed("2001:db8::2", "", "invalid_credentials")
+	assertDataError(t, limiter.AuthAllowed("2001:db8::3", ""), "auth_locked")
+	if err := limiter.AuthAllowed("2001:db8:0:1::1", ""); err != nil {
+		t.Errorf("Unexpected error %v for other network", err)
+	}
+}
+
+func Test_AuthLimiter_DoesNotLockOutRooms(t *testing.T) {
+	limiter := NewAuthLimiter(&Config{AuthLimitThreshold: 2, AuthLimitLockout: time.Minute, AuthLimitMaxLockout: time.Hour}, nil)
+
+	for i := 0; i < 10; i++ {
+		limiter.AuthFailed("", "Room:foo", "invalid_credentials")
+	}
+	if err := limiter.AuthAllowed("192.0.2.1", "Room:foo"); err != nil {
+		t.Errorf("Unexpected error %v for a room with many failures", err)
+	}
+	if stat := limiter.AuthInfo(); stat.Failures != 10 || stat.Lockouts != 0 {
+		t.Errorf("Unexpected stats %+v", stat)
+	}
+}
@@ -0,0 +1,74 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package channelling
+
+// bandwidthCapStep rounds caps down to reduce flapping between nearby values.
+const bandwidthCapStep = 50
+
+// BandwidthPolicy decides how much bandwidth each participant of a room may
+// use to send video to a single peer, based on the latest bandwidth reports
+// of all participants.
+type BandwidthPolicy interface {
+	VideoCap(reports map[string]*DataBandwidth) int
+}
+
+type aggregateBandwidthPolicy struct {
+	minimum int
+	maximum int
+}
+
+// NewBandwidthPolicy creates a policy for mesh calls. Every participant
+// sends its video to and receives video from all others, so the estimates
+// are shared among the peers. Caps at or above the maximum are lifted,
+// caps are never lower than the minimum. A maximum of 0 disables caps.
+func NewBandwidthPolicy(minimum, maximum int) BandwidthPolicy {
+	return &aggregateBandwidthPolicy{minimum, maximum}
+}
+
+func (policy *aggregateBandwidthPolicy) VideoCap(reports map[string]*DataBandwidth) int {
+	peers := len(reports) - 1
+	if policy.maximum <= 0 || peers < 1 {
+		return 0
+	}
+
+	videoCap := policy.maximum
+	for _, report := range reports {
+		if report.Send > 0 && report.Send/peers < videoCap {
+			videoCap = report.Send / peers
+		}
+		if report.Receive > 0 && report.Receive/peers < videoCap {
+			videoCap = report.Receive / peers
+		}
+	}
+	if videoCap >= policy.maximum {
+		return 0
+	}
+
+	videoCap -= videoCap % bandwidthCapStep
+	if videoCap < bandwidthCapStep {
+		videoCap = bandwidthCapStep
+	}
+	if videoCap < policy.minimum {
+		videoCap = policy.minimum
+	}
+	return videoCap
+}
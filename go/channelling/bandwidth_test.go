@@ -0,0 +1,58 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package channelling
+
+import (
+	"testing"
+)
+
+func Test_BandwidthPolicy_SharesEstimatesAmongPeers(t *testing.T) {
+	policy := NewBandwidthPolicy(100, 2000)
+	reports := map[string]*DataBandwidth{
+		"a": {Type: "Bandwidth", Send: 5000, Receive: 5000},
+		"b": {Type: "Bandwidth", Send: 5000, Receive: 5000},
+	}
+	if videoCap := policy.VideoCap(reports); videoCap != 0 {
+		t.Errorf("Expected no cap without stress, but got %d", videoCap)
+	}
+
+	reports["c"] = &DataBandwidth{Type: "Bandwidth", Receive: 1530}
+	if videoCap := policy.VideoCap(reports); videoCap != 750 {
+		t.Errorf("Expected cap of 750, but got %d", videoCap)
+	}
+
+	reports["c"].Receive = 20
+	if videoCap := policy.VideoCap(reports); videoCap != 100 {
+		t.Errorf("Expected cap to be clamped to the minimum, but got %d", videoCap)
+	}
+}
+
+func Test_BandwidthPolicy_IsDisabledWithoutMaximum(t *testing.T) {
+	policy := NewBandwidthPolicy(100, 0)
+	reports := map[string]*DataBandwidth{
+		"a": {Type: "Bandwidth", Receive: 200},
+		"b": {Type: "Bandwidth", Receive: 200},
+	}
+	if videoCap := policy.VideoCap(reports); videoCap != 0 {
+		t.Errorf("Expected no cap when disabled, but got %d", videoCap)
+	}
+}
@@ -0,0 +1,214 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package channelling
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/strukturag/spreed-webrtc/go/objectstore"
+	"github.com/strukturag/spreed-webrtc/go/randomstring"
+)
+
+const (
+	// Maximum number of chunks of a single blob.
+	blobMaxChunks = 64
+	// Maximum number of incomplete transfers per session.
+	blobMaxTransfers = 16
+)
+
+// BlobRelay reassembles blobs sent in chunks by sessions, so they can be
+// relayed to their recipient in one piece.
+type BlobRelay interface {
+	AddBlobChunk(sessionID string, chunk *DataBlobChunk) (*DataBlob, error)
+	CleanupBlobs(sessionID string)
+	SetObjectStore(store objectstore.Store, expires time.Duration)
+	StoreBlob(blob *DataBlob) error
+}
+
+type blobTransfer struct {
+	to       string
+	mime     string
+	chunks   [][]byte
+	received int
+	size     int
+	timer    *time.Timer
+}
+
+type blobRelay struct {
+	sync.Mutex
+	transfers map[string]map[string]*blobTransfer // Session id -> transfer id -> transfer.
+	usage     map[string]int                      // Session id -> bytes of incomplete transfers.
+	maxSize   int
+	quota     int
+	timeout   time.Duration
+	store     objectstore.Store
+	expires   time.Duration
+}
+
+// NewBlobRelay returns a BlobRelay which accepts blobs up to the configured
+// maximum size, limits the bytes of incomplete transfers per session to the
+// configured quota and drops transfers which are not completed in time.
+func NewBlobRelay(config *Config) BlobRelay {
+	return &blobRelay{
+		transfers: make(map[string]map[string]*blobTransfer),
+		usage:     make(map[string]int),
+		maxSize:   config.BlobMaxSize,
+		quota:     config.BlobQuota,
+		timeout:   config.BlobTimeout,
+	}
+}
+
+// AddBlobChunk adds chunk to the transfer it belongs to and returns the
+// complete blob once all chunks have been received.
+func (relay *blobRelay) AddBlobChunk(sessionID string, chunk *DataBlobChunk) (*DataBlob, error) {
+	if chunk.Id == "" || chunk.To == "" || chunk.Total < 1 || chunk.Total > blobMaxChunks || chunk.Index < 0 || chunk.Index >= chunk.Total || len(chunk.Data) == 0 {
+		return nil, NewDataError("invalid_blob_chunk", "The blob chunk is not valid")
+	}
+
+	relay.Lock()
+	defer relay.Unlock()
+
+	transfers, ok := relay.transfers[sessionID]
+	if !ok {
+		transfers = make(map[string]*blobTransfer)
+		relay.transfers[sessionID] = transfers
+	}
+	transfer, ok := transfers[chunk.Id]
+	if !ok {
+		if len(transfers) >= blobMaxTransfers {
+			return nil, NewDataError("blob_quota_exceeded", "Too many blob transfers are pending for this session")
+		}
+		transfer = &blobTransfer{
+			to:     chunk.To,
+			mime:   chunk.Mime,
+			chunks: make([][]byte, chunk.Total),
+		}
+		transferID := chunk.Id
+		transfer.timer = time.AfterFunc(relay.timeout, func() {
+			relay.Lock()
+			if current, ok := relay.transfers[sessionID][transferID]; ok && current == transfer {
+				relay.removeTransfer(sessionID, transferID)
+			}
+			relay.Unlock()
+		})
+		transfers[chunk.Id] = transfer
+	} else if transfer.to != chunk.To || len(transfer.chunks) != chunk.Total || transfer.chunks[chunk.Index] != nil {
+		relay.removeTransfer(sessionID, chunk.Id)
+		return nil, NewDataError("invalid_blob_chunk", "The blob chunk does not match its transfer")
+	}
+
+	size := len(chunk.Data)
+	if transfer.size+size > relay.maxSize {
+		relay.removeTransfer(sessionID, chunk.Id)
+		return nil, NewDataError("blob_too_large", "The blob exceeds the size limit")
+	}
+	if relay.usage[sessionID]+size > relay.quota {
+		relay.removeTransfer(sessionID, chunk.Id)
+		return nil, NewDataError("blob_quota_exceeded", "Too much blob data is pending for this session")
+	}
+
+	transfer.chunks[chunk.Index] = chunk.Data
+	transfer.received++
+	transfer.size += size
+	relay.usage[sessionID] += size
+	if transfer.received < len(transfer.chunks) {
+		return nil, nil
+	}
+
+	data := make([]byte, 0, transfer.size)
+	for _, c := range transfer.chunks {
+		data = append(data, c...)
+	}
+	relay.removeTransfer(sessionID, chunk.Id)
+	return &DataBlob{Type: "Blob", To: transfer.to, Id: chunk.Id, Mime: transfer.mime, Data: data}, nil
+}
+
+// CleanupBlobs drops all incomplete transfers of sessionID.
+func (relay *blobRelay) CleanupBlobs(sessionID string) {
+	relay.Lock()
+	for id := range relay.transfers[sessionID] {
+		relay.removeTransfer(sessionID, id)
+	}
+	relay.Unlock()
+}
+
+// SetObjectStore makes StoreBlob upload complete blobs to store, from where
+// recipients download them until expires has passed.
+func (relay *blobRelay) SetObjectStore(store objectstore.Store, expires time.Duration) {
+	relay.Lock()
+	relay.store = store
+	relay.expires = expires
+	relay.Unlock()
+}
+
+// StoreBlob uploads the data of blob to the object store and replaces it
+// with a signed URL. Blobs are kept unchanged without object store.
+func (relay *blobRelay) StoreBlob(blob *DataBlob) error {
+	relay.Lock()
+	store, expires := relay.store, relay.expires
+	relay.Unlock()
+	if store == nil {
+		return nil
+	}
+
+	key := fmt.Sprintf("blobs/%s/%s", randomstring.NewRandomString(24), blob.Id)
+	if err := store.Put(key, blob.Mime, blob.Data); err != nil {
+		log.Println("Failed to store blob", err)
+		return NewDataError("blob_store_failed", "The blob could not be stored")
+	}
+	url, err := store.SignedURL(key, expires)
+	if err != nil {
+		store.Delete(key)
+		log.Println("Failed to sign blob url", err)
+		return NewDataError("blob_store_failed", "The blob could not be stored")
+	}
+	time.AfterFunc(expires, func() {
+		if err := store.Delete(key); err != nil {
+			log.Println("Failed to delete stored blob", key, err)
+		}
+	})
+	blob.Url = url
+	blob.Data = nil
+	return nil
+}
+
+// removeTransfer must be called with the lock held.
+func (relay *blobRelay) removeTransfer(sessionID, id string) {
+	transfers := relay.transfers[sessionID]
+	transfer, ok := transfers[id]
+	if !ok {
+		return
+	}
+	transfer.timer.Stop()
+	delete(transfers, id)
+	if len(transfers) == 0 {
+		delete(relay.transfers, sessionID)
+	}
+	if usage := relay.usage[sessionID] - transfer.size; usage > 0 {
+		relay.usage[sessionID] = usage
+	} else {
+		delete(relay.usage, sessionID)
+	}
+}
@@ -0,0 +1,118 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package channelling
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/strukturag/spreed-webrtc/go/objectstore"
+)
+
+func NewTestBlobRelay() BlobRelay {
+	return NewBlobRelay(&Config{BlobMaxSize: 8, BlobQuota: 10, BlobTimeout: time.Minute})
+}
+
+func Test_BlobRelay_AddBlobChunk_ReassemblesChunks(t *testing.T) {
+	relay := NewTestBlobRelay()
+
+	blob, err := relay.AddBlobChunk("a", &DataBlobChunk{To: "b", Id: "1", Index: 1, Total: 2, Data: []byte("def")})
+	if err != nil || blob != nil {
+		t.Fatalf("Expected incomplete transfer, but got %+v, %v", blob, err)
+	}
+	_, err = relay.AddBlobChunk("a", &DataBlobChunk{To: "b", Id: "1", Index: 1, Total: 2, Data: []byte("def")})
+	assertDataError(t, err, "invalid_blob_chunk")
+
+	relay.AddBlobChunk("a", &DataBlobChunk{To: "b", Id: "2", Index: 1, Total: 2, Data: []byte("def")})
+	blob, err = relay.AddBlobChunk("a", &DataBlobChunk{To: "b", Id: "2", Index: 0, Total: 2, Mime: "text/plain", Data: []byte("abc")})
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if blob == nil || string(blob.Data) != "abcdef" || blob.To != "b" {
+		t.Errorf("Expected reassembled blob, but got %+v", blob)
+	}
+}
+
+func Test_BlobRelay_AddBlobChunk_EnforcesLimits(t *testing.T) {
+	relay := NewTestBlobRelay()
+
+	_, err := relay.AddBlobChunk("a", &DataBlobChunk{To: "b", Id: "1", Index: 0, Total: 1, Data: []byte("123456789")})
+	assertDataError(t, err, "blob_too_large")
+
+	relay.AddBlobChunk("a", &DataBlobChunk{To: "b", Id: "2", Index: 0, Total: 2, Data: []byte("123456")})
+	_, err = relay.AddBlobChunk("a", &DataBlobChunk{To: "b", Id: "3", Index: 0, Total: 2, Data: []byte("123456")})
+	assertDataError(t, err, "blob_quota_exceeded")
+
+	relay.CleanupBlobs("a")
+	if _, err = relay.AddBlobChunk("a", &DataBlobChunk{To: "b", Id: "3", Index: 0, Total: 2, Data: []byte("123456")}); err != nil {
+		t.Errorf("Expected quota to be released on cleanup, but got %v", err)
+	}
+}
+
+func Test_BlobRelay_AddBlobChunk_LimitsPendingTransfers(t *testing.T) {
+	relay := NewBlobRelay(&Config{BlobMaxSize: 8, BlobQuota: 1024, BlobTimeout: time.Minute})
+
+	for i := 0; i < blobMaxTransfers; i++ {
+		if _, err := relay.AddBlobChunk("a", &DataBlobChunk{To: "b", Id: string(rune('a' + i)), Index: 0, Total: 2, Data: []byte("1")}); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+	}
+	_, err := relay.AddBlobChunk("a", &DataBlobChunk{To: "b", Id: "next", Index: 0, Total: 2, Data: []byte("1")})
+	assertDataError(t, err, "blob_quota_exceeded")
+
+	if _, err := relay.AddBlobChunk("c", &DataBlobChunk{To: "b", Id: "next", Index: 0, Total: 2, Data: []byte("1")}); err != nil {
+		t.Errorf("Expected other sessions not to be limited, but got %v", err)
+	}
+}
+
+func Test_BlobRelay_StoreBlob(t *testing.T) {
+	relay := NewTestBlobRelay()
+	blob := &DataBlob{Type: "Blob", To: "b", Id: "1", Mime: "text/plain", Data: []byte("abc")}
+	if err := relay.StoreBlob(blob); err != nil || string(blob.Data) != "abc" || blob.Url != "" {
+		t.Fatalf("Expected blob to be unchanged without store, got %+v, %v", blob, err)
+	}
+
+	dir, err := ioutil.TempDir("", "blobs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	store, _ := objectstore.NewDisk(dir, "https://example.com/objects", []byte("secret"))
+	relay.SetObjectStore(store, time.Minute)
+	if err := relay.StoreBlob(blob); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if blob.Data != nil || !strings.HasPrefix(blob.Url, "https://example.com/objects/blobs/") {
+		t.Fatalf("Expected blob url instead of data, got %+v", blob)
+	}
+	key := strings.TrimPrefix(blob.Url[:strings.Index(blob.Url, "?")], "https://example.com/objects/")
+	if data, err := store.Get(key); err != nil || string(data) != "abc" {
+		t.Errorf("Blob not stored as %s: %q, %v", key, data, err)
+	}
+
+	relay.SetObjectStore(objectstore.NewMemory(), time.Minute)
+	blob = &DataBlob{Type: "Blob", To: "b", Id: "2", Data: []byte("abc")}
+	assertDataError(t, relay.StoreBlob(blob), "blob_store_failed")
+}
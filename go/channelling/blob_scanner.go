@@ -0,0 +1,300 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package channelling
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	BlobStatusScanning = "scanning" // The blob is being scanned.
+	BlobStatusApproved = "approved" // The blob was delivered to the recipient.
+	BlobStatusRejected = "rejected" // The scanner found a problem, the blob was dropped.
+	BlobStatusFailed   = "failed"   // The blob could not be scanned and was dropped.
+)
+
+const (
+	maxBlobScanResponseSize = 64 * 1024
+	blobScanChunkSize       = 16 * 1024 // Chunk size for clamd streams.
+	maxBlobScans            = 8         // Maximum number of concurrent scans.
+)
+
+// BlobScanResult is the verdict of a BlobScanner.
+type BlobScanResult struct {
+	Clean  bool   `json:"clean"`
+	Reason string `json:"reason,omitempty"` // E.g. the name of the found virus.
+}
+
+// BlobScanner scans relayed blobs before they are delivered.
+type BlobScanner interface {
+	ScanBlob(from string, blob *DataBlob) (*BlobScanResult, error)
+}
+
+type blobScanner struct {
+	scanner  BlobScanner
+	failOpen bool
+	scans    chan bool
+}
+
+// NewBlobScanner creates a BlobScanner for rawurl. Supported are clamd
+// (clamd://host:port or clamd:///path/to/socket), ICAP RESPMOD services
+// (icap://host:port/service) and webhooks (http:// or https://). Webhook
+// requests are signed with secret like the join webhook. If failOpen is
+// true, blobs which cannot be scanned are approved.
+func NewBlobScanner(rawurl string, secret []byte, timeout time.Duration, failOpen bool) (BlobScanner, error) {
+	scanner, err := newBlobScannerBackend(rawurl, secret, timeout)
+	if err != nil {
+		return nil, err
+	}
+	return &blobScanner{scanner, failOpen, make(chan bool, maxBlobScans)}, nil
+}
+
+// ScanBlob waits for a free scan slot and scans blob.
+func (scanner *blobScanner) ScanBlob(from string, blob *DataBlob) (*BlobScanResult, error) {
+	scanner.scans <- true
+	result, err := scanner.scanner.ScanBlob(from, blob)
+	<-scanner.scans
+	if err != nil {
+		log.Printf("Failed to scan blob %s of session %s: %s\n", blob.Id, from, err)
+		if scanner.failOpen {
+			return &BlobScanResult{Clean: true}, nil
+		}
+	}
+	return result, err
+}
+
+func newBlobScannerBackend(rawurl string, secret []byte, timeout time.Duration) (BlobScanner, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "clamd":
+		if u.Host != "" {
+			return &clamdScanner{"tcp", u.Host, timeout}, nil
+		}
+		if u.Path == "" {
+			return nil, fmt.Errorf("clamd URL without host or socket path")
+		}
+		return &clamdScanner{"unix", u.Path, timeout}, nil
+	case "icap":
+		host := u.Host
+		if _, _, err := net.SplitHostPort(host); err != nil {
+			host = net.JoinHostPort(host, "1344")
+		}
+		return &icapScanner{u, host, timeout}, nil
+	case "http", "https":
+		return &webhookScanner{rawurl, secret, &http.Client{Timeout: timeout}}, nil
+	}
+	return nil, fmt.Errorf("unsupported blob scanner URL scheme %s", u.Scheme)
+}
+
+type clamdScanner struct {
+	network string
+	address string
+	timeout time.Duration
+}
+
+// ScanBlob streams the blob to clamd with the INSTREAM command.
+func (scanner *clamdScanner) ScanBlob(from string, blob *DataBlob) (*BlobScanResult, error) {
+	conn, err := net.DialTimeout(scanner.network, scanner.address, scanner.timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(scanner.timeout))
+
+	if _, err := conn.Write([]byte("zINSTREAM\x00")); err != nil {
+		return nil, err
+	}
+	size := make([]byte, 4)
+	for data := blob.Data; len(data) > 0; {
+		chunk := data
+		if len(chunk) > blobScanChunkSize {
+			chunk = chunk[:blobScanChunkSize]
+		}
+		data = data[len(chunk):]
+		binary.BigEndian.PutUint32(size, uint32(len(chunk)))
+		if _, err := conn.Write(size); err != nil {
+			return nil, err
+		}
+		if _, err := conn.Write(chunk); err != nil {
+			return nil, err
+		}
+	}
+	binary.BigEndian.PutUint32(size, 0)
+	if _, err := conn.Write(size); err != nil {
+		return nil, err
+	}
+
+	reply, err := bufio.NewReader(io.LimitReader(conn, maxBlobScanResponseSize)).ReadString(0)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	return parseClamdReply(strings.TrimRight(reply, "\x00\n"))
+}
+
+// parseClamdReply parses replies like "stream: OK" and
+// "stream: Eicar-Test-Signature FOUND".
+func parseClamdReply(reply string) (*BlobScanResult, error) {
+	reply = strings.TrimPrefix(reply, "stream: ")
+	switch {
+	case reply == "OK":
+		return &BlobScanResult{Clean: true}, nil
+	case strings.HasSuffix(reply, " FOUND"):
+		return &BlobScanResult{Reason: strings.TrimSuffix(reply, " FOUND")}, nil
+	}
+	return nil, fmt.Errorf("clamd error: %s", reply)
+}
+
+type icapScanner struct {
+	url     *url.URL
+	host    string
+	timeout time.Duration
+}
+
+// ScanBlob sends the blob as encapsulated HTTP response to the ICAP
+// RESPMOD service. A 204 reply approves it, a 200 reply means the service
+// replaced or blocked the content.
+func (scanner *icapScanner) ScanBlob(from string, blob *DataBlob) (*BlobScanResult, error) {
+	conn, err := net.DialTimeout("tcp", scanner.host, scanner.timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(scanner.timeout))
+
+	mime := blob.Mime
+	if mime == "" {
+		mime = "application/octet-stream"
+	}
+	header := fmt.Sprintf("HTTP/1.1 200 OK\r\nContent-Type: %s\r\nContent-Length: %d\r\n\r\n", mime, len(blob.Data))
+	var request bytes.Buffer
+	fmt.Fprintf(&request, "RESPMOD %s ICAP/1.0\r\n", scanner.url.String())
+	fmt.Fprintf(&request, "Host: %s\r\n", scanner.url.Host)
+	request.WriteString("Allow: 204\r\n")
+	fmt.Fprintf(&request, "Encapsulated: res-hdr=0, res-body=%d\r\n\r\n", len(header))
+	request.WriteString(header)
+	if len(blob.Data) > 0 {
+		fmt.Fprintf(&request, "%x\r\n", len(blob.Data))
+		request.Write(blob.Data)
+		request.WriteString("\r\n")
+	}
+	request.WriteString("0\r\n\r\n")
+	if _, err := conn.Write(request.Bytes()); err != nil {
+		return nil, err
+	}
+
+	reader := textproto.NewReader(bufio.NewReader(io.LimitReader(conn, maxBlobScanResponseSize)))
+	status, err := reader.ReadLine()
+	if err != nil {
+		return nil, err
+	}
+	fields := strings.Fields(status)
+	if len(fields) < 2 || !strings.HasPrefix(fields[0], "ICAP/") {
+		return nil, fmt.Errorf("invalid ICAP status %s", status)
+	}
+	headers, err := reader.ReadMIMEHeader()
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	switch fields[1] {
+	case "204":
+		return &BlobScanResult{Clean: true}, nil
+	case "200":
+		reason := headers.Get("X-Infection-Found")
+		if reason == "" {
+			reason = headers.Get("X-Virus-ID")
+		}
+		if reason == "" {
+			reason = "blocked"
+		}
+		return &BlobScanResult{Reason: reason}, nil
+	}
+	return nil, fmt.Errorf("ICAP error: %s", status)
+}
+
+// BlobScanRequest is sent to blob scanning webhooks.
+type BlobScanRequest struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+	Id   string `json:"id"`
+	Mime string `json:"mime,omitempty"`
+	Data []byte `json:"data"` // Base64 encoded in JSON.
+}
+
+type webhookScanner struct {
+	url    string
+	secret []byte
+	client *http.Client
+}
+
+// ScanBlob POSTs a BlobScanRequest to the webhook, which replies with a
+// BlobScanResult.
+func (scanner *webhookScanner) ScanBlob(from string, blob *DataBlob) (*BlobScanResult, error) {
+	body, err := json.Marshal(&BlobScanRequest{from, blob.To, blob.Id, blob.Mime, blob.Data})
+	if err != nil {
+		return nil, err
+	}
+	request, err := http.NewRequest("POST", scanner.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	if len(scanner.secret) > 0 {
+		mac := hmac.New(sha256.New, scanner.secret)
+		mac.Write(body)
+		request.Header.Set("X-Spreed-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	resp, err := scanner.client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		io.Copy(ioutil.Discard, io.LimitReader(resp.Body, maxBlobScanResponseSize))
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	result := &BlobScanResult{}
+	if err = json.NewDecoder(io.LimitReader(resp.Body, maxBlobScanResponseSize)).Decode(result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
@@ -0,0 +1,183 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package channelling
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+var eicar = []byte(`X5O!P%@AP[4\PZX54(P^)7CC)7}$EICAR-STANDARD-ANTIVIRUS-TEST-FILE!$H+H*`)
+
+// serveOnce accepts one connection on a local listener and passes it to
+// handler.
+func serveOnce(t *testing.T, handler func(conn net.Conn)) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		defer listener.Close()
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		handler(conn)
+	}()
+	return listener.Addr().String()
+}
+
+func Test_BlobScanner_Clamd(t *testing.T) {
+	for _, test := range []struct {
+		data  []byte
+		clean bool
+	}{{[]byte("hello"), true}, {eicar, false}} {
+		address := serveOnce(t, func(conn net.Conn) {
+			reader := bufio.NewReader(conn)
+			if command, _ := reader.ReadString(0); command != "zINSTREAM\x00" {
+				t.Errorf("Unexpected command %q", command)
+				return
+			}
+			var data []byte
+			size := make([]byte, 4)
+			for {
+				if _, err := io.ReadFull(reader, size); err != nil {
+					return
+				}
+				length := binary.BigEndian.Uint32(size)
+				if length == 0 {
+					break
+				}
+				chunk := make([]byte, length)
+				io.ReadFull(reader, chunk)
+				data = append(data, chunk...)
+			}
+			if bytes.Contains(data, []byte("EICAR")) {
+				conn.Write([]byte("stream: Eicar-Test-Signature FOUND\x00"))
+			} else {
+				conn.Write([]byte("stream: OK\x00"))
+			}
+		})
+
+		scanner, err := NewBlobScanner("clamd://"+address, nil, time.Second, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		result, err := scanner.ScanBlob("a", &DataBlob{Id: "1", To: "b", Data: test.data})
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if result.Clean != test.clean || (!test.clean && result.Reason != "Eicar-Test-Signature") {
+			t.Errorf("Unexpected result %+v", result)
+		}
+	}
+}
+
+func Test_BlobScanner_ICAP(t *testing.T) {
+	for _, test := range []struct {
+		reply string
+		clean bool
+	}{
+		{"ICAP/1.0 204 No Content\r\n\r\n", true},
+		{"ICAP/1.0 200 OK\r\nX-Infection-Found: Type=0; Resolution=2; Threat=Eicar;\r\n\r\n", false},
+	} {
+		reply := test.reply
+		address := serveOnce(t, func(conn net.Conn) {
+			reader := bufio.NewReader(conn)
+			if line, _ := reader.ReadString('\n'); !strings.HasPrefix(line, "RESPMOD icap://") {
+				t.Errorf("Unexpected request %q", line)
+				return
+			}
+			for {
+				line, err := reader.ReadString('\n')
+				if err != nil || line == "0\r\n" {
+					break
+				}
+			}
+			conn.Write([]byte(reply))
+		})
+
+		scanner, err := NewBlobScanner("icap://"+address+"/avscan", nil, time.Second, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		result, err := scanner.ScanBlob("a", &DataBlob{Id: "1", To: "b", Data: []byte("hello")})
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if result.Clean != test.clean || (!test.clean && !strings.Contains(result.Reason, "Eicar")) {
+			t.Errorf("Unexpected result %+v", result)
+		}
+	}
+}
+
+func Test_BlobScanner_Webhook(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		if r.Header.Get("X-Spreed-Signature") == "" {
+			t.Error("Expected signed request")
+		}
+		request := &BlobScanRequest{}
+		json.Unmarshal(body, request)
+		json.NewEncoder(w).Encode(&BlobScanResult{Clean: request.From == "a" && string(request.Data) == "hello"})
+	}))
+	defer server.Close()
+
+	scanner, err := NewBlobScanner(server.URL, []byte("secret"), time.Second, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result, err := scanner.ScanBlob("a", &DataBlob{Id: "1", To: "b", Data: []byte("hello")}); err != nil || !result.Clean {
+		t.Errorf("Expected clean blob, but got %+v (%v)", result, err)
+	}
+}
+
+func Test_BlobScanner_FailOpen(t *testing.T) {
+	if _, err := NewBlobScanner("ftp://scanner", nil, time.Second, false); err == nil {
+		t.Error("Expected unsupported scheme to fail")
+	}
+
+	// Nothing listens on the address of a closed listener.
+	listener, _ := net.Listen("tcp", "127.0.0.1:0")
+	address := listener.Addr().String()
+	listener.Close()
+
+	closed, _ := NewBlobScanner("clamd://"+address, nil, time.Second, false)
+	if _, err := closed.ScanBlob("a", &DataBlob{Data: []byte("hello")}); err == nil {
+		t.Error("Expected scan to fail")
+	}
+	open, _ := NewBlobScanner("clamd://"+address, nil, time.Second, true)
+	if result, err := open.ScanBlob("a", &DataBlob{Data: []byte("hello")}); err != nil || !result.Clean {
+		t.Errorf("Expected failing scan to approve, but got %+v (%v)", result, err)
+	}
+}
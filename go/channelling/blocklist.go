@@ -0,0 +1,193 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package channelling
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"os"
+	"sort"
+	"sync"
+)
+
+const (
+	maxBlockedUsers = 1000 // Maximum number of users a user can block.
+)
+
+// Blocklist stores which users a user has blocked. Calls, chat and
+// presence of blocked users are not delivered to the blocking user.
+type Blocklist interface {
+	Block(userid, blocked string) ([]string, error)
+	Unblock(userid, blocked string) []string
+	Blocked(userid string) []string
+	IsBlocked(userid, from string) bool
+	EraseUser(userid string) int
+}
+
+type blocklist struct {
+	sync.RWMutex
+	path    string
+	blocked map[string]map[string]bool // Map of userid -> blocked userids.
+}
+
+// NewBlocklist creates a Blocklist. If path is not empty, the blocklists
+// are loaded from and saved to that file.
+func NewBlocklist(path string) (Blocklist, error) {
+	list := &blocklist{
+		path:    path,
+		blocked: make(map[string]map[string]bool),
+	}
+	if path != "" {
+		data, err := ioutil.ReadFile(path)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		if err == nil {
+			var stored map[string][]string
+			if err := json.Unmarshal(data, &stored); err != nil {
+				return nil, err
+			}
+			for userid, blocked := range stored {
+				users := make(map[string]bool)
+				for _, id := range blocked {
+					users[id] = true
+				}
+				list.blocked[userid] = users
+			}
+		}
+	}
+	return list, nil
+}
+
+// Block adds blocked to the blocklist of userid and returns the updated
+// blocklist.
+func (list *blocklist) Block(userid, blocked string) ([]string, error) {
+	if userid == "" {
+		return nil, NewDataError("not_authenticated", "Only authenticated users can block other users")
+	}
+	if blocked == "" || blocked == userid {
+		return nil, NewDataError("invalid_block", "Invalid user to block")
+	}
+	list.Lock()
+	defer list.Unlock()
+	users, ok := list.blocked[userid]
+	if !ok {
+		users = make(map[string]bool)
+		list.blocked[userid] = users
+	}
+	if !users[blocked] {
+		if len(users) >= maxBlockedUsers {
+			return nil, NewDataError("too_many_blocked", "Too many blocked users")
+		}
+		users[blocked] = true
+		list.save()
+	}
+	return list.list(userid), nil
+}
+
+// Unblock removes blocked from the blocklist of userid and returns the
+// updated blocklist.
+func (list *blocklist) Unblock(userid, blocked string) []string {
+	list.Lock()
+	defer list.Unlock()
+	if users, ok := list.blocked[userid]; ok && users[blocked] {
+		delete(users, blocked)
+		if len(users) == 0 {
+			delete(list.blocked, userid)
+		}
+		list.save()
+	}
+	return list.list(userid)
+}
+
+func (list *blocklist) Blocked(userid string) []string {
+	list.RLock()
+	defer list.RUnlock()
+	return list.list(userid)
+}
+
+// IsBlocked returns true if userid has blocked the user from.
+func (list *blocklist) IsBlocked(userid, from string) bool {
+	if userid == "" || from == "" {
+		return false
+	}
+	list.RLock()
+	defer list.RUnlock()
+	return list.blocked[userid][from]
+}
+
+// EraseUser removes the blocklist of userid and userid from the blocklists
+// of other users and returns the number of removed entries.
+func (list *blocklist) EraseUser(userid string) int {
+	list.Lock()
+	defer list.Unlock()
+	count := len(list.blocked[userid])
+	delete(list.blocked, userid)
+	for id, users := range list.blocked {
+		if users[userid] {
+			delete(users, userid)
+			if len(users) == 0 {
+				delete(list.blocked, id)
+			}
+			count++
+		}
+	}
+	if count > 0 {
+		list.save()
+	}
+	return count
+}
+
+// list returns the sorted blocklist of userid. The lock must be held.
+func (list *blocklist) list(userid string) []string {
+	blocked := make([]string, 0, len(list.blocked[userid]))
+	for id := range list.blocked[userid] {
+		blocked = append(blocked, id)
+	}
+	sort.Strings(blocked)
+	return blocked
+}
+
+// save writes all blocklists to the file. The lock must be held.
+func (list *blocklist) save() {
+	if list.path == "" {
+		return
+	}
+	stored := make(map[string][]string, len(list.blocked))
+	for userid := range list.blocked {
+		stored[userid] = list.list(userid)
+	}
+	data, err := json.Marshal(stored)
+	if err != nil {
+		log.Println("Failed to encode blocklists", err)
+		return
+	}
+	tmp := list.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0600); err != nil {
+		log.Println("Failed to save blocklists", err)
+		return
+	}
+	if err := os.Rename(tmp, list.path); err != nil {
+		log.Println("Failed to save blocklists", err)
+	}
+}
@@ -0,0 +1,78 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package channelling
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func Test_Blocklist_BlocksAndUnblocksUsers(t *testing.T) {
+	blocklist, _ := NewBlocklist("")
+	if _, err := blocklist.Block("", "bob"); err == nil {
+		t.Error("Expected anonymous users to be rejected")
+	}
+	if _, err := blocklist.Block("alice", "alice"); err == nil {
+		t.Error("Expected blocking oneself to be rejected")
+	}
+
+	blocklist.Block("alice", "mallory")
+	blocked, err := blocklist.Block("alice", "bob")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if len(blocked) != 2 || blocked[0] != "bob" || blocked[1] != "mallory" {
+		t.Errorf("Expected sorted blocklist, but got %v", blocked)
+	}
+	if !blocklist.IsBlocked("alice", "bob") || blocklist.IsBlocked("bob", "alice") {
+		t.Error("Expected blocking to be one-sided")
+	}
+
+	if blocked := blocklist.Unblock("alice", "bob"); len(blocked) != 1 || blocked[0] != "mallory" {
+		t.Errorf("Expected bob to be unblocked, but got %v", blocked)
+	}
+	if blocklist.IsBlocked("alice", "bob") {
+		t.Error("Expected bob to be unblocked")
+	}
+}
+
+func Test_Blocklist_StoresBlocklists(t *testing.T) {
+	dir, err := ioutil.TempDir("", "blocklist")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "blocklist.json")
+
+	blocklist, _ := NewBlocklist(path)
+	blocklist.Block("alice", "bob")
+
+	loaded, err := NewBlocklist(path)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if !loaded.IsBlocked("alice", "bob") {
+		t.Error("Expected stored blocklist to be loaded")
+	}
+}
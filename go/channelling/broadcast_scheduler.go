@@ -0,0 +1,219 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package channelling
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+const (
+	// Default number of sends a room may spend per round.
+	broadcastDefaultQuantum = 100
+	// Broadcasts queued per room, further broadcasts are dropped.
+	broadcastMaxQueued = 10000
+)
+
+// RoomBroadcastStats are the scheduling metrics of the broadcasts of a
+// room. Sends is the spent budget, the number of recipients of all
+// broadcasts.
+type RoomBroadcastStats struct {
+	Room       string
+	Queued     int
+	Broadcasts uint64
+	Sends      uint64
+	Dropped    uint64
+	Rounds     uint64        // Rounds in which the room was served.
+	Waited     time.Duration // Total time broadcasts waited to be run.
+	MaxWait    time.Duration
+}
+
+type broadcastWork struct {
+	cost   int
+	queued time.Time
+	run    func()
+}
+
+type broadcastRoom struct {
+	stats   RoomBroadcastStats
+	queue   []*broadcastWork
+	deficit int
+	busy    bool // Served by a worker, broadcasts of a room are run in order.
+	ready   bool // In the ready list.
+}
+
+// BroadcastScheduler runs the broadcasts of all rooms with a fixed number
+// of workers, fairly across rooms: rooms with queued broadcasts are served
+// round-robin, and every round a room may spend a budget of quantum sends
+// (deficit round-robin). Large rooms thus wait for their budget instead of
+// starving small ones. Broadcasts of a room are run in order.
+type BroadcastScheduler struct {
+	mutex   sync.Mutex
+	cond    *sync.Cond
+	quantum int
+	rooms   map[string]*broadcastRoom
+	ready   []*broadcastRoom
+	closed  bool
+}
+
+// NewBroadcastScheduler starts a scheduler with workers goroutines. Rooms
+// may spend quantum sends per round, the default if 0.
+func NewBroadcastScheduler(workers, quantum int) *BroadcastScheduler {
+	if quantum <= 0 {
+		quantum = broadcastDefaultQuantum
+	}
+	scheduler := &BroadcastScheduler{
+		quantum: quantum,
+		rooms:   make(map[string]*broadcastRoom),
+	}
+	scheduler.cond = sync.NewCond(&scheduler.mutex)
+	for i := 0; i < workers; i++ {
+		go scheduler.work()
+	}
+	return scheduler
+}
+
+// Submit queues the broadcast run of the room roomID to cost sends. It
+// returns false if the queue of the room is full or the scheduler was
+// stopped.
+func (scheduler *BroadcastScheduler) Submit(roomID string, cost int, run func()) bool {
+	if cost < 1 {
+		cost = 1
+	}
+	scheduler.mutex.Lock()
+	defer scheduler.mutex.Unlock()
+	if scheduler.closed {
+		return false
+	}
+	room, ok := scheduler.rooms[roomID]
+	if !ok {
+		room = &broadcastRoom{stats: RoomBroadcastStats{Room: roomID}}
+		scheduler.rooms[roomID] = room
+	}
+	if len(room.queue) >= broadcastMaxQueued {
+		room.stats.Dropped++
+		log.Printf("Broadcast queue full, dropping broadcast in room '%s'\n", roomID)
+		return false
+	}
+	room.queue = append(room.queue, &broadcastWork{cost, time.Now(), run})
+	scheduler.schedule(room)
+	return true
+}
+
+// Forget removes the metrics of the room roomID once it has no queued
+// broadcasts, e.g. when the room expired.
+func (scheduler *BroadcastScheduler) Forget(roomID string) {
+	scheduler.mutex.Lock()
+	if room, ok := scheduler.rooms[roomID]; ok && len(room.queue) == 0 && !room.busy {
+		delete(scheduler.rooms, roomID)
+	}
+	scheduler.mutex.Unlock()
+}
+
+// Stats returns the metrics of all rooms.
+func (scheduler *BroadcastScheduler) Stats() []*RoomBroadcastStats {
+	scheduler.mutex.Lock()
+	defer scheduler.mutex.Unlock()
+	stats := make([]*RoomBroadcastStats, 0, len(scheduler.rooms))
+	for _, room := range scheduler.rooms {
+		roomStats := room.stats
+		roomStats.Queued = len(room.queue)
+		stats = append(stats, &roomStats)
+	}
+	return stats
+}
+
+// Stop ends the workers once the queued broadcasts were run.
+func (scheduler *BroadcastScheduler) Stop() {
+	scheduler.mutex.Lock()
+	scheduler.closed = true
+	scheduler.cond.Broadcast()
+	scheduler.mutex.Unlock()
+}
+
+// schedule appends room to the ready list if it has work and is not served.
+// The mutex must be held.
+func (scheduler *BroadcastScheduler) schedule(room *broadcastRoom) {
+	if room.busy || room.ready || len(room.queue) == 0 {
+		return
+	}
+	room.ready = true
+	scheduler.ready = append(scheduler.ready, room)
+	scheduler.cond.Signal()
+}
+
+func (scheduler *BroadcastScheduler) work() {
+	scheduler.mutex.Lock()
+	defer scheduler.mutex.Unlock()
+	for {
+		for len(scheduler.ready) == 0 {
+			if scheduler.closed {
+				return
+			}
+			scheduler.cond.Wait()
+		}
+		room := scheduler.ready[0]
+		scheduler.ready[0] = nil
+		scheduler.ready = scheduler.ready[1:]
+		room.ready = false
+
+		// Take the broadcasts the room can afford this round.
+		room.deficit += scheduler.quantum
+		var batch []*broadcastWork
+		for len(room.queue) > 0 && room.queue[0].cost <= room.deficit {
+			work := room.queue[0]
+			room.queue[0] = nil
+			room.queue = room.queue[1:]
+			room.deficit -= work.cost
+			batch = append(batch, work)
+		}
+		if len(batch) == 0 {
+			// Save up for the next round.
+			scheduler.schedule(room)
+			continue
+		}
+		room.busy = true
+		room.stats.Rounds++
+		scheduler.mutex.Unlock()
+
+		for _, work := range batch {
+			waited := time.Since(work.queued)
+			work.run()
+			scheduler.mutex.Lock()
+			room.stats.Broadcasts++
+			room.stats.Sends += uint64(work.cost)
+			room.stats.Waited += waited
+			if waited > room.stats.MaxWait {
+				room.stats.MaxWait = waited
+			}
+			scheduler.mutex.Unlock()
+		}
+
+		scheduler.mutex.Lock()
+		room.busy = false
+		if len(room.queue) == 0 {
+			room.deficit = 0
+		}
+		scheduler.schedule(room)
+	}
+}
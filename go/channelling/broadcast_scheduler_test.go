@@ -0,0 +1,118 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package channelling
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func Test_BroadcastScheduler_RunsRoomInOrder(t *testing.T) {
+	scheduler := NewBroadcastScheduler(4, 10)
+	defer scheduler.Stop()
+
+	var mutex sync.Mutex
+	var order []int
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		i := i
+		wg.Add(1)
+		scheduler.Submit("Room:a", 3, func() {
+			mutex.Lock()
+			order = append(order, i)
+			mutex.Unlock()
+			wg.Done()
+		})
+	}
+	wg.Wait()
+	for i, value := range order {
+		if value != i {
+			t.Fatalf("Expected broadcasts in order, but got %v", order)
+		}
+	}
+
+	stats := scheduler.Stats()
+	if len(stats) != 1 || stats[0].Broadcasts != 50 || stats[0].Sends != 150 || stats[0].Queued != 0 {
+		t.Errorf("Unexpected stats %+v", stats[0])
+	}
+}
+
+func Test_BroadcastScheduler_SmallRoomsDoNotWaitForLargeRooms(t *testing.T) {
+	// A single worker, blocked until all broadcasts are queued.
+	scheduler := NewBroadcastScheduler(1, 10)
+	defer scheduler.Stop()
+	block := make(chan bool)
+	scheduler.Submit("Room:block", 1, func() { <-block })
+
+	var mutex sync.Mutex
+	var order []string
+	record := func(room string) func() {
+		return func() {
+			mutex.Lock()
+			order = append(order, room)
+			mutex.Unlock()
+		}
+	}
+	for i := 0; i < 3; i++ {
+		scheduler.Submit("Room:large", 25, record("large"))
+	}
+	done := make(chan bool)
+	scheduler.Submit("Room:small", 2, func() {
+		record("small")()
+		close(done)
+	})
+	close(block)
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Expected the small room to be served")
+	}
+	mutex.Lock()
+	defer mutex.Unlock()
+	if len(order) == 0 || order[0] != "small" {
+		t.Errorf("Expected the small room to be served before the large room saved up, but got %v", order)
+	}
+}
+
+func Test_BroadcastScheduler_Forget(t *testing.T) {
+	scheduler := NewBroadcastScheduler(1, 0)
+	defer scheduler.Stop()
+	done := make(chan bool)
+	scheduler.Submit("Room:a", 1, func() { close(done) })
+	<-done
+	// The worker updates the stats after running the broadcast.
+	time.Sleep(10 * time.Millisecond)
+	scheduler.Forget("Room:a")
+	if stats := scheduler.Stats(); len(stats) != 0 {
+		t.Errorf("Expected no stats after forgetting the room, but got %d", len(stats))
+	}
+}
+
+func Test_BroadcastScheduler_RejectsAfterStop(t *testing.T) {
+	scheduler := NewBroadcastScheduler(1, 0)
+	scheduler.Stop()
+	if scheduler.Submit("Room:a", 1, func() {}) {
+		t.Error("Expected Submit to fail after Stop")
+	}
+}
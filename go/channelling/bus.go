@@ -33,9 +33,12 @@ type DataSink struct {
 	SubjectIn  string `json:subject_in"`
 }
 
+// DataSinkOutgoing is sent to sinks. Encrypted messages only contain
+// Sealed, which holds the complete message.
 type DataSinkOutgoing struct {
 	Outgoing   *DataOutgoing
 	ToUserid   string
 	FromUserid string
 	Pipe       string `json:",omitempty"`
+	Sealed     string `json:",omitempty"`
 }
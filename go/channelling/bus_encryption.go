@@ -0,0 +1,106 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package channelling
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"github.com/strukturag/spreed-webrtc/go/envelope"
+)
+
+// BusEncryption seals the payloads of triggers and sink messages published
+// to the bus with the keyring of the tenant they belong to, so the broker
+// cannot read them. Tenants are identified by room name prefix, like the
+// reserved room name prefixes.
+type BusEncryption struct {
+	sessions SessionStore
+	fallback *envelope.Keyring
+	tenants  map[string]*envelope.Keyring
+}
+
+// NewBusEncryption creates a BusEncryption which uses the keyring of the
+// longest matching room name prefix in tenants for payloads of sessions in
+// such rooms, and fallback for all others. A nil fallback publishes the
+// payloads of other sessions unencrypted.
+func NewBusEncryption(sessions SessionStore, fallback *envelope.Keyring, tenants map[string]*envelope.Keyring) *BusEncryption {
+	return &BusEncryption{
+		sessions: sessions,
+		fallback: fallback,
+		tenants:  tenants,
+	}
+}
+
+// Seal returns v encoded as JSON and sealed with the keyring of the tenant
+// of the room roomID, or of the room of the session id if roomID is empty.
+// It returns an empty string if no keyring applies.
+func (enc *BusEncryption) Seal(id, roomID string, v interface{}) (string, error) {
+	keyring := enc.keyring(id, roomID)
+	if keyring == nil {
+		return "", nil
+	}
+	plaintext, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return keyring.Seal(plaintext)
+}
+
+// Open decodes the JSON of sealed, which was sealed with the keyring of the
+// tenant of the room roomID, into v.
+func (enc *BusEncryption) Open(roomID, sealed string, v interface{}) error {
+	keyring := enc.keyring("", roomID)
+	if keyring == nil {
+		return errors.New("no keyring for room")
+	}
+	plaintext, err := keyring.Open(sealed)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(plaintext, v)
+}
+
+func (enc *BusEncryption) keyring(id, roomID string) *envelope.Keyring {
+	if len(enc.tenants) == 0 {
+		return enc.fallback
+	}
+	if roomID == "" && id != "" {
+		if session, ok := enc.sessions.GetSession(id); ok {
+			roomID = session.RoomID()
+		}
+	}
+	if roomID == "" {
+		return enc.fallback
+	}
+	roomName := roomID
+	if idx := strings.Index(roomName, ":"); idx >= 0 {
+		roomName = roomName[idx+1:]
+	}
+	keyring, match := enc.fallback, ""
+	for prefix, tenant := range enc.tenants {
+		if strings.HasPrefix(roomName, prefix) && len(prefix) > len(match) {
+			keyring, match = tenant, prefix
+		}
+	}
+	return keyring
+}
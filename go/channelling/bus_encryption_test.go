@@ -0,0 +1,118 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package channelling
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/strukturag/spreed-webrtc/go/envelope"
+)
+
+func newTestKeyring(t *testing.T, id string) *envelope.Keyring {
+	key, err := envelope.NewMasterKey(id, bytes.Repeat([]byte(id[:1]), 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return envelope.NewKeyring(key)
+}
+
+func Test_BusEncryption_SealsWithTenantKeyring(t *testing.T) {
+	fallback, acme := newTestKeyring(t, "default"), newTestKeyring(t, "acme")
+	sessions := testSessionStore{
+		"a": &Session{Id: "a", Roomid: "Room:acme/call"},
+		"b": &Session{Id: "b", Roomid: "Room:other"},
+	}
+	enc := NewBusEncryption(sessions, fallback, map[string]*envelope.Keyring{"acme/": acme})
+
+	sealed, err := enc.Seal("a", "", &BusTrigger{Name: "offer", From: "a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fallback.Open(sealed); err == nil {
+		t.Error("Expected the default keyring not to open tenant payloads")
+	}
+	plaintext, err := acme.Open(sealed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	trigger := &BusTrigger{}
+	if err := json.Unmarshal(plaintext, trigger); err != nil || trigger.From != "a" {
+		t.Errorf("Expected the sealed trigger, but got %s (%v)", plaintext, err)
+	}
+
+	for _, id := range []string{"b", "unknown", ""} {
+		sealed, err := enc.Seal(id, "", &BusTrigger{Name: "offer", From: id})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := fallback.Open(sealed); err != nil {
+			t.Errorf("Expected the default keyring for session %q, but got %v", id, err)
+		}
+	}
+}
+
+func Test_BusEncryption_WithoutFallbackKeepsOtherTenantsPlain(t *testing.T) {
+	sessions := testSessionStore{
+		"a": &Session{Id: "a", Roomid: "Room:acme/call"},
+		"b": &Session{Id: "b", Roomid: "Room:other"},
+	}
+	enc := NewBusEncryption(sessions, nil, map[string]*envelope.Keyring{"acme/": newTestKeyring(t, "acme")})
+	sink := &natsSink{encryption: enc}
+
+	outgoing := &DataSinkOutgoing{Outgoing: &DataOutgoing{From: "b", Data: "hi"}}
+	if sealed, err := sink.seal(outgoing); err != nil || sealed != outgoing {
+		t.Errorf("Expected an unencrypted message, but got %+v (%v)", sealed, err)
+	}
+
+	outgoing = &DataSinkOutgoing{Outgoing: &DataOutgoing{To: "a", Data: "hi"}, Pipe: "a.b"}
+	sealed, err := sink.seal(outgoing)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sealed.Outgoing != nil || sealed.Pipe != "" || !envelope.IsSealed(sealed.Sealed) {
+		t.Errorf("Expected only the sealed message, but got %+v", sealed)
+	}
+}
+
+func Test_BusEncryption_SealsTriggersWithoutSessionByRoom(t *testing.T) {
+	fallback, acme := newTestKeyring(t, "default"), newTestKeyring(t, "acme")
+	enc := NewBusEncryption(testSessionStore{}, fallback, map[string]*envelope.Keyring{"acme/": acme})
+
+	for _, roomID := range []string{
+		triggerRoomID("", "Room:acme/call", &DataRoom{}),
+		triggerRoomID("", "", &AuthEvent{Roomid: "Room:acme/call"}),
+	} {
+		sealed, err := enc.Seal("", roomID, &BusTrigger{Name: "roomexpired"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := acme.Open(sealed); err != nil {
+			t.Errorf("Expected the tenant keyring for room %q, but got %v", roomID, err)
+		}
+	}
+
+	if roomID := triggerRoomID("a", "Room:acme/call", nil); roomID != "" {
+		t.Errorf("Expected the room of the session for triggers of sessions, but got %q", roomID)
+	}
+}
@@ -22,6 +22,7 @@
 package channelling
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
@@ -34,13 +35,21 @@ import (
 )
 
 const (
-	BusManagerStartup    = "startup"
-	BusManagerOffer      = "offer"
-	BusManagerAnswer     = "answer"
-	BusManagerBye        = "bye"
-	BusManagerConnect    = "connect"
-	BusManagerDisconnect = "disconnect"
-	BusManagerSession    = "session"
+	BusManagerStartup          = "startup"
+	BusManagerOffer            = "offer"
+	BusManagerAnswer           = "answer"
+	BusManagerBye              = "bye"
+	BusManagerIceRestart       = "icerestart"
+	BusManagerNetworkChange    = "networkchange"
+	BusManagerConnect          = "connect"
+	BusManagerDisconnect       = "disconnect"
+	BusManagerSession          = "session"
+	BusManagerRoomExpired      = "roomexpired"
+	BusManagerEndRoom          = "endroom"
+	BusManagerRecording        = "recording"
+	BusManagerRecordingConsent = "recordingconsent"
+	BusManagerLeader           = "leader"
+	BusManagerMediaMode        = "mediamode"
 )
 
 // A BusManager provides the API to interact with a bus.
@@ -55,10 +64,12 @@ type BusManager interface {
 	BindSendChan(subject string, channel interface{}) error
 	PrefixSubject(string) string
 	CreateSink(string) Sink
+	SetEncryption(*BusEncryption)
 }
 
 // A BusTrigger is a container to serialize trigger events
-// for the bus backend.
+// for the bus backend. Encrypted triggers only contain Id, Name and
+// Sealed, which holds the complete trigger.
 type BusTrigger struct {
 	Id       string
 	Name     string
@@ -66,6 +77,7 @@ type BusTrigger struct {
 	Payload  string      `json:",omitempty"`
 	Data     interface{} `json:",omitempty"`
 	Pipeline string      `json:",omitempty"`
+	Sealed   string      `json:",omitempty"`
 }
 
 // BusSubjectTrigger returns the bus subject for trigger payloads.
@@ -135,12 +147,17 @@ func (bus *noopBus) CreateSink(id string) Sink {
 	return nil
 }
 
+func (bus *noopBus) SetEncryption(encryption *BusEncryption) {
+	// noop
+}
+
 type natsBus struct {
 	ChannellingAPIConsumer
 	id           string
 	prefix       string
 	ec           *natsconnection.EncodedConnection
 	triggerQueue chan *busQueueEntry
+	encryption   *BusEncryption
 }
 
 func newNatsBus(apiConsumer ChannellingAPIConsumer, id, prefix string) (*natsBus, error) {
@@ -154,7 +171,7 @@ func newNatsBus(apiConsumer ChannellingAPIConsumer, id, prefix string) (*natsBus
 	// Create buffered channel for outbound NATS data.
 	triggerQueue := make(chan *busQueueEntry, 50)
 
-	return &natsBus{apiConsumer, id, prefix, ec, triggerQueue}, nil
+	return &natsBus{apiConsumer, id, prefix, ec, triggerQueue, nil}, nil
 }
 
 func (bus *natsBus) Start() {
@@ -182,6 +199,20 @@ func (bus *natsBus) Trigger(name, from, payload string, data interface{}, pipeli
 	if pipeline != nil {
 		trigger.Pipeline = pipeline.GetID()
 	}
+	if bus.encryption != nil {
+		var sealed string
+		if sealed, err = bus.encryption.Seal(from, triggerRoomID(from, payload, data), trigger); err != nil {
+			log.Println("Failed to seal NATS event", name, err)
+			return err
+		}
+		if sealed != "" {
+			trigger = &BusTrigger{
+				Id:     bus.id,
+				Name:   name,
+				Sealed: sealed,
+			}
+		}
+	}
 	entry := &busQueueEntry{BusSubjectTrigger(bus.prefix, name), trigger}
 	select {
 	case bus.triggerQueue <- entry:
@@ -194,6 +225,19 @@ func (bus *natsBus) Trigger(name, from, payload string, data interface{}, pipeli
 	return err
 }
 
+// triggerRoomID returns the room id of triggers which are not sent by a
+// session. Such triggers carry the room id as payload or, for
+// authentication events, in their data.
+func triggerRoomID(from, payload string, data interface{}) string {
+	if from != "" {
+		return ""
+	}
+	if event, ok := data.(*AuthEvent); ok {
+		return event.Roomid
+	}
+	return payload
+}
+
 func (bus *natsBus) PrefixSubject(sub string) string {
 	return fmt.Sprintf("%s.%s", bus.prefix, sub)
 }
@@ -211,10 +255,16 @@ func (bus *natsBus) BindSendChan(subject string, channel interface{}) error {
 }
 
 func (bus *natsBus) CreateSink(id string) (sink Sink) {
-	sink = newNatsSink(bus, id)
+	sink = newNatsSink(bus, id, bus.encryption)
 	return
 }
 
+// SetEncryption makes the bus seal triggers and sink messages. It must be
+// called before the bus is started.
+func (bus *natsBus) SetEncryption(encryption *BusEncryption) {
+	bus.encryption = encryption
+}
+
 type busQueueEntry struct {
 	subject string
 	data    interface{}
@@ -238,29 +288,61 @@ type natsSink struct {
 	SubjectOut string
 	SubjectIn  string
 	sub        *nats.Subscription
-	sendQueue  chan *DataSinkOutgoing
+	sendQueue  chan json.RawMessage
+	encryption *BusEncryption
 }
 
-func newNatsSink(bm BusManager, id string) *natsSink {
+func newNatsSink(bm BusManager, id string, encryption *BusEncryption) *natsSink {
 	sink := &natsSink{
 		id:         id,
 		bm:         bm,
+		encryption: encryption,
 		SubjectOut: bm.PrefixSubject(fmt.Sprintf("sink.%s.out", id)),
 		SubjectIn:  bm.PrefixSubject(fmt.Sprintf("sink.%s.in", id)),
 	}
 
-	sink.sendQueue = make(chan *DataSinkOutgoing, 100)
+	sink.sendQueue = make(chan json.RawMessage, 100)
 	bm.BindSendChan(sink.SubjectOut, sink.sendQueue)
 
 	return sink
 }
 
-func (sink *natsSink) Write(outgoing *DataSinkOutgoing) (err error) {
+func (sink *natsSink) Write(outgoing *DataSinkOutgoing) (size int, err error) {
 	if sink.Enabled() {
+		if sink.encryption != nil {
+			if outgoing, err = sink.seal(outgoing); err != nil {
+				log.Println("Failed to seal NATS sink message", sink.SubjectOut, err)
+				return 0, err
+			}
+		}
+		// Encode here, so the size is known without encoding twice.
+		var b []byte
+		if b, err = json.Marshal(outgoing); err != nil {
+			log.Println("Failed to encode NATS sink message", sink.SubjectOut, err)
+			return 0, err
+		}
 		log.Println("Sending via NATS sink", sink.SubjectOut, outgoing)
-		sink.sendQueue <- outgoing
+		sink.sendQueue <- json.RawMessage(b)
+		size = len(b)
 	}
-	return err
+	return size, err
+}
+
+// seal returns outgoing sealed with the keyring of the tenant of its
+// sender, or outgoing itself if no keyring applies.
+func (sink *natsSink) seal(outgoing *DataSinkOutgoing) (*DataSinkOutgoing, error) {
+	id := ""
+	if outgoing.Outgoing != nil {
+		id = outgoing.Outgoing.From
+		if id == "" {
+			id = outgoing.Outgoing.To
+		}
+	}
+	sealed, err := sink.encryption.Seal(id, "", outgoing)
+	if err != nil || sealed == "" {
+		return outgoing, err
+	}
+	return &DataSinkOutgoing{Sealed: sealed}, nil
 }
 
 func (sink *natsSink) Enabled() bool {
@@ -290,14 +372,23 @@ func (sink *natsSink) Export() *DataSink {
 	}
 }
 
-func (sink *natsSink) BindRecvChan(channel interface{}) (*nats.Subscription, error) {
+func (sink *natsSink) BindRecv(pipeline *Pipeline) (*nats.Subscription, error) {
 	sink.Lock()
 	defer sink.Unlock()
 	if sink.sub != nil {
 		sink.sub.Unsubscribe()
 		sink.sub = nil
 	}
-	sub, err := sink.bm.BindRecvChan(sink.SubjectIn, channel)
+	// Subscribe to the raw messages, so the size is known without encoding
+	// them again.
+	sub, err := sink.bm.Subscribe(sink.SubjectIn, func(msg *nats.Msg) {
+		incoming := &DataIncoming{}
+		if err := json.Unmarshal(msg.Data, incoming); err != nil {
+			log.Println("Failed to decode NATS sink message", sink.SubjectIn, err)
+			return
+		}
+		pipeline.Receive(incoming, len(msg.Data))
+	})
 	if err != nil {
 		return nil, err
 	}
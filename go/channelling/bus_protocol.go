@@ -0,0 +1,233 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package channelling
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats"
+)
+
+// BusProtocolVersion is the version of the messages servers exchange on the
+// bus. Version 1 are the unversioned subjects of older servers. Subjects
+// used by external services (triggers, sessions, sinks) and the cluster
+// membership are not versioned.
+const BusProtocolVersion = 2
+
+const busBridgeDedupe = 10 * time.Second
+
+// bridgedBusSubjects are the versioned subjects.
+var bridgedBusSubjects = []string{
+	roomBroadcastSubject,
+	presenceUpdateSubject,
+	presenceSyncSubject,
+}
+
+// A BusTranslator converts the messages of a subject between protocol
+// versions.
+type BusTranslator interface {
+	// Subject returns the subject on which messages of version are
+	// received, it may contain wildcards.
+	Subject(version int) string
+	// Translate returns the subject and data to publish a message received
+	// on subject in version from for version to. An empty subject drops
+	// the message.
+	Translate(subject string, from, to int, data json.RawMessage) (string, json.RawMessage, error)
+}
+
+// busTranslators are the translators of subjects whose messages differ
+// between versions, all other subjects are passed on unchanged.
+var busTranslators = map[string]BusTranslator{
+	roomBroadcastSubject: roomBroadcastTranslator{},
+}
+
+// unchangedBusTranslator passes messages on to the subject of the other
+// version.
+type unchangedBusTranslator string
+
+func (subject unchangedBusTranslator) Subject(version int) string {
+	return BusSubject(version, string(subject))
+}
+
+func (subject unchangedBusTranslator) Translate(received string, from, to int, data json.RawMessage) (string, json.RawMessage, error) {
+	return BusSubject(to, string(subject)), data, nil
+}
+
+// BusSubject returns the name of subject for a protocol version.
+func BusSubject(version int, subject string) string {
+	if version <= 1 {
+		return subject
+	}
+	parts := strings.SplitN(subject, ".", 2)
+	if len(parts) == 1 {
+		return fmt.Sprintf("v%d.%s", version, subject)
+	}
+	return fmt.Sprintf("%s.v%d.%s", parts[0], version, parts[1])
+}
+
+// A BusBridge translates messages between servers of different protocol
+// versions sharing the bus, so rooms and presence work across versions
+// while servers are upgraded one by one. Only the cluster leader bridges.
+type BusBridge interface {
+	Start() error
+	Stop()
+}
+
+type busBridge struct {
+	BusManager
+	cluster       Cluster
+	versions      []int
+	mutex         sync.Mutex
+	bridged       map[string]time.Time
+	subscriptions []*nats.Subscription
+	exit          chan bool
+}
+
+// NewBusBridge creates a bridge between the current protocol version and
+// versions.
+func NewBusBridge(busManager BusManager, cluster Cluster, versions []int) BusBridge {
+	return &busBridge{
+		BusManager: busManager,
+		cluster:    cluster,
+		versions:   append([]int{BusProtocolVersion}, versions...),
+		bridged:    make(map[string]time.Time),
+	}
+}
+
+func (bridge *busBridge) Start() error {
+	for _, subject := range bridgedBusSubjects {
+		translator, ok := busTranslators[subject]
+		if !ok {
+			translator = unchangedBusTranslator(subject)
+		}
+		for _, version := range bridge.versions {
+			translator, version := translator, version
+			sub, err := bridge.Subscribe(translator.Subject(version), func(received string, data *json.RawMessage) {
+				if data != nil {
+					bridge.forward(translator, received, version, *data)
+				}
+			})
+			if err != nil {
+				bridge.Stop()
+				return err
+			}
+			if sub != nil {
+				bridge.subscriptions = append(bridge.subscriptions, sub)
+			}
+		}
+	}
+
+	bridge.exit = make(chan bool)
+	go func(exit chan bool) {
+		ticker := time.NewTicker(busBridgeDedupe)
+		defer ticker.Stop()
+		for {
+			select {
+			case now := <-ticker.C:
+				bridge.expireBridged(now)
+			case <-exit:
+				return
+			}
+		}
+	}(bridge.exit)
+	return nil
+}
+
+func (bridge *busBridge) Stop() {
+	for _, sub := range bridge.subscriptions {
+		sub.Unsubscribe()
+	}
+	bridge.subscriptions = nil
+	if bridge.exit != nil {
+		close(bridge.exit)
+		bridge.exit = nil
+	}
+}
+
+// forward publishes a message received on subject for version to all other
+// versions. Messages published by the bridge itself are recognized when
+// they come back and are not forwarded again.
+func (bridge *busBridge) forward(translator BusTranslator, subject string, version int, data json.RawMessage) {
+	if !bridge.cluster.IsLeader() {
+		return
+	}
+	if bridge.wasBridged(subject, data) {
+		return
+	}
+	for _, to := range bridge.versions {
+		if to == version {
+			continue
+		}
+		target, translated, err := translator.Translate(subject, version, to, data)
+		if err != nil {
+			log.Printf("Failed to translate %s from version %d to %d: %s\n", subject, version, to, err)
+			continue
+		}
+		if target == "" {
+			continue
+		}
+		bridge.markBridged(target, translated)
+		if err := bridge.Publish(target, translated); err != nil {
+			log.Println("Failed to bridge", target, err)
+		}
+	}
+}
+
+func (bridge *busBridge) markBridged(subject string, data json.RawMessage) {
+	key := busBridgeKey(subject, data)
+	bridge.mutex.Lock()
+	bridge.bridged[key] = time.Now()
+	bridge.mutex.Unlock()
+}
+
+func (bridge *busBridge) wasBridged(subject string, data json.RawMessage) bool {
+	key := busBridgeKey(subject, data)
+	bridge.mutex.Lock()
+	defer bridge.mutex.Unlock()
+	if _, ok := bridge.bridged[key]; ok {
+		delete(bridge.bridged, key)
+		return true
+	}
+	return false
+}
+
+// expireBridged forgets bridged messages which did not come back within
+// the dedupe time.
+func (bridge *busBridge) expireBridged(now time.Time) {
+	bridge.mutex.Lock()
+	for key, bridged := range bridge.bridged {
+		if now.Sub(bridged) > busBridgeDedupe {
+			delete(bridge.bridged, key)
+		}
+	}
+	bridge.mutex.Unlock()
+}
+
+func busBridgeKey(subject string, data json.RawMessage) string {
+	return fmt.Sprintf("%s:%x", subject, sha256.Sum256(data))
+}
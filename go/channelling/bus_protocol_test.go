@@ -0,0 +1,125 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package channelling
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+type publishingBus struct {
+	BusManager
+	published []string
+}
+
+func (bus *publishingBus) Publish(subject string, v interface{}) error {
+	bus.published = append(bus.published, subject)
+	return nil
+}
+
+func NewTestBusBridge(leader bool) (*busBridge, *publishingBus) {
+	cluster := NewTestCluster()
+	if leader {
+		cluster.started = time.Now().Add(-time.Minute)
+		cluster.updateLeader(time.Now())
+	}
+	bus := &publishingBus{BusManager: NewBusManager(nil, "", false, "")}
+	return NewBusBridge(bus, cluster, []int{1}).(*busBridge), bus
+}
+
+func Test_BusSubject_InsertsVersion(t *testing.T) {
+	if subject := BusSubject(1, "channelling.room.broadcast"); subject != "channelling.room.broadcast" {
+		t.Errorf("Expected unversioned subject, but got %s", subject)
+	}
+	if subject := BusSubject(2, "channelling.room.broadcast"); subject != "channelling.v2.room.broadcast" {
+		t.Errorf("Expected versioned subject, but got %s", subject)
+	}
+}
+
+func Test_BusBridge_Forward_PublishesToOtherVersionsOnce(t *testing.T) {
+	bridge, bus := NewTestBusBridge(true)
+	translator := unchangedBusTranslator(presenceUpdateSubject)
+	data := json.RawMessage(`{"Node":"a","Userid":"foo","Count":1}`)
+
+	bridge.forward(translator, BusSubject(1, presenceUpdateSubject), 1, data)
+	if len(bus.published) != 1 || bus.published[0] != BusSubject(2, presenceUpdateSubject) {
+		t.Fatalf("Expected message to be bridged to version 2, but got %v", bus.published)
+	}
+
+	// The bridged message comes back from the bus and is not forwarded again.
+	bridge.forward(translator, BusSubject(2, presenceUpdateSubject), 2, data)
+	if len(bus.published) != 1 {
+		t.Errorf("Expected bridged message not to be forwarded again, but got %v", bus.published)
+	}
+}
+
+func Test_BusBridge_Forward_OnlyOnLeader(t *testing.T) {
+	bridge, bus := NewTestBusBridge(false)
+	bridge.forward(unchangedBusTranslator(presenceUpdateSubject), presenceUpdateSubject, 1, json.RawMessage(`{}`))
+	if len(bus.published) != 0 {
+		t.Errorf("Expected no messages to be bridged, but got %v", bus.published)
+	}
+}
+
+func Test_BusBridge_ExpireBridged_ForgetsMessagesWhichDidNotComeBack(t *testing.T) {
+	bridge, _ := NewTestBusBridge(true)
+	data := json.RawMessage(`{}`)
+	bridge.markBridged("a", data)
+	bridge.markBridged("b", data)
+
+	bridge.expireBridged(time.Now())
+	if len(bridge.bridged) != 2 {
+		t.Fatalf("Expected recent messages to be kept, but got %v", bridge.bridged)
+	}
+	bridge.expireBridged(time.Now().Add(2 * busBridgeDedupe))
+	if len(bridge.bridged) != 0 {
+		t.Errorf("Expected old messages to be forgotten, but got %v", bridge.bridged)
+	}
+}
+
+func Test_RoomBroadcastTranslator_BridgesSubjectsPerRoom(t *testing.T) {
+	translator := roomBroadcastTranslator{}
+	roomID := RoomTypeRoom + ":foo"
+	room := BusSubject(2, roomBroadcastRoomSubject(roomID))
+	data := json.RawMessage(`{"roomid":"Room:foo","from":"a","message":{}}`)
+
+	if subject := translator.Subject(1); subject != "channelling.room.broadcast" {
+		t.Errorf("Expected the single subject of version 1, but got %s", subject)
+	}
+	if subject := translator.Subject(2); subject != "channelling.v2.room.broadcast.*" {
+		t.Errorf("Expected the subjects per room of version 2, but got %s", subject)
+	}
+
+	if subject, translated, err := translator.Translate(roomBroadcastSubject, 1, 2, data); err != nil || subject != room || string(translated) != string(data) {
+		t.Errorf("Expected version 1 broadcast on %s, but got %s %s (%v)", room, subject, translated, err)
+	}
+	if subject, _, err := translator.Translate(room, 2, 1, data); err != nil || subject != roomBroadcastSubject {
+		t.Errorf("Expected version 2 broadcast on the single subject, but got %s (%v)", subject, err)
+	}
+	if subject, _, err := translator.Translate(room, 2, 1, json.RawMessage(`{"sealed":"x"}`)); err != nil || subject != "" {
+		t.Errorf("Expected sealed broadcast not to be bridged to version 1, but got %s (%v)", subject, err)
+	}
+	if subject, _, err := translator.Translate(room, 2, 3, json.RawMessage(`{"sealed":"x"}`)); err != nil || subject != BusSubject(3, roomBroadcastRoomSubject(roomID)) {
+		t.Errorf("Expected sealed broadcast to keep its room in version 3, but got %s (%v)", subject, err)
+	}
+}
@@ -0,0 +1,223 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package channelling
+
+import (
+	"time"
+)
+
+const (
+	// CallQueueRoundRobin hands callers to the available agents in turn.
+	CallQueueRoundRobin = "roundrobin"
+	// CallQueueLongestIdle hands callers to the agent which has been
+	// available for the longest time.
+	CallQueueLongestIdle = "longestidle"
+)
+
+const (
+	// AgentStateAvailable agents are handed waiting callers.
+	AgentStateAvailable = "available"
+	// AgentStateOnCall agents talk to the caller they were handed.
+	AgentStateOnCall = "oncall"
+	// AgentStateWrapUp agents finish the work of their last call. They
+	// become available after the wrap-up time of the room.
+	AgentStateWrapUp = "wrapup"
+	// AgentStateOffline agents take no calls.
+	AgentStateOffline = "offline"
+)
+
+type callQueueAgent struct {
+	id       string
+	state    string
+	caller   string    // Caller of the current call.
+	idle     time.Time // When the agent became available.
+	sequence uint64    // Incremented on each state change.
+}
+
+// callQueueAssignment is a caller handed to an agent.
+type callQueueAssignment struct {
+	caller string
+	agent  string
+}
+
+// callQueue holds the callers of a queue room in arrival order and
+// distributes them to the available agents. It is not safe for
+// concurrent use, the room worker guards it with its lock.
+type callQueue struct {
+	strategy string
+	callers  []string
+	agents   []*callQueueAgent // In order of registration.
+	next     int               // Position of the next agent for round-robin.
+	changed  []*DataAgentState // State changes since the last call of changes.
+}
+
+func newCallQueue(strategy string) *callQueue {
+	return &callQueue{strategy: strategy}
+}
+
+// addCaller appends sessionID to the queue unless it is queued already or
+// is an agent. Returns true if the caller was added.
+func (queue *callQueue) addCaller(sessionID string) bool {
+	if queue.position(sessionID) > 0 || queue.agent(sessionID) != nil {
+		return false
+	}
+	queue.callers = append(queue.callers, sessionID)
+	return true
+}
+
+// setAgent registers sessionID as agent and sets its state. An agent which
+// becomes available counts as idle from now on. Returns the agent.
+func (queue *callQueue) setAgent(sessionID string, state string, now time.Time) *callQueueAgent {
+	queue.removeCaller(sessionID)
+	agent := queue.agent(sessionID)
+	if agent == nil {
+		agent = &callQueueAgent{id: sessionID, state: AgentStateOffline}
+		queue.agents = append(queue.agents, agent)
+	}
+	queue.setState(agent, state, now)
+	return agent
+}
+
+func (queue *callQueue) setState(agent *callQueueAgent, state string, now time.Time) {
+	if agent.state == state {
+		return
+	}
+	if state == AgentStateAvailable {
+		agent.idle = now
+	}
+	if state != AgentStateOnCall {
+		agent.caller = ""
+	}
+	agent.state = state
+	agent.sequence++
+	queue.changed = append(queue.changed, &DataAgentState{Type: "AgentState", Id: agent.id, State: state})
+}
+
+// callEnded moves the agent of a call between the sessions a and b to
+// wrap-up. Returns the agent, or nil if no agent was on a call with them.
+func (queue *callQueue) callEnded(a, b string, now time.Time) *callQueueAgent {
+	for _, agent := range queue.agents {
+		if agent.state == AgentStateOnCall && (agent.id == a && agent.caller == b || agent.id == b && agent.caller == a) {
+			queue.setState(agent, AgentStateWrapUp, now)
+			return agent
+		}
+	}
+	return nil
+}
+
+// changes returns and resets the agent state changes.
+func (queue *callQueue) changes() []*DataAgentState {
+	changed := queue.changed
+	queue.changed = nil
+	return changed
+}
+
+// remove drops the caller or agent sessionID from the queue. Returns true
+// if the positions of the remaining callers changed. Agents are on a call
+// with a removed caller no longer.
+func (queue *callQueue) remove(sessionID string, now time.Time) bool {
+	if queue.removeCaller(sessionID) {
+		return true
+	}
+	for idx, agent := range queue.agents {
+		if agent.caller == sessionID {
+			queue.setState(agent, AgentStateWrapUp, now)
+		}
+		if agent.id == sessionID {
+			queue.agents = append(queue.agents[:idx], queue.agents[idx+1:]...)
+			if queue.next > idx {
+				queue.next--
+			}
+			break
+		}
+	}
+	return false
+}
+
+func (queue *callQueue) removeCaller(sessionID string) bool {
+	for idx, caller := range queue.callers {
+		if caller == sessionID {
+			queue.callers = append(queue.callers[:idx], queue.callers[idx+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// position returns the 1-based position of the caller sessionID, or 0 if
+// it is not queued.
+func (queue *callQueue) position(sessionID string) int {
+	for idx, caller := range queue.callers {
+		if caller == sessionID {
+			return idx + 1
+		}
+	}
+	return 0
+}
+
+func (queue *callQueue) agent(sessionID string) *callQueueAgent {
+	for _, agent := range queue.agents {
+		if agent.id == sessionID {
+			return agent
+		}
+	}
+	return nil
+}
+
+// distribute hands the longest waiting callers to available agents, which
+// are on a call afterwards.
+func (queue *callQueue) distribute(now time.Time) []callQueueAssignment {
+	var assignments []callQueueAssignment
+	for len(queue.callers) > 0 {
+		agent := queue.pick()
+		if agent == nil {
+			break
+		}
+		queue.setState(agent, AgentStateOnCall, now)
+		agent.caller = queue.callers[0]
+		assignments = append(assignments, callQueueAssignment{caller: queue.callers[0], agent: agent.id})
+		queue.callers = queue.callers[1:]
+	}
+	return assignments
+}
+
+// pick returns the available agent to take the next call according to the
+// strategy, or nil if all agents are busy.
+func (queue *callQueue) pick() *callQueueAgent {
+	if queue.strategy == CallQueueLongestIdle {
+		var picked *callQueueAgent
+		for _, agent := range queue.agents {
+			if agent.state == AgentStateAvailable && (picked == nil || agent.idle.Before(picked.idle)) {
+				picked = agent
+			}
+		}
+		return picked
+	}
+	for i := range queue.agents {
+		idx := (queue.next + i) % len(queue.agents)
+		if agent := queue.agents[idx]; agent.state == AgentStateAvailable {
+			queue.next = idx + 1
+			return agent
+		}
+	}
+	return nil
+}
@@ -0,0 +1,232 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package channelling
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/strukturag/spreed-webrtc/go/buffercache"
+)
+
+func Test_CallQueue_RoundRobin(t *testing.T) {
+	queue := newCallQueue(CallQueueRoundRobin)
+	now := time.Now()
+	queue.setAgent("agent1", AgentStateAvailable, now)
+	queue.setAgent("agent2", AgentStateAvailable, now)
+	for _, id := range []string{"a", "b", "c"} {
+		if !queue.addCaller(id) {
+			t.Fatalf("Expected caller %s to be queued", id)
+		}
+	}
+	if queue.addCaller("a") || queue.addCaller("agent1") {
+		t.Error("Expected callers to be queued only once and agents not at all")
+	}
+
+	assignments := queue.distribute(time.Now())
+	if len(assignments) != 2 || assignments[0] != (callQueueAssignment{"a", "agent1"}) || assignments[1] != (callQueueAssignment{"b", "agent2"}) {
+		t.Fatalf("Unexpected assignments %+v", assignments)
+	}
+	if position := queue.position("c"); position != 1 {
+		t.Errorf("Expected c at position 1, got %d", position)
+	}
+	if assignments := queue.distribute(time.Now()); len(assignments) != 0 {
+		t.Errorf("Expected busy agents to get no callers, got %+v", assignments)
+	}
+
+	// Both are available again, the next turn is agent1.
+	queue.setAgent("agent2", AgentStateAvailable, now)
+	queue.setAgent("agent1", AgentStateAvailable, now)
+	queue.addCaller("d")
+	assignments = queue.distribute(time.Now())
+	if len(assignments) != 2 || assignments[0] != (callQueueAssignment{"c", "agent1"}) || assignments[1] != (callQueueAssignment{"d", "agent2"}) {
+		t.Fatalf("Unexpected assignments %+v", assignments)
+	}
+}
+
+func Test_CallQueue_LongestIdle(t *testing.T) {
+	queue := newCallQueue(CallQueueLongestIdle)
+	now := time.Now()
+	queue.setAgent("agent1", AgentStateAvailable, now)
+	queue.setAgent("agent2", AgentStateAvailable, now.Add(-time.Minute))
+	queue.setAgent("agent3", AgentStateOffline, now.Add(-time.Hour))
+	queue.addCaller("a")
+	queue.addCaller("b")
+
+	assignments := queue.distribute(time.Now())
+	if len(assignments) != 2 || assignments[0] != (callQueueAssignment{"a", "agent2"}) || assignments[1] != (callQueueAssignment{"b", "agent1"}) {
+		t.Fatalf("Unexpected assignments %+v", assignments)
+	}
+
+	// Staying available keeps the idle time.
+	queue.setAgent("agent1", AgentStateAvailable, now)
+	queue.setAgent("agent1", AgentStateAvailable, now.Add(time.Minute))
+	queue.setAgent("agent2", AgentStateAvailable, now.Add(time.Second))
+	queue.addCaller("c")
+	if assignments := queue.distribute(time.Now()); len(assignments) != 1 || assignments[0].agent != "agent1" {
+		t.Fatalf("Expected agent1 to take the call, got %+v", assignments)
+	}
+}
+
+func Test_CallQueue_Remove(t *testing.T) {
+	queue := newCallQueue(CallQueueRoundRobin)
+	queue.addCaller("a")
+	queue.addCaller("b")
+	if !queue.remove("a", time.Now()) {
+		t.Error("Expected positions to change when a caller leaves")
+	}
+	if position := queue.position("b"); position != 1 {
+		t.Errorf("Expected b at position 1, got %d", position)
+	}
+
+	queue.setAgent("agent1", AgentStateAvailable, time.Now())
+	queue.setAgent("agent2", AgentStateAvailable, time.Now())
+	queue.distribute(time.Now())
+	if queue.remove("agent1", time.Now()) {
+		t.Error("Expected positions to stay when an agent leaves")
+	}
+	queue.setAgent("agent2", AgentStateAvailable, time.Now())
+	queue.addCaller("c")
+	if assignments := queue.distribute(time.Now()); len(assignments) != 1 || assignments[0].agent != "agent2" {
+		t.Fatalf("Expected agent2 to take the call, got %+v", assignments)
+	}
+}
+
+func Test_CallQueue_AgentStates(t *testing.T) {
+	queue := newCallQueue(CallQueueRoundRobin)
+	now := time.Now()
+	queue.setAgent("agent1", AgentStateAvailable, now)
+	queue.setAgent("agent2", AgentStateAvailable, now)
+	queue.addCaller("a")
+	queue.addCaller("b")
+	queue.distribute(now)
+	queue.changes()
+
+	if agent := queue.callEnded("b", "agent1", now); agent != nil {
+		t.Errorf("Expected no agent for unrelated call, got %+v", agent)
+	}
+	if agent := queue.callEnded("a", "agent1", now); agent == nil || agent.state != AgentStateWrapUp || agent.caller != "" {
+		t.Errorf("Expected agent1 in wrap-up, got %+v", agent)
+	}
+	queue.remove("b", now)
+	if agent := queue.agent("agent2"); agent.state != AgentStateWrapUp {
+		t.Errorf("Expected agent2 in wrap-up when its caller left, got %s", agent.state)
+	}
+	changes := queue.changes()
+	if len(changes) != 2 || *changes[0] != (DataAgentState{"AgentState", "agent1", AgentStateWrapUp}) || *changes[1] != (DataAgentState{"AgentState", "agent2", AgentStateWrapUp}) {
+		t.Errorf("Unexpected state changes %+v", changes)
+	}
+
+	// Agents in wrap-up take no callers.
+	queue.addCaller("c")
+	if assignments := queue.distribute(now); len(assignments) != 0 {
+		t.Errorf("Expected no assignments, got %+v", assignments)
+	}
+}
+
+type queueTestSender struct {
+	sync.Mutex
+	messages []string
+}
+
+func (sender *queueTestSender) Index() uint64 {
+	return 0
+}
+
+func (sender *queueTestSender) Send(message buffercache.Buffer) {
+	sender.Lock()
+	sender.messages = append(sender.messages, string(message.Bytes()))
+	sender.Unlock()
+}
+
+func (sender *queueTestSender) received(fragment string) bool {
+	sender.Lock()
+	defer sender.Unlock()
+	for _, message := range sender.messages {
+		if strings.Contains(message, fragment) {
+			return true
+		}
+	}
+	return false
+}
+
+func Test_RoomWorker_CallQueue_HandsCallersToAgents(t *testing.T) {
+	manager := &roomManager{
+		Config:          &Config{},
+		OutgoingEncoder: NewCodec(1024, nil),
+	}
+	worker := NewRoomWorker(manager, testRoomID, testRoomName, testRoomType, nil)
+	go worker.Start()
+	worker.SetTemplate(&RoomTemplate{Name: "support", Queue: CallQueueRoundRobin})
+
+	agent, caller1, caller2 := &queueTestSender{}, &queueTestSender{}, &queueTestSender{}
+	worker.Join(nil, &Session{Id: "agent"}, agent)
+	worker.Join(nil, &Session{Id: "caller1"}, caller1)
+	worker.Join(nil, &Session{Id: "caller2"}, caller2)
+
+	worker.SetQueueAgent("agent", AgentStateAvailable)
+	if !agent.received(`"Caller":"caller1"`) {
+		t.Error("Expected agent to be handed caller1")
+	}
+	if !caller1.received(`"Agent":"agent"`) {
+		t.Error("Expected caller1 to be told the agent")
+	}
+	if !caller2.received(`"Position":1,`) {
+		t.Error("Expected caller2 to move to position 1")
+	}
+
+	// Unknown sessions cannot become agents.
+	worker.SetQueueAgent("unknown", AgentStateAvailable)
+	if caller2.received(`"Agent"`) {
+		t.Error("Expected caller2 to keep waiting")
+	}
+}
+
+func Test_RoomWorker_CallQueue_WrapUp(t *testing.T) {
+	manager := &roomManager{
+		Config:          &Config{},
+		OutgoingEncoder: NewCodec(1024, nil),
+	}
+	worker := NewRoomWorker(manager, testRoomID, testRoomName, testRoomType, nil)
+	go worker.Start()
+	worker.SetTemplate(&RoomTemplate{Name: "support", Queue: CallQueueRoundRobin, QueueWrapUp: 10 * time.Millisecond})
+
+	agent := &queueTestSender{}
+	worker.Join(nil, &Session{Id: "agent"}, agent)
+	worker.SetQueueAgent("agent", AgentStateAvailable)
+	worker.Join(nil, &Session{Id: "caller1"}, nil)
+	worker.Join(nil, &Session{Id: "caller2"}, nil)
+	if !agent.received(`"Caller":"caller1"`) {
+		t.Fatal("Expected agent to be handed caller1")
+	}
+
+	worker.QueueCallEnded("caller1", "agent")
+	deadline := time.Now().Add(time.Second)
+	for !agent.received(`"Caller":"caller2"`) {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected agent to be handed caller2 after wrap-up")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
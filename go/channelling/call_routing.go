@@ -0,0 +1,299 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package channelling
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Actions of call routing rules.
+const (
+	CallRoutingRing      = "ring"
+	CallRoutingVoicemail = "voicemail"
+	CallRoutingClosed    = "closed"
+)
+
+var (
+	callRoutingWeekdays  = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+	callRoutingOccupancy = regexp.MustCompile(`^occupancy(<=|>=|<|>|=)(\d+)$`)
+)
+
+type callRoutingRule struct {
+	action     string
+	voicemail  string // Userid of the voicemail sessions.
+	message    string
+	room       string
+	days       []bool
+	hours      []int // Minutes of the day, from inclusive and until exclusive.
+	presence   []string
+	occupancyF func(int) bool
+}
+
+type callRouting struct {
+	rules    []*callRoutingRule
+	location *time.Location
+}
+
+// LoadCallRoutingRules reads call routing rules from filename, see
+// ParseCallRoutingRules.
+func LoadCallRoutingRules(filename string, location *time.Location) (CallScreener, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ParseCallRoutingRules(f, location)
+}
+
+// ParseCallRoutingRules returns a CallScreener evaluating the call routing
+// rules read from r. Each line is one rule in the form
+//
+//	action [argument] condition... [ : message]
+//
+// Empty lines and lines starting with # are ignored. The first rule whose
+// conditions all match a call decides, calls matching no rule ring. Actions
+// are:
+//
+//	ring                 relay the call to the callee
+//	voicemail <userid>   redirect the call to a session of the user in the
+//	                     room, e.g. a bot recording messages
+//	closed               reject the call, the message after " : " is shown
+//	                     to the caller
+//
+// Conditions are:
+//
+//	room=<room pattern>           the room name matches the glob pattern
+//	days=mon-fri,sun              the call is on one of the days
+//	hours=08:00-18:00             the call is within the hours, until is
+//	                              exclusive and may be before from to span
+//	                              midnight
+//	presence=connected,stale,gone the liveness of the callee session, gone
+//	                              for unknown callees
+//	occupancy<N                   the number of sessions in the room, with
+//	                              one of <, <=, >, >= or =
+//
+// Days and hours are evaluated in location.
+func ParseCallRoutingRules(r io.Reader, location *time.Location) (CallScreener, error) {
+	if location == nil {
+		location = time.Local
+	}
+	routing := &callRouting{location: location}
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		rule, err := parseCallRoutingRule(line)
+		if err != nil {
+			return nil, fmt.Errorf("call routing line %d: %s", n, err)
+		}
+		routing.rules = append(routing.rules, rule)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return routing, nil
+}
+
+func parseCallRoutingRule(line string) (*callRoutingRule, error) {
+	rule := &callRoutingRule{}
+	if idx := strings.Index(line, " : "); idx >= 0 {
+		rule.message = strings.TrimSpace(line[idx+3:])
+		line = line[:idx]
+	}
+	fields := strings.Fields(line)
+	rule.action, fields = fields[0], fields[1:]
+	switch rule.action {
+	case CallRoutingRing, CallRoutingClosed:
+	case CallRoutingVoicemail:
+		if len(fields) == 0 || strings.ContainsAny(fields[0], "=<>") {
+			return nil, fmt.Errorf("voicemail expects a userid")
+		}
+		rule.voicemail, fields = fields[0], fields[1:]
+	default:
+		return nil, fmt.Errorf("unknown action %s", rule.action)
+	}
+
+	for _, field := range fields {
+		if match := callRoutingOccupancy.FindStringSubmatch(field); match != nil {
+			rule.occupancyF = occupancyCondition(match[1], match[2])
+			continue
+		}
+		pos := strings.Index(field, "=")
+		if pos < 0 {
+			return nil, fmt.Errorf("invalid condition %s", field)
+		}
+		key, value := field[:pos], field[pos+1:]
+		var err error
+		switch key {
+		case "room":
+			if _, err = path.Match(value, ""); err == nil {
+				rule.room = value
+			}
+		case "days":
+			rule.days, err = parseCallRoutingDays(value)
+		case "hours":
+			rule.hours, err = parseCallRoutingHours(value)
+		case "presence":
+			rule.presence = strings.Split(value, ",")
+			for _, presence := range rule.presence {
+				switch presence {
+				case SessionLivenessConnected, SessionLivenessStale, SessionLivenessGone:
+				default:
+					err = fmt.Errorf("unknown presence %s", presence)
+				}
+			}
+		default:
+			err = fmt.Errorf("unknown condition %s", key)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return rule, nil
+}
+
+func occupancyCondition(op, value string) func(int) bool {
+	n, _ := strconv.Atoi(value)
+	switch op {
+	case "<":
+		return func(occupancy int) bool { return occupancy < n }
+	case "<=":
+		return func(occupancy int) bool { return occupancy <= n }
+	case ">":
+		return func(occupancy int) bool { return occupancy > n }
+	case ">=":
+		return func(occupancy int) bool { return occupancy >= n }
+	}
+	return func(occupancy int) bool { return occupancy == n }
+}
+
+func parseCallRoutingDay(day string) (int, error) {
+	for i, name := range callRoutingWeekdays {
+		if strings.ToLower(day) == name {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown day %s", day)
+}
+
+func parseCallRoutingDays(value string) ([]bool, error) {
+	days := make([]bool, len(callRoutingWeekdays))
+	for _, span := range strings.Split(value, ",") {
+		bounds := strings.SplitN(span, "-", 2)
+		first, err := parseCallRoutingDay(bounds[0])
+		if err != nil {
+			return nil, err
+		}
+		last := first
+		if len(bounds) == 2 {
+			if last, err = parseCallRoutingDay(bounds[1]); err != nil {
+				return nil, err
+			}
+		}
+		for day := first; ; day = (day + 1) % len(days) {
+			days[day] = true
+			if day == last {
+				break
+			}
+		}
+	}
+	return days, nil
+}
+
+func parseCallRoutingHours(value string) ([]int, error) {
+	bounds := strings.SplitN(value, "-", 2)
+	if len(bounds) != 2 {
+		return nil, fmt.Errorf("hours expect from-until")
+	}
+	hours := make([]int, 2)
+	for i, bound := range bounds {
+		t, err := time.Parse("15:04", bound)
+		if err != nil {
+			return nil, fmt.Errorf("invalid time %s", bound)
+		}
+		hours[i] = t.Hour()*60 + t.Minute()
+	}
+	return hours, nil
+}
+
+func (rule *callRoutingRule) matches(input *CallScreeningInput, now time.Time) bool {
+	if rule.room != "" {
+		if matched, _ := path.Match(rule.room, input.Room.Name); !matched {
+			return false
+		}
+	}
+	if rule.days != nil && !rule.days[now.Weekday()] {
+		return false
+	}
+	if rule.hours != nil {
+		minute := now.Hour()*60 + now.Minute()
+		from, until := rule.hours[0], rule.hours[1]
+		if from <= until && (minute < from || minute >= until) {
+			return false
+		}
+		if from > until && minute < from && minute >= until {
+			return false
+		}
+	}
+	if rule.presence != nil {
+		found := false
+		for _, presence := range rule.presence {
+			if presence == input.Callee.Presence {
+				found = true
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if rule.occupancyF != nil && !rule.occupancyF(input.Occupancy) {
+		return false
+	}
+	return true
+}
+
+func (routing *callRouting) ScreenCall(input *CallScreeningInput) *CallScreeningDecision {
+	now := time.Unix(input.Time, 0).In(routing.location)
+	for _, rule := range routing.rules {
+		if !rule.matches(input, now) {
+			continue
+		}
+		switch rule.action {
+		case CallRoutingVoicemail:
+			return &CallScreeningDecision{Action: CallScreeningRedirect, Reason: CallRoutingVoicemail, RedirectUser: rule.voicemail}
+		case CallRoutingClosed:
+			return &CallScreeningDecision{Action: CallScreeningReject, Reason: CallRoutingClosed, Message: rule.message}
+		}
+		return &CallScreeningDecision{Action: CallScreeningAllow}
+	}
+	return &CallScreeningDecision{Action: CallScreeningAllow}
+}
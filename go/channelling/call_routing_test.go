@@ -0,0 +1,107 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package channelling
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+const testCallRoutingRules = `
+# Helpdesk opening hours.
+ring room=helpdesk days=mon-fri hours=08:00-18:00 presence=connected occupancy<10
+voicemail voicemail-bot room=helpdesk days=mon-fri hours=08:00-18:00
+closed room=helpdesk : We are open Monday to Friday from 8 to 18.
+closed room=night hours=22:00-06:00
+`
+
+func newTestCallRoutingInput(room, presence string, occupancy int, now time.Time) *CallScreeningInput {
+	return &CallScreeningInput{
+		Caller:    &CallScreeningParty{Id: "caller"},
+		Callee:    &CallScreeningParty{Id: "callee", Presence: presence},
+		Room:      &PolicyRoom{Id: "Room:" + room, Name: room},
+		Time:      now.Unix(),
+		Occupancy: occupancy,
+	}
+}
+
+func Test_CallRouting_RoutesByTimePresenceAndOccupancy(t *testing.T) {
+	routing, err := ParseCallRoutingRules(strings.NewReader(testCallRoutingRules), time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	monday := time.Date(2016, time.May, 2, 10, 30, 0, 0, time.UTC)
+	evening := time.Date(2016, time.May, 2, 19, 0, 0, 0, time.UTC)
+	saturday := time.Date(2016, time.May, 7, 10, 30, 0, 0, time.UTC)
+	ring := CallScreeningDecision{Action: CallScreeningAllow}
+	voicemail := CallScreeningDecision{Action: CallScreeningRedirect, Reason: CallRoutingVoicemail, RedirectUser: "voicemail-bot"}
+	closed := CallScreeningDecision{Action: CallScreeningReject, Reason: CallRoutingClosed, Message: "We are open Monday to Friday from 8 to 18."}
+
+	for _, test := range []struct {
+		input    *CallScreeningInput
+		expected CallScreeningDecision
+	}{
+		{newTestCallRoutingInput("helpdesk", SessionLivenessConnected, 2, monday), ring},
+		{newTestCallRoutingInput("helpdesk", SessionLivenessStale, 2, monday), voicemail},
+		{newTestCallRoutingInput("helpdesk", SessionLivenessConnected, 10, monday), voicemail},
+		{newTestCallRoutingInput("helpdesk", SessionLivenessConnected, 2, evening), closed},
+		{newTestCallRoutingInput("helpdesk", SessionLivenessConnected, 2, saturday), closed},
+		{newTestCallRoutingInput("night", SessionLivenessConnected, 2, evening), ring},
+		{newTestCallRoutingInput("night", SessionLivenessConnected, 2, evening.Add(4*time.Hour)), CallScreeningDecision{Action: CallScreeningReject, Reason: CallRoutingClosed}},
+		{newTestCallRoutingInput("lobby", SessionLivenessGone, 2, saturday), ring},
+	} {
+		if decision := routing.ScreenCall(test.input); *decision != test.expected {
+			t.Errorf("Expected %+v for %s at %s, but got %+v", test.expected, test.input.Room.Name, time.Unix(test.input.Time, 0).UTC(), decision)
+		}
+	}
+}
+
+func Test_CallRouting_DaysWrapAroundTheWeek(t *testing.T) {
+	days, err := parseCallRoutingDays("fri-mon,wed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []bool{true, true, false, true, false, true, true}
+	for day := range expected {
+		if days[day] != expected[day] {
+			t.Errorf("Expected %t for %s, but got %t", expected[day], callRoutingWeekdays[day], days[day])
+		}
+	}
+}
+
+func Test_ParseCallRoutingRules_RejectsInvalidRules(t *testing.T) {
+	for _, rules := range []string{
+		"forward room=helpdesk",
+		"voicemail room=helpdesk",
+		"ring days=mon-funday",
+		"ring hours=8-18",
+		"ring presence=online",
+		"ring room=[",
+		"ring weather=sunny",
+		"ring occupancy",
+	} {
+		if _, err := ParseCallRoutingRules(strings.NewReader(rules), nil); err == nil {
+			t.Errorf("Expected rules %q to be invalid", rules)
+		}
+	}
+}
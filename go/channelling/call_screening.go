@@ -0,0 +1,220 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package channelling
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/strukturag/spreed-webrtc/go/plugins"
+)
+
+const (
+	BusManagerCallScreened = "callscreened"
+
+	CallScreeningAllow    = "allow"
+	CallScreeningReject   = "reject"
+	CallScreeningRedirect = "redirect"
+)
+
+// CallScreeningParty identifies the caller or callee of a screened call.
+type CallScreeningParty struct {
+	Id            string
+	Userid        string `json:",omitempty"`
+	Name          string `json:",omitempty"` // Display name from the status.
+	Authenticated bool
+	RemoteIP      string `json:",omitempty"`
+	Presence      string `json:",omitempty"` // Liveness of the session.
+}
+
+// CallScreeningInput describes a call before the offer is relayed to the
+// callee. Time is the Unix time of the call, e.g. for business hours, and
+// Occupancy the number of sessions in the room.
+type CallScreeningInput struct {
+	Caller    *CallScreeningParty
+	Callee    *CallScreeningParty
+	Room      *PolicyRoom
+	Time      int64
+	Occupancy int
+}
+
+// CallScreeningDecision allows, rejects or redirects a call. Redirect is
+// the session id which receives the call instead of the callee, or
+// RedirectUser the user with a session in the room which does. Message is
+// shown to rejected callers. It is triggered on the bus as data of
+// callscreened events.
+type CallScreeningDecision struct {
+	Action       string `json:"action"`
+	Reason       string `json:"reason,omitempty"`
+	Message      string `json:"message,omitempty"`
+	Redirect     string `json:"redirect,omitempty"`
+	RedirectUser string `json:"redirectUser,omitempty"`
+}
+
+// A CallScreener decides about calls before their offer is relayed to the
+// callee.
+type CallScreener interface {
+	ScreenCall(input *CallScreeningInput) *CallScreeningDecision
+}
+
+// NewCallScreeningInput returns the screening input for a call of caller
+// to the session with id to. callee is nil if the session is not known.
+func NewCallScreeningInput(caller, callee *Session, to string) *CallScreeningInput {
+	input := &CallScreeningInput{
+		Caller: newCallScreeningParty(caller),
+		Callee: &CallScreeningParty{Id: to, Presence: SessionLivenessGone},
+		Room: &PolicyRoom{
+			Id:   caller.Roomid,
+			Name: roomNameFromID(caller.Roomid),
+		},
+		Time: time.Now().Unix(),
+	}
+	if callee != nil {
+		input.Callee = newCallScreeningParty(callee)
+		input.Callee.RemoteIP = ""
+	}
+	return input
+}
+
+func newCallScreeningParty(session *Session) *CallScreeningParty {
+	party := &CallScreeningParty{
+		Id:            session.Id,
+		Userid:        session.Userid(),
+		Authenticated: session.authenticated(),
+		RemoteIP:      session.RemoteIP,
+	}
+	data := session.Data()
+	party.Presence = data.Liveness
+	if status, ok := data.Status.(map[string]interface{}); ok {
+		party.Name, _ = status["displayName"].(string)
+	}
+	return party
+}
+
+type callScreeningWebhook struct {
+	url      string
+	secret   []byte
+	failOpen bool
+	client   *http.Client
+}
+
+// NewCallScreeningWebhook creates a CallScreener which POSTs the
+// CallScreeningInput of every call to url and uses the returned
+// CallScreeningDecision. Requests are signed like those of the join
+// webhook. If failOpen is true, calls are allowed when the endpoint
+// cannot be reached.
+func NewCallScreeningWebhook(url string, secret []byte, timeout time.Duration, failOpen bool) CallScreener {
+	return &callScreeningWebhook{
+		url:      url,
+		secret:   secret,
+		failOpen: failOpen,
+		client:   &http.Client{Timeout: timeout},
+	}
+}
+
+func (webhook *callScreeningWebhook) ScreenCall(input *CallScreeningInput) *CallScreeningDecision {
+	decision := &CallScreeningDecision{}
+	err := postWebhook(webhook.client, webhook.url, webhook.secret, input, decision)
+	if err == nil {
+		decision, err = validCallScreeningDecision(decision)
+	}
+	if err != nil {
+		log.Printf("Call screening webhook failed for call of %s: %s\n", input.Caller.Id, err)
+		if webhook.failOpen {
+			return &CallScreeningDecision{Action: CallScreeningAllow}
+		}
+		return &CallScreeningDecision{Action: CallScreeningReject, Reason: "screening_failed"}
+	}
+	return decision
+}
+
+func validCallScreeningDecision(decision *CallScreeningDecision) (*CallScreeningDecision, error) {
+	switch decision.Action {
+	case "":
+		decision.Action = CallScreeningAllow
+	case CallScreeningAllow, CallScreeningReject:
+	case CallScreeningRedirect:
+		if decision.Redirect == "" && decision.RedirectUser == "" {
+			return nil, errors.New("redirect without target")
+		}
+	default:
+		return nil, fmt.Errorf("unknown action %s", decision.Action)
+	}
+	return decision, nil
+}
+
+type pluginCallScreener struct {
+	host *plugins.Host
+}
+
+// NewPluginCallScreener creates a CallScreener which asks the call
+// screeners of host.
+func NewPluginCallScreener(host *plugins.Host) CallScreener {
+	return &pluginCallScreener{host}
+}
+
+func (screener *pluginCallScreener) ScreenCall(input *CallScreeningInput) *CallScreeningDecision {
+	reply := screener.host.ScreenCall(&plugins.CallScreeningRequest{
+		From:       input.Caller.Id,
+		Userid:     input.Caller.Userid,
+		Name:       input.Caller.Name,
+		Roomid:     input.Room.Id,
+		To:         input.Callee.Id,
+		ToUserid:   input.Callee.Userid,
+		ToName:     input.Callee.Name,
+		ToPresence: input.Callee.Presence,
+		Time:       input.Time,
+		Occupancy:  input.Occupancy,
+		RemoteAddr: input.Caller.RemoteIP,
+	})
+	decision, err := validCallScreeningDecision(&CallScreeningDecision{
+		Action:       reply.Action,
+		Reason:       reply.Reason,
+		Message:      reply.Message,
+		Redirect:     reply.Redirect,
+		RedirectUser: reply.RedirectUser,
+	})
+	if err != nil {
+		return &CallScreeningDecision{Action: CallScreeningReject, Reason: "plugin_error"}
+	}
+	return decision
+}
+
+type callScreeners []CallScreener
+
+// ChainCallScreeners returns a CallScreener which asks screeners in order,
+// the first decision which does not allow the call wins.
+func ChainCallScreeners(screeners ...CallScreener) CallScreener {
+	return callScreeners(screeners)
+}
+
+func (screeners callScreeners) ScreenCall(input *CallScreeningInput) *CallScreeningDecision {
+	for _, screener := range screeners {
+		if decision := screener.ScreenCall(input); decision.Action != CallScreeningAllow {
+			return decision
+		}
+	}
+	return &CallScreeningDecision{Action: CallScreeningAllow}
+}
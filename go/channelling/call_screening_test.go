@@ -0,0 +1,96 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package channelling
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type staticCallScreener CallScreeningDecision
+
+func (screener *staticCallScreener) ScreenCall(input *CallScreeningInput) *CallScreeningDecision {
+	decision := CallScreeningDecision(*screener)
+	return &decision
+}
+
+func Test_CallScreeningWebhook(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		input := &CallScreeningInput{}
+		json.NewDecoder(r.Body).Decode(input)
+		switch input.Caller.Userid {
+		case "blocked":
+			json.NewEncoder(w).Encode(&CallScreeningDecision{Action: CallScreeningReject, Reason: "blocklist"})
+		case "afterhours":
+			json.NewEncoder(w).Encode(&CallScreeningDecision{Action: CallScreeningRedirect, Redirect: "voicemail"})
+		case "invalid":
+			json.NewEncoder(w).Encode(&CallScreeningDecision{Action: CallScreeningRedirect})
+		case "broken":
+			http.Error(w, "oops", http.StatusInternalServerError)
+		default:
+			if input.Callee.Id != "callee" || input.Room.Name != "lobby" || input.Time == 0 {
+				http.Error(w, "unexpected input", http.StatusBadRequest)
+				return
+			}
+			w.Write([]byte("{}"))
+		}
+	}))
+	defer server.Close()
+
+	webhook := NewCallScreeningWebhook(server.URL, nil, time.Second, false)
+	caller := &Session{Id: "caller", Roomid: "Room:lobby"}
+	for userid, expected := range map[string]CallScreeningDecision{
+		"":           {Action: CallScreeningAllow},
+		"blocked":    {Action: CallScreeningReject, Reason: "blocklist"},
+		"afterhours": {Action: CallScreeningRedirect, Redirect: "voicemail"},
+		"invalid":    {Action: CallScreeningReject, Reason: "screening_failed"},
+		"broken":     {Action: CallScreeningReject, Reason: "screening_failed"},
+	} {
+		caller.userid = userid
+		if decision := webhook.ScreenCall(NewCallScreeningInput(caller, nil, "callee")); *decision != expected {
+			t.Errorf("Expected %+v for %q, but got %+v", expected, userid, decision)
+		}
+	}
+
+	caller.userid = "broken"
+	failOpen := NewCallScreeningWebhook(server.URL, nil, time.Second, true)
+	if decision := failOpen.ScreenCall(NewCallScreeningInput(caller, nil, "callee")); decision.Action != CallScreeningAllow {
+		t.Errorf("Expected call to be allowed with fail open, but got %+v", decision)
+	}
+}
+
+func Test_ChainCallScreeners_FirstObjectionWins(t *testing.T) {
+	allow := &staticCallScreener{Action: CallScreeningAllow}
+	reject := &staticCallScreener{Action: CallScreeningReject, Reason: "blocklist"}
+	redirect := &staticCallScreener{Action: CallScreeningRedirect, Redirect: "agent"}
+	input := NewCallScreeningInput(&Session{Id: "caller"}, nil, "callee")
+
+	if decision := ChainCallScreeners(allow, allow).ScreenCall(input); decision.Action != CallScreeningAllow {
+		t.Errorf("Expected call to be allowed, but got %+v", decision)
+	}
+	if decision := ChainCallScreeners(allow, redirect, reject).ScreenCall(input); decision.Action != CallScreeningRedirect || decision.Redirect != "agent" {
+		t.Errorf("Expected call to be redirected, but got %+v", decision)
+	}
+}
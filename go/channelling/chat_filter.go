@@ -0,0 +1,184 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package channelling
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/strukturag/spreed-webrtc/go/plugins"
+)
+
+const (
+	ChatFilterActionMask   = "mask"   // Matched words are replaced with asterisks.
+	ChatFilterActionReject = "reject" // Matching messages are rejected.
+	ChatFilterActionFlag   = "flag"   // Matching messages are reported to moderators.
+)
+
+// ChatFilterResult is the result of a ChatFilter. Message replaces the
+// chat message if not empty.
+type ChatFilterResult struct {
+	Message string
+	Reject  bool
+	Flag    bool
+	Reason  string
+}
+
+// ChatFilter checks chat messages before they are relayed. It returns nil
+// if the message passes unchanged. To is empty for room chat.
+type ChatFilter interface {
+	FilterChat(session *Session, to, message string) *ChatFilterResult
+}
+
+type chatFilters []ChatFilter
+
+// ChainChatFilters returns a ChatFilter which passes messages through all
+// filters in order. Each filter receives the message as changed by earlier
+// filters, the first rejection wins.
+func ChainChatFilters(filters ...ChatFilter) ChatFilter {
+	return chatFilters(filters)
+}
+
+func (filters chatFilters) FilterChat(session *Session, to, message string) *ChatFilterResult {
+	var result *ChatFilterResult
+	for _, filter := range filters {
+		filtered := filter.FilterChat(session, to, message)
+		if filtered == nil {
+			continue
+		}
+		if filtered.Reject {
+			return filtered
+		}
+		if result == nil {
+			result = &ChatFilterResult{}
+		}
+		if filtered.Message != "" {
+			message = filtered.Message
+			result.Message = message
+		}
+		if filtered.Flag && !result.Flag {
+			result.Flag = true
+			result.Reason = filtered.Reason
+		}
+	}
+	return result
+}
+
+type wordListChatFilter struct {
+	words  *regexp.Regexp
+	action string
+	reason string
+}
+
+// NewWordListChatFilter creates a ChatFilter which masks, rejects or flags
+// messages containing any of words, depending on action. Words match
+// whole words only and regardless of case.
+func NewWordListChatFilter(words []string, action string) (ChatFilter, error) {
+	switch action {
+	case ChatFilterActionMask, ChatFilterActionReject, ChatFilterActionFlag:
+	default:
+		return nil, fmt.Errorf("invalid chat filter action %s", action)
+	}
+	quoted := make([]string, 0, len(words))
+	for _, word := range words {
+		if word = strings.TrimSpace(word); word != "" {
+			quoted = append(quoted, regexp.QuoteMeta(word))
+		}
+	}
+	if len(quoted) == 0 {
+		return nil, fmt.Errorf("empty chat filter word list")
+	}
+	pattern, err := regexp.Compile(`(?i)\b(?:` + strings.Join(quoted, "|") + `)\b`)
+	if err != nil {
+		return nil, err
+	}
+	return &wordListChatFilter{pattern, action, "wordlist"}, nil
+}
+
+// LoadWordListChatFilter creates a word list ChatFilter with the words of
+// the file at path, one per line. Empty lines and lines starting with #
+// are ignored.
+func LoadWordListChatFilter(path, action string) (ChatFilter, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var words []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		words = append(words, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return NewWordListChatFilter(words, action)
+}
+
+func (filter *wordListChatFilter) FilterChat(session *Session, to, message string) *ChatFilterResult {
+	if !filter.words.MatchString(message) {
+		return nil
+	}
+	switch filter.action {
+	case ChatFilterActionReject:
+		return &ChatFilterResult{Reject: true, Reason: filter.reason}
+	case ChatFilterActionFlag:
+		return &ChatFilterResult{Flag: true, Reason: filter.reason}
+	}
+	masked := filter.words.ReplaceAllStringFunc(message, func(word string) string {
+		return strings.Repeat("*", utf8.RuneCountInString(word))
+	})
+	return &ChatFilterResult{Message: masked}
+}
+
+type pluginChatFilter struct {
+	host *plugins.Host
+}
+
+// NewPluginChatFilter creates a ChatFilter which asks the chat filters of
+// host.
+func NewPluginChatFilter(host *plugins.Host) ChatFilter {
+	return &pluginChatFilter{host}
+}
+
+func (filter *pluginChatFilter) FilterChat(session *Session, to, message string) *ChatFilterResult {
+	reply := filter.host.FilterChat(&plugins.ChatFilterRequest{
+		From:    session.Id,
+		Userid:  session.Userid(),
+		Roomid:  session.Roomid,
+		To:      to,
+		Message: message,
+	})
+	if !reply.Reject && !reply.Flag && reply.Message == "" {
+		return nil
+	}
+	return &ChatFilterResult{reply.Message, reply.Reject, reply.Flag, reply.Reason}
+}
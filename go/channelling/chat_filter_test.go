@@ -0,0 +1,96 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package channelling
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func Test_WordListChatFilter_Actions(t *testing.T) {
+	if _, err := NewWordListChatFilter([]string{"darn"}, "delete"); err == nil {
+		t.Error("Expected invalid action to fail")
+	}
+
+	session := &Session{Id: "a"}
+	mask, _ := NewWordListChatFilter([]string{"darn", "heck"}, ChatFilterActionMask)
+	if result := mask.FilterChat(session, "", "Darned good"); result != nil {
+		t.Errorf("Expected only whole words to match, but got %+v", result)
+	}
+	if result := mask.FilterChat(session, "", "Darn it, what the heck"); result == nil || result.Message != "**** it, what the ****" {
+		t.Errorf("Expected words to be masked, but got %+v", result)
+	}
+
+	reject, _ := NewWordListChatFilter([]string{"darn"}, ChatFilterActionReject)
+	if result := reject.FilterChat(session, "", "darn"); result == nil || !result.Reject {
+		t.Errorf("Expected message to be rejected, but got %+v", result)
+	}
+
+	flag, _ := NewWordListChatFilter([]string{"darn"}, ChatFilterActionFlag)
+	if result := flag.FilterChat(session, "", "darn"); result == nil || !result.Flag || result.Message != "" {
+		t.Errorf("Expected message to be flagged, but got %+v", result)
+	}
+}
+
+func Test_ChainChatFilters(t *testing.T) {
+	session := &Session{Id: "a"}
+	mask, _ := NewWordListChatFilter([]string{"darn"}, ChatFilterActionMask)
+	flag, _ := NewWordListChatFilter([]string{"it"}, ChatFilterActionFlag)
+	reject, _ := NewWordListChatFilter([]string{"darn"}, ChatFilterActionReject)
+
+	chain := ChainChatFilters(mask, flag, reject)
+	if result := chain.FilterChat(session, "", "hello"); result != nil {
+		t.Errorf("Expected message to pass, but got %+v", result)
+	}
+	// The rejecting filter only sees the masked message.
+	result := chain.FilterChat(session, "", "darn it")
+	if result == nil || result.Reject || !result.Flag || result.Message != "**** it" {
+		t.Errorf("Expected message to be masked and flagged, but got %+v", result)
+	}
+
+	chain = ChainChatFilters(reject, mask)
+	if result := chain.FilterChat(session, "", "darn it"); result == nil || !result.Reject {
+		t.Errorf("Expected message to be rejected, but got %+v", result)
+	}
+}
+
+func Test_LoadWordListChatFilter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "chatfilter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "words.txt")
+	if err := ioutil.WriteFile(path, []byte("# Profanity\n\ndarn\n  heck  \n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	filter, err := LoadWordListChatFilter(path, ChatFilterActionMask)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if result := filter.FilterChat(&Session{}, "", "heck, # Profanity"); result == nil || result.Message != "****, # Profanity" {
+		t.Errorf("Expected loaded words to be masked, but got %+v", result)
+	}
+}
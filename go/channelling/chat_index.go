@@ -0,0 +1,323 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package channelling
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// Chat index backends.
+const (
+	ChatIndexMemory        = "memory"
+	ChatIndexElasticsearch = "elasticsearch"
+)
+
+const (
+	chatIndexMaxResults      = 50   // Maximum number of search results.
+	chatIndexQueueSize       = 1024 // Messages waiting to be sent to Elasticsearch.
+	maxElasticsearchResponse = 1024 * 1024
+)
+
+// ChatIndexEntry is an indexed room chat message.
+type ChatIndexEntry struct {
+	Id      string `json:",omitempty"` // Message id of the client, if any.
+	Roomid  string
+	From    string // Session id of the sender.
+	Userid  string `json:",omitempty"`
+	Message string
+	Time    time.Time
+}
+
+// ChatIndex indexes the chat of rooms whose template enables it, so
+// members can search the chat of their room.
+type ChatIndex interface {
+	RetentionStore
+	Index(entry *ChatIndexEntry)
+	// Search returns the newest messages of roomID matching all terms
+	// of query, at most limit.
+	Search(roomID, query string, limit int) ([]*ChatIndexEntry, error)
+	EraseUser(userid string) int
+}
+
+// chatTerms returns the lower case words of text.
+func chatTerms(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(c rune) bool {
+		return !unicode.IsLetter(c) && !unicode.IsNumber(c)
+	})
+}
+
+// chatIndexLimit returns limit bounded to chatIndexMaxResults.
+func chatIndexLimit(limit int) int {
+	if limit <= 0 || limit > chatIndexMaxResults {
+		return chatIndexMaxResults
+	}
+	return limit
+}
+
+type memoryChatEntry struct {
+	*ChatIndexEntry
+	terms []string
+}
+
+// matches returns true if every term is the prefix of a term of entry.
+func (entry *memoryChatEntry) matches(terms []string) bool {
+	for _, term := range terms {
+		found := false
+		for _, t := range entry.terms {
+			if strings.HasPrefix(t, term) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+type memoryChatIndex struct {
+	sync.RWMutex
+	maxEntries int
+	rooms      map[string][]*memoryChatEntry // Oldest first.
+}
+
+// NewMemoryChatIndex creates a ChatIndex which keeps the latest maxEntries
+// messages of each room in memory.
+func NewMemoryChatIndex(maxEntries int) ChatIndex {
+	return &memoryChatIndex{
+		maxEntries: maxEntries,
+		rooms:      make(map[string][]*memoryChatEntry),
+	}
+}
+
+func (index *memoryChatIndex) Index(entry *ChatIndexEntry) {
+	index.Lock()
+	defer index.Unlock()
+	entries := append(index.rooms[entry.Roomid], &memoryChatEntry{entry, chatTerms(entry.Message)})
+	if index.maxEntries > 0 && len(entries) > index.maxEntries {
+		entries = entries[len(entries)-index.maxEntries:]
+	}
+	index.rooms[entry.Roomid] = entries
+}
+
+func (index *memoryChatIndex) Search(roomID, query string, limit int) ([]*ChatIndexEntry, error) {
+	terms := chatTerms(query)
+	limit = chatIndexLimit(limit)
+	results := []*ChatIndexEntry{}
+	if len(terms) == 0 {
+		return results, nil
+	}
+
+	index.RLock()
+	defer index.RUnlock()
+	entries := index.rooms[roomID]
+	for i := len(entries) - 1; i >= 0 && len(results) < limit; i-- {
+		if entries[i].matches(terms) {
+			copied := *entries[i].ChatIndexEntry
+			results = append(results, &copied)
+		}
+	}
+	return results, nil
+}
+
+// ExpireBefore removes messages older than before and returns their
+// number. With dryRun, messages are only counted.
+func (index *memoryChatIndex) ExpireBefore(before time.Time, dryRun bool) int {
+	return index.remove(dryRun, func(entry *memoryChatEntry) bool {
+		return entry.Time.Before(before)
+	})
+}
+
+// EraseUser removes all messages of userid and returns their number.
+func (index *memoryChatIndex) EraseUser(userid string) int {
+	if userid == "" {
+		return 0
+	}
+	return index.remove(false, func(entry *memoryChatEntry) bool {
+		return entry.Userid == userid
+	})
+}
+
+func (index *memoryChatIndex) remove(dryRun bool, matches func(*memoryChatEntry) bool) int {
+	index.Lock()
+	defer index.Unlock()
+	count := 0
+	for roomID, entries := range index.rooms {
+		kept := make([]*memoryChatEntry, 0, len(entries))
+		for _, entry := range entries {
+			if matches(entry) {
+				count++
+			} else if !dryRun {
+				kept = append(kept, entry)
+			}
+		}
+		if dryRun {
+			continue
+		}
+		if len(kept) == 0 {
+			delete(index.rooms, roomID)
+		} else {
+			index.rooms[roomID] = kept
+		}
+	}
+	return count
+}
+
+type elasticsearchChatIndex struct {
+	url    string
+	client *http.Client
+	queue  chan *ChatIndexEntry
+}
+
+// NewElasticsearchChatIndex creates a ChatIndex which stores messages in
+// the Elasticsearch index at url, e.g. http://localhost:9200/spreed-chat.
+// Messages are sent in the background, so chat is never blocked by the
+// search backend.
+func NewElasticsearchChatIndex(url string, timeout time.Duration) ChatIndex {
+	index := &elasticsearchChatIndex{
+		url:    strings.TrimRight(url, "/"),
+		client: &http.Client{Timeout: timeout},
+		queue:  make(chan *ChatIndexEntry, chatIndexQueueSize),
+	}
+	go func() {
+		for entry := range index.queue {
+			if err := index.post("/_doc", entry, nil); err != nil {
+				log.Printf("Failed to index chat message of room %s: %s\n", entry.Roomid, err)
+			}
+		}
+	}()
+	return index
+}
+
+func (index *elasticsearchChatIndex) Index(entry *ChatIndexEntry) {
+	select {
+	case index.queue <- entry:
+	default:
+		log.Println("Chat index queue overflow, dropping message of room", entry.Roomid)
+	}
+}
+
+func (index *elasticsearchChatIndex) Search(roomID, query string, limit int) ([]*ChatIndexEntry, error) {
+	results := []*ChatIndexEntry{}
+	if len(chatTerms(query)) == 0 {
+		return results, nil
+	}
+
+	var response struct {
+		Hits struct {
+			Hits []struct {
+				Source *ChatIndexEntry `json:"_source"`
+			} `json:"hits"`
+		} `json:"hits"`
+	}
+	err := index.post("/_search", map[string]interface{}{
+		"size": chatIndexLimit(limit),
+		"sort": []interface{}{map[string]interface{}{"Time": "desc"}},
+		"query": map[string]interface{}{
+			"bool": map[string]interface{}{
+				"must":   map[string]interface{}{"match": map[string]interface{}{"Message": map[string]interface{}{"query": query, "operator": "and"}}},
+				"filter": map[string]interface{}{"term": map[string]interface{}{"Roomid.keyword": roomID}},
+			},
+		},
+	}, &response)
+	if err != nil {
+		log.Printf("Failed to search chat of room %s: %s\n", roomID, err)
+		return nil, NewDataError("chat_search_failed", "The chat could not be searched")
+	}
+	for _, hit := range response.Hits.Hits {
+		if hit.Source != nil {
+			results = append(results, hit.Source)
+		}
+	}
+	return results, nil
+}
+
+func (index *elasticsearchChatIndex) ExpireBefore(before time.Time, dryRun bool) int {
+	return index.deleteByQuery(map[string]interface{}{
+		"range": map[string]interface{}{"Time": map[string]interface{}{"lt": before.Format(time.RFC3339Nano)}},
+	}, dryRun)
+}
+
+func (index *elasticsearchChatIndex) EraseUser(userid string) int {
+	if userid == "" {
+		return 0
+	}
+	return index.deleteByQuery(map[string]interface{}{
+		"term": map[string]interface{}{"Userid.keyword": userid},
+	}, false)
+}
+
+// deleteByQuery removes the messages matching query and returns their
+// number. With dryRun, messages are only counted.
+func (index *elasticsearchChatIndex) deleteByQuery(query map[string]interface{}, dryRun bool) int {
+	var response struct {
+		Count   int `json:"count"`
+		Deleted int `json:"deleted"`
+	}
+	path := "/_delete_by_query"
+	if dryRun {
+		path = "/_count"
+	}
+	if err := index.post(path, map[string]interface{}{"query": query}, &response); err != nil {
+		log.Println("Failed to remove messages from chat index:", err)
+		return 0
+	}
+	if dryRun {
+		return response.Count
+	}
+	return response.Deleted
+}
+
+// post sends v as JSON to path below the index URL and decodes the reply
+// into response, if not nil.
+func (index *elasticsearchChatIndex) post(path string, v interface{}, response interface{}) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	resp, err := index.client.Post(index.url+path, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	reader := io.LimitReader(resp.Body, maxElasticsearchResponse)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		io.Copy(ioutil.Discard, reader)
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	if response == nil {
+		io.Copy(ioutil.Discard, reader)
+		return nil
+	}
+	return json.NewDecoder(reader).Decode(response)
+}
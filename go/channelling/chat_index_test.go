@@ -0,0 +1,108 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package channelling
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func Test_MemoryChatIndex_SearchMatchesAllTermsInRoom(t *testing.T) {
+	index := NewMemoryChatIndex(0)
+	now := time.Now()
+	index.Index(&ChatIndexEntry{Roomid: "Room:a", From: "1", Message: "The release is on Monday", Time: now})
+	index.Index(&ChatIndexEntry{Roomid: "Room:a", From: "2", Message: "Release notes are ready", Time: now})
+	index.Index(&ChatIndexEntry{Roomid: "Room:b", From: "3", Message: "Release on Monday", Time: now})
+
+	results, _ := index.Search("Room:a", "releas", 0)
+	if len(results) != 2 || results[0].From != "2" {
+		t.Fatalf("Expected both messages of the room, newest first, but got %v", results)
+	}
+	if results, _ = index.Search("Room:a", "release mon", 0); len(results) != 1 || results[0].From != "1" {
+		t.Errorf("Expected the message with all terms, but got %v", results)
+	}
+	if results, _ = index.Search("Room:a", "release", 1); len(results) != 1 {
+		t.Errorf("Expected results to be limited, but got %d", len(results))
+	}
+	if results, _ = index.Search("Room:a", " ?! ", 0); len(results) != 0 {
+		t.Errorf("Expected no results without terms, but got %d", len(results))
+	}
+}
+
+func Test_MemoryChatIndex_ExpiresAndErases(t *testing.T) {
+	index := NewMemoryChatIndex(2)
+	now := time.Now()
+	index.Index(&ChatIndexEntry{Roomid: "Room:a", Message: "dropped", Time: now.Add(-3 * time.Hour)})
+	index.Index(&ChatIndexEntry{Roomid: "Room:a", Userid: "alice", Message: "old", Time: now.Add(-2 * time.Hour)})
+	index.Index(&ChatIndexEntry{Roomid: "Room:a", Userid: "bob", Message: "new", Time: now})
+
+	if results, _ := index.Search("Room:a", "dropped", 0); len(results) != 0 {
+		t.Error("Expected the oldest message to be dropped beyond maxEntries")
+	}
+	if expired := index.ExpireBefore(now.Add(-time.Hour), true); expired != 1 {
+		t.Errorf("Expected 1 message to expire in dry run, but got %d", expired)
+	}
+	if results, _ := index.Search("Room:a", "old", 0); len(results) != 1 {
+		t.Error("Expected dry run to keep messages")
+	}
+	if expired := index.ExpireBefore(now.Add(-time.Hour), false); expired != 1 {
+		t.Errorf("Expected 1 message to expire, but got %d", expired)
+	}
+	if erased := index.EraseUser("bob"); erased != 1 {
+		t.Errorf("Expected 1 message of the user to be erased, but got %d", erased)
+	}
+	if results, _ := index.Search("Room:a", "new", 0); len(results) != 0 {
+		t.Error("Expected erased messages not to be found")
+	}
+}
+
+func Test_ElasticsearchChatIndex_SearchFiltersRoom(t *testing.T) {
+	var query map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/chat/_search" {
+			http.NotFound(w, r)
+			return
+		}
+		json.NewDecoder(r.Body).Decode(&query)
+		w.Write([]byte(`{"hits":{"hits":[{"_source":{"Roomid":"Room:a","From":"1","Message":"hello"}}]}}`))
+	}))
+	defer server.Close()
+
+	index := NewElasticsearchChatIndex(server.URL+"/chat/", time.Second)
+	results, err := index.Search("Room:a", "hello", 500)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if len(results) != 1 || results[0].Message != "hello" {
+		t.Errorf("Unexpected results %v", results)
+	}
+	if size := query["size"]; size != float64(chatIndexMaxResults) {
+		t.Errorf("Expected size to be limited, but got %v", size)
+	}
+	filter := query["query"].(map[string]interface{})["bool"].(map[string]interface{})["filter"]
+	if term := filter.(map[string]interface{})["term"].(map[string]interface{}); term["Roomid.keyword"] != "Room:a" {
+		t.Errorf("Expected search to be filtered by room, but got %v", filter)
+	}
+}
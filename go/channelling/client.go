@@ -23,6 +23,8 @@ package channelling
 
 import (
 	"log"
+	"sync"
+	"time"
 
 	"github.com/strukturag/spreed-webrtc/go/buffercache"
 )
@@ -32,11 +34,28 @@ type Sender interface {
 	Send(buffercache.Buffer)
 }
 
+// PrioritySender is implemented by senders which deliver messages ahead of
+// queued messages, e.g. accessibility events.
+type PrioritySender interface {
+	SendPriority(buffercache.Buffer)
+}
+
+// PresenceSender is implemented by senders which treat presence updates
+// with a lower priority.
+type PresenceSender interface {
+	SendPresence(buffercache.Buffer)
+}
+
 type Client struct {
 	Connection
 	Codec
 	ChannellingAPI ChannellingAPI
+	Tracer         Tracer            // Records the messages of traced sessions, optional.
+	Network        *NetworkSimulator // Simulates network conditions for testing, optional.
+	Catalogs       *MessageCatalogs  // Translates server-generated messages, optional.
 	session        *Session
+	linkMutex      sync.Mutex
+	link           *simulatedLink
 }
 
 func NewClient(codec Codec, api ChannellingAPI, session *Session) *Client {
@@ -57,14 +76,27 @@ func (client *Client) OnConnect(conn Connection) {
 }
 
 func (client *Client) OnDisconnect() {
+	client.linkMutex.Lock()
+	if client.link != nil {
+		client.link.close()
+	}
+	client.linkMutex.Unlock()
 	client.session.Close()
 	client.ChannellingAPI.OnDisconnect(client, client.session)
 }
 
 func (client *Client) OnText(b buffercache.Buffer) {
+	client.trace(TraceInbound, b)
 	incoming, err := client.Codec.DecodeIncoming(b)
 	if err != nil {
 		log.Println("OnText error while processing incoming message", err)
+		if dataError, ok := err.(*DataError); ok {
+			iid := ""
+			if incoming != nil {
+				iid = incoming.Iid
+			}
+			client.reply(iid, dataError)
+		}
 		return
 	}
 
@@ -77,14 +109,97 @@ func (client *Client) OnText(b buffercache.Buffer) {
 	client.ChannellingAPI.OnIncomingProcessed(client, client.session, incoming, reply, err)
 }
 
+func (client *Client) OnSlowConsumer(queued int) {
+	client.reply("", &DataWarning{
+		Type:    "Warning",
+		Code:    "slow_consumer",
+		Message: "The connection cannot keep up, presence updates are delayed",
+	})
+}
+
+// OnStale tells the room when the connection misses pongs, so clients can
+// show the session as reconnecting.
+func (client *Client) OnStale(stale bool) {
+	if client.session.SetStale(stale) {
+		client.session.BroadcastStatus()
+	}
+}
+
 func (client *Client) reply(iid string, m interface{}) {
+	if client.Catalogs != nil {
+		m, _ = client.Catalogs.Localize(client.session.Locale(), m)
+	}
 	outgoing := &DataOutgoing{From: client.session.Id, Iid: iid, Data: m}
 	if b, err := client.Codec.EncodeOutgoing(outgoing); err == nil {
-		client.Connection.Send(b)
+		client.Send(b)
 		b.Decref()
 	}
 }
 
+// Send sends message to the connection of the client.
+func (client *Client) Send(message buffercache.Buffer) {
+	client.trace(TraceOutbound, message)
+	client.deliver(message, false)
+}
+
+// SendPresence sends the presence update message to the connection of the
+// client.
+func (client *Client) SendPresence(message buffercache.Buffer) {
+	client.trace(TraceOutbound, message)
+	client.deliver(message, true)
+}
+
+// SendPriority sends message ahead of queued messages if the connection
+// supports it. Priority messages skip the network simulator.
+func (client *Client) SendPriority(message buffercache.Buffer) {
+	client.trace(TraceOutbound, message)
+	if sender, ok := client.Connection.(PrioritySender); ok {
+		sender.SendPriority(message)
+		return
+	}
+	client.Connection.Send(message)
+}
+
+// deliver sends message to the connection, through the simulated network
+// if the session has network conditions. Once simulated, all further
+// messages take the same way to keep their order.
+func (client *Client) deliver(message buffercache.Buffer, presence bool) {
+	if client.Network != nil {
+		client.linkMutex.Lock()
+		conditions := client.Network.Conditions(client.session)
+		if conditions != nil && client.link == nil {
+			client.link = newSimulatedLink(client.send)
+		}
+		link := client.link
+		client.linkMutex.Unlock()
+		if link != nil {
+			due, ok := time.Now(), true
+			if conditions != nil {
+				due, ok = client.Network.due(conditions, due)
+			}
+			if ok {
+				link.send(due, message, presence)
+			}
+			return
+		}
+	}
+	client.send(message, presence)
+}
+
+func (client *Client) send(message buffercache.Buffer, presence bool) {
+	if presence {
+		client.Connection.SendPresence(message)
+	} else {
+		client.Connection.Send(message)
+	}
+}
+
+func (client *Client) trace(direction string, message buffercache.Buffer) {
+	if client.Tracer != nil && client.Tracer.Tracing(client.session) {
+		client.Tracer.Record(client.session, direction, message.Bytes())
+	}
+}
+
 func (client *Client) Session() *Session {
 	return client.session
 }
@@ -23,4 +23,6 @@ package channelling
 
 type ClientStats interface {
 	ClientInfo(details bool) (int, map[string]*DataSession, map[string]string)
+	LatencyInfo() map[string]*SessionLatency
+	NetworkInfo() map[string]*SessionNetwork
 }
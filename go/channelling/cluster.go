@@ -0,0 +1,311 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package channelling
+
+import (
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats"
+)
+
+const (
+	clusterHeartbeatSubject = "channelling.cluster.heartbeat"
+	clusterLeaveSubject     = "channelling.cluster.leave"
+
+	clusterDefaultHeartbeatInterval = 5 * time.Second
+)
+
+// ClusterNode is the metadata a node announces with its heartbeats.
+type ClusterNode struct {
+	Id       string    `json:"id"`
+	Version  string    `json:"version"`
+	Protocol int       `json:"protocol"`
+	Started  time.Time `json:"started"`
+	Rooms    int       `json:"rooms"`
+	Sessions int       `json:"sessions"`
+	Users    int       `json:"users"`
+	LastSeen time.Time `json:"lastseen"`
+	Self     bool      `json:"self,omitempty"`
+	Leader   bool      `json:"leader,omitempty"`
+}
+
+// A Cluster tracks the nodes which share the bus with this node and elects
+// the node with the lowest id as leader. Nodes only take part in elections
+// after they had one cluster timeout to learn about the other nodes, so
+// there may be no leader for a short time but never knowingly two.
+type Cluster interface {
+	Start() error
+	Stop()
+	Self() string
+	Nodes() []*ClusterNode
+	Node(id string) (*ClusterNode, bool)
+	Leader() string
+	IsLeader() bool
+}
+
+type cluster struct {
+	sync.RWMutex
+	BusManager
+	StatsGenerator
+	id            string
+	version       string
+	started       time.Time
+	interval      time.Duration
+	timeout       time.Duration
+	nodes         map[string]*ClusterNode
+	leader        string
+	subscriptions []*nats.Subscription
+	running       bool
+	exit          chan bool
+}
+
+// NewCluster creates the membership view of the node id. Nodes which did
+// not send a heartbeat within the configured cluster timeout are dropped.
+func NewCluster(config *Config, id string, busManager BusManager, stats StatsGenerator) Cluster {
+	interval := config.ClusterHeartbeatInterval
+	if interval <= 0 {
+		interval = clusterDefaultHeartbeatInterval
+	}
+	timeout := config.ClusterTimeout
+	if timeout < interval {
+		timeout = 3 * interval
+	}
+	return &cluster{
+		BusManager:     busManager,
+		StatsGenerator: stats,
+		id:             id,
+		version:        config.Version,
+		started:        time.Now(),
+		interval:       interval,
+		timeout:        timeout,
+		nodes:          make(map[string]*ClusterNode),
+		exit:           make(chan bool),
+	}
+}
+
+func (cluster *cluster) Start() error {
+	for subject, cb := range map[string]nats.Handler{
+		clusterHeartbeatSubject: cluster.heartbeatReceived,
+		clusterLeaveSubject:     cluster.leaveReceived,
+	} {
+		sub, err := cluster.Subscribe(subject, cb)
+		if err != nil {
+			cluster.Stop()
+			return err
+		}
+		if sub != nil {
+			cluster.subscriptions = append(cluster.subscriptions, sub)
+		}
+	}
+
+	cluster.running = true
+	go func() {
+		ticker := time.NewTicker(cluster.interval)
+		defer ticker.Stop()
+		cluster.heartbeat()
+		for {
+			select {
+			case <-ticker.C:
+				cluster.heartbeat()
+				now := time.Now()
+				cluster.expire(now)
+				cluster.updateLeader(now)
+			case <-cluster.exit:
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+func (cluster *cluster) Stop() {
+	if cluster.running {
+		cluster.running = false
+		close(cluster.exit)
+		if err := cluster.Publish(clusterLeaveSubject, &ClusterNode{Id: cluster.id}); err != nil {
+			log.Println("Failed to publish cluster leave", err)
+		}
+	}
+	for _, sub := range cluster.subscriptions {
+		sub.Unsubscribe()
+	}
+	cluster.subscriptions = nil
+}
+
+func (cluster *cluster) Self() string {
+	return cluster.id
+}
+
+// Leader returns the id of the current leader, or an empty string while
+// no leader is known.
+func (cluster *cluster) Leader() string {
+	cluster.RLock()
+	defer cluster.RUnlock()
+	return cluster.leader
+}
+
+func (cluster *cluster) IsLeader() bool {
+	return cluster.Leader() == cluster.id
+}
+
+// Nodes returns all known nodes sorted by id, including this node.
+func (cluster *cluster) Nodes() []*ClusterNode {
+	cluster.RLock()
+	defer cluster.RUnlock()
+	nodes := []*ClusterNode{cluster.selfNode()}
+	for id, node := range cluster.nodes {
+		if id != cluster.id {
+			copied := *node
+			nodes = append(nodes, &copied)
+		}
+	}
+	for _, node := range nodes {
+		node.Leader = node.Id == cluster.leader
+	}
+	sort.Sort(clusterNodesById(nodes))
+	return nodes
+}
+
+func (cluster *cluster) Node(id string) (*ClusterNode, bool) {
+	if id == cluster.id {
+		node := cluster.selfNode()
+		node.Leader = cluster.IsLeader()
+		return node, true
+	}
+	cluster.RLock()
+	defer cluster.RUnlock()
+	node, ok := cluster.nodes[id]
+	if !ok {
+		return nil, false
+	}
+	copied := *node
+	copied.Leader = id == cluster.leader
+	return &copied, true
+}
+
+func (cluster *cluster) selfNode() *ClusterNode {
+	node := &ClusterNode{
+		Id:       cluster.id,
+		Version:  cluster.version,
+		Protocol: BusProtocolVersion,
+		Started:  cluster.started,
+		LastSeen: time.Now(),
+		Self:     true,
+	}
+	if cluster.StatsGenerator != nil {
+		stat := cluster.Stat(false)
+		node.Rooms = stat.Rooms
+		node.Sessions = stat.Sessions
+		node.Users = stat.Users
+	}
+	return node
+}
+
+func (cluster *cluster) heartbeat() {
+	node := cluster.selfNode()
+	node.Self = false
+	if err := cluster.Publish(clusterHeartbeatSubject, node); err != nil {
+		log.Println("Failed to publish cluster heartbeat", err)
+	}
+}
+
+func (cluster *cluster) heartbeatReceived(node *ClusterNode) {
+	if node == nil || node.Id == "" || node.Id == cluster.id {
+		return
+	}
+	node.LastSeen = time.Now()
+	node.Self = false
+	node.Leader = false
+	cluster.Lock()
+	_, known := cluster.nodes[node.Id]
+	cluster.nodes[node.Id] = node
+	cluster.Unlock()
+	if !known {
+		log.Printf("Cluster node %s joined\n", node.Id)
+		cluster.updateLeader(node.LastSeen)
+	}
+}
+
+func (cluster *cluster) leaveReceived(node *ClusterNode) {
+	if node == nil {
+		return
+	}
+	cluster.Lock()
+	_, known := cluster.nodes[node.Id]
+	delete(cluster.nodes, node.Id)
+	cluster.Unlock()
+	if known {
+		log.Printf("Cluster node %s left\n", node.Id)
+		cluster.updateLeader(time.Now())
+	}
+}
+
+func (cluster *cluster) expire(now time.Time) {
+	cluster.Lock()
+	defer cluster.Unlock()
+	for id, node := range cluster.nodes {
+		if now.Sub(node.LastSeen) > cluster.timeout {
+			delete(cluster.nodes, id)
+			log.Printf("Cluster node %s timed out\n", id)
+		}
+	}
+}
+
+// updateLeader elects the node with the lowest id once this node had the
+// time to learn about the other nodes.
+func (cluster *cluster) updateLeader(now time.Time) {
+	cluster.Lock()
+	previous := cluster.leader
+	leader := ""
+	if now.Sub(cluster.started) >= cluster.timeout {
+		leader = cluster.id
+		for id := range cluster.nodes {
+			if id < leader {
+				leader = id
+			}
+		}
+	}
+	cluster.leader = leader
+	cluster.Unlock()
+
+	if leader == previous {
+		return
+	}
+	switch leader {
+	case "":
+		log.Println("Cluster leader is unknown")
+	case cluster.id:
+		log.Println("This node is now the cluster leader")
+		cluster.Trigger(BusManagerLeader, cluster.id, "", nil, nil)
+	default:
+		log.Printf("Cluster leader is now %s\n", leader)
+	}
+}
+
+type clusterNodesById []*ClusterNode
+
+func (nodes clusterNodesById) Len() int           { return len(nodes) }
+func (nodes clusterNodesById) Swap(i, j int)      { nodes[i], nodes[j] = nodes[j], nodes[i] }
+func (nodes clusterNodesById) Less(i, j int) bool { return nodes[i].Id < nodes[j].Id }
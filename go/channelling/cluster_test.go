@@ -0,0 +1,103 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package channelling
+
+import (
+	"testing"
+	"time"
+)
+
+func NewTestCluster() *cluster {
+	config := &Config{Version: "1.0", ClusterHeartbeatInterval: time.Second, ClusterTimeout: 3 * time.Second}
+	return NewCluster(config, "b", NewBusManager(nil, "", false, ""), nil).(*cluster)
+}
+
+func Test_Cluster_Nodes_ContainsSelfAndHeartbeats(t *testing.T) {
+	cluster := NewTestCluster()
+	cluster.heartbeatReceived(&ClusterNode{Id: "c", Sessions: 2})
+	cluster.heartbeatReceived(&ClusterNode{Id: "a"})
+	cluster.heartbeatReceived(&ClusterNode{Id: "b"})
+
+	nodes := cluster.Nodes()
+	if len(nodes) != 3 || nodes[0].Id != "a" || nodes[1].Id != "b" || nodes[2].Id != "c" {
+		t.Fatalf("Expected nodes a, b and c, but got %+v", nodes)
+	}
+	if !nodes[1].Self || nodes[1].Version != "1.0" {
+		t.Errorf("Expected own node to be marked as self, but got %+v", nodes[1])
+	}
+	if node, ok := cluster.Node("c"); !ok || node.Sessions != 2 {
+		t.Errorf("Expected node c with 2 sessions, but got %+v", node)
+	}
+}
+
+func Test_Cluster_RemovesLeavingAndExpiredNodes(t *testing.T) {
+	cluster := NewTestCluster()
+	cluster.heartbeatReceived(&ClusterNode{Id: "a"})
+	cluster.heartbeatReceived(&ClusterNode{Id: "c"})
+
+	cluster.leaveReceived(&ClusterNode{Id: "a"})
+	if _, ok := cluster.Node("a"); ok {
+		t.Error("Expected node a to be removed after leaving")
+	}
+
+	cluster.expire(time.Now().Add(2 * time.Second))
+	if _, ok := cluster.Node("c"); !ok {
+		t.Error("Expected node c to be kept within the timeout")
+	}
+	cluster.expire(time.Now().Add(4 * time.Second))
+	if _, ok := cluster.Node("c"); ok {
+		t.Error("Expected node c to be removed after the timeout")
+	}
+	if _, ok := cluster.Node("b"); !ok {
+		t.Error("Expected own node to be never removed")
+	}
+}
+
+func Test_Cluster_UpdateLeader_ElectsLowestIdAfterTimeout(t *testing.T) {
+	cluster := NewTestCluster()
+	cluster.started = time.Now().Add(-time.Minute)
+	cluster.heartbeatReceived(&ClusterNode{Id: "c"})
+
+	cluster.updateLeader(cluster.started.Add(time.Second))
+	if leader := cluster.Leader(); leader != "" {
+		t.Errorf("Expected no leader before the timeout, but got %s", leader)
+	}
+
+	now := cluster.started.Add(3 * time.Second)
+	cluster.updateLeader(now)
+	if !cluster.IsLeader() {
+		t.Errorf("Expected own node b to lead, but got %s", cluster.Leader())
+	}
+
+	cluster.heartbeatReceived(&ClusterNode{Id: "a"})
+	if leader := cluster.Leader(); leader != "a" {
+		t.Errorf("Expected node a to lead, but got %s", leader)
+	}
+	if node, _ := cluster.Node("a"); !node.Leader {
+		t.Errorf("Expected node a to be marked as leader, but got %+v", node)
+	}
+
+	cluster.leaveReceived(&ClusterNode{Id: "a"})
+	if !cluster.IsLeader() {
+		t.Errorf("Expected own node b to take over, but got %s", cluster.Leader())
+	}
+}
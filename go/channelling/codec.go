@@ -24,7 +24,7 @@ package channelling
 import (
 	"bytes"
 	"encoding/json"
-	"errors"
+	"fmt"
 	"log"
 
 	"github.com/strukturag/spreed-webrtc/go/buffercache"
@@ -44,26 +44,52 @@ type Codec interface {
 	OutgoingEncoder
 }
 
+// DefaultMessageLimits are the size limits in bytes for incoming messages
+// of some types, which are used unless configured otherwise.
+var DefaultMessageLimits = map[string]int{
+	"Hello":     8192,
+	"Alive":     1024,
+	"Candidate": 8192,
+	"Offer":     131072,
+	"Answer":    131072,
+	"Chat":      65536,
+	"BlobChunk": 32768,
+	"Volatile":  4096,
+	"Bandwidth": 1024,
+}
+
 type incomingCodec struct {
 	buffers       buffercache.BufferCache
 	incomingLimit int
+	typeLimits    map[string]int
 }
 
-func NewCodec(incomingLimit int) Codec {
-	return &incomingCodec{buffercache.NewBufferCache(1024, bytes.MinRead), incomingLimit}
+// NewCodec creates a codec which rejects incoming messages larger than
+// incomingLimit bytes, or larger than the limit in typeLimits for their
+// type.
+func NewCodec(incomingLimit int, typeLimits map[string]int) Codec {
+	return &incomingCodec{buffercache.NewBufferCache(1024, bytes.MinRead), incomingLimit, typeLimits}
 }
 
 func (codec incomingCodec) NewBuffer() buffercache.Buffer {
 	return codec.buffers.New()
 }
 
+// DecodeIncoming decodes b. Messages exceeding the size limit of their type
+// are returned with a *DataError, so the rejection can be sent back.
 func (codec incomingCodec) DecodeIncoming(b buffercache.Buffer) (*DataIncoming, error) {
 	length := b.GetBuffer().Len()
 	if length > codec.incomingLimit {
-		return nil, errors.New("Incoming message size limit exceeded")
+		return nil, NewDataError("message_too_large", fmt.Sprintf("Incoming message size limit of %d bytes exceeded", codec.incomingLimit))
 	}
 	incoming := &DataIncoming{}
-	return incoming, json.Unmarshal(b.Bytes(), incoming)
+	if err := json.Unmarshal(b.Bytes(), incoming); err != nil {
+		return nil, err
+	}
+	if limit, ok := codec.typeLimits[incoming.Type]; ok && length > limit {
+		return incoming, NewDataError("message_too_large", fmt.Sprintf("Size limit of %d bytes for %s messages exceeded", limit, incoming.Type))
+	}
+	return incoming, nil
 }
 
 func (codec incomingCodec) EncodeOutgoing(outgoing *DataOutgoing) (buffercache.Buffer, error) {
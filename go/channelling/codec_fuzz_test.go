@@ -0,0 +1,56 @@
+//go:build go1.18
+// +build go1.18
+
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package channelling
+
+import (
+	"testing"
+)
+
+func FuzzDecodeIncoming(f *testing.F) {
+	for _, seed := range []string{
+		`{"Type":"Hello","Hello":{"Version":"1.0","Ua":"fuzz","Name":"room"}}`,
+		`{"Type":"Chat","Iid":"1","Chat":{"To":"a","Chat":{"Message":"hi","Status":{"SeenMids":["1"]}}}}`,
+		`{"Type":"Sessions","Sessions":{"Sessions":{"Type":"contact","Token":"x"}}}`,
+		`{"Type":"BlobChunk","BlobChunk":{"To":"a","Id":"b","Total":1,"Data":"AA=="}}`,
+		`{"Type":"Alive","Alive":{"Alive":1}}`,
+	} {
+		f.Add([]byte(seed))
+	}
+	codec := NewCodec(1024*1024, DefaultMessageLimits)
+	f.Fuzz(func(t *testing.T, data []byte) {
+		b := codec.NewBuffer()
+		defer b.Decref()
+		b.Write(data)
+		incoming, err := codec.DecodeIncoming(b)
+		if err != nil {
+			return
+		}
+		if err := ValidateIncoming(incoming); err != nil {
+			if _, ok := err.(*ValidationError); !ok {
+				t.Errorf("Expected a *ValidationError, but got %#v", err)
+			}
+		}
+	})
+}
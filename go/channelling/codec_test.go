@@ -0,0 +1,50 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package channelling
+
+import (
+	"testing"
+)
+
+func Test_Codec_DecodeIncoming_EnforcesMessageLimits(t *testing.T) {
+	codec := NewCodec(64, map[string]int{"Chat": 40})
+
+	decode := func(s string) (*DataIncoming, error) {
+		b := codec.NewBuffer()
+		defer b.Decref()
+		b.Write([]byte(s))
+		return codec.DecodeIncoming(b)
+	}
+
+	if incoming, err := decode(`{"Type":"Alive","Iid":"1"}`); err != nil || incoming.Type != "Alive" {
+		t.Fatalf("Unexpected result %+v, %v", incoming, err)
+	}
+
+	incoming, err := decode(`{"Type":"Chat","Iid":"2","Chat":{"To":"foobar"}}`)
+	assertDataError(t, err, "message_too_large")
+	if incoming == nil || incoming.Iid != "2" {
+		t.Errorf("Expected decoded message with Iid to reply to, but got %+v", incoming)
+	}
+
+	_, err = decode(`{"Type":"Alive","Iid":"3","Alive":{"Alive":1389190912092,"Rtt":48}}`)
+	assertDataError(t, err, "message_too_large")
+}
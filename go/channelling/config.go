@@ -3,6 +3,7 @@ package channelling
 import (
 	"net/http"
 	"regexp"
+	"time"
 )
 
 type Config struct {
@@ -14,12 +15,23 @@ type Config struct {
 	Renegotiation                   bool                      // Renegotiation flag
 	StunURIs                        []string                  // STUN server URIs
 	TurnURIs                        []string                  // TURN server URIs
+	StunListen                      string                    `json:"-"` // UDP address of the built-in STUN server
+	TurnUsageLog                    string                    `json:"-"` // Log file of the TURN server to read usage from
 	Tokens                          bool                      // True when we got a tokens file
+	TermsVersion                    string                    // Version of the terms clients have to accept, empty if none
+	TermsText                       string                    // Terms text shown to clients
+	TermsURL                        string                    // URL of the full terms
+	Motd                            string                    `json:"-"` // Message of the day sent to every session
+	AnnouncementsFile               string                    `json:"-"` // File to store scheduled announcements in
+	BlocklistFile                   string                    `json:"-"` // File to store blocklists of users in
+	FavoritesFile                   string                    `json:"-"` // File to store favorites and recent rooms of users in
 	Version                         string                    // Server version number
 	UsersEnabled                    bool                      // Flag if users are enabled
 	UsersAllowRegistration          bool                      // Flag if users can register
 	UsersMode                       string                    // Users mode string
 	DefaultRoomEnabled              bool                      // Flag if default room ("") is enabled
+	RoomSearchEnabled               bool                      // Flag if rooms can be searched
+	PrivacyMode                     bool                      // Flag if all sessions are in privacy mode
 	Plugin                          string                    // Plugin to load
 	AuthorizeRoomCreation           bool                      // Whether a user account is required to create rooms
 	AuthorizeRoomJoin               bool                      // Whether a user account is required to join rooms
@@ -28,8 +40,63 @@ type Config struct {
 	GlobalRoomID                    string                    `json:"-"` // Id of the global room (not exported to Javascript)
 	ContentSecurityPolicy           string                    `json:"-"` // HTML content security policy
 	ContentSecurityPolicyReportOnly string                    `json:"-"` // HTML content security policy in report only mode
+	ContentSecurityPolicyReport     bool                      `json:"-"` // Whether CSP violations are reported to the server
+	FrameAncestors                  string                    `json:"-"` // Origins which may embed the web client
+	StrictTransportSecurity         string                    `json:"-"` // HSTS header value for secure requests
+	ReferrerPolicy                  string                    `json:"-"` // Referrer-Policy header value
 	RoomTypeDefault                 string                    `json:"-"` // New rooms default to this type
 	RoomTypes                       map[*regexp.Regexp]string `json:"-"` // Map of regular expression -> room type
+	RoomExpiry                      time.Duration             `json:"-"` // How long empty rooms keep their state
+	RoomOwners                      map[string]string         `json:"-"` // Map of room name -> provisioned owner userid
+	RoomNamePattern                 *regexp.Regexp            `json:"-"` // Names of new rooms must match this expression
+	RoomNameBlocklist               []string                  `json:"-"` // Words which are not allowed in names of new rooms
+	RoomNamePrefixes                map[string][]string       `json:"-"` // Map of reserved room name prefix -> userids
+	RoomBroadcastBusThreshold       int                       `json:"-"` // Enables room broadcasts through the bus
+	ClusterHeartbeatInterval        time.Duration             `json:"-"` // Interval between cluster heartbeats on the bus
+	ClusterTimeout                  time.Duration             `json:"-"` // Nodes without heartbeat for this long leave the cluster
+	BusBridgeVersions               []int                     `json:"-"` // Bus protocol versions to translate messages from and to
+	RoomTemplates                   map[string]*RoomTemplate  `json:"-"` // Map of template name -> room template
+	SnapshotFile                    string                    `json:"-"` // File to hand over state to a replacement server
+	SnapshotMaxAge                  time.Duration             `json:"-"` // Older snapshots are not restored
+	PipelinesCleanupInterval        time.Duration             `json:"-"` // Base interval between pipeline expiry scans
+	PipelinesCleanupJitter          time.Duration             `json:"-"` // Maximum random delay added to the cleanup interval
+	PipelinesCleanupChunkSize       int                       `json:"-"` // Number of pipelines checked per cleanup lock
+	PipelinesIDScheme               string                    `json:"-"` // Scheme used to build pipeline IDs
+	StepUpActions                   map[string]bool           `json:"-"` // Actions which require a step-up confirmation
+	StepUpWindow                    time.Duration             `json:"-"` // How long a step-up confirmation is valid
+	BlobMaxSize                     int                       `json:"-"` // Maximum size of relayed blobs in bytes
+	BlobQuota                       int                       `json:"-"` // Maximum bytes of incomplete blobs per session
+	BlobTimeout                     time.Duration             `json:"-"` // Time after which incomplete blobs are dropped
+	FollowInterval                  time.Duration             `json:"-"` // Minimum time between follow requests in a room
+	BandwidthMinimum                int                       `json:"-"` // Lowest video bandwidth cap in kbit/s
+	BandwidthMaximum                int                       `json:"-"` // Video bandwidth caps at or above this are lifted, 0 disables caps
+	MediaModeSFUThreshold           int                       `json:"-"` // Participants from which calls of a room switch to the SFU, 0 disables
+	MediaModeMeshThreshold          int                       `json:"-"` // Participants at which calls of a room switch back to mesh
+	MediaModeTimeout                time.Duration             `json:"-"` // Time after which a media mode switch completes without all participants
+	RetentionMaxAges                map[string]time.Duration  `json:"-"` // Maximum age of retained data by store, 0 keeps data without age limit
+	RetentionInterval               time.Duration             `json:"-"` // How often retention is enforced
+	RetentionDryRun                 bool                      `json:"-"` // Only report what retention would remove
+	RecordingConsentTimeout         time.Duration             `json:"-"` // Time participants have to consent to a recording
+	RecordingConsentEject           bool                      `json:"-"` // Whether participants without consent leave the room
+	AuthLimitThreshold              int                       `json:"-"` // Failed authentications before lockout
+	AuthLimitLockout                time.Duration             `json:"-"` // Initial lockout duration
+	AuthLimitMaxLockout             time.Duration             `json:"-"` // Maximum lockout duration
+	SpamFilter                      bool                      `json:"-"` // Whether spam detection for chat is enabled
+	SpamWindow                      time.Duration             `json:"-"` // Time window to count chat messages in
+	SpamMaxMessages                 int                       `json:"-"` // Maximum chat messages per window
+	SpamMaxRepeats                  int                       `json:"-"` // Maximum identical chat messages per window
+	SpamMaxLinks                    int                       `json:"-"` // Maximum links per chat message
+	SpamThrottle                    time.Duration             `json:"-"` // Duration to reject chat messages of spamming sessions
+	SpamMuteStrikes                 int                       `json:"-"` // Spam detections until a session gets muted
+	SpamMute                        time.Duration             `json:"-"` // Duration to shadow-mute spamming sessions
+	ChatFilterWordList              string                    `json:"-"` // File with words for the chat filter
+	ChatFilterAction                string                    `json:"-"` // Action of the chat filter word list
+	MessageRates                    map[string]int            `json:"-"` // Map of message type -> maximum messages per minute and session
+	TrustForwardedFor               bool                      `json:"-"` // Use X-Forwarded-For to find client addresses
+	SessionFingerprint              []string                  `json:"-"` // Client properties session tokens are bound to
+	AffinityNode                    string                    `json:"-"` // Name of this node in affinity tokens
+	AffinityCookie                  string                    `json:"-"` // Name of the affinity cookie set on connect
+	CustomFields                    *CustomFieldSchema        `json:"-"` // Custom fields of sessions and rooms
 }
 
 func (config *Config) WithModule(m string) bool {
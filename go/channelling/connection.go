@@ -42,15 +42,22 @@ const (
 	pongWait = 60 * time.Second
 
 	// Send pings to client with this period. Must be less than readWait.
-	pingPeriod = (pongWait * 9) / 10
+	// Connections which miss a pong are stale until the next pong, and are
+	// closed when there was no pong for pongWait.
+	pingPeriod = pongWait / 3
 
 	// Maximum message size allowed from client.
 	maxMessageSize = 1024 * 1024
 
-	// Size of send queue.
+	// Size of send queue. Clients with more queued messages are slow
+	// consumers, presence updates are dropped for them and they are warned.
+	// Clients reaching the maximum are disconnected.
 	queueSize    = 512
 	maxQueueSize = queueSize * 4
 
+	// Close code sent to disconnected slow consumers.
+	CloseSlowConsumer = 4008
+
 	// Throttle.
 	maxRatePerSecond = 20
 )
@@ -58,6 +65,7 @@ const (
 type Connection interface {
 	Index() uint64
 	Send(buffercache.Buffer)
+	SendPresence(buffercache.Buffer)
 	Close()
 	ReadPump()
 	WritePump()
@@ -68,6 +76,8 @@ type ConnectionHandler interface {
 	OnConnect(Connection)
 	OnDisconnect()
 	OnText(buffercache.Buffer)
+	OnSlowConsumer(queued int)
+	OnStale(stale bool)
 }
 
 type connection struct {
@@ -78,8 +88,14 @@ type connection struct {
 	// Data handling.
 	condition *sync.Cond
 	queue     list.List
+	priority  list.List // Messages written before the queue.
 	mutex     sync.Mutex
 	isClosed  bool
+	isSlow    bool
+	isEvicted bool
+	isStale   bool
+	pinged    time.Time
+	ponged    time.Time
 
 	// Debugging
 	Idx uint64
@@ -113,12 +129,10 @@ func (c *connection) Close() {
 	// Lock again to clean up the queue and send out the signal.
 	c.mutex.Lock()
 	for {
-		head := c.queue.Front()
-		if head == nil {
+		message := c.pop()
+		if message == nil {
 			break
 		}
-		c.queue.Remove(head)
-		message := head.Value.(buffercache.Buffer)
 		message.Decref()
 	}
 	c.condition.Signal()
@@ -130,7 +144,16 @@ func (c *connection) ReadPump() {
 	c.ws.SetReadLimit(maxMessageSize)
 	c.ws.SetReadDeadline(time.Now().Add(pongWait))
 	c.ws.SetPongHandler(func(string) error {
-		c.ws.SetReadDeadline(time.Now().Add(pongWait))
+		now := time.Now()
+		c.ws.SetReadDeadline(now.Add(pongWait))
+		c.mutex.Lock()
+		c.ponged = now
+		recovered := c.isStale
+		c.isStale = false
+		c.mutex.Unlock()
+		if recovered {
+			c.handler.OnStale(false)
+		}
 		return nil
 	})
 	times := list.New()
@@ -177,21 +200,93 @@ func (c *connection) ReadPump() {
 	c.handler.OnDisconnect()
 }
 
+const (
+	sendNormal = iota
+	sendPresence
+	sendPriority
+)
+
 // Write message to outbound queue.
 func (c *connection) Send(message buffercache.Buffer) {
+	c.send(message, sendNormal)
+}
+
+// SendPresence writes a presence update to the outbound queue. Presence
+// updates are dropped first when the client cannot keep up.
+func (c *connection) SendPresence(message buffercache.Buffer) {
+	c.send(message, sendPresence)
+}
+
+// SendPriority writes message ahead of all queued messages which are not
+// priority messages. Priority messages are not dropped for slow consumers.
+func (c *connection) SendPriority(message buffercache.Buffer) {
+	c.send(message, sendPriority)
+}
+
+func (c *connection) send(message buffercache.Buffer, kind int) {
 	c.mutex.Lock()
-	defer c.mutex.Unlock()
 	if c.isClosed {
+		c.mutex.Unlock()
 		return
 	}
 	//fmt.Println("Outbound queue size", c.Idx, len(c.queue))
-	if c.queue.Len() >= maxQueueSize {
-		log.Println("Outbound queue overflow", c.Idx, c.queue.Len())
+	queued := c.queue.Len() + c.priority.Len()
+	if queued >= maxQueueSize {
+		evict := !c.isEvicted
+		c.isEvicted = true
+		c.mutex.Unlock()
+		if evict {
+			log.Println("Outbound queue overflow, disconnecting slow consumer", c.Idx, queued)
+			go c.closeWithCode(CloseSlowConsumer, "slow consumer")
+		}
 		return
 	}
-	message.Incref()
-	c.queue.PushBack(message)
-	c.condition.Signal()
+	warn := false
+	if queued >= queueSize {
+		warn = !c.isSlow
+		c.isSlow = true
+	} else if c.isSlow && queued < queueSize/2 {
+		c.isSlow = false
+	}
+	switch {
+	case kind == sendPresence && c.isSlow:
+		c.mutex.Unlock()
+	case kind == sendPriority:
+		message.Incref()
+		c.priority.PushBack(message)
+		c.condition.Signal()
+		c.mutex.Unlock()
+	default:
+		message.Incref()
+		c.queue.PushBack(message)
+		c.condition.Signal()
+		c.mutex.Unlock()
+	}
+
+	if warn {
+		log.Println("Outbound queue is backing up, slow consumer", c.Idx, queued)
+		c.handler.OnSlowConsumer(queued)
+	}
+}
+
+// pop removes and returns the next message to write, priority messages
+// first. Returns nil if nothing is queued. Must be called with the mutex
+// held.
+func (c *connection) pop() buffercache.Buffer {
+	for _, queue := range []*list.List{&c.priority, &c.queue} {
+		if head := queue.Front(); head != nil {
+			queue.Remove(head)
+			return head.Value.(buffercache.Buffer)
+		}
+	}
+	return nil
+}
+
+// closeWithCode tells the client why it is disconnected and closes the
+// connection.
+func (c *connection) closeWithCode(code int, text string) {
+	c.ws.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, text), time.Now().Add(writeWait))
+	c.Close()
 }
 
 // writePump pumps messages from the queue to the websocket connection.
@@ -206,9 +301,18 @@ func (c *connection) WritePump() {
 			c.mutex.Unlock()
 			return
 		}
+		// The previous ping was not answered.
+		stale := !c.isStale && !c.pinged.IsZero() && c.ponged.Before(c.pinged)
+		if stale {
+			c.isStale = true
+		}
+		c.pinged = time.Now()
 		ping = true
 		c.condition.Signal()
 		c.mutex.Unlock()
+		if stale {
+			c.handler.OnStale(true)
+		}
 		timer.Reset(pingPeriod)
 	})
 
@@ -217,7 +321,7 @@ func (c *connection) WritePump() {
 
 		c.mutex.Lock()
 		// Wait until something todo.
-		for !ping && !c.isClosed && c.queue.Len() == 0 {
+		for !ping && !c.isClosed && c.queue.Len() == 0 && c.priority.Len() == 0 {
 			// Wait on signal (this also unlocks while waiting, and locks again when got the signal).
 			c.condition.Wait()
 		}
@@ -228,12 +332,10 @@ func (c *connection) WritePump() {
 		}
 		// Flush queue if something.
 		for {
-			head := c.queue.Front()
-			if head == nil {
+			message := c.pop()
+			if message == nil {
 				break
 			}
-			c.queue.Remove(head)
-			message := head.Value.(buffercache.Buffer)
 			if ping {
 				// Send ping.
 				ping = false
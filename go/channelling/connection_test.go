@@ -0,0 +1,197 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package channelling
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/strukturag/spreed-webrtc/go/buffercache"
+
+	"github.com/gorilla/websocket"
+)
+
+type connectionTestHandler struct {
+	Client
+}
+
+func (handler *connectionTestHandler) OnSlowConsumer(queued int) {}
+
+func Test_Connection_SendPriority_SkipsQueueAndIsNotDropped(t *testing.T) {
+	c := &connection{handler: &connectionTestHandler{}}
+	c.condition = sync.NewCond(&c.mutex)
+	buffers := buffercache.NewBufferCache(4, 64)
+
+	for i := 0; i < queueSize; i++ {
+		c.Send(buffers.Wrap([]byte("normal")))
+	}
+	c.SendPresence(buffers.Wrap([]byte("presence")))
+	c.SendPriority(buffers.Wrap([]byte("caption")))
+
+	if !c.isSlow {
+		t.Fatal("Expected connection to be a slow consumer")
+	}
+	if message := c.pop(); message == nil || string(message.Bytes()) != "caption" {
+		t.Errorf("Expected priority message first, but got %v", message)
+	}
+	if c.queue.Len() != queueSize {
+		t.Errorf("Expected presence update to be dropped, but %d messages are queued", c.queue.Len())
+	}
+}
+
+type slowConsumerTestHandler struct {
+	sync.Mutex
+	warnings []int
+}
+
+func (handler *slowConsumerTestHandler) NewBuffer() buffercache.Buffer { return nil }
+func (handler *slowConsumerTestHandler) OnConnect(Connection)          {}
+func (handler *slowConsumerTestHandler) OnDisconnect()                 {}
+func (handler *slowConsumerTestHandler) OnText(buffercache.Buffer)     {}
+func (handler *slowConsumerTestHandler) OnStale(stale bool)            {}
+
+func (handler *slowConsumerTestHandler) OnSlowConsumer(queued int) {
+	handler.Lock()
+	handler.warnings = append(handler.warnings, queued)
+	handler.Unlock()
+}
+
+func (handler *slowConsumerTestHandler) Warnings() []int {
+	handler.Lock()
+	defer handler.Unlock()
+	return append([]int(nil), handler.warnings...)
+}
+
+func newSlowConsumerTestConnection(ws *websocket.Conn) (*connection, *slowConsumerTestHandler) {
+	handler := &slowConsumerTestHandler{}
+	return NewConnection(1, ws, handler).(*connection), handler
+}
+
+func Test_Connection_SlowConsumer_DropsPresenceAndWarnsOnce(t *testing.T) {
+	c, handler := newSlowConsumerTestConnection(nil)
+	buffers := buffercache.NewBufferCache(4, 64)
+
+	for i := 0; i < queueSize; i++ {
+		c.SendPresence(buffers.Wrap([]byte("presence")))
+	}
+	if c.isSlow || len(handler.Warnings()) != 0 {
+		t.Fatalf("Expected no slow consumer below the queue size, but got warnings %v", handler.Warnings())
+	}
+
+	c.SendPresence(buffers.Wrap([]byte("presence")))
+	if !c.isSlow || c.queue.Len() != queueSize {
+		t.Errorf("Expected presence update to be dropped, but %d messages are queued", c.queue.Len())
+	}
+	c.Send(buffers.Wrap([]byte("normal")))
+	c.Send(buffers.Wrap([]byte("normal")))
+	if c.queue.Len() != queueSize+2 {
+		t.Errorf("Expected normal messages to be queued, but %d messages are queued", c.queue.Len())
+	}
+	if warnings := handler.Warnings(); len(warnings) != 1 || warnings[0] != queueSize {
+		t.Errorf("Expected one warning at %d queued messages, but got %v", queueSize, warnings)
+	}
+}
+
+func Test_Connection_SlowConsumer_RecoversBelowHalfTheQueueSize(t *testing.T) {
+	c, handler := newSlowConsumerTestConnection(nil)
+	buffers := buffercache.NewBufferCache(4, 64)
+
+	for i := 0; i <= queueSize; i++ {
+		c.Send(buffers.Wrap([]byte("normal")))
+	}
+	for c.queue.Len() > queueSize/2 {
+		c.pop()
+	}
+	c.SendPresence(buffers.Wrap([]byte("presence")))
+	if !c.isSlow || c.queue.Len() != queueSize/2 {
+		t.Errorf("Expected connection to stay slow at half the queue size, but %d messages are queued", c.queue.Len())
+	}
+
+	c.pop()
+	c.SendPresence(buffers.Wrap([]byte("presence")))
+	if c.isSlow || c.queue.Len() != queueSize/2 {
+		t.Errorf("Expected connection to recover below half the queue size, but %d messages are queued", c.queue.Len())
+	}
+
+	for c.queue.Len() <= queueSize {
+		c.Send(buffers.Wrap([]byte("normal")))
+	}
+	if warnings := handler.Warnings(); len(warnings) != 2 {
+		t.Errorf("Expected to be warned again after recovering, but got %v", warnings)
+	}
+}
+
+func Test_Connection_SlowConsumer_IsClosedAtTheMaximumQueueSize(t *testing.T) {
+	connections := make(chan *connection, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ws, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+		if err != nil {
+			t.Errorf("Could not upgrade: %v", err)
+			return
+		}
+		c, _ := newSlowConsumerTestConnection(ws)
+		connections <- c
+	}))
+	defer server.Close()
+
+	ws, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("Could not connect: %v", err)
+	}
+	defer ws.Close()
+	c := <-connections
+	buffers := buffercache.NewBufferCache(4, 64)
+
+	for i := 0; i < maxQueueSize; i++ {
+		c.Send(buffers.Wrap([]byte("normal")))
+	}
+	c.mutex.Lock()
+	evicted := c.isEvicted
+	c.mutex.Unlock()
+	if evicted {
+		t.Fatal("Expected connection not to be evicted below the maximum queue size")
+	}
+	c.Send(buffers.Wrap([]byte("normal")))
+	c.Send(buffers.Wrap([]byte("normal")))
+
+	ws.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, _, err = ws.ReadMessage()
+	if !websocket.IsCloseError(err, CloseSlowConsumer) {
+		t.Fatalf("Expected close code %d, but got %v", CloseSlowConsumer, err)
+	}
+	// The close message is written before the connection is closed.
+	var closed bool
+	var queued int
+	for i := 0; i < 100 && (!closed || queued != 0); i++ {
+		time.Sleep(10 * time.Millisecond)
+		c.mutex.Lock()
+		closed, queued = c.isClosed, c.queue.Len()
+		c.mutex.Unlock()
+	}
+	if !closed || queued != 0 {
+		t.Errorf("Expected connection to be closed with an empty queue, but %d messages are queued", queued)
+	}
+}
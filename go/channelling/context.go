@@ -32,6 +32,7 @@ type Context struct {
 	Ssl        bool
 	Csp        bool
 	Languages  []string
+	Lang       string        `json:"-"`
 	Room       string        `json:"-"`
 	Scheme     string        `json:"-"`
 	Origin     string        `json:",omitempty"`
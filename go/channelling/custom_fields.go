@@ -0,0 +1,210 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package channelling
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	CustomFieldScopeSession = "session"
+	CustomFieldScopeRoom    = "room"
+
+	CustomFieldString = "string"
+	CustomFieldInt    = "int"
+	CustomFieldBool   = "bool"
+
+	maxCustomFieldString = 1024 // Default maximum length of string fields.
+)
+
+// CustomField is a typed field deployments declare for sessions or rooms.
+// Min and Max limit the value of int fields and the length of string
+// fields.
+type CustomField struct {
+	Scope   string
+	Name    string
+	Type    string
+	Min     *int
+	Max     *int
+	Pattern *regexp.Regexp // Strings must match, if set.
+}
+
+// ParseCustomField parses the declaration of a field of the form
+// "<type> [min=<n>] [max=<n>] [pattern=<regexp>]" with a key of the form
+// "<scope>.<name>".
+func ParseCustomField(key, definition string) (*CustomField, error) {
+	parts := strings.SplitN(key, ".", 2)
+	if len(parts) != 2 || parts[1] == "" || (parts[0] != CustomFieldScopeSession && parts[0] != CustomFieldScopeRoom) {
+		return nil, fmt.Errorf("Custom field %s must be named session.<name> or room.<name>", key)
+	}
+	field := &CustomField{Scope: parts[0], Name: parts[1]}
+	options := strings.Fields(definition)
+	if len(options) == 0 {
+		return nil, fmt.Errorf("Custom field %s needs a type", key)
+	}
+	field.Type = options[0]
+	if field.Type != CustomFieldString && field.Type != CustomFieldInt && field.Type != CustomFieldBool {
+		return nil, fmt.Errorf("Unsupported type '%s' of custom field %s", field.Type, key)
+	}
+	for _, option := range options[1:] {
+		pos := strings.Index(option, "=")
+		if pos < 0 || field.Type == CustomFieldBool {
+			return nil, fmt.Errorf("Invalid option '%s' of custom field %s", option, key)
+		}
+		name, value := option[:pos], option[pos+1:]
+		switch name {
+		case "min", "max":
+			limit, err := strconv.Atoi(value)
+			if err != nil {
+				return nil, fmt.Errorf("Invalid %s of custom field %s: %s", name, key, err)
+			}
+			if name == "min" {
+				field.Min = &limit
+			} else {
+				field.Max = &limit
+			}
+		case "pattern":
+			if field.Type != CustomFieldString {
+				return nil, fmt.Errorf("Only string custom fields can have a pattern, not %s", key)
+			}
+			re, err := regexp.Compile(value)
+			if err != nil {
+				return nil, fmt.Errorf("Invalid pattern of custom field %s: %s", key, err)
+			}
+			field.Pattern = re
+		default:
+			return nil, fmt.Errorf("Invalid option '%s' of custom field %s", option, key)
+		}
+	}
+	return field, nil
+}
+
+// validate returns value converted to the type of the field.
+func (field *CustomField) validate(value interface{}) (interface{}, error) {
+	invalid := func(message string) error {
+		return NewDataError("invalid_field", fmt.Sprintf("Field %s %s", field.Name, message))
+	}
+	switch field.Type {
+	case CustomFieldBool:
+		if b, ok := value.(bool); ok {
+			return b, nil
+		}
+		return nil, invalid("must be a boolean")
+	case CustomFieldInt:
+		// Numbers of JSON documents are decoded as float64.
+		f, ok := value.(float64)
+		if !ok || f != float64(int(f)) {
+			return nil, invalid("must be an integer")
+		}
+		i := int(f)
+		if field.Min != nil && i < *field.Min {
+			return nil, invalid(fmt.Sprintf("must be at least %d", *field.Min))
+		}
+		if field.Max != nil && i > *field.Max {
+			return nil, invalid(fmt.Sprintf("must be at most %d", *field.Max))
+		}
+		return i, nil
+	default:
+		s, ok := value.(string)
+		if !ok {
+			return nil, invalid("must be a string")
+		}
+		max := maxCustomFieldString
+		if field.Max != nil {
+			max = *field.Max
+		}
+		if len(s) > max || (field.Min != nil && len(s) < *field.Min) {
+			return nil, invalid("has an invalid length")
+		}
+		if field.Pattern != nil && !field.Pattern.MatchString(s) {
+			return nil, invalid("has an invalid format")
+		}
+		return s, nil
+	}
+}
+
+// CustomFieldSchema holds the custom fields of sessions and rooms.
+type CustomFieldSchema struct {
+	fields map[string]map[string]*CustomField // Map of scope -> name -> field.
+}
+
+// NewCustomFieldSchema creates a schema of fields.
+func NewCustomFieldSchema(fields []*CustomField) *CustomFieldSchema {
+	schema := &CustomFieldSchema{fields: make(map[string]map[string]*CustomField)}
+	for _, field := range fields {
+		if schema.fields[field.Scope] == nil {
+			schema.fields[field.Scope] = make(map[string]*CustomField)
+		}
+		schema.fields[field.Scope][field.Name] = field
+	}
+	return schema
+}
+
+// Validate checks values against the fields of scope and returns them
+// converted to the types of the fields. Nil values are kept, they remove
+// the field when merged.
+func (schema *CustomFieldSchema) Validate(scope string, values map[string]interface{}) (map[string]interface{}, error) {
+	validated := make(map[string]interface{}, len(values))
+	for name, value := range values {
+		var field *CustomField
+		if schema != nil {
+			field = schema.fields[scope][name]
+		}
+		if field == nil {
+			return nil, NewDataError("invalid_field", fmt.Sprintf("Unknown field %.64s", name))
+		}
+		if value == nil {
+			validated[name] = nil
+			continue
+		}
+		v, err := field.validate(value)
+		if err != nil {
+			return nil, err
+		}
+		validated[name] = v
+	}
+	return validated, nil
+}
+
+// MergeCustomFields returns a new map with the values of current updated
+// by update. Nil values in update remove the field. Returns nil if no
+// fields remain.
+func MergeCustomFields(current, update map[string]interface{}) map[string]interface{} {
+	merged := make(map[string]interface{}, len(current)+len(update))
+	for name, value := range current {
+		merged[name] = value
+	}
+	for name, value := range update {
+		if value == nil {
+			delete(merged, name)
+		} else {
+			merged[name] = value
+		}
+	}
+	if len(merged) == 0 {
+		return nil
+	}
+	return merged
+}
@@ -0,0 +1,133 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package channelling
+
+import (
+	"testing"
+)
+
+func Test_ParseCustomField(t *testing.T) {
+	field, err := ParseCustomField("session.seats", "int min=1 max=10")
+	if err != nil || field.Scope != CustomFieldScopeSession || field.Name != "seats" || field.Type != CustomFieldInt || *field.Min != 1 || *field.Max != 10 {
+		t.Errorf("Unexpected field %+v, %v", field, err)
+	}
+	field, err = ParseCustomField("room.ticket", "string pattern=^[A-Z]+-[0-9]+$")
+	if err != nil || field.Pattern == nil {
+		t.Errorf("Unexpected field %+v, %v", field, err)
+	}
+	for key, definition := range map[string]string{
+		"seats":      "int",
+		"user.seats": "int",
+		"session.a":  "",
+		"session.b":  "float",
+		"session.c":  "bool max=1",
+		"session.d":  "int pattern=x",
+		"session.e":  "int max=x",
+		"room.f":     "string length=5",
+		"room.g":     "string pattern=(",
+		"session.":   "string",
+	} {
+		if _, err := ParseCustomField(key, definition); err == nil {
+			t.Errorf("Expected %s = %q to be rejected", key, definition)
+		}
+	}
+}
+
+func Test_CustomFieldSchema_Validate(t *testing.T) {
+	var fields []*CustomField
+	for key, definition := range map[string]string{
+		"session.seats":   "int min=1 max=10",
+		"session.away":    "bool",
+		"session.team":    "string max=8",
+		"room.ticket":     "string pattern=^[A-Z]+-[0-9]+$",
+		"room.department": "string",
+	} {
+		field, err := ParseCustomField(key, definition)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fields = append(fields, field)
+	}
+	schema := NewCustomFieldSchema(fields)
+
+	_, err := schema.Validate(CustomFieldScopeSession, map[string]interface{}{"seats": float64(3), "old": nil})
+	assertDataError(t, err, "invalid_field")
+	validated, err := schema.Validate(CustomFieldScopeSession, map[string]interface{}{"seats": float64(3), "away": true, "team": nil})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if validated["seats"] != 3 || validated["away"] != true || validated["team"] != nil {
+		t.Errorf("Unexpected validated fields %v", validated)
+	}
+
+	for scope, values := range map[string]map[string]interface{}{
+		CustomFieldScopeSession: {"seats": float64(11)},
+		CustomFieldScopeRoom:    {"ticket": "abc"},
+		"":                      {"seats": float64(1)},
+	} {
+		_, err := schema.Validate(scope, values)
+		assertDataError(t, err, "invalid_field")
+	}
+	for _, values := range []map[string]interface{}{
+		{"seats": 1.5},
+		{"seats": "1"},
+		{"away": "yes"},
+		{"team": "too long for it"},
+	} {
+		_, err := schema.Validate(CustomFieldScopeSession, values)
+		assertDataError(t, err, "invalid_field")
+	}
+
+	var missing *CustomFieldSchema
+	_, err = missing.Validate(CustomFieldScopeSession, map[string]interface{}{"seats": float64(1)})
+	assertDataError(t, err, "invalid_field")
+}
+
+func Test_MergeCustomFields(t *testing.T) {
+	current := map[string]interface{}{"a": 1, "b": "x"}
+	merged := MergeCustomFields(current, map[string]interface{}{"a": nil, "c": true})
+	if len(merged) != 2 || merged["b"] != "x" || merged["c"] != true {
+		t.Errorf("Unexpected merged fields %v", merged)
+	}
+	if len(current) != 2 || current["a"] != 1 {
+		t.Errorf("Expected current fields to be unchanged, got %v", current)
+	}
+	if merged := MergeCustomFields(merged, map[string]interface{}{"b": nil, "c": nil}); merged != nil {
+		t.Errorf("Expected no fields, got %v", merged)
+	}
+}
+
+func Test_RoomWorker_Update_MergesFields(t *testing.T) {
+	worker := NewRoomWorker(&roomManager{Config: &Config{}}, testRoomID, testRoomName, testRoomType, nil)
+	go worker.Start()
+
+	worker.Update(&DataRoom{Fields: map[string]interface{}{"ticket": "A-1", "department": "sales"}})
+	room := &DataRoom{Fields: map[string]interface{}{"department": nil}}
+	worker.Update(room)
+	if len(room.Fields) != 1 || room.Fields["ticket"] != "A-1" {
+		t.Errorf("Expected the merged fields, got %v", room.Fields)
+	}
+	room = &DataRoom{}
+	if worker.Update(room); room.Fields["ticket"] != "A-1" {
+		t.Errorf("Expected updates without fields to keep them, got %v", room.Fields)
+	}
+}
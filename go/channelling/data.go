@@ -36,48 +36,291 @@ func (err *DataError) Error() string {
 }
 
 type DataRoomCredentials struct {
-	PIN string
+	PIN  string    `validate:"max=256"`
+	Link string    `json:",omitempty" validate:"max=4096"` // Signed room link.
+	link *RoomLink // Verified room link.
 }
 
 type DataHello struct {
-	Version     string
-	Ua          string
-	Id          string // Compatibility with old clients.
-	Name        string // Room name.
-	Type        string // Room type.
+	Version     string `validate:"max=32"`
+	Ua          string `validate:"max=512"`
+	Id          string `validate:"max=256"`                  // Compatibility with old clients.
+	Name        string `validate:"max=256"`                  // Room name.
+	Type        string `validate:"max=64"`                   // Room type.
+	Template    string `json:",omitempty" validate:"max=64"` // Template for new rooms.
 	Credentials *DataRoomCredentials
+	Terms       string `json:",omitempty" validate:"max=64"` // Version of the accepted terms.
+	Locale      string `json:",omitempty" validate:"max=35"` // Locale for server-generated messages, e.g. de-AT.
+}
+
+type DataRoomLink struct {
+	Type     string
+	Name     string `json:",omitempty" validate:"max=256"` // Room name.
+	RoomType string `json:",omitempty" validate:"max=64"`  // Room type.
+	Role     string `json:",omitempty" validate:"max=32"`
+	Ttl      int    `json:",omitempty"`                     // Requested validity in seconds.
+	Link     string `json:",omitempty" validate:"max=4096"` // Signed room link.
+	Expires  int64  `json:",omitempty"`
+}
+
+type DataStepUp struct {
+	Type      string
+	Challenge string `json:",omitempty" validate:"max=4096"`
+	Method    string `json:",omitempty" validate:"max=32"` // Second factor method, e.g. "totp".
+	Code      string `json:",omitempty" validate:"max=32"` // Second factor code.
+	Confirmed bool   `json:",omitempty"`
+	Expires   int64  `json:",omitempty"` // Unix time when the confirmation expires.
 }
 
 type DataWelcome struct {
-	Type  string
-	Room  *DataRoom
-	Users []*DataSession
+	Type        string
+	Time        int64 // Server time in milliseconds.
+	Mono        int64 // Monotonic server time in milliseconds since the server started.
+	Room        *DataRoom
+	Users       []*DataSession
+	Mute        *DataMute              `json:",omitempty"`
+	Permissions *DataPermissions       `json:",omitempty"`
+	Follow      *DataFollow            `json:",omitempty"`
+	Timer       *DataTimer             `json:",omitempty"`
+	Recording   *DataRecording         `json:",omitempty"`
+	Volatile    []*DataVolatile        `json:",omitempty"`
+	Bandwidth   *DataBandwidthCap      `json:",omitempty"`
+	MediaMode   *DataMediaMode         `json:",omitempty"`
+	Extras      map[string]interface{} `json:",omitempty"` // Deployment specific fields added by extensions.
 }
 
 type DataRoom struct {
-	Type        string // Room type.
-	Name        string // Room name.
+	Type        string           `validate:"max=64"`                    // Room type.
+	Name        string           `validate:"max=256"`                   // Room name.
+	Owner       string           `json:",omitempty" validate:"max=256"` // Userid of the room owner.
+	Capacity    int              `json:",omitempty"`                    // Maximum number of sessions.
+	Features    []string         `json:",omitempty" validate:"max=32"`  // Enabled features, empty for all.
+	Turn        string           `json:",omitempty"`                    // TURN policy.
+	ScreenShare *DataScreenShare `json:",omitempty"`                    // Screen sharing limits.
 	Credentials *DataRoomCredentials
+	Fields      map[string]interface{} `json:",omitempty" validate:"max=32"` // Custom fields, see CustomField.
+}
+
+// DataScreenShare limits the screen sharing in a room. Zero values do not
+// limit.
+type DataScreenShare struct {
+	MaxWidth     int `json:",omitempty"` // Maximum width in pixels.
+	MaxHeight    int `json:",omitempty"` // Maximum height in pixels.
+	MaxFrameRate int `json:",omitempty"` // Maximum frames per second.
+	MaxBitrate   int `json:",omitempty"` // Maximum bitrate in kbit/s.
+}
+
+type DataMute struct {
+	Type  string
+	To    string `validate:"max=256"` // Session to mute, or empty for all sessions in the room.
+	Audio bool   // Audio must be muted.
+	Video bool   // Video must be muted.
+}
+
+type DataBlock struct {
+	Type    string
+	Userid  string   `json:",omitempty" validate:"max=256"` // User to block or unblock, empty to only list blocked users.
+	Block   bool     // Userid must be blocked, else unblocked.
+	Blocked []string // Blocked users, in replies.
+}
+
+// DataFavorites pins or unpins a favorite of the user of the session. The
+// reply lists all favorites and recent rooms and calls of the user.
+type DataFavorites struct {
+	Type      string
+	Favorite  *DataFavorite   `json:",omitempty"` // Favorite to pin or unpin, empty to only list favorites.
+	Pin       bool            `json:",omitempty"` // Favorite must be pinned, else unpinned.
+	Favorites []*DataFavorite `json:",omitempty"` // Pinned favorites, in replies.
+	Recent    []*DataFavorite `json:",omitempty"` // Recent rooms and calls, newest first, in replies.
+}
+
+type DataPermissions struct {
+	Type         string
+	Chat         string `json:",omitempty"` // Who may send chat messages.
+	Screenshare  string `json:",omitempty"` // Who may share their screen.
+	Call         string `json:",omitempty"` // Who may start calls and conferences.
+	Invite       string `json:",omitempty"` // Who may create room links.
+	FileTransfer string `json:",omitempty"` // Who may share files.
+}
+
+type DataFollow struct {
+	Type  string
+	Url   string `json:",omitempty"` // URL all participants shall open.
+	Slide int    `json:",omitempty"` // Slide (page) number all participants shall show, starting at 1.
+}
+
+type DataTimer struct {
+	Type     string
+	Label    string `json:",omitempty"` // Description of the countdown.
+	Duration int    // Countdown in seconds, 0 stops the timer.
+	Started  int64  `json:",omitempty"` // Server time in milliseconds when the countdown started.
+	Ends     int64  `json:",omitempty"` // Server time in milliseconds when the countdown ends.
+	Now      int64  `json:",omitempty"` // Server time in milliseconds when the document was sent.
+}
+
+// DataVolatile is a message of which only the latest value per sender and
+// key matters, e.g. cursor positions or volume levels. The server may drop
+// volatile messages for clients which cannot keep up.
+type DataVolatile struct {
+	Type string
+	Key  string
+	From string      `json:",omitempty"` // Sender, set by the server in Welcome.
+	Data interface{} `json:",omitempty"` // Value, nil removes the key.
+}
+
+// DataMediaMode tells the participants of a room to switch between mesh
+// calls and the SFU. Clients answer a prepare with the same Sequence once
+// the connections of the new mode are set up.
+type DataMediaMode struct {
+	Type     string
+	Mode     string `json:",omitempty" validate:"max=16"` // Mode of the room, server only.
+	Phase    string `json:",omitempty" validate:"max=16"` // Phase of the switch, server only.
+	Sequence uint64 // Number of the switch.
+}
+
+// DataBandwidth is a bandwidth estimation report of a client in kbit/s.
+type DataBandwidth struct {
+	Type    string
+	Send    int `json:",omitempty"` // Estimated available send bandwidth.
+	Receive int `json:",omitempty"` // Estimated available receive bandwidth.
+}
+
+// DataBandwidthCap tells the participants of a room to limit the bandwidth
+// of each video they send in kbit/s.
+type DataBandwidthCap struct {
+	Type  string
+	Video int // Maximum video send bandwidth per peer, 0 for no limit.
+}
+
+// DataDialOut requests a call to a phone number which joins the room. The
+// server answers with the Id and Status of the call.
+type DataDialOut struct {
+	Type   string
+	Id     string `json:",omitempty"` // Id of the call, set by the server.
+	Number string `validate:"max=32"`
+	Status string `json:",omitempty"` // Status of the call, set by the server.
+}
+
+type DataRecording struct {
+	Type   string
+	Active bool // Whether the room is being recorded.
+}
+
+type DataRecordingConsent struct {
+	Type    string
+	Id      string `json:",omitempty"` // Session which answered, set by the server.
+	Consent bool
+}
+
+// DataAnnouncement is a notice sent by the server operator.
+type DataAnnouncement struct {
+	Type    string
+	Code    string `json:",omitempty"` // Message code to localize Message.
+	Message string
+	Level   string `json:",omitempty"` // One of info, warning or error.
+}
+
+type DataEjected struct {
+	Type   string
+	Reason string
+}
+
+// DataMigrate asks a client to reconnect to another server with a fresh
+// session token.
+type DataMigrate struct {
+	Type   string
+	Url    string
+	Token  string
+	Reason string `json:",omitempty"`
+}
+
+// RecordingEvent is triggered on the bus when recording starts or stops and
+// when participants answer the consent request.
+type RecordingEvent struct {
+	Roomid   string
+	Active   bool
+	Consents map[string]bool // Session id -> consent.
+}
+
+// IceRestartEvent is triggered on the bus when the ICE restart of a call
+// is coordinated.
+type IceRestartEvent struct {
+	Offerer string // Session id which sends the offer.
+	Reason  string
+}
+
+type DataEndRoom struct {
+	Type string
+	Lock bool // Lock the room against further joins.
+}
+
+// EndRoomEvent is triggered on the bus when a room was ended.
+type EndRoomEvent struct {
+	Roomid   string
+	From     string // Session which ended the room.
+	Userid   string `json:",omitempty"`
+	Sessions int    // Number of sessions in the room.
+	Locked   bool
+}
+
+type DataRoomOwner struct {
+	Type  string
+	Owner string `validate:"max=256"` // Userid of the new room owner.
 }
 
 type DataOffer struct {
 	Type  string
-	To    string
+	To    string `validate:"required,max=256"`
 	Offer map[string]interface{}
 }
 
 type DataCandidate struct {
 	Type      string
-	To        string
+	To        string `validate:"required,max=256"`
 	Candidate interface{}
 }
 
+// DataDtmf relays DTMF tones to the peer of a call, e.g. a SIP gateway
+// which plays them on the PSTN leg.
+type DataDtmf struct {
+	Type     string
+	To       string `validate:"required,max=256"`
+	Tones    string `validate:"required,max=64"` // Tones to play, see DtmfTones.
+	Duration int    `json:",omitempty"`          // Duration of each tone in milliseconds.
+}
+
 type DataAnswer struct {
 	Type   string
-	To     string
+	To     string `validate:"required,max=256"`
 	Answer map[string]interface{}
 }
 
+// DataIceRestart asks to restart ICE of the call with another session, e.g.
+// after the network of a client changed. The server decides which of the
+// two sessions sends the offer, so both sides never offer at once.
+type DataIceRestart struct {
+	Type   string
+	To     string `validate:"max=256"`
+	Reason string `json:",omitempty"`
+	Offer  bool   // Whether the receiving session sends the offer.
+}
+
+// DataNetworkChange is sent by clients when their network changed, e.g.
+// from Wi-Fi to cellular.
+type DataNetworkChange struct {
+	Type    string
+	Network string   `json:",omitempty"` // Type of the new network, e.g. wifi or cellular.
+	Peers   []string `json:",omitempty"` // Sessions the client has calls with.
+}
+
+// DataNetworkChanged is the reply to a network change with fresh TURN
+// credentials and the ICE restarts of the calls.
+type DataNetworkChanged struct {
+	Type       string
+	Turn       *DataTurn
+	IceRestart []*DataIceRestart `json:",omitempty"`
+}
+
 type DataSelf struct {
 	Type       string
 	Id         string
@@ -89,6 +332,9 @@ type DataSelf struct {
 	ApiVersion float64 // Server channelling API version.
 	Turn       *DataTurn
 	Stun       []string
+	Affinity   string                 `json:",omitempty"` // Token naming the serving node.
+	Private    bool                   `json:",omitempty"` // Session is in privacy mode.
+	Extras     map[string]interface{} `json:",omitempty"` // Deployment specific fields added by extensions.
 }
 
 type DataTurn struct {
@@ -99,16 +345,19 @@ type DataTurn struct {
 }
 
 type DataSession struct {
-	Type    string
-	Id      string
-	Userid  string      `json:",omitempty"`
-	Ua      string      `json:",omitempty"`
-	Token   string      `json:",omitempty"`
-	Version string      `json:",omitempty"`
-	Rev     uint64      `json:",omitempty"`
-	Prio    int         `json:",omitempty"`
-	Status  interface{} `json:",omitempty"`
-	stamp   int64
+	Type         string
+	Id           string
+	Userid       string                 `json:",omitempty"`
+	Ua           string                 `json:",omitempty"`
+	Token        string                 `json:",omitempty"`
+	Version      string                 `json:",omitempty"`
+	Rev          uint64                 `json:",omitempty"`
+	Prio         int                    `json:",omitempty"`
+	Status       interface{}            `json:",omitempty"`
+	Usersessions int                    `json:",omitempty"` // Sessions of the user on all nodes.
+	Liveness     string                 `json:",omitempty"` // Liveness of the connection, see SessionLivenessConnected.
+	Fields       map[string]interface{} `json:",omitempty"` // Custom fields, see CustomField.
+	stamp        int64
 }
 
 type DataUser struct {
@@ -116,36 +365,212 @@ type DataUser struct {
 	Sessions int
 }
 
+// DataCallScreening tells the caller that the call screening rejected or
+// redirected its call before the callee was reached.
+type DataCallScreening struct {
+	Type     string
+	To       string // Callee of the screened call.
+	Action   string
+	Reason   string `json:",omitempty"`
+	Message  string `json:",omitempty"` // Message for the caller.
+	Redirect string `json:",omitempty"` // Session id to call instead.
+}
+
+// DataQueue tells a caller in a queue room its position in the queue, or
+// the agent which takes the call once Position is 0.
+type DataQueue struct {
+	Type     string
+	Position int    `json:",omitempty"` // 1-based position of the caller.
+	Length   int    // Number of waiting callers.
+	Agent    string `json:",omitempty"` // Session id of the agent taking the call.
+}
+
+// DataQueueAgent is sent by agents of a queue room to change their state,
+// see AgentStateAvailable. The server sends it to an agent with the caller
+// to call, the agent is on a call afterwards.
+type DataQueueAgent struct {
+	Type   string
+	State  string `validate:"required,oneof=available wrapup offline"`
+	Caller string `json:",omitempty"` // Session id of the caller, server only.
+}
+
+// DataAgentState is broadcast to a queue room when the state of an agent
+// changes.
+type DataAgentState struct {
+	Type  string
+	Id    string // Session id of the agent.
+	State string
+}
+
+// DataMonitor starts or stops monitoring the call of a session with its
+// peer To by a supervisor.
+type DataMonitor struct {
+	Type    string
+	Session string `validate:"required,max=256"` // Session id of the agent.
+	To      string `validate:"required,max=256"` // Session id of the peer.
+	Active  bool
+}
+
+// DataMonitorEvent is a message of a monitored call, sent to the
+// supervisor.
+type DataMonitorEvent struct {
+	Type  string
+	Pipe  string      // Id of the pipeline of the call.
+	From  string      // Session id which sent the message.
+	To    string      `json:",omitempty"` // Session id of the recipient.
+	Event interface{} // The message.
+}
+
+// DataWhisper is a message of a supervisor to the agent of a monitored
+// call, the peer of the call does not receive it.
+type DataWhisper struct {
+	Type    string
+	To      string `validate:"required,max=256"`
+	Message string `validate:"required,max=1024"`
+}
+
+// DataSurvey asks a participant of a call for feedback after the call
+// ended.
+type DataSurvey struct {
+	Type      string
+	Id        string
+	Questions []*SurveyQuestion
+}
+
+// DataSurveyResponse answers a survey, Answers maps question ids to
+// ratings or text.
+type DataSurveyResponse struct {
+	Type    string
+	Id      string            `validate:"required,max=64"`
+	Answers map[string]string `validate:"required,max=32"`
+}
+
+// Kinds of accessibility events.
+const (
+	AccessibilityCaption     = "caption"
+	AccessibilityDescription = "description"
+)
+
+// DataAccessibility subscribes the session to the accessibility events of
+// the given kinds in its room, replacing previous subscriptions.
+type DataAccessibility struct {
+	Type      string
+	Subscribe []string `validate:"max=8"`
+}
+
+// DataAccessibilityEvent is live accessibility content like the captions
+// of the speech of the sending session or audio descriptions. It is
+// delivered with priority to the sessions which subscribed to its kind.
+type DataAccessibilityEvent struct {
+	Type     string
+	Kind     string `validate:"required,oneof=caption description"`
+	Text     string `validate:"required,max=1024"`
+	Language string `json:",omitempty" validate:"max=35"`
+	Final    bool   `json:",omitempty"` // Interim captions are replaced by later events.
+}
+
 type DataBye struct {
 	Type string
-	To   string
+	To   string `validate:"required,max=256"`
 	Bye  interface{}
 }
 
+type DataPipelineClosed struct {
+	Type   string
+	Id     string
+	Reason string
+}
+
 type DataStatus struct {
 	Type   string
 	Status interface{}
 }
 
+// DataFields updates the custom fields of the session, null values remove
+// fields.
+type DataFields struct {
+	Type   string
+	Fields map[string]interface{} `validate:"required,max=32"`
+}
+
 type DataChat struct {
-	To   string
+	To   string `validate:"max=256"`
 	Type string
 	Chat *DataChatMessage
 }
 
+// DataRoomSearch searches the rooms visible to the session, e.g. to
+// autocomplete room names.
+type DataRoomSearch struct {
+	Type  string
+	Query string `validate:"max=256"`
+	Sort  string `json:",omitempty"` // One of occupancy (default) or recent.
+	Limit int    `json:",omitempty"` // Maximum number of results, at most 50.
+}
+
+// DataRoomSearchResult lists the matching rooms, best matches first.
+type DataRoomSearchResult struct {
+	Type  string
+	Query string
+	Rooms []*RoomSearchResult
+}
+
+// DataDirectory sets the discoverability of the user of the session in
+// the user directory.
+type DataDirectory struct {
+	Type            string
+	Discoverability string `validate:"required,oneof=hidden email public"`
+}
+
+// DataDirectorySearch searches the user directory by name or by the hex
+// encoded SHA-256 hash of a lower case email address.
+type DataDirectorySearch struct {
+	Type      string
+	Query     string `json:",omitempty" validate:"max=256"`
+	EmailHash string `json:",omitempty" validate:"max=64"`
+	Limit     int    `json:",omitempty"` // Maximum number of results, at most 20.
+}
+
+// DataDirectoryUser is a user found in the user directory.
+type DataDirectoryUser struct {
+	Userid   string
+	Name     string `json:",omitempty"` // Display name of the user.
+	Sessions []*DataSession
+}
+
+// DataDirectorySearchResult lists the users found in the user directory.
+type DataDirectorySearchResult struct {
+	Type  string
+	Users []*DataDirectoryUser
+}
+
+// DataChatSearch searches the indexed chat of the room of the session.
+type DataChatSearch struct {
+	Type  string
+	Query string `validate:"required,max=256"`
+	Limit int    `json:",omitempty"` // Maximum number of results, at most 50.
+}
+
+// DataChatSearchResult lists the matching chat messages, newest first.
+type DataChatSearchResult struct {
+	Type    string
+	Query   string
+	Results []*ChatIndexEntry
+}
+
 type DataChatMessage struct {
-	Message string
-	Time    string
+	Message string `validate:"max=32768"`
+	Time    string `validate:"max=64"`
 	NoEcho  bool   `json:",omitempty"`
-	Mid     string `json:",omitempty"`
+	Mid     string `json:",omitempty" validate:"max=64"`
 	Status  *DataChatStatus
 }
 
 type DataChatStatus struct {
-	Typing         string              `json:",omitempty"`
-	State          string              `json:",omitempty"`
-	Mid            string              `json:",omitempty"`
-	SeenMids       []string            `json:",omitempty"`
+	Typing         string              `json:",omitempty" validate:"oneof=start stop"`
+	State          string              `json:",omitempty" validate:"oneof=sent delivered"`
+	Mid            string              `json:",omitempty" validate:"max=64"`
+	SeenMids       []string            `json:",omitempty" validate:"max=1000"`
 	FileInfo       *DataFileInfo       `json:",omitempty"`
 	Geolocation    *DataGeolocation    `json:",omitempty"`
 	ContactRequest *DataContactRequest `json:",omitempty"`
@@ -153,11 +578,11 @@ type DataChatStatus struct {
 }
 
 type DataFileInfo struct {
-	Id     string `json:"id"`
+	Id     string `json:"id" validate:"max=256"`
 	Chunks uint64 `json:"chunks"`
-	Name   string `json:"name"`
+	Name   string `json:"name" validate:"max=1024"`
 	Size   uint64 `json:"size"`
-	Type   string `json:"type"`
+	Type   string `json:"type" validate:"max=256"`
 }
 
 type DataGeolocation struct {
@@ -169,32 +594,63 @@ type DataGeolocation struct {
 }
 
 type DataContactRequest struct {
-	Id      string
+	Id      string `validate:"max=256"`
 	Success bool
-	Userid  string `json:",omitempty"`
-	Token   string `json:",omitempty"`
+	Userid  string `json:",omitempty" validate:"max=256"`
+	Token   string `json:",omitempty" validate:"max=4096"`
 }
 
 type DataAutoCall struct {
-	Id   string
-	Type string
+	Id   string `validate:"max=256"`
+	Type string `validate:"max=64"`
 }
 
 type DataIncoming struct {
-	Type           string
-	Hello          *DataHello          `json:",omitempty"`
-	Offer          *DataOffer          `json:",omitempty"`
-	Candidate      *DataCandidate      `json:",omitempty"`
-	Answer         *DataAnswer         `json:",omitempty"`
-	Bye            *DataBye            `json:",omitempty"`
-	Status         *DataStatus         `json:",omitempty"`
-	Chat           *DataChat           `json:",omitempty"`
-	Conference     *DataConference     `json:",omitempty"`
-	Alive          *DataAlive          `json:",omitempty"`
-	Authentication *DataAuthentication `json:",omitempty"`
-	Sessions       *DataSessions       `json:",omitempty"`
-	Room           *DataRoom           `json:",omitempty"`
-	Iid            string              `json:",omitempty"`
+	Type               string
+	Hello              *DataHello              `json:",omitempty"`
+	Offer              *DataOffer              `json:",omitempty"`
+	Candidate          *DataCandidate          `json:",omitempty"`
+	Answer             *DataAnswer             `json:",omitempty"`
+	IceRestart         *DataIceRestart         `json:",omitempty"`
+	NetworkChange      *DataNetworkChange      `json:",omitempty"`
+	Bye                *DataBye                `json:",omitempty"`
+	Status             *DataStatus             `json:",omitempty"`
+	Chat               *DataChat               `json:",omitempty"`
+	Conference         *DataConference         `json:",omitempty"`
+	Alive              *DataAlive              `json:",omitempty"`
+	Authentication     *DataAuthentication     `json:",omitempty"`
+	Sessions           *DataSessions           `json:",omitempty"`
+	Room               *DataRoom               `json:",omitempty"`
+	RoomLink           *DataRoomLink           `json:",omitempty"`
+	StepUp             *DataStepUp             `json:",omitempty"`
+	RoomOwner          *DataRoomOwner          `json:",omitempty"`
+	EndRoom            *DataEndRoom            `json:",omitempty"`
+	Mute               *DataMute               `json:",omitempty"`
+	Follow             *DataFollow             `json:",omitempty"`
+	Block              *DataBlock              `json:",omitempty"`
+	Favorites          *DataFavorites          `json:",omitempty"`
+	Permissions        *DataPermissions        `json:",omitempty"`
+	Timer              *DataTimer              `json:",omitempty"`
+	BlobChunk          *DataBlobChunk          `json:",omitempty"`
+	Recording          *DataRecording          `json:",omitempty"`
+	RecordingConsent   *DataRecordingConsent   `json:",omitempty"`
+	Volatile           *DataVolatile           `json:",omitempty"`
+	Bandwidth          *DataBandwidth          `json:",omitempty"`
+	MediaMode          *DataMediaMode          `json:",omitempty"`
+	DialOut            *DataDialOut            `json:",omitempty"`
+	Dtmf               *DataDtmf               `json:",omitempty"`
+	QueueAgent         *DataQueueAgent         `json:",omitempty"`
+	Monitor            *DataMonitor            `json:",omitempty"`
+	Whisper            *DataWhisper            `json:",omitempty"`
+	SurveyResponse     *DataSurveyResponse     `json:",omitempty"`
+	Fields             *DataFields             `json:",omitempty"`
+	Accessibility      *DataAccessibility      `json:",omitempty"`
+	AccessibilityEvent *DataAccessibilityEvent `json:",omitempty"`
+	ChatSearch         *DataChatSearch         `json:",omitempty"`
+	RoomSearch         *DataRoomSearch         `json:",omitempty"`
+	Directory          *DataDirectory          `json:",omitempty"`
+	DirectorySearch    *DataDirectorySearch    `json:",omitempty"`
+	Iid                string                  `json:",omitempty"`
 }
 
 type DataOutgoing struct {
@@ -212,19 +668,72 @@ type DataSessions struct {
 }
 
 type DataSessionsRequest struct {
-	Token string
-	Type  string
+	Token string `validate:"required,max=4096"`
+	Type  string `validate:"required,oneof=contact session"`
 }
 
 type DataConference struct {
-	Id         string
+	Id         string `validate:"max=256"`
 	Type       string
 	Conference []string
 }
 
+type DataBlobChunk struct {
+	Type  string
+	To    string `validate:"required,max=256"`
+	Id    string `validate:"required,max=256"` // Transfer id chosen by the sender.
+	Index int    // Index of this chunk, starting at 0.
+	Total int    // Number of chunks of the blob.
+	Mime  string `json:",omitempty" validate:"max=256"`
+	Data  []byte // Base64 encoded in JSON.
+}
+
+type DataBlob struct {
+	Type string
+	To   string
+	Id   string
+	Mime string `json:",omitempty"`
+	Data []byte `json:",omitempty"` // Base64 encoded in JSON.
+	Url  string `json:",omitempty"` // Signed download URL of stored blobs instead of Data.
+}
+
+type DataBlobStatus struct {
+	Type   string
+	Id     string // Transfer id chosen by the sender.
+	To     string // Recipient of the blob.
+	Status string // One of scanning, approved, rejected or failed.
+	Reason string `json:",omitempty"`
+}
+
+type DataWarning struct {
+	Type    string
+	Code    string
+	Message string
+}
+
+type DataSpam struct {
+	Type   string
+	Id     string // Session which sent spam.
+	Userid string `json:",omitempty"`
+	Action string // Penalty of the session.
+	Reason string // Detected kind of spam.
+	Until  int64  // Unix time when the penalty ends.
+}
+
+type DataChatFlag struct {
+	Type    string
+	Id      string // Session which sent the message.
+	Userid  string `json:",omitempty"`
+	Message string `json:",omitempty"` // Flagged room chat message, empty for private messages.
+	Reason  string
+}
+
 type DataAlive struct {
 	Type  string
-	Alive uint64
+	Alive uint64 // Client timestamp, echoed by the server.
+	Rtt   int    `json:",omitempty"` // Round trip time in milliseconds of the previous Alive, sent by clients.
+	Time  int64  `json:",omitempty"` // Server time in milliseconds, set by the server.
+	Mono  int64  `json:",omitempty"` // Monotonic server time in milliseconds since the server started, set by the server.
 }
 
 type DataAuthentication struct {
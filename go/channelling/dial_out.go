@@ -0,0 +1,246 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package channelling
+
+import (
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/strukturag/spreed-webrtc/go/randomstring"
+)
+
+const (
+	// BusManagerDialOut is the subject suffix of dial-out requests to the
+	// telephony provider.
+	BusManagerDialOut = "dialout"
+
+	// DialOutAllowAll in an allowlist permits numbers of all countries.
+	DialOutAllowAll = "*"
+
+	minPhoneNumberDigits = 8
+	maxPhoneNumberDigits = 15 // E.164
+)
+
+var phoneNumberSeparators = strings.NewReplacer(" ", "", "-", "", ".", "", "/", "", "(", "", ")", "")
+
+// NormalizePhoneNumber returns number in E.164 format. Common separators
+// are removed and a leading international call prefix 00 is replaced
+// with +.
+func NormalizePhoneNumber(number string) (string, error) {
+	number = phoneNumberSeparators.Replace(strings.TrimSpace(number))
+	if strings.HasPrefix(number, "00") {
+		number = "+" + number[2:]
+	}
+	if !strings.HasPrefix(number, "+") {
+		return "", NewDataError("dialout_invalid_number", "Phone numbers must include the country code")
+	}
+	digits := number[1:]
+	if len(digits) < minPhoneNumberDigits || len(digits) > maxPhoneNumberDigits || digits[0] == '0' {
+		return "", NewDataError("dialout_invalid_number", "Invalid phone number")
+	}
+	for _, c := range digits {
+		if c < '0' || c > '9' {
+			return "", NewDataError("dialout_invalid_number", "Invalid phone number")
+		}
+	}
+	return number, nil
+}
+
+// DialOutRequest is sent on the bus to the telephony provider, which
+// places the call and connects it to the room.
+type DialOutRequest struct {
+	Id     string
+	Roomid string
+	Tenant string `json:",omitempty"` // Room name prefix of the tenant.
+	Number string // E.164 number to call.
+	From   string // Session id which requested the call.
+	Userid string `json:",omitempty"`
+}
+
+// DialOutReply is the answer of the telephony provider.
+type DialOutReply struct {
+	Status string // Status of the call, e.g. ringing.
+	Error  string `json:",omitempty"` // Reason the provider rejected the call.
+}
+
+// DialOutLimiter is a hook to limit the cost of dial-out calls. AllowDialOut
+// is called before a request is sent to the provider and DialOutPlaced once
+// the provider accepted it.
+type DialOutLimiter interface {
+	AllowDialOut(request *DialOutRequest) error
+	DialOutPlaced(request *DialOutRequest)
+}
+
+// DialOut requests calls to phone numbers from the telephony provider.
+type DialOut interface {
+	Dial(session *Session, number string) (*DataDialOut, error)
+	SetLimiter(DialOutLimiter)
+}
+
+type dialOut struct {
+	sync.RWMutex
+	busManager BusManager
+	allowlists map[string][]string
+	timeout    time.Duration
+	limiter    DialOutLimiter
+}
+
+// NewDialOut creates a DialOut which sends requests to the telephony
+// provider on the bus. Allowlists map room name prefixes of tenants to the
+// number prefixes those tenants may call, the empty prefix holds the
+// allowlist of all other rooms. Numbers are only called if an allowlist
+// of the tenant matches.
+func NewDialOut(busManager BusManager, allowlists map[string][]string, timeout time.Duration) DialOut {
+	return &dialOut{
+		busManager: busManager,
+		allowlists: allowlists,
+		timeout:    timeout,
+	}
+}
+
+func (d *dialOut) SetLimiter(limiter DialOutLimiter) {
+	d.Lock()
+	d.limiter = limiter
+	d.Unlock()
+}
+
+func (d *dialOut) Dial(session *Session, number string) (*DataDialOut, error) {
+	number, err := NormalizePhoneNumber(number)
+	if err != nil {
+		return nil, err
+	}
+	tenant, allowlist := d.tenant(session.Roomid)
+	if !dialOutAllowed(allowlist, number) {
+		return nil, NewDataError("dialout_not_allowed", "Calls to this number are not allowed")
+	}
+
+	request := &DialOutRequest{
+		Id:     randomstring.NewRandomString(16),
+		Roomid: session.Roomid,
+		Tenant: tenant,
+		Number: number,
+		From:   session.Id,
+		Userid: session.Userid(),
+	}
+	d.RLock()
+	limiter := d.limiter
+	d.RUnlock()
+	if limiter != nil {
+		if err := limiter.AllowDialOut(request); err != nil {
+			return nil, err
+		}
+	}
+
+	reply := &DialOutReply{}
+	if err := d.busManager.Request(d.busManager.PrefixSubject(BusManagerDialOut), request, reply, d.timeout); err != nil {
+		log.Println("Dial-out request failed", err)
+		return nil, NewDataError("dialout_unavailable", "Dial-out is currently not available")
+	}
+	if reply.Error != "" {
+		return nil, NewDataError("dialout_rejected", reply.Error)
+	}
+	if reply.Status == "" {
+		return nil, NewDataError("dialout_unavailable", "Dial-out is currently not available")
+	}
+	if limiter != nil {
+		limiter.DialOutPlaced(request)
+	}
+
+	log.Printf("Dial-out %s to %s requested by session %s in room %s\n", request.Id, number, session.Id, session.Roomid)
+	return &DataDialOut{Type: "DialOut", Id: request.Id, Number: number, Status: reply.Status}, nil
+}
+
+// tenant returns the longest room name prefix with an allowlist matching
+// roomID and that allowlist.
+func (d *dialOut) tenant(roomID string) (string, []string) {
+	roomName := roomID
+	if idx := strings.Index(roomName, ":"); idx >= 0 {
+		roomName = roomName[idx+1:]
+	}
+	tenant, allowlist := "", d.allowlists[""]
+	for prefix, prefixes := range d.allowlists {
+		if prefix != "" && strings.HasPrefix(roomName, prefix) && len(prefix) > len(tenant) {
+			tenant, allowlist = prefix, prefixes
+		}
+	}
+	return tenant, allowlist
+}
+
+func dialOutAllowed(allowlist []string, number string) bool {
+	for _, prefix := range allowlist {
+		if prefix == DialOutAllowAll || strings.HasPrefix(number, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+type dialOutQuota struct {
+	sync.Mutex
+	limit  int
+	window time.Duration
+	placed map[string][]time.Time
+}
+
+// NewDialOutQuota creates a DialOutLimiter which allows each tenant at most
+// limit calls within window.
+func NewDialOutQuota(limit int, window time.Duration) DialOutLimiter {
+	return &dialOutQuota{
+		limit:  limit,
+		window: window,
+		placed: make(map[string][]time.Time),
+	}
+}
+
+func (quota *dialOutQuota) AllowDialOut(request *DialOutRequest) error {
+	quota.Lock()
+	defer quota.Unlock()
+	if len(quota.expire(request.Tenant, time.Now())) >= quota.limit {
+		return NewDataError("dialout_quota_exceeded", "Too many calls, please try again later")
+	}
+	return nil
+}
+
+func (quota *dialOutQuota) DialOutPlaced(request *DialOutRequest) {
+	quota.Lock()
+	defer quota.Unlock()
+	now := time.Now()
+	quota.placed[request.Tenant] = append(quota.expire(request.Tenant, now), now)
+}
+
+// expire removes the calls of tenant which are outside of the window and
+// returns the remaining ones. Call with the lock held.
+func (quota *dialOutQuota) expire(tenant string, now time.Time) []time.Time {
+	placed := quota.placed[tenant]
+	cutoff := now.Add(-quota.window)
+	for len(placed) > 0 && !placed[0].After(cutoff) {
+		placed = placed[1:]
+	}
+	if len(placed) == 0 {
+		delete(quota.placed, tenant)
+		return nil
+	}
+	quota.placed[tenant] = placed
+	return placed
+}
@@ -0,0 +1,157 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package channelling
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+)
+
+type telephonyBus struct {
+	BusManager
+	requests []*DialOutRequest
+	reply    *DialOutReply
+	err      error
+}
+
+func (bus *telephonyBus) Request(subject string, v interface{}, vPtr interface{}, timeout time.Duration) error {
+	if bus.err != nil {
+		return bus.err
+	}
+	bus.requests = append(bus.requests, v.(*DialOutRequest))
+	data, _ := json.Marshal(bus.reply)
+	return json.Unmarshal(data, vPtr)
+}
+
+func newTestDialOut(allowlists map[string][]string) (DialOut, *telephonyBus) {
+	bus := &telephonyBus{
+		BusManager: NewBusManager(nil, "", false, ""),
+		reply:      &DialOutReply{Status: "ringing"},
+	}
+	return NewDialOut(bus, allowlists, time.Second), bus
+}
+
+func Test_NormalizePhoneNumber(t *testing.T) {
+	for number, expected := range map[string]string{
+		"+49301234567":      "+49301234567",
+		"+49 (30) 123-4567": "+49301234567",
+		"0049 30 1234567":   "+49301234567",
+		"+1 202.555.0100":   "+12025550100",
+	} {
+		if normalized, err := NormalizePhoneNumber(number); err != nil || normalized != expected {
+			t.Errorf("Expected %s for %q, but got %s (%v)", expected, number, normalized, err)
+		}
+	}
+	for _, number := range []string{"", "030 1234567", "+0301234567", "+4930", "+49301234567890123", "+4930123456x", "+49 30 1234567;1"} {
+		_, err := NormalizePhoneNumber(number)
+		assertDataError(t, err, "dialout_invalid_number")
+	}
+}
+
+func Test_DialOut_RequestsCallFromProvider(t *testing.T) {
+	dialOut, bus := newTestDialOut(map[string][]string{"": []string{"+49"}})
+	session := &Session{Id: "a", Roomid: "Room:call"}
+
+	data, err := dialOut.Dial(session, "0049 30 1234567")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data.Status != "ringing" || data.Number != "+49301234567" || data.Id == "" {
+		t.Errorf("Unexpected dial-out %#v", data)
+	}
+	if len(bus.requests) != 1 {
+		t.Fatalf("Expected one request, but got %d", len(bus.requests))
+	}
+	if request := bus.requests[0]; request.Id != data.Id || request.Roomid != "Room:call" || request.From != "a" || request.Tenant != "" {
+		t.Errorf("Unexpected request %#v", request)
+	}
+}
+
+func Test_DialOut_UsesAllowlistOfTenant(t *testing.T) {
+	dialOut, bus := newTestDialOut(map[string][]string{
+		"":          []string{"+49"},
+		"acme/":     []string{"+1"},
+		"acme/all/": []string{DialOutAllowAll},
+	})
+
+	_, err := dialOut.Dial(&Session{Id: "a", Roomid: "Room:acme/call"}, "+49301234567")
+	assertDataError(t, err, "dialout_not_allowed")
+	if _, err := dialOut.Dial(&Session{Id: "a", Roomid: "Room:acme/call"}, "+12025550100"); err != nil {
+		t.Error(err)
+	}
+	if _, err := dialOut.Dial(&Session{Id: "b", Roomid: "Room:acme/all/call"}, "+81312345678"); err != nil {
+		t.Error(err)
+	}
+	_, err = dialOut.Dial(&Session{Id: "c", Roomid: "Room:other"}, "+12025550100")
+	assertDataError(t, err, "dialout_not_allowed")
+
+	if len(bus.requests) != 2 || bus.requests[0].Tenant != "acme/" || bus.requests[1].Tenant != "acme/all/" {
+		t.Errorf("Expected requests for the tenants, but got %#v", bus.requests)
+	}
+}
+
+func Test_DialOut_ReportsProviderErrors(t *testing.T) {
+	dialOut, bus := newTestDialOut(map[string][]string{"": []string{DialOutAllowAll}})
+	session := &Session{Id: "a", Roomid: "Room:call"}
+
+	bus.reply = &DialOutReply{Error: "no credit"}
+	_, err := dialOut.Dial(session, "+49301234567")
+	assertDataError(t, err, "dialout_rejected")
+
+	bus.reply = &DialOutReply{}
+	_, err = dialOut.Dial(session, "+49301234567")
+	assertDataError(t, err, "dialout_unavailable")
+
+	bus.err = errors.New("nats: timeout")
+	_, err = dialOut.Dial(session, "+49301234567")
+	assertDataError(t, err, "dialout_unavailable")
+}
+
+func Test_DialOutQuota_LimitsCallsPerTenant(t *testing.T) {
+	dialOut, bus := newTestDialOut(map[string][]string{"": []string{DialOutAllowAll}, "acme/": []string{DialOutAllowAll}})
+	quota := NewDialOutQuota(2, time.Hour)
+	dialOut.SetLimiter(quota)
+	session := &Session{Id: "a", Roomid: "Room:call"}
+
+	bus.reply = &DialOutReply{Error: "busy"}
+	if _, err := dialOut.Dial(session, "+49301234567"); err == nil {
+		t.Fatal("Expected the provider to reject the call")
+	}
+	bus.reply = &DialOutReply{Status: "ringing"}
+	for i := 0; i < 2; i++ {
+		if _, err := dialOut.Dial(session, "+49301234567"); err != nil {
+			t.Fatalf("Expected call %d to be placed, but got %v", i, err)
+		}
+	}
+	_, err := dialOut.Dial(session, "+49301234567")
+	assertDataError(t, err, "dialout_quota_exceeded")
+	if _, err := dialOut.Dial(&Session{Id: "b", Roomid: "Room:acme/call"}, "+49301234567"); err != nil {
+		t.Errorf("Expected other tenants not to be limited, but got %v", err)
+	}
+
+	quota.(*dialOutQuota).window = 0
+	if _, err := dialOut.Dial(session, "+49301234567"); err != nil {
+		t.Errorf("Expected calls outside of the window not to count, but got %v", err)
+	}
+}
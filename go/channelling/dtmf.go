@@ -0,0 +1,74 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package channelling
+
+import (
+	"strings"
+)
+
+const (
+	BusManagerDtmf = "dtmf"
+
+	// DtmfTones are the valid DTMF tones, a comma inserts a pause.
+	DtmfTones = "0123456789*#ABCD,"
+
+	// DtmfRateDefault is the number of Dtmf messages a session may send
+	// per minute unless a rate is configured in [messagerates].
+	DtmfRateDefault = 120
+
+	dtmfMinDuration = 40
+	dtmfMaxDuration = 6000
+)
+
+// DtmfEvent is triggered on the bus when DTMF tones are relayed, so call
+// detail records of the pipeline can be annotated. The tones themselves
+// are left out as they often are PINs.
+type DtmfEvent struct {
+	To       string
+	Count    int // Number of tones without pauses.
+	Duration int `json:",omitempty"`
+}
+
+// NormalizeDtmf validates the tones and duration of dtmf and converts the
+// tones to upper case.
+func NormalizeDtmf(dtmf *DataDtmf) error {
+	tones := strings.ToUpper(dtmf.Tones)
+	for _, c := range tones {
+		if !strings.ContainsRune(DtmfTones, c) {
+			return NewDataError("dtmf_invalid", "Only the tones 0-9, *, #, A-D and , are allowed")
+		}
+	}
+	if dtmf.Duration != 0 && (dtmf.Duration < dtmfMinDuration || dtmf.Duration > dtmfMaxDuration) {
+		return NewDataError("dtmf_invalid", "The tone duration must be between 40 and 6000 milliseconds")
+	}
+	dtmf.Tones = tones
+	return nil
+}
+
+// Event returns the bus event of dtmf.
+func (dtmf *DataDtmf) Event() *DtmfEvent {
+	return &DtmfEvent{
+		To:       dtmf.To,
+		Count:    len(dtmf.Tones) - strings.Count(dtmf.Tones, ","),
+		Duration: dtmf.Duration,
+	}
+}
@@ -0,0 +1,50 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package channelling
+
+import (
+	"testing"
+)
+
+func Test_NormalizeDtmf_AcceptsTonesAndPauses(t *testing.T) {
+	dtmf := &DataDtmf{To: "a", Tones: "12,34*#abcd", Duration: 100}
+	if err := NormalizeDtmf(dtmf); err != nil {
+		t.Fatal(err)
+	}
+	if dtmf.Tones != "12,34*#ABCD" {
+		t.Errorf("Expected upper case tones, but got %s", dtmf.Tones)
+	}
+	if event := dtmf.Event(); event.To != "a" || event.Count != 10 || event.Duration != 100 {
+		t.Errorf("Unexpected event %#v", event)
+	}
+}
+
+func Test_NormalizeDtmf_RejectsInvalidTonesAndDurations(t *testing.T) {
+	for _, dtmf := range []*DataDtmf{
+		{To: "a", Tones: "12E"},
+		{To: "a", Tones: "1 2"},
+		{To: "a", Tones: "1", Duration: 39},
+		{To: "a", Tones: "1", Duration: 6001},
+	} {
+		assertDataError(t, NormalizeDtmf(dtmf), "dtmf_invalid")
+	}
+}
@@ -0,0 +1,210 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package channelling
+
+import (
+	"github.com/strukturag/spreed-webrtc/go/plugins"
+)
+
+// Extensions check room joins and incoming messages before they are
+// handled. CheckMessage may modify msg. CheckRoom may return a room role
+// for the session, or an empty string to keep the default. CheckAction
+// checks a policy action of session in its current room. Extras returns
+// additional fields for the Self or Welcome message sent to session, or nil.
+type Extensions interface {
+	CheckMessage(session *Session, msg *DataIncoming) error
+	CheckRoom(roomID, roomName, roomType string, session *Session) (string, error)
+	CheckAction(action string, session *Session) error
+	Extras(message string, session *Session) map[string]interface{}
+}
+
+// Actions passed to policy engines.
+const (
+	PolicyActionJoin   = "join"
+	PolicyActionCall   = "call"
+	PolicyActionRecord = "record"
+)
+
+// PolicyInput is the context passed to policy engines for a decision.
+type PolicyInput struct {
+	Action  string
+	Session *PolicySession
+	Room    *PolicyRoom
+	To      string `json:",omitempty"`
+}
+
+// PolicySession describes the session asking for an action.
+type PolicySession struct {
+	Id            string
+	Userid        string `json:",omitempty"`
+	Authenticated bool
+	RoomRole      string `json:",omitempty"`
+	RemoteIP      string `json:",omitempty"`
+}
+
+// PolicyRoom describes the room an action applies to.
+type PolicyRoom struct {
+	Id   string
+	Name string
+	Type string `json:",omitempty"`
+}
+
+func newPolicyInput(action string, session *Session, roomID, roomName, roomType string) *PolicyInput {
+	return &PolicyInput{
+		Action: action,
+		Session: &PolicySession{
+			Id:            session.Id,
+			Userid:        session.Userid(),
+			Authenticated: session.authenticated(),
+			RoomRole:      session.RoomRole(),
+			RemoteIP:      session.RemoteIP,
+		},
+		Room: &PolicyRoom{
+			Id:   roomID,
+			Name: roomName,
+			Type: roomType,
+		},
+	}
+}
+
+type pluginExtensions struct {
+	host *plugins.Host
+}
+
+// NewPluginExtensions creates Extensions which ask the message hooks, room
+// policies and policy engines of host.
+func NewPluginExtensions(host *plugins.Host) Extensions {
+	return &pluginExtensions{host}
+}
+
+func (extensions *pluginExtensions) authorize(input *PolicyInput) error {
+	if !extensions.host.Has(plugins.CapabilityPolicy) {
+		return nil
+	}
+
+	decision := extensions.host.Authorize(&plugins.PolicyRequest{
+		Action: input.Action,
+		Input:  input,
+	})
+	if decision.Reject {
+		return NewDataError("not_authorized", decision.Reason)
+	}
+	return nil
+}
+
+func (extensions *pluginExtensions) CheckMessage(session *Session, msg *DataIncoming) error {
+	// Offers with a token are file transfers and screen sharing, not calls.
+	if msg.Type == "Offer" && msg.Offer != nil && msg.Offer.Offer != nil {
+		if _, ok := msg.Offer.Offer["_token"]; !ok {
+			roomID := session.Roomid
+			input := newPolicyInput(PolicyActionCall, session, roomID, roomNameFromID(roomID), "")
+			input.To = msg.Offer.To
+			if err := extensions.authorize(input); err != nil {
+				return err
+			}
+		}
+	}
+
+	if !extensions.host.Has(plugins.CapabilityMessages) {
+		return nil
+	}
+
+	request := &plugins.MessageRequest{
+		Type:   msg.Type,
+		From:   session.Id,
+		Userid: session.Userid(),
+		Roomid: session.Roomid,
+	}
+	switch msg.Type {
+	case "Hello", "Authentication", "StepUp", "RoomLink":
+		// Never pass on credentials.
+	default:
+		request.Data = msg
+	}
+	if decision := extensions.host.CheckMessage(request); decision.Reject {
+		return NewDataError("rejected_by_plugin", decision.Reason)
+	}
+	return nil
+}
+
+func (extensions *pluginExtensions) CheckRoom(roomID, roomName, roomType string, session *Session) (string, error) {
+	if err := extensions.authorize(newPolicyInput(PolicyActionJoin, session, roomID, roomName, roomType)); err != nil {
+		return "", err
+	}
+
+	if !extensions.host.Has(plugins.CapabilityRooms) {
+		return "", nil
+	}
+
+	decision := extensions.host.CheckRoom(&plugins.RoomRequest{
+		Roomid:        roomID,
+		Name:          roomName,
+		Type:          roomType,
+		From:          session.Id,
+		Userid:        session.Userid(),
+		Authenticated: session.authenticated(),
+	})
+	if decision.Reject {
+		return "", NewDataError("room_join_rejected", decision.Reason)
+	}
+	return "", nil
+}
+
+func (extensions *pluginExtensions) CheckAction(action string, session *Session) error {
+	roomID := session.Roomid
+	return extensions.authorize(newPolicyInput(action, session, roomID, roomNameFromID(roomID), ""))
+}
+
+func (extensions *pluginExtensions) Extras(message string, session *Session) map[string]interface{} {
+	if !extensions.host.Has(plugins.CapabilityExtras) {
+		return nil
+	}
+
+	return extensions.host.Extras(&plugins.ExtrasRequest{
+		Message:       message,
+		From:          session.Id,
+		Userid:        session.Userid(),
+		Roomid:        session.Roomid,
+		Authenticated: session.authenticated(),
+	})
+}
+
+type extensionsBus struct {
+	BusManager
+	host *plugins.Host
+}
+
+// NewExtensionsBusManager wraps busManager to send all triggered events to
+// the event sinks of host as well.
+func NewExtensionsBusManager(busManager BusManager, host *plugins.Host) BusManager {
+	return &extensionsBus{busManager, host}
+}
+
+func (bus *extensionsBus) Trigger(name, from, payload string, data interface{}, pipeline *Pipeline) error {
+	bus.host.Event(&plugins.Event{
+		Name: name,
+		From: from,
+		To:   payload,
+		Data: data,
+	})
+	return bus.BusManager.Trigger(name, from, payload, data, pipeline)
+}
@@ -0,0 +1,253 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package channelling
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// Kinds of favorites.
+const (
+	FavoriteRoom = "room" // Id is the room name.
+	FavoriteCall = "call" // Id is the userid of the called user.
+)
+
+const (
+	maxFavorites = 100 // Maximum number of favorites a user can pin.
+	maxRecent    = 20  // Number of recent rooms and calls kept per user.
+)
+
+// DataFavorite is a pinned favorite or a recent room or call.
+type DataFavorite struct {
+	Kind string    `validate:"required,oneof=room call"`
+	Id   string    `validate:"required,max=256"`          // Room name or userid.
+	Type string    `json:",omitempty" validate:"max=64"`  // Room type.
+	Name string    `json:",omitempty" validate:"max=256"` // Display name.
+	Time time.Time // When the favorite was pinned or the room or call was recent.
+}
+
+// Favorites stores the pinned favorites and the recent rooms and calls of
+// users, so they follow the user across sessions and devices.
+type Favorites interface {
+	Pin(userid string, favorite *DataFavorite) (*DataFavorites, error)
+	Unpin(userid string, favorite *DataFavorite) *DataFavorites
+	AddRecent(userid string, recent *DataFavorite)
+	Favorites(userid string) *DataFavorites
+	EraseUser(userid string) int
+}
+
+type userFavorites struct {
+	Favorites []*DataFavorite `json:",omitempty"`
+	Recent    []*DataFavorite `json:",omitempty"`
+}
+
+type favorites struct {
+	sync.RWMutex
+	path  string
+	users map[string]*userFavorites // Map of userid -> favorites.
+}
+
+// NewFavorites creates Favorites. If path is not empty, the favorites are
+// loaded from and saved to that file.
+func NewFavorites(path string) (Favorites, error) {
+	store := &favorites{
+		path:  path,
+		users: make(map[string]*userFavorites),
+	}
+	if path != "" {
+		data, err := ioutil.ReadFile(path)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		if err == nil {
+			if err := json.Unmarshal(data, &store.users); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return store, nil
+}
+
+// Pin adds favorite to the favorites of userid, or updates its name if it
+// is pinned already, and returns the updated favorites.
+func (store *favorites) Pin(userid string, favorite *DataFavorite) (*DataFavorites, error) {
+	if userid == "" {
+		return nil, NewDataError("not_authenticated", "Only authenticated users can pin favorites")
+	}
+	if favorite.Id == "" || (favorite.Kind != FavoriteRoom && favorite.Kind != FavoriteCall) {
+		return nil, NewDataError("invalid_favorite", "Invalid favorite")
+	}
+	store.Lock()
+	defer store.Unlock()
+	user, ok := store.users[userid]
+	if !ok {
+		user = &userFavorites{}
+		store.users[userid] = user
+	}
+	pinned := &DataFavorite{
+		Kind: favorite.Kind,
+		Id:   favorite.Id,
+		Type: favorite.Type,
+		Name: favorite.Name,
+		Time: time.Now(),
+	}
+	if i := favoriteIndex(user.Favorites, pinned); i >= 0 {
+		pinned.Time = user.Favorites[i].Time
+		user.Favorites[i] = pinned
+	} else {
+		if len(user.Favorites) >= maxFavorites {
+			return nil, NewDataError("too_many_favorites", "Too many favorites")
+		}
+		user.Favorites = append(user.Favorites, pinned)
+	}
+	store.save()
+	return store.data(userid), nil
+}
+
+// Unpin removes favorite from the favorites of userid and returns the
+// updated favorites.
+func (store *favorites) Unpin(userid string, favorite *DataFavorite) *DataFavorites {
+	store.Lock()
+	defer store.Unlock()
+	if user, ok := store.users[userid]; ok {
+		if i := favoriteIndex(user.Favorites, favorite); i >= 0 {
+			user.Favorites = append(user.Favorites[:i], user.Favorites[i+1:]...)
+			store.prune(userid)
+			store.save()
+		}
+	}
+	return store.data(userid)
+}
+
+// AddRecent moves recent to the front of the recent rooms and calls of
+// userid. The oldest entries are removed once there are more than
+// maxRecent.
+func (store *favorites) AddRecent(userid string, recent *DataFavorite) {
+	if userid == "" || recent.Id == "" {
+		return
+	}
+	store.Lock()
+	defer store.Unlock()
+	user, ok := store.users[userid]
+	if !ok {
+		user = &userFavorites{}
+		store.users[userid] = user
+	}
+	entry := &DataFavorite{
+		Kind: recent.Kind,
+		Id:   recent.Id,
+		Type: recent.Type,
+		Name: recent.Name,
+		Time: time.Now(),
+	}
+	if i := favoriteIndex(user.Recent, entry); i >= 0 {
+		user.Recent = append(user.Recent[:i], user.Recent[i+1:]...)
+	}
+	user.Recent = append([]*DataFavorite{entry}, user.Recent...)
+	if len(user.Recent) > maxRecent {
+		user.Recent = user.Recent[:maxRecent]
+	}
+	store.save()
+}
+
+func (store *favorites) Favorites(userid string) *DataFavorites {
+	store.RLock()
+	defer store.RUnlock()
+	return store.data(userid)
+}
+
+// EraseUser removes the favorites and recent entries of userid and returns
+// their number.
+func (store *favorites) EraseUser(userid string) int {
+	store.Lock()
+	defer store.Unlock()
+	user, ok := store.users[userid]
+	if !ok {
+		return 0
+	}
+	delete(store.users, userid)
+	store.save()
+	return len(user.Favorites) + len(user.Recent)
+}
+
+// data returns copies of the favorites of userid. The lock must be held.
+func (store *favorites) data(userid string) *DataFavorites {
+	data := &DataFavorites{
+		Type:      "Favorites",
+		Favorites: []*DataFavorite{},
+		Recent:    []*DataFavorite{},
+	}
+	if user, ok := store.users[userid]; ok {
+		for _, favorite := range user.Favorites {
+			copied := *favorite
+			data.Favorites = append(data.Favorites, &copied)
+		}
+		for _, recent := range user.Recent {
+			copied := *recent
+			data.Recent = append(data.Recent, &copied)
+		}
+	}
+	return data
+}
+
+// prune removes userid if it has no entries left. The lock must be held.
+func (store *favorites) prune(userid string) {
+	if user, ok := store.users[userid]; ok && len(user.Favorites) == 0 && len(user.Recent) == 0 {
+		delete(store.users, userid)
+	}
+}
+
+// save writes all favorites to the file. The lock must be held.
+func (store *favorites) save() {
+	if store.path == "" {
+		return
+	}
+	data, err := json.Marshal(store.users)
+	if err != nil {
+		log.Println("Failed to encode favorites", err)
+		return
+	}
+	tmp := store.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0600); err != nil {
+		log.Println("Failed to save favorites", err)
+		return
+	}
+	if err := os.Rename(tmp, store.path); err != nil {
+		log.Println("Failed to save favorites", err)
+	}
+}
+
+// favoriteIndex returns the index of the entry in list for the same room or
+// user as favorite, or -1.
+func favoriteIndex(list []*DataFavorite, favorite *DataFavorite) int {
+	for i, entry := range list {
+		if entry.Kind == favorite.Kind && entry.Id == favorite.Id && entry.Type == favorite.Type {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,99 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package channelling
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func Test_Favorites_PinsAndUnpinsFavorites(t *testing.T) {
+	favorites, _ := NewFavorites("")
+	room := &DataFavorite{Kind: FavoriteRoom, Id: "release", Type: "Room", Name: "Release"}
+	if _, err := favorites.Pin("", room); err == nil {
+		t.Error("Expected anonymous users to be rejected")
+	}
+	if _, err := favorites.Pin("alice", &DataFavorite{Kind: "meeting", Id: "release"}); err == nil {
+		t.Error("Expected unknown kinds to be rejected")
+	}
+
+	favorites.Pin("alice", room)
+	data, err := favorites.Pin("alice", &DataFavorite{Kind: FavoriteRoom, Id: "release", Type: "Room", Name: "Releases"})
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if len(data.Favorites) != 1 || data.Favorites[0].Name != "Releases" {
+		t.Errorf("Expected pinning again to update the favorite, but got %+v", data.Favorites)
+	}
+	if data := favorites.Favorites("bob"); len(data.Favorites) != 0 {
+		t.Errorf("Expected favorites to be per user, but got %+v", data.Favorites)
+	}
+
+	if data := favorites.Unpin("alice", room); len(data.Favorites) != 0 {
+		t.Errorf("Expected favorite to be unpinned, but got %+v", data.Favorites)
+	}
+}
+
+func Test_Favorites_KeepsLatestRecent(t *testing.T) {
+	favorites, _ := NewFavorites("")
+	for i := 0; i <= maxRecent; i++ {
+		favorites.AddRecent("alice", &DataFavorite{Kind: FavoriteRoom, Id: fmt.Sprintf("room-%d", i)})
+	}
+	favorites.AddRecent("alice", &DataFavorite{Kind: FavoriteRoom, Id: "room-5"})
+	favorites.AddRecent("alice", &DataFavorite{Kind: FavoriteCall, Id: "bob"})
+
+	recent := favorites.Favorites("alice").Recent
+	if len(recent) != maxRecent {
+		t.Fatalf("Expected %d recent entries, but got %d", maxRecent, len(recent))
+	}
+	if recent[0].Id != "bob" || recent[1].Id != "room-5" || recent[2].Id != fmt.Sprintf("room-%d", maxRecent) {
+		t.Errorf("Expected newest entries first, but got %+v %+v %+v", recent[0], recent[1], recent[2])
+	}
+	if count := favorites.EraseUser("alice"); count != maxRecent {
+		t.Errorf("Expected %d erased entries, but got %d", maxRecent, count)
+	}
+}
+
+func Test_Favorites_StoresFavorites(t *testing.T) {
+	dir, err := ioutil.TempDir("", "favorites")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "favorites.json")
+
+	favorites, _ := NewFavorites(path)
+	favorites.Pin("alice", &DataFavorite{Kind: FavoriteCall, Id: "bob"})
+	favorites.AddRecent("alice", &DataFavorite{Kind: FavoriteRoom, Id: "release"})
+
+	loaded, err := NewFavorites(path)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	data := loaded.Favorites("alice")
+	if len(data.Favorites) != 1 || data.Favorites[0].Id != "bob" || len(data.Recent) != 1 {
+		t.Errorf("Expected stored favorites to be loaded, but got %+v", data)
+	}
+}
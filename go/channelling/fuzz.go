@@ -0,0 +1,50 @@
+//go:build gofuzz
+// +build gofuzz
+
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package channelling
+
+import (
+	"github.com/strukturag/spreed-webrtc/go/buffercache"
+)
+
+var fuzzCodec = NewCodec(1024*1024, DefaultMessageLimits)
+
+// Fuzz is the go-fuzz entry point for the decoder of incoming messages and
+// the schema validation of their payloads. Build with go-fuzz-build.
+func Fuzz(data []byte) int {
+	b := fuzzCodec.NewBuffer()
+	defer b.Decref()
+	b.Write(data)
+	incoming, err := fuzzCodec.DecodeIncoming(b)
+	if err != nil {
+		if incoming != nil {
+			return 0
+		}
+		return -1
+	}
+	if err := ValidateIncoming(incoming); err != nil {
+		return 0
+	}
+	return 1
+}
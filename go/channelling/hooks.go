@@ -0,0 +1,390 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package channelling
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/yuin/gopher-lua"
+)
+
+const hooksTimeout = 250 * time.Millisecond // Maximum run time of a single hook.
+
+// Hooks are Extensions, a ChatFilter and a CallScreener which run the hook
+// functions of a Lua script.
+type Hooks interface {
+	Extensions
+	ChatFilter
+	CallScreener
+	Close()
+}
+
+type luaHooks struct {
+	sync.Mutex
+	state *lua.LState
+}
+
+// LoadHooksScript reads a hooks script from filename, see ParseHooksScript.
+func LoadHooksScript(filename string) (Hooks, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ParseHooksScript(f)
+}
+
+// ParseHooksScript runs the Lua script read from r and returns Hooks which
+// call the hook functions the script defines. Scripts only have the base,
+// string, table and math libraries, without access to files. The state of
+// a script is kept between calls, hooks are called one at a time and must
+// return within 250 milliseconds. Hooks are:
+//
+//	on_join(input)                 input is the PolicyInput of the join,
+//	                               return nil or a table like the response
+//	                               of the join webhook ({allow, role,
+//	                               reason}) to reject or grant a role
+//	on_chat(input, to, message)    return nil or a table like a
+//	                               ChatFilterResult ({message, reject,
+//	                               flag, reason}), to is empty for room chat
+//	on_name(input, name)           return the new display name or nil
+//	on_call(input)                 input is the CallScreeningInput of the
+//	                               call, return nil or a table like a
+//	                               CallScreeningDecision ({action, reason,
+//	                               message, redirect, redirectUser}) to
+//	                               reject or route the call
+//	on_extras(message, input)      return a table of fields to add to the
+//	                               Self or Welcome message, or nil
+//
+// Inputs are passed as tables with the fields of their JSON documents, the
+// input of on_chat, on_name and on_extras has the Session and Room of the
+// sending session. Result tables are read like JSON documents, their keys
+// are case insensitive.
+func ParseHooksScript(r io.Reader) (Hooks, error) {
+	script, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	state := lua.NewState(lua.Options{SkipOpenLibs: true})
+	for _, lib := range []struct {
+		name string
+		open lua.LGFunction
+	}{
+		{lua.BaseLibName, lua.OpenBase},
+		{lua.TabLibName, lua.OpenTable},
+		{lua.StringLibName, lua.OpenString},
+		{lua.MathLibName, lua.OpenMath},
+	} {
+		state.Push(state.NewFunction(lib.open))
+		state.Push(lua.LString(lib.name))
+		state.Call(1, 0)
+	}
+	for _, name := range []string{"dofile", "loadfile", "module", "require"} {
+		state.SetGlobal(name, lua.LNil)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), hooksTimeout)
+	defer cancel()
+	state.SetContext(ctx)
+	err = state.DoString(string(script))
+	state.RemoveContext()
+	if err != nil {
+		state.Close()
+		return nil, err
+	}
+	return &luaHooks{state: state}, nil
+}
+
+// Close releases the Lua state of the script.
+func (hooks *luaHooks) Close() {
+	hooks.Lock()
+	hooks.state.Close()
+	hooks.Unlock()
+}
+
+// call runs the hook function name with args and returns its result. The
+// result is nil if the script does not define the hook.
+func (hooks *luaHooks) call(name string, args ...interface{}) (interface{}, error) {
+	hooks.Lock()
+	defer hooks.Unlock()
+	fn, ok := hooks.state.GetGlobal(name).(*lua.LFunction)
+	if !ok {
+		return nil, nil
+	}
+
+	values := make([]lua.LValue, len(args))
+	for i, arg := range args {
+		// Pass arguments as their JSON documents.
+		data, err := json.Marshal(arg)
+		if err != nil {
+			return nil, err
+		}
+		var value interface{}
+		if err := json.Unmarshal(data, &value); err != nil {
+			return nil, err
+		}
+		values[i] = hooks.luaValue(value)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), hooksTimeout)
+	defer cancel()
+	hooks.state.SetContext(ctx)
+	defer hooks.state.RemoveContext()
+	if err := hooks.state.CallByParam(lua.P{Fn: fn, NRet: 1, Protect: true}, values...); err != nil {
+		return nil, err
+	}
+	result := hooks.state.Get(-1)
+	hooks.state.Pop(1)
+	return goValue(result), nil
+}
+
+// decode calls the hook function name and decodes its result into v like
+// a JSON document. It returns false if the hook returned nil.
+func (hooks *luaHooks) decode(v interface{}, name string, args ...interface{}) (bool, error) {
+	result, err := hooks.call(name, args...)
+	if err != nil || result == nil {
+		return false, err
+	}
+	data, err := json.Marshal(result)
+	if err != nil {
+		return false, err
+	}
+	return true, json.Unmarshal(data, v)
+}
+
+func (hooks *luaHooks) luaValue(value interface{}) lua.LValue {
+	switch value := value.(type) {
+	case bool:
+		return lua.LBool(value)
+	case float64:
+		return lua.LNumber(value)
+	case string:
+		return lua.LString(value)
+	case []interface{}:
+		table := hooks.state.NewTable()
+		for _, v := range value {
+			table.Append(hooks.luaValue(v))
+		}
+		return table
+	case map[string]interface{}:
+		table := hooks.state.NewTable()
+		for k, v := range value {
+			table.RawSetString(k, hooks.luaValue(v))
+		}
+		return table
+	}
+	return lua.LNil
+}
+
+func goValue(value lua.LValue) interface{} {
+	switch value := value.(type) {
+	case lua.LBool:
+		return bool(value)
+	case lua.LNumber:
+		return float64(value)
+	case lua.LString:
+		return string(value)
+	case *lua.LTable:
+		if n := value.Len(); n > 0 {
+			values := make([]interface{}, n)
+			for i := range values {
+				values[i] = goValue(value.RawGetInt(i + 1))
+			}
+			return values
+		}
+		values := make(map[string]interface{})
+		value.ForEach(func(k, v lua.LValue) {
+			if key, ok := k.(lua.LString); ok {
+				values[string(key)] = goValue(v)
+			}
+		})
+		return values
+	}
+	return nil
+}
+
+func newHookInput(action string, session *Session) *PolicyInput {
+	roomID := session.Roomid
+	return newPolicyInput(action, session, roomID, roomNameFromID(roomID), "")
+}
+
+func (hooks *luaHooks) CheckMessage(session *Session, msg *DataIncoming) error {
+	if msg.Type != "Status" || msg.Status == nil {
+		return nil
+	}
+	status, ok := msg.Status.Status.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	name, ok := status["displayName"].(string)
+	if !ok {
+		return nil
+	}
+	result, err := hooks.call("on_name", newHookInput("name", session), name)
+	if err != nil {
+		log.Printf("Hook on_name failed for session %s: %s\n", session.Id, err)
+		return nil
+	}
+	if name, ok := result.(string); ok {
+		status["displayName"] = name
+	}
+	return nil
+}
+
+func (hooks *luaHooks) CheckRoom(roomID, roomName, roomType string, session *Session) (string, error) {
+	response := &JoinWebhookResponse{}
+	ok, err := hooks.decode(response, "on_join", newPolicyInput(PolicyActionJoin, session, roomID, roomName, roomType))
+	if err == nil && ok {
+		switch response.Role {
+		case "", RoomRoleParticipant, RoomRoleModerator:
+		default:
+			err = errors.New("unknown role " + response.Role)
+		}
+	}
+	if err != nil {
+		log.Printf("Hook on_join failed for room %s: %s\n", roomID, err)
+		return "", NewDataError("room_join_rejected", "Room join could not be authorized")
+	}
+	if !ok {
+		return "", nil
+	}
+	if !response.Allow {
+		return "", NewDataError("room_join_rejected", response.Reason)
+	}
+	return response.Role, nil
+}
+
+func (hooks *luaHooks) CheckAction(action string, session *Session) error {
+	return nil
+}
+
+func (hooks *luaHooks) Extras(message string, session *Session) map[string]interface{} {
+	var extras map[string]interface{}
+	if _, err := hooks.decode(&extras, "on_extras", message, newHookInput(strings.ToLower(message), session)); err != nil {
+		log.Printf("Hook on_extras failed for session %s: %s\n", session.Id, err)
+		return nil
+	}
+	return extras
+}
+
+func (hooks *luaHooks) FilterChat(session *Session, to, message string) *ChatFilterResult {
+	result := &ChatFilterResult{}
+	ok, err := hooks.decode(result, "on_chat", newHookInput("chat", session), to, message)
+	if err != nil {
+		log.Printf("Hook on_chat failed for session %s: %s\n", session.Id, err)
+		return &ChatFilterResult{Reject: true, Reason: "hook_failed"}
+	}
+	if !ok {
+		return nil
+	}
+	return result
+}
+
+func (hooks *luaHooks) ScreenCall(input *CallScreeningInput) *CallScreeningDecision {
+	decision := &CallScreeningDecision{}
+	ok, err := hooks.decode(decision, "on_call", input)
+	if err == nil && ok {
+		decision, err = validCallScreeningDecision(decision)
+	}
+	if err != nil {
+		log.Printf("Hook on_call failed for call of %s: %s\n", input.Caller.Id, err)
+		return &CallScreeningDecision{Action: CallScreeningReject, Reason: "screening_failed"}
+	}
+	if !ok {
+		return &CallScreeningDecision{Action: CallScreeningAllow}
+	}
+	return decision
+}
+
+func roomNameFromID(roomID string) string {
+	if idx := strings.IndexByte(roomID, ':'); idx != -1 {
+		return roomID[idx+1:]
+	}
+	return roomID
+}
+
+type extensionsChain []Extensions
+
+// ChainExtensions returns Extensions which run all of extensions in order
+// and stop at the first error. The first room role returned is used.
+func ChainExtensions(extensions ...Extensions) Extensions {
+	return extensionsChain(extensions)
+}
+
+func (chain extensionsChain) CheckMessage(session *Session, msg *DataIncoming) error {
+	for _, extensions := range chain {
+		if err := extensions.CheckMessage(session, msg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (chain extensionsChain) CheckRoom(roomID, roomName, roomType string, session *Session) (string, error) {
+	var role string
+	for _, extensions := range chain {
+		r, err := extensions.CheckRoom(roomID, roomName, roomType, session)
+		if err != nil {
+			return "", err
+		}
+		if role == "" {
+			role = r
+		}
+	}
+	return role, nil
+}
+
+func (chain extensionsChain) CheckAction(action string, session *Session) error {
+	for _, extensions := range chain {
+		if err := extensions.CheckAction(action, session); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Extras merges the fields of all extensions, fields of earlier extensions
+// take precedence.
+func (chain extensionsChain) Extras(message string, session *Session) map[string]interface{} {
+	var extras map[string]interface{}
+	for _, extensions := range chain {
+		for key, value := range extensions.Extras(message, session) {
+			if extras == nil {
+				extras = make(map[string]interface{})
+			}
+			if _, ok := extras[key]; !ok {
+				extras[key] = value
+			}
+		}
+	}
+	return extras
+}
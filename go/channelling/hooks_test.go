@@ -0,0 +1,217 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package channelling
+
+import (
+	"strings"
+	"testing"
+)
+
+const testHooksScript = `
+-- Test hooks.
+joins = 0
+
+function on_join(input)
+  joins = joins + 1
+  if input.Room.Name:match("^private%-") then
+    return {allow = false, reason = "Private room"}
+  elseif input.Room.Name == "staff" and not input.Session.Authenticated then
+    return {allow = false, reason = "Staff only"}
+  elseif input.Room.Name == "staff" then
+    return {allow = true, role = "moderator"}
+  end
+end
+
+function on_chat(input, to, message)
+  if message:lower():find("spam") then
+    return {reject = true, reason = "spam"}
+  end
+  local masked = message:gsub("darn", "****")
+  if masked ~= message then
+    return {message = masked, flag = true}
+  end
+end
+
+function on_name(input, name)
+  return (name:gsub("^admin", "user"))
+end
+
+function on_call(input)
+  if input.Room.Name == "lobby" then
+    return {action = "reject", message = "No calls in the lobby"}
+  elseif input.Callee.Presence == "gone" then
+    return {action = "redirect", redirectUser = "voicemail"}
+  end
+end
+
+function on_extras(message, input)
+  if message == "Self" then
+    return {features = {whiteboard = true}, joins = joins}
+  elseif input.Room.Name:match("^lobby") then
+    return {banner = "Maintenance tonight"}
+  end
+end
+`
+
+func newTestHooks(t *testing.T, script string) Hooks {
+	hooks, err := ParseHooksScript(strings.NewReader(script))
+	if err != nil {
+		t.Fatalf("Could not parse hooks script: %v", err)
+	}
+	return hooks
+}
+
+func Test_ParseHooksScript_Errors(t *testing.T) {
+	for _, script := range []string{
+		"function on_join(",
+		"error('failed')",
+		"while true do end",
+	} {
+		if _, err := ParseHooksScript(strings.NewReader(script)); err == nil {
+			t.Errorf("Expected error for script %q", script)
+		}
+	}
+}
+
+func Test_Hooks_HaveNoFileAccess(t *testing.T) {
+	for _, script := range []string{
+		"io.open('/etc/passwd')",
+		"os.exit(1)",
+		"dofile('/etc/passwd')",
+		"require('os')",
+	} {
+		if _, err := ParseHooksScript(strings.NewReader(script)); err == nil {
+			t.Errorf("Expected error for script %q", script)
+		}
+	}
+}
+
+func Test_Hooks_CheckRoom(t *testing.T) {
+	hooks := newTestHooks(t, testHooksScript)
+	defer hooks.Close()
+	session := &Session{}
+
+	_, err := hooks.CheckRoom("Room:private-1", "private-1", "", session)
+	assertDataError(t, err, "room_join_rejected")
+	_, err = hooks.CheckRoom("Room:staff", "staff", "", session)
+	assertDataError(t, err, "room_join_rejected")
+	if role, err := hooks.CheckRoom("Room:public", "public", "", session); err != nil || role != "" {
+		t.Errorf("Unexpected role %q and error %v joining public room", role, err)
+	}
+
+	session.userid = "user"
+	if role, err := hooks.CheckRoom("Room:staff", "staff", "", session); err != nil || role != RoomRoleModerator {
+		t.Errorf("Unexpected role %q and error %v joining with account", role, err)
+	}
+	if extras := hooks.Extras("Self", session); extras["joins"] != float64(4) {
+		t.Errorf("Expected script state to be kept, but got %+v", extras)
+	}
+}
+
+func Test_Hooks_FilterChat(t *testing.T) {
+	hooks := newTestHooks(t, testHooksScript)
+	defer hooks.Close()
+	session := &Session{Roomid: "Room:lobby"}
+
+	if result := hooks.FilterChat(session, "", "Buy SPAM now"); result == nil || !result.Reject || result.Reason != "spam" {
+		t.Errorf("Expected message to be rejected, but got %+v", result)
+	}
+	if result := hooks.FilterChat(session, "", "Oh darn it"); result == nil || result.Message != "Oh **** it" || !result.Flag {
+		t.Errorf("Expected masked message, but got %+v", result)
+	}
+	if result := hooks.FilterChat(session, "", "Hello"); result != nil {
+		t.Errorf("Expected message to pass, but got %+v", result)
+	}
+}
+
+func Test_Hooks_CheckMessage_RewritesDisplayNames(t *testing.T) {
+	hooks := newTestHooks(t, testHooksScript)
+	defer hooks.Close()
+
+	status := &DataIncoming{Type: "Status", Status: &DataStatus{Status: map[string]interface{}{"displayName": "admin42"}}}
+	if err := hooks.CheckMessage(&Session{}, status); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if name := status.Status.Status.(map[string]interface{})["displayName"]; name != "user42" {
+		t.Errorf("Expected rewritten display name, but got %v", name)
+	}
+}
+
+func Test_Hooks_ScreenCall(t *testing.T) {
+	hooks := newTestHooks(t, testHooksScript)
+	defer hooks.Close()
+	caller := &Session{Id: "a", Roomid: "Room:lobby"}
+
+	if decision := hooks.ScreenCall(NewCallScreeningInput(caller, nil, "b")); decision.Action != CallScreeningReject || decision.Message != "No calls in the lobby" {
+		t.Errorf("Expected call to be rejected, but got %+v", decision)
+	}
+	caller.Roomid = "Room:helpdesk"
+	if decision := hooks.ScreenCall(NewCallScreeningInput(caller, nil, "b")); decision.Action != CallScreeningRedirect || decision.RedirectUser != "voicemail" {
+		t.Errorf("Expected call to be routed, but got %+v", decision)
+	}
+	if decision := hooks.ScreenCall(NewCallScreeningInput(caller, &Session{Id: "b"}, "b")); decision.Action != CallScreeningAllow {
+		t.Errorf("Expected call to be allowed, but got %+v", decision)
+	}
+}
+
+func Test_Hooks_FailClosedOnErrors(t *testing.T) {
+	hooks := newTestHooks(t, `
+function on_join(input) error("broken") end
+function on_call(input) while true do end end
+function on_chat(input, to, message) return {action = "redirect"} end
+`)
+	defer hooks.Close()
+	session := &Session{Id: "a", Roomid: "Room:lobby"}
+
+	_, err := hooks.CheckRoom("Room:lobby", "lobby", "", session)
+	assertDataError(t, err, "room_join_rejected")
+	if decision := hooks.ScreenCall(NewCallScreeningInput(session, nil, "b")); decision.Action != CallScreeningReject || decision.Reason != "screening_failed" {
+		t.Errorf("Expected timed out hook to reject the call, but got %+v", decision)
+	}
+	if result := hooks.FilterChat(session, "", "Hello"); result == nil || result.Reject {
+		t.Errorf("Expected unknown result fields to be ignored, but got %+v", result)
+	}
+	if extras := hooks.Extras("Self", session); extras != nil {
+		t.Errorf("Expected no extras, but got %+v", extras)
+	}
+}
+
+func Test_Hooks_Extras(t *testing.T) {
+	hooks := newTestHooks(t, testHooksScript)
+	defer hooks.Close()
+
+	extras := hooks.Extras("Self", &Session{})
+	if features, ok := extras["features"].(map[string]interface{}); !ok || features["whiteboard"] != true {
+		t.Errorf("Expected features, but got %+v", extras)
+	}
+	if extras := hooks.Extras("Welcome", &Session{Roomid: "Room:lobby-1"}); len(extras) != 1 || extras["banner"] != "Maintenance tonight" {
+		t.Errorf("Expected banner, but got %+v", extras)
+	}
+	if extras := hooks.Extras("Welcome", &Session{Roomid: "Room:other"}); extras != nil {
+		t.Errorf("Expected no extras, but got %+v", extras)
+	}
+
+	chain := ChainExtensions(hooks, ChainExtensions())
+	if extras := chain.Extras("Self", &Session{}); len(extras) != 2 {
+		t.Errorf("Expected chained extras, but got %+v", extras)
+	}
+}
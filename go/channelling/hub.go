@@ -30,6 +30,7 @@ import (
 	"errors"
 	"fmt"
 	"github.com/gorilla/securecookie"
+	"github.com/strukturag/spreed-webrtc/go/buffercache"
 	"log"
 	"sync"
 	"time"
@@ -44,6 +45,10 @@ type Hub interface {
 	Unicaster
 	TurnDataCreator
 	ContactManager
+	Announcer
+	SetBlocklist(Blocklist)
+	SetTurnSecret([]byte)
+	SetMessageCatalogs(*MessageCatalogs)
 }
 
 type hub struct {
@@ -51,6 +56,9 @@ type hub struct {
 	clients    map[string]*Client
 	config     *Config
 	turnSecret []byte
+	turnUsage  TurnUsage
+	blocklist  Blocklist
+	catalogs   *MessageCatalogs
 	mutex      sync.RWMutex
 	contacts   *securecookie.SecureCookie
 }
@@ -91,27 +99,98 @@ func (h *hub) ClientInfo(details bool) (clientCount int, sessions map[string]*Da
 	return
 }
 
+// LatencyInfo returns the aggregated round trip times of all sessions which
+// reported any and are not in privacy mode.
+func (h *hub) LatencyInfo() map[string]*SessionLatency {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+
+	latencies := make(map[string]*SessionLatency)
+	for id, client := range h.clients {
+		if client.Session().Private() {
+			continue
+		}
+		if latency := client.Session().Latency(); latency != nil {
+			latencies[id] = latency
+		}
+	}
+
+	return latencies
+}
+
+// NetworkInfo returns the network changes of all sessions which reported
+// any and are not in privacy mode.
+func (h *hub) NetworkInfo() map[string]*SessionNetwork {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+
+	networks := make(map[string]*SessionNetwork)
+	for id, client := range h.clients {
+		if client.Session().Private() {
+			continue
+		}
+		if network := client.Session().Network(); network != nil {
+			networks[id] = network
+		}
+	}
+
+	return networks
+}
+
 func (h *hub) CreateTurnData(session *Session) *DataTurn {
 	// Create turn data credentials for shared secret auth with TURN
 	// server. See http://tools.ietf.org/html/draft-uberti-behave-turn-rest-00
 	// and https://code.google.com/p/rfc5766-turn-server/ REST API auth
 	// and set shared secret in TURN server with static-auth-secret.
-	if len(h.turnSecret) == 0 {
+	h.mutex.RLock()
+	turnSecret := h.turnSecret
+	h.mutex.RUnlock()
+	if len(turnSecret) == 0 {
 		return &DataTurn{}
 	}
 	id := session.Id
 	bar := sha256.New()
 	bar.Write([]byte(id))
 	id = base64.StdEncoding.EncodeToString(bar.Sum(nil))
-	foo := hmac.New(sha1.New, h.turnSecret)
+	foo := hmac.New(sha1.New, turnSecret)
 	expiration := int32(time.Now().Unix()) + turnTTL
 	user := fmt.Sprintf("%d:%s", expiration, id)
 	foo.Write([]byte(user))
 	password := base64.StdEncoding.EncodeToString(foo.Sum(nil))
+	if h.turnUsage != nil && !session.Private() {
+		h.turnUsage.Track(session, user)
+	}
 
 	return &DataTurn{user, password, turnTTL, h.config.TurnURIs}
 }
 
+// SetTurnUsage makes the hub track which sessions received TURN
+// credentials, to correlate the usage reported by the TURN server.
+func (h *hub) SetTurnUsage(usage TurnUsage) {
+	h.turnUsage = usage
+}
+
+// SetTurnSecret replaces the shared secret for TURN credentials, e.g. when
+// it was rotated. Credentials created before stay valid as long as the TURN
+// server accepts the previous secret.
+func (h *hub) SetTurnSecret(turnSecret []byte) {
+	h.mutex.Lock()
+	h.turnSecret = turnSecret
+	h.mutex.Unlock()
+}
+
+// SetBlocklist makes the hub drop unicasts from users which were blocked
+// by the receiving user.
+func (h *hub) SetBlocklist(blocklist Blocklist) {
+	h.blocklist = blocklist
+}
+
+// SetMessageCatalogs makes the hub translate server-generated messages into
+// the locale of the receiving sessions.
+func (h *hub) SetMessageCatalogs(catalogs *MessageCatalogs) {
+	h.catalogs = catalogs
+}
+
 func (h *hub) GetSession(id string) (session *Session, ok bool) {
 	var client *Client
 	client, ok = h.GetClient(id)
@@ -157,6 +236,9 @@ func (h *hub) GetClient(sessionID string) (client *Client, ok bool) {
 
 func (h *hub) Unicast(to string, outgoing *DataOutgoing, pipeline *Pipeline) {
 	client, ok := h.GetClient(to)
+	if ok && h.blocked(client.Session(), outgoing.From) {
+		return
+	}
 	if pipeline != nil {
 		if complete := pipeline.FlushOutgoing(h, client, to, outgoing); complete {
 			return
@@ -166,12 +248,71 @@ func (h *hub) Unicast(to string, outgoing *DataOutgoing, pipeline *Pipeline) {
 		log.Println("Unicast To not found", to)
 		return
 	}
+	if h.catalogs != nil {
+		outgoing = h.catalogs.localizeOutgoing(client.Session().Locale(), outgoing)
+	}
 	if message, err := h.EncodeOutgoing(outgoing); err == nil {
 		client.Send(message)
 		message.Decref()
 	}
 }
 
+// blocked returns true if the user of session has blocked the user of the
+// local session from.
+func (h *hub) blocked(session *Session, from string) bool {
+	if h.blocklist == nil || from == "" || from == session.Id {
+		return false
+	}
+	sender, ok := h.GetSession(from)
+	return ok && h.blocklist.IsBlocked(session.Userid(), sender.Userid())
+}
+
+// Announce sends announcement to all sessions connected to this server
+// which are in the room roomID and belong to userid. Empty values match any
+// room or user. Returns the number of sessions it was sent to.
+func (h *hub) Announce(roomID, userid string, announcement *DataAnnouncement) int {
+	var clients []*Client
+	h.mutex.RLock()
+	for _, client := range h.clients {
+		session := client.Session()
+		if roomID != "" && session.Roomid != roomID {
+			continue
+		}
+		if userid != "" && session.Userid() != userid {
+			continue
+		}
+		clients = append(clients, client)
+	}
+	h.mutex.RUnlock()
+
+	// Encode once per locale of the receiving sessions.
+	messages := make(map[string]buffercache.Buffer)
+	defer func() {
+		for _, message := range messages {
+			message.Decref()
+		}
+	}()
+	count := 0
+	for _, client := range clients {
+		var locale string
+		if h.catalogs != nil {
+			locale = client.Session().Locale()
+		}
+		message, ok := messages[locale]
+		if !ok {
+			data, _ := h.catalogs.Localize(locale, announcement)
+			var err error
+			if message, err = h.EncodeOutgoing(&DataOutgoing{Data: data}); err != nil {
+				continue
+			}
+			messages[locale] = message
+		}
+		client.Send(message)
+		count++
+	}
+	return count
+}
+
 func (h *hub) GetContactID(session *Session, token string) (userid string, err error) {
 	contact := &Contact{}
 	err = h.contacts.Decode("contact", token, contact)
@@ -0,0 +1,124 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package channelling
+
+import (
+	"testing"
+
+	"github.com/strukturag/spreed-webrtc/go/buffercache"
+)
+
+type testConnection struct {
+	sent int
+}
+
+func (conn *testConnection) Index() uint64                   { return 0 }
+func (conn *testConnection) Send(buffercache.Buffer)         { conn.sent++ }
+func (conn *testConnection) SendPresence(buffercache.Buffer) {}
+func (conn *testConnection) Close()                          {}
+func (conn *testConnection) ReadPump()                       {}
+func (conn *testConnection) WritePump()                      {}
+
+func Test_Hub_Announce_FiltersByRoomAndUser(t *testing.T) {
+	h := NewHub(&Config{}, []byte("secret"), []byte("encryptionsecret"), nil, NewCodec(1024, nil))
+	sessions := []*Session{
+		{Id: "a", Roomid: "Room:lobby", userid: "alice"},
+		{Id: "b", Roomid: "Room:lobby"},
+		{Id: "c", Roomid: "Room:other", userid: "alice"},
+	}
+	connections := make([]*testConnection, len(sessions))
+	for i, session := range sessions {
+		client := NewClient(nil, nil, session)
+		connections[i] = &testConnection{}
+		client.Connection = connections[i]
+		h.OnConnect(client, session)
+	}
+
+	announcement := &DataAnnouncement{Type: "Announcement", Message: "Restarting soon"}
+	if count := h.Announce("", "", announcement); count != 3 {
+		t.Errorf("Expected announcement to all sessions, but got %d", count)
+	}
+	if count := h.Announce("Room:lobby", "", announcement); count != 2 {
+		t.Errorf("Expected announcement to the room, but got %d", count)
+	}
+	if count := h.Announce("", "alice", announcement); count != 2 {
+		t.Errorf("Expected announcement to the user, but got %d", count)
+	}
+	if count := h.Announce("Room:lobby", "alice", announcement); count != 1 {
+		t.Errorf("Expected announcement to the user in the room, but got %d", count)
+	}
+	if connections[0].sent != 4 || connections[1].sent != 2 || connections[2].sent != 2 {
+		t.Errorf("Unexpected sends %d, %d, %d", connections[0].sent, connections[1].sent, connections[2].sent)
+	}
+}
+
+func Test_Hub_Unicast_DropsBlockedUsers(t *testing.T) {
+	h := NewHub(&Config{}, []byte("secret"), []byte("encryptionsecret"), nil, NewCodec(1024, nil))
+	blocklist, _ := NewBlocklist("")
+	h.SetBlocklist(blocklist)
+	sessions := []*Session{
+		{Id: "a", userid: "alice"},
+		{Id: "b", userid: "bob"},
+	}
+	connections := make([]*testConnection, len(sessions))
+	for i, session := range sessions {
+		client := NewClient(nil, nil, session)
+		connections[i] = &testConnection{}
+		client.Connection = connections[i]
+		h.OnConnect(client, session)
+	}
+
+	blocklist.Block("alice", "bob")
+	h.Unicast("a", &DataOutgoing{From: "b", To: "a", Data: &DataChat{Type: "Chat"}}, nil)
+	h.Unicast("b", &DataOutgoing{From: "a", To: "b", Data: &DataChat{Type: "Chat"}}, nil)
+	if connections[0].sent != 0 || connections[1].sent != 1 {
+		t.Errorf("Expected only the unblocked unicast, but got %d, %d", connections[0].sent, connections[1].sent)
+	}
+
+	blocklist.Unblock("alice", "bob")
+	h.Unicast("a", &DataOutgoing{From: "b", To: "a", Data: &DataChat{Type: "Chat"}}, nil)
+	if connections[0].sent != 1 {
+		t.Errorf("Expected unicast after unblocking, but got %d", connections[0].sent)
+	}
+}
+
+func Test_Hub_Statistics_SkipPrivateSessions(t *testing.T) {
+	h := NewHub(&Config{}, []byte("secret"), []byte("encryptionsecret"), nil, NewCodec(1024, nil))
+	sessions := []*Session{
+		{Id: "a"},
+		{Id: "b", private: true},
+	}
+	for _, session := range sessions {
+		client := NewClient(nil, nil, session)
+		client.Connection = &testConnection{}
+		h.OnConnect(client, session)
+		session.UpdateLatency(20)
+		session.UpdateNetwork("wifi")
+	}
+
+	if latencies := h.LatencyInfo(); len(latencies) != 1 || latencies["a"] == nil {
+		t.Errorf("Expected only latency of session a, but got %v", latencies)
+	}
+	if networks := h.NetworkInfo(); len(networks) != 1 || networks["a"] == nil {
+		t.Errorf("Expected only network of session a, but got %v", networks)
+	}
+}
@@ -26,21 +26,49 @@ import (
 	"crypto/rand"
 	"encoding/base64"
 	"encoding/binary"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
 	"log"
 	"strings"
 	"sync"
 	"time"
+
+	"github.com/strukturag/spreed-webrtc/go/objectstore"
+
+	// Decode GIF images for resizing.
+	_ "image/gif"
 )
 
+// BuddyImageSizes are the standard sizes in pixels buddy images are resized
+// to on upload. Clients request sizes with the s<size> flag of image urls,
+// e.g. s46, and get the smallest standard size which is at least as large.
+var BuddyImageSizes = []int{46, 92, 184}
+
+// Images with more pixels are not resized but always served as uploaded.
+const maxResizePixels = 4096 * 4096
+
 var imageFilenames map[string]string
 
+// ImageVariant is the original or a resized version of an image.
+type ImageVariant struct {
+	// Size is the standard size of the variant, 0 for the original.
+	Size     int
+	MimeType string
+	// ETag is the quoted entity tag of the variant.
+	ETag string
+	key  string
+}
+
+// Image describes the buddy image of a session. Images are not modified
+// once created, updates replace them.
 type Image struct {
-	updateIdx    int
 	lastChange   time.Time
 	lastChangeId string
 	sessionid    string
 	mimetype     string
-	data         []byte
+	variants     []*ImageVariant
 }
 
 func (img *Image) LastChangeID() string {
@@ -55,24 +83,41 @@ func (img *Image) MimeType() string {
 	return img.mimetype
 }
 
-func (img *Image) Reader() *bytes.Reader {
-	return bytes.NewReader(img.data)
+// Variant returns the smallest variant which is at least size pixels large,
+// or the original if there is none or size is 0.
+func (img *Image) Variant(size int) *ImageVariant {
+	if size > 0 {
+		for _, variant := range img.variants[1:] {
+			if variant.Size >= size {
+				return variant
+			}
+		}
+	}
+	return img.variants[0]
 }
 
 type ImageCache interface {
 	Update(sessionId string, image string) string
 	Get(imageId string) *Image
+	Read(variant *ImageVariant) ([]byte, error)
 	Delete(sessionId string)
 }
 
 type imageCache struct {
 	images        map[string]*Image
 	sessionImages map[string]string
+	store         objectstore.Store
 	mutex         sync.RWMutex
 }
 
-func NewImageCache() ImageCache {
-	result := &imageCache{}
+// NewImageCache creates the buddy images subsystem, which keeps the data
+// of the images and their resized variants in store. Images are kept in
+// memory if store is nil.
+func NewImageCache(store objectstore.Store) ImageCache {
+	if store == nil {
+		store = objectstore.NewMemory()
+	}
+	result := &imageCache{store: store}
 	result.images = make(map[string]*Image)
 	result.sessionImages = make(map[string]string)
 	if imageFilenames == nil {
@@ -111,49 +156,118 @@ func (self *imageCache) Update(sessionId string, image string) string {
 	} else {
 		decoded = []byte(image[pos+1:])
 	}
-	var img *Image
+
 	self.mutex.RLock()
 	result, ok := self.sessionImages[sessionId]
+	img := self.images[result]
+	self.mutex.RUnlock()
 	if !ok {
-		self.mutex.RUnlock()
 		imageId := make([]byte, 15, 15)
 		if _, err = rand.Read(imageId); err != nil {
 			return ""
 		}
 		result = base64.URLEncoding.EncodeToString(imageId)
-		img = &Image{sessionid: sessionId}
-		self.mutex.Lock()
-		resultTmp, ok := self.sessionImages[sessionId]
-		if !ok {
-			self.sessionImages[sessionId] = result
-			self.images[result] = img
-		} else {
-			result = resultTmp
-			img = self.images[result]
+	} else if mimetype == img.mimetype {
+		if data, err := self.store.Get(img.variants[0].key); err == nil && bytes.Equal(data, decoded) {
+			return self.url(result, img)
 		}
+	}
+
+	updated := &Image{
+		sessionid: sessionId,
+		mimetype:  mimetype,
+	}
+	updated.lastChange = time.Now()
+	tmp := make([]byte, binary.MaxVarintLen64)
+	count := binary.PutUvarint(tmp, uint64(updated.lastChange.UnixNano()))
+	updated.lastChangeId = base64.URLEncoding.EncodeToString(tmp[:count])
+	if err := self.storeVariants(result, updated, decoded); err != nil {
+		log.Println("Failed to store buddy image", err)
+		return ""
+	}
+
+	self.mutex.Lock()
+	if resultTmp, ok := self.sessionImages[sessionId]; ok && resultTmp != result {
+		// Another update created an image for the session meanwhile.
 		self.mutex.Unlock()
-	} else {
-		img = self.images[result]
-		self.mutex.RUnlock()
-	}
-	if mimetype != img.mimetype || !bytes.Equal(img.data, decoded) {
-		img.updateIdx++
-		img.lastChange = time.Now()
-		tmp := make([]byte, binary.MaxVarintLen64)
-		count := binary.PutUvarint(tmp, uint64(img.lastChange.UnixNano()))
-		img.lastChangeId = base64.URLEncoding.EncodeToString(tmp[:count])
-		img.mimetype = mimetype
-		img.data = decoded
-	}
-	result += "/" + img.lastChangeId
-	filename, ok := imageFilenames[mimetype]
+		self.deleteVariants(updated)
+		return ""
+	}
+	self.sessionImages[sessionId] = result
+	self.images[result] = updated
+	self.mutex.Unlock()
+	if img != nil {
+		self.deleteVariants(img)
+	}
+
+	return self.url(result, updated)
+}
+
+func (self *imageCache) url(imageId string, img *Image) string {
+	result := imageId + "/" + img.lastChangeId
+	filename, ok := imageFilenames[img.mimetype]
 	if ok {
 		result += "/" + filename
 	}
-
 	return result
 }
 
+// storeVariants stores data as original of img, followed by the standard
+// sizes smaller than the image. Images which cannot be decoded have no
+// resized variants.
+func (self *imageCache) storeVariants(imageId string, img *Image, data []byte) error {
+	prefix := imageId + "/" + img.lastChangeId + "/"
+	original := &ImageVariant{
+		MimeType: img.mimetype,
+		ETag:     fmt.Sprintf(`"%s"`, img.lastChangeId),
+		key:      prefix + "orig",
+	}
+	if err := self.store.Put(original.key, original.MimeType, data); err != nil {
+		return err
+	}
+	img.variants = []*ImageVariant{original}
+
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil || config.Width*config.Height > maxResizePixels {
+		return nil
+	}
+	var decoded image.Image
+	for _, size := range BuddyImageSizes {
+		if config.Width <= size && config.Height <= size {
+			break
+		}
+		if decoded == nil {
+			if decoded, _, err = image.Decode(bytes.NewReader(data)); err != nil {
+				return nil
+			}
+		}
+		mimetype, resized, err := encodeImage(resizeImage(decoded, size), format)
+		if err != nil {
+			return nil
+		}
+		variant := &ImageVariant{
+			Size:     size,
+			MimeType: mimetype,
+			ETag:     fmt.Sprintf(`"%s-s%d"`, img.lastChangeId, size),
+			key:      fmt.Sprintf("%ss%d", prefix, size),
+		}
+		if err := self.store.Put(variant.key, variant.MimeType, resized); err != nil {
+			self.deleteVariants(img)
+			return err
+		}
+		img.variants = append(img.variants, variant)
+	}
+	return nil
+}
+
+func (self *imageCache) deleteVariants(img *Image) {
+	for _, variant := range img.variants {
+		if err := self.store.Delete(variant.key); err != nil {
+			log.Println("Failed to delete buddy image", variant.key, err)
+		}
+	}
+}
+
 func (self *imageCache) Get(imageId string) *Image {
 	self.mutex.RLock()
 	image := self.images[imageId]
@@ -162,12 +276,85 @@ func (self *imageCache) Get(imageId string) *Image {
 	return image
 }
 
+func (self *imageCache) Read(variant *ImageVariant) ([]byte, error) {
+	return self.store.Get(variant.key)
+}
+
 func (self *imageCache) Delete(sessionId string) {
 	self.mutex.Lock()
 	imageId, ok := self.sessionImages[sessionId]
+	img := self.images[imageId]
 	if ok {
 		delete(self.sessionImages, sessionId)
 		delete(self.images, imageId)
 	}
 	self.mutex.Unlock()
+	if img != nil {
+		// Stores may be remote, do not block the session.
+		go self.deleteVariants(img)
+	}
+}
+
+// resizeImage scales src down to fit into size x size pixels, keeping its
+// aspect ratio. Every pixel is the average of the source pixels it covers.
+func resizeImage(src image.Image, size int) image.Image {
+	bounds := src.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	dstWidth, dstHeight := size, size
+	if width > height {
+		dstHeight = height * size / width
+	} else {
+		dstWidth = width * size / height
+	}
+	if dstWidth < 1 {
+		dstWidth = 1
+	}
+	if dstHeight < 1 {
+		dstHeight = 1
+	}
+
+	dst := image.NewNRGBA(image.Rect(0, 0, dstWidth, dstHeight))
+	for y := 0; y < dstHeight; y++ {
+		y0 := bounds.Min.Y + y*height/dstHeight
+		y1 := bounds.Min.Y + (y+1)*height/dstHeight
+		for x := 0; x < dstWidth; x++ {
+			x0 := bounds.Min.X + x*width/dstWidth
+			x1 := bounds.Min.X + (x+1)*width/dstWidth
+			var r, g, b, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					pr, pg, pb, pa := src.At(sx, sy).RGBA()
+					r, g, b, a = r+uint64(pr), g+uint64(pg), b+uint64(pb), a+uint64(pa)
+					n++
+				}
+			}
+			offset := dst.PixOffset(x, y)
+			if a > 0 {
+				// Un-premultiply the averaged color.
+				dst.Pix[offset] = uint8(r * 0xff / a)
+				dst.Pix[offset+1] = uint8(g * 0xff / a)
+				dst.Pix[offset+2] = uint8(b * 0xff / a)
+			}
+			dst.Pix[offset+3] = uint8(a / n >> 8)
+		}
+	}
+	return dst
+}
+
+// encodeImage encodes img in its original format. Animations of GIF images
+// are not kept, resized GIF images are encoded as PNG.
+func encodeImage(img image.Image, format string) (string, []byte, error) {
+	var buf bytes.Buffer
+	switch format {
+	case "jpeg":
+		if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 90}); err != nil {
+			return "", nil, err
+		}
+		return "image/jpeg", buf.Bytes(), nil
+	default:
+		if err := png.Encode(&buf, img); err != nil {
+			return "", nil, err
+		}
+		return "image/png", buf.Bytes(), nil
+	}
 }
@@ -0,0 +1,134 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package channelling
+
+import (
+	"bytes"
+	"encoding/base64"
+	"image"
+	"image/color"
+	"image/png"
+	"strings"
+	"testing"
+
+	"github.com/strukturag/spreed-webrtc/go/objectstore"
+)
+
+type countingStore struct {
+	objectstore.Store
+	count int
+}
+
+func (store *countingStore) Put(key, contentType string, data []byte) error {
+	store.count++
+	return store.Store.Put(key, contentType, data)
+}
+
+func (store *countingStore) Delete(key string) error {
+	store.count--
+	return store.Store.Delete(key)
+}
+
+func testImageDataURL(t *testing.T, width, height int) string {
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, color.NRGBA{255, 0, 0, 255})
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatalf("Failed to encode image: %v", err)
+	}
+	return "image/png;base64," + base64.StdEncoding.EncodeToString(buf.Bytes())
+}
+
+func Test_ImageCache_ResizesToStandardSizes(t *testing.T) {
+	cache := NewImageCache(nil)
+	url := cache.Update("session", testImageDataURL(t, 120, 60))
+	if !strings.HasSuffix(url, "/picture.png") {
+		t.Fatalf("Unexpected image url %s", url)
+	}
+	img := cache.Get(strings.Split(url, "/")[0])
+	if img == nil {
+		t.Fatal("Image not found")
+	}
+
+	for _, check := range []struct {
+		size, variantSize, width, height int
+	}{
+		{0, 0, 120, 60},
+		{46, 46, 46, 23},
+		{50, 92, 92, 46},
+		{184, 0, 120, 60},
+	} {
+		variant := img.Variant(check.size)
+		if variant.Size != check.variantSize {
+			t.Errorf("Expected size %d for %d, got %d", check.variantSize, check.size, variant.Size)
+			continue
+		}
+		data, err := cache.Read(variant)
+		if err != nil {
+			t.Fatalf("Failed to read variant: %v", err)
+		}
+		decoded, err := png.Decode(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("Failed to decode variant: %v", err)
+		}
+		if bounds := decoded.Bounds(); bounds.Dx() != check.width || bounds.Dy() != check.height {
+			t.Errorf("Expected %dx%d for size %d, got %v", check.width, check.height, check.size, bounds)
+		}
+		if r, g, b, a := decoded.At(0, 0).RGBA(); r != 0xffff || g != 0 || b != 0 || a != 0xffff {
+			t.Errorf("Unexpected resized color %v", decoded.At(0, 0))
+		}
+	}
+	if img.Variant(46).ETag == img.Variant(92).ETag {
+		t.Error("Variants have the same ETag")
+	}
+}
+
+func Test_ImageCache_UpdateReplacesImage(t *testing.T) {
+	store := &countingStore{objectstore.NewMemory(), 0}
+	cache := NewImageCache(store)
+	picture := testImageDataURL(t, 100, 100)
+	url := cache.Update("session", picture)
+	if again := cache.Update("session", picture); again != url {
+		t.Errorf("Unchanged image got new url %s, expected %s", again, url)
+	}
+	if count := store.count; count != 3 {
+		t.Errorf("Expected 3 stored variants, got %d", count)
+	}
+
+	updated := cache.Update("session", testImageDataURL(t, 40, 40))
+	if updated == url || strings.Split(updated, "/")[0] != strings.Split(url, "/")[0] {
+		t.Errorf("Expected new url for the same image id, got %s after %s", updated, url)
+	}
+	if count := store.count; count != 1 {
+		t.Errorf("Expected 1 stored variant of small image, got %d", count)
+	}
+
+	cache.Update("session", "image/webp;base64,"+base64.StdEncoding.EncodeToString([]byte("not decodable")))
+	img := cache.Get(strings.Split(updated, "/")[0])
+	if img.Variant(46).Size != 0 || img.MimeType() != "image/webp" {
+		t.Errorf("Images which cannot be decoded must be served as uploaded")
+	}
+}
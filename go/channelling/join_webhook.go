@@ -0,0 +1,139 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package channelling
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"time"
+)
+
+const maxWebhookResponseSize = 64 * 1024
+
+// JoinWebhookResponse is the reply of the join webhook endpoint.
+type JoinWebhookResponse struct {
+	Allow  bool   `json:"allow"`
+	Role   string `json:"role,omitempty"`
+	Reason string `json:"reason,omitempty"`
+}
+
+type joinWebhook struct {
+	url      string
+	secret   []byte
+	failOpen bool
+	client   *http.Client
+}
+
+// NewJoinWebhook creates Extensions which POST the PolicyInput of every
+// room join to url and use the JoinWebhookResponse to grant or deny the
+// join. If secret is set, the request body is signed with HMAC-SHA256 in
+// the X-Spreed-Signature header. If failOpen is true, joins are allowed
+// when the endpoint cannot be reached.
+func NewJoinWebhook(url string, secret []byte, timeout time.Duration, failOpen bool) Extensions {
+	return &joinWebhook{
+		url:      url,
+		secret:   secret,
+		failOpen: failOpen,
+		client:   &http.Client{Timeout: timeout},
+	}
+}
+
+func (webhook *joinWebhook) CheckMessage(session *Session, msg *DataIncoming) error {
+	return nil
+}
+
+func (webhook *joinWebhook) CheckAction(action string, session *Session) error {
+	return nil
+}
+
+func (webhook *joinWebhook) Extras(message string, session *Session) map[string]interface{} {
+	return nil
+}
+
+func (webhook *joinWebhook) CheckRoom(roomID, roomName, roomType string, session *Session) (string, error) {
+	response, err := webhook.call(newPolicyInput(PolicyActionJoin, session, roomID, roomName, roomType))
+	if err != nil {
+		log.Printf("Join webhook failed for room %s: %s\n", roomID, err)
+		if webhook.failOpen {
+			return "", nil
+		}
+		return "", NewDataError("room_join_rejected", "Room join could not be authorized")
+	}
+
+	if !response.Allow {
+		return "", NewDataError("room_join_rejected", response.Reason)
+	}
+	return response.Role, nil
+}
+
+func (webhook *joinWebhook) call(input *PolicyInput) (*JoinWebhookResponse, error) {
+	response := &JoinWebhookResponse{}
+	if err := postWebhook(webhook.client, webhook.url, webhook.secret, input, response); err != nil {
+		return nil, err
+	}
+	switch response.Role {
+	case "", RoomRoleParticipant, RoomRoleModerator:
+	default:
+		return nil, fmt.Errorf("unknown role %s", response.Role)
+	}
+	return response, nil
+}
+
+// postWebhook POSTs v as JSON to url and decodes the reply into response.
+// If secret is set, the request body is signed with HMAC-SHA256 in the
+// X-Spreed-Signature header.
+func postWebhook(client *http.Client, url string, secret []byte, v interface{}, response interface{}) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	request, err := http.NewRequest("POST", url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	if len(secret) > 0 {
+		mac := hmac.New(sha256.New, secret)
+		mac.Write(body)
+		request.Header.Set("X-Spreed-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	resp, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		io.Copy(ioutil.Discard, io.LimitReader(resp.Body, maxWebhookResponseSize))
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	return json.NewDecoder(io.LimitReader(resp.Body, maxWebhookResponseSize)).Decode(response)
+}
@@ -0,0 +1,79 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package channelling
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func Test_JoinWebhook(t *testing.T) {
+	secret := []byte("webhook-secret")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		mac := hmac.New(sha256.New, secret)
+		mac.Write(body)
+		if r.Header.Get("X-Spreed-Signature") != "sha256="+hex.EncodeToString(mac.Sum(nil)) {
+			http.Error(w, "bad signature", http.StatusForbidden)
+			return
+		}
+		input := &PolicyInput{}
+		json.Unmarshal(body, input)
+		switch input.Room.Name {
+		case "vip":
+			json.NewEncoder(w).Encode(&JoinWebhookResponse{Allow: input.Session.Userid == "boss", Role: RoomRoleModerator, Reason: "members only"})
+		case "broken":
+			http.Error(w, "oops", http.StatusInternalServerError)
+		default:
+			json.NewEncoder(w).Encode(&JoinWebhookResponse{Allow: true})
+		}
+	}))
+	defer server.Close()
+
+	webhook := NewJoinWebhook(server.URL, secret, time.Second, false)
+	session := &Session{Id: "session"}
+
+	if role, err := webhook.CheckRoom("Room:lobby", "lobby", "", session); err != nil || role != "" {
+		t.Errorf("Expected join without role, but got %q (%v)", role, err)
+	}
+	_, err := webhook.CheckRoom("Room:vip", "vip", "", session)
+	assertDataError(t, err, "room_join_rejected")
+	_, err = webhook.CheckRoom("Room:broken", "broken", "", session)
+	assertDataError(t, err, "room_join_rejected")
+
+	session.userid = "boss"
+	if role, err := webhook.CheckRoom("Room:vip", "vip", "", session); err != nil || role != RoomRoleModerator {
+		t.Errorf("Expected moderator role, but got %q (%v)", role, err)
+	}
+
+	failOpen := NewJoinWebhook(server.URL, secret, time.Second, true)
+	if _, err := failOpen.CheckRoom("Room:broken", "broken", "", session); err != nil {
+		t.Errorf("Unexpected error %v with fail open", err)
+	}
+}
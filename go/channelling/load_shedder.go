@@ -0,0 +1,166 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package channelling
+
+import (
+	"log"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// Load levels, each sheds the load of the levels before as well.
+const (
+	LoadNormal = iota
+	LoadShedAnonymous
+	LoadShedRooms
+	LoadShedCalls
+)
+
+// LoadLevelNames are the names of the load levels in metrics and the admin
+// API.
+var LoadLevelNames = []string{"normal", "shed_anonymous", "shed_rooms", "shed_calls"}
+
+// LoadStatus is the current load level and what was refused in it.
+type LoadStatus struct {
+	Level      string            `json:"level"`
+	Heap       uint64            `json:"heap"`
+	Thresholds []uint64          `json:"thresholds"`
+	Since      time.Time         `json:"since"`
+	Refused    map[string]uint64 `json:"refused"`
+}
+
+// LoadShedder refuses new work while the server is short of memory: new
+// anonymous connections first, then new rooms, then new calls.
+type LoadShedder interface {
+	AllowConnection(authenticated bool) bool
+	AllowRoom() bool
+	AllowCall() bool
+	LoadStatus() *LoadStatus
+	Stop()
+}
+
+type loadShedder struct {
+	mutex      sync.Mutex
+	thresholds []uint64 // Heap bytes to enter a level, by level - 1. Zero disables a level.
+	level      int
+	heap       uint64
+	since      time.Time
+	refused    map[string]uint64
+	exit       chan bool
+}
+
+// NewLoadShedder creates a load shedder which sheds anonymous connections,
+// rooms and calls once the heap exceeds the respective threshold in bytes,
+// checked every interval. Thresholds of zero never shed. Levels are left
+// once the heap drops below 90% of their threshold.
+func NewLoadShedder(anonymous, rooms, calls uint64, interval time.Duration) LoadShedder {
+	shedder := &loadShedder{
+		thresholds: []uint64{anonymous, rooms, calls},
+		since:      time.Now(),
+		refused:    make(map[string]uint64),
+		exit:       make(chan bool),
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		memStats := &runtime.MemStats{}
+		for {
+			select {
+			case <-ticker.C:
+				runtime.ReadMemStats(memStats)
+				shedder.update(memStats.HeapAlloc)
+			case <-shedder.exit:
+				return
+			}
+		}
+	}()
+	return shedder
+}
+
+// Stop ends the heap checks.
+func (shedder *loadShedder) Stop() {
+	close(shedder.exit)
+}
+
+func (shedder *loadShedder) update(heap uint64) {
+	shedder.mutex.Lock()
+	defer shedder.mutex.Unlock()
+	shedder.heap = heap
+	level := LoadNormal
+	for i, threshold := range shedder.thresholds {
+		if threshold > 0 && heap >= threshold {
+			level = i + 1
+		}
+	}
+	current := shedder.level
+	// Leave levels only well below their threshold, to not flap.
+	for current > level && (shedder.thresholds[current-1] == 0 || heap < shedder.thresholds[current-1]/10*9) {
+		current--
+	}
+	if level > current {
+		current = level
+	}
+	if current != shedder.level {
+		log.Printf("Load level changed from %s to %s with %d bytes heap\n", LoadLevelNames[shedder.level], LoadLevelNames[current], heap)
+		shedder.level = current
+		shedder.since = time.Now()
+	}
+}
+
+func (shedder *loadShedder) allow(level int, what string) bool {
+	shedder.mutex.Lock()
+	defer shedder.mutex.Unlock()
+	if shedder.level < level {
+		return true
+	}
+	shedder.refused[what]++
+	return false
+}
+
+func (shedder *loadShedder) AllowConnection(authenticated bool) bool {
+	return authenticated || shedder.allow(LoadShedAnonymous, "connections")
+}
+
+func (shedder *loadShedder) AllowRoom() bool {
+	return shedder.allow(LoadShedRooms, "rooms")
+}
+
+func (shedder *loadShedder) AllowCall() bool {
+	return shedder.allow(LoadShedCalls, "calls")
+}
+
+func (shedder *loadShedder) LoadStatus() *LoadStatus {
+	shedder.mutex.Lock()
+	defer shedder.mutex.Unlock()
+	refused := make(map[string]uint64, len(shedder.refused))
+	for what, count := range shedder.refused {
+		refused[what] = count
+	}
+	return &LoadStatus{
+		Level:      LoadLevelNames[shedder.level],
+		Heap:       shedder.heap,
+		Thresholds: append([]uint64(nil), shedder.thresholds...),
+		Since:      shedder.since,
+		Refused:    refused,
+	}
+}
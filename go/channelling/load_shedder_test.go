@@ -0,0 +1,82 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package channelling
+
+import (
+	"testing"
+	"time"
+)
+
+func Test_LoadShedder_Levels(t *testing.T) {
+	shedder := NewLoadShedder(100, 200, 300, time.Hour).(*loadShedder)
+	defer shedder.Stop()
+
+	if !shedder.AllowConnection(false) || !shedder.AllowRoom() || !shedder.AllowCall() {
+		t.Fatal("Expected everything to be allowed at normal load")
+	}
+
+	shedder.update(150)
+	if shedder.AllowConnection(false) || !shedder.AllowConnection(true) || !shedder.AllowRoom() {
+		t.Error("Expected only anonymous connections to be refused")
+	}
+
+	shedder.update(350)
+	if shedder.AllowRoom() || shedder.AllowCall() {
+		t.Error("Expected rooms and calls to be refused")
+	}
+
+	status := shedder.LoadStatus()
+	if status.Level != "shed_calls" || status.Heap != 350 {
+		t.Errorf("Unexpected status %+v", status)
+	}
+	if status.Refused["connections"] != 1 || status.Refused["rooms"] != 1 || status.Refused["calls"] != 1 {
+		t.Errorf("Unexpected refusals %v", status.Refused)
+	}
+}
+
+func Test_LoadShedder_Hysteresis(t *testing.T) {
+	shedder := NewLoadShedder(100, 0, 300, time.Hour).(*loadShedder)
+	defer shedder.Stop()
+
+	shedder.update(300)
+	if level := shedder.LoadStatus().Level; level != "shed_calls" {
+		t.Fatalf("Expected shed_calls, but got %s", level)
+	}
+	// Still above 90% of the calls threshold.
+	shedder.update(280)
+	if level := shedder.LoadStatus().Level; level != "shed_calls" {
+		t.Errorf("Expected to stay at shed_calls, but got %s", level)
+	}
+	// Disabled rooms level is skipped on the way down.
+	shedder.update(200)
+	if level := shedder.LoadStatus().Level; level != "shed_anonymous" {
+		t.Errorf("Expected shed_anonymous, but got %s", level)
+	}
+	shedder.update(95)
+	if level := shedder.LoadStatus().Level; level != "shed_anonymous" {
+		t.Errorf("Expected to stay at shed_anonymous, but got %s", level)
+	}
+	shedder.update(50)
+	if level := shedder.LoadStatus().Level; level != "normal" {
+		t.Errorf("Expected normal, but got %s", level)
+	}
+}
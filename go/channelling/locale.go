@@ -0,0 +1,182 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package channelling
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const maxLocaleLength = 35
+
+// NormalizeLocale returns locale as lower case language tag with dashes, e.g.
+// de_AT becomes de-at. Returns an empty string for invalid locales.
+func NormalizeLocale(locale string) string {
+	locale = strings.Replace(strings.ToLower(strings.TrimSpace(locale)), "_", "-", -1)
+	if len(locale) > maxLocaleLength {
+		return ""
+	}
+	for _, c := range locale {
+		if (c < 'a' || c > 'z') && (c < '0' || c > '9') && c != '-' {
+			return ""
+		}
+	}
+	return locale
+}
+
+// localeChain returns the locales tried for locale, from most to least
+// specific, e.g. de-at and de.
+func localeChain(locale string) []string {
+	var chain []string
+	for locale != "" {
+		chain = append(chain, locale)
+		idx := strings.LastIndex(locale, "-")
+		if idx < 0 {
+			break
+		}
+		locale = locale[:idx]
+	}
+	return chain
+}
+
+// MessageCatalogs translate server-generated messages into the locale of
+// the receiving session. Messages are identified by their code, e.g. the
+// code of an error. Catalogs must not be changed once they are in use.
+type MessageCatalogs struct {
+	defaultLocale string
+	catalogs      map[string]map[string]string
+}
+
+func NewMessageCatalogs(defaultLocale string) *MessageCatalogs {
+	return &MessageCatalogs{
+		defaultLocale: NormalizeLocale(defaultLocale),
+		catalogs:      make(map[string]map[string]string),
+	}
+}
+
+// LoadMessageCatalogs reads the catalogs from the <locale>.json files in
+// dir. Each file contains an object mapping message codes to texts.
+func LoadMessageCatalogs(dir, defaultLocale string) (*MessageCatalogs, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		if _, err := os.Stat(dir); err != nil {
+			return nil, err
+		}
+	}
+	catalogs := NewMessageCatalogs(defaultLocale)
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		var messages map[string]string
+		if err := json.Unmarshal(data, &messages); err != nil {
+			return nil, err
+		}
+		locale := NormalizeLocale(strings.TrimSuffix(filepath.Base(file), ".json"))
+		if locale == "" {
+			continue
+		}
+		catalogs.Add(locale, messages)
+	}
+	return catalogs, nil
+}
+
+// Add adds the messages of locale, replacing existing messages with the
+// same code.
+func (c *MessageCatalogs) Add(locale string, messages map[string]string) {
+	catalog, ok := c.catalogs[locale]
+	if !ok {
+		catalog = make(map[string]string)
+		c.catalogs[locale] = catalog
+	}
+	for id, message := range messages {
+		catalog[id] = message
+	}
+}
+
+// Len returns the number of loaded locales.
+func (c *MessageCatalogs) Len() int {
+	return len(c.catalogs)
+}
+
+// Translate returns the message id in locale. It falls back to less
+// specific locales, then to the default locale and finally to fallback.
+func (c *MessageCatalogs) Translate(locale, id, fallback string) string {
+	if c == nil || id == "" {
+		return fallback
+	}
+	for _, chain := range [][]string{localeChain(locale), localeChain(c.defaultLocale)} {
+		for _, l := range chain {
+			if message, ok := c.catalogs[l][id]; ok {
+				return message
+			}
+		}
+	}
+	return fallback
+}
+
+// Localize returns a copy of m with its message translated into locale if
+// m is a server-generated message, and whether m was translated.
+func (c *MessageCatalogs) Localize(locale string, m interface{}) (interface{}, bool) {
+	if c == nil {
+		return m, false
+	}
+	switch data := m.(type) {
+	case *DataError:
+		if message := c.Translate(locale, data.Code, data.Message); message != data.Message {
+			localized := *data
+			localized.Message = message
+			return &localized, true
+		}
+	case *DataWarning:
+		if message := c.Translate(locale, data.Code, data.Message); message != data.Message {
+			localized := *data
+			localized.Message = message
+			return &localized, true
+		}
+	case *DataAnnouncement:
+		if message := c.Translate(locale, data.Code, data.Message); message != data.Message {
+			localized := *data
+			localized.Message = message
+			return &localized, true
+		}
+	}
+	return m, false
+}
+
+// localizeOutgoing returns outgoing with its data translated into locale,
+// copying outgoing if needed.
+func (c *MessageCatalogs) localizeOutgoing(locale string, outgoing *DataOutgoing) *DataOutgoing {
+	if data, ok := c.Localize(locale, outgoing.Data); ok {
+		localized := *outgoing
+		localized.Data = data
+		return &localized
+	}
+	return outgoing
+}
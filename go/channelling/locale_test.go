@@ -0,0 +1,141 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package channelling
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/strukturag/spreed-webrtc/go/buffercache"
+)
+
+type localeTestConnection struct {
+	testConnection
+	last string
+}
+
+func (conn *localeTestConnection) Send(message buffercache.Buffer) {
+	conn.last = string(message.Bytes())
+}
+
+func Test_NormalizeLocale(t *testing.T) {
+	for locale, expected := range map[string]string{
+		"de_AT":   "de-at",
+		" EN ":    "en",
+		"zh-Hans": "zh-hans",
+		"de/../x": "",
+	} {
+		if normalized := NormalizeLocale(locale); normalized != expected {
+			t.Errorf("Expected %q for %q, but got %q", expected, locale, normalized)
+		}
+	}
+}
+
+func Test_MessageCatalogs_TranslateFallsBack(t *testing.T) {
+	catalogs := NewMessageCatalogs("en")
+	catalogs.Add("en", map[string]string{"room_full": "The room is full", "maintenance": "Maintenance"})
+	catalogs.Add("de", map[string]string{"room_full": "Der Raum ist voll"})
+	catalogs.Add("de-at", map[string]string{"maintenance": "Wartungsarbeiten"})
+
+	for _, test := range []struct{ locale, id, expected string }{
+		{"de-at", "maintenance", "Wartungsarbeiten"},
+		{"de-at", "room_full", "Der Raum ist voll"},
+		{"de", "maintenance", "Maintenance"},
+		{"", "room_full", "The room is full"},
+		{"fr", "unknown", "fallback"},
+	} {
+		if message := catalogs.Translate(test.locale, test.id, "fallback"); message != test.expected {
+			t.Errorf("Expected %q for %s in %q, but got %q", test.expected, test.id, test.locale, message)
+		}
+	}
+
+	var none *MessageCatalogs
+	if message := none.Translate("de", "room_full", "fallback"); message != "fallback" {
+		t.Errorf("Expected fallback without catalogs, but got %q", message)
+	}
+}
+
+func Test_MessageCatalogs_LocalizeCopies(t *testing.T) {
+	catalogs := NewMessageCatalogs("en")
+	catalogs.Add("de", map[string]string{"room_full": "Der Raum ist voll"})
+
+	err := &DataError{"Error", "room_full", "The room is full"}
+	localized, ok := catalogs.Localize("de", err)
+	if !ok || localized.(*DataError).Message != "Der Raum ist voll" {
+		t.Fatalf("Expected translated error, but got %v", localized)
+	}
+	if err.Message != "The room is full" {
+		t.Error("Expected the original error to be unchanged")
+	}
+	if _, ok := catalogs.Localize("de", &DataWelcome{}); ok {
+		t.Error("Expected other documents not to be translated")
+	}
+}
+
+func Test_LoadMessageCatalogs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "catalogs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, "de_AT.json"), []byte(`{"maintenance": "Wartung"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	catalogs, err := LoadMessageCatalogs(dir, "en")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if catalogs.Len() != 1 || catalogs.Translate("de-at", "maintenance", "") != "Wartung" {
+		t.Errorf("Expected catalog for de-at, but got %v", catalogs.catalogs)
+	}
+	if _, err := LoadMessageCatalogs(filepath.Join(dir, "missing"), "en"); err == nil {
+		t.Error("Expected error for a missing directory")
+	}
+}
+
+func Test_Hub_Announce_EncodesPerLocale(t *testing.T) {
+	h := NewHub(&Config{}, []byte("secret"), []byte("encryptionsecret"), nil, NewCodec(1024, nil))
+	catalogs := NewMessageCatalogs("en")
+	catalogs.Add("de", map[string]string{"maintenance": "Wartung"})
+	h.SetMessageCatalogs(catalogs)
+	sessions := []*Session{{Id: "a", locale: "de"}, {Id: "b", locale: "de-at"}, {Id: "c"}}
+	connections := make([]*localeTestConnection, len(sessions))
+	for i, session := range sessions {
+		client := NewClient(nil, nil, session)
+		connections[i] = &localeTestConnection{}
+		client.Connection = connections[i]
+		h.OnConnect(client, session)
+	}
+
+	if count := h.Announce("", "", &DataAnnouncement{Type: "Announcement", Code: "maintenance", Message: "Maintenance"}); count != 3 {
+		t.Errorf("Expected announcement to all sessions, but got %d", count)
+	}
+	for i, expected := range []string{"Wartung", "Wartung", "Maintenance"} {
+		if !strings.Contains(connections[i].last, `"Message":"`+expected+`"`) {
+			t.Errorf("Expected %s for session %s, but got %s", expected, sessions[i].Id, connections[i].last)
+		}
+	}
+}
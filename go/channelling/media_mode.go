@@ -0,0 +1,86 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package channelling
+
+const (
+	// MediaModeMesh connects all participants of a call with each other.
+	MediaModeMesh = "mesh"
+	// MediaModeSFU connects all participants with a selective forwarding
+	// unit, which forwards their media to the others.
+	MediaModeSFU = "sfu"
+)
+
+const (
+	// MediaModePhasePrepare asks clients to set up the connections of the
+	// new mode, while keeping the current ones.
+	MediaModePhasePrepare = "prepare"
+	// MediaModePhaseSwitch tells clients to use the mode and to close the
+	// connections of other modes.
+	MediaModePhaseSwitch = "switch"
+)
+
+// MediaModePolicy decides whether the calls of a room use peer to peer
+// connections or a selective forwarding unit.
+type MediaModePolicy interface {
+	MediaMode(current string, participants int) string
+}
+
+type thresholdMediaModePolicy struct {
+	escalate   int
+	deescalate int
+}
+
+// NewMediaModePolicy creates a policy which escalates rooms to the SFU
+// once they have escalate participants, and returns them to mesh calls at
+// deescalate participants or less. Rooms in between keep their mode, so
+// they do not flap. An escalate threshold of 0 keeps all rooms in mesh.
+func NewMediaModePolicy(escalate, deescalate int) MediaModePolicy {
+	if deescalate <= 0 || deescalate >= escalate {
+		deescalate = escalate / 2
+	}
+	return &thresholdMediaModePolicy{escalate, deescalate}
+}
+
+func (policy *thresholdMediaModePolicy) MediaMode(current string, participants int) string {
+	switch {
+	case policy.escalate <= 0:
+		return MediaModeMesh
+	case participants >= policy.escalate:
+		return MediaModeSFU
+	case participants <= policy.deescalate:
+		return MediaModeMesh
+	case current == "":
+		return MediaModeMesh
+	default:
+		return current
+	}
+}
+
+// MediaModeEvent is triggered on the bus when a room prepares or completes
+// a switch of its media mode, so the SFU integration can follow.
+type MediaModeEvent struct {
+	Roomid       string
+	Mode         string
+	Phase        string
+	Sequence     uint64
+	Participants int
+}
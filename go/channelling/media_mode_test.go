@@ -0,0 +1,110 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package channelling
+
+import (
+	"testing"
+	"time"
+)
+
+func Test_MediaModePolicy(t *testing.T) {
+	policy := NewMediaModePolicy(6, 3)
+	for _, check := range []struct {
+		current      string
+		participants int
+		expected     string
+	}{
+		{MediaModeMesh, 5, MediaModeMesh},
+		{MediaModeMesh, 6, MediaModeSFU},
+		{MediaModeSFU, 4, MediaModeSFU},
+		{MediaModeSFU, 3, MediaModeMesh},
+		{MediaModeMesh, 4, MediaModeMesh},
+	} {
+		if mode := policy.MediaMode(check.current, check.participants); mode != check.expected {
+			t.Errorf("Expected %s for %d participants in %s, got %s", check.expected, check.participants, check.current, mode)
+		}
+	}
+	if mode := NewMediaModePolicy(0, 0).MediaMode(MediaModeMesh, 100); mode != MediaModeMesh {
+		t.Errorf("Expected disabled policy to keep mesh, got %s", mode)
+	}
+}
+
+func newTestMediaModeRoomWorker(timeout time.Duration) RoomWorker {
+	manager := &roomManager{
+		Config:          &Config{MediaModeTimeout: timeout},
+		OutgoingEncoder: NewCodec(1024, nil),
+		mediaModePolicy: NewMediaModePolicy(3, 1),
+	}
+	worker := NewRoomWorker(manager, testRoomID, testRoomName, testRoomType, nil)
+	go worker.Start()
+	return worker
+}
+
+func Test_RoomWorker_MediaMode_SwitchesWhenAllAreReady(t *testing.T) {
+	worker := newTestMediaModeRoomWorker(0)
+	for _, id := range []string{"a", "b"} {
+		worker.Join(nil, &Session{Id: id}, nil)
+	}
+	if mode := worker.GetMediaMode(); mode != nil {
+		t.Fatalf("Expected mesh, got %+v", mode)
+	}
+
+	worker.Join(nil, &Session{Id: "c"}, nil)
+	prepare := worker.GetMediaMode()
+	if prepare == nil || prepare.Mode != MediaModeSFU || prepare.Phase != MediaModePhasePrepare {
+		t.Fatalf("Expected sfu switch to be prepared, got %+v", prepare)
+	}
+	worker.SetMediaModeReady("a", prepare.Sequence)
+	worker.SetMediaModeReady("b", prepare.Sequence+1)
+	if mode := worker.GetMediaMode(); mode.Phase != MediaModePhasePrepare {
+		t.Fatalf("Expected switch to wait for all participants, got %+v", mode)
+	}
+	worker.SetMediaModeReady("b", prepare.Sequence)
+	worker.SetMediaModeReady("c", prepare.Sequence)
+	if mode := worker.GetMediaMode(); mode == nil || mode.Mode != MediaModeSFU || mode.Phase != MediaModePhaseSwitch {
+		t.Fatalf("Expected sfu mode, got %+v", mode)
+	}
+
+	worker.Leave("b")
+	worker.Leave("c")
+	deadline := time.Now().Add(time.Second)
+	for worker.GetMediaMode() != nil && worker.GetMediaMode().Phase != MediaModePhasePrepare && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if mode := worker.GetMediaMode(); mode == nil || mode.Mode != MediaModeMesh || mode.Phase != MediaModePhasePrepare {
+		t.Errorf("Expected mesh switch to be prepared, got %+v", mode)
+	}
+}
+
+func Test_RoomWorker_MediaMode_SwitchesAfterTimeout(t *testing.T) {
+	worker := newTestMediaModeRoomWorker(10 * time.Millisecond)
+	for _, id := range []string{"a", "b", "c"} {
+		worker.Join(nil, &Session{Id: id}, nil)
+	}
+	if mode := worker.GetMediaMode(); mode == nil || mode.Phase != MediaModePhasePrepare {
+		t.Fatalf("Expected sfu switch to be prepared, got %+v", mode)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if mode := worker.GetMediaMode(); mode == nil || mode.Mode != MediaModeSFU || mode.Phase != MediaModePhaseSwitch {
+		t.Errorf("Expected sfu mode after timeout, got %+v", mode)
+	}
+}
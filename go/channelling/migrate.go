@@ -0,0 +1,100 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package channelling
+
+import (
+	"log"
+	"net/url"
+	"sort"
+)
+
+const maxMigrateURLLength = 2048
+
+// A SessionMigrator asks connected clients to reconnect to another server,
+// e.g. to drain a server before it is stopped or to rebalance load.
+type SessionMigrator interface {
+	MigrateSessions(ids []string, count int, url, reason string) (int, error)
+}
+
+type sessionMigrator struct {
+	ClientStats
+	SessionStore
+	SessionEncoder
+}
+
+func NewSessionMigrator(clientStats ClientStats, sessionStore SessionStore, sessionEncoder SessionEncoder) SessionMigrator {
+	return &sessionMigrator{clientStats, sessionStore, sessionEncoder}
+}
+
+// MigrateSessions sends a Migrate message to the sessions ids, or to all
+// connected sessions if ids is empty. With a positive count at most count
+// sessions are migrated. It returns the number of migrated sessions.
+func (migrator *sessionMigrator) MigrateSessions(ids []string, count int, target, reason string) (int, error) {
+	if err := checkMigrateURL(target); err != nil {
+		return 0, err
+	}
+	if len(ids) == 0 {
+		_, sessions, _ := migrator.ClientInfo(true)
+		for id := range sessions {
+			ids = append(ids, id)
+		}
+		// Migrate in a stable order, which makes partial migrations
+		// predictable.
+		sort.Strings(ids)
+	}
+
+	migrated := 0
+	for _, id := range ids {
+		if count > 0 && migrated >= count {
+			break
+		}
+		session, ok := migrator.GetSession(id)
+		if !ok {
+			continue
+		}
+		token, err := migrator.EncodeSessionToken(session)
+		if err != nil {
+			log.Println("Failed to create token for migration", id, err)
+			continue
+		}
+		session.Unicast(session.Id, &DataMigrate{
+			Type:   "Migrate",
+			Url:    target,
+			Token:  token,
+			Reason: reason,
+		}, nil)
+		migrated++
+	}
+	log.Printf("Migrated %d sessions to %s\n", migrated, target)
+	return migrated, nil
+}
+
+func checkMigrateURL(target string) error {
+	if len(target) > maxMigrateURLLength {
+		return NewDataError("invalid_migrate_url", "Migration URL is too long")
+	}
+	u, err := url.Parse(target)
+	if err != nil || (u.Scheme != "ws" && u.Scheme != "wss") || u.Host == "" {
+		return NewDataError("invalid_migrate_url", "Migration URL must be a ws or wss URL")
+	}
+	return nil
+}
@@ -0,0 +1,187 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package channelling
+
+import (
+	"log"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/strukturag/spreed-webrtc/go/buffercache"
+)
+
+// Messages queued for delayed delivery per client, further messages are
+// dropped.
+const simulatedQueueSize = 1024
+
+// NetworkConditions are simulated for the delivery of signaling messages to
+// a session. Every message is delayed by Delay plus or minus a random
+// Jitter and dropped with the probability Drop (0 to 1). Messages are never
+// reordered.
+type NetworkConditions struct {
+	Delay  time.Duration
+	Jitter time.Duration
+	Drop   float64
+}
+
+// NetworkSimulator holds the simulated network conditions for testing
+// clients in staging, per session, per room and as default for all
+// sessions. Session conditions take precedence over room conditions.
+type NetworkSimulator struct {
+	mutex    sync.RWMutex
+	defaults *NetworkConditions
+	sessions map[string]*NetworkConditions
+	rooms    map[string]*NetworkConditions
+	random   *rand.Rand
+}
+
+// NewNetworkSimulator creates a simulator which applies defaults to all
+// sessions without other conditions. Defaults can be nil.
+func NewNetworkSimulator(defaults *NetworkConditions) *NetworkSimulator {
+	return &NetworkSimulator{
+		defaults: defaults,
+		sessions: make(map[string]*NetworkConditions),
+		rooms:    make(map[string]*NetworkConditions),
+		random:   rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// SetSession sets the conditions of the session id, nil removes them.
+func (simulator *NetworkSimulator) SetSession(id string, conditions *NetworkConditions) {
+	simulator.mutex.Lock()
+	if conditions == nil {
+		delete(simulator.sessions, id)
+	} else {
+		simulator.sessions[id] = conditions
+	}
+	simulator.mutex.Unlock()
+}
+
+// SetRoom sets the conditions of the sessions in the room roomID, nil
+// removes them.
+func (simulator *NetworkSimulator) SetRoom(roomID string, conditions *NetworkConditions) {
+	simulator.mutex.Lock()
+	if conditions == nil {
+		delete(simulator.rooms, roomID)
+	} else {
+		simulator.rooms[roomID] = conditions
+	}
+	simulator.mutex.Unlock()
+}
+
+// Conditions returns the conditions of session, or nil if it has none.
+func (simulator *NetworkSimulator) Conditions(session *Session) *NetworkConditions {
+	simulator.mutex.RLock()
+	defer simulator.mutex.RUnlock()
+	if conditions, ok := simulator.sessions[session.Id]; ok {
+		return conditions
+	}
+	if conditions, ok := simulator.rooms[session.Roomid]; ok {
+		return conditions
+	}
+	return simulator.defaults
+}
+
+// All returns the default conditions and copies of the conditions by
+// session id and by room id.
+func (simulator *NetworkSimulator) All() (defaults *NetworkConditions, sessions, rooms map[string]*NetworkConditions) {
+	simulator.mutex.RLock()
+	defer simulator.mutex.RUnlock()
+	sessions = make(map[string]*NetworkConditions, len(simulator.sessions))
+	for id, conditions := range simulator.sessions {
+		sessions[id] = conditions
+	}
+	rooms = make(map[string]*NetworkConditions, len(simulator.rooms))
+	for id, conditions := range simulator.rooms {
+		rooms[id] = conditions
+	}
+	return simulator.defaults, sessions, rooms
+}
+
+// due returns when a message sent now should be delivered under conditions,
+// or false if it is dropped.
+func (simulator *NetworkSimulator) due(conditions *NetworkConditions, now time.Time) (time.Time, bool) {
+	simulator.mutex.Lock()
+	defer simulator.mutex.Unlock()
+	if conditions.Drop > 0 && simulator.random.Float64() < conditions.Drop {
+		return now, false
+	}
+	delay := conditions.Delay
+	if conditions.Jitter > 0 {
+		delay += time.Duration(simulator.random.Int63n(int64(2*conditions.Jitter+1))) - conditions.Jitter
+	}
+	if delay < 0 {
+		delay = 0
+	}
+	return now.Add(delay), true
+}
+
+type simulatedMessage struct {
+	due      time.Time
+	message  buffercache.Buffer
+	presence bool
+}
+
+// simulatedLink delivers the messages of a client in order, each not
+// before it is due.
+type simulatedLink struct {
+	mutex  sync.Mutex
+	queue  chan *simulatedMessage
+	closed bool
+}
+
+func newSimulatedLink(send func(buffercache.Buffer, bool)) *simulatedLink {
+	link := &simulatedLink{queue: make(chan *simulatedMessage, simulatedQueueSize)}
+	go func() {
+		for m := range link.queue {
+			time.Sleep(m.due.Sub(time.Now()))
+			send(m.message, m.presence)
+			m.message.Decref()
+		}
+	}()
+	return link
+}
+
+func (link *simulatedLink) send(due time.Time, message buffercache.Buffer, presence bool) {
+	link.mutex.Lock()
+	defer link.mutex.Unlock()
+	if link.closed {
+		return
+	}
+	message.Incref()
+	select {
+	case link.queue <- &simulatedMessage{due, message, presence}:
+	default:
+		message.Decref()
+		log.Println("Simulated network queue overflow, dropping message")
+	}
+}
+
+func (link *simulatedLink) close() {
+	link.mutex.Lock()
+	if !link.closed {
+		link.closed = true
+		close(link.queue)
+	}
+	link.mutex.Unlock()
+}
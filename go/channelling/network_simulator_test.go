@@ -0,0 +1,99 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package channelling
+
+import (
+	"testing"
+	"time"
+
+	"github.com/strukturag/spreed-webrtc/go/buffercache"
+)
+
+func Test_NetworkSimulator_Conditions(t *testing.T) {
+	defaults := &NetworkConditions{Delay: time.Second}
+	room := &NetworkConditions{Drop: 0.5}
+	session := &NetworkConditions{Jitter: time.Second}
+	simulator := NewNetworkSimulator(defaults)
+	simulator.SetRoom("Room:test", room)
+	simulator.SetSession("a", session)
+
+	if conditions := simulator.Conditions(&Session{Id: "a", Roomid: "Room:test"}); conditions != session {
+		t.Errorf("Expected session conditions, but got %v", conditions)
+	}
+	if conditions := simulator.Conditions(&Session{Id: "b", Roomid: "Room:test"}); conditions != room {
+		t.Errorf("Expected room conditions, but got %v", conditions)
+	}
+	if conditions := simulator.Conditions(&Session{Id: "c", Roomid: "Room:other"}); conditions != defaults {
+		t.Errorf("Expected default conditions, but got %v", conditions)
+	}
+
+	simulator.SetSession("a", nil)
+	if conditions := simulator.Conditions(&Session{Id: "a", Roomid: "Room:test"}); conditions != room {
+		t.Errorf("Expected room conditions after removing session conditions, but got %v", conditions)
+	}
+}
+
+func Test_NetworkSimulator_Due(t *testing.T) {
+	simulator := NewNetworkSimulator(nil)
+	now := time.Now()
+	if _, ok := simulator.due(&NetworkConditions{Drop: 1}, now); ok {
+		t.Error("Expected message to be dropped")
+	}
+	conditions := &NetworkConditions{Delay: 100 * time.Millisecond, Jitter: 50 * time.Millisecond}
+	for i := 0; i < 100; i++ {
+		due, ok := simulator.due(conditions, now)
+		if !ok {
+			t.Fatal("Expected message not to be dropped")
+		}
+		if delay := due.Sub(now); delay < 50*time.Millisecond || delay > 150*time.Millisecond {
+			t.Fatalf("Expected delay within jitter, but got %s", delay)
+		}
+	}
+}
+
+func Test_SimulatedLink_DeliversInOrder(t *testing.T) {
+	cache := buffercache.NewBufferCache(0, 0)
+	delivered := make(chan string, 3)
+	link := newSimulatedLink(func(message buffercache.Buffer, presence bool) {
+		delivered <- string(message.Bytes())
+	})
+	defer link.close()
+
+	now := time.Now()
+	link.send(now.Add(50*time.Millisecond), cache.Wrap([]byte("first")), false)
+	// Due earlier, but must not overtake the first message.
+	link.send(now, cache.Wrap([]byte("second")), false)
+
+	for _, expected := range []string{"first", "second"} {
+		select {
+		case message := <-delivered:
+			if message != expected {
+				t.Errorf("Expected %s, but got %s", expected, message)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Expected %s to be delivered", expected)
+		}
+	}
+	if elapsed := time.Since(now); elapsed < 50*time.Millisecond {
+		t.Errorf("Expected delivery to be delayed, but took %s", elapsed)
+	}
+}
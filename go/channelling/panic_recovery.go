@@ -0,0 +1,149 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package channelling
+
+import (
+	"fmt"
+	"log"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Maximum number of stack frames kept in a PanicReport.
+const maxPanicFrames = 64
+
+// PanicFrame is a stack frame of a recovered panic.
+type PanicFrame struct {
+	Function string `json:"function"`
+	File     string `json:"filename"`
+	Line     int    `json:"lineno"`
+}
+
+// PanicReport is a panic recovered in a goroutine of a connection or a
+// handler.
+type PanicReport struct {
+	Time    time.Time
+	Where   string
+	Session string // Empty for private sessions and goroutines without session.
+	Value   string
+	Stack   []byte
+	Frames  []*PanicFrame // Innermost first, starting at the panic.
+}
+
+// PanicReporter sends recovered panics to a crash reporting service.
+type PanicReporter interface {
+	ReportPanic(report *PanicReport)
+}
+
+// PanicRecovery recovers panics so they only affect one connection or
+// handler instead of stopping the server.
+type PanicRecovery interface {
+	// Recover must be deferred directly. It recovers a panic in where, logs
+	// and reports it and then calls cleanup, which may be nil.
+	Recover(where, sessionID string, cleanup func())
+	// Panics returns the number of recovered panics by where.
+	Panics() map[string]uint64
+}
+
+type panicRecovery struct {
+	reporter PanicReporter
+	mutex    sync.Mutex
+	panics   map[string]uint64
+}
+
+// NewPanicRecovery creates a PanicRecovery which sends recovered panics to
+// reporter, which may be nil.
+func NewPanicRecovery(reporter PanicReporter) PanicRecovery {
+	return &panicRecovery{
+		reporter: reporter,
+		panics:   make(map[string]uint64),
+	}
+}
+
+func (recovery *panicRecovery) Recover(where, sessionID string, cleanup func()) {
+	value := recover()
+	if value == nil {
+		return
+	}
+	report := &PanicReport{
+		Time:    time.Now(),
+		Where:   where,
+		Session: sessionID,
+		Value:   fmt.Sprint(value),
+		Stack:   debug.Stack(),
+		Frames:  panicFrames(),
+	}
+	log.Printf("Recovered panic where=%s session=%s panic=%q\n%s", report.Where, report.Session, report.Value, report.Stack)
+
+	recovery.mutex.Lock()
+	recovery.panics[where]++
+	recovery.mutex.Unlock()
+
+	if recovery.reporter != nil {
+		recovery.reporter.ReportPanic(report)
+	}
+	if cleanup != nil {
+		defer func() {
+			// Do not take the server down when the cleanup fails as well.
+			if value := recover(); value != nil {
+				log.Printf("Recovered panic in cleanup where=%s session=%s panic=%q\n", where, sessionID, fmt.Sprint(value))
+			}
+		}()
+		cleanup()
+	}
+}
+
+func (recovery *panicRecovery) Panics() map[string]uint64 {
+	recovery.mutex.Lock()
+	defer recovery.mutex.Unlock()
+	panics := make(map[string]uint64, len(recovery.panics))
+	for where, count := range recovery.panics {
+		panics[where] = count
+	}
+	return panics
+}
+
+// panicFrames returns the stack of the panicking goroutine, without the
+// frames of the recovery and the runtime.
+func panicFrames() []*PanicFrame {
+	pcs := make([]uintptr, maxPanicFrames)
+	pcs = pcs[:runtime.Callers(0, pcs)]
+	frames := []*PanicFrame{}
+	for _, pc := range pcs {
+		fn := runtime.FuncForPC(pc - 1)
+		if fn == nil {
+			continue
+		}
+		name := fn.Name()
+		if strings.HasPrefix(name, "runtime.gopanic") || strings.HasPrefix(name, "runtime.panic") || name == "runtime.sigpanic" {
+			// Everything before is the recovery.
+			frames = frames[:0]
+			continue
+		}
+		file, line := fn.FileLine(pc - 1)
+		frames = append(frames, &PanicFrame{Function: name, File: file, Line: line})
+	}
+	return frames
+}
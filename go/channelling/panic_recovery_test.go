@@ -0,0 +1,91 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+package channelling
+
+import (
+	"strings"
+	"testing"
+)
+
+type testPanicReporter struct {
+	reports []*PanicReport
+}
+
+func (reporter *testPanicReporter) ReportPanic(report *PanicReport) {
+	reporter.reports = append(reporter.reports, report)
+}
+
+func panickingJob(recovery PanicRecovery, cleanup func()) {
+	defer recovery.Recover("test", "session-id", cleanup)
+	panic("boom")
+}
+
+func Test_PanicRecovery_RecoversAndReports(t *testing.T) {
+	reporter := &testPanicReporter{}
+	recovery := NewPanicRecovery(reporter)
+	cleaned := false
+
+	panickingJob(recovery, func() { cleaned = true })
+	panickingJob(recovery, nil)
+
+	if !cleaned {
+		t.Error("Expected cleanup to run")
+	}
+	if count := recovery.Panics()["test"]; count != 2 {
+		t.Errorf("Expected 2 recovered panics, got %d", count)
+	}
+	if len(reporter.reports) != 2 {
+		t.Fatalf("Expected 2 reports, got %d", len(reporter.reports))
+	}
+	report := reporter.reports[0]
+	if report.Where != "test" || report.Session != "session-id" || report.Value != "boom" {
+		t.Errorf("Unexpected report %+v", report)
+	}
+	if len(report.Frames) == 0 || !strings.HasSuffix(report.Frames[0].Function, "panickingJob") {
+		t.Errorf("Expected the frames to start at the panic, got %+v", report.Frames)
+	}
+}
+
+func Test_PanicRecovery_IgnoresNormalReturn(t *testing.T) {
+	recovery := NewPanicRecovery(nil)
+	func() {
+		defer recovery.Recover("test", "", func() { t.Error("Expected no cleanup without panic") })
+	}()
+	if len(recovery.Panics()) != 0 {
+		t.Errorf("Expected no panics, got %v", recovery.Panics())
+	}
+}
+
+func Test_ParseSentryDSN(t *testing.T) {
+	endpoint, auth, err := parseSentryDSN("https://public@sentry.example.com/prefix/42", "1.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if endpoint != "https://sentry.example.com/prefix/api/42/store/" {
+		t.Errorf("Unexpected endpoint %s", endpoint)
+	}
+	if !strings.Contains(auth, "sentry_key=public") {
+		t.Errorf("Expected the key in the auth header, got %s", auth)
+	}
+	if _, _, err := parseSentryDSN("https://sentry.example.com/42", "1.0"); err == nil {
+		t.Error("Expected an error for a DSN without key")
+	}
+}
@@ -32,11 +32,29 @@ import (
 	"github.com/strukturag/spreed-webrtc/go/buffercache"
 )
 
+const (
+	PipelineCloseReasonExpired = "expired"
+	PipelineCloseReasonBye     = "bye"
+)
+
 type PipelineFeedLine struct {
 	Seq int
 	Msg *DataOutgoing
 }
 
+// PipelineStat contains usage statistics of a single pipeline.
+type PipelineStat struct {
+	Id           string    `json:"id"`
+	Namespace    string    `json:"namespace"`
+	Created      time.Time `json:"created"`
+	LastActivity time.Time `json:"lastactivity"`
+	MessagesIn   uint64    `json:"messagesin"`
+	MessagesOut  uint64    `json:"messagesout"`
+	BytesIn      uint64    `json:"bytesin"`
+	BytesOut     uint64    `json:"bytesout"`
+	Attached     bool      `json:"attached"`
+}
+
 type Pipeline struct {
 	PipelineManager PipelineManager
 	mutex           sync.RWMutex
@@ -48,7 +66,15 @@ type Pipeline struct {
 	data            []*DataSinkOutgoing
 	sink            Sink
 	recvQueue       chan *DataIncoming
+	done            chan struct{} // Closed by Close to stop receiving.
 	closed          bool
+	monitors        map[string]*Session // Supervisor sessions receiving the messages.
+	created         time.Time
+	lastActivity    time.Time
+	messagesIn      uint64
+	messagesOut     uint64
+	bytesIn         uint64
+	bytesOut        uint64
 }
 
 func NewPipeline(manager PipelineManager,
@@ -62,7 +88,10 @@ func NewPipeline(manager PipelineManager,
 		id:              id,
 		from:            from,
 		recvQueue:       make(chan *DataIncoming, 100),
+		done:            make(chan struct{}),
+		created:         time.Now(),
 	}
+	pipeline.lastActivity = pipeline.created
 	go pipeline.receive()
 	pipeline.Refresh(duration)
 	return pipeline
@@ -71,16 +100,21 @@ func NewPipeline(manager PipelineManager,
 func (pipeline *Pipeline) receive() {
 	// TODO(longsleep): Call to ToSession() should be avoided because it locks.
 	api := pipeline.PipelineManager.GetChannellingAPI()
-	for data := range pipeline.recvQueue {
-		session := pipeline.ToSession()
-		reply, err := api.OnIncoming(nil, session, data)
-		if err != nil {
-			// TODO(longsleep): Handle reply and error.
-			log.Println("Pipeline receive incoming error", err)
+	for {
+		select {
+		case data := <-pipeline.recvQueue:
+			session := pipeline.ToSession()
+			reply, err := api.OnIncoming(nil, session, data)
+			if err != nil {
+				// TODO(longsleep): Handle reply and error.
+				log.Println("Pipeline receive incoming error", err)
+			}
+			api.OnIncomingProcessed(nil, session, data, reply, err)
+		case <-pipeline.done:
+			log.Println("Pipeline receive done")
+			return
 		}
-		api.OnIncomingProcessed(nil, session, data, reply, err)
 	}
-	log.Println("Pipeline receive done")
 }
 
 func (pipeline *Pipeline) GetID() string {
@@ -103,11 +137,51 @@ func (pipeline *Pipeline) Add(msg *DataSinkOutgoing) *Pipeline {
 	pipeline.mutex.Lock()
 	pipeline.data = append(pipeline.data, msg)
 	pipeline.refresh(30 * time.Second)
+	pipeline.messagesOut++
+	pipeline.lastActivity = time.Now()
 	pipeline.mutex.Unlock()
 
 	return pipeline
 }
 
+// CountIncoming records an incoming message of size bytes which was
+// received for this pipeline.
+func (pipeline *Pipeline) CountIncoming(size int) {
+	pipeline.mutex.Lock()
+	pipeline.messagesIn++
+	pipeline.bytesIn += uint64(size)
+	pipeline.lastActivity = time.Now()
+	pipeline.mutex.Unlock()
+}
+
+// Receive queues data received from the sink of the pipeline, which was
+// size bytes when encoded. It waits while the queue is full and drops data
+// once the pipeline is closed.
+func (pipeline *Pipeline) Receive(data *DataIncoming, size int) {
+	pipeline.CountIncoming(size)
+	select {
+	case <-pipeline.done:
+	case pipeline.recvQueue <- data:
+	}
+}
+
+func (pipeline *Pipeline) Stat() *PipelineStat {
+	pipeline.mutex.RLock()
+	defer pipeline.mutex.RUnlock()
+
+	return &PipelineStat{
+		Id:           pipeline.id,
+		Namespace:    pipeline.namespace,
+		Created:      pipeline.created,
+		LastActivity: pipeline.lastActivity,
+		MessagesIn:   pipeline.messagesIn,
+		MessagesOut:  pipeline.messagesOut,
+		BytesIn:      pipeline.bytesIn,
+		BytesOut:     pipeline.bytesOut,
+		Attached:     pipeline.sink != nil,
+	}
+}
+
 func (pipeline *Pipeline) Send(b buffercache.Buffer) {
 	// Noop.
 }
@@ -116,20 +190,97 @@ func (pipeline *Pipeline) Index() uint64 {
 	return 0
 }
 
-func (pipeline *Pipeline) Close() {
+// Close closes the pipeline and notifies the session which created the
+// pipeline and an attached sink with a PipelineClosed document containing
+// the given reason.
+func (pipeline *Pipeline) Close(reason string) {
 	pipeline.mutex.Lock()
-	if !pipeline.closed {
-		pipeline.expires = nil
-		if pipeline.sink != nil {
-			pipeline.sink = nil
+	if pipeline.closed {
+		pipeline.mutex.Unlock()
+		return
+	}
+	sink := pipeline.sink
+	fromSession := pipeline.from
+	toSession := pipeline.to
+	monitors := pipeline.monitors
+	pipeline.expires = nil
+	pipeline.sink = nil
+	pipeline.monitors = nil
+	close(pipeline.done)
+	pipeline.closed = true
+	pipeline.mutex.Unlock()
+	log.Println("Closed pipeline", pipeline.id, reason)
+
+	// Notify outside of lock, as writing to the sink might block.
+	closed := &DataPipelineClosed{
+		Type:   "PipelineClosed",
+		Id:     pipeline.id,
+		Reason: reason,
+	}
+	if sink != nil && sink.Enabled() {
+		sinkOutgoing := &DataSinkOutgoing{
+			Outgoing: &DataOutgoing{Data: closed},
+			Pipe:     pipeline.id,
 		}
-		close(pipeline.recvQueue)
-		pipeline.closed = true
-		log.Println("Closed pipeline")
+		if fromSession != nil {
+			sinkOutgoing.FromUserid = fromSession.Userid()
+		}
+		if toSession != nil {
+			sinkOutgoing.ToUserid = toSession.Userid()
+		}
+		sink.Write(sinkOutgoing)
+	}
+	if fromSession != nil {
+		outgoing := &DataOutgoing{
+			To:   fromSession.Id,
+			Data: closed,
+		}
+		if toSession != nil {
+			outgoing.From = toSession.Id
+		}
+		fromSession.Unicaster.Unicast(fromSession.Id, outgoing, nil)
+	}
+	for _, monitor := range monitors {
+		pipeline.notifyMonitor(monitor, fromSession, "", closed)
+	}
+}
+
+// AddMonitor lets the supervisor session receive all messages sent through
+// the pipeline, without the sessions of the call being told.
+func (pipeline *Pipeline) AddMonitor(session *Session) error {
+	pipeline.mutex.Lock()
+	defer pipeline.mutex.Unlock()
+	if pipeline.closed {
+		return errors.New("pipeline closed")
 	}
+	if pipeline.monitors == nil {
+		pipeline.monitors = make(map[string]*Session)
+	}
+	pipeline.monitors[session.Id] = session
+	return nil
+}
+
+// RemoveMonitor stops sending the messages of the pipeline to the
+// supervisor session sessionID.
+func (pipeline *Pipeline) RemoveMonitor(sessionID string) {
+	pipeline.mutex.Lock()
+	delete(pipeline.monitors, sessionID)
 	pipeline.mutex.Unlock()
 }
 
+func (pipeline *Pipeline) notifyMonitor(monitor, fromSession *Session, to string, data interface{}) {
+	event := &DataMonitorEvent{
+		Type:  "MonitorEvent",
+		Pipe:  pipeline.id,
+		To:    to,
+		Event: data,
+	}
+	if fromSession != nil {
+		event.From = fromSession.Id
+	}
+	monitor.Unicaster.Unicast(monitor.Id, &DataOutgoing{To: monitor.Id, Data: event}, nil)
+}
+
 func (pipeline *Pipeline) Expired() bool {
 	var expired bool
 	pipeline.mutex.RLock()
@@ -187,6 +338,17 @@ func (pipeline *Pipeline) JSONFeed(since, limit int) ([]byte, error) {
 
 func (pipeline *Pipeline) FlushOutgoing(hub Hub, client *Client, to string, outgoing *DataOutgoing) bool {
 	//log.Println("Flush outgoing via pipeline", to, client == nil)
+	pipeline.mutex.RLock()
+	var monitors []*Session
+	for _, monitor := range pipeline.monitors {
+		monitors = append(monitors, monitor)
+	}
+	from := pipeline.from
+	pipeline.mutex.RUnlock()
+	for _, monitor := range monitors {
+		pipeline.notifyMonitor(monitor, from, to, outgoing.Data)
+	}
+
 	if client == nil {
 		sinkOutgoing := &DataSinkOutgoing{
 			Outgoing: outgoing,
@@ -212,7 +374,7 @@ func (pipeline *Pipeline) FlushOutgoing(hub Hub, client *Client, to string, outg
 					pipeline.mutex.Unlock()
 
 					// Create incoming receiver.
-					sink.BindRecvChan(pipeline.recvQueue)
+					sink.BindRecv(pipeline)
 
 					// Sink it.
 					break
@@ -234,7 +396,11 @@ func (pipeline *Pipeline) FlushOutgoing(hub Hub, client *Client, to string, outg
 
 		if sink != nil {
 			// Pipelined, sink data.
-			sink.Write(sinkOutgoing)
+			if size, err := sink.Write(sinkOutgoing); err == nil {
+				pipeline.mutex.Lock()
+				pipeline.bytesOut += uint64(size)
+				pipeline.mutex.Unlock()
+			}
 			return true
 		}
 	}
@@ -252,7 +418,9 @@ func (pipeline *Pipeline) Attach(sink Sink) error {
 	if err == nil {
 		for _, msg := range pipeline.data {
 			log.Println("Flushing pipeline to sink after attach", len(pipeline.data))
-			sink.Write(msg)
+			if size, err := sink.Write(msg); err == nil {
+				pipeline.bytesOut += uint64(size)
+			}
 		}
 	}
 
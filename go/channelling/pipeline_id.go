@@ -0,0 +1,140 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package channelling
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+const (
+	// PipelineIDSchemePlain joins the parts with dots as is. IDs collide
+	// when parts contain dots.
+	PipelineIDSchemePlain = "plain"
+	// PipelineIDSchemeEscaped joins escaped parts with dots. IDs are
+	// reversible and safe for bus subjects and URL path segments.
+	PipelineIDSchemeEscaped = "escaped"
+	// PipelineIDSchemeOpaque uses a hash of the escaped ID. The parts can
+	// only be looked up through the pipeline manager.
+	PipelineIDSchemeOpaque = "opaque"
+)
+
+const pipelineIDEscape = '~'
+
+var errInvalidPipelineID = errors.New("invalid pipeline id")
+
+// PipelineKey holds the parts a pipeline ID is made of.
+type PipelineKey struct {
+	Namespace string `json:"namespace"`
+	From      string `json:"from"`
+	To        string `json:"to"`
+}
+
+func isPipelineIDSafe(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_'
+}
+
+// EscapePipelineIDPart replaces all bytes which are not letters, digits,
+// '-' or '_' with '~' followed by two hex digits.
+func EscapePipelineIDPart(s string) string {
+	n := 0
+	for i := 0; i < len(s); i++ {
+		if !isPipelineIDSafe(s[i]) {
+			n++
+		}
+	}
+	if n == 0 {
+		return s
+	}
+
+	const hexDigits = "0123456789ABCDEF"
+	b := make([]byte, 0, len(s)+2*n)
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if isPipelineIDSafe(c) {
+			b = append(b, c)
+		} else {
+			b = append(b, pipelineIDEscape, hexDigits[c>>4], hexDigits[c&15])
+		}
+	}
+	return string(b)
+}
+
+// UnescapePipelineIDPart reverses EscapePipelineIDPart.
+func UnescapePipelineIDPart(s string) (string, error) {
+	if strings.IndexByte(s, pipelineIDEscape) == -1 {
+		return s, nil
+	}
+
+	b := make([]byte, 0, len(s))
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c != pipelineIDEscape {
+			b = append(b, c)
+			continue
+		}
+		if i+2 >= len(s) {
+			return "", errInvalidPipelineID
+		}
+		v, err := strconv.ParseUint(s[i+1:i+3], 16, 8)
+		if err != nil {
+			return "", errInvalidPipelineID
+		}
+		b = append(b, byte(v))
+		i += 2
+	}
+	return string(b), nil
+}
+
+// MakePipelineID returns the pipeline ID for key using scheme. Unknown
+// schemes are treated like PipelineIDSchemePlain, the default.
+func MakePipelineID(scheme string, key *PipelineKey) string {
+	switch scheme {
+	case PipelineIDSchemeEscaped:
+		return EscapePipelineIDPart(key.Namespace) + "." + EscapePipelineIDPart(key.From) + "." + EscapePipelineIDPart(key.To)
+	case PipelineIDSchemeOpaque:
+		sum := sha256.Sum256([]byte(MakePipelineID(PipelineIDSchemeEscaped, key)))
+		return EscapePipelineIDPart(key.Namespace) + "." + hex.EncodeToString(sum[:16])
+	}
+	return key.Namespace + "." + key.From + "." + key.To
+}
+
+// ParsePipelineID returns the key of an ID created with the escaped
+// scheme. Plain IDs parse as well, as long as none of their parts contain
+// dots or the escape character.
+func ParsePipelineID(id string) (*PipelineKey, error) {
+	parts := strings.Split(id, ".")
+	if len(parts) != 3 {
+		return nil, errInvalidPipelineID
+	}
+	for i, part := range parts {
+		unescaped, err := UnescapePipelineIDPart(part)
+		if err != nil {
+			return nil, err
+		}
+		parts[i] = unescaped
+	}
+	return &PipelineKey{parts[0], parts[1], parts[2]}, nil
+}
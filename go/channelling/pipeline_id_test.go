@@ -0,0 +1,80 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package channelling
+
+import (
+	"testing"
+)
+
+func Test_PipelineIDEscapedIsReversible(t *testing.T) {
+	keys := []*PipelineKey{
+		{"call", "abc", "def"},
+		{"call", "a.b", "c"},
+		{"call", "a", "b.c"},
+		{"call", "a~2Eb", "c/d?e=f"},
+		{"call", "", ""},
+	}
+	seen := make(map[string]bool)
+	for _, key := range keys {
+		id := MakePipelineID(PipelineIDSchemeEscaped, key)
+		if seen[id] {
+			t.Errorf("Pipeline ID %s collides", id)
+		}
+		seen[id] = true
+
+		parsed, err := ParsePipelineID(id)
+		if err != nil {
+			t.Errorf("Could not parse %s: %v", id, err)
+			continue
+		}
+		if *parsed != *key {
+			t.Errorf("Parsed key %v does not match %v", parsed, key)
+		}
+	}
+}
+
+func Test_PipelineIDOpaqueHidesParts(t *testing.T) {
+	id := MakePipelineID(PipelineIDSchemeOpaque, &PipelineKey{"call", "from-session", "to-session"})
+	if id != MakePipelineID(PipelineIDSchemeOpaque, &PipelineKey{"call", "from-session", "to-session"}) {
+		t.Errorf("Opaque pipeline ID %s is not stable", id)
+	}
+	if _, err := ParsePipelineID(id); err == nil {
+		t.Errorf("Opaque pipeline ID %s should not parse", id)
+	}
+}
+
+func Test_UnescapePipelineIDPartInvalid(t *testing.T) {
+	for _, s := range []string{"~", "~2", "a~ZZ"} {
+		if _, err := UnescapePipelineIDPart(s); err == nil {
+			t.Errorf("Unescaping %s should fail", s)
+		}
+	}
+}
+
+func Test_PipelineIDPlainIsDefault(t *testing.T) {
+	key := &PipelineKey{"call", "a.b", "c"}
+	for _, scheme := range []string{"", PipelineIDSchemePlain} {
+		if id := MakePipelineID(scheme, key); id != "call.a.b.c" {
+			t.Errorf("Unexpected pipeline ID %s for scheme %q", id, scheme)
+		}
+	}
+}
@@ -22,9 +22,11 @@
 package channelling
 
 import (
-	"fmt"
 	"log"
+	"math/rand"
+	"runtime"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -32,42 +34,90 @@ const (
 	PipelineNamespaceCall = "call"
 )
 
+const (
+	defaultPipelinesCleanupInterval  = 30 * time.Second
+	defaultPipelinesCleanupChunkSize = 100
+)
+
+type PipelineStats interface {
+	PipelineInfo(details bool) (count int, cleanup *PipelineCleanupStat, pipelines map[string]*PipelineStat)
+}
+
+// PipelineCleanupStat contains metrics of the periodic pipeline expiry
+// scan. Durations are in nanoseconds.
+type PipelineCleanupStat struct {
+	Runs          uint64        `json:"runs"`
+	Expired       uint64        `json:"expired"`
+	LastDuration  time.Duration `json:"lastduration"`
+	MaxDuration   time.Duration `json:"maxduration"`
+	TotalDuration time.Duration `json:"totalduration"`
+}
+
 type PipelineManager interface {
 	BusManager
 	SessionStore
 	UserStore
 	SessionCreator
+	PipelineStats
 	GetPipelineByID(id string) (pipeline *Pipeline, ok bool)
+	PipelineKeyByID(id string) (key *PipelineKey, ok bool)
 	GetPipeline(namespace string, sender Sender, session *Session, to string) *Pipeline
 	FindSinkAndSession(to string) (Sink, *Session)
+	SnapshotSessions() []*SessionCreateRequest
+	RestoreSessions(requests []*SessionCreateRequest)
 }
 
 type pipelineManager struct {
+	// Cleanup counters are accessed atomically and need to be first for
+	// 64-bit alignment on 32-bit platforms.
+	cleanupRuns    uint64
+	cleanupExpired uint64
+	cleanupLast    int64
+	cleanupMax     int64
+	cleanupTotal   int64
 	BusManager
 	SessionStore
 	UserStore
 	SessionCreator
 	mutex               sync.RWMutex
 	pipelineTable       map[string]*Pipeline
+	pipelineKeyTable    map[string]*PipelineKey
 	sessionTable        map[string]*Session
 	sessionByBusIDTable map[string]*Session
+	sessionRequestTable map[string]*SessionCreateRequest
 	sessionSinkTable    map[string]Sink
 	duration            time.Duration
 	defaultSinkID       string
 	enabled             bool
+	cleanupInterval     time.Duration
+	cleanupJitter       time.Duration
+	cleanupChunkSize    int
+	idScheme            string
 }
 
-func NewPipelineManager(busManager BusManager, sessionStore SessionStore, userStore UserStore, sessionCreator SessionCreator) PipelineManager {
+func NewPipelineManager(config *Config, busManager BusManager, sessionStore SessionStore, userStore UserStore, sessionCreator SessionCreator) PipelineManager {
 	plm := &pipelineManager{
 		BusManager:          busManager,
 		SessionStore:        sessionStore,
 		UserStore:           userStore,
 		SessionCreator:      sessionCreator,
 		pipelineTable:       make(map[string]*Pipeline),
+		pipelineKeyTable:    make(map[string]*PipelineKey),
 		sessionTable:        make(map[string]*Session),
 		sessionByBusIDTable: make(map[string]*Session),
+		sessionRequestTable: make(map[string]*SessionCreateRequest),
 		sessionSinkTable:    make(map[string]Sink),
 		duration:            60 * time.Second,
+		cleanupInterval:     config.PipelinesCleanupInterval,
+		cleanupJitter:       config.PipelinesCleanupJitter,
+		cleanupChunkSize:    config.PipelinesCleanupChunkSize,
+		idScheme:            config.PipelinesIDScheme,
+	}
+	if plm.cleanupInterval <= 0 {
+		plm.cleanupInterval = defaultPipelinesCleanupInterval
+	}
+	if plm.cleanupChunkSize <= 0 {
+		plm.cleanupChunkSize = defaultPipelinesCleanupChunkSize
 	}
 
 	return plm
@@ -82,26 +132,105 @@ func (plm *pipelineManager) Start() {
 	plm.Subscribe("channelling.session.close", plm.sessionClose)
 }
 
+// cleanup removes expired pipelines. The pipeline table is only locked
+// for one chunk at a time, so that a large table does not block
+// concurrent pipeline lookups for the whole scan.
 func (plm *pipelineManager) cleanup() {
-	plm.mutex.Lock()
-	for id, pipeline := range plm.pipelineTable {
-		if pipeline.Expired() {
-			pipeline.Close()
-			delete(plm.pipelineTable, id)
+	started := time.Now()
+
+	plm.mutex.RLock()
+	ids := make([]string, 0, len(plm.pipelineTable))
+	for id := range plm.pipelineTable {
+		ids = append(ids, id)
+	}
+	plm.mutex.RUnlock()
+
+	var expired []*Pipeline
+	var count uint64
+	for len(ids) > 0 {
+		size := plm.cleanupChunkSize
+		if size > len(ids) {
+			size = len(ids)
+		}
+		plm.mutex.Lock()
+		for _, id := range ids[:size] {
+			if pipeline, ok := plm.pipelineTable[id]; ok && pipeline.Expired() {
+				delete(plm.pipelineTable, id)
+				delete(plm.pipelineKeyTable, id)
+				expired = append(expired, pipeline)
+			}
+		}
+		plm.mutex.Unlock()
+		ids = ids[size:]
+
+		// Close outside of the lock, closing might block on the sink.
+		for _, pipeline := range expired {
+			pipeline.Close(PipelineCloseReasonExpired)
+		}
+		count += uint64(len(expired))
+		expired = expired[:0]
+
+		// Give others a chance to get the lock before the next chunk.
+		runtime.Gosched()
+	}
+
+	duration := int64(time.Since(started))
+	atomic.AddUint64(&plm.cleanupRuns, 1)
+	atomic.AddUint64(&plm.cleanupExpired, count)
+	atomic.StoreInt64(&plm.cleanupLast, duration)
+	atomic.AddInt64(&plm.cleanupTotal, duration)
+	for {
+		max := atomic.LoadInt64(&plm.cleanupMax)
+		if duration <= max || atomic.CompareAndSwapInt64(&plm.cleanupMax, max, duration) {
+			break
 		}
 	}
-	plm.mutex.Unlock()
+}
+
+// cleanupDelay returns the time to wait until the next cleanup run. The
+// random jitter avoids that multiple instances scan in lock step.
+func (plm *pipelineManager) cleanupDelay() time.Duration {
+	delay := plm.cleanupInterval
+	if plm.cleanupJitter > 0 {
+		delay += time.Duration(rand.Int63n(int64(plm.cleanupJitter)))
+	}
+	return delay
 }
 
 func (plm *pipelineManager) start() {
-	c := time.Tick(30 * time.Second)
 	go func() {
-		for _ = range c {
+		// The timer is only reset once a run has completed, so slow
+		// runs delay the next run instead of piling up.
+		timer := time.NewTimer(plm.cleanupDelay())
+		for range timer.C {
 			plm.cleanup()
+			timer.Reset(plm.cleanupDelay())
 		}
 	}()
 }
 
+func (plm *pipelineManager) PipelineInfo(details bool) (count int, cleanup *PipelineCleanupStat, pipelines map[string]*PipelineStat) {
+	plm.mutex.RLock()
+	count = len(plm.pipelineTable)
+	if details {
+		pipelines = make(map[string]*PipelineStat)
+		for id, pipeline := range plm.pipelineTable {
+			pipelines[id] = pipeline.Stat()
+		}
+	}
+	plm.mutex.RUnlock()
+
+	cleanup = &PipelineCleanupStat{
+		Runs:          atomic.LoadUint64(&plm.cleanupRuns),
+		Expired:       atomic.LoadUint64(&plm.cleanupExpired),
+		LastDuration:  time.Duration(atomic.LoadInt64(&plm.cleanupLast)),
+		MaxDuration:   time.Duration(atomic.LoadInt64(&plm.cleanupMax)),
+		TotalDuration: time.Duration(atomic.LoadInt64(&plm.cleanupTotal)),
+	}
+
+	return
+}
+
 func (plm *pipelineManager) sessionCreate(subject, reply string, msg *SessionCreateRequest) {
 	log.Println("sessionCreate via NATS", subject, reply, msg)
 
@@ -122,6 +251,7 @@ func (plm *pipelineManager) sessionCreate(subject, reply string, msg *SessionCre
 	}
 	session = plm.CreateSession(nil, "")
 	plm.sessionByBusIDTable[msg.Id] = session
+	plm.sessionRequestTable[msg.Id] = msg
 	plm.sessionTable[session.Id] = session
 	if sink == nil {
 		sink = plm.CreateSink(msg.Id)
@@ -148,7 +278,7 @@ func (plm *pipelineManager) sessionCreate(subject, reply string, msg *SessionCre
 	}
 
 	if msg.Room != nil {
-		room, err := session.JoinRoom(msg.Room.Name, msg.Room.Type, msg.Room.Credentials, nil)
+		room, err := session.JoinRoom(msg.Room.Name, msg.Room.Type, "", msg.Room.Credentials, nil)
 		log.Println("Joined NATS session to room", room, err)
 	}
 
@@ -166,6 +296,7 @@ func (plm *pipelineManager) sessionClose(subject, reply string, id string) {
 	session, ok := plm.sessionByBusIDTable[id]
 	if ok {
 		delete(plm.sessionByBusIDTable, id)
+		delete(plm.sessionRequestTable, id)
 		delete(plm.sessionTable, session.Id)
 		if sink, ok := plm.sessionSinkTable[session.Id]; ok {
 			delete(plm.sessionSinkTable, session.Id)
@@ -179,6 +310,39 @@ func (plm *pipelineManager) sessionClose(subject, reply string, id string) {
 	}
 }
 
+// SnapshotSessions returns requests which recreate the sessions created
+// through the bus with their current status.
+func (plm *pipelineManager) SnapshotSessions() []*SessionCreateRequest {
+	plm.mutex.RLock()
+	defer plm.mutex.RUnlock()
+	requests := make([]*SessionCreateRequest, 0, len(plm.sessionRequestTable))
+	for id, msg := range plm.sessionRequestTable {
+		session, ok := plm.sessionByBusIDTable[id]
+		if !ok {
+			continue
+		}
+		data := session.Data()
+		requests = append(requests, &SessionCreateRequest{
+			Id: id,
+			Session: &DataSession{
+				Userid: msg.Session.Userid,
+				Status: data.Status,
+			},
+			Room:         msg.Room,
+			SetAsDefault: plm.defaultSinkID == session.Id,
+		})
+	}
+	return requests
+}
+
+// RestoreSessions recreates sessions from the requests of a snapshot. The
+// sessions get new ids but keep their bus ids and sinks.
+func (plm *pipelineManager) RestoreSessions(requests []*SessionCreateRequest) {
+	for _, msg := range requests {
+		plm.sessionCreate("", "", msg)
+	}
+}
+
 func (plm *pipelineManager) GetPipelineByID(id string) (*Pipeline, bool) {
 	plm.mutex.RLock()
 	pipeline, ok := plm.pipelineTable[id]
@@ -186,8 +350,17 @@ func (plm *pipelineManager) GetPipelineByID(id string) (*Pipeline, bool) {
 	return pipeline, ok
 }
 
+// PipelineKeyByID returns the parts of a known pipeline ID. This works
+// with all ID schemes, including opaque IDs.
+func (plm *pipelineManager) PipelineKeyByID(id string) (*PipelineKey, bool) {
+	plm.mutex.RLock()
+	key, ok := plm.pipelineKeyTable[id]
+	plm.mutex.RUnlock()
+	return key, ok
+}
+
 func (plm *pipelineManager) PipelineID(namespace string, sender Sender, session *Session, to string) string {
-	return fmt.Sprintf("%s.%s.%s", namespace, session.Id, to)
+	return MakePipelineID(plm.idScheme, &PipelineKey{namespace, session.Id, to})
 }
 
 func (plm *pipelineManager) GetPipeline(namespace string, sender Sender, session *Session, to string) *Pipeline {
@@ -209,6 +382,7 @@ func (plm *pipelineManager) GetPipeline(namespace string, sender Sender, session
 	log.Println("Creating pipeline", namespace, id)
 	pipeline = NewPipeline(plm, namespace, id, session, plm.duration)
 	plm.pipelineTable[id] = pipeline
+	plm.pipelineKeyTable[id] = &PipelineKey{namespace, session.Id, to}
 	plm.mutex.Unlock()
 
 	return pipeline
@@ -0,0 +1,160 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package channelling
+
+import (
+	"log"
+	"sync"
+
+	"github.com/nats-io/nats"
+)
+
+const (
+	presenceUpdateSubject = "channelling.presence.update"
+	presenceSyncSubject   = "channelling.presence.sync"
+)
+
+// A UserPresence keeps the number of sessions per user on the other nodes
+// of the cluster in sync. Every node publishes its own count whenever it
+// changes and answers sync requests of new nodes with all of its counts.
+type UserPresence interface {
+	Start() error
+	Stop()
+	SetLocalUserSessions(userid string, count int)
+	RemoteUserSessions(userid string) int
+}
+
+type presenceUpdate struct {
+	Node   string
+	Userid string `json:",omitempty"`
+	Count  int    `json:",omitempty"`
+}
+
+type userPresence struct {
+	sync.RWMutex
+	BusManager
+	cluster       Cluster
+	local         map[string]int
+	remote        map[string]map[string]int // Map of node -> userid -> count.
+	subscriptions []*nats.Subscription
+}
+
+// NewUserPresence creates a UserPresence which only counts sessions of
+// nodes known to cluster, so counts of nodes which went away are ignored.
+func NewUserPresence(cluster Cluster, busManager BusManager) UserPresence {
+	return &userPresence{
+		BusManager: busManager,
+		cluster:    cluster,
+		local:      make(map[string]int),
+		remote:     make(map[string]map[string]int),
+	}
+}
+
+func (presence *userPresence) Start() error {
+	for subject, cb := range map[string]nats.Handler{
+		presenceUpdateSubject: presence.updateReceived,
+		presenceSyncSubject:   presence.syncReceived,
+	} {
+		sub, err := presence.Subscribe(BusSubject(BusProtocolVersion, subject), cb)
+		if err != nil {
+			presence.Stop()
+			return err
+		}
+		if sub != nil {
+			presence.subscriptions = append(presence.subscriptions, sub)
+		}
+	}
+	return presence.Publish(BusSubject(BusProtocolVersion, presenceSyncSubject), &presenceUpdate{Node: presence.cluster.Self()})
+}
+
+func (presence *userPresence) Stop() {
+	for _, sub := range presence.subscriptions {
+		sub.Unsubscribe()
+	}
+	presence.subscriptions = nil
+}
+
+func (presence *userPresence) SetLocalUserSessions(userid string, count int) {
+	presence.Lock()
+	if count > 0 {
+		presence.local[userid] = count
+	} else {
+		delete(presence.local, userid)
+	}
+	presence.Unlock()
+
+	if err := presence.Publish(BusSubject(BusProtocolVersion, presenceUpdateSubject), &presenceUpdate{presence.cluster.Self(), userid, count}); err != nil {
+		log.Println("Failed to publish presence update", err)
+	}
+}
+
+// RemoteUserSessions returns the number of sessions of userid on all
+// other nodes of the cluster.
+func (presence *userPresence) RemoteUserSessions(userid string) int {
+	presence.Lock()
+	defer presence.Unlock()
+	count := 0
+	for node, counts := range presence.remote {
+		if _, ok := presence.cluster.Node(node); !ok {
+			delete(presence.remote, node)
+			continue
+		}
+		count += counts[userid]
+	}
+	return count
+}
+
+func (presence *userPresence) updateReceived(update *presenceUpdate) {
+	if update == nil || update.Node == "" || update.Node == presence.cluster.Self() || update.Userid == "" {
+		return
+	}
+	presence.Lock()
+	defer presence.Unlock()
+	counts, ok := presence.remote[update.Node]
+	if !ok {
+		counts = make(map[string]int)
+		presence.remote[update.Node] = counts
+	}
+	if update.Count > 0 {
+		counts[update.Userid] = update.Count
+	} else {
+		delete(counts, update.Userid)
+	}
+}
+
+func (presence *userPresence) syncReceived(request *presenceUpdate) {
+	if request == nil || request.Node == presence.cluster.Self() {
+		return
+	}
+	presence.RLock()
+	updates := make([]*presenceUpdate, 0, len(presence.local))
+	for userid, count := range presence.local {
+		updates = append(updates, &presenceUpdate{presence.cluster.Self(), userid, count})
+	}
+	presence.RUnlock()
+	for _, update := range updates {
+		if err := presence.Publish(BusSubject(BusProtocolVersion, presenceUpdateSubject), update); err != nil {
+			log.Println("Failed to publish presence update", err)
+			return
+		}
+	}
+}
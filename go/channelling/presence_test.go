@@ -0,0 +1,52 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package channelling
+
+import (
+	"testing"
+)
+
+func Test_UserPresence_RemoteUserSessions_SumsKnownNodes(t *testing.T) {
+	cluster := NewTestCluster()
+	cluster.heartbeatReceived(&ClusterNode{Id: "a"})
+	cluster.heartbeatReceived(&ClusterNode{Id: "c"})
+	presence := NewUserPresence(cluster, cluster.BusManager).(*userPresence)
+
+	presence.SetLocalUserSessions("u1", 3)
+	presence.updateReceived(&presenceUpdate{"a", "u1", 1})
+	presence.updateReceived(&presenceUpdate{"c", "u1", 2})
+	presence.updateReceived(&presenceUpdate{"b", "u1", 5})
+	presence.updateReceived(&presenceUpdate{"d", "u1", 7})
+	if count := presence.RemoteUserSessions("u1"); count != 3 {
+		t.Errorf("Expected 3 remote sessions, but got %d", count)
+	}
+
+	presence.updateReceived(&presenceUpdate{"c", "u1", 0})
+	if count := presence.RemoteUserSessions("u1"); count != 1 {
+		t.Errorf("Expected 1 remote session, but got %d", count)
+	}
+
+	cluster.leaveReceived(&ClusterNode{Id: "a"})
+	if count := presence.RemoteUserSessions("u1"); count != 0 {
+		t.Errorf("Expected sessions of nodes which left to be ignored, but got %d", count)
+	}
+}
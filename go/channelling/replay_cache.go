@@ -0,0 +1,95 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package channelling
+
+import (
+	"crypto/sha256"
+	"log"
+	"sync"
+	"time"
+)
+
+const (
+	maxReplayCacheEntries = 100000          // Default maximum number of remembered tokens.
+	replayCachePrune      = 1 * time.Minute // Interval to drop expired tokens.
+)
+
+// ReplayCache remembers used one-time tokens until they expire, so captured
+// tokens cannot be used again.
+type ReplayCache interface {
+	// Use marks token as used until expires. It returns false if token was
+	// used before, or if the cache is full.
+	Use(token string, expires time.Time) bool
+}
+
+type replayCache struct {
+	sync.Mutex
+	tokens     map[[sha256.Size]byte]time.Time
+	maxEntries int
+	pruned     time.Time
+}
+
+// NewReplayCache creates a ReplayCache for up to maxEntries unexpired
+// tokens. Tokens are rejected while the cache is full, as they cannot be
+// remembered.
+func NewReplayCache(maxEntries int) ReplayCache {
+	if maxEntries <= 0 {
+		maxEntries = maxReplayCacheEntries
+	}
+	return &replayCache{
+		tokens:     make(map[[sha256.Size]byte]time.Time),
+		maxEntries: maxEntries,
+		pruned:     time.Now(),
+	}
+}
+
+func (cache *replayCache) Use(token string, expires time.Time) bool {
+	return cache.use(token, expires, time.Now())
+}
+
+func (cache *replayCache) use(token string, expires, now time.Time) bool {
+	key := sha256.Sum256([]byte(token))
+
+	cache.Lock()
+	defer cache.Unlock()
+	if now.Sub(cache.pruned) >= replayCachePrune || len(cache.tokens) >= cache.maxEntries {
+		cache.prune(now)
+	}
+	if until, ok := cache.tokens[key]; ok && now.Before(until) {
+		return false
+	}
+	if len(cache.tokens) >= cache.maxEntries {
+		log.Println("Replay cache is full, rejecting token")
+		return false
+	}
+	cache.tokens[key] = expires
+	return true
+}
+
+func (cache *replayCache) prune(now time.Time) {
+	for key, until := range cache.tokens {
+		if !now.Before(until) {
+			delete(cache.tokens, key)
+		}
+	}
+	cache.pruned = now
+}
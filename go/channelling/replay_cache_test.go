@@ -0,0 +1,62 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package channelling
+
+import (
+	"testing"
+	"time"
+)
+
+func Test_ReplayCache_RejectsUsedTokens(t *testing.T) {
+	cache := NewReplayCache(10).(*replayCache)
+	now := time.Now()
+
+	if !cache.use("a", now.Add(time.Minute), now) {
+		t.Fatal("Expected first use to be accepted")
+	}
+	if cache.use("a", now.Add(time.Minute), now.Add(time.Second)) {
+		t.Error("Expected replayed token to be rejected")
+	}
+	if !cache.use("b", now.Add(time.Minute), now.Add(time.Second)) {
+		t.Error("Expected other token to be accepted")
+	}
+	if !cache.use("a", now.Add(2*time.Minute), now.Add(time.Minute)) {
+		t.Error("Expected token to be accepted again once expired")
+	}
+}
+
+func Test_ReplayCache_RejectsTokensWhenFull(t *testing.T) {
+	cache := NewReplayCache(2).(*replayCache)
+	now := time.Now()
+
+	cache.use("a", now.Add(time.Second), now)
+	cache.use("b", now.Add(time.Minute), now)
+	if cache.use("c", now.Add(time.Minute), now) {
+		t.Error("Expected token to be rejected while the cache is full")
+	}
+	if !cache.use("c", now.Add(time.Minute), now.Add(2*time.Second)) {
+		t.Error("Expected token to be accepted once expired tokens were pruned")
+	}
+	if len(cache.tokens) != 2 {
+		t.Errorf("Expected 2 remembered tokens, but got %d", len(cache.tokens))
+	}
+}
@@ -0,0 +1,224 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package channelling
+
+import (
+	"bufio"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"strings"
+)
+
+// Sources of resource limits.
+const (
+	ResourceLimitsHost    = "host"
+	ResourceLimitsCgroup1 = "cgroup1"
+	ResourceLimitsCgroup2 = "cgroup2"
+)
+
+// Memory limits of cgroup v1 at or above this are unlimited, the kernel
+// reports the largest page aligned value instead of a marker.
+const cgroup1Unlimited = uint64(1) << 62
+
+// GC percent in a memory limited container, the heap then grows to 1.5
+// times the live heap instead of twice before collecting.
+const limitedGCPercent = 50
+
+// ResourceLimits are the CPU and memory limits of the container the server
+// runs in, and the runtime settings derived from them.
+type ResourceLimits struct {
+	Source     string  `json:"source"`
+	HostCPUs   int     `json:"hostcpus"`
+	CPUs       float64 `json:"cpus"`   // CPU quota, 0 if unlimited.
+	Memory     uint64  `json:"memory"` // Memory limit in bytes, 0 if unlimited.
+	GOMAXPROCS int     `json:"gomaxprocs"`
+	GCPercent  int     `json:"gcpercent"`
+}
+
+// DetectResourceLimits reads the cgroup limits of the current process. It
+// returns host limits when no cgroup limits are found.
+func DetectResourceLimits() *ResourceLimits {
+	return readResourceLimits("/sys/fs/cgroup", "/proc/self/cgroup")
+}
+
+func readResourceLimits(root, self string) *ResourceLimits {
+	limits := &ResourceLimits{
+		Source:    ResourceLimitsHost,
+		HostCPUs:  runtime.NumCPU(),
+		GCPercent: 100,
+	}
+	paths := readCgroupPaths(self)
+	if _, err := os.Stat(filepath.Join(root, "cgroup.controllers")); err == nil {
+		// Unified hierarchy, limits may be set on any parent up to the root.
+		for dir := filepath.Join(root, paths[""]); ; dir = filepath.Dir(dir) {
+			if limits.CPUs == 0 {
+				limits.CPUs = readCgroup2CPUs(filepath.Join(dir, "cpu.max"))
+			}
+			if limits.Memory == 0 {
+				limits.Memory = readCgroupBytes(filepath.Join(dir, "memory.max"))
+			}
+			if len(dir) <= len(root) {
+				break
+			}
+		}
+		if limits.CPUs > 0 || limits.Memory > 0 {
+			limits.Source = ResourceLimitsCgroup2
+		}
+		return limits
+	}
+	for _, dir := range cgroup1Dirs(root, "cpu", paths["cpu"]) {
+		quota := readCgroupInt(filepath.Join(dir, "cpu.cfs_quota_us"))
+		period := readCgroupInt(filepath.Join(dir, "cpu.cfs_period_us"))
+		if quota > 0 && period > 0 {
+			limits.CPUs = float64(quota) / float64(period)
+			break
+		}
+	}
+	for _, dir := range cgroup1Dirs(root, "memory", paths["memory"]) {
+		if memory := readCgroupBytes(filepath.Join(dir, "memory.limit_in_bytes")); memory > 0 && memory < cgroup1Unlimited {
+			limits.Memory = memory
+			break
+		}
+	}
+	if limits.CPUs > 0 || limits.Memory > 0 {
+		limits.Source = ResourceLimitsCgroup1
+	}
+	return limits
+}
+
+// Processors returns the number of processors to use, the CPU quota
+// rounded up but at most the CPUs of the host.
+func (limits *ResourceLimits) Processors() int {
+	if limits.CPUs <= 0 || int(math.Ceil(limits.CPUs)) >= limits.HostCPUs {
+		return limits.HostCPUs
+	}
+	return int(math.Ceil(limits.CPUs))
+}
+
+// Workers returns the size of worker pools which run CPU bound work.
+func (limits *ResourceLimits) Workers() int {
+	return 2 * limits.Processors()
+}
+
+// MemoryThresholds returns heap sizes in bytes to shed anonymous
+// connections, rooms and calls at, leaving room below the memory limit for
+// stacks, buffers and garbage. All are zero without a memory limit.
+func (limits *ResourceLimits) MemoryThresholds() (anonymous, rooms, calls uint64) {
+	return limits.Memory / 10 * 5, limits.Memory / 10 * 6, limits.Memory / 10 * 7
+}
+
+// Apply sets GOMAXPROCS and the GC percent from the limits, unless they
+// were set with the GOMAXPROCS and GOGC environment variables.
+func (limits *ResourceLimits) Apply() {
+	if os.Getenv("GOMAXPROCS") == "" {
+		runtime.GOMAXPROCS(limits.Processors())
+	}
+	limits.GOMAXPROCS = runtime.GOMAXPROCS(0)
+	if os.Getenv("GOGC") == "" && limits.Memory > 0 {
+		debug.SetGCPercent(limitedGCPercent)
+	}
+	// SetGCPercent returns the previous setting, restore it after reading.
+	limits.GCPercent = debug.SetGCPercent(100)
+	debug.SetGCPercent(limits.GCPercent)
+}
+
+// readCgroupPaths returns the cgroup of the process by controller, the
+// unified hierarchy has the empty controller.
+func readCgroupPaths(self string) map[string]string {
+	paths := make(map[string]string)
+	file, err := os.Open(self)
+	if err != nil {
+		return paths
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		// Lines are hierarchy-ID:controller-list:cgroup-path.
+		parts := strings.SplitN(scanner.Text(), ":", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		for _, controller := range strings.Split(parts[1], ",") {
+			paths[controller] = parts[2]
+		}
+	}
+	return paths
+}
+
+// cgroup1Dirs returns the directories to look for limits of a controller.
+// Containers usually see their own cgroup at the mount point, while the
+// process cgroup is only found below it on the host.
+func cgroup1Dirs(root, controller, path string) []string {
+	dirs := []string{}
+	if path != "" && path != "/" {
+		dirs = append(dirs, filepath.Join(root, controller, path))
+	}
+	return append(dirs, filepath.Join(root, controller))
+}
+
+func readCgroupFile(name string) string {
+	data, err := ioutil.ReadFile(name)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+func readCgroupInt(name string) int64 {
+	value, err := strconv.ParseInt(readCgroupFile(name), 10, 64)
+	if err != nil {
+		return 0
+	}
+	return value
+}
+
+// readCgroupBytes returns a memory limit, 0 if the file is missing or has
+// no limit ("max").
+func readCgroupBytes(name string) uint64 {
+	value, err := strconv.ParseUint(readCgroupFile(name), 10, 64)
+	if err != nil {
+		return 0
+	}
+	return value
+}
+
+// readCgroup2CPUs parses cpu.max with "quota period" or "max period".
+func readCgroup2CPUs(name string) float64 {
+	fields := strings.Fields(readCgroupFile(name))
+	if len(fields) != 2 {
+		return 0
+	}
+	quota, err := strconv.ParseInt(fields[0], 10, 64)
+	if err != nil || quota <= 0 {
+		return 0
+	}
+	period, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil || period <= 0 {
+		return 0
+	}
+	return float64(quota) / float64(period)
+}
@@ -0,0 +1,114 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+package channelling
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func writeCgroupFiles(t *testing.T, files map[string]string) string {
+	root, err := ioutil.TempDir("", "cgroup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range files {
+		name = filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(name, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+func Test_ResourceLimits_Cgroup2(t *testing.T) {
+	root := writeCgroupFiles(t, map[string]string{
+		"proc/self/cgroup":                    "0::/app.slice/server.service\n",
+		"fs/cgroup.controllers":               "cpu memory\n",
+		"fs/cpu.max":                          "max 100000\n",
+		"fs/memory.max":                       "max\n",
+		"fs/app.slice/memory.max":             "536870912\n",
+		"fs/app.slice/server.service/cpu.max": "150000 100000\n",
+	})
+	defer os.RemoveAll(root)
+
+	limits := readResourceLimits(filepath.Join(root, "fs"), filepath.Join(root, "proc/self/cgroup"))
+	if limits.Source != ResourceLimitsCgroup2 {
+		t.Errorf("Expected source %s, got %s", ResourceLimitsCgroup2, limits.Source)
+	}
+	if limits.CPUs != 1.5 {
+		t.Errorf("Expected 1.5 CPUs, got %f", limits.CPUs)
+	}
+	if limits.Memory != 536870912 {
+		t.Errorf("Expected memory limit of the parent, got %d", limits.Memory)
+	}
+	if runtime.NumCPU() >= 2 && limits.Processors() != 2 {
+		t.Errorf("Expected 2 processors, got %d", limits.Processors())
+	}
+	if anonymous, rooms, calls := limits.MemoryThresholds(); anonymous == 0 || anonymous >= rooms || rooms >= calls || calls >= limits.Memory {
+		t.Errorf("Expected increasing thresholds below the limit, got %d %d %d", anonymous, rooms, calls)
+	}
+}
+
+func Test_ResourceLimits_Cgroup1(t *testing.T) {
+	root := writeCgroupFiles(t, map[string]string{
+		"proc/self/cgroup":                "4:memory:/\n3:cpu,cpuacct:/\n",
+		"fs/cpu/cpu.cfs_quota_us":         "50000\n",
+		"fs/cpu/cpu.cfs_period_us":        "100000\n",
+		"fs/memory/memory.limit_in_bytes": "9223372036854771712\n",
+	})
+	defer os.RemoveAll(root)
+
+	limits := readResourceLimits(filepath.Join(root, "fs"), filepath.Join(root, "proc/self/cgroup"))
+	if limits.Source != ResourceLimitsCgroup1 {
+		t.Errorf("Expected source %s, got %s", ResourceLimitsCgroup1, limits.Source)
+	}
+	if limits.CPUs != 0.5 || limits.Processors() != 1 {
+		t.Errorf("Expected 0.5 CPUs on 1 processor, got %f on %d", limits.CPUs, limits.Processors())
+	}
+	if limits.Memory != 0 {
+		t.Errorf("Expected no memory limit, got %d", limits.Memory)
+	}
+}
+
+func Test_ResourceLimits_Host(t *testing.T) {
+	root := writeCgroupFiles(t, map[string]string{
+		"proc/self/cgroup":      "0::/\n",
+		"fs/cgroup.controllers": "cpu memory\n",
+		"fs/cpu.max":            "max 100000\n",
+		"fs/memory.max":         "max\n",
+	})
+	defer os.RemoveAll(root)
+
+	limits := readResourceLimits(filepath.Join(root, "fs"), filepath.Join(root, "proc/self/cgroup"))
+	if limits.Source != ResourceLimitsHost || limits.CPUs != 0 || limits.Memory != 0 {
+		t.Errorf("Expected host limits, got %+v", limits)
+	}
+	if limits.Processors() != runtime.NumCPU() {
+		t.Errorf("Expected %d processors, got %d", runtime.NumCPU(), limits.Processors())
+	}
+}
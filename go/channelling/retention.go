@@ -0,0 +1,174 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package channelling
+
+import (
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	RetentionParticipants = "participants"
+	RetentionErasures     = "erasures"
+	RetentionTurnUsage    = "turnUsage"
+	RetentionTerms        = "terms"
+	RetentionChatIndex    = "chatIndex"
+)
+
+// RetentionStore is a store of data which expires by age.
+type RetentionStore interface {
+	ExpireBefore(before time.Time, dryRun bool) int
+}
+
+// leaderRetentionStore expires a store shared by all nodes of the cluster
+// on the leader only.
+type leaderRetentionStore struct {
+	cluster Cluster
+	store   RetentionStore
+}
+
+// NewLeaderRetentionStore wraps a store which all nodes share, so only the
+// cluster leader expires it and the other nodes report nothing expired.
+func NewLeaderRetentionStore(cluster Cluster, store RetentionStore) RetentionStore {
+	return &leaderRetentionStore{cluster, store}
+}
+
+func (store *leaderRetentionStore) ExpireBefore(before time.Time, dryRun bool) int {
+	if !store.cluster.IsLeader() {
+		return 0
+	}
+	return store.store.ExpireBefore(before, dryRun)
+}
+
+// RetentionResult is the outcome of enforcing the retention of a store.
+type RetentionResult struct {
+	Store   string `json:"store"`
+	MaxAge  int64  `json:"max_age"` // Seconds, 0 keeps data without age limit.
+	Expired int    `json:"expired"`
+}
+
+// RetentionReport is the outcome of a janitor run. With dry run, expired
+// counts what would have been removed.
+type RetentionReport struct {
+	Time    time.Time          `json:"time"`
+	DryRun  bool               `json:"dry_run"`
+	Results []*RetentionResult `json:"results"`
+}
+
+// RetentionJanitor periodically removes data older than the configured
+// maximum age of its store.
+type RetentionJanitor interface {
+	Register(name string, store RetentionStore)
+	Run(dryRun bool) *RetentionReport
+	LastReport() *RetentionReport
+	Start()
+	Stop()
+}
+
+type retentionJanitor struct {
+	sync.Mutex
+	maxAges  map[string]time.Duration
+	interval time.Duration
+	dryRun   bool
+	stores   map[string]RetentionStore
+	last     *RetentionReport
+	exit     chan bool
+}
+
+// NewRetentionJanitor creates a janitor with the configured maximum ages,
+// run interval and dry run mode.
+func NewRetentionJanitor(config *Config) RetentionJanitor {
+	return &retentionJanitor{
+		maxAges:  config.RetentionMaxAges,
+		interval: config.RetentionInterval,
+		dryRun:   config.RetentionDryRun,
+		stores:   make(map[string]RetentionStore),
+		exit:     make(chan bool),
+	}
+}
+
+// Register adds a store to be enforced with the maximum age configured for
+// name. Stores without a maximum age are reported but never expired.
+func (janitor *retentionJanitor) Register(name string, store RetentionStore) {
+	janitor.Lock()
+	janitor.stores[name] = store
+	janitor.Unlock()
+}
+
+// Run enforces the retention of all stores once.
+func (janitor *retentionJanitor) Run(dryRun bool) *RetentionReport {
+	janitor.Lock()
+	defer janitor.Unlock()
+	now := time.Now()
+	report := &RetentionReport{Time: now, DryRun: dryRun, Results: make([]*RetentionResult, 0, len(janitor.stores))}
+	names := make([]string, 0, len(janitor.stores))
+	for name := range janitor.stores {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		maxAge := janitor.maxAges[name]
+		result := &RetentionResult{Store: name, MaxAge: int64(maxAge / time.Second)}
+		if maxAge > 0 {
+			result.Expired = janitor.stores[name].ExpireBefore(now.Add(-maxAge), dryRun)
+		}
+		if result.Expired > 0 {
+			if dryRun {
+				log.Printf("Retention dry run: would expire %d entries of %s\n", result.Expired, name)
+			} else {
+				log.Printf("Retention: expired %d entries of %s\n", result.Expired, name)
+			}
+		}
+		report.Results = append(report.Results, result)
+	}
+	janitor.last = report
+	return report
+}
+
+// LastReport returns the report of the latest run, or nil if there was none.
+func (janitor *retentionJanitor) LastReport() *RetentionReport {
+	janitor.Lock()
+	defer janitor.Unlock()
+	return janitor.last
+}
+
+// Start runs the janitor in the background at the configured interval.
+func (janitor *retentionJanitor) Start() {
+	go func() {
+		ticker := time.NewTicker(janitor.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				janitor.Run(janitor.dryRun)
+			case <-janitor.exit:
+				return
+			}
+		}
+	}()
+}
+
+func (janitor *retentionJanitor) Stop() {
+	close(janitor.exit)
+}
@@ -0,0 +1,101 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package channelling
+
+import (
+	"testing"
+	"time"
+)
+
+type testRetentionStore []time.Time
+
+func (store *testRetentionStore) ExpireBefore(before time.Time, dryRun bool) int {
+	kept := make(testRetentionStore, 0, len(*store))
+	for _, t := range *store {
+		if !t.Before(before) {
+			kept = append(kept, t)
+		}
+	}
+	count := len(*store) - len(kept)
+	if !dryRun {
+		*store = kept
+	}
+	return count
+}
+
+func Test_RetentionJanitor_ExpiresByMaxAge(t *testing.T) {
+	now := time.Now()
+	old := &testRetentionStore{now.Add(-2 * time.Hour), now}
+	unlimited := &testRetentionStore{now.Add(-2 * time.Hour)}
+	janitor := NewRetentionJanitor(&Config{RetentionMaxAges: map[string]time.Duration{"old": time.Hour}})
+	janitor.Register("old", old)
+	janitor.Register("unlimited", unlimited)
+
+	report := janitor.Run(true)
+	if !report.DryRun || report.Results[0].Store != "old" || report.Results[0].Expired != 1 || len(*old) != 2 {
+		t.Fatalf("Expected dry run to only count, but got %+v", report.Results[0])
+	}
+
+	report = janitor.Run(false)
+	if report.Results[0].Expired != 1 || len(*old) != 1 {
+		t.Errorf("Expected one expired entry, but got %+v", report.Results[0])
+	}
+	if report.Results[1].Expired != 0 || len(*unlimited) != 1 {
+		t.Errorf("Expected store without max age to be kept, but got %+v", report.Results[1])
+	}
+	if janitor.LastReport() != report {
+		t.Error("Expected last report to be returned")
+	}
+}
+
+func Test_LeaderRetentionStore_ExpiresOnLeaderOnly(t *testing.T) {
+	cluster := NewTestCluster()
+	cluster.started = time.Now().Add(-time.Minute)
+	cluster.heartbeatReceived(&ClusterNode{Id: "a"})
+	cluster.updateLeader(time.Now())
+	store := &testRetentionStore{time.Now().Add(-2 * time.Hour)}
+	shared := NewLeaderRetentionStore(cluster, store)
+
+	if count := shared.ExpireBefore(time.Now(), false); count != 0 || len(*store) != 1 {
+		t.Errorf("Expected other nodes than the leader to keep the entry, but got %d", count)
+	}
+
+	cluster.leaveReceived(&ClusterNode{Id: "a"})
+	if count := shared.ExpireBefore(time.Now(), false); count != 1 || len(*store) != 0 {
+		t.Errorf("Expected leader to expire the entry, but got %d", count)
+	}
+}
+
+func Test_RoomWorker_ExpireLog_RemovesOldEntries(t *testing.T) {
+	worker := NewTestRoomWorker()
+	worker.Join(nil, &Session{Id: "a"}, nil)
+	if count := worker.ExpireLog(time.Now().Add(-time.Minute), false); count != 0 {
+		t.Errorf("Expected no expired entries, but got %d", count)
+	}
+	if count := worker.ExpireLog(time.Now().Add(time.Minute), true); count != 1 || len(worker.ParticipantLog()) != 1 {
+		t.Errorf("Expected dry run to keep the entry, but got %d", count)
+	}
+	worker.ExpireLog(time.Now().Add(time.Minute), false)
+	if log := worker.ParticipantLog(); len(log) != 0 {
+		t.Errorf("Expected log to be empty, but got %+v", log)
+	}
+}
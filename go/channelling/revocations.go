@@ -0,0 +1,87 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package channelling
+
+import (
+	"log"
+
+	"github.com/nats-io/nats"
+)
+
+const revocationSubject = "channelling.tickets.revoke"
+
+// SessionRevocations publish the session and user revocations of this
+// node to the other nodes of the cluster and apply theirs, so revoked
+// tokens are rejected by every node.
+type SessionRevocations interface {
+	Start() error
+	Stop()
+}
+
+type sessionRevocations struct {
+	BusManager
+	cluster      Cluster
+	tickets      Tickets
+	subscription *nats.Subscription
+}
+
+func NewSessionRevocations(cluster Cluster, busManager BusManager, tickets Tickets) SessionRevocations {
+	return &sessionRevocations{
+		BusManager: busManager,
+		cluster:    cluster,
+		tickets:    tickets,
+	}
+}
+
+func (revocations *sessionRevocations) Start() error {
+	sub, err := revocations.Subscribe(BusSubject(BusProtocolVersion, revocationSubject), revocations.revocationReceived)
+	if err != nil {
+		return err
+	}
+	revocations.subscription = sub
+	revocations.tickets.PublishRevocations(revocations.publish)
+	return nil
+}
+
+func (revocations *sessionRevocations) Stop() {
+	revocations.tickets.PublishRevocations(nil)
+	if revocations.subscription != nil {
+		revocations.subscription.Unsubscribe()
+		revocations.subscription = nil
+	}
+}
+
+func (revocations *sessionRevocations) publish(revocation *SessionRevocation) {
+	published := *revocation
+	published.Node = revocations.cluster.Self()
+	if err := revocations.Publish(BusSubject(BusProtocolVersion, revocationSubject), &published); err != nil {
+		log.Println("Failed to publish revocation", err)
+	}
+}
+
+func (revocations *sessionRevocations) revocationReceived(revocation *SessionRevocation) {
+	if revocation == nil || revocation.Node == "" || revocation.Node == revocations.cluster.Self() {
+		return
+	}
+	revocations.tickets.ApplyRevocation(revocation)
+	log.Println("Applied revocation of node", revocation.Node)
+}
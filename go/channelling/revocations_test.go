@@ -0,0 +1,107 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package channelling
+
+import (
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats"
+)
+
+// revocationBus delivers published revocations to all subscribers as JSON,
+// including the publishing node.
+type revocationBus struct {
+	BusManager
+	mutex    sync.Mutex
+	handlers []func(*SessionRevocation)
+}
+
+func (bus *revocationBus) Subscribe(subject string, cb nats.Handler) (*nats.Subscription, error) {
+	bus.mutex.Lock()
+	bus.handlers = append(bus.handlers, cb.(func(*SessionRevocation)))
+	bus.mutex.Unlock()
+	return nil, nil
+}
+
+func (bus *revocationBus) Publish(subject string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	bus.mutex.Lock()
+	handlers := bus.handlers
+	bus.mutex.Unlock()
+	for _, handler := range handlers {
+		revocation := &SessionRevocation{}
+		if err := json.Unmarshal(data, revocation); err != nil {
+			return err
+		}
+		handler(revocation)
+	}
+	return nil
+}
+
+func newTestRevocationNode(t *testing.T, id string, bus BusManager, sessionSecret, encryptionSecret []byte) Tickets {
+	tickets := NewTickets(sessionSecret, encryptionSecret, "test")
+	config := &Config{Version: "1.0", ClusterHeartbeatInterval: time.Second, ClusterTimeout: 3 * time.Second}
+	revocations := NewSessionRevocations(NewCluster(config, id, bus, nil), bus, tickets)
+	if err := revocations.Start(); err != nil {
+		t.Fatal(err)
+	}
+	return tickets
+}
+
+func Test_SessionRevocations_AreAppliedOnAllNodes(t *testing.T) {
+	bus := &revocationBus{BusManager: NewBusManager(nil, "", false, "")}
+	sessionSecret, _ := getRandom(64)
+	encryptionSecret, _ := getRandom(32)
+	a := newTestRevocationNode(t, "a", bus, sessionSecret, encryptionSecret)
+	b := newTestRevocationNode(t, "b", bus, sessionSecret, encryptionSecret)
+	silentOutput = true
+	defer func() { silentOutput = false }()
+
+	issued := time.Now().UnixNano()
+	a.RevokeUserid("user")
+	a.RevokeSessionToken("id")
+	for name, tickets := range map[string]Tickets{"a": a, "b": b} {
+		if !tickets.Revoked(&SessionToken{Id: "other", Userid: "user", Issued: issued}) {
+			t.Errorf("Expected user to be revoked on node %s", name)
+		}
+		if !tickets.Revoked(&SessionToken{Id: "id"}) {
+			t.Errorf("Expected session to be revoked on node %s", name)
+		}
+	}
+
+	// Tokens issued right after the revocation are valid on all nodes.
+	token, err := b.EncodeSessionToken(&Session{Id: "other", Sid: "sid", userid: "user"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, tickets := range map[string]Tickets{"a": a, "b": b} {
+		if st := tickets.DecodeSessionToken(token, ""); st.Id != "other" {
+			t.Errorf("Expected token issued after the revocation to be valid on node %s", name)
+		}
+	}
+}
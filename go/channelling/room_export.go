@@ -0,0 +1,128 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package channelling
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"sort"
+	"time"
+)
+
+const (
+	RoomParticipantJoined = "joined"
+	RoomParticipantLeft   = "left"
+)
+
+// RoomParticipantEvent is an entry of the participant log of a room.
+type RoomParticipantEvent struct {
+	Time    time.Time
+	Event   string
+	Session string
+	Userid  string `json:",omitempty"`
+}
+
+// RoomExport is the retained state of a room for record-keeping. The
+// server does not retain chat messages, so only room settings, current
+// participants and the participant log are included.
+type RoomExport struct {
+	Exported     time.Time
+	Room         *RoomSnapshot
+	Participants []string
+	Log          []*RoomParticipantEvent
+}
+
+// NewRoomExport collects the retained state of room. Room credentials are
+// never exported.
+func NewRoomExport(room RoomWorker) *RoomExport {
+	snapshot := room.Snapshot()
+	snapshot.Credentials = nil
+	participants := room.SessionIDs()
+	sort.Strings(participants)
+	return &RoomExport{time.Now(), snapshot, participants, room.ParticipantLog()}
+}
+
+// Redact replaces session ids and/or userids with pseudonyms which are
+// consistent within the export, numbered in order of the participant log.
+func (export *RoomExport) Redact(sessions, userids bool) {
+	if sessions {
+		pseudonyms := newRoomExportPseudonyms("session")
+		for _, event := range export.Log {
+			event.Session = pseudonyms.get(event.Session)
+		}
+		for i, id := range export.Participants {
+			export.Participants[i] = pseudonyms.get(id)
+		}
+		if export.Room.Consents != nil {
+			consents := make(map[string]bool, len(export.Room.Consents))
+			for id, consent := range export.Room.Consents {
+				consents[pseudonyms.get(id)] = consent
+			}
+			export.Room.Consents = consents
+		}
+	}
+	if userids {
+		pseudonyms := newRoomExportPseudonyms("user")
+		for _, event := range export.Log {
+			if event.Userid != "" {
+				event.Userid = pseudonyms.get(event.Userid)
+			}
+		}
+		if export.Room.Owner != "" {
+			export.Room.Owner = pseudonyms.get(export.Room.Owner)
+		}
+	}
+}
+
+// CSV returns the participant log as CSV with a header row.
+func (export *RoomExport) CSV() ([]byte, error) {
+	var buf bytes.Buffer
+	writer := csv.NewWriter(&buf)
+	writer.Write([]string{"time", "event", "session", "userid"})
+	for _, event := range export.Log {
+		writer.Write([]string{event.Time.UTC().Format(time.RFC3339), event.Event, event.Session, event.Userid})
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+type roomExportPseudonyms struct {
+	prefix string
+	names  map[string]string
+}
+
+func newRoomExportPseudonyms(prefix string) *roomExportPseudonyms {
+	return &roomExportPseudonyms{prefix, make(map[string]string)}
+}
+
+func (pseudonyms *roomExportPseudonyms) get(id string) string {
+	name, ok := pseudonyms.names[id]
+	if !ok {
+		name = fmt.Sprintf("%s-%d", pseudonyms.prefix, len(pseudonyms.names)+1)
+		pseudonyms.names[id] = name
+	}
+	return name
+}
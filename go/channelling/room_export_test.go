@@ -0,0 +1,58 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package channelling
+
+import (
+	"strings"
+	"testing"
+)
+
+func Test_RoomExport_RedactsSessionsAndUserids(t *testing.T) {
+	worker := NewTestRoomWorker()
+	worker.Join(nil, &Session{Id: "a", userid: "alice"}, nil)
+	worker.Join(nil, &Session{Id: "b", userid: "bob"}, nil)
+	worker.Leave("a")
+	done := make(chan bool)
+	worker.(*roomWorker).Run(func() { close(done) })
+	<-done
+
+	export := NewRoomExport(worker)
+	if len(export.Log) != 3 || export.Log[2].Event != RoomParticipantLeft || export.Log[2].Userid != "alice" {
+		t.Fatalf("Unexpected participant log %+v", export.Log)
+	}
+
+	export.Redact(true, true)
+	if export.Participants[0] != "session-2" {
+		t.Errorf("Expected redacted participant session-2, but got %v", export.Participants)
+	}
+	if export.Log[0].Session != "session-1" || export.Log[2].Session != "session-1" || export.Log[2].Userid != "user-1" {
+		t.Errorf("Expected consistent pseudonyms, but got %+v", export.Log)
+	}
+
+	data, err := export.CSV()
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if lines := strings.Split(strings.TrimSpace(string(data)), "\n"); len(lines) != 4 || !strings.HasSuffix(lines[1], ",joined,session-1,user-1") {
+		t.Errorf("Unexpected CSV %q", data)
+	}
+}
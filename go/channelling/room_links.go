@@ -0,0 +1,118 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package channelling
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"log"
+	"time"
+
+	"github.com/gorilla/securecookie"
+)
+
+const (
+	RoomRoleParticipant = "participant"
+	RoomRoleModerator   = "moderator"
+)
+
+const roomLinkName = "roomlink"
+
+// RoomLink is the content of a signed room link token.
+type RoomLink struct {
+	Name    string // Room name.
+	Type    string // Room type.
+	Role    string // Role of sessions joining with the link.
+	Expires int64  // Unix time after which the link is invalid.
+}
+
+type RoomLinks interface {
+	SignRoomLink(roomName, roomType, role string, ttl time.Duration) (string, *RoomLink, error)
+	VerifyRoomLink(token string) (*RoomLink, error)
+	RotateSessionSecret(sessionSecret []byte, grace time.Duration)
+}
+
+type roomLinks struct {
+	codec  *rotatingCodec
+	maxTTL time.Duration
+}
+
+// NewRoomLinks creates signed room links which are valid for at most
+// maxTTL. Links are signed with a key derived from sessionSecret, so they
+// can not be used as session tokens or ids and the other way round.
+func NewRoomLinks(sessionSecret []byte, maxTTL time.Duration) RoomLinks {
+	links := &roomLinks{maxTTL: maxTTL}
+	links.codec = newRotatingCodec(sessionSecret, links.newCodec)
+	return links
+}
+
+func (links *roomLinks) newCodec(sessionSecret []byte) *securecookie.SecureCookie {
+	mac := hmac.New(sha256.New, sessionSecret)
+	mac.Write([]byte(roomLinkName))
+	codec := securecookie.New(mac.Sum(nil), nil)
+	codec.MaxAge(int(links.maxTTL / time.Second))
+	return codec
+}
+
+// RotateSessionSecret signs all new links with a key derived from
+// sessionSecret. Links signed before stay valid until the grace duration
+// has passed, like session tokens.
+func (links *roomLinks) RotateSessionSecret(sessionSecret []byte, grace time.Duration) {
+	valid := links.codec.Rotate(sessionSecret, grace)
+	log.Printf("Rotated room link key, %d previous keys still valid\n", valid)
+}
+
+func (links *roomLinks) SignRoomLink(roomName, roomType, role string, ttl time.Duration) (string, *RoomLink, error) {
+	switch role {
+	case "":
+		role = RoomRoleParticipant
+	case RoomRoleParticipant, RoomRoleModerator:
+	default:
+		return "", nil, NewDataError("invalid_room_role", "Unknown room role")
+	}
+	if ttl <= 0 || ttl > links.maxTTL {
+		ttl = links.maxTTL
+	}
+
+	link := &RoomLink{
+		Name:    roomName,
+		Type:    roomType,
+		Role:    role,
+		Expires: time.Now().Add(ttl).Unix(),
+	}
+	token, err := links.codec.Encode(roomLinkName, link)
+	if err != nil {
+		return "", nil, NewDataError("room_link_failed", err.Error())
+	}
+	return token, link, nil
+}
+
+func (links *roomLinks) VerifyRoomLink(token string) (*RoomLink, error) {
+	link := &RoomLink{}
+	if err := links.codec.Decode(roomLinkName, token, link); err != nil {
+		return nil, NewDataError("invalid_room_link", "The room link is invalid")
+	}
+	if time.Now().Unix() > link.Expires {
+		return nil, NewDataError("room_link_expired", "The room link has expired")
+	}
+	return link, nil
+}
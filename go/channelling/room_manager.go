@@ -22,16 +22,23 @@
 package channelling
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"log"
+	"strings"
 	"sync"
+	"time"
+
+	"github.com/strukturag/spreed-webrtc/go/buffercache"
 
 	"github.com/nats-io/nats"
 )
 
 type RoomStatusManager interface {
 	RoomUsers(*Session) []*DataSession
-	JoinRoom(roomID, roomName, roomType string, credentials *DataRoomCredentials, session *Session, sessionAuthenticated bool, sender Sender) (*DataRoom, error)
+	JoinRoom(roomID, roomName, roomType, template string, credentials *DataRoomCredentials, session *Session, sessionAuthenticated bool, sender Sender) (*DataRoom, error)
 	LeaveRoom(roomID, sessionID string)
 	UpdateRoom(*Session, *DataRoom) (*DataRoom, error)
 	MakeRoomID(roomName, roomType string) string
@@ -48,9 +55,19 @@ type RoomStats interface {
 
 type RoomManager interface {
 	RoomStatusManager
+	RetentionStore
 	Broadcaster
 	RoomStats
+	RoomSearcher
 	SetBusManager(bus BusManager) error
+	SnapshotRooms() []*RoomSnapshot
+	RestoreRooms(snapshots []*RoomSnapshot)
+	UserRooms(userid string) []*UserRoomData
+	EraseUser(userid string) int
+	SetBlocklist(blocklist Blocklist)
+	SetBroadcastScheduler(scheduler *BroadcastScheduler)
+	SetLoadShedder(shedder LoadShedder)
+	SetBusEncryption(encryption *BusEncryption)
 }
 
 type roomManager struct {
@@ -58,11 +75,20 @@ type roomManager struct {
 	*Config
 	OutgoingEncoder
 	BusManager
-	roomTypeSubscription *nats.Subscription
-	roomTable            map[string]RoomWorker
-	roomTypes            map[string]string
-	globalRoomID         string
-	defaultRoomID        string
+	roomTypeSubscription   *nats.Subscription
+	broadcastSubscriptions map[string]*nats.Subscription
+	encryption             *BusEncryption
+	buffers                buffercache.BufferCache
+	roomTable              map[string]RoomWorker
+	roomTypes              map[string]string
+	roomLinks              RoomLinks
+	bandwidthPolicy        BandwidthPolicy
+	mediaModePolicy        MediaModePolicy
+	blocklist              Blocklist
+	scheduler              *BroadcastScheduler
+	loadShedder            LoadShedder
+	globalRoomID           string
+	defaultRoomID          string
 }
 
 type roomTypeMessage struct {
@@ -70,13 +96,75 @@ type roomTypeMessage struct {
 	Type string `json:"type"`
 }
 
-func NewRoomManager(config *Config, encoder OutgoingEncoder) RoomManager {
+const roomBroadcastSubject = "channelling.room.broadcast"
+
+// roomBroadcastMessage carries a room broadcast over the bus, so every node
+// delivers it to its local sessions in that room. With bus encryption, only
+// Sealed is set, which holds the complete message.
+type roomBroadcastMessage struct {
+	Roomid   string `json:"roomid,omitempty"`
+	From     string `json:"from,omitempty"`
+	Presence bool   `json:"presence,omitempty"`
+	// Kind of accessibility event, delivered only to subscribed sessions.
+	Accessibility string          `json:"accessibility,omitempty"`
+	Message       json.RawMessage `json:"message,omitempty"`
+	Sealed        string          `json:"sealed,omitempty"`
+}
+
+// roomBroadcastRoomSubject returns the unversioned subject of the
+// broadcasts to roomID, so nodes only receive broadcasts of their rooms. The
+// room id is hashed to be a valid subject token which does not reveal the
+// room name to the broker.
+func roomBroadcastRoomSubject(roomID string) string {
+	sum := sha256.Sum256([]byte(roomID))
+	return roomBroadcastSubject + "." + hex.EncodeToString(sum[:16])
+}
+
+// roomBroadcastTranslator bridges room broadcasts between version 1, which
+// publishes the broadcasts of all rooms on one subject, and the subjects
+// per room of later versions. Sealed broadcasts are not bridged to version
+// 1, as it cannot open them.
+type roomBroadcastTranslator struct{}
+
+func (translator roomBroadcastTranslator) Subject(version int) string {
+	if version <= 1 {
+		return roomBroadcastSubject
+	}
+	return BusSubject(version, roomBroadcastSubject) + ".*"
+}
+
+func (translator roomBroadcastTranslator) Translate(subject string, from, to int, data json.RawMessage) (string, json.RawMessage, error) {
+	if from > 1 && to > 1 {
+		// The room token is the same in all versions with subjects per room.
+		return BusSubject(to, roomBroadcastSubject+subject[strings.LastIndex(subject, "."):]), data, nil
+	}
+	msg := &roomBroadcastMessage{}
+	if err := json.Unmarshal(data, msg); err != nil {
+		return "", nil, err
+	}
+	if msg.Sealed != "" || msg.Roomid == "" {
+		return "", nil, nil
+	}
+	if to <= 1 {
+		return roomBroadcastSubject, data, nil
+	}
+	return BusSubject(to, roomBroadcastRoomSubject(msg.Roomid)), data, nil
+}
+
+func NewRoomManager(config *Config, encoder OutgoingEncoder, roomLinks RoomLinks) RoomManager {
 	rm := &roomManager{
-		RWMutex:         sync.RWMutex{},
-		Config:          config,
-		OutgoingEncoder: encoder,
-		roomTable:       make(map[string]RoomWorker),
-		roomTypes:       make(map[string]string),
+		RWMutex:                sync.RWMutex{},
+		Config:                 config,
+		OutgoingEncoder:        encoder,
+		roomTable:              make(map[string]RoomWorker),
+		broadcastSubscriptions: make(map[string]*nats.Subscription),
+		roomTypes:              make(map[string]string),
+		roomLinks:              roomLinks,
+		buffers:                buffercache.NewBufferCache(64, 0),
+		bandwidthPolicy:        NewBandwidthPolicy(config.BandwidthMinimum, config.BandwidthMaximum),
+	}
+	if config.MediaModeSFUThreshold > 0 {
+		rm.mediaModePolicy = NewMediaModePolicy(config.MediaModeSFUThreshold, config.MediaModeMeshThreshold)
 	}
 	if config.GlobalRoomID != "" {
 		rm.globalRoomID = rm.MakeRoomID(config.GlobalRoomID, "")
@@ -90,6 +178,11 @@ func (rooms *roomManager) SetBusManager(BusManager BusManager) error {
 		rooms.roomTypeSubscription.Unsubscribe()
 		rooms.roomTypeSubscription = nil
 	}
+	rooms.Lock()
+	defer rooms.Unlock()
+	for roomID := range rooms.broadcastSubscriptions {
+		rooms.unsubscribeBroadcasts(roomID)
+	}
 	rooms.BusManager = BusManager
 	if rooms.BusManager != nil {
 		sub, err := rooms.Subscribe("channelling.config.roomtype", rooms.setNatsRoomType)
@@ -97,10 +190,115 @@ func (rooms *roomManager) SetBusManager(BusManager BusManager) error {
 			return err
 		}
 		rooms.roomTypeSubscription = sub
+		for roomID := range rooms.roomTable {
+			rooms.subscribeBroadcasts(roomID)
+		}
 	}
 	return nil
 }
 
+// SetBusEncryption makes rooms seal the broadcasts they publish to the bus
+// with the keyring of the room, and open sealed broadcasts they receive.
+func (rooms *roomManager) SetBusEncryption(encryption *BusEncryption) {
+	rooms.encryption = encryption
+}
+
+// subscribeBroadcasts subscribes to the bus broadcasts of roomID, when
+// broadcasts go through the bus. The caller must hold the lock.
+func (rooms *roomManager) subscribeBroadcasts(roomID string) {
+	if rooms.BusManager == nil || rooms.RoomBroadcastBusThreshold <= 0 || roomID == rooms.globalRoomID {
+		return
+	}
+	sub, err := rooms.Subscribe(BusSubject(BusProtocolVersion, roomBroadcastRoomSubject(roomID)), func(msg *roomBroadcastMessage) {
+		rooms.deliverBusBroadcast(roomID, msg)
+	})
+	if err != nil {
+		log.Println("Failed to subscribe to room broadcasts, delivering locally", roomID, err)
+		return
+	}
+	// The subscription is nil without NATS, which keeps all broadcasts
+	// local.
+	if sub != nil {
+		rooms.broadcastSubscriptions[roomID] = sub
+	}
+}
+
+// unsubscribeBroadcasts ends the bus broadcasts of roomID. The caller must
+// hold the lock.
+func (rooms *roomManager) unsubscribeBroadcasts(roomID string) {
+	if sub, ok := rooms.broadcastSubscriptions[roomID]; ok {
+		sub.Unsubscribe()
+		delete(rooms.broadcastSubscriptions, roomID)
+	}
+}
+
+// SetBlocklist makes rooms skip users which were blocked by the receiving
+// user, for broadcasts and user lists.
+func (rooms *roomManager) SetBlocklist(blocklist Blocklist) {
+	rooms.blocklist = blocklist
+}
+
+// SetBroadcastScheduler makes rooms run their broadcasts with scheduler,
+// fairly across rooms, instead of in their own worker.
+func (rooms *roomManager) SetBroadcastScheduler(scheduler *BroadcastScheduler) {
+	rooms.scheduler = scheduler
+}
+
+// SetLoadShedder makes the manager refuse to create rooms when shedder
+// sheds them.
+func (rooms *roomManager) SetLoadShedder(shedder LoadShedder) {
+	rooms.loadShedder = shedder
+}
+
+// announceMediaMode broadcasts a media mode document to the room and
+// triggers it on the bus for the SFU integration.
+func (rooms *roomManager) announceMediaMode(roomID string, mode *DataMediaMode, participants int) {
+	log.Printf("Media mode of room %s: %s %s (%d participants)\n", roomID, mode.Phase, mode.Mode, participants)
+	rooms.Broadcast("", roomID, &DataOutgoing{Data: mode})
+	if rooms.BusManager != nil {
+		rooms.BusManager.Trigger(BusManagerMediaMode, "", roomID, &MediaModeEvent{
+			Roomid:       roomID,
+			Mode:         mode.Mode,
+			Phase:        mode.Phase,
+			Sequence:     mode.Sequence,
+			Participants: participants,
+		}, nil)
+	}
+}
+
+// deliverBusBroadcast delivers a broadcast to roomID received from the bus
+// to the local sessions in the room.
+func (rooms *roomManager) deliverBusBroadcast(roomID string, msg *roomBroadcastMessage) {
+	if msg == nil {
+		return
+	}
+	if msg.Sealed != "" {
+		if rooms.encryption == nil {
+			log.Println("Received sealed room broadcast without bus encryption", roomID)
+			return
+		}
+		opened := &roomBroadcastMessage{}
+		if err := rooms.encryption.Open(roomID, msg.Sealed, opened); err != nil {
+			log.Println("Failed to open room broadcast", roomID, err)
+			return
+		}
+		msg = opened
+	}
+	room, ok := rooms.Get(roomID)
+	if !ok {
+		// No sessions of this room on this node.
+		return
+	}
+
+	message := rooms.buffers.Wrap([]byte(msg.Message))
+	if msg.Accessibility != "" {
+		room.BroadcastAccessibility(msg.From, message, msg.Accessibility)
+	} else {
+		room.Broadcast(msg.From, message, msg.Presence)
+	}
+	message.Decref()
+}
+
 func (rooms *roomManager) setNatsRoomType(msg *roomTypeMessage) {
 	if msg == nil {
 		return
@@ -117,18 +315,52 @@ func (rooms *roomManager) setNatsRoomType(msg *roomTypeMessage) {
 
 func (rooms *roomManager) RoomUsers(session *Session) []*DataSession {
 	if room, ok := rooms.Get(session.Roomid); ok {
-		return room.GetUsers()
+		users := room.GetUsers()
+		if rooms.blocklist == nil {
+			return users
+		}
+		userid := session.Userid()
+		visible := users[:0]
+		for _, user := range users {
+			if !rooms.blocklist.IsBlocked(userid, user.Userid) {
+				visible = append(visible, user)
+			}
+		}
+		return visible
 	}
 	// TODO(lcooper): This should return an error.
 	return []*DataSession{}
 }
 
-func (rooms *roomManager) JoinRoom(roomID, roomName, roomType string, credentials *DataRoomCredentials, session *Session, sessionAuthenticated bool, sender Sender) (*DataRoom, error) {
+func (rooms *roomManager) JoinRoom(roomID, roomName, roomType, template string, credentials *DataRoomCredentials, session *Session, sessionAuthenticated bool, sender Sender) (*DataRoom, error) {
 	if roomID == rooms.defaultRoomID && !rooms.DefaultRoomEnabled {
 		return nil, NewDataError("default_room_disabled", "The default room is not enabled")
 	}
 
-	roomWorker, err := rooms.GetOrCreate(roomID, roomName, roomType, credentials, sessionAuthenticated)
+	if credentials != nil && credentials.Link != "" {
+		if rooms.roomLinks == nil {
+			return nil, NewDataError("room_links_disabled", "Room links are not enabled")
+		}
+		link, err := rooms.roomLinks.VerifyRoomLink(credentials.Link)
+		if err != nil {
+			return nil, err
+		}
+		if link.Name != roomName || rooms.MakeRoomID(link.Name, link.Type) != roomID {
+			return nil, NewDataError("invalid_room_link", "The room link is not valid for this room")
+		}
+		// A valid link replaces the account requirement and the PIN.
+		credentials.link = link
+		sessionAuthenticated = true
+	}
+
+	if _, ok := rooms.Get(roomID); !ok && roomID != rooms.defaultRoomID && roomID != rooms.globalRoomID {
+		// The caller holds the session lock, so access the field directly.
+		if err := rooms.checkRoomName(roomName, session.userid); err != nil {
+			return nil, err
+		}
+	}
+
+	roomWorker, err := rooms.GetOrCreate(roomID, roomName, roomType, template, credentials, sessionAuthenticated, session.userid)
 	if err != nil {
 		return nil, err
 	}
@@ -151,6 +383,19 @@ func (rooms *roomManager) UpdateRoom(session *Session, room *DataRoom) (*DataRoo
 		return nil, NewDataError("not_in_room", "Cannot update other rooms")
 	}
 	if roomWorker, ok := rooms.Get(session.Roomid); ok {
+		if owner := roomWorker.GetOwner(); owner != "" && room.Credentials != nil && owner != session.Userid() {
+			return nil, NewDataError("not_room_owner", "Only the room owner can change the room credentials")
+		}
+		if room.Fields != nil {
+			if owner := roomWorker.GetOwner(); owner != "" && owner != session.Userid() {
+				return nil, NewDataError("not_room_owner", "Only the room owner can change the room fields")
+			}
+			fields, err := rooms.CustomFields.Validate(CustomFieldScopeRoom, room.Fields)
+			if err != nil {
+				return nil, err
+			}
+			room.Fields = fields
+		}
 		return room, roomWorker.Update(room)
 	}
 	// Set default room type if room was not found.
@@ -166,20 +411,71 @@ func (rooms *roomManager) Broadcast(sessionID, roomID string, outgoing *DataOutg
 		return
 	}
 
+	// Status updates and volatile messages can be dropped for slow
+	// consumers.
+	presence := false
+	accessibility := ""
+	switch data := outgoing.Data.(type) {
+	case *DataSession:
+		presence = data.Type == "Status"
+	case *DataVolatile:
+		presence = true
+	case *DataAccessibilityEvent:
+		// Accessibility events go to subscribed sessions only.
+		accessibility = data.Kind
+	}
+
 	if roomID == rooms.globalRoomID {
 		rooms.RLock()
 		for _, room := range rooms.roomTable {
-			room.Broadcast(sessionID, message)
+			room.Broadcast(sessionID, message, presence)
 		}
 		rooms.RUnlock()
 	} else if room, ok := rooms.Get(roomID); ok {
-		room.Broadcast(sessionID, message)
+		rooms.RLock()
+		_, bus := rooms.broadcastSubscriptions[roomID]
+		rooms.RUnlock()
+		if bus {
+			// Every node publishes all broadcasts of its rooms, each node
+			// (including this one) delivers them to its local sessions.
+			if err := rooms.publishBroadcast(roomID, &roomBroadcastMessage{
+				Roomid:        roomID,
+				From:          sessionID,
+				Presence:      presence,
+				Accessibility: accessibility,
+				Message:       json.RawMessage(message.Bytes()),
+			}); err == nil {
+				message.Decref()
+				return
+			}
+			log.Println("Failed to publish room broadcast, delivering locally", roomID)
+		}
+		if accessibility != "" {
+			room.BroadcastAccessibility(sessionID, message, accessibility)
+		} else {
+			room.Broadcast(sessionID, message, presence)
+		}
 	} else {
 		log.Printf("No room named %s found for broadcast %#v", roomID, outgoing)
 	}
 	message.Decref()
 }
 
+// publishBroadcast publishes msg on the subject of roomID, sealed with the
+// keyring of the room if there is one.
+func (rooms *roomManager) publishBroadcast(roomID string, msg *roomBroadcastMessage) error {
+	if rooms.encryption != nil {
+		sealed, err := rooms.encryption.Seal("", roomID, msg)
+		if err != nil {
+			return err
+		}
+		if sealed != "" {
+			msg = &roomBroadcastMessage{Sealed: sealed}
+		}
+	}
+	return rooms.Publish(BusSubject(BusProtocolVersion, roomBroadcastRoomSubject(roomID)), msg)
+}
+
 func (rooms *roomManager) RoomInfo(includeSessions bool) (count int, sessionInfo map[string][]string) {
 	rooms.RLock()
 	defer rooms.RUnlock()
@@ -203,7 +499,10 @@ func (rooms *roomManager) Get(roomID string) (room RoomWorker, ok bool) {
 	return
 }
 
-func (rooms *roomManager) GetOrCreate(roomID, roomName, roomType string, credentials *DataRoomCredentials, sessionAuthenticated bool) (RoomWorker, error) {
+// GetOrCreate returns the room with roomID. New rooms are owned by their
+// provisioned owner or else by userid, if set. They inherit the settings of
+// the template with the given name, or else of a template matching roomName.
+func (rooms *roomManager) GetOrCreate(roomID, roomName, roomType, template string, credentials *DataRoomCredentials, sessionAuthenticated bool, userid string) (RoomWorker, error) {
 	if rooms.AuthorizeRoomJoin && rooms.UsersEnabled && !sessionAuthenticated {
 		return nil, NewDataError("room_join_requires_account", "Room join requires a user account")
 	}
@@ -215,6 +514,10 @@ func (rooms *roomManager) GetOrCreate(roomID, roomName, roomType string, credent
 	if roomType == "" {
 		roomType = rooms.getConfiguredRoomType(roomName)
 	}
+	roomTemplate, err := rooms.getRoomTemplate(roomName, template)
+	if err != nil {
+		return nil, err
+	}
 
 	rooms.Lock()
 	// Need to re-check, another thread might have created the room
@@ -229,22 +532,135 @@ func (rooms *roomManager) GetOrCreate(roomID, roomName, roomType string, credent
 		return nil, NewDataError("room_join_requires_account", "Room creation requires a user account")
 	}
 
+	if rooms.loadShedder != nil && !rooms.loadShedder.AllowRoom() {
+		rooms.Unlock()
+		return nil, NewDataError("room_join_overloaded", "The server is overloaded and does not create new rooms")
+	}
+
 	room := NewRoomWorker(rooms, roomID, roomName, roomType, credentials)
+	if owner, ok := rooms.RoomOwners[roomName]; ok {
+		room.SetOwner(owner)
+	} else {
+		room.SetOwner(userid)
+	}
+	if roomTemplate != nil {
+		room.SetTemplate(roomTemplate)
+	}
 	rooms.roomTable[roomID] = room
+	rooms.subscribeBroadcasts(roomID)
 	rooms.Unlock()
-	go func() {
-		// Start room, this blocks until room expired.
-		room.Start()
-		// Cleanup room when we are done.
-		rooms.Lock()
-		defer rooms.Unlock()
-		delete(rooms.roomTable, roomID)
-		log.Printf("Cleaned up room '%s'\n", roomID)
-	}()
+	go rooms.run(roomID, room)
 
 	return room, nil
 }
 
+// run starts room and blocks until the room expired.
+func (rooms *roomManager) run(roomID string, room RoomWorker) {
+	room.Start()
+	// Cleanup room when we are done.
+	rooms.Lock()
+	delete(rooms.roomTable, roomID)
+	rooms.unsubscribeBroadcasts(roomID)
+	busManager := rooms.BusManager
+	rooms.Unlock()
+	log.Printf("Cleaned up room '%s'\n", roomID)
+	if rooms.scheduler != nil {
+		rooms.scheduler.Forget(roomID)
+	}
+	if busManager != nil {
+		busManager.Trigger(BusManagerRoomExpired, "", roomID, &DataRoom{Type: room.GetType(), Name: room.GetName()}, nil)
+	}
+}
+
+// SnapshotRooms returns the state of all rooms.
+func (rooms *roomManager) SnapshotRooms() []*RoomSnapshot {
+	rooms.RLock()
+	defer rooms.RUnlock()
+	snapshots := make([]*RoomSnapshot, 0, len(rooms.roomTable))
+	for _, room := range rooms.roomTable {
+		snapshots = append(snapshots, room.Snapshot())
+	}
+	return snapshots
+}
+
+// RestoreRooms creates the rooms of snapshots. Restored rooms expire like
+// any other room when nobody joins them within the room expiry.
+func (rooms *roomManager) RestoreRooms(snapshots []*RoomSnapshot) {
+	for _, snapshot := range snapshots {
+		var template *RoomTemplate
+		if snapshot.Template != "" {
+			template = rooms.RoomTemplates[snapshot.Template]
+		}
+		rooms.Lock()
+		if _, ok := rooms.roomTable[snapshot.Id]; ok {
+			rooms.Unlock()
+			continue
+		}
+		room := NewRoomWorker(rooms, snapshot.Id, snapshot.Name, snapshot.Type, nil)
+		room.Restore(snapshot, template)
+		rooms.roomTable[snapshot.Id] = room
+		rooms.subscribeBroadcasts(snapshot.Id)
+		rooms.Unlock()
+		go rooms.run(snapshot.Id, room)
+	}
+}
+
+// UserRooms returns the data all rooms retain about userid.
+func (rooms *roomManager) UserRooms(userid string) []*UserRoomData {
+	rooms.RLock()
+	defer rooms.RUnlock()
+	data := make([]*UserRoomData, 0)
+	for _, room := range rooms.roomTable {
+		if roomData := room.UserData(userid); roomData != nil {
+			data = append(data, roomData)
+		}
+	}
+	return data
+}
+
+// SearchRooms returns the rooms of this server which are visible to userid
+// and match query.
+func (rooms *roomManager) SearchRooms(userid, query, order string, limit int) []*RoomSearchResult {
+	rooms.RLock()
+	candidates := make([]*RoomSearchResult, 0, len(rooms.roomTable))
+	for roomID, room := range rooms.roomTable {
+		if roomID == rooms.globalRoomID {
+			continue
+		}
+		if result := room.SearchResult(userid); result != nil {
+			candidates = append(candidates, result)
+		}
+	}
+	rooms.RUnlock()
+	return searchRooms(candidates, query, order, limit)
+}
+
+// EraseUser removes userid from all rooms and returns the number of
+// changed rooms.
+func (rooms *roomManager) EraseUser(userid string) int {
+	rooms.RLock()
+	defer rooms.RUnlock()
+	count := 0
+	for _, room := range rooms.roomTable {
+		if room.EraseUser(userid) {
+			count++
+		}
+	}
+	return count
+}
+
+// ExpireBefore removes participant log entries older than before from all
+// rooms and returns their number. With dryRun, entries are only counted.
+func (rooms *roomManager) ExpireBefore(before time.Time, dryRun bool) int {
+	rooms.RLock()
+	defer rooms.RUnlock()
+	count := 0
+	for _, room := range rooms.roomTable {
+		count += room.ExpireLog(before, dryRun)
+	}
+	return count
+}
+
 func (rooms *roomManager) GlobalUsers() []*roomUser {
 	if rooms.globalRoomID == "" {
 		return make([]*roomUser, 0)
@@ -267,6 +683,41 @@ func (rooms *roomManager) MakeRoomID(roomName, roomType string) string {
 	return fmt.Sprintf("%s:%s", roomType, roomName)
 }
 
+// checkRoomName applies the room name policy for new rooms created by
+// userid.
+func (rooms *roomManager) checkRoomName(roomName, userid string) error {
+	if rooms.RoomNamePattern != nil && !rooms.RoomNamePattern.MatchString(roomName) {
+		return NewDataError("invalid_room_name", "The room name is not allowed")
+	}
+
+	if len(rooms.RoomNameBlocklist) > 0 {
+		lowerName := strings.ToLower(roomName)
+		for _, word := range rooms.RoomNameBlocklist {
+			if strings.Contains(lowerName, word) {
+				return NewDataError("invalid_room_name", "The room name is not allowed")
+			}
+		}
+	}
+
+	for prefix, userids := range rooms.RoomNamePrefixes {
+		if !strings.HasPrefix(roomName, prefix) {
+			continue
+		}
+		allowed := false
+		for _, allowedUserid := range userids {
+			if userid != "" && userid == allowedUserid {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return NewDataError("room_name_reserved", "The room name is reserved")
+		}
+	}
+
+	return nil
+}
+
 func (rooms *roomManager) getConfiguredRoomType(roomName string) string {
 	if roomType, found := rooms.roomTypes[roomName]; found {
 		// Type of this room was overwritten through NATS.
@@ -279,5 +730,28 @@ func (rooms *roomManager) getConfiguredRoomType(roomName string) string {
 		}
 	}
 
+	if template, _ := rooms.getRoomTemplate(roomName, ""); template != nil && template.Type != "" {
+		return template.Type
+	}
+
 	return rooms.RoomTypeDefault
 }
+
+// getRoomTemplate returns the template with name, or if name is empty a
+// template with a pattern matching roomName.
+func (rooms *roomManager) getRoomTemplate(roomName, name string) (*RoomTemplate, error) {
+	if name != "" {
+		if template, ok := rooms.RoomTemplates[name]; ok {
+			return template, nil
+		}
+		return nil, NewDataError("unknown_room_template", "The room template does not exist")
+	}
+
+	for _, template := range rooms.RoomTemplates {
+		if template.Pattern != nil && template.Pattern.MatchString(roomName) {
+			return template, nil
+		}
+	}
+
+	return nil, nil
+}
@@ -22,16 +22,23 @@
 package channelling
 
 import (
+	"encoding/json"
+	"regexp"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
-	"github.com/strukturag/spreed-webrtc/go/channelling"
+	"github.com/nats-io/nats"
+
+	"github.com/strukturag/spreed-webrtc/go/buffercache"
 )
 
 func NewTestRoomManager() (RoomManager, *Config) {
 	config := &Config{
-		RoomTypeDefault: channelling.RoomTypeRoom,
+		RoomTypeDefault: RoomTypeRoom,
 	}
-	return NewRoomManager(config, nil), config
+	return NewRoomManager(config, nil, nil), config
 }
 
 func Test_RoomManager_JoinRoom_ReturnsAnErrorForUnauthenticatedSessionsWhenCreationRequiresAnAccount(t *testing.T) {
@@ -40,16 +47,16 @@ func Test_RoomManager_JoinRoom_ReturnsAnErrorForUnauthenticatedSessionsWhenCreat
 	config.AuthorizeRoomCreation = true
 
 	unauthenticatedSession := &Session{}
-	_, err := roomManager.JoinRoom(channelling.RoomTypeRoom+":foo", "foo", channelling.RoomTypeRoom, nil, unauthenticatedSession, false, nil)
+	_, err := roomManager.JoinRoom(RoomTypeRoom+":foo", "foo", RoomTypeRoom, "", nil, unauthenticatedSession, false, nil)
 	assertDataError(t, err, "room_join_requires_account")
 
 	authenticatedSession := &Session{userid: "9870457"}
-	_, err = roomManager.JoinRoom(channelling.RoomTypeRoom+":foo", "foo", channelling.RoomTypeRoom, nil, authenticatedSession, true, nil)
+	_, err = roomManager.JoinRoom(RoomTypeRoom+":foo", "foo", RoomTypeRoom, "", nil, authenticatedSession, true, nil)
 	if err != nil {
 		t.Fatalf("Unexpected error %v joining room while authenticated", err)
 	}
 
-	_, err = roomManager.JoinRoom(channelling.RoomTypeRoom+":foo", "foo", channelling.RoomTypeRoom, nil, unauthenticatedSession, false, nil)
+	_, err = roomManager.JoinRoom(RoomTypeRoom+":foo", "foo", RoomTypeRoom, "", nil, unauthenticatedSession, false, nil)
 	if err != nil {
 		t.Fatalf("Unexpected error %v joining room while unauthenticated", err)
 	}
@@ -61,19 +68,93 @@ func Test_RoomManager_JoinRoom_ReturnsAnErrorForUnauthenticatedSessionsWhenJoinR
 	config.AuthorizeRoomJoin = true
 
 	unauthenticatedSession := &Session{}
-	_, err := roomManager.JoinRoom(channelling.RoomTypeRoom+":foo", "foo", channelling.RoomTypeRoom, nil, unauthenticatedSession, false, nil)
+	_, err := roomManager.JoinRoom(RoomTypeRoom+":foo", "foo", RoomTypeRoom, "", nil, unauthenticatedSession, false, nil)
 	assertDataError(t, err, "room_join_requires_account")
 
 	authenticatedSession := &Session{userid: "9870457"}
-	_, err = roomManager.JoinRoom(channelling.RoomTypeRoom+":foo", "foo", channelling.RoomTypeRoom, nil, authenticatedSession, true, nil)
+	_, err = roomManager.JoinRoom(RoomTypeRoom+":foo", "foo", RoomTypeRoom, "", nil, authenticatedSession, true, nil)
 	if err != nil {
 		t.Fatalf("Unexpected error %v joining room while authenticated", err)
 	}
 
-	_, err = roomManager.JoinRoom(channelling.RoomTypeRoom+":foo", "foo", channelling.RoomTypeRoom, nil, unauthenticatedSession, false, nil)
+	_, err = roomManager.JoinRoom(RoomTypeRoom+":foo", "foo", RoomTypeRoom, "", nil, unauthenticatedSession, false, nil)
 	assertDataError(t, err, "room_join_requires_account")
 }
 
+func Test_RoomManager_JoinRoom_AcceptsValidRoomLinks(t *testing.T) {
+	roomLinks := NewRoomLinks([]byte("room-links-test-secret-room-links"), time.Hour)
+	config := &Config{
+		RoomTypeDefault:   RoomTypeRoom,
+		UsersEnabled:      true,
+		AuthorizeRoomJoin: true,
+	}
+	roomManager := NewRoomManager(config, nil, roomLinks)
+
+	token, _, err := roomLinks.SignRoomLink("foo", "", RoomRoleParticipant, time.Minute)
+	if err != nil {
+		t.Fatalf("Unexpected error %v signing room link", err)
+	}
+
+	unauthenticatedSession := &Session{}
+	_, err = roomManager.JoinRoom(RoomTypeRoom+":foo", "foo", RoomTypeRoom, "", &DataRoomCredentials{Link: token}, unauthenticatedSession, false, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error %v joining room with link", err)
+	}
+
+	_, err = roomManager.JoinRoom(RoomTypeRoom+":bar", "bar", RoomTypeRoom, "", &DataRoomCredentials{Link: token}, unauthenticatedSession, false, nil)
+	assertDataError(t, err, "invalid_room_link")
+
+	_, err = roomManager.JoinRoom(RoomTypeRoom+":foo", "foo", RoomTypeRoom, "", &DataRoomCredentials{Link: token + "x"}, unauthenticatedSession, false, nil)
+	assertDataError(t, err, "invalid_room_link")
+}
+
+func Test_RoomLinks_RotateSessionSecret_KeepsLinksWithinGrace(t *testing.T) {
+	roomLinks := NewRoomLinks([]byte("room-links-test-secret-room-links"), time.Hour)
+	token, _, err := roomLinks.SignRoomLink("foo", "", RoomRoleParticipant, time.Minute)
+	if err != nil {
+		t.Fatalf("Unexpected error %v signing room link", err)
+	}
+
+	roomLinks.RotateSessionSecret([]byte("room-links-test-secret-rotated-1"), time.Hour)
+	if _, err := roomLinks.VerifyRoomLink(token); err != nil {
+		t.Errorf("Expected link to be valid within grace period, but got %v", err)
+	}
+
+	roomLinks.RotateSessionSecret([]byte("room-links-test-secret-rotated-2"), 0)
+	if _, err := roomLinks.VerifyRoomLink(token); err == nil {
+		t.Error("Expected link to be invalid without grace period")
+	}
+}
+
+func Test_RoomManager_JoinRoom_EnforcesRoomNamePolicy(t *testing.T) {
+	roomManager, config := NewTestRoomManager()
+	config.RoomNamePattern = regexp.MustCompile(`^[a-z0-9/-]+$`)
+	config.RoomNameBlocklist = []string{"badword"}
+	config.RoomNamePrefixes = map[string][]string{"acme/": {"alice"}}
+
+	session := &Session{}
+	for name, code := range map[string]string{
+		"Foo Bar":      "invalid_room_name",
+		"the-badword":  "invalid_room_name",
+		"acme/meeting": "room_name_reserved",
+	} {
+		_, err := roomManager.JoinRoom(RoomTypeRoom+":"+name, name, RoomTypeRoom, "", nil, session, false, nil)
+		assertDataError(t, err, code)
+	}
+
+	if _, err := roomManager.JoinRoom(RoomTypeRoom+":foo", "foo", RoomTypeRoom, "", nil, session, false, nil); err != nil {
+		t.Fatalf("Unexpected error %v joining allowed room", err)
+	}
+
+	alice := &Session{userid: "alice"}
+	if _, err := roomManager.JoinRoom(RoomTypeRoom+":acme/meeting", "acme/meeting", RoomTypeRoom, "", nil, alice, true, nil); err != nil {
+		t.Fatalf("Unexpected error %v creating reserved room as owner", err)
+	}
+	if _, err := roomManager.JoinRoom(RoomTypeRoom+":acme/meeting", "acme/meeting", RoomTypeRoom, "", nil, session, false, nil); err != nil {
+		t.Fatalf("Unexpected error %v joining existing reserved room", err)
+	}
+}
+
 func Test_RoomManager_UpdateRoom_ReturnsAnErrorIfNoRoomHasBeenJoined(t *testing.T) {
 	roomManager, _ := NewTestRoomManager()
 	_, err := roomManager.UpdateRoom(&Session{}, nil)
@@ -83,36 +164,294 @@ func Test_RoomManager_UpdateRoom_ReturnsAnErrorIfNoRoomHasBeenJoined(t *testing.
 
 func Test_RoomManager_UpdateRoom_ReturnsAnErrorIfUpdatingAnUnjoinedRoom(t *testing.T) {
 	roomManager, _ := NewTestRoomManager()
-	session := &Session{Hello: true, Roomid: channelling.RoomTypeRoom + ":foo"}
+	session := &Session{Hello: true, Roomid: RoomTypeRoom + ":foo"}
 	_, err := roomManager.UpdateRoom(session, &DataRoom{Name: "bar"})
 	assertDataError(t, err, "not_in_room")
 }
 
 func Test_RoomManager_UpdateRoom_ReturnsACorrectlyTypedDocument(t *testing.T) {
 	roomManager, _ := NewTestRoomManager()
-	session := &Session{Hello: true, Roomid: channelling.RoomTypeRoom + ":foo"}
+	session := &Session{Hello: true, Roomid: RoomTypeRoom + ":foo"}
 	room, err := roomManager.UpdateRoom(session, &DataRoom{Name: "foo"})
 	if err != nil {
 		t.Fatalf("Unexpected error %v updating room", err)
 	}
 
-	if room.Type != channelling.RoomTypeRoom {
-		t.Errorf("Expected document type to be %s, but was %v", channelling.RoomTypeRoom, room.Type)
+	if room.Type != RoomTypeRoom {
+		t.Errorf("Expected document type to be %s, but was %v", RoomTypeRoom, room.Type)
+	}
+}
+
+func Test_RoomManager_RoomOwner(t *testing.T) {
+	roomManager, config := NewTestRoomManager()
+	config.RoomOwners = map[string]string{"provisioned": "carol"}
+
+	alice := &Session{userid: "alice"}
+	room, err := roomManager.JoinRoom(RoomTypeRoom+":foo", "foo", RoomTypeRoom, "", nil, alice, true, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error %v joining room", err)
+	}
+	if room.Owner != "alice" {
+		t.Errorf("Expected creator alice to own the room, but got %q", room.Owner)
+	}
+
+	room, err = roomManager.JoinRoom(RoomTypeRoom+":provisioned", "provisioned", RoomTypeRoom, "", nil, alice, true, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error %v joining room", err)
+	}
+	if room.Owner != "carol" {
+		t.Errorf("Expected provisioned owner carol, but got %q", room.Owner)
+	}
+
+	bob := &Session{Hello: true, Roomid: RoomTypeRoom + ":foo", userid: "bob"}
+	_, err = roomManager.UpdateRoom(bob, &DataRoom{Name: "foo", Credentials: &DataRoomCredentials{PIN: "1234"}})
+	assertDataError(t, err, "not_room_owner")
+
+	alice.Hello, alice.Roomid = true, RoomTypeRoom+":foo"
+	if _, err = roomManager.UpdateRoom(alice, &DataRoom{Name: "foo", Credentials: &DataRoomCredentials{PIN: "1234"}}); err != nil {
+		t.Errorf("Unexpected error %v changing credentials as owner", err)
+	}
+}
+
+func Test_RoomManager_RoomTemplates(t *testing.T) {
+	roomManager, config := NewTestRoomManager()
+	config.RoomTemplates = map[string]*RoomTemplate{
+		"small":   {Name: "small", Pattern: regexp.MustCompile("^small/"), Capacity: 1},
+		"webinar": {Name: "webinar", Features: []string{RoomFeatureRecording}, Turn: RoomTurnPolicyRelay},
+	}
+
+	_, err := roomManager.JoinRoom(RoomTypeRoom+":foo", "foo", RoomTypeRoom, "unknown", nil, &Session{Id: "a"}, false, nil)
+	assertDataError(t, err, "unknown_room_template")
+
+	room, err := roomManager.JoinRoom(RoomTypeRoom+":foo", "foo", RoomTypeRoom, "webinar", nil, &Session{Id: "a"}, false, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error %v joining room with template", err)
+	}
+	if room.Turn != RoomTurnPolicyRelay || len(room.Features) != 1 {
+		t.Errorf("Expected room to inherit the webinar template, but got %+v", room)
+	}
+
+	if _, err = roomManager.JoinRoom(RoomTypeRoom+":small/1", "small/1", RoomTypeRoom, "", nil, &Session{Id: "a"}, false, nil); err != nil {
+		t.Fatalf("Unexpected error %v joining room", err)
+	}
+	_, err = roomManager.JoinRoom(RoomTypeRoom+":small/1", "small/1", RoomTypeRoom, "", nil, &Session{Id: "b"}, false, nil)
+	assertDataError(t, err, "room_full")
+}
+
+type testSender struct {
+	sent chan string
+}
+
+func (sender *testSender) Index() uint64 {
+	return 0
+}
+
+func (sender *testSender) Send(message buffercache.Buffer) {
+	sender.sent <- string(message.Bytes())
+}
+
+func Test_RoomManager_DeliverBusBroadcast_SendsToLocalSessions(t *testing.T) {
+	theRoomManager, _ := NewTestRoomManager()
+	rm := theRoomManager.(*roomManager)
+	roomID := RoomTypeRoom + ":foo"
+	a, b := &testSender{make(chan string, 1)}, &testSender{make(chan string, 1)}
+	rm.JoinRoom(roomID, "foo", RoomTypeRoom, "", nil, &Session{Id: "a"}, false, a)
+	rm.JoinRoom(roomID, "foo", RoomTypeRoom, "", nil, &Session{Id: "b"}, false, b)
+
+	rm.deliverBusBroadcast(roomID, &roomBroadcastMessage{From: "a", Message: []byte(`{"Data":{}}`)})
+	select {
+	case message := <-b.sent:
+		if message != `{"Data":{}}` {
+			t.Errorf("Unexpected message %s", message)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected broadcast to be delivered to local session")
+	}
+	select {
+	case <-a.sent:
+		t.Error("Expected broadcast not to be delivered to its sender")
+	default:
+	}
+}
+
+// memoryBus connects the room managers of several nodes like NATS, it
+// delivers published room broadcasts to all subscribers as JSON.
+type memoryBus struct {
+	BusManager
+	mutex     sync.Mutex
+	handlers  map[string][]func(*roomBroadcastMessage)
+	published []string
+}
+
+func newMemoryBus() *memoryBus {
+	return &memoryBus{
+		BusManager: NewBusManager(nil, "", false, ""),
+		handlers:   make(map[string][]func(*roomBroadcastMessage)),
+	}
+}
+
+func (bus *memoryBus) Subscribe(subject string, cb nats.Handler) (*nats.Subscription, error) {
+	if handler, ok := cb.(func(*roomBroadcastMessage)); ok {
+		bus.mutex.Lock()
+		bus.handlers[subject] = append(bus.handlers[subject], handler)
+		bus.mutex.Unlock()
+	}
+	return &nats.Subscription{}, nil
+}
+
+func (bus *memoryBus) Publish(subject string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	bus.mutex.Lock()
+	bus.published = append(bus.published, string(data))
+	handlers := bus.handlers[subject]
+	bus.mutex.Unlock()
+	for _, handler := range handlers {
+		msg := &roomBroadcastMessage{}
+		if err := json.Unmarshal(data, msg); err != nil {
+			return err
+		}
+		handler(msg)
+	}
+	return nil
+}
+
+func NewTestBusRoomManager(t *testing.T, bus BusManager) *roomManager {
+	rm := NewRoomManager(&Config{RoomTypeDefault: RoomTypeRoom, RoomBroadcastBusThreshold: 2}, NewCodec(0, nil), nil).(*roomManager)
+	if err := rm.SetBusManager(bus); err != nil {
+		t.Fatal(err)
+	}
+	return rm
+}
+
+func assertReceived(t *testing.T, sender *testSender, name string) {
+	select {
+	case message := <-sender.sent:
+		if !strings.Contains(message, "hello") {
+			t.Errorf("Unexpected message %s for %s", message, name)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("Expected broadcast to be delivered to %s", name)
+	}
+}
+
+func Test_RoomManager_Broadcast_ReachesSessionsOnAllNodes(t *testing.T) {
+	bus := newMemoryBus()
+	large, small := NewTestBusRoomManager(t, bus), NewTestBusRoomManager(t, bus)
+	roomID := RoomTypeRoom + ":foo"
+	a1, a2, b := &testSender{make(chan string, 1)}, &testSender{make(chan string, 1)}, &testSender{make(chan string, 1)}
+	large.JoinRoom(roomID, "foo", RoomTypeRoom, "", nil, &Session{Id: "a1"}, false, a1)
+	large.JoinRoom(roomID, "foo", RoomTypeRoom, "", nil, &Session{Id: "a2"}, false, a2)
+	small.JoinRoom(roomID, "foo", RoomTypeRoom, "", nil, &Session{Id: "b"}, false, b)
+
+	// The node below the threshold reaches the sessions of the large node.
+	small.Broadcast("b", roomID, &DataOutgoing{From: "b", Data: "hello"})
+	assertReceived(t, a1, "a1")
+	assertReceived(t, a2, "a2")
+
+	large.Broadcast("a1", roomID, &DataOutgoing{From: "a1", Data: "hello"})
+	assertReceived(t, a2, "a2")
+	assertReceived(t, b, "b")
+
+	select {
+	case message := <-a1.sent:
+		t.Errorf("Expected broadcast not to be delivered to its sender, but got %s", message)
+	case message := <-b.sent:
+		t.Errorf("Expected broadcast not to be delivered to its sender, but got %s", message)
+	default:
+	}
+}
+
+func Test_RoomManager_Broadcast_SealsBusBroadcasts(t *testing.T) {
+	bus := newMemoryBus()
+	encryption := NewBusEncryption(testSessionStore{}, newTestKeyring(t, "default"), nil)
+	a, b := NewTestBusRoomManager(t, bus), NewTestBusRoomManager(t, bus)
+	a.SetBusEncryption(encryption)
+	b.SetBusEncryption(encryption)
+	roomID := RoomTypeRoom + ":foo"
+	sender := &testSender{make(chan string, 1)}
+	a.JoinRoom(roomID, "foo", RoomTypeRoom, "", nil, &Session{Id: "a"}, false, &testSender{make(chan string, 1)})
+	b.JoinRoom(roomID, "foo", RoomTypeRoom, "", nil, &Session{Id: "b"}, false, sender)
+
+	a.Broadcast("a", roomID, &DataOutgoing{From: "a", Data: "hello"})
+	assertReceived(t, sender, "b")
+	if len(bus.published) != 1 || strings.Contains(bus.published[0], "hello") || strings.Contains(bus.published[0], "foo") {
+		t.Errorf("Expected only sealed broadcasts on the bus, but got %v", bus.published)
+	}
+}
+
+func Test_RoomManager_DeliverBusBroadcast_SendsAccessibilityToSubscribers(t *testing.T) {
+	theRoomManager, _ := NewTestRoomManager()
+	rm := theRoomManager.(*roomManager)
+	roomID := RoomTypeRoom + ":foo"
+	subscribed := &Session{Id: "b"}
+	subscribed.SetAccessibility([]string{AccessibilityCaption})
+	described := &Session{Id: "c"}
+	described.SetAccessibility([]string{AccessibilityDescription})
+	b, c := &testSender{make(chan string, 1)}, &testSender{make(chan string, 1)}
+	rm.JoinRoom(roomID, "foo", RoomTypeRoom, "", nil, &Session{Id: "a"}, false, &testSender{make(chan string, 1)})
+	rm.JoinRoom(roomID, "foo", RoomTypeRoom, "", nil, subscribed, false, b)
+	rm.JoinRoom(roomID, "foo", RoomTypeRoom, "", nil, described, false, c)
+
+	rm.deliverBusBroadcast(roomID, &roomBroadcastMessage{From: "a", Accessibility: AccessibilityCaption, Message: []byte(`{"Data":{}}`)})
+	select {
+	case <-b.sent:
+	default:
+		t.Error("Expected caption to be delivered to the subscribed session")
+	}
+	select {
+	case <-c.sent:
+		t.Error("Expected caption not to be delivered to sessions without subscription")
+	default:
 	}
 }
 
 func Test_RoomManager_TypeThroughNats(t *testing.T) {
 	theRoomManager, _ := NewTestRoomManager()
 	rm := theRoomManager.(*roomManager)
-	if rt := rm.getConfiguredRoomType("foo"); rt != channelling.RoomTypeRoom {
-		t.Errorf("Expected room type to be %s, but was %v", channelling.RoomTypeRoom, rt)
+	if rt := rm.getConfiguredRoomType("foo"); rt != RoomTypeRoom {
+		t.Errorf("Expected room type to be %s, but was %v", RoomTypeRoom, rt)
 	}
 	rm.setNatsRoomType(&roomTypeMessage{Path: "foo", Type: "Conference"})
 	if rt := rm.getConfiguredRoomType("foo"); rt != "Conference" {
 		t.Errorf("Expected room type to be %s, but was %v", "Conference", rt)
 	}
 	rm.setNatsRoomType(&roomTypeMessage{Path: "foo", Type: ""})
-	if rt := rm.getConfiguredRoomType("foo"); rt != channelling.RoomTypeRoom {
-		t.Errorf("Expected room type to be %s, but was %v", channelling.RoomTypeRoom, rt)
+	if rt := rm.getConfiguredRoomType("foo"); rt != RoomTypeRoom {
+		t.Errorf("Expected room type to be %s, but was %v", RoomTypeRoom, rt)
+	}
+}
+
+func Test_RoomManager_RestoreRooms_RestoresSnapshotState(t *testing.T) {
+	theRoomManager, _ := NewTestRoomManager()
+	roomID := RoomTypeRoom + ":foo"
+	credentials := &DataRoomCredentials{PIN: "1234"}
+	if _, err := theRoomManager.JoinRoom(roomID, "foo", RoomTypeRoom, "", credentials, &Session{Id: "a"}, false, nil); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	room, _ := theRoomManager.(*roomManager).Get(roomID)
+	room.SetOwner("owner")
+	room.SetMute(&DataMute{Audio: true})
+
+	snapshots := theRoomManager.SnapshotRooms()
+	restored, _ := NewTestRoomManager()
+	restored.RestoreRooms(snapshots)
+
+	room, ok := restored.(*roomManager).Get(roomID)
+	if !ok {
+		t.Fatal("Expected room to be restored")
+	}
+	if owner := room.GetOwner(); owner != "owner" {
+		t.Errorf("Expected owner to be restored, but got %s", owner)
+	}
+	if mute := room.GetMute(); mute == nil || !mute.Audio {
+		t.Errorf("Expected mute state to be restored, but got %+v", mute)
+	}
+	_, err := restored.JoinRoom(roomID, "foo", RoomTypeRoom, "", nil, &Session{Id: "b"}, false, nil)
+	assertDataError(t, err, "authorization_required")
+	if _, err = restored.JoinRoom(roomID, "foo", RoomTypeRoom, "", credentials, &Session{Id: "b"}, false, nil); err != nil {
+		t.Errorf("Expected join with PIN to succeed, but got %v", err)
 	}
 }
@@ -0,0 +1,92 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package channelling
+
+const (
+	RoomPermissionChat         = "chat"
+	RoomPermissionScreenshare  = "screenshare"
+	RoomPermissionCall         = "call"
+	RoomPermissionInvite       = "invite"
+	RoomPermissionFileTransfer = "filetransfer"
+)
+
+const (
+	PermissionEveryone   = "everyone"   // All sessions in the room.
+	PermissionUsers      = "users"      // Authenticated sessions and moderators.
+	PermissionModerators = "moderators" // The room owner and moderators.
+)
+
+func (permissions *DataPermissions) values() []*string {
+	return []*string{&permissions.Chat, &permissions.Screenshare, &permissions.Call, &permissions.Invite, &permissions.FileTransfer}
+}
+
+// Validate checks all values and normalizes everyone to the empty value.
+func (permissions *DataPermissions) Validate() error {
+	for _, value := range permissions.values() {
+		switch *value {
+		case PermissionEveryone:
+			*value = ""
+		case "", PermissionUsers, PermissionModerators:
+		default:
+			return NewDataError("invalid_permissions", "Permissions must be one of everyone, users or moderators")
+		}
+	}
+	return nil
+}
+
+// Empty returns true if everyone may do everything.
+func (permissions *DataPermissions) Empty() bool {
+	for _, value := range permissions.values() {
+		if *value != "" && *value != PermissionEveryone {
+			return false
+		}
+	}
+	return true
+}
+
+// Allowed returns true if a session may do action. Moderators may do
+// everything.
+func (permissions *DataPermissions) Allowed(action string, moderator, authenticated bool) bool {
+	if permissions == nil || moderator {
+		return true
+	}
+	var value string
+	switch action {
+	case RoomPermissionChat:
+		value = permissions.Chat
+	case RoomPermissionScreenshare:
+		value = permissions.Screenshare
+	case RoomPermissionCall:
+		value = permissions.Call
+	case RoomPermissionInvite:
+		value = permissions.Invite
+	case RoomPermissionFileTransfer:
+		value = permissions.FileTransfer
+	}
+	switch value {
+	case PermissionUsers:
+		return authenticated
+	case PermissionModerators:
+		return false
+	}
+	return true
+}
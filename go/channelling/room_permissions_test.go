@@ -0,0 +1,87 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package channelling
+
+import (
+	"testing"
+)
+
+func Test_DataPermissions_Validate(t *testing.T) {
+	permissions := &DataPermissions{Chat: PermissionEveryone, Call: PermissionModerators}
+	if err := permissions.Validate(); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if permissions.Chat != "" || permissions.Call != PermissionModerators {
+		t.Errorf("Expected everyone to be normalized, but got %+v", permissions)
+	}
+	if err := (&DataPermissions{Invite: "admins"}).Validate(); err == nil {
+		t.Error("Expected unknown value to be rejected")
+	}
+}
+
+func Test_DataPermissions_Allowed(t *testing.T) {
+	permissions := &DataPermissions{Chat: PermissionUsers, Screenshare: PermissionModerators}
+	for _, test := range []struct {
+		action        string
+		moderator     bool
+		authenticated bool
+		allowed       bool
+	}{
+		{RoomPermissionChat, false, false, false},
+		{RoomPermissionChat, false, true, true},
+		{RoomPermissionScreenshare, false, true, false},
+		{RoomPermissionScreenshare, true, false, true},
+		{RoomPermissionCall, false, false, true},
+	} {
+		if allowed := permissions.Allowed(test.action, test.moderator, test.authenticated); allowed != test.allowed {
+			t.Errorf("Expected %s (moderator %v, authenticated %v) to be allowed %v", test.action, test.moderator, test.authenticated, test.allowed)
+		}
+	}
+	var none *DataPermissions
+	if !none.Allowed(RoomPermissionChat, false, false) {
+		t.Error("Expected everything to be allowed without permissions")
+	}
+}
+
+func Test_RoomWorker_Permissions(t *testing.T) {
+	worker := NewRoomWorker(&roomManager{Config: &Config{}}, testRoomID, testRoomName, testRoomType, nil)
+	worker.SetPermissions(&DataPermissions{Type: "Permissions", Call: PermissionModerators})
+	permissions := worker.GetPermissions()
+	if permissions == nil || permissions.Call != PermissionModerators {
+		t.Fatalf("Expected permissions, but got %+v", permissions)
+	}
+	permissions.Call = ""
+	if worker.GetPermissions().Call != PermissionModerators {
+		t.Error("Expected a copy of the permissions")
+	}
+
+	restored := NewRoomWorker(&roomManager{Config: &Config{}}, testRoomID, testRoomName, testRoomType, nil)
+	restored.Restore(worker.Snapshot(), nil)
+	if restored.GetPermissions() == nil {
+		t.Error("Expected permissions to be restored from the snapshot")
+	}
+
+	worker.SetPermissions(&DataPermissions{Type: "Permissions"})
+	if worker.GetPermissions() != nil {
+		t.Error("Expected permissions allowing everything to be cleared")
+	}
+}
@@ -0,0 +1,137 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package channelling
+
+import (
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Orders of room search results with the same match quality.
+const (
+	RoomSearchOccupancy = "occupancy" // Most sessions first.
+	RoomSearchRecent    = "recent"    // Latest activity first.
+)
+
+const roomSearchMaxResults = 50
+
+// Quality of room search matches, better matches first.
+const (
+	roomSearchNamePrefix = iota
+	roomSearchWordPrefix
+	roomSearchFieldPrefix
+	roomSearchNoMatch
+)
+
+// RoomSearchResult is a room matching a room search.
+type RoomSearchResult struct {
+	Id        string
+	Name      string
+	Type      string
+	Template  string `json:",omitempty"`
+	Occupancy int
+	Active    time.Time              // Latest join or leave, zero if unknown.
+	Fields    map[string]interface{} `json:",omitempty"`
+	match     int
+}
+
+// RoomSearcher searches the rooms of this server.
+type RoomSearcher interface {
+	// SearchRooms returns at most limit rooms visible to userid (empty for
+	// anonymous users) whose name, or a word of it, or the value of a
+	// custom text field starts with query, best matches first.
+	SearchRooms(userid, query, order string, limit int) []*RoomSearchResult
+}
+
+// roomSearchWords returns the lower case words of text.
+func roomSearchWords(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(c rune) bool {
+		return !unicode.IsLetter(c) && !unicode.IsNumber(c)
+	})
+}
+
+// roomSearchMatch returns the quality of the match of query with the
+// room of result.
+func roomSearchMatch(result *RoomSearchResult, query string) int {
+	if strings.HasPrefix(strings.ToLower(result.Name), query) {
+		return roomSearchNamePrefix
+	}
+	for _, word := range roomSearchWords(result.Name) {
+		if strings.HasPrefix(word, query) {
+			return roomSearchWordPrefix
+		}
+	}
+	for _, value := range result.Fields {
+		if text, ok := value.(string); ok && strings.HasPrefix(strings.ToLower(text), query) {
+			return roomSearchFieldPrefix
+		}
+	}
+	return roomSearchNoMatch
+}
+
+func searchRooms(candidates []*RoomSearchResult, query, order string, limit int) []*RoomSearchResult {
+	query = strings.ToLower(strings.TrimSpace(query))
+	if limit <= 0 || limit > roomSearchMaxResults {
+		limit = roomSearchMaxResults
+	}
+	results := make([]*RoomSearchResult, 0, len(candidates))
+	for _, result := range candidates {
+		if result.match = roomSearchMatch(result, query); result.match != roomSearchNoMatch {
+			results = append(results, result)
+		}
+	}
+	sort.Sort(&roomSearchResults{results, order})
+	if len(results) > limit {
+		results = results[:limit]
+	}
+	return results
+}
+
+type roomSearchResults struct {
+	results []*RoomSearchResult
+	order   string
+}
+
+func (list *roomSearchResults) Len() int { return len(list.results) }
+func (list *roomSearchResults) Swap(i, j int) {
+	list.results[i], list.results[j] = list.results[j], list.results[i]
+}
+func (list *roomSearchResults) Less(i, j int) bool {
+	a, b := list.results[i], list.results[j]
+	if a.match != b.match {
+		return a.match < b.match
+	}
+	if list.order == RoomSearchRecent {
+		if !a.Active.Equal(b.Active) {
+			return a.Active.After(b.Active)
+		}
+	}
+	if a.Occupancy != b.Occupancy {
+		return a.Occupancy > b.Occupancy
+	}
+	if !a.Active.Equal(b.Active) {
+		return a.Active.After(b.Active)
+	}
+	return a.Id < b.Id
+}
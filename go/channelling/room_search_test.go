@@ -0,0 +1,70 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package channelling
+
+import (
+	"testing"
+	"time"
+)
+
+func Test_RoomSearch_RanksMatches(t *testing.T) {
+	now := time.Now()
+	candidates := []*RoomSearchResult{
+		{Id: "Room:team-release", Name: "team-release", Occupancy: 9, Active: now.Add(-time.Hour)},
+		{Id: "Room:release", Name: "release", Occupancy: 1, Active: now.Add(-2 * time.Hour)},
+		{Id: "Room:notes", Name: "notes", Fields: map[string]interface{}{"topic": "Release notes", "seats": 3}},
+		{Id: "Room:releases", Name: "Releases", Occupancy: 4, Active: now},
+		{Id: "Room:other", Name: "other", Occupancy: 20},
+	}
+
+	results := searchRooms(candidates, " Rel", "", 0)
+	expected := []string{"Room:releases", "Room:release", "Room:team-release", "Room:notes"}
+	if len(results) != len(expected) {
+		t.Fatalf("Expected %d results, but got %d", len(expected), len(results))
+	}
+	for i, id := range expected {
+		if results[i].Id != id {
+			t.Errorf("Expected %s at %d, but got %s", id, i, results[i].Id)
+		}
+	}
+
+	if results = searchRooms(candidates, "", RoomSearchRecent, 2); len(results) != 2 || results[0].Id != "Room:releases" || results[1].Id != "Room:team-release" {
+		t.Errorf("Expected the most recent rooms, but got %v", results)
+	}
+}
+
+func Test_RoomManager_SearchRooms_HidesProtectedRooms(t *testing.T) {
+	roomManager, _ := NewTestRoomManager()
+	roomManager.JoinRoom(RoomTypeRoom+":public", "public", RoomTypeRoom, "", nil, &Session{Id: "a"}, false, nil)
+	alice := &Session{Id: "b", userid: "alice"}
+	roomManager.JoinRoom(RoomTypeRoom+":private", "private", RoomTypeRoom, "", &DataRoomCredentials{PIN: "1234"}, alice, true, nil)
+
+	if results := roomManager.SearchRooms("", "p", "", 0); len(results) != 1 || results[0].Name != "public" {
+		t.Errorf("Expected only the public room for anonymous users, but got %v", results)
+	}
+	if results := roomManager.SearchRooms("bob", "p", "", 0); len(results) != 1 {
+		t.Errorf("Expected only the public room for other users, but got %v", results)
+	}
+	if results := roomManager.SearchRooms("alice", "p", "", 0); len(results) != 2 {
+		t.Errorf("Expected the room with a PIN to be visible to its owner, but got %v", results)
+	}
+}
@@ -0,0 +1,77 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package channelling
+
+import (
+	"regexp"
+	"time"
+)
+
+const (
+	RoomFeatureChat       = "chat"
+	RoomFeatureRecording  = "recording"
+	RoomFeatureChatFilter = "chatfilter" // Chat messages pass the configured chat filters.
+	RoomFeatureDialOut    = "dialout"    // Moderators may call phone numbers into the room.
+	RoomFeatureMonitoring = "monitoring" // Moderators may monitor calls and whisper to agents.
+)
+
+const (
+	// RoomTurnPolicyDefault lets clients use all ICE candidates.
+	RoomTurnPolicyDefault = "default"
+	// RoomTurnPolicyRelay makes clients only use TURN relay candidates,
+	// which hides the addresses of participants from each other.
+	RoomTurnPolicyRelay = "relay"
+)
+
+// RoomTemplate holds the settings new rooms inherit. Templates apply to
+// rooms with a name matching Pattern or which are created with an explicit
+// template selection.
+type RoomTemplate struct {
+	Name     string
+	Pattern  *regexp.Regexp // Room names this template applies to, if any.
+	Type     string         // Room type, empty to keep the configured type.
+	Capacity int            // Maximum number of sessions, 0 for no limit.
+	Locked   bool           // New rooms start locked.
+	Features []string       // Enabled features, empty to enable all.
+	Turn     string         // TURN policy.
+	Queue    string         // Call distribution strategy of queue rooms, empty for other rooms.
+	// Time agents of queue rooms stay in wrap-up after a call, 0 until
+	// they become available themselves.
+	QueueWrapUp time.Duration
+	// Index the room chat for search, if the server has a chat index.
+	ChatIndex bool
+	// Screen sharing limits, nil for no limits.
+	ScreenShare *DataScreenShare
+}
+
+// HasFeature returns true if feature is enabled by the template.
+func (template *RoomTemplate) HasFeature(feature string) bool {
+	if template == nil || len(template.Features) == 0 {
+		return true
+	}
+	for _, f := range template.Features {
+		if f == feature {
+			return true
+		}
+	}
+	return false
+}
@@ -32,8 +32,10 @@ import (
 
 const (
 	roomMaxWorkers     = 10000
-	roomExpiryDuration = 60 * time.Second
+	roomExpiryDuration = 60 * time.Second // Default for Config.RoomExpiry
 	maxUsersLength     = 5000
+	roomMaxVolatile    = 256  // Maximum number of volatile keys per room.
+	roomMaxLog         = 1000 // Maximum number of participant log entries per room.
 )
 
 type RoomWorker interface {
@@ -42,10 +44,46 @@ type RoomWorker interface {
 	Users() []*roomUser
 	Update(*DataRoom) error
 	GetUsers() []*DataSession
-	Broadcast(sessionID string, buf buffercache.Buffer)
+	Broadcast(sessionID string, buf buffercache.Buffer, presence bool)
+	BroadcastAccessibility(sessionID string, buf buffercache.Buffer, kind string)
 	Join(*DataRoomCredentials, *Session, Sender) (*DataRoom, error)
 	Leave(sessionID string)
 	GetType() string
+	GetName() string
+	GetOwner() string
+	SetOwner(userid string)
+	SetLocked(locked bool)
+	GetTemplate() *RoomTemplate
+	SetTemplate(template *RoomTemplate)
+	GetMute() *DataMute
+	SetMute(mute *DataMute)
+	GetPermissions() *DataPermissions
+	SetPermissions(permissions *DataPermissions)
+	GetFollow() *DataFollow
+	SetFollow(follow *DataFollow, interval time.Duration) error
+	GetTimer() *DataTimer
+	SetTimer(timer *DataTimer)
+	IsRecording() bool
+	SetRecording(active bool)
+	SetRecordingConsent(sessionID string, consent bool) (map[string]bool, error)
+	RecordingConsents() map[string]bool
+	GetVolatile() []*DataVolatile
+	SetVolatile(sessionID string, volatile *DataVolatile) error
+	GetScreenShare() *DataScreenShare
+	SetScreenShare(screenShare *DataScreenShare) *DataRoom
+	GetMediaMode() *DataMediaMode
+	SetMediaModeReady(sessionID string, sequence uint64)
+	SetQueueAgent(sessionID string, state string)
+	QueueCallEnded(a, b string)
+	GetBandwidthCap() *DataBandwidthCap
+	SetBandwidth(sessionID string, report *DataBandwidth) (*DataBandwidthCap, bool)
+	ParticipantLog() []*RoomParticipantEvent
+	ExpireLog(before time.Time, dryRun bool) int
+	UserData(userid string) *UserRoomData
+	SearchResult(userid string) *RoomSearchResult
+	EraseUser(userid string) bool
+	Snapshot() *RoomSnapshot
+	Restore(snapshot *RoomSnapshot, template *RoomTemplate)
 }
 
 type roomWorker struct {
@@ -57,31 +95,60 @@ type roomWorker struct {
 	expired chan (bool)
 	users   map[string]*roomUser
 	timer   *time.Timer
+	expiry  time.Duration
 	mutex   sync.RWMutex
 
 	// Metadata.
 	id          string
 	name        string
 	roomType    string
+	owner       string
+	locked      bool
+	template    *RoomTemplate
+	mute        *DataMute
+	permissions *DataPermissions
+	follow      *DataFollow
+	followed    time.Time
+	countdown   *DataTimer
+	recording   bool
+	consents    map[string]bool
+	volatile    map[string]map[string]*DataVolatile // Map of session id -> key -> latest value.
+	bandwidth   map[string]*DataBandwidth           // Map of session id -> latest bandwidth report.
+	videoCap    int
+	screenShare *DataScreenShare // Screen sharing limits set for this room, overriding the template.
+	mediaMode   string           // Media mode of calls, empty for mesh.
+	mediaSwitch *DataMediaMode   // Media mode switch being prepared.
+	mediaReady  map[string]bool  // Sessions ready for the prepared switch.
+	mediaSeq    uint64
+	queue       *callQueue              // Callers and agents of a queue room.
+	fields      map[string]interface{}  // Custom fields, replaced on updates.
+	log         []*RoomParticipantEvent // Latest joins and leaves, oldest first.
 	credentials *DataRoomCredentials
 }
 
 type roomUser struct {
 	*Session
 	Sender
+	userid string // Userid when joining, for the participant log.
 }
 
 func NewRoomWorker(manager *roomManager, roomID, roomName, roomType string, credentials *DataRoomCredentials) RoomWorker {
 	log.Printf("Creating worker for room '%s'\n", roomID)
 
 	r := &roomWorker{
-		manager:  manager,
-		id:       roomID,
-		name:     roomName,
-		roomType: roomType,
-		workers:  make(chan func(), roomMaxWorkers),
-		expired:  make(chan bool),
-		users:    make(map[string]*roomUser),
+		manager:   manager,
+		id:        roomID,
+		name:      roomName,
+		roomType:  roomType,
+		workers:   make(chan func(), roomMaxWorkers),
+		expired:   make(chan bool),
+		users:     make(map[string]*roomUser),
+		volatile:  make(map[string]map[string]*DataVolatile),
+		bandwidth: make(map[string]*DataBandwidth),
+		expiry:    manager.RoomExpiry,
+	}
+	if r.expiry <= 0 {
+		r.expiry = roomExpiryDuration
 	}
 
 	if credentials != nil && len(credentials.PIN) > 0 {
@@ -89,7 +156,7 @@ func NewRoomWorker(manager *roomManager, roomID, roomName, roomType string, cred
 	}
 
 	// Create expire timer.
-	r.timer = time.AfterFunc(roomExpiryDuration, func() {
+	r.timer = time.AfterFunc(r.expiry, func() {
 		r.expired <- true
 	})
 
@@ -100,7 +167,7 @@ func (r *roomWorker) Start() {
 	// Main blocking worker.
 L:
 	for {
-		r.timer.Reset(roomExpiryDuration)
+		r.timer.Reset(r.expiry)
 		select {
 		case w := <-r.workers:
 			//fmt.Println("Running worker", r.Id, w)
@@ -110,7 +177,8 @@ L:
 			//fmt.Println("Work room expired", r.Id, len(r.connections))
 			r.mutex.RLock()
 			if len(r.users) == 0 {
-				// Cleanup room when it is empty.
+				// Cleanup room when it was empty for the whole expiry
+				// duration, state like the PIN is kept until then.
 				r.mutex.RUnlock()
 				log.Printf("Room worker not in use - cleaning up '%s'\n", r.id)
 				break L
@@ -151,6 +219,697 @@ func (r *roomWorker) GetType() string {
 	return r.roomType
 }
 
+func (r *roomWorker) GetName() string {
+	return r.name
+}
+
+// GetOwner returns the userid of the room owner, or an empty string if the
+// room has no owner.
+func (r *roomWorker) GetOwner() string {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return r.owner
+}
+
+func (r *roomWorker) SetOwner(userid string) {
+	r.mutex.Lock()
+	r.owner = userid
+	r.mutex.Unlock()
+}
+
+// SetLocked locks or unlocks the room. Locked rooms can only be joined by
+// the owner and with moderator links.
+func (r *roomWorker) SetLocked(locked bool) {
+	r.mutex.Lock()
+	r.locked = locked
+	r.mutex.Unlock()
+}
+
+// GetMute returns a copy of the current mute all state of the room, or nil
+// if the room is not muted.
+func (r *roomWorker) GetMute() *DataMute {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	if r.mute == nil {
+		return nil
+	}
+	mute := *r.mute
+	return &mute
+}
+
+// SetMute sets the mute all state of the room, which is sent to sessions
+// joining later.
+func (r *roomWorker) SetMute(mute *DataMute) {
+	r.mutex.Lock()
+	if mute != nil && !mute.Audio && !mute.Video {
+		mute = nil
+	}
+	r.mute = mute
+	r.mutex.Unlock()
+}
+
+// GetPermissions returns a copy of the permissions matrix of the room, or
+// nil if everyone may do everything.
+func (r *roomWorker) GetPermissions() *DataPermissions {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	if r.permissions == nil {
+		return nil
+	}
+	permissions := *r.permissions
+	return &permissions
+}
+
+// SetPermissions sets the permissions matrix of the room.
+func (r *roomWorker) SetPermissions(permissions *DataPermissions) {
+	r.mutex.Lock()
+	if permissions != nil && permissions.Empty() {
+		permissions = nil
+	}
+	r.permissions = permissions
+	r.mutex.Unlock()
+}
+
+func (r *roomWorker) GetFollow() *DataFollow {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return r.follow
+}
+
+// SetFollow remembers the URL or slide pushed to the room, if the last push
+// was at least interval ago.
+func (r *roomWorker) SetFollow(follow *DataFollow, interval time.Duration) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	now := time.Now()
+	if interval > 0 && now.Sub(r.followed) < interval {
+		return NewDataError("rate_limited", "Too many follow requests")
+	}
+	r.follow = follow
+	r.followed = now
+	return nil
+}
+
+// GetTimer returns a copy of the running timer of the room with the current
+// server time, or nil if no timer is running.
+func (r *roomWorker) GetTimer() *DataTimer {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	if r.countdown == nil {
+		return nil
+	}
+	now := time.Now().UnixNano() / int64(time.Millisecond)
+	if now >= r.countdown.Ends {
+		return nil
+	}
+	timer := *r.countdown
+	timer.Now = now
+	return &timer
+}
+
+// SetTimer starts the countdown timer of the room, or stops it if timer is
+// nil.
+func (r *roomWorker) SetTimer(timer *DataTimer) {
+	r.mutex.Lock()
+	r.countdown = timer
+	r.mutex.Unlock()
+}
+
+func (r *roomWorker) GetTemplate() *RoomTemplate {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return r.template
+}
+
+// SetTemplate applies template to the room, which locks the room if the
+// template says so.
+func (r *roomWorker) SetTemplate(template *RoomTemplate) {
+	r.mutex.Lock()
+	r.template = template
+	if template != nil && template.Locked {
+		r.locked = true
+	}
+	r.mutex.Unlock()
+}
+
+func (r *roomWorker) IsRecording() bool {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return r.recording
+}
+
+// SetRecording starts or stops recording the room. All recorded consents
+// are reset.
+func (r *roomWorker) SetRecording(active bool) {
+	r.mutex.Lock()
+	r.recording = active
+	r.consents = make(map[string]bool)
+	r.mutex.Unlock()
+}
+
+// SetRecordingConsent records the answer of a session to the consent
+// request and returns a copy of all consents.
+func (r *roomWorker) SetRecordingConsent(sessionID string, consent bool) (map[string]bool, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if !r.recording {
+		return nil, NewDataError("not_recording", "The room is not being recorded")
+	}
+	r.consents[sessionID] = consent
+	return r.copyConsents(), nil
+}
+
+// RecordingConsents returns a copy of the consents of the current
+// recording.
+func (r *roomWorker) RecordingConsents() map[string]bool {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return r.copyConsents()
+}
+
+func (r *roomWorker) copyConsents() map[string]bool {
+	consents := make(map[string]bool, len(r.consents))
+	for id, consent := range r.consents {
+		consents[id] = consent
+	}
+	return consents
+}
+
+// GetVolatile returns the latest volatile values of all sessions in the
+// room.
+func (r *roomWorker) GetVolatile() []*DataVolatile {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	var values []*DataVolatile
+	for sessionID, keys := range r.volatile {
+		for _, volatile := range keys {
+			values = append(values, &DataVolatile{
+				Type: "Volatile",
+				Key:  volatile.Key,
+				From: sessionID,
+				Data: volatile.Data,
+			})
+		}
+	}
+	return values
+}
+
+// SetVolatile remembers the latest value of a key of a session, or removes
+// the key if the value is nil. Values are removed when the session leaves.
+func (r *roomWorker) SetVolatile(sessionID string, volatile *DataVolatile) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	keys, ok := r.volatile[sessionID]
+	if volatile.Data == nil {
+		if ok {
+			delete(keys, volatile.Key)
+			if len(keys) == 0 {
+				delete(r.volatile, sessionID)
+			}
+		}
+		return nil
+	}
+	if _, exists := keys[volatile.Key]; !exists {
+		count := 0
+		for _, keys := range r.volatile {
+			count += len(keys)
+		}
+		if count >= roomMaxVolatile {
+			return NewDataError("too_many_volatile_keys", "Too many volatile keys in the room")
+		}
+	}
+	if !ok {
+		keys = make(map[string]*DataVolatile)
+		r.volatile[sessionID] = keys
+	}
+	keys[volatile.Key] = volatile
+	return nil
+}
+
+// Snapshot returns the state of the room which survives a server restart.
+// dataRoom returns the Room document of the room. It must be called with
+// the lock held.
+func (r *roomWorker) dataRoom() *DataRoom {
+	// NOTE(lcooper): Needs to be a copy, else we risk races with
+	// a subsequent modification of room properties.
+	room := &DataRoom{Name: r.name, Type: r.roomType, Owner: r.owner}
+	if r.template != nil {
+		room.Capacity = r.template.Capacity
+		room.Features = r.template.Features
+		room.Turn = r.template.Turn
+	}
+	room.ScreenShare = r.getScreenShare()
+	room.Fields = r.fields
+	return room
+}
+
+// GetScreenShare returns the screen sharing limits of the room, nil if
+// screen sharing is not limited.
+func (r *roomWorker) GetScreenShare() *DataScreenShare {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return r.getScreenShare()
+}
+
+func (r *roomWorker) getScreenShare() *DataScreenShare {
+	if r.screenShare != nil {
+		return r.screenShare
+	}
+	if r.template != nil {
+		return r.template.ScreenShare
+	}
+	return nil
+}
+
+// SetScreenShare overrides the screen sharing limits of the template of
+// the room, nil restores them. It returns the updated Room document.
+func (r *roomWorker) SetScreenShare(screenShare *DataScreenShare) *DataRoom {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.screenShare = screenShare
+	return r.dataRoom()
+}
+
+// GetMediaMode returns the prepared media mode switch of the room, or the
+// current mode if it is not mesh, else nil.
+func (r *roomWorker) GetMediaMode() *DataMediaMode {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	if r.mediaSwitch != nil {
+		return r.mediaSwitch
+	}
+	if r.mediaMode == "" || r.mediaMode == MediaModeMesh {
+		return nil
+	}
+	return &DataMediaMode{Type: "MediaMode", Mode: r.mediaMode, Phase: MediaModePhaseSwitch, Sequence: r.mediaSeq}
+}
+
+// SetMediaModeReady records that sessionID set up the connections of the
+// prepared media mode switch sequence. The switch is announced once all
+// participants are ready.
+func (r *roomWorker) SetMediaModeReady(sessionID string, sequence uint64) {
+	r.mutex.Lock()
+	if r.mediaSwitch == nil || r.mediaSwitch.Sequence != sequence {
+		r.mutex.Unlock()
+		return
+	}
+	if _, ok := r.users[sessionID]; ok {
+		r.mediaReady[sessionID] = true
+	}
+	mode := r.completeMediaMode(false)
+	participants := len(r.users)
+	r.mutex.Unlock()
+	if mode != nil {
+		r.manager.announceMediaMode(r.id, mode, participants)
+	}
+}
+
+// updateMediaMode applies the media mode policy to the current number of
+// participants and returns the document to broadcast, if any. The room lock
+// must be held.
+func (r *roomWorker) updateMediaMode() *DataMediaMode {
+	policy := r.manager.mediaModePolicy
+	if policy == nil {
+		return nil
+	}
+	current := r.mediaMode
+	if current == "" {
+		current = MediaModeMesh
+	}
+	target := policy.MediaMode(current, len(r.users))
+	switch {
+	case r.mediaSwitch != nil && r.mediaSwitch.Mode == target:
+		// Participants who left do not hold up the switch.
+		return r.completeMediaMode(false)
+	case r.mediaSwitch != nil:
+		// The room changed its mind before all were ready, stay.
+		r.mediaSwitch = nil
+		r.mediaReady = nil
+		r.mediaSeq++
+		return &DataMediaMode{Type: "MediaMode", Mode: current, Phase: MediaModePhaseSwitch, Sequence: r.mediaSeq}
+	case target != current:
+		r.mediaSeq++
+		r.mediaSwitch = &DataMediaMode{Type: "MediaMode", Mode: target, Phase: MediaModePhasePrepare, Sequence: r.mediaSeq}
+		r.mediaReady = make(map[string]bool)
+		if timeout := r.manager.MediaModeTimeout; timeout > 0 {
+			sequence := r.mediaSeq
+			time.AfterFunc(timeout, func() {
+				r.mutex.Lock()
+				var mode *DataMediaMode
+				if r.mediaSwitch != nil && r.mediaSwitch.Sequence == sequence {
+					mode = r.completeMediaMode(true)
+				}
+				participants := len(r.users)
+				r.mutex.Unlock()
+				if mode != nil {
+					r.manager.announceMediaMode(r.id, mode, participants)
+				}
+			})
+		}
+		return r.mediaSwitch
+	}
+	return nil
+}
+
+// SetQueueAgent sets the state of sessionID as agent of the call queue.
+// Agents are on a call after they were handed a caller and in wrap-up
+// after the call ended, until the wrap-up time of the room passed.
+func (r *roomWorker) SetQueueAgent(sessionID string, state string) {
+	r.mutex.Lock()
+	queue := r.callQueue()
+	if _, ok := r.users[sessionID]; !ok || queue == nil {
+		r.mutex.Unlock()
+		return
+	}
+	changed := queue.position(sessionID) > 0
+	queue.setAgent(sessionID, state, time.Now())
+	notices := r.updateQueue(changed)
+	r.mutex.Unlock()
+	r.sendNotices(notices)
+}
+
+// QueueCallEnded moves the agent of a call between the sessions a and b
+// to wrap-up.
+func (r *roomWorker) QueueCallEnded(a, b string) {
+	r.mutex.Lock()
+	if r.queue == nil || r.queue.callEnded(a, b, time.Now()) == nil {
+		r.mutex.Unlock()
+		return
+	}
+	notices := r.updateQueue(false)
+	r.mutex.Unlock()
+	r.sendNotices(notices)
+}
+
+// callQueue returns the call queue of the room, or nil if the room is no
+// queue room. Call with the lock held.
+func (r *roomWorker) callQueue() *callQueue {
+	if r.queue == nil && r.template != nil && r.template.Queue != "" {
+		r.queue = newCallQueue(r.template.Queue)
+	}
+	return r.queue
+}
+
+// roomNotice is a document for a single user of the room, or for all
+// users if user is nil.
+type roomNotice struct {
+	user *roomUser
+	data interface{}
+}
+
+// updateQueue hands waiting callers to available agents and returns the
+// notices for the agents and callers. All callers are told their position
+// if changed is true or callers were handed over. Agents in wrap-up become
+// available after the wrap-up time. Call with the lock held.
+func (r *roomWorker) updateQueue(changed bool) []roomNotice {
+	var notices []roomNotice
+	assignments := r.queue.distribute(time.Now())
+	for _, assignment := range assignments {
+		log.Printf("Call queue of room %s: handing caller %s to agent %s\n", r.id, assignment.caller, assignment.agent)
+		if user, ok := r.users[assignment.agent]; ok {
+			notices = append(notices, roomNotice{user, &DataQueueAgent{Type: "QueueAgent", State: AgentStateOnCall, Caller: assignment.caller}})
+		}
+		if user, ok := r.users[assignment.caller]; ok {
+			notices = append(notices, roomNotice{user, &DataQueue{Type: "Queue", Length: len(r.queue.callers), Agent: assignment.agent}})
+		}
+	}
+	for _, state := range r.queue.changes() {
+		notices = append(notices, roomNotice{nil, state})
+		if agent := r.queue.agent(state.Id); agent != nil && agent.state == AgentStateWrapUp && r.template != nil && r.template.QueueWrapUp > 0 {
+			r.scheduleWrapUp(agent, r.template.QueueWrapUp)
+		}
+	}
+	if !changed && len(assignments) == 0 {
+		return notices
+	}
+	for idx, caller := range r.queue.callers {
+		if user, ok := r.users[caller]; ok {
+			notices = append(notices, roomNotice{user, &DataQueue{Type: "Queue", Position: idx + 1, Length: len(r.queue.callers)}})
+		}
+	}
+	return notices
+}
+
+// scheduleWrapUp makes agent available after wrapUp unless its state
+// changed meanwhile. Call with the lock held.
+func (r *roomWorker) scheduleWrapUp(agent *callQueueAgent, wrapUp time.Duration) {
+	id, sequence := agent.id, agent.sequence
+	time.AfterFunc(wrapUp, func() {
+		r.mutex.Lock()
+		var notices []roomNotice
+		if agent := r.queue.agent(id); agent != nil && agent.sequence == sequence {
+			r.queue.setState(agent, AgentStateAvailable, time.Now())
+			notices = r.updateQueue(false)
+		}
+		r.mutex.Unlock()
+		r.sendNotices(notices)
+	})
+}
+
+// agentStates returns notices with the states of all agents for user.
+// Call with the lock held.
+func (r *roomWorker) agentStates(user *roomUser) []roomNotice {
+	var notices []roomNotice
+	for _, agent := range r.queue.agents {
+		notices = append(notices, roomNotice{user, &DataAgentState{Type: "AgentState", Id: agent.id, State: agent.state}})
+	}
+	return notices
+}
+
+// sendNotices sends each notice to its user, or broadcasts it to the room.
+// Call without holding the lock.
+func (r *roomWorker) sendNotices(notices []roomNotice) {
+	for _, notice := range notices {
+		if notice.user == nil {
+			r.manager.Broadcast("", r.id, &DataOutgoing{Data: notice.data})
+			continue
+		}
+		if notice.user.Sender == nil {
+			continue
+		}
+		if message, err := r.manager.EncodeOutgoing(&DataOutgoing{Data: notice.data}); err == nil {
+			notice.user.Send(message)
+			message.Decref()
+		}
+	}
+}
+
+// completeMediaMode switches to the prepared media mode once all
+// participants are ready, or anyway if force is set. The room lock must be
+// held.
+func (r *roomWorker) completeMediaMode(force bool) *DataMediaMode {
+	if !force {
+		for id := range r.users {
+			if !r.mediaReady[id] {
+				return nil
+			}
+		}
+	}
+	r.mediaMode = r.mediaSwitch.Mode
+	r.mediaSwitch = nil
+	r.mediaReady = nil
+	return &DataMediaMode{Type: "MediaMode", Mode: r.mediaMode, Phase: MediaModePhaseSwitch, Sequence: r.mediaSeq}
+}
+
+// GetBandwidthCap returns the current video bandwidth cap of the room, or
+// nil if video is not capped.
+func (r *roomWorker) GetBandwidthCap() *DataBandwidthCap {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	if r.videoCap == 0 {
+		return nil
+	}
+	return &DataBandwidthCap{Type: "BandwidthCap", Video: r.videoCap}
+}
+
+// SetBandwidth remembers the latest bandwidth report of a session and
+// applies the bandwidth policy of the room. The returned cap is only valid
+// if it changed because of the report.
+func (r *roomWorker) SetBandwidth(sessionID string, report *DataBandwidth) (*DataBandwidthCap, bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.bandwidth[sessionID] = report
+	if r.manager.bandwidthPolicy == nil {
+		return nil, false
+	}
+	videoCap := r.manager.bandwidthPolicy.VideoCap(r.bandwidth)
+	if videoCap == r.videoCap {
+		return nil, false
+	}
+	r.videoCap = videoCap
+	return &DataBandwidthCap{Type: "BandwidthCap", Video: videoCap}, true
+}
+
+// appendLog records a participant event. The room lock must be held.
+func (r *roomWorker) appendLog(event, sessionID, userid string) {
+	if len(r.log) >= roomMaxLog {
+		r.log = r.log[1:]
+	}
+	r.log = append(r.log, &RoomParticipantEvent{time.Now(), event, sessionID, userid})
+}
+
+// ParticipantLog returns the latest joins and leaves of the room.
+func (r *roomWorker) ParticipantLog() []*RoomParticipantEvent {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	log := make([]*RoomParticipantEvent, len(r.log))
+	for i, event := range r.log {
+		copied := *event
+		log[i] = &copied
+	}
+	return log
+}
+
+// ExpireLog removes participant log entries older than before and returns
+// their number. With dryRun, entries are only counted.
+func (r *roomWorker) ExpireLog(before time.Time, dryRun bool) int {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	count := 0
+	for count < len(r.log) && r.log[count].Time.Before(before) {
+		count++
+	}
+	if !dryRun {
+		r.log = r.log[count:]
+	}
+	return count
+}
+
+// UserData returns the data the room retains about userid, or nil if
+// there is none.
+func (r *roomWorker) UserData(userid string) *UserRoomData {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	var log []*RoomParticipantEvent
+	for _, event := range r.log {
+		if event.Userid == userid {
+			copied := *event
+			log = append(log, &copied)
+		}
+	}
+	if log == nil && r.owner != userid {
+		return nil
+	}
+	return &UserRoomData{r.id, r.owner == userid, log}
+}
+
+// SearchResult returns the room as room search result, or nil if it is
+// hidden from userid. Locked rooms and rooms with a PIN are only visible to
+// their owner and to users in the participant log.
+func (r *roomWorker) SearchResult(userid string) *RoomSearchResult {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	if r.locked || r.credentials != nil {
+		if userid == "" {
+			return nil
+		}
+		visible := r.owner == userid
+		for _, event := range r.log {
+			if visible {
+				break
+			}
+			visible = event.Userid == userid
+		}
+		if !visible {
+			return nil
+		}
+	}
+
+	result := &RoomSearchResult{
+		Id:        r.id,
+		Name:      r.name,
+		Type:      r.roomType,
+		Occupancy: len(r.users),
+	}
+	if r.template != nil {
+		result.Template = r.template.Name
+	}
+	if len(r.log) > 0 {
+		result.Active = r.log[len(r.log)-1].Time
+	}
+	if len(r.fields) > 0 {
+		result.Fields = make(map[string]interface{}, len(r.fields))
+		for key, value := range r.fields {
+			result.Fields[key] = value
+		}
+	}
+	return result
+}
+
+// EraseUser removes userid from the participant log and clears the room
+// owner if it is userid. Returns true if anything was changed.
+func (r *roomWorker) EraseUser(userid string) bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	changed := false
+	for _, event := range r.log {
+		if event.Userid == userid {
+			event.Userid = ""
+			changed = true
+		}
+	}
+	for _, user := range r.users {
+		if user.userid == userid {
+			user.userid = ""
+		}
+	}
+	if r.owner == userid {
+		r.owner = ""
+		changed = true
+	}
+	return changed
+}
+
+func (r *roomWorker) Snapshot() *RoomSnapshot {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	snapshot := &RoomSnapshot{
+		Id:          r.id,
+		Name:        r.name,
+		Type:        r.roomType,
+		Owner:       r.owner,
+		Locked:      r.locked,
+		Mute:        r.mute,
+		Permissions: r.permissions,
+		Follow:      r.follow,
+		Timer:       r.countdown,
+		Recording:   r.recording,
+		ScreenShare: r.screenShare,
+	}
+	if r.template != nil {
+		snapshot.Template = r.template.Name
+	}
+	if r.credentials != nil {
+		snapshot.Credentials = &DataRoomCredentials{PIN: r.credentials.PIN}
+	}
+	if r.recording {
+		snapshot.Consents = r.copyConsents()
+	}
+	return snapshot
+}
+
+// Restore applies the state of a snapshot to a new room.
+func (r *roomWorker) Restore(snapshot *RoomSnapshot, template *RoomTemplate) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.owner = snapshot.Owner
+	r.template = template
+	r.locked = snapshot.Locked
+	r.mute = snapshot.Mute
+	r.permissions = snapshot.Permissions
+	r.follow = snapshot.Follow
+	r.countdown = snapshot.Timer
+	r.recording = snapshot.Recording
+	r.screenShare = snapshot.ScreenShare
+	r.consents = make(map[string]bool)
+	for id, consent := range snapshot.Consents {
+		r.consents[id] = consent
+	}
+	if snapshot.Credentials != nil && len(snapshot.Credentials.PIN) > 0 {
+		r.credentials = &DataRoomCredentials{PIN: snapshot.Credentials.PIN}
+	}
+}
+
 func (r *roomWorker) Run(f func()) bool {
 	select {
 	case r.workers <- f:
@@ -165,9 +924,14 @@ func (r *roomWorker) Update(room *DataRoom) error {
 	fault := make(chan error, 1)
 	worker := func() {
 		r.mutex.Lock()
-		// Enforce room type and name.
+		// Enforce room type, name and owner.
 		room.Type = r.roomType
 		room.Name = r.name
+		room.Owner = r.owner
+		if room.Fields != nil {
+			r.fields = MergeCustomFields(r.fields, room.Fields)
+		}
+		room.Fields = r.fields
 		// Update credentials.
 		if room.Credentials != nil {
 			if len(room.Credentials.PIN) > 0 {
@@ -226,15 +990,28 @@ func (r *roomWorker) GetUsers() []*DataSession {
 	return <-out
 }
 
-func (r *roomWorker) Broadcast(sessionID string, message buffercache.Buffer) {
+// Broadcast sends message to all users in the room except sessionID.
+// Presence updates are dropped first for slow consumers. Broadcasts are run
+// by the broadcast scheduler of the manager if set, else by the room worker.
+func (r *roomWorker) Broadcast(sessionID string, message buffercache.Buffer, presence bool) {
 	worker := func() {
+		from := r.senderUserid(sessionID)
 		r.mutex.RLock()
 		for id, user := range r.users {
 			if id == sessionID || user.Sender == nil {
 				// Skip broadcast to self or non existing sender.
 				continue
 			}
+			if from != "" && r.manager.blocklist.IsBlocked(user.Userid(), from) {
+				continue
+			}
 			//fmt.Printf("%s\n", m.Message)
+			if presence {
+				if sender, ok := user.Sender.(PresenceSender); ok {
+					sender.SendPresence(message)
+					continue
+				}
+			}
 			user.Send(message)
 		}
 		r.mutex.RUnlock()
@@ -242,9 +1019,64 @@ func (r *roomWorker) Broadcast(sessionID string, message buffercache.Buffer) {
 	}
 
 	message.Incref()
+	if scheduler := r.manager.scheduler; scheduler != nil {
+		r.mutex.RLock()
+		cost := len(r.users)
+		r.mutex.RUnlock()
+		if !scheduler.Submit(r.id, cost, worker) {
+			message.Decref()
+		}
+		return
+	}
 	r.Run(worker)
 }
 
+// BroadcastAccessibility sends message to all users in the room except
+// sessionID which subscribed to accessibility events of kind. The message
+// is delivered right away with priority, bypassing the broadcast scheduler
+// and the room worker.
+func (r *roomWorker) BroadcastAccessibility(sessionID string, message buffercache.Buffer, kind string) {
+	from := r.senderUserid(sessionID)
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	for id, user := range r.users {
+		if id == sessionID || user.Sender == nil || user.Session == nil || !user.AccessibilitySubscribed(kind) {
+			continue
+		}
+		if from != "" && r.manager.blocklist.IsBlocked(user.Userid(), from) {
+			continue
+		}
+		if sender, ok := user.Sender.(PrioritySender); ok {
+			sender.SendPriority(message)
+			continue
+		}
+		user.Send(message)
+	}
+}
+
+// senderUserid returns the userid of the broadcasting session sessionID,
+// if blocklists apply. Sessions of the global room broadcast to all rooms.
+func (r *roomWorker) senderUserid(sessionID string) string {
+	if r.manager.blocklist == nil {
+		return ""
+	}
+	r.mutex.RLock()
+	user, ok := r.users[sessionID]
+	r.mutex.RUnlock()
+	if !ok && r.id != r.manager.globalRoomID {
+		for _, global := range r.manager.GlobalUsers() {
+			if global.Id == sessionID {
+				user, ok = global, true
+				break
+			}
+		}
+	}
+	if !ok || user.Session == nil {
+		return ""
+	}
+	return user.Userid()
+}
+
 type joinResult struct {
 	*DataRoom
 	error
@@ -254,11 +1086,19 @@ func (r *roomWorker) Join(credentials *DataRoomCredentials, session *Session, se
 	results := make(chan joinResult, 1)
 	worker := func() {
 		r.mutex.Lock()
-		if r.credentials == nil && credentials != nil {
+		// Credentials with a room link were verified by the room manager.
+		linked := credentials != nil && credentials.link != nil
+		// The caller holds the session lock, so access the field directly.
+		if r.locked && (r.owner == "" || session.userid != r.owner) && (!linked || credentials.link.Role != RoomRoleModerator) {
+			results <- joinResult{nil, NewDataError("room_locked", "The room is locked")}
+			r.mutex.Unlock()
+			return
+		}
+		if r.credentials == nil && credentials != nil && !linked {
 			results <- joinResult{nil, NewDataError("authorization_not_required", "No credentials may be provided for this room")}
 			r.mutex.Unlock()
 			return
-		} else if r.credentials != nil {
+		} else if r.credentials != nil && !linked {
 			if credentials == nil {
 				results <- joinResult{nil, NewDataError("authorization_required", "Valid credentials are required to join this room")}
 				r.mutex.Unlock()
@@ -272,12 +1112,34 @@ func (r *roomWorker) Join(credentials *DataRoomCredentials, session *Session, se
 			}
 		}
 
-		r.users[session.Id] = &roomUser{session, sender}
-		// NOTE(lcooper): Needs to be a copy, else we risk races with
-		// a subsequent modification of room properties.
-		result := joinResult{&DataRoom{Name: r.name, Type: r.roomType}, nil}
+		if _, ok := r.users[session.Id]; !ok && r.template != nil && r.template.Capacity > 0 && len(r.users) >= r.template.Capacity {
+			results <- joinResult{nil, NewDataError("room_full", "The room is full")}
+			r.mutex.Unlock()
+			return
+		}
+
+		if _, ok := r.users[session.Id]; !ok {
+			r.appendLog(RoomParticipantJoined, session.Id, session.userid)
+		}
+		r.users[session.Id] = &roomUser{session, sender, session.userid}
+		result := joinResult{r.dataRoom(), nil}
+		mode := r.updateMediaMode()
+		participants := len(r.users)
+		var notices []roomNotice
+		// Owners and moderators may become agents, everybody else waits
+		// for one.
+		if queue := r.callQueue(); queue != nil {
+			if (r.owner == "" || session.userid != r.owner) && (!linked || credentials.link.Role != RoomRoleModerator) {
+				notices = r.updateQueue(queue.addCaller(session.Id))
+			}
+			notices = append(notices, r.agentStates(r.users[session.Id])...)
+		}
 		r.mutex.Unlock()
 		results <- result
+		if mode != nil {
+			r.manager.announceMediaMode(r.id, mode, participants)
+		}
+		r.sendNotices(notices)
 	}
 	r.Run(worker)
 	result := <-results
@@ -288,10 +1150,23 @@ func (r *roomWorker) Join(credentials *DataRoomCredentials, session *Session, se
 func (r *roomWorker) Leave(sessionID string) {
 	worker := func() {
 		r.mutex.Lock()
-		if _, ok := r.users[sessionID]; ok {
+		if user, ok := r.users[sessionID]; ok {
 			delete(r.users, sessionID)
+			r.appendLog(RoomParticipantLeft, sessionID, user.userid)
+		}
+		delete(r.volatile, sessionID)
+		delete(r.bandwidth, sessionID)
+		mode := r.updateMediaMode()
+		participants := len(r.users)
+		var notices []roomNotice
+		if r.queue != nil {
+			notices = r.updateQueue(r.queue.remove(sessionID, time.Now()))
 		}
 		r.mutex.Unlock()
+		if mode != nil {
+			r.manager.announceMediaMode(r.id, mode, participants)
+		}
+		r.sendNotices(notices)
 	}
 	r.Run(worker)
 }
@@ -23,14 +23,13 @@ package channelling
 
 import (
 	"testing"
-
-	"github.com/strukturag/spreed-webrtc/go/channelling"
+	"time"
 )
 
 const (
-	testRoomID   string = channelling.RoomTypeRoom + ":a-room-name"
+	testRoomID   string = RoomTypeRoom + ":a-room-name"
 	testRoomName string = "a-room-name"
-	testRoomType string = channelling.RoomTypeRoom
+	testRoomType string = RoomTypeRoom
 )
 
 func NewTestRoomWorker() RoomWorker {
@@ -126,3 +125,130 @@ func Test_RoomWorker_Update_RetainsCredentialsWhenOtherPropertiesAreUpdated(t *t
 		t.Fatalf("Unexpected error joining room %v", err)
 	}
 }
+
+func Test_RoomWorker_Start_ExpiresEmptyRoomAfterConfiguredDuration(t *testing.T) {
+	worker := NewRoomWorker(&roomManager{Config: &Config{RoomExpiry: 10 * time.Millisecond}}, testRoomID, testRoomName, testRoomType, nil)
+	done := make(chan bool)
+	go func() {
+		worker.Start()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Expected empty room to expire")
+	}
+}
+
+func Test_RoomWorker_Join_FailsWhenRoomIsLocked(t *testing.T) {
+	worker := NewTestRoomWorker()
+	worker.SetOwner("owner")
+	worker.SetLocked(true)
+
+	_, err := worker.Join(nil, &Session{}, nil)
+	assertDataError(t, err, "room_locked")
+
+	if _, err = worker.Join(nil, &Session{userid: "owner"}, nil); err != nil {
+		t.Fatalf("Unexpected error %v joining locked room as owner", err)
+	}
+}
+
+func Test_RoomWorker_SetMute_KeepsStateForLateJoiners(t *testing.T) {
+	worker := NewTestRoomWorker()
+	if mute := worker.GetMute(); mute != nil {
+		t.Fatalf("Expected new room not to be muted, but got %+v", mute)
+	}
+
+	worker.SetMute(&DataMute{Type: "Mute", Audio: true})
+	if mute := worker.GetMute(); mute == nil || !mute.Audio || mute.Video {
+		t.Errorf("Expected audio mute, but got %+v", mute)
+	}
+
+	worker.SetMute(&DataMute{Type: "Mute"})
+	if mute := worker.GetMute(); mute != nil {
+		t.Errorf("Expected mute to be cleared, but got %+v", mute)
+	}
+}
+
+func Test_RoomWorker_SetRecordingConsent_RequiresRecording(t *testing.T) {
+	worker := NewTestRoomWorker()
+	_, err := worker.SetRecordingConsent("a", true)
+	assertDataError(t, err, "not_recording")
+
+	worker.SetRecording(true)
+	worker.SetRecordingConsent("a", true)
+	consents, err := worker.SetRecordingConsent("b", false)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if len(consents) != 2 || !consents["a"] || consents["b"] {
+		t.Errorf("Unexpected consents %v", consents)
+	}
+
+	worker.SetRecording(true)
+	if consents := worker.RecordingConsents(); len(consents) != 0 {
+		t.Errorf("Expected consents to be reset when recording restarts, but got %v", consents)
+	}
+}
+
+func Test_RoomWorker_SetFollow_IsRateLimited(t *testing.T) {
+	worker := NewTestRoomWorker()
+	if err := worker.SetFollow(&DataFollow{Type: "Follow", Slide: 1}, time.Minute); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	assertDataError(t, worker.SetFollow(&DataFollow{Type: "Follow", Slide: 2}, time.Minute), "rate_limited")
+	if follow := worker.GetFollow(); follow == nil || follow.Slide != 1 {
+		t.Errorf("Expected first follow request to be kept, but got %+v", follow)
+	}
+
+	if err := worker.SetFollow(&DataFollow{Type: "Follow", Slide: 2}, 0); err != nil {
+		t.Errorf("Unexpected error %v without rate limit", err)
+	}
+}
+
+func Test_RoomWorker_GetTimer_ReturnsRunningTimersOnly(t *testing.T) {
+	worker := NewTestRoomWorker()
+	now := time.Now().UnixNano() / int64(time.Millisecond)
+	worker.SetTimer(&DataTimer{Type: "Timer", Duration: 60, Started: now, Ends: now + 60000})
+	if timer := worker.GetTimer(); timer == nil || timer.Now < now {
+		t.Errorf("Expected running timer with current server time, but got %+v", timer)
+	}
+
+	worker.SetTimer(&DataTimer{Type: "Timer", Duration: 60, Started: now - 120000, Ends: now - 60000})
+	if timer := worker.GetTimer(); timer != nil {
+		t.Errorf("Expected expired timer to be omitted, but got %+v", timer)
+	}
+}
+
+func Test_RoomWorker_SetVolatile_KeepsLatestValuePerKey(t *testing.T) {
+	worker := NewTestRoomWorker()
+	worker.SetVolatile("a", &DataVolatile{Type: "Volatile", Key: "cursor", Data: 1})
+	worker.SetVolatile("a", &DataVolatile{Type: "Volatile", Key: "cursor", Data: 2})
+	values := worker.GetVolatile()
+	if len(values) != 1 || values[0].From != "a" || values[0].Data != 2 {
+		t.Fatalf("Expected latest value from session a, but got %+v", values)
+	}
+
+	worker.SetVolatile("a", &DataVolatile{Type: "Volatile", Key: "cursor"})
+	if values := worker.GetVolatile(); len(values) != 0 {
+		t.Errorf("Expected key to be removed, but got %+v", values)
+	}
+}
+
+func Test_RoomWorker_SetBandwidth_ReportsChangedCapsOnly(t *testing.T) {
+	worker := NewRoomWorker(&roomManager{Config: &Config{}, bandwidthPolicy: NewBandwidthPolicy(100, 2000)}, testRoomID, testRoomName, testRoomType, nil)
+	if _, changed := worker.SetBandwidth("a", &DataBandwidth{Type: "Bandwidth", Receive: 800}); changed {
+		t.Error("Expected no cap for a single participant")
+	}
+	videoCap, changed := worker.SetBandwidth("b", &DataBandwidth{Type: "Bandwidth", Receive: 5000})
+	if !changed || videoCap.Video != 800 {
+		t.Fatalf("Expected cap of 800, but got %+v", videoCap)
+	}
+	if _, changed := worker.SetBandwidth("b", &DataBandwidth{Type: "Bandwidth", Receive: 4000}); changed {
+		t.Error("Expected unchanged cap not to be reported")
+	}
+	if current := worker.GetBandwidthCap(); current == nil || current.Video != 800 {
+		t.Errorf("Expected current cap of 800, but got %+v", current)
+	}
+}
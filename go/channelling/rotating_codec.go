@@ -0,0 +1,94 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package channelling
+
+import (
+	"sync"
+	"time"
+
+	"github.com/gorilla/securecookie"
+)
+
+type expiringCodec struct {
+	*securecookie.SecureCookie
+	expires time.Time
+}
+
+// rotatingCodec encodes values with a codec for the current secret and
+// decodes values encoded with previous secrets until their grace duration
+// has passed.
+type rotatingCodec struct {
+	mutex    sync.RWMutex
+	codecs   []*expiringCodec
+	newCodec func(secret []byte) *securecookie.SecureCookie
+}
+
+func newRotatingCodec(secret []byte, newCodec func(secret []byte) *securecookie.SecureCookie) *rotatingCodec {
+	return &rotatingCodec{
+		codecs:   []*expiringCodec{{SecureCookie: newCodec(secret)}},
+		newCodec: newCodec,
+	}
+}
+
+// Rotate makes secret the secret for all new values. It returns how many
+// previous secrets are still valid.
+func (rc *rotatingCodec) Rotate(secret []byte, grace time.Duration) int {
+	now := time.Now()
+	rc.mutex.Lock()
+	defer rc.mutex.Unlock()
+
+	codecs := []*expiringCodec{{SecureCookie: rc.newCodec(secret)}}
+	for idx, codec := range rc.codecs {
+		if idx == 0 {
+			codec.expires = now.Add(grace)
+		}
+		if grace > 0 && codec.expires.After(now) {
+			codecs = append(codecs, codec)
+		}
+	}
+	rc.codecs = codecs
+	return len(codecs) - 1
+}
+
+func (rc *rotatingCodec) Encode(name string, value interface{}) (string, error) {
+	rc.mutex.RLock()
+	codec := rc.codecs[0]
+	rc.mutex.RUnlock()
+	return codec.Encode(name, value)
+}
+
+func (rc *rotatingCodec) Decode(name, value string, dst interface{}) (err error) {
+	now := time.Now()
+	rc.mutex.RLock()
+	codecs := rc.codecs
+	rc.mutex.RUnlock()
+
+	for idx, codec := range codecs {
+		if idx > 0 && now.After(codec.expires) {
+			continue
+		}
+		if err = codec.Decode(name, value, dst); err == nil {
+			return
+		}
+	}
+	return
+}
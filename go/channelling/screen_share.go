@@ -0,0 +1,98 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package channelling
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ApplyScreenShareSDP limits the bitrate and frame rate of the video in
+// sdp to screenShare. It is applied to the offers of screen sharing viewers,
+// which the sharing session uses as remote description, so browsers cap
+// the video they send. Lower limits already in sdp are kept. Resolutions
+// cannot be limited in SDP, clients apply them to their capture.
+func ApplyScreenShareSDP(sdp string, screenShare *DataScreenShare) string {
+	if screenShare == nil || screenShare.MaxBitrate <= 0 && screenShare.MaxFrameRate <= 0 {
+		return sdp
+	}
+	eol := "\r\n"
+	if !strings.Contains(sdp, eol) {
+		eol = "\n"
+	}
+	lines := strings.Split(strings.TrimSuffix(sdp, eol), eol)
+
+	var result, section []string
+	for _, line := range lines {
+		if strings.HasPrefix(line, "m=") {
+			result = append(result, limitVideoSection(section, screenShare)...)
+			section = nil
+		}
+		section = append(section, line)
+	}
+	result = append(result, limitVideoSection(section, screenShare)...)
+	return strings.Join(result, eol) + eol
+}
+
+// limitVideoSection returns the lines of a media section with bandwidth
+// and frame rate limits, if it is a video section.
+func limitVideoSection(section []string, screenShare *DataScreenShare) []string {
+	if len(section) == 0 || !strings.HasPrefix(section[0], "m=video") {
+		return section
+	}
+
+	bitrate := screenShare.MaxBitrate
+	frameRate := float64(screenShare.MaxFrameRate)
+	lines := make([]string, 0, len(section)+3)
+	for _, line := range section {
+		switch {
+		case strings.HasPrefix(line, "b=AS:"):
+			if value, err := strconv.Atoi(line[5:]); err == nil && value > 0 && (bitrate <= 0 || value < bitrate) {
+				bitrate = value
+			}
+		case strings.HasPrefix(line, "b=TIAS:"):
+			// Replaced by the limit of b=AS.
+		case strings.HasPrefix(line, "a=framerate:"):
+			if value, err := strconv.ParseFloat(line[12:], 64); err == nil && value > 0 && (frameRate <= 0 || value < frameRate) {
+				frameRate = value
+			}
+		default:
+			lines = append(lines, line)
+		}
+	}
+
+	// Bandwidth lines follow the title and connection lines of the section.
+	pos := 1
+	for pos < len(lines) && (strings.HasPrefix(lines[pos], "i=") || strings.HasPrefix(lines[pos], "c=")) {
+		pos++
+	}
+	var bandwidth []string
+	if bitrate > 0 {
+		bandwidth = []string{fmt.Sprintf("b=AS:%d", bitrate), fmt.Sprintf("b=TIAS:%d", bitrate*1000)}
+	}
+	lines = append(lines[:pos], append(bandwidth, lines[pos:]...)...)
+	if frameRate > 0 {
+		lines = append(lines, "a=framerate:"+strconv.FormatFloat(frameRate, 'f', -1, 64))
+	}
+	return lines
+}
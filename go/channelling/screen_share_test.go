@@ -0,0 +1,80 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package channelling
+
+import (
+	"testing"
+)
+
+func Test_ApplyScreenShareSDP(t *testing.T) {
+	sdp := "v=0\r\n" +
+		"o=- 1 2 IN IP4 127.0.0.1\r\n" +
+		"m=audio 9 UDP/TLS/RTP/SAVPF 111\r\n" +
+		"c=IN IP4 0.0.0.0\r\n" +
+		"a=recvonly\r\n" +
+		"m=video 9 UDP/TLS/RTP/SAVPF 100\r\n" +
+		"c=IN IP4 0.0.0.0\r\n" +
+		"b=AS:2000\r\n" +
+		"a=recvonly\r\n" +
+		"a=framerate:10\r\n"
+	expected := "v=0\r\n" +
+		"o=- 1 2 IN IP4 127.0.0.1\r\n" +
+		"m=audio 9 UDP/TLS/RTP/SAVPF 111\r\n" +
+		"c=IN IP4 0.0.0.0\r\n" +
+		"a=recvonly\r\n" +
+		"m=video 9 UDP/TLS/RTP/SAVPF 100\r\n" +
+		"c=IN IP4 0.0.0.0\r\n" +
+		"b=AS:1500\r\n" +
+		"b=TIAS:1500000\r\n" +
+		"a=recvonly\r\n" +
+		"a=framerate:10\r\n"
+
+	result := ApplyScreenShareSDP(sdp, &DataScreenShare{MaxBitrate: 1500, MaxFrameRate: 15})
+	if result != expected {
+		t.Errorf("Unexpected SDP:\n%s\nexpected:\n%s", result, expected)
+	}
+	if again := ApplyScreenShareSDP(result, &DataScreenShare{MaxBitrate: 1500, MaxFrameRate: 15}); again != expected {
+		t.Errorf("Applying limits twice changed the SDP:\n%s", again)
+	}
+	if unchanged := ApplyScreenShareSDP(sdp, &DataScreenShare{MaxWidth: 1280}); unchanged != sdp {
+		t.Errorf("SDP changed without bitrate or frame rate limit:\n%s", unchanged)
+	}
+}
+
+func Test_RoomWorker_ScreenShare(t *testing.T) {
+	worker := NewTestRoomWorker()
+	if worker.GetScreenShare() != nil {
+		t.Fatal("Expected no screen sharing limits")
+	}
+	template := &DataScreenShare{MaxFrameRate: 5}
+	worker.SetTemplate(&RoomTemplate{Name: "slides", ScreenShare: template})
+	if worker.GetScreenShare() != template {
+		t.Errorf("Expected limits of the template, got %+v", worker.GetScreenShare())
+	}
+	room := worker.SetScreenShare(&DataScreenShare{MaxBitrate: 500})
+	if room.ScreenShare == nil || room.ScreenShare.MaxBitrate != 500 || worker.Snapshot().ScreenShare == nil {
+		t.Errorf("Expected limits of the room, got %+v", room.ScreenShare)
+	}
+	if room := worker.SetScreenShare(nil); room.ScreenShare != template {
+		t.Errorf("Expected limits of the template after reset, got %+v", room.ScreenShare)
+	}
+}
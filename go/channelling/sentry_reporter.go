@@ -0,0 +1,170 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package channelling
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// Number of reports queued for sending, further panics are only logged
+// until the queue drains.
+const sentryQueueSize = 16
+
+type sentryReporter struct {
+	endpoint   string
+	auth       string
+	release    string
+	serverName string
+	client     *http.Client
+	queue      chan *PanicReport
+}
+
+// NewSentryReporter creates a PanicReporter which sends panics as events to
+// the Sentry project of dsn (https://key@host/project). Events are sent in
+// the background.
+func NewSentryReporter(dsn, release string, timeout time.Duration) (PanicReporter, error) {
+	endpoint, auth, err := parseSentryDSN(dsn, release)
+	if err != nil {
+		return nil, err
+	}
+	serverName, _ := os.Hostname()
+	reporter := &sentryReporter{
+		endpoint:   endpoint,
+		auth:       auth,
+		release:    release,
+		serverName: serverName,
+		client:     &http.Client{Timeout: timeout},
+		queue:      make(chan *PanicReport, sentryQueueSize),
+	}
+	go reporter.run()
+	return reporter, nil
+}
+
+// parseSentryDSN returns the store endpoint and the X-Sentry-Auth header
+// of dsn.
+func parseSentryDSN(dsn, release string) (string, string, error) {
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return "", "", err
+	}
+	if u.User == nil || u.User.Username() == "" || u.Host == "" {
+		return "", "", fmt.Errorf("Sentry DSN has no key or host")
+	}
+	path := strings.TrimSuffix(u.Path, "/")
+	slash := strings.LastIndex(path, "/")
+	if slash < 0 || slash == len(path)-1 {
+		return "", "", fmt.Errorf("Sentry DSN has no project")
+	}
+	endpoint := fmt.Sprintf("%s://%s%s/api/%s/store/", u.Scheme, u.Host, path[:slash], path[slash+1:])
+	auth := fmt.Sprintf("Sentry sentry_version=7, sentry_client=spreed-webrtc/%s, sentry_key=%s", release, u.User.Username())
+	if secret, ok := u.User.Password(); ok {
+		auth += ", sentry_secret=" + secret
+	}
+	return endpoint, auth, nil
+}
+
+func (reporter *sentryReporter) ReportPanic(report *PanicReport) {
+	select {
+	case reporter.queue <- report:
+	default:
+		log.Println("Sentry queue is full, panic not reported")
+	}
+}
+
+func (reporter *sentryReporter) run() {
+	for report := range reporter.queue {
+		if err := reporter.send(report); err != nil {
+			log.Println("Failed to report panic to Sentry", err)
+		}
+	}
+}
+
+func (reporter *sentryReporter) send(report *PanicReport) error {
+	body, err := json.Marshal(reporter.event(report))
+	if err != nil {
+		return err
+	}
+	request, err := http.NewRequest("POST", reporter.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("X-Sentry-Auth", reporter.auth)
+
+	resp, err := reporter.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, io.LimitReader(resp.Body, maxWebhookResponseSize))
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
+
+// event returns the Sentry event of report.
+func (reporter *sentryReporter) event(report *PanicReport) map[string]interface{} {
+	id := make([]byte, 16)
+	rand.Read(id)
+	// Sentry lists frames from the outermost to the innermost.
+	frames := make([]*PanicFrame, len(report.Frames))
+	for i, frame := range report.Frames {
+		frames[len(frames)-1-i] = frame
+	}
+	event := map[string]interface{}{
+		"event_id":    hex.EncodeToString(id),
+		"timestamp":   report.Time.UTC().Format("2006-01-02T15:04:05"),
+		"level":       "error",
+		"logger":      "panic",
+		"platform":    "go",
+		"release":     reporter.release,
+		"server_name": reporter.serverName,
+		"message":     fmt.Sprintf("panic in %s: %s", report.Where, report.Value),
+		"tags":        map[string]string{"where": report.Where},
+		"exception": map[string]interface{}{
+			"values": []interface{}{
+				map[string]interface{}{
+					"type":       "panic",
+					"value":      report.Value,
+					"stacktrace": map[string]interface{}{"frames": frames},
+				},
+			},
+		},
+	}
+	if report.Session != "" {
+		event["extra"] = map[string]string{"session": report.Session}
+	}
+	return event
+}
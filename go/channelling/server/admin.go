@@ -0,0 +1,122 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package server
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// Admin roles, a role includes the privileges of the roles before it.
+const (
+	AdminRoleViewer = "viewer" // Read only access to the dashboard end points.
+	AdminRoleAdmin  = "admin"  // Access to all admin end points.
+)
+
+var adminRoleLevels = map[string]int{
+	AdminRoleViewer: 1,
+	AdminRoleAdmin:  2,
+}
+
+// IsAdminRole returns true if role is a known admin role.
+func IsAdminRole(role string) bool {
+	_, ok := adminRoleLevels[role]
+	return ok
+}
+
+// An AdminToken grants the role to requests which provide the secret as
+// bearer token.
+type AdminToken struct {
+	Name   string
+	Role   string
+	Secret string
+}
+
+// AdminTokens authorizes admin API requests by role. The admin secret
+// always has the admin role.
+type AdminTokens struct {
+	secret func() string
+	tokens []*AdminToken
+}
+
+// NewAdminTokens creates AdminTokens which ask secret for the current admin
+// secret on every request, so the secret can be rotated.
+func NewAdminTokens(secret func() string, tokens []*AdminToken) *AdminTokens {
+	return &AdminTokens{secret, tokens}
+}
+
+// Lookup returns the token matching the bearer token of request or nil.
+func (tokens *AdminTokens) Lookup(request *http.Request) *AdminToken {
+	auth := request.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "Bearer ") {
+		return nil
+	}
+	token := []byte(auth[7:])
+	var found *AdminToken
+	if secret := tokens.secret(); secret != "" && subtle.ConstantTimeCompare(token, []byte(secret)) == 1 {
+		found = &AdminToken{Name: AdminRoleAdmin, Role: AdminRoleAdmin}
+	}
+	// Compare all tokens to not leak which one matched through timing.
+	for _, candidate := range tokens.tokens {
+		if subtle.ConstantTimeCompare(token, []byte(candidate.Secret)) == 1 && found == nil {
+			found = candidate
+		}
+	}
+	return found
+}
+
+// Handler returns a resource wrapper which only passes on requests with a
+// token of at least role.
+func (tokens *AdminTokens) Handler(role string) func(http.HandlerFunc) http.HandlerFunc {
+	return func(fn http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			token := tokens.Lookup(r)
+			if token == nil {
+				log.Printf("Admin API request denied from %s\n", r.RemoteAddr)
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusUnauthorized)
+				json.NewEncoder(w).Encode(NewApiError("admin_unauthorized", "Invalid admin credentials"))
+				return
+			}
+			if adminRoleLevels[token.Role] < adminRoleLevels[role] {
+				log.Printf("Admin API request to %s with %s token %s denied from %s\n", r.URL.Path, token.Role, token.Name, r.RemoteAddr)
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusForbidden)
+				json.NewEncoder(w).Encode(NewApiError("admin_forbidden", "The admin role does not allow this request"))
+				return
+			}
+			fn(w, r)
+		}
+	}
+}
+
+// MakeAdminAuthHandler returns a resource wrapper which only passes on
+// requests which provide the admin secret as bearer token in the
+// Authorization header.
+func MakeAdminAuthHandler(secret string) func(http.HandlerFunc) http.HandlerFunc {
+	return NewAdminTokens(func() string {
+		return secret
+	}, nil).Handler(AdminRoleAdmin)
+}
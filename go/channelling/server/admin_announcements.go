@@ -0,0 +1,80 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/strukturag/spreed-webrtc/go/channelling"
+)
+
+const maxAnnouncementLength = 1024
+
+type AdminAnnouncementsRequest struct {
+	Code    string `json:"code"` // Message code to localize message, optional.
+	Message string `json:"message"`
+	Level   string `json:"level"`  // info (default), warning or error.
+	Room    string `json:"room"`   // Room name, all rooms if empty.
+	Type    string `json:"type"`   // Room type, configured default if empty.
+	Userid  string `json:"userid"` // User id, all users if empty.
+}
+
+type AdminAnnouncementsResponse struct {
+	Success  bool `json:"success"`
+	Sessions int  `json:"sessions"`
+}
+
+type AdminAnnouncements struct {
+	channelling.Announcer
+	channelling.RoomStatusManager
+}
+
+func (announcements *AdminAnnouncements) Post(request *http.Request) (int, interface{}, http.Header) {
+	var aar AdminAnnouncementsRequest
+	if err := json.NewDecoder(request.Body).Decode(&aar); err != nil {
+		return http.StatusBadRequest, NewApiError("admin_announcements_bad_request", "Failed to parse request"), http.Header{"Content-Type": {"application/json"}}
+	}
+	if aar.Message == "" || len(aar.Message) > maxAnnouncementLength {
+		return http.StatusBadRequest, NewApiError("admin_announcements_bad_message", "Message must be between 1 and 1024 bytes"), http.Header{"Content-Type": {"application/json"}}
+	}
+	switch aar.Level {
+	case "":
+		aar.Level = channelling.AnnouncementInfo
+	case channelling.AnnouncementInfo, channelling.AnnouncementWarning, channelling.AnnouncementError:
+	default:
+		return http.StatusBadRequest, NewApiError("admin_announcements_bad_level", "Level must be info, warning or error"), http.Header{"Content-Type": {"application/json"}}
+	}
+
+	var roomID string
+	if aar.Room != "" || aar.Type != "" {
+		roomID = announcements.MakeRoomID(aar.Room, aar.Type)
+	}
+	count := announcements.Announce(roomID, aar.Userid, &channelling.DataAnnouncement{
+		Type:    "Announcement",
+		Code:    aar.Code,
+		Message: aar.Message,
+		Level:   aar.Level,
+	})
+
+	return http.StatusOK, &AdminAnnouncementsResponse{true, count}, http.Header{"Content-Type": {"application/json"}}
+}
@@ -0,0 +1,314 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package server
+
+import (
+	"net/http"
+	"net/url"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/strukturag/spreed-webrtc/go/channelling"
+)
+
+const (
+	adminPageDefaultLimit = 50
+	adminPageMaxLimit     = 500
+)
+
+// AdminPage is a page of the items of a dashboard list. Pages are selected
+// with the offset and limit query parameters.
+type AdminPage struct {
+	Total  int         `json:"total"`
+	Offset int         `json:"offset"`
+	Limit  int         `json:"limit"`
+	Items  interface{} `json:"items"`
+}
+
+// adminPagination returns the offset and limit of query.
+func adminPagination(query url.Values) (offset, limit int, apiErr *ApiError) {
+	var err error
+	limit = adminPageDefaultLimit
+	if value := query.Get("offset"); value != "" {
+		if offset, err = strconv.Atoi(value); err != nil || offset < 0 {
+			return 0, 0, NewApiError("admin_bad_offset", "Offset must be a positive number")
+		}
+	}
+	if value := query.Get("limit"); value != "" {
+		if limit, err = strconv.Atoi(value); err != nil || limit <= 0 || limit > adminPageMaxLimit {
+			return 0, 0, NewApiError("admin_bad_limit", "Limit must be a number between 1 and "+strconv.Itoa(adminPageMaxLimit))
+		}
+	}
+	return offset, limit, nil
+}
+
+// adminPageBounds returns the slice bounds of the page in a list of total
+// items.
+func adminPageBounds(total, offset, limit int) (start, end int) {
+	if offset > total {
+		offset = total
+	}
+	end = offset + limit
+	if end > total {
+		end = total
+	}
+	return offset, end
+}
+
+type AdminDashboardRoom struct {
+	Id        string `json:"id"`
+	Name      string `json:"name"`
+	Type      string `json:"type"`
+	Occupancy int    `json:"occupancy"`
+	Owner     string `json:"owner,omitempty"`
+	Template  string `json:"template,omitempty"`
+	Recording bool   `json:"recording,omitempty"`
+}
+
+type AdminDashboardRooms struct {
+	channelling.RoomStats
+	channelling.RoomStatusManager
+}
+
+// Get lists the rooms of this server, the fullest rooms first. The optional
+// query parameter q only lists rooms whose name contains it.
+func (rooms *AdminDashboardRooms) Get(request *http.Request) (int, interface{}, http.Header) {
+	query := request.URL.Query()
+	offset, limit, apiErr := adminPagination(query)
+	if apiErr != nil {
+		return http.StatusBadRequest, apiErr, http.Header{"Content-Type": {"application/json"}}
+	}
+	q := strings.ToLower(query.Get("q"))
+
+	_, roomSessions := rooms.RoomInfo(true)
+	list := make([]*AdminDashboardRoom, 0, len(roomSessions))
+	for roomID, sessionIDs := range roomSessions {
+		room, ok := rooms.RoomStatusManager.Get(roomID)
+		if !ok || (q != "" && !strings.Contains(strings.ToLower(room.GetName()), q)) {
+			continue
+		}
+		item := &AdminDashboardRoom{
+			Id:        roomID,
+			Name:      room.GetName(),
+			Type:      room.GetType(),
+			Occupancy: len(sessionIDs),
+			Owner:     room.GetOwner(),
+			Recording: room.IsRecording(),
+		}
+		if template := room.GetTemplate(); template != nil {
+			item.Template = template.Name
+		}
+		list = append(list, item)
+	}
+	sort.Sort(adminDashboardRoomsByOccupancy(list))
+
+	start, end := adminPageBounds(len(list), offset, limit)
+	return http.StatusOK, &AdminPage{len(list), offset, limit, list[start:end]}, http.Header{"Content-Type": {"application/json"}}
+}
+
+type adminDashboardRoomsByOccupancy []*AdminDashboardRoom
+
+func (list adminDashboardRoomsByOccupancy) Len() int      { return len(list) }
+func (list adminDashboardRoomsByOccupancy) Swap(i, j int) { list[i], list[j] = list[j], list[i] }
+func (list adminDashboardRoomsByOccupancy) Less(i, j int) bool {
+	if list[i].Occupancy != list[j].Occupancy {
+		return list[i].Occupancy > list[j].Occupancy
+	}
+	return list[i].Id < list[j].Id
+}
+
+type AdminDashboardSession struct {
+	Id       string `json:"id"`
+	Userid   string `json:"userid,omitempty"`
+	Room     string `json:"room,omitempty"`
+	Ua       string `json:"ua,omitempty"`
+	Version  string `json:"version,omitempty"`
+	Liveness string `json:"liveness,omitempty"`
+}
+
+type AdminDashboardSessions struct {
+	channelling.ClientStats
+	channelling.SessionStore
+}
+
+// Get searches the sessions connected to this server. The optional query
+// parameters are q (contained in the session id, userid or room id), userid
+// and room (exact room id).
+func (sessions *AdminDashboardSessions) Get(request *http.Request) (int, interface{}, http.Header) {
+	query := request.URL.Query()
+	offset, limit, apiErr := adminPagination(query)
+	if apiErr != nil {
+		return http.StatusBadRequest, apiErr, http.Header{"Content-Type": {"application/json"}}
+	}
+	q, userid, roomID := strings.ToLower(query.Get("q")), query.Get("userid"), query.Get("room")
+
+	_, data, _ := sessions.ClientInfo(true)
+	list := make([]*AdminDashboardSession, 0, len(data))
+	for id, session := range data {
+		item := &AdminDashboardSession{
+			Id:       id,
+			Userid:   session.Userid,
+			Ua:       session.Ua,
+			Version:  session.Version,
+			Liveness: session.Liveness,
+		}
+		if s, ok := sessions.GetSession(id); ok {
+			item.Room = s.Roomid
+		}
+		if userid != "" && item.Userid != userid {
+			continue
+		}
+		if roomID != "" && item.Room != roomID {
+			continue
+		}
+		if q != "" && !strings.Contains(strings.ToLower(item.Id), q) && !strings.Contains(strings.ToLower(item.Userid), q) && !strings.Contains(strings.ToLower(item.Room), q) {
+			continue
+		}
+		list = append(list, item)
+	}
+	sort.Sort(adminDashboardSessionsById(list))
+
+	start, end := adminPageBounds(len(list), offset, limit)
+	return http.StatusOK, &AdminPage{len(list), offset, limit, list[start:end]}, http.Header{"Content-Type": {"application/json"}}
+}
+
+type adminDashboardSessionsById []*AdminDashboardSession
+
+func (list adminDashboardSessionsById) Len() int           { return len(list) }
+func (list adminDashboardSessionsById) Swap(i, j int)      { list[i], list[j] = list[j], list[i] }
+func (list adminDashboardSessionsById) Less(i, j int) bool { return list[i].Id < list[j].Id }
+
+type AdminDashboardErrors struct {
+	channelling.ErrorLog
+}
+
+// Get lists the recent errors of incoming channelling messages, newest
+// first. The optional query parameters type and code only list errors of
+// that message type or error code.
+func (dashboard *AdminDashboardErrors) Get(request *http.Request) (int, interface{}, http.Header) {
+	query := request.URL.Query()
+	offset, limit, apiErr := adminPagination(query)
+	if apiErr != nil {
+		return http.StatusBadRequest, apiErr, http.Header{"Content-Type": {"application/json"}}
+	}
+	msgType, code := query.Get("type"), query.Get("code")
+
+	recent := dashboard.RecentErrors()
+	list := make([]*channelling.RecentError, 0, len(recent))
+	for _, err := range recent {
+		if (msgType == "" || err.Type == msgType) && (code == "" || err.Code == code) {
+			list = append(list, err)
+		}
+	}
+
+	start, end := adminPageBounds(len(list), offset, limit)
+	return http.StatusOK, &AdminPage{len(list), offset, limit, list[start:end]}, http.Header{"Content-Type": {"application/json"}}
+}
+
+type AdminDashboardBroadcast struct {
+	Room       string `json:"room"`
+	Queued     int    `json:"queued"`
+	Broadcasts uint64 `json:"broadcasts"`
+	Sends      uint64 `json:"sends"`
+	Dropped    uint64 `json:"dropped"`
+	Rounds     uint64 `json:"rounds"`
+	AvgWait    int64  `json:"avg_wait"` // Milliseconds.
+	MaxWait    int64  `json:"max_wait"` // Milliseconds.
+}
+
+type AdminDashboardBroadcasts struct {
+	*channelling.BroadcastScheduler
+}
+
+// Get lists the broadcast scheduling metrics of the rooms, the rooms which
+// spent the most sends first.
+func (dashboard *AdminDashboardBroadcasts) Get(request *http.Request) (int, interface{}, http.Header) {
+	offset, limit, apiErr := adminPagination(request.URL.Query())
+	if apiErr != nil {
+		return http.StatusBadRequest, apiErr, http.Header{"Content-Type": {"application/json"}}
+	}
+
+	stats := dashboard.Stats()
+	list := make([]*AdminDashboardBroadcast, 0, len(stats))
+	for _, room := range stats {
+		item := &AdminDashboardBroadcast{
+			Room:       room.Room,
+			Queued:     room.Queued,
+			Broadcasts: room.Broadcasts,
+			Sends:      room.Sends,
+			Dropped:    room.Dropped,
+			Rounds:     room.Rounds,
+			MaxWait:    int64(room.MaxWait / time.Millisecond),
+		}
+		if room.Broadcasts > 0 {
+			item.AvgWait = int64(room.Waited / time.Duration(room.Broadcasts) / time.Millisecond)
+		}
+		list = append(list, item)
+	}
+	sort.Sort(adminDashboardBroadcastsBySends(list))
+
+	start, end := adminPageBounds(len(list), offset, limit)
+	return http.StatusOK, &AdminPage{len(list), offset, limit, list[start:end]}, http.Header{"Content-Type": {"application/json"}}
+}
+
+type adminDashboardBroadcastsBySends []*AdminDashboardBroadcast
+
+func (list adminDashboardBroadcastsBySends) Len() int      { return len(list) }
+func (list adminDashboardBroadcastsBySends) Swap(i, j int) { list[i], list[j] = list[j], list[i] }
+func (list adminDashboardBroadcastsBySends) Less(i, j int) bool {
+	if list[i].Sends != list[j].Sends {
+		return list[i].Sends > list[j].Sends
+	}
+	return list[i].Room < list[j].Room
+}
+
+type AdminDashboardServerView struct {
+	Version string                      `json:"version"`
+	Uptime  int64                       `json:"uptime"`
+	CPUs    int                         `json:"cpus"`
+	Limits  *channelling.ResourceLimits `json:"limits,omitempty"`
+	Runtime *RuntimeStat                `json:"runtime"`
+	Hub     *channelling.HubStat        `json:"hub"`
+}
+
+type AdminDashboardServer struct {
+	channelling.StatsGenerator
+	Version string
+	Started time.Time
+	Limits  *channelling.ResourceLimits
+}
+
+// Get returns the resource usage and the counters of this server.
+func (dashboard *AdminDashboardServer) Get(request *http.Request) (int, interface{}, http.Header) {
+	stat := NewStat(false, dashboard.StatsGenerator)
+	return http.StatusOK, &AdminDashboardServerView{
+		Version: dashboard.Version,
+		Uptime:  int64(time.Since(dashboard.Started) / time.Second),
+		CPUs:    runtime.NumCPU(),
+		Limits:  dashboard.Limits,
+		Runtime: stat.Runtime,
+		Hub:     stat.Hub,
+	}, http.Header{"Content-Type": {"application/json"}}
+}
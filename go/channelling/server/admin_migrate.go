@@ -0,0 +1,59 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/strukturag/spreed-webrtc/go/channelling"
+)
+
+type AdminMigrateRequest struct {
+	Url      string   `json:"url"`      // Websocket URL of the target server.
+	Sessions []string `json:"sessions"` // Session ids to migrate, all if empty.
+	Count    int      `json:"count"`    // Maximum number of sessions to migrate.
+	Reason   string   `json:"reason"`
+}
+
+type AdminMigrateResponse struct {
+	Success  bool `json:"success"`
+	Migrated int  `json:"migrated"`
+}
+
+type AdminMigrate struct {
+	channelling.SessionMigrator
+}
+
+func (migrate *AdminMigrate) Post(request *http.Request) (int, interface{}, http.Header) {
+	var amr AdminMigrateRequest
+	if err := json.NewDecoder(request.Body).Decode(&amr); err != nil {
+		return http.StatusBadRequest, NewApiError("admin_migrate_bad_request", "Failed to parse request"), http.Header{"Content-Type": {"application/json"}}
+	}
+
+	migrated, err := migrate.MigrateSessions(amr.Sessions, amr.Count, amr.Url, amr.Reason)
+	if err != nil {
+		return http.StatusBadRequest, NewApiError("admin_migrate_bad_url", err.Error()), http.Header{"Content-Type": {"application/json"}}
+	}
+
+	return http.StatusOK, &AdminMigrateResponse{true, migrated}, http.Header{"Content-Type": {"application/json"}}
+}
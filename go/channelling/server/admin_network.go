@@ -0,0 +1,126 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/strukturag/spreed-webrtc/go/channelling"
+)
+
+// AdminNetworkConditions are simulated network conditions with times in
+// milliseconds and the drop probability in percent.
+type AdminNetworkConditions struct {
+	Delay  int64   `json:"delay"`
+	Jitter int64   `json:"jitter"`
+	Drop   float64 `json:"drop"`
+}
+
+// AdminNetworkRequest sets the conditions of a session, or of a room given
+// by name and type.
+type AdminNetworkRequest struct {
+	AdminNetworkConditions
+	Session string `json:"session"`
+	Name    string `json:"name"`
+	Type    string `json:"type"`
+}
+
+type AdminNetworkList struct {
+	Defaults *AdminNetworkConditions            `json:"defaults"`
+	Sessions map[string]*AdminNetworkConditions `json:"sessions"`
+	Rooms    map[string]*AdminNetworkConditions `json:"rooms"`
+}
+
+// AdminNetwork sets (Post) and removes (Delete) simulated network
+// conditions and lists them (Get).
+type AdminNetwork struct {
+	*channelling.NetworkSimulator
+	Rooms channelling.RoomStatusManager
+}
+
+func (network *AdminNetwork) Get(request *http.Request) (int, interface{}, http.Header) {
+	defaults, sessions, rooms := network.All()
+	list := &AdminNetworkList{
+		Defaults: newAdminNetworkConditions(defaults),
+		Sessions: make(map[string]*AdminNetworkConditions, len(sessions)),
+		Rooms:    make(map[string]*AdminNetworkConditions, len(rooms)),
+	}
+	for id, conditions := range sessions {
+		list.Sessions[id] = newAdminNetworkConditions(conditions)
+	}
+	for id, conditions := range rooms {
+		list.Rooms[id] = newAdminNetworkConditions(conditions)
+	}
+	return http.StatusOK, list, http.Header{"Content-Type": {"application/json"}}
+}
+
+func (network *AdminNetwork) Post(request *http.Request) (int, interface{}, http.Header) {
+	var anr AdminNetworkRequest
+	if err := json.NewDecoder(request.Body).Decode(&anr); err != nil || (anr.Session == "" && anr.Name == "") {
+		return http.StatusBadRequest, NewApiError("admin_network_bad_request", "Failed to parse request"), http.Header{"Content-Type": {"application/json"}}
+	}
+	if anr.Delay < 0 || anr.Jitter < 0 || anr.Drop < 0 || anr.Drop > 100 {
+		return http.StatusBadRequest, NewApiError("admin_network_bad_conditions", "Delay and jitter must not be negative, drop must be between 0 and 100"), http.Header{"Content-Type": {"application/json"}}
+	}
+	conditions := &channelling.NetworkConditions{
+		Delay:  time.Duration(anr.Delay) * time.Millisecond,
+		Jitter: time.Duration(anr.Jitter) * time.Millisecond,
+		Drop:   anr.Drop / 100,
+	}
+	if anr.Session != "" {
+		network.SetSession(anr.Session, conditions)
+	}
+	if anr.Name != "" {
+		network.SetRoom(network.Rooms.MakeRoomID(anr.Name, anr.Type), conditions)
+	}
+	return network.Get(request)
+}
+
+// Delete removes the conditions of the session or the room given with the
+// query parameters session, name and type.
+func (network *AdminNetwork) Delete(request *http.Request) (int, interface{}, http.Header) {
+	query := request.URL.Query()
+	session, name := query.Get("session"), query.Get("name")
+	if session == "" && name == "" {
+		return http.StatusBadRequest, NewApiError("admin_network_bad_request", "Session or room name required"), http.Header{"Content-Type": {"application/json"}}
+	}
+	if session != "" {
+		network.SetSession(session, nil)
+	}
+	if name != "" {
+		network.SetRoom(network.Rooms.MakeRoomID(name, query.Get("type")), nil)
+	}
+	return network.Get(request)
+}
+
+func newAdminNetworkConditions(conditions *channelling.NetworkConditions) *AdminNetworkConditions {
+	if conditions == nil {
+		return nil
+	}
+	return &AdminNetworkConditions{
+		Delay:  int64(conditions.Delay / time.Millisecond),
+		Jitter: int64(conditions.Jitter / time.Millisecond),
+		Drop:   conditions.Drop * 100,
+	}
+}
@@ -0,0 +1,54 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package server
+
+import (
+	"net/http"
+
+	"github.com/strukturag/spreed-webrtc/go/channelling"
+
+	"github.com/gorilla/mux"
+)
+
+type AdminPipelinesList struct {
+	Count     int                                  `json:"count"`
+	Cleanup   *channelling.PipelineCleanupStat     `json:"cleanup"`
+	Pipelines map[string]*channelling.PipelineStat `json:"pipelines"`
+}
+
+type AdminPipelines struct {
+	channelling.PipelineManager
+}
+
+func (pipelines *AdminPipelines) Get(request *http.Request) (int, interface{}, http.Header) {
+	vars := mux.Vars(request)
+	if id, ok := vars["id"]; ok {
+		pipeline, ok := pipelines.GetPipelineByID(id)
+		if !ok {
+			return http.StatusNotFound, NewApiError("no_such_pipeline", "Pipeline not found"), http.Header{"Content-Type": {"application/json"}}
+		}
+		return http.StatusOK, pipeline.Stat(), http.Header{"Content-Type": {"application/json"}}
+	}
+
+	count, cleanup, stats := pipelines.PipelineInfo(true)
+	return http.StatusOK, &AdminPipelinesList{count, cleanup, stats}, http.Header{"Content-Type": {"application/json"}}
+}
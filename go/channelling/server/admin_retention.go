@@ -0,0 +1,55 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/strukturag/spreed-webrtc/go/channelling"
+)
+
+type AdminRetentionRequest struct {
+	DryRun bool `json:"dry_run"`
+}
+
+type AdminRetention struct {
+	channelling.RetentionJanitor
+}
+
+// Get returns the report of the latest retention run.
+func (retention *AdminRetention) Get(request *http.Request) (int, interface{}, http.Header) {
+	report := retention.LastReport()
+	if report == nil {
+		return http.StatusNotFound, NewApiError("admin_retention_no_report", "Retention did not run yet"), http.Header{"Content-Type": {"application/json"}}
+	}
+	return http.StatusOK, report, http.Header{"Content-Type": {"application/json"}}
+}
+
+// Post enforces retention now and returns the report.
+func (retention *AdminRetention) Post(request *http.Request) (int, interface{}, http.Header) {
+	var arr AdminRetentionRequest
+	if err := json.NewDecoder(request.Body).Decode(&arr); err != nil {
+		return http.StatusBadRequest, NewApiError("admin_retention_bad_request", "Failed to parse request"), http.Header{"Content-Type": {"application/json"}}
+	}
+	return http.StatusOK, retention.Run(arr.DryRun), http.Header{"Content-Type": {"application/json"}}
+}
@@ -0,0 +1,77 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/strukturag/spreed-webrtc/go/channelling"
+)
+
+type AdminRoomLinkRequest struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+	Role string `json:"role"`
+	Ttl  int    `json:"ttl"` // Validity in seconds.
+}
+
+type AdminRoomLink struct {
+	Name    string `json:"name"`
+	Type    string `json:"type,omitempty"`
+	Role    string `json:"role"`
+	Link    string `json:"link"`
+	Path    string `json:"path"`
+	Expires int64  `json:"expires"`
+}
+
+type AdminRoomLinks struct {
+	channelling.RoomLinks
+	Config *channelling.Config
+}
+
+func (links *AdminRoomLinks) Post(request *http.Request) (int, interface{}, http.Header) {
+	var alr AdminRoomLinkRequest
+	if err := json.NewDecoder(request.Body).Decode(&alr); err != nil {
+		return http.StatusBadRequest, NewApiError("admin_room_link_bad_request", "Failed to parse request"), http.Header{"Content-Type": {"application/json"}}
+	}
+
+	token, link, err := links.SignRoomLink(alr.Name, alr.Type, alr.Role, time.Duration(alr.Ttl)*time.Second)
+	if err != nil {
+		if dataError, ok := err.(*channelling.DataError); ok {
+			return http.StatusBadRequest, NewApiError(dataError.Code, dataError.Message), http.Header{"Content-Type": {"application/json"}}
+		}
+		return http.StatusInternalServerError, NewApiError("admin_room_link_failed", err.Error()), http.Header{"Content-Type": {"application/json"}}
+	}
+
+	path := &url.URL{Path: links.Config.B + alr.Name, RawQuery: "link=" + url.QueryEscape(token)}
+	return http.StatusOK, &AdminRoomLink{
+		Name:    link.Name,
+		Type:    link.Type,
+		Role:    link.Role,
+		Link:    token,
+		Path:    path.String(),
+		Expires: link.Expires,
+	}, http.Header{"Content-Type": {"application/json"}}
+}
@@ -0,0 +1,127 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/strukturag/spreed-webrtc/go/channelling"
+	"github.com/strukturag/spreed-webrtc/go/objectstore"
+
+	"github.com/gorilla/mux"
+)
+
+var exportKeyName = regexp.MustCompile(`[^A-Za-z0-9._-]`)
+
+type AdminRooms struct {
+	channelling.RoomStatusManager
+	// Store keeps exports requested with store=true, nil if not configured.
+	Store objectstore.Store
+	// Expires is the validity of the download URLs of stored exports.
+	Expires time.Duration
+}
+
+// StoredExport is the response for exports kept in the object store.
+type StoredExport struct {
+	Key     string    `json:"key"`
+	Url     string    `json:"url,omitempty"`
+	Expires time.Time `json:"expires,omitempty"`
+}
+
+// Get exports the retained state of a room. The optional query parameters
+// are type (room type, configured default if empty), format ("json" or "csv"), redact
+// (comma separated list of "sessions" and "userids") and store ("true" to
+// keep the export in the object store and return its download URL).
+func (rooms *AdminRooms) Get(request *http.Request) (int, interface{}, http.Header) {
+	query := request.URL.Query()
+	room, ok := rooms.RoomStatusManager.Get(rooms.MakeRoomID(mux.Vars(request)["name"], query.Get("type")))
+	if !ok {
+		return http.StatusNotFound, NewApiError("no_such_room", "No such room"), http.Header{"Content-Type": {"application/json"}}
+	}
+
+	export := channelling.NewRoomExport(room)
+	var sessions, userids bool
+	if redact := query.Get("redact"); redact != "" {
+		for _, field := range strings.Split(redact, ",") {
+			switch field {
+			case "sessions":
+				sessions = true
+			case "userids":
+				userids = true
+			default:
+				return http.StatusBadRequest, NewApiError("admin_rooms_bad_redact", "Unknown redact field"), http.Header{"Content-Type": {"application/json"}}
+			}
+		}
+	}
+	export.Redact(sessions, userids)
+
+	format := query.Get("format")
+	store := query.Get("store") == "true"
+	if store && rooms.Store == nil {
+		return http.StatusNotImplemented, NewApiError("admin_rooms_no_store", "No object store configured"), http.Header{"Content-Type": {"application/json"}}
+	}
+	switch format {
+	case "", "json":
+		if !store {
+			return http.StatusOK, export, http.Header{"Content-Type": {"application/json"}}
+		}
+		data, err := json.Marshal(export)
+		if err != nil {
+			return http.StatusInternalServerError, NewApiError("admin_rooms_export_failed", "Failed to export room"), http.Header{"Content-Type": {"application/json"}}
+		}
+		return rooms.storeExport(room.GetName(), "json", "application/json", data)
+	case "csv":
+		data, err := export.CSV()
+		if err != nil {
+			return http.StatusInternalServerError, NewApiError("admin_rooms_export_failed", "Failed to export room"), http.Header{"Content-Type": {"application/json"}}
+		}
+		if store {
+			return rooms.storeExport(room.GetName(), "csv", "text/csv; charset=utf-8", data)
+		}
+		return http.StatusOK, data, http.Header{"Content-Type": {"text/csv; charset=utf-8"}}
+	default:
+		return http.StatusBadRequest, NewApiError("admin_rooms_bad_format", "Format must be json or csv"), http.Header{"Content-Type": {"application/json"}}
+	}
+}
+
+func (rooms *AdminRooms) storeExport(name, extension, contentType string, data []byte) (int, interface{}, http.Header) {
+	now := time.Now()
+	stored := &StoredExport{
+		Key: fmt.Sprintf("exports/rooms/%s-%s.%s", exportKeyName.ReplaceAllString(name, "_"), now.UTC().Format("20060102T150405Z"), extension),
+	}
+	if err := rooms.Store.Put(stored.Key, contentType, data); err != nil {
+		log.Println("Failed to store room export", err)
+		return http.StatusBadGateway, NewApiError("admin_rooms_store_failed", "Failed to store export"), http.Header{"Content-Type": {"application/json"}}
+	}
+	// Stores without signed URLs are still useful for record-keeping.
+	if signed, err := rooms.Store.SignedURL(stored.Key, rooms.Expires); err == nil {
+		stored.Url = signed
+		stored.Expires = now.Add(rooms.Expires)
+	}
+	return http.StatusCreated, stored, http.Header{"Content-Type": {"application/json"}}
+}
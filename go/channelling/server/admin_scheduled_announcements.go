@@ -0,0 +1,90 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/strukturag/spreed-webrtc/go/channelling"
+
+	"github.com/gorilla/mux"
+)
+
+type AdminScheduledAnnouncementsRequest struct {
+	AdminAnnouncementsRequest
+	At    time.Time `json:"at"`    // Start time, now if empty.
+	Every int       `json:"every"` // Seconds between repetitions, 0 to send once.
+	Until time.Time `json:"until"` // End time, none if empty.
+	Motd  bool      `json:"motd"`  // Send once to every session joining a room.
+}
+
+type AdminScheduledAnnouncementsResponse struct {
+	Success bool `json:"success"`
+}
+
+type AdminScheduledAnnouncements struct {
+	channelling.AnnouncementScheduler
+	channelling.RoomStatusManager
+}
+
+func (announcements *AdminScheduledAnnouncements) Get(request *http.Request) (int, interface{}, http.Header) {
+	return http.StatusOK, announcements.List(), http.Header{"Content-Type": {"application/json"}}
+}
+
+func (announcements *AdminScheduledAnnouncements) Post(request *http.Request) (int, interface{}, http.Header) {
+	var asar AdminScheduledAnnouncementsRequest
+	if err := json.NewDecoder(request.Body).Decode(&asar); err != nil {
+		return http.StatusBadRequest, NewApiError("admin_announcements_bad_request", "Failed to parse request"), http.Header{"Content-Type": {"application/json"}}
+	}
+	if len(asar.Message) > maxAnnouncementLength {
+		return http.StatusBadRequest, NewApiError("admin_announcements_bad_message", "Message must be between 1 and 1024 bytes"), http.Header{"Content-Type": {"application/json"}}
+	}
+
+	scheduled := &channelling.ScheduledAnnouncement{
+		Code:    asar.Code,
+		Message: asar.Message,
+		Level:   asar.Level,
+		Userid:  asar.Userid,
+		At:      asar.At,
+		Every:   asar.Every,
+		Until:   asar.Until,
+		Motd:    asar.Motd,
+	}
+	if asar.Room != "" || asar.Type != "" {
+		scheduled.Roomid = announcements.MakeRoomID(asar.Room, asar.Type)
+	}
+	scheduled, err := announcements.Add(scheduled)
+	if err != nil {
+		return http.StatusBadRequest, NewApiError("admin_announcements_bad_schedule", err.Error()), http.Header{"Content-Type": {"application/json"}}
+	}
+
+	return http.StatusOK, scheduled, http.Header{"Content-Type": {"application/json"}}
+}
+
+func (announcements *AdminScheduledAnnouncements) Delete(request *http.Request) (int, interface{}, http.Header) {
+	if !announcements.Remove(mux.Vars(request)["id"]) {
+		return http.StatusNotFound, NewApiError("no_such_announcement", "Scheduled announcement not found"), http.Header{"Content-Type": {"application/json"}}
+	}
+	return http.StatusOK, &AdminScheduledAnnouncementsResponse{true}, http.Header{"Content-Type": {"application/json"}}
+}
@@ -0,0 +1,105 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/strukturag/spreed-webrtc/go/channelling"
+
+	"github.com/gorilla/mux"
+)
+
+// Upper bounds of screen sharing limits, to catch typos.
+const (
+	maxScreenShareSize      = 16384
+	maxScreenShareFrameRate = 120
+	maxScreenShareBitrate   = 100000
+)
+
+// AdminScreenShare manages the screen sharing limits of rooms. Changes are
+// broadcast to the room in a Room document.
+type AdminScreenShare struct {
+	channelling.RoomStatusManager
+	channelling.Broadcaster
+}
+
+func (admin *AdminScreenShare) room(request *http.Request) (channelling.RoomWorker, bool) {
+	return admin.RoomStatusManager.Get(admin.MakeRoomID(mux.Vars(request)["name"], request.URL.Query().Get("type")))
+}
+
+// Get returns the screen sharing limits of a room, empty if not limited.
+func (admin *AdminScreenShare) Get(request *http.Request) (int, interface{}, http.Header) {
+	room, ok := admin.room(request)
+	if !ok {
+		return http.StatusNotFound, NewApiError("no_such_room", "No such room"), http.Header{"Content-Type": {"application/json"}}
+	}
+	screenShare := room.GetScreenShare()
+	if screenShare == nil {
+		screenShare = &channelling.DataScreenShare{}
+	}
+	return http.StatusOK, screenShare, http.Header{"Content-Type": {"application/json"}}
+}
+
+// Put sets the screen sharing limits of a room, overriding its template.
+func (admin *AdminScreenShare) Put(request *http.Request) (int, interface{}, http.Header) {
+	room, ok := admin.room(request)
+	if !ok {
+		return http.StatusNotFound, NewApiError("no_such_room", "No such room"), http.Header{"Content-Type": {"application/json"}}
+	}
+	var screenShare channelling.DataScreenShare
+	if err := json.NewDecoder(request.Body).Decode(&screenShare); err != nil {
+		return http.StatusBadRequest, NewApiError("admin_screenshare_bad_request", "Failed to parse request"), http.Header{"Content-Type": {"application/json"}}
+	}
+	if screenShare.MaxWidth < 0 || screenShare.MaxWidth > maxScreenShareSize ||
+		screenShare.MaxHeight < 0 || screenShare.MaxHeight > maxScreenShareSize ||
+		screenShare.MaxFrameRate < 0 || screenShare.MaxFrameRate > maxScreenShareFrameRate ||
+		screenShare.MaxBitrate < 0 || screenShare.MaxBitrate > maxScreenShareBitrate {
+		return http.StatusBadRequest, NewApiError("admin_screenshare_bad_limits", "Limits are out of range"), http.Header{"Content-Type": {"application/json"}}
+	}
+
+	admin.update(room, &screenShare)
+	return http.StatusOK, &screenShare, http.Header{"Content-Type": {"application/json"}}
+}
+
+// Delete restores the screen sharing limits of the template of a room and
+// returns them.
+func (admin *AdminScreenShare) Delete(request *http.Request) (int, interface{}, http.Header) {
+	room, ok := admin.room(request)
+	if !ok {
+		return http.StatusNotFound, NewApiError("no_such_room", "No such room"), http.Header{"Content-Type": {"application/json"}}
+	}
+	screenShare := admin.update(room, nil)
+	if screenShare == nil {
+		screenShare = &channelling.DataScreenShare{}
+	}
+	return http.StatusOK, screenShare, http.Header{"Content-Type": {"application/json"}}
+}
+
+// update sets the limits of room and returns the limits which apply.
+func (admin *AdminScreenShare) update(room channelling.RoomWorker, screenShare *channelling.DataScreenShare) *channelling.DataScreenShare {
+	data := room.SetScreenShare(screenShare)
+	id := admin.MakeRoomID(room.GetName(), room.GetType())
+	admin.Broadcast("", id, &channelling.DataOutgoing{Data: data})
+	return data.ScreenShare
+}
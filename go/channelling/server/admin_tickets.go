@@ -0,0 +1,93 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package server
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/strukturag/spreed-webrtc/go/channelling"
+
+	"github.com/gorilla/mux"
+	"github.com/gorilla/securecookie"
+)
+
+type AdminTicketsRequest struct {
+	Secret string `json:"secret"` // Hex encoded new session secret, random if empty.
+	Grace  *int   `json:"grace"`  // Seconds to accept the previous secret.
+	Id     string `json:"id"`     // Public session id to revoke.
+	Userid string `json:"userid"` // User id to revoke.
+}
+
+type AdminTicketsResponse struct {
+	Success bool `json:"success"`
+}
+
+type AdminTickets struct {
+	channelling.Tickets
+	RoomLinks channelling.RoomLinks // Optional, rotated with the session secret.
+	Grace     time.Duration
+}
+
+func (tickets *AdminTickets) Post(request *http.Request) (int, interface{}, http.Header) {
+	var atr AdminTicketsRequest
+	if err := json.NewDecoder(request.Body).Decode(&atr); err != nil {
+		return http.StatusBadRequest, NewApiError("admin_tickets_bad_request", "Failed to parse request"), http.Header{"Content-Type": {"application/json"}}
+	}
+
+	switch mux.Vars(request)["action"] {
+	case "rotate":
+		var secret []byte
+		if atr.Secret != "" {
+			var err error
+			if secret, err = hex.DecodeString(atr.Secret); err != nil || len(secret) < 32 {
+				return http.StatusBadRequest, NewApiError("admin_tickets_bad_secret", "Secret must be hex encoded with at least 32 bytes"), http.Header{"Content-Type": {"application/json"}}
+			}
+		} else {
+			secret = securecookie.GenerateRandomKey(32)
+		}
+		grace := tickets.Grace
+		if atr.Grace != nil {
+			grace = time.Duration(*atr.Grace) * time.Second
+		}
+		tickets.RotateSessionSecret(secret, grace)
+		if tickets.RoomLinks != nil {
+			tickets.RoomLinks.RotateSessionSecret(secret, grace)
+		}
+	case "revoke":
+		if atr.Id == "" && atr.Userid == "" {
+			return http.StatusBadRequest, NewApiError("admin_tickets_bad_request", "Either id or userid is required"), http.Header{"Content-Type": {"application/json"}}
+		}
+		if atr.Id != "" {
+			tickets.RevokeSessionToken(atr.Id)
+		}
+		if atr.Userid != "" {
+			tickets.RevokeUserid(atr.Userid)
+		}
+	default:
+		return http.StatusNotFound, NewApiError("admin_tickets_unknown_action", "Unknown action"), http.Header{"Content-Type": {"application/json"}}
+	}
+
+	return http.StatusOK, &AdminTicketsResponse{true}, http.Header{"Content-Type": {"application/json"}}
+}
@@ -0,0 +1,70 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/strukturag/spreed-webrtc/go/channelling"
+)
+
+// AdminTraceRequest selects a session id and/or all sessions of a userid.
+type AdminTraceRequest struct {
+	Session string `json:"session"`
+	Userid  string `json:"userid"`
+}
+
+type AdminTraceList struct {
+	Sessions []string `json:"sessions"`
+	Userids  []string `json:"userids"`
+}
+
+// AdminTraces starts (Post) and stops (Delete) the signaling trace of
+// sessions and lists the traced sessions (Get).
+type AdminTraces struct {
+	*channelling.SessionTracer
+}
+
+func (traces *AdminTraces) Get(request *http.Request) (int, interface{}, http.Header) {
+	sessions, userids := traces.Traced()
+	return http.StatusOK, &AdminTraceList{sessions, userids}, http.Header{"Content-Type": {"application/json"}}
+}
+
+func (traces *AdminTraces) Post(request *http.Request) (int, interface{}, http.Header) {
+	var atr AdminTraceRequest
+	if err := json.NewDecoder(request.Body).Decode(&atr); err != nil || (atr.Session == "" && atr.Userid == "") {
+		return http.StatusBadRequest, NewApiError("admin_trace_bad_request", "Failed to parse request"), http.Header{"Content-Type": {"application/json"}}
+	}
+	traces.Start(atr.Session, atr.Userid)
+	return traces.Get(request)
+}
+
+func (traces *AdminTraces) Delete(request *http.Request) (int, interface{}, http.Header) {
+	query := request.URL.Query()
+	session, userid := query.Get("session"), query.Get("userid")
+	if session == "" && userid == "" {
+		return http.StatusBadRequest, NewApiError("admin_trace_bad_request", "Session or userid required"), http.Header{"Content-Type": {"application/json"}}
+	}
+	traces.Stop(session, userid)
+	return traces.Get(request)
+}
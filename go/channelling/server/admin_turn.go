@@ -0,0 +1,41 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package server
+
+import (
+	"net/http"
+
+	"github.com/strukturag/spreed-webrtc/go/channelling"
+)
+
+type AdminTurnUsageView struct {
+	Sessions []*channelling.TurnUsageStat `json:"sessions"`
+	Rooms    []*channelling.TurnUsageStat `json:"rooms"`
+}
+
+type AdminTurnUsage struct {
+	channelling.TurnUsage
+}
+
+func (usage *AdminTurnUsage) Get(request *http.Request) (int, interface{}, http.Header) {
+	return http.StatusOK, &AdminTurnUsageView{usage.Sessions(), usage.Rooms()}, http.Header{"Content-Type": {"application/json"}}
+}
@@ -0,0 +1,60 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package server
+
+import (
+	"net/http"
+
+	"github.com/strukturag/spreed-webrtc/go/channelling"
+
+	"github.com/gorilla/mux"
+)
+
+type AdminUserData struct {
+	channelling.UserData
+}
+
+// Get exports all data held about the user.
+func (data *AdminUserData) Get(request *http.Request) (int, interface{}, http.Header) {
+	userid := mux.Vars(request)["userid"]
+	if userid == "" {
+		return http.StatusBadRequest, NewApiError("admin_userdata_bad_request", "Userid is required"), http.Header{"Content-Type": {"application/json"}}
+	}
+	return http.StatusOK, data.Export(userid), http.Header{"Content-Type": {"application/json"}}
+}
+
+// Delete erases the data held about the user and returns the audit record.
+func (data *AdminUserData) Delete(request *http.Request) (int, interface{}, http.Header) {
+	userid := mux.Vars(request)["userid"]
+	if userid == "" {
+		return http.StatusBadRequest, NewApiError("admin_userdata_bad_request", "Userid is required"), http.Header{"Content-Type": {"application/json"}}
+	}
+	return http.StatusOK, data.Erase(userid), http.Header{"Content-Type": {"application/json"}}
+}
+
+type AdminErasures struct {
+	channelling.UserData
+}
+
+func (data *AdminErasures) Get(request *http.Request) (int, interface{}, http.Header) {
+	return http.StatusOK, data.Erasures(), http.Header{"Content-Type": {"application/json"}}
+}
@@ -24,7 +24,9 @@ package server
 import (
 	"fmt"
 	"log"
+	"net"
 	"regexp"
+	"strconv"
 	"strings"
 	"time"
 
@@ -71,12 +73,35 @@ func NewConfig(container phoenix.Container, tokens bool) (*channelling.Config, e
 
 	stunURIsString := container.GetStringDefault("app", "stunURIs", "")
 	stunURIs := strings.Split(stunURIsString, " ")
+	stunListen := container.GetStringDefault("app", "stunListen", "")
+	if stunListen != "" {
+		if stunURI := builtinStunURI(stunListen, container.GetStringDefault("app", "stunAdvertise", "")); stunURI != "" {
+			stunURIs = append([]string{stunURI}, stunURIs...)
+		} else {
+			log.Println("Not advertising built-in STUN server, set stunAdvertise to its public address")
+		}
+	}
 	trimAndRemoveDuplicates(&stunURIs)
 
 	turnURIsString := container.GetStringDefault("app", "turnURIs", "")
 	turnURIs := strings.Split(turnURIsString, " ")
 	trimAndRemoveDuplicates(&turnURIs)
 
+	for _, uri := range append(append([]string{}, stunURIs...), turnURIs...) {
+		if err := channelling.CheckURI(uri); err != nil {
+			log.Println("Invalid STUN or TURN URI:", err)
+		}
+	}
+	preferAddressFamily := container.GetStringDefault("app", "preferAddressFamily", "")
+	switch preferAddressFamily {
+	case "":
+	case channelling.AddressFamilyIPv4, channelling.AddressFamilyIPv6:
+		channelling.SortURIsByFamily(stunURIs, preferAddressFamily)
+		channelling.SortURIsByFamily(turnURIs, preferAddressFamily)
+	default:
+		return nil, fmt.Errorf("Invalid preferAddressFamily %s, must be ipv4 or ipv6", preferAddressFamily)
+	}
+
 	// Get enabled modules.
 	modulesTable := map[string]bool{
 		"screensharing": true,
@@ -118,6 +143,146 @@ func NewConfig(container phoenix.Container, tokens bool) (*channelling.Config, e
 		}
 	}
 
+	var roomNamePattern *regexp.Regexp
+	if pattern := container.GetStringDefault("app", "roomNamePattern", ""); pattern != "" {
+		var err error
+		if roomNamePattern, err = regexp.Compile(pattern); err != nil {
+			return nil, fmt.Errorf("Invalid room name pattern '%s': %s", pattern, err)
+		}
+	}
+	busBridgeVersions := []int{}
+	for _, field := range strings.Fields(container.GetStringDefault("nats", "bridgeVersions", "")) {
+		version, err := strconv.Atoi(field)
+		if err != nil || version < 1 || version == channelling.BusProtocolVersion {
+			return nil, fmt.Errorf("Invalid bus protocol version '%s' to bridge", field)
+		}
+		busBridgeVersions = append(busBridgeVersions, version)
+	}
+	roomNameBlocklist := []string{}
+	for _, word := range strings.Fields(container.GetStringDefault("app", "roomNameBlocklist", "")) {
+		roomNameBlocklist = append(roomNameBlocklist, strings.ToLower(word))
+	}
+	roomNamePrefixes := make(map[string][]string)
+	if options, _ := container.GetOptions("roomprefixes"); len(options) > 0 {
+		for _, option := range options {
+			roomNamePrefixes[option] = strings.Fields(container.GetStringDefault("roomprefixes", option, ""))
+			log.Printf("Reserved room name prefix %s for %d users\n", option, len(roomNamePrefixes[option]))
+		}
+	}
+
+	roomTemplates := make(map[string]*channelling.RoomTemplate)
+	for _, name := range strings.Fields(container.GetStringDefault("app", "roomTemplates", "")) {
+		section := "roomtemplate-" + name
+		template := &channelling.RoomTemplate{
+			Name:     name,
+			Type:     container.GetStringDefault(section, "type", ""),
+			Capacity: container.GetIntDefault(section, "capacity", 0),
+			Locked:   container.GetBoolDefault(section, "locked", false),
+			Features: strings.Fields(container.GetStringDefault(section, "features", "")),
+			Turn:     container.GetStringDefault(section, "turn", channelling.RoomTurnPolicyDefault),
+			Queue:    container.GetStringDefault(section, "queue", ""),
+		}
+		template.QueueWrapUp = time.Duration(container.GetIntDefault(section, "queueWrapUp", 30)) * time.Second
+		template.ChatIndex = container.GetBoolDefault(section, "chatIndex", false)
+		if template.Type != "" && template.Type != defaultRoomType && !knownRoomTypes[template.Type] {
+			return nil, fmt.Errorf("Unsupported room type '%s' in room template %s", template.Type, name)
+		}
+		if template.Turn != channelling.RoomTurnPolicyDefault && template.Turn != channelling.RoomTurnPolicyRelay {
+			return nil, fmt.Errorf("Unsupported TURN policy '%s' in room template %s", template.Turn, name)
+		}
+		if template.Queue != "" && template.Queue != channelling.CallQueueRoundRobin && template.Queue != channelling.CallQueueLongestIdle {
+			return nil, fmt.Errorf("Unsupported call queue strategy '%s' in room template %s", template.Queue, name)
+		}
+		screenShare := &channelling.DataScreenShare{
+			MaxWidth:     container.GetIntDefault(section, "screenShareMaxWidth", 0),
+			MaxHeight:    container.GetIntDefault(section, "screenShareMaxHeight", 0),
+			MaxFrameRate: container.GetIntDefault(section, "screenShareMaxFrameRate", 0),
+			MaxBitrate:   container.GetIntDefault(section, "screenShareMaxBitrate", 0),
+		}
+		if *screenShare != (channelling.DataScreenShare{}) {
+			template.ScreenShare = screenShare
+		}
+		if pattern := container.GetStringDefault(section, "pattern", ""); pattern != "" {
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return nil, fmt.Errorf("Invalid regular expression '%s' for room template %s: %s", pattern, name, err)
+			}
+			template.Pattern = re
+		}
+		roomTemplates[name] = template
+		log.Printf("Using room template %s\n", name)
+	}
+
+	var customFields []*channelling.CustomField
+	if options, _ := container.GetOptions("customfields"); len(options) > 0 {
+		for _, option := range options {
+			field, err := channelling.ParseCustomField(option, container.GetStringDefault("customfields", option, ""))
+			if err != nil {
+				return nil, err
+			}
+			customFields = append(customFields, field)
+		}
+		log.Printf("Using %d custom fields\n", len(customFields))
+	}
+
+	pipelinesIDScheme := container.GetStringDefault("app", "pipelinesIDScheme", channelling.PipelineIDSchemePlain)
+	switch pipelinesIDScheme {
+	case channelling.PipelineIDSchemePlain, channelling.PipelineIDSchemeEscaped, channelling.PipelineIDSchemeOpaque:
+	default:
+		return nil, fmt.Errorf("Invalid pipelinesIDScheme %s, must be plain, escaped or opaque", pipelinesIDScheme)
+	}
+	roomOwners := make(map[string]string)
+	if options, _ := container.GetOptions("roomowners"); len(options) > 0 {
+		for _, option := range options {
+			if owner := container.GetStringDefault("roomowners", option, ""); owner != "" {
+				roomOwners[option] = owner
+			}
+		}
+	}
+
+	sessionFingerprint := strings.Fields(container.GetStringDefault("app", "sessionFingerprint", ""))
+	for _, part := range sessionFingerprint {
+		if !fingerprintParts[part] {
+			return nil, fmt.Errorf("Unsupported session fingerprint part '%s'", part)
+		}
+	}
+	if len(sessionFingerprint) > 0 {
+		log.Printf("Binding session tokens to client %s\n", strings.Join(sessionFingerprint, " "))
+	}
+
+	messageRates := map[string]int{
+		"Dtmf": channelling.DtmfRateDefault,
+	}
+	if options, _ := container.GetOptions("messagerates"); len(options) > 0 {
+		for _, option := range options {
+			if rate := container.GetIntDefault("messagerates", option, 0); rate > 0 {
+				messageRates[option] = rate
+				log.Printf("Limiting %s messages to %d per minute\n", option, rate)
+			} else {
+				delete(messageRates, option)
+			}
+		}
+	}
+
+	retentionMaxAges := map[string]time.Duration{
+		channelling.RetentionParticipants: time.Duration(container.GetIntDefault("retention", "participants", 0)) * time.Second,
+		channelling.RetentionErasures:     time.Duration(container.GetIntDefault("retention", "erasures", 0)) * time.Second,
+		channelling.RetentionTurnUsage:    time.Duration(container.GetIntDefault("retention", "turnUsage", 86400)) * time.Second,
+		channelling.RetentionTerms:        time.Duration(container.GetIntDefault("retention", "terms", 0)) * time.Second,
+		channelling.RetentionChatIndex:    time.Duration(container.GetIntDefault("retention", "chatIndex", 0)) * time.Second,
+	}
+	retentionInterval := container.GetIntDefault("retention", "interval", 3600)
+	if retentionInterval < 60 {
+		retentionInterval = 60
+	}
+
+	stepUpActions := make(map[string]bool)
+	for _, action := range strings.Split(container.GetStringDefault("stepup", "actions", "endroom recording"), " ") {
+		if action = strings.TrimSpace(action); action != "" {
+			stepUpActions[action] = true
+		}
+	}
+
 	return &channelling.Config{
 		Title:                           container.GetStringDefault("app", "title", "Spreed WebRTC"),
 		Ver:                             ver,
@@ -126,13 +291,24 @@ func NewConfig(container phoenix.Container, tokens bool) (*channelling.Config, e
 		Token:                           serverToken,
 		Renegotiation:                   container.GetBoolDefault("app", "renegotiation", false),
 		StunURIs:                        stunURIs,
+		StunListen:                      stunListen,
 		TurnURIs:                        turnURIs,
+		TurnUsageLog:                    container.GetStringDefault("app", "turnUsageLog", ""),
+		TermsVersion:                    container.GetStringDefault("app", "termsVersion", ""),
+		TermsText:                       container.GetStringDefault("app", "termsText", ""),
+		TermsURL:                        container.GetStringDefault("app", "termsURL", ""),
+		Motd:                            container.GetStringDefault("app", "motd", ""),
+		AnnouncementsFile:               container.GetStringDefault("app", "announcementsFile", ""),
+		BlocklistFile:                   container.GetStringDefault("app", "blocklistFile", ""),
+		FavoritesFile:                   container.GetStringDefault("app", "favoritesFile", ""),
 		Tokens:                          tokens,
 		Version:                         version,
 		UsersEnabled:                    container.GetBoolDefault("users", "enabled", false),
 		UsersAllowRegistration:          container.GetBoolDefault("users", "allowRegistration", false),
 		UsersMode:                       container.GetStringDefault("users", "mode", ""),
 		DefaultRoomEnabled:              container.GetBoolDefault("app", "defaultRoomEnabled", true),
+		RoomSearchEnabled:               container.GetBoolDefault("app", "roomSearch", false),
+		PrivacyMode:                     container.GetBoolDefault("app", "privacyMode", false),
 		Plugin:                          container.GetStringDefault("app", "plugin", ""),
 		AuthorizeRoomCreation:           container.GetBoolDefault("app", "authorizeRoomCreation", false),
 		AuthorizeRoomJoin:               container.GetBoolDefault("app", "authorizeRoomJoin", false),
@@ -141,11 +317,88 @@ func NewConfig(container phoenix.Container, tokens bool) (*channelling.Config, e
 		GlobalRoomID:                    container.GetStringDefault("app", "globalRoom", ""),
 		ContentSecurityPolicy:           container.GetStringDefault("app", "contentSecurityPolicy", ""),
 		ContentSecurityPolicyReportOnly: container.GetStringDefault("app", "contentSecurityPolicyReportOnly", ""),
+		ContentSecurityPolicyReport:     container.GetBoolDefault("app", "contentSecurityPolicyReport", false),
+		FrameAncestors:                  container.GetStringDefault("app", "frameAncestors", ""),
+		StrictTransportSecurity:         container.GetStringDefault("http", "strictTransportSecurity", ""),
+		ReferrerPolicy:                  container.GetStringDefault("http", "referrerPolicy", ""),
 		RoomTypeDefault:                 defaultRoomType,
 		RoomTypes:                       roomTypes,
+		RoomExpiry:                      time.Duration(container.GetIntDefault("app", "roomExpiry", 60)) * time.Second,
+		RoomOwners:                      roomOwners,
+		RoomNamePattern:                 roomNamePattern,
+		RoomNameBlocklist:               roomNameBlocklist,
+		RoomBroadcastBusThreshold:       container.GetIntDefault("nats", "roomBroadcastThreshold", 0),
+		ClusterHeartbeatInterval:        time.Duration(container.GetIntDefault("nats", "heartbeatInterval", 5)) * time.Second,
+		ClusterTimeout:                  time.Duration(container.GetIntDefault("nats", "clusterTimeout", 15)) * time.Second,
+		BusBridgeVersions:               busBridgeVersions,
+		RoomTemplates:                   roomTemplates,
+		CustomFields:                    channelling.NewCustomFieldSchema(customFields),
+		SnapshotFile:                    container.GetStringDefault("app", "snapshotFile", ""),
+		SnapshotMaxAge:                  time.Duration(container.GetIntDefault("app", "snapshotMaxAge", 300)) * time.Second,
+		RoomNamePrefixes:                roomNamePrefixes,
+		PipelinesCleanupInterval:        time.Duration(container.GetIntDefault("app", "pipelinesCleanupInterval", 30)) * time.Second,
+		PipelinesCleanupJitter:          time.Duration(container.GetIntDefault("app", "pipelinesCleanupJitter", 5)) * time.Second,
+		PipelinesCleanupChunkSize:       container.GetIntDefault("app", "pipelinesCleanupChunkSize", 100),
+		PipelinesIDScheme:               pipelinesIDScheme,
+		StepUpActions:                   stepUpActions,
+		StepUpWindow:                    time.Duration(container.GetIntDefault("stepup", "window", 300)) * time.Second,
+		BlobMaxSize:                     container.GetIntDefault("app", "blobMaxSize", 65536),
+		BlobQuota:                       container.GetIntDefault("app", "blobQuota", 262144),
+		BlobTimeout:                     time.Duration(container.GetIntDefault("app", "blobTimeout", 30)) * time.Second,
+		FollowInterval:                  time.Duration(container.GetIntDefault("app", "followInterval", 1)) * time.Second,
+		BandwidthMinimum:                container.GetIntDefault("app", "bandwidthMinimum", 100),
+		BandwidthMaximum:                container.GetIntDefault("app", "bandwidthMaximum", 2000),
+		MediaModeSFUThreshold:           container.GetIntDefault("app", "sfuThreshold", 0),
+		MediaModeMeshThreshold:          container.GetIntDefault("app", "sfuMeshThreshold", 0),
+		MediaModeTimeout:                time.Duration(container.GetIntDefault("app", "sfuSwitchTimeout", 10)) * time.Second,
+		RetentionMaxAges:                retentionMaxAges,
+		RetentionInterval:               time.Duration(retentionInterval) * time.Second,
+		RetentionDryRun:                 container.GetBoolDefault("retention", "dryRun", false),
+		RecordingConsentTimeout:         time.Duration(container.GetIntDefault("app", "recordingConsentTimeout", 30)) * time.Second,
+		RecordingConsentEject:           container.GetBoolDefault("app", "recordingConsentEject", false),
+		AuthLimitThreshold:              container.GetIntDefault("app", "authLimitThreshold", 5),
+		AuthLimitLockout:                time.Duration(container.GetIntDefault("app", "authLimitLockout", 30)) * time.Second,
+		AuthLimitMaxLockout:             time.Duration(container.GetIntDefault("app", "authLimitMaxLockout", 3600)) * time.Second,
+		SpamFilter:                      container.GetBoolDefault("spam", "enabled", false),
+		SpamWindow:                      time.Duration(container.GetIntDefault("spam", "window", 10)) * time.Second,
+		SpamMaxMessages:                 container.GetIntDefault("spam", "maxMessages", 10),
+		SpamMaxRepeats:                  container.GetIntDefault("spam", "maxRepeats", 3),
+		SpamMaxLinks:                    container.GetIntDefault("spam", "maxLinks", 3),
+		SpamThrottle:                    time.Duration(container.GetIntDefault("spam", "throttle", 30)) * time.Second,
+		SpamMuteStrikes:                 container.GetIntDefault("spam", "muteStrikes", 3),
+		SpamMute:                        time.Duration(container.GetIntDefault("spam", "mute", 600)) * time.Second,
+		ChatFilterWordList:              container.GetStringDefault("chatfilter", "wordList", ""),
+		ChatFilterAction:                container.GetStringDefault("chatfilter", "action", channelling.ChatFilterActionMask),
+		MessageRates:                    messageRates,
+		TrustForwardedFor:               container.GetBoolDefault("http", "trustForwardedFor", false),
+		SessionFingerprint:              sessionFingerprint,
+		AffinityNode:                    container.GetStringDefault("http", "affinityNode", ""),
+		AffinityCookie:                  container.GetStringDefault("http", "affinityCookie", "spreed-affinity"),
 	}, nil
 }
 
+// builtinStunURI returns the URI clients use to reach the built-in STUN
+// server. Without an explicit public address, the listen address is used
+// unless it has no, an unspecified or a link-local host. Public addresses
+// without port get the port of the listen address, IPv6 addresses are put
+// in brackets.
+func builtinStunURI(listen, advertise string) string {
+	host, port, err := net.SplitHostPort(listen)
+	if err != nil {
+		return ""
+	}
+	if advertise == "" {
+		ip := net.ParseIP(host)
+		if host == "" || (ip != nil && (ip.IsUnspecified() || ip.IsLinkLocalUnicast())) {
+			return ""
+		}
+		advertise = net.JoinHostPort(host, port)
+	} else if _, _, err := net.SplitHostPort(advertise); err != nil {
+		advertise = net.JoinHostPort(strings.Trim(advertise, "[]"), port)
+	}
+	return fmt.Sprintf("stun:%s", advertise)
+}
+
 // Helper function to clean up string arrays.
 func trimAndRemoveDuplicates(data *[]string) {
 	found := make(map[string]bool)
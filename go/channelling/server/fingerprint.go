@@ -0,0 +1,76 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"net"
+	"net/http"
+
+	"github.com/strukturag/spreed-webrtc/go/channelling"
+)
+
+// fingerprintParts are the supported parts of client fingerprints.
+var fingerprintParts = map[string]bool{
+	"ua":   true,
+	"ip":   true,
+	"cert": true,
+}
+
+// ClientFingerprint returns a hash of the properties of the client of
+// request which are configured in config.SessionFingerprint, or an empty
+// string if session tokens are not bound to clients.
+func ClientFingerprint(config *channelling.Config, request *http.Request) string {
+	if config == nil || len(config.SessionFingerprint) == 0 {
+		return ""
+	}
+	h := sha256.New()
+	for _, part := range config.SessionFingerprint {
+		switch part {
+		case "ua":
+			h.Write([]byte(request.UserAgent()))
+		case "ip":
+			h.Write([]byte(clientNetwork(RemoteIP(config, request))))
+		case "cert":
+			if request.TLS != nil && len(request.TLS.PeerCertificates) > 0 {
+				h.Write(request.TLS.PeerCertificates[0].Raw)
+			}
+		}
+		h.Write([]byte{0})
+	}
+	return base64.URLEncoding.EncodeToString(h.Sum(nil)[:16])
+}
+
+// clientNetwork returns the /24 network of IPv4 and the /64 network of IPv6
+// addresses, so clients keep their fingerprint when their address changes
+// within their network.
+func clientNetwork(address string) string {
+	ip := net.ParseIP(address)
+	if ip == nil {
+		return address
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		return ip4.Mask(net.CIDRMask(24, 32)).String()
+	}
+	return ip.Mask(net.CIDRMask(64, 128)).String()
+}
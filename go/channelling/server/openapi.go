@@ -0,0 +1,225 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// OpenAPIVersion is the version of the OpenAPI specification of the
+// documents created by OpenAPI.
+const OpenAPIVersion = "3.0.0"
+
+var openAPIPathParameter = regexp.MustCompile(`\{([^}:]+)(:[^}]*)?\}`)
+
+type openAPIGetter interface {
+	Get(*http.Request) (int, interface{}, http.Header)
+}
+
+type openAPIPoster interface {
+	Post(*http.Request) (int, interface{}, http.Header)
+}
+
+type openAPIPutter interface {
+	Put(*http.Request) (int, interface{}, http.Header)
+}
+
+type openAPIPatcher interface {
+	Patch(*http.Request) (int, interface{}, http.Header)
+}
+
+type openAPIDeleter interface {
+	Delete(*http.Request) (int, interface{}, http.Header)
+}
+
+type OpenAPIInfo struct {
+	Title   string `json:"title"`
+	Version string `json:"version"`
+}
+
+type OpenAPIServer struct {
+	Url string `json:"url"`
+}
+
+type OpenAPIParameter struct {
+	Name     string                 `json:"name"`
+	In       string                 `json:"in"`
+	Required bool                   `json:"required"`
+	Schema   map[string]interface{} `json:"schema"`
+}
+
+type OpenAPIOperation struct {
+	OperationId string                 `json:"operationId"`
+	Tags        []string               `json:"tags"`
+	Parameters  []*OpenAPIParameter    `json:"parameters,omitempty"`
+	RequestBody map[string]interface{} `json:"requestBody,omitempty"`
+	Responses   map[string]interface{} `json:"responses"`
+	Security    []map[string][]string  `json:"security,omitempty"`
+}
+
+type OpenAPIComponents struct {
+	Schemas         map[string]interface{} `json:"schemas"`
+	SecuritySchemes map[string]interface{} `json:"securitySchemes"`
+}
+
+// OpenAPI describes the REST resources added to it as OpenAPI document, so
+// client SDKs can be generated. Operations are derived from the methods
+// the resources implement.
+type OpenAPI struct {
+	Openapi    string                                  `json:"openapi"`
+	Info       *OpenAPIInfo                            `json:"info"`
+	Servers    []*OpenAPIServer                        `json:"servers"`
+	Paths      map[string]map[string]*OpenAPIOperation `json:"paths"`
+	Components *OpenAPIComponents                      `json:"components"`
+}
+
+// NewOpenAPI creates an empty document for the API of version which is
+// served below url.
+func NewOpenAPI(title, version, url string) *OpenAPI {
+	return &OpenAPI{
+		Openapi: OpenAPIVersion,
+		Info:    &OpenAPIInfo{title, version},
+		Servers: []*OpenAPIServer{{url}},
+		Paths:   make(map[string]map[string]*OpenAPIOperation),
+		Components: &OpenAPIComponents{
+			Schemas: map[string]interface{}{
+				"ApiError": map[string]interface{}{
+					"type": "object",
+					"properties": map[string]interface{}{
+						"code":    map[string]string{"type": "string"},
+						"message": map[string]string{"type": "string"},
+						"success": map[string]string{"type": "boolean"},
+					},
+				},
+			},
+			SecuritySchemes: map[string]interface{}{
+				"bearerAuth": map[string]string{"type": "http", "scheme": "bearer"},
+			},
+		},
+	}
+}
+
+// AddResource documents the methods of resource at paths. Secured
+// resources require a bearer token.
+func (spec *OpenAPI) AddResource(resource interface{}, secured bool, paths ...string) {
+	name := reflect.Indirect(reflect.ValueOf(resource)).Type().Name()
+	for idx, path := range paths {
+		var parameters []*OpenAPIParameter
+		var parameterNames []string
+		for _, match := range openAPIPathParameter.FindAllStringSubmatch(path, -1) {
+			parameters = append(parameters, &OpenAPIParameter{match[1], "path", true, map[string]interface{}{"type": "string"}})
+			parameterNames = append(parameterNames, strings.Title(match[1]))
+		}
+		path = openAPIPathParameter.ReplaceAllString(path, "{$1}")
+		suffix := ""
+		if idx > 0 {
+			if len(parameterNames) > 0 {
+				suffix = "By" + strings.Join(parameterNames, "And")
+			} else {
+				suffix = strconv.Itoa(idx + 1)
+			}
+		}
+
+		operations := spec.Paths[path]
+		if operations == nil {
+			operations = make(map[string]*OpenAPIOperation)
+			spec.Paths[path] = operations
+		}
+		for _, method := range openAPIMethods(resource) {
+			operation := &OpenAPIOperation{
+				OperationId: method + name + suffix,
+				Tags:        []string{openAPITag(path)},
+				Parameters:  parameters,
+				Responses: map[string]interface{}{
+					"200": map[string]string{"description": "Success"},
+					"default": map[string]interface{}{
+						"description": "Error",
+						"content": map[string]interface{}{
+							"application/json": map[string]interface{}{
+								"schema": map[string]string{"$ref": "#/components/schemas/ApiError"},
+							},
+						},
+					},
+				},
+			}
+			if method == "post" || method == "put" || method == "patch" {
+				operation.RequestBody = map[string]interface{}{
+					"content": map[string]interface{}{
+						"application/json":                  map[string]interface{}{},
+						"application/x-www-form-urlencoded": map[string]interface{}{},
+					},
+				}
+			}
+			if secured {
+				operation.Security = []map[string][]string{{"bearerAuth": {}}}
+			}
+			operations[method] = operation
+		}
+	}
+}
+
+// ServeHTTP serves the document as JSON.
+func (spec *OpenAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	data, err := json.MarshalIndent(spec, "", "  ")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Write(data)
+}
+
+// openAPITag groups operations by the first segment of their path, and
+// admin operations by their second segment.
+func openAPITag(path string) string {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	if segments[0] == "admin" && len(segments) > 1 {
+		return "admin/" + segments[1]
+	}
+	return segments[0]
+}
+
+// openAPIMethods returns the HTTP methods implemented by resource.
+func openAPIMethods(resource interface{}) (methods []string) {
+	if _, ok := resource.(openAPIGetter); ok {
+		methods = append(methods, "get")
+	}
+	if _, ok := resource.(openAPIPoster); ok {
+		methods = append(methods, "post")
+	}
+	if _, ok := resource.(openAPIPutter); ok {
+		methods = append(methods, "put")
+	}
+	if _, ok := resource.(openAPIPatcher); ok {
+		methods = append(methods, "patch")
+	}
+	if _, ok := resource.(openAPIDeleter); ok {
+		methods = append(methods, "delete")
+	}
+	return
+}
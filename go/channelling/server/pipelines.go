@@ -23,6 +23,7 @@ package server
 
 import (
 	"encoding/json"
+	"io/ioutil"
 	"net/http"
 	"strconv"
 
@@ -77,11 +78,15 @@ func (pipelines *Pipelines) Post(request *http.Request) (int, interface{}, http.
 		return http.StatusNotFound, "", nil
 	}
 
+	body, err := ioutil.ReadAll(request.Body)
+	if err != nil {
+		return http.StatusBadRequest, err.Error(), nil
+	}
 	var incoming channelling.DataIncoming
-	dec := json.NewDecoder(request.Body)
-	if err := dec.Decode(&incoming); err != nil {
+	if err := json.Unmarshal(body, &incoming); err != nil {
 		return http.StatusBadRequest, err.Error(), nil
 	}
+	pipeline.CountIncoming(len(body))
 
 	result := &channelling.DataOutgoing{
 		From: pipeline.FromSession().Id,
@@ -0,0 +1,49 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package server
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/strukturag/spreed-webrtc/go/channelling"
+)
+
+// RemoteIP returns the client address of request. The last entry of the
+// X-Forwarded-For header is used when the configuration trusts it, which
+// is the address seen by the proxy in front of this server. Addresses are
+// normalized, so IPv4 clients of dual-stack sockets get their IPv4 address.
+func RemoteIP(config *channelling.Config, request *http.Request) string {
+	if config != nil && config.TrustForwardedFor {
+		if forwarded := request.Header.Get("X-Forwarded-For"); forwarded != "" {
+			parts := strings.Split(forwarded, ",")
+			if ip := channelling.NormalizeIP(parts[len(parts)-1]); ip != "" {
+				return ip
+			}
+		}
+	}
+
+	if ip := channelling.NormalizeIP(request.RemoteAddr); ip != "" {
+		return ip
+	}
+	return request.RemoteAddr
+}
@@ -0,0 +1,81 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/strukturag/spreed-webrtc/go/channelling"
+)
+
+type RoomSearchItem struct {
+	Name      string                 `json:"name"`
+	Type      string                 `json:"type"`
+	Template  string                 `json:"template,omitempty"`
+	Occupancy int                    `json:"occupancy"`
+	Active    *time.Time             `json:"active,omitempty"`
+	Fields    map[string]interface{} `json:"fields,omitempty"`
+}
+
+type RoomSearch struct {
+	channelling.RoomSearcher
+}
+
+// Get lists the public rooms matching the query parameter q, e.g. to
+// autocomplete room names. Locked rooms and rooms with a PIN are never
+// listed, use the RoomSearch channeling API to include the rooms of the
+// user.
+func (search *RoomSearch) Get(request *http.Request) (int, interface{}, http.Header) {
+	query := request.URL.Query()
+	order := query.Get("sort")
+	switch order {
+	case "", channelling.RoomSearchOccupancy, channelling.RoomSearchRecent:
+	default:
+		return http.StatusBadRequest, NewApiError("room_search_bad_sort", "Sort must be occupancy or recent"), http.Header{"Content-Type": {"application/json"}}
+	}
+	var limit int
+	if value := query.Get("limit"); value != "" {
+		var err error
+		if limit, err = strconv.Atoi(value); err != nil || limit <= 0 {
+			return http.StatusBadRequest, NewApiError("room_search_bad_limit", "Limit must be a positive number"), http.Header{"Content-Type": {"application/json"}}
+		}
+	}
+
+	results := search.SearchRooms("", query.Get("q"), order, limit)
+	items := make([]*RoomSearchItem, len(results))
+	for i, result := range results {
+		items[i] = &RoomSearchItem{
+			Name:      result.Name,
+			Type:      result.Type,
+			Template:  result.Template,
+			Occupancy: result.Occupancy,
+			Fields:    result.Fields,
+		}
+		if !result.Active.IsZero() {
+			active := result.Active
+			items[i].Active = &active
+		}
+	}
+	return http.StatusOK, items, http.Header{"Content-Type": {"application/json"}}
+}
@@ -25,6 +25,7 @@ import (
 	"fmt"
 	"net/http"
 
+	"github.com/strukturag/spreed-webrtc/go/idgen"
 	"github.com/strukturag/spreed-webrtc/go/randomstring"
 )
 
@@ -34,11 +35,18 @@ type Room struct {
 }
 
 type Rooms struct {
+	// NewName creates names of new rooms, random names if nil.
+	NewName idgen.Generator
 }
 
 func (rooms *Rooms) Post(request *http.Request) (int, interface{}, http.Header) {
 
-	name := randomstring.NewRandomString(11)
+	var name string
+	if rooms.NewName != nil {
+		name = rooms.NewName()
+	} else {
+		name = randomstring.NewRandomString(11)
+	}
 	return 200, &Room{name, fmt.Sprintf("/%s", name)}, http.Header{"Content-Type": {"application/json"}}
 
 }
@@ -48,12 +48,20 @@ type SessionNonceRequest struct {
 type Sessions struct {
 	channelling.SessionValidator
 	channelling.SessionStore
-	Users *Users
+	Users       *Users
+	AuthLimiter channelling.AuthLimiter
+	Config      *channelling.Config
 }
 
 // Patch is used to add a userid to a given session (login).
 func (sessions *Sessions) Patch(request *http.Request) (int, interface{}, http.Header) {
 
+	remoteIP := RemoteIP(sessions.Config, request)
+	if err := sessions.AuthLimiter.AuthAllowed(remoteIP, ""); err != nil {
+		log.Println("Session patch failed - locked.", remoteIP)
+		return 429, NewApiError("auth_locked", err.Error()), http.Header{"Content-Type": {"application/json"}}
+	}
+
 	// Make sure to always run all the checks to make timing attacks harder.
 	error := false
 
@@ -122,9 +130,11 @@ func (sessions *Sessions) Patch(request *http.Request) (int, interface{}, http.H
 	}
 
 	if error {
+		sessions.AuthLimiter.AuthFailed(remoteIP, "", "session_patch_failed")
 		return 403, NewApiError("session_patch_failed", "Failed to patch session"), http.Header{"Content-Type": {"application/json"}}
 	}
 
+	sessions.AuthLimiter.AuthSucceeded(remoteIP, "")
 	log.Printf("Session patch successfull %s -> %s\n", snr.Id, userid)
 	return 200, &SessionNonce{Nonce: nonce, Userid: userid, Success: true}, http.Header{"Content-Type": {"application/json"}}
 
@@ -43,6 +43,7 @@ import (
 	"time"
 
 	"github.com/strukturag/spreed-webrtc/go/channelling"
+	"github.com/strukturag/spreed-webrtc/go/plugins"
 
 	"github.com/longsleep/pkac"
 	"github.com/satori/go.uuid"
@@ -60,7 +61,9 @@ type UsersHandler interface {
 }
 
 type UsersSharedsecretHandler struct {
-	secret []byte
+	secret  []byte
+	maxTTL  time.Duration           // Maximum validity of accepted secrets, 0 for any.
+	replays channelling.ReplayCache // Used secrets, nil to accept secrets repeatedly.
 }
 
 func (uh *UsersSharedsecretHandler) createHMAC(useridCombo string) string {
@@ -91,15 +94,24 @@ func (uh *UsersSharedsecretHandler) Validate(snr *SessionNonceRequest, request *
 	}
 
 	// Check expiration.
-	if time.Unix(expiration, 0).Before(time.Now()) {
+	now := time.Now()
+	expires := time.Unix(expiration, 0)
+	if expires.Before(now) {
 		return "", errors.New("expired secret")
 	}
+	if uh.maxTTL > 0 && expires.Sub(now) > uh.maxTTL {
+		return "", errors.New("secret is valid for too long")
+	}
 
 	secret := uh.createHMAC(snr.UseridCombo)
 	if subtle.ConstantTimeCompare([]byte(snr.Secret), []byte(secret)) != 1 {
 		return "", errors.New("invalid secret")
 	}
 
+	if uh.replays != nil && !uh.replays.Use(snr.Secret, expires) {
+		return "", errors.New("secret was already used")
+	}
+
 	return userid, nil
 
 }
@@ -136,6 +148,26 @@ func (uh *UsersHTTPHeaderHandler) Create(un *UserNonce, request *http.Request) (
 	return nil, errors.New("create is not possible in httpheader mode")
 }
 
+type UsersPluginHandler struct {
+	host *plugins.Host
+}
+
+func (uh *UsersPluginHandler) Get(request *http.Request) (string, error) {
+	return "", errors.New("get is not possible in plugin mode")
+}
+
+func (uh *UsersPluginHandler) Validate(snr *SessionNonceRequest, request *http.Request) (string, error) {
+	return uh.host.Authenticate(&plugins.AuthRequest{
+		UseridCombo: snr.UseridCombo,
+		Secret:      snr.Secret,
+		RemoteAddr:  request.RemoteAddr,
+	})
+}
+
+func (uh *UsersPluginHandler) Create(un *UserNonce, request *http.Request) (*UserNonce, error) {
+	return nil, errors.New("create is not possible in plugin mode")
+}
+
 type UsersCertificateHandler struct {
 	validFor            time.Duration
 	privateKey          crypto.PrivateKey
@@ -301,7 +333,7 @@ type Users struct {
 	handler UsersHandler
 }
 
-func NewUsers(sessionStore channelling.SessionStore, sessionValidator channelling.SessionValidator, sessionManager channelling.SessionManager, mode, realm string, runtime phoenix.Runtime) *Users {
+func NewUsers(sessionStore channelling.SessionStore, sessionValidator channelling.SessionValidator, sessionManager channelling.SessionManager, mode, realm string, runtime phoenix.Runtime, pluginHost *plugins.Host) *Users {
 	var users = &Users{
 		sessionStore,
 		sessionValidator,
@@ -313,7 +345,7 @@ func NewUsers(sessionStore channelling.SessionStore, sessionValidator channellin
 	// Create handler based on mode.
 	var handler UsersHandler
 	var err error
-	if handler, err = users.createHandler(mode, runtime); handler != nil && err == nil {
+	if handler, err = users.createHandler(mode, runtime, pluginHost); handler != nil && err == nil {
 		users.handler = handler
 		log.Printf("Enabled users handler '%s'\n", mode)
 	} else if err != nil {
@@ -323,13 +355,27 @@ func NewUsers(sessionStore channelling.SessionStore, sessionValidator channellin
 	return users
 }
 
-func (users *Users) createHandler(mode string, runtime phoenix.Runtime) (handler UsersHandler, err error) {
+func (users *Users) createHandler(mode string, runtime phoenix.Runtime, pluginHost *plugins.Host) (handler UsersHandler, err error) {
 
 	switch mode {
+	case "plugin":
+		if pluginHost != nil && pluginHost.Has(plugins.CapabilityAuth) {
+			handler = &UsersPluginHandler{host: pluginHost}
+		} else {
+			err = errors.New("Cannot enable plugin users handler: No auth plugin loaded.")
+		}
 	case "sharedsecret":
 		secret, _ := runtime.GetString("users", "sharedsecret_secret")
 		if secret != "" {
-			handler = &UsersSharedsecretHandler{secret: []byte(secret)}
+			uh := &UsersSharedsecretHandler{secret: []byte(secret)}
+			if maxTTL, _ := runtime.GetInt("users", "sharedsecret_maxTTL"); maxTTL > 0 {
+				uh.maxTTL = time.Duration(maxTTL) * time.Second
+			}
+			if singleUse, _ := runtime.GetBool("users", "sharedsecret_singleUse"); singleUse {
+				uh.replays = channelling.NewReplayCache(0)
+				log.Println("Shared secret logins can only be used once")
+			}
+			handler = uh
 		} else {
 			err = errors.New("Cannot enable sharedsecret users handler: No secret.")
 		}
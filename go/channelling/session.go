@@ -30,33 +30,76 @@ import (
 	"github.com/gorilla/securecookie"
 )
 
-var sessionNonces *securecookie.SecureCookie
+const sessionNonceMaxAge = 60 // Seconds an authentication nonce is valid.
+
+var (
+	sessionNonces       *securecookie.SecureCookie
+	sessionNonceReplays = NewReplayCache(0)
+)
 
 type Session struct {
-	SessionManager    SessionManager
-	Unicaster         Unicaster
-	Broadcaster       Broadcaster
-	RoomStatusManager RoomStatusManager
-	buddyImages       ImageCache
-	Id                string
-	Sid               string
-	Ua                string
-	UpdateRev         uint64
-	Status            interface{}
-	Nonce             string
-	Prio              int
-	Hello             bool
-	Roomid            string
-	mutex             sync.RWMutex
-	userid            string
-	fake              bool
-	stamp             int64
-	attestation       *SessionAttestation
-	attestations      *securecookie.SecureCookie
-	subscriptions     map[string]*Session
-	subscribers       map[string]*Session
-	disconnected      bool
-	replaced          bool
+	SessionManager         SessionManager
+	Unicaster              Unicaster
+	Broadcaster            Broadcaster
+	RoomStatusManager      RoomStatusManager
+	buddyImages            ImageCache
+	Id                     string
+	Sid                    string
+	Ua                     string
+	UpdateRev              uint64
+	Status                 interface{}
+	Nonce                  string
+	Prio                   int
+	Hello                  bool
+	Roomid                 string
+	RemoteIP               string
+	mutex                  sync.RWMutex
+	roomRole               string
+	fields                 map[string]interface{} // Custom fields, replaced on updates.
+	locale                 string                 // Locale for server-generated messages.
+	accessibility          map[string]bool        // Kinds of subscribed accessibility events.
+	private                bool                   // Session is excluded from events and statistics.
+	stepUpChallenge        string
+	stepUpChallengeExpires time.Time
+	stepUpConfirmed        time.Time
+	userid                 string
+	fingerprint            string // Client fingerprint the session tokens are bound to.
+	fake                   bool
+	stamp                  int64
+	attestation            *SessionAttestation
+	attestations           *securecookie.SecureCookie
+	subscriptions          map[string]*Session
+	subscribers            map[string]*Session
+	disconnected           bool
+	replaced               bool
+	latency                SessionLatency
+	network                SessionNetwork
+	stale                  bool
+}
+
+// SessionLatency aggregates the signaling round trip times in milliseconds
+// reported by the client of a session.
+type SessionLatency struct {
+	Last    int    `json:"last"`
+	Average int    `json:"average"`
+	Min     int    `json:"min"`
+	Max     int    `json:"max"`
+	Samples uint64 `json:"samples"`
+}
+
+// Liveness of sessions in presence updates.
+const (
+	SessionLivenessConnected = "connected" // Connection answers pings.
+	SessionLivenessStale     = "stale"     // Connection missed a pong, the client is probably reconnecting.
+	SessionLivenessGone      = "gone"      // Session left.
+)
+
+// SessionNetwork records the network changes reported by the client of a
+// session, for quality analytics.
+type SessionNetwork struct {
+	Network string    `json:"network,omitempty"`
+	Changes int       `json:"changes"`
+	Changed time.Time `json:"changed"`
 }
 
 func NewSession(manager SessionManager,
@@ -123,7 +166,7 @@ func (s *Session) RemoveSubscriber(id string) {
 	s.mutex.Unlock()
 }
 
-func (s *Session) JoinRoom(roomName, roomType string, credentials *DataRoomCredentials, sender Sender) (*DataRoom, error) {
+func (s *Session) JoinRoom(roomName, roomType, template string, credentials *DataRoomCredentials, sender Sender) (*DataRoom, error) {
 	roomID := s.RoomStatusManager.MakeRoomID(roomName, roomType)
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
@@ -132,10 +175,14 @@ func (s *Session) JoinRoom(roomName, roomType string, credentials *DataRoomCrede
 		s.doLeaveRoom("soft")
 	}
 
-	room, err := s.RoomStatusManager.JoinRoom(roomID, roomName, roomType, credentials, s, s.authenticated(), sender)
+	room, err := s.RoomStatusManager.JoinRoom(roomID, roomName, roomType, template, credentials, s, s.authenticated(), sender)
 	if err == nil {
 		s.Hello = true
 		s.Roomid = roomID
+		s.roomRole = ""
+		if credentials != nil && credentials.link != nil {
+			s.roomRole = credentials.link.Role
+		}
 		s.Broadcaster.Broadcast(s.Id, s.Roomid, &DataOutgoing{
 			From: s.Id,
 			A:    s.attestation.Token(),
@@ -146,6 +193,7 @@ func (s *Session) JoinRoom(roomName, roomType string, credentials *DataRoomCrede
 				Ua:     s.Ua,
 				Prio:   s.Prio,
 				Status: s.Status,
+				Fields: s.fields,
 			},
 		})
 	} else {
@@ -155,6 +203,153 @@ func (s *Session) JoinRoom(roomName, roomType string, credentials *DataRoomCrede
 	return room, err
 }
 
+// RoomID returns the id of the room the session joined last.
+func (s *Session) RoomID() string {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	return s.Roomid
+}
+
+// RoomRole returns the role granted by the room link the session used to
+// join its current room or by a join extension, or an empty string.
+func (s *Session) RoomRole() string {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	return s.roomRole
+}
+
+// SetRoomRole sets the role of the session in its current room.
+func (s *Session) SetRoomRole(role string) {
+	s.mutex.Lock()
+	s.roomRole = role
+	s.mutex.Unlock()
+}
+
+// UpdateLatency adds a round trip time in milliseconds measured by the
+// client. The average is a moving average weighting the last sample with 1/8.
+func (s *Session) UpdateLatency(rtt int) {
+	s.mutex.Lock()
+	l := &s.latency
+	if l.Samples == 0 {
+		l.Average, l.Min, l.Max = rtt, rtt, rtt
+	} else {
+		l.Average += (rtt - l.Average) / 8
+		if rtt < l.Min {
+			l.Min = rtt
+		}
+		if rtt > l.Max {
+			l.Max = rtt
+		}
+	}
+	l.Last = rtt
+	l.Samples++
+	s.mutex.Unlock()
+}
+
+// Latency returns a copy of the aggregated round trip times, or nil if the
+// client did not report any.
+func (s *Session) Latency() *SessionLatency {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	if s.latency.Samples == 0 {
+		return nil
+	}
+	latency := s.latency
+	return &latency
+}
+
+// SetStale marks the connection of the session as stale, and returns true
+// if this changed its liveness.
+func (s *Session) SetStale(stale bool) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	changed := s.stale != stale
+	s.stale = stale
+	return changed
+}
+
+// SetLocale sets the locale server-generated messages are translated into.
+func (s *Session) SetLocale(locale string) {
+	s.mutex.Lock()
+	s.locale = locale
+	s.mutex.Unlock()
+}
+
+// Locale returns the locale of the session, empty if it is unknown.
+func (s *Session) Locale() string {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.locale
+}
+
+// SetPrivate sets the privacy mode of the session. Sessions in privacy mode
+// are left out of bus events, TURN usage and quality statistics.
+func (s *Session) SetPrivate(private bool) {
+	s.mutex.Lock()
+	s.private = private
+	s.mutex.Unlock()
+}
+
+// Private returns true if the session is in privacy mode.
+func (s *Session) Private() bool {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.private
+}
+
+// SetAccessibility replaces the kinds of accessibility events the session
+// receives.
+func (s *Session) SetAccessibility(kinds []string) {
+	accessibility := make(map[string]bool, len(kinds))
+	for _, kind := range kinds {
+		accessibility[kind] = true
+	}
+	s.mutex.Lock()
+	s.accessibility = accessibility
+	s.mutex.Unlock()
+}
+
+// AccessibilitySubscribed returns true if the session receives
+// accessibility events of kind.
+func (s *Session) AccessibilitySubscribed(kind string) bool {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.accessibility[kind]
+}
+
+// liveness returns the liveness of the session for presence updates.
+func (s *Session) liveness() string {
+	if s.stale {
+		return SessionLivenessStale
+	}
+	return SessionLivenessConnected
+}
+
+// UpdateNetwork records a network change of the client.
+func (s *Session) UpdateNetwork(network string) *SessionNetwork {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.network.Network = network
+	s.network.Changes++
+	s.network.Changed = time.Now()
+	n := s.network
+	return &n
+}
+
+// Network returns a copy of the recorded network changes, or nil if the
+// client did not report any.
+func (s *Session) Network() *SessionNetwork {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	if s.network.Changes == 0 {
+		return nil
+	}
+	network := s.network
+	return &network
+}
+
 func (s *Session) doLeaveRoom(status string) {
 	s.RoomStatusManager.LeaveRoom(s.Roomid, s.Id)
 	s.Broadcaster.Broadcast(s.Id, s.Roomid, &DataOutgoing{
@@ -167,6 +362,7 @@ func (s *Session) doLeaveRoom(status string) {
 		},
 	})
 	s.Hello = false
+	s.roomRole = ""
 }
 
 func (s *Session) LeaveRoom() {
@@ -180,6 +376,21 @@ func (s *Session) LeaveRoom() {
 	s.doLeaveRoom("soft")
 }
 
+// EndRoom takes s out of roomID without broadcasting that it left, as all
+// other sessions are taken out of the ended room as well.
+func (s *Session) EndRoom(roomID string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if !s.Hello || s.Roomid != roomID {
+		return
+	}
+
+	s.RoomStatusManager.LeaveRoom(s.Roomid, s.Id)
+	s.Hello = false
+	s.roomRole = ""
+}
+
 func (s *Session) Broadcast(m interface{}) {
 	s.mutex.RLock()
 	if s.Hello {
@@ -199,18 +410,30 @@ func (s *Session) BroadcastStatus() {
 			From: s.Id,
 			A:    s.attestation.Token(),
 			Data: &DataSession{
-				Type:   "Status",
-				Id:     s.Id,
-				Userid: s.userid,
-				Status: s.Status,
-				Rev:    s.UpdateRev,
-				Prio:   s.Prio,
+				Type:         "Status",
+				Id:           s.Id,
+				Userid:       s.userid,
+				Status:       s.Status,
+				Rev:          s.UpdateRev,
+				Prio:         s.Prio,
+				Usersessions: s.userSessions(),
+				Liveness:     s.liveness(),
+				Fields:       s.fields,
 			},
 		})
 	}
 	s.mutex.RUnlock()
 }
 
+// userSessions returns the number of sessions of the user of s on all
+// nodes. The session lock must be held.
+func (s *Session) userSessions() int {
+	if s.userid == "" || s.SessionManager == nil {
+		return 0
+	}
+	return s.SessionManager.UserSessions(s.userid)
+}
+
 func (s *Session) Unicast(to string, m interface{}, pipeline *Pipeline) {
 	s.mutex.RLock()
 	outgoing := &DataOutgoing{
@@ -234,13 +457,22 @@ func (s *Session) Close() {
 	// TODO(longsleep): Verify that it is ok to not do all this when replaced is true.
 	if !s.replaced {
 
+		// Sessions of the user left after this one is closed.
+		remaining := s.userSessions() - 1
+		if remaining < 0 {
+			remaining = 0
+		}
+
 		outgoing := &DataOutgoing{
 			From: s.Id,
 			A:    s.attestation.Token(),
 			Data: &DataSession{
-				Type:   "Left",
-				Id:     s.Id,
-				Status: "hard",
+				Type:         "Left",
+				Id:           s.Id,
+				Userid:       s.userid,
+				Status:       "hard",
+				Usersessions: remaining,
+				Liveness:     SessionLivenessGone,
 			},
 		}
 
@@ -318,6 +550,8 @@ func (s *Session) Update(update *SessionUpdate) uint64 {
 			s.Status = update.Status
 		case "Prio":
 			s.Prio = update.Prio
+		case "Fields":
+			s.fields = MergeCustomFields(s.fields, update.Fields)
 		}
 
 	}
@@ -365,6 +599,9 @@ func (s *Session) Authenticate(realm string, st *SessionToken, userid string) er
 		if st.Userid != userid {
 			return NewDataError("invalid_session_token", "user id mismatch")
 		}
+		if !sessionNonceReplays.Use(st.Nonce, time.Now().Add(sessionNonceMaxAge*time.Second)) {
+			return NewDataError("invalid_session_token", "nonce was already used")
+		}
 		s.Nonce = ""
 	}
 
@@ -379,7 +616,7 @@ func (s *Session) Token() *SessionToken {
 	s.mutex.RLock()
 	defer s.mutex.RUnlock()
 
-	return &SessionToken{Id: s.Id, Sid: s.Sid, Userid: s.userid}
+	return &SessionToken{Id: s.Id, Sid: s.Sid, Userid: s.userid, Fp: s.fingerprint}
 }
 
 func (s *Session) Data() *DataSession {
@@ -387,13 +624,15 @@ func (s *Session) Data() *DataSession {
 	defer s.mutex.RUnlock()
 
 	return &DataSession{
-		Id:     s.Id,
-		Userid: s.userid,
-		Ua:     s.Ua,
-		Status: s.Status,
-		Rev:    s.UpdateRev,
-		Prio:   s.Prio,
-		stamp:  s.stamp,
+		Id:       s.Id,
+		Userid:   s.userid,
+		Ua:       s.Ua,
+		Status:   s.Status,
+		Rev:      s.UpdateRev,
+		Prio:     s.Prio,
+		Liveness: s.liveness(),
+		Fields:   s.fields,
+		stamp:    s.stamp,
 	}
 }
 
@@ -432,5 +671,5 @@ func (s *Session) DecodeAttestation(token string) (string, error) {
 func init() {
 	// Create nonce generator.
 	sessionNonces = securecookie.New(securecookie.GenerateRandomKey(64), nil)
-	sessionNonces.MaxAge(60)
+	sessionNonces.MaxAge(sessionNonceMaxAge)
 }
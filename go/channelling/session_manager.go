@@ -41,7 +41,9 @@ type SessionManager interface {
 	DestroySession(sessionID, userID string)
 	Authenticate(*Session, *SessionToken, string) error
 	GetUserSessions(session *Session, id string) []*DataSession
-	DecodeSessionToken(token string) (st *SessionToken)
+	DecodeSessionToken(token, fingerprint string) (st *SessionToken)
+	SetUserPresence(UserPresence)
+	UserSessions(userid string) int
 }
 
 type sessionManager struct {
@@ -57,6 +59,7 @@ type sessionManager struct {
 	sessionByUserIDTable map[string]*Session
 	useridRetriever      func(*http.Request) (string, error)
 	attestations         *securecookie.SecureCookie
+	presence             UserPresence
 }
 
 func NewSessionManager(config *Config, tickets Tickets, unicaster Unicaster, broadcaster Broadcaster, rooms RoomStatusManager, buddyImages ImageCache, sessionSecret []byte) SessionManager {
@@ -73,6 +76,7 @@ func NewSessionManager(config *Config, tickets Tickets, unicaster Unicaster, bro
 		make(map[string]*Session),
 		nil,
 		nil,
+		nil,
 	}
 
 	sessionManager.attestations = securecookie.New(sessionSecret, nil)
@@ -114,11 +118,24 @@ func (sessionManager *sessionManager) GetUser(id string) (*User, bool) {
 	return user, ok
 }
 
+// Users returns all users with sessions.
+func (sessionManager *sessionManager) Users() []*User {
+	sessionManager.RLock()
+	defer sessionManager.RUnlock()
+
+	users := make([]*User, 0, len(sessionManager.userTable))
+	for _, user := range sessionManager.userTable {
+		users = append(users, user)
+	}
+	return users
+}
+
 func (sessionManager *sessionManager) CreateSession(st *SessionToken, userid string) *Session {
 	if st == nil {
-		st = sessionManager.DecodeSessionToken("")
+		st = sessionManager.DecodeSessionToken("", "")
 	}
 	session := NewSession(sessionManager, sessionManager.Unicaster, sessionManager.Broadcaster, sessionManager.RoomStatusManager, sessionManager.buddyImages, sessionManager.attestations, st.Id, st.Sid)
+	session.fingerprint = st.Fp
 
 	if userid != "" {
 		// Errors are ignored here, session is returned without userID when auth failed.
@@ -134,7 +151,8 @@ func (sessionManager *sessionManager) DestroySession(sessionID, userID string) {
 	}
 
 	sessionManager.Lock()
-	if user, ok := sessionManager.userTable[userID]; ok && user.RemoveSession(sessionID) {
+	user, ok := sessionManager.userTable[userID]
+	if ok && user.RemoveSession(sessionID) {
 		delete(sessionManager.userTable, userID)
 	}
 	if _, ok := sessionManager.sessionTable[sessionID]; ok {
@@ -144,6 +162,9 @@ func (sessionManager *sessionManager) DestroySession(sessionID, userID string) {
 		delete(sessionManager.sessionByUserIDTable, sessionID)
 	}
 	sessionManager.Unlock()
+	if ok {
+		sessionManager.updateUserPresence(user)
+	}
 }
 
 func (sessionManager *sessionManager) Authenticate(session *Session, st *SessionToken, userid string) error {
@@ -161,10 +182,37 @@ func (sessionManager *sessionManager) Authenticate(session *Session, st *Session
 	}
 	sessionManager.Unlock()
 	user.AddSession(session)
+	sessionManager.updateUserPresence(user)
 
 	return nil
 }
 
+// SetUserPresence makes UserSessions include the sessions of users on the
+// other nodes of the cluster.
+func (sessionManager *sessionManager) SetUserPresence(presence UserPresence) {
+	sessionManager.presence = presence
+}
+
+// UserSessions returns the number of sessions of userid on all nodes.
+func (sessionManager *sessionManager) UserSessions(userid string) int {
+	count := 0
+	sessionManager.RLock()
+	if user, ok := sessionManager.userTable[userid]; ok {
+		count = user.Data().Sessions
+	}
+	sessionManager.RUnlock()
+	if sessionManager.presence != nil {
+		count += sessionManager.presence.RemoteUserSessions(userid)
+	}
+	return count
+}
+
+func (sessionManager *sessionManager) updateUserPresence(user *User) {
+	if sessionManager.presence != nil {
+		sessionManager.presence.SetLocalUserSessions(user.Id, user.Data().Sessions)
+	}
+}
+
 func (sessionManager *sessionManager) GetUserSessions(session *Session, userid string) (users []*DataSession) {
 	var (
 		user *User
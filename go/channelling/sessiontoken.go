@@ -25,5 +25,7 @@ type SessionToken struct {
 	Id     string // Public session id.
 	Sid    string // Secret session id.
 	Userid string // Public user id.
-	Nonce  string `json:"Nonce,omitempty"` // User autentication nonce.
+	Nonce  string `json:"Nonce,omitempty"`  // User autentication nonce.
+	Issued int64  `json:"Issued,omitempty"` // Unix time in nanoseconds when the token was encoded.
+	Fp     string `json:"Fp,omitempty"`     // Fingerprint of the client the token is bound to.
 }
@@ -26,4 +26,5 @@ type SessionUpdate struct {
 	Ua     string
 	Prio   int
 	Status interface{}
+	Fields map[string]interface{} // Validated custom fields to merge.
 }
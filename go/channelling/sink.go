@@ -28,10 +28,12 @@ import (
 // Sink connects a Pipeline with end points in both directions by
 // getting attached to a Pipeline.
 type Sink interface {
-	// Write sends outgoing data on the sink
-	Write(*DataSinkOutgoing) error
+	// Write sends outgoing data on the sink and returns the number of
+	// bytes it was encoded to.
+	Write(*DataSinkOutgoing) (int, error)
 	Enabled() bool
 	Close()
 	Export() *DataSink
-	BindRecvChan(channel interface{}) (*nats.Subscription, error)
+	// BindRecv passes data received on the sink to pipeline.
+	BindRecv(pipeline *Pipeline) (*nats.Subscription, error)
 }
@@ -0,0 +1,125 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package channelling
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/strukturag/spreed-webrtc/go/envelope"
+)
+
+const snapshotVersion = 1
+
+// A Snapshot contains the server state which survives a restart, so a
+// replacement server can continue where the previous one stopped. Sessions
+// of connected clients are not part of it, clients reconnect with their
+// session tokens.
+type Snapshot struct {
+	Version  int
+	Created  time.Time
+	Rooms    []*RoomSnapshot         `json:",omitempty"`
+	Sessions []*SessionCreateRequest `json:",omitempty"` // Sessions created through the bus.
+}
+
+// RoomSnapshot is the state of a single room.
+type RoomSnapshot struct {
+	Id          string
+	Name        string
+	Type        string
+	Owner       string               `json:",omitempty"`
+	Locked      bool                 `json:",omitempty"`
+	Template    string               `json:",omitempty"`
+	Credentials *DataRoomCredentials `json:",omitempty"`
+	Mute        *DataMute            `json:",omitempty"`
+	Permissions *DataPermissions     `json:",omitempty"`
+	Follow      *DataFollow          `json:",omitempty"`
+	Timer       *DataTimer           `json:",omitempty"`
+	Recording   bool                 `json:",omitempty"`
+	Consents    map[string]bool      `json:",omitempty"`
+	ScreenShare *DataScreenShare     `json:",omitempty"`
+}
+
+// WriteSnapshotFile writes snapshot to path. The file is only readable by
+// the server user, as it contains room PINs. With a keyring, the snapshot
+// is sealed with its current master key.
+func WriteSnapshotFile(path string, snapshot *Snapshot, keyring *envelope.Keyring) error {
+	snapshot.Version = snapshotVersion
+	snapshot.Created = time.Now()
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+	if keyring != nil {
+		sealed, err := keyring.Seal(data)
+		if err != nil {
+			return err
+		}
+		data = []byte(sealed)
+	}
+	// Write to a temporary file first, so a crash never leaves a partial
+	// snapshot behind.
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// ReadSnapshotFile reads a snapshot from path and removes the file, so the
+// same state is never restored twice. Snapshots older than maxAge are
+// ignored and nil is returned, as is when the file does not exist. Sealed
+// snapshots are opened with keyring.
+func ReadSnapshotFile(path string, maxAge time.Duration, keyring *envelope.Keyring) (*Snapshot, error) {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := os.Remove(path); err != nil {
+		return nil, err
+	}
+
+	if envelope.IsSealed(string(data)) {
+		if keyring == nil {
+			return nil, fmt.Errorf("Snapshot is sealed, but no keyring is configured")
+		}
+		if data, err = keyring.Open(string(data)); err != nil {
+			return nil, err
+		}
+	}
+	snapshot := &Snapshot{}
+	if err := json.Unmarshal(data, snapshot); err != nil {
+		return nil, err
+	}
+	if snapshot.Version != snapshotVersion {
+		return nil, fmt.Errorf("Unsupported snapshot version %d", snapshot.Version)
+	}
+	if time.Since(snapshot.Created) > maxAge {
+		return nil, nil
+	}
+	return snapshot, nil
+}
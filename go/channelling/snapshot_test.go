@@ -0,0 +1,94 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package channelling
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_SnapshotFile_IsRestoredOnce(t *testing.T) {
+	dir, err := ioutil.TempDir("", "snapshot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "snapshot.json")
+
+	err = WriteSnapshotFile(path, &Snapshot{Rooms: []*RoomSnapshot{{Id: "Room:foo", Name: "foo", Type: "Room"}}}, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	snapshot, err := ReadSnapshotFile(path, time.Minute, nil)
+	if err != nil || snapshot == nil || len(snapshot.Rooms) != 1 || snapshot.Rooms[0].Id != "Room:foo" {
+		t.Fatalf("Expected snapshot with room, but got %+v, %v", snapshot, err)
+	}
+	if snapshot, err = ReadSnapshotFile(path, time.Minute, nil); snapshot != nil || err != nil {
+		t.Errorf("Expected snapshot to be removed after reading, but got %+v, %v", snapshot, err)
+	}
+}
+
+func Test_SnapshotFile_IgnoresOldSnapshots(t *testing.T) {
+	dir, err := ioutil.TempDir("", "snapshot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "snapshot.json")
+
+	WriteSnapshotFile(path, &Snapshot{}, nil)
+	if snapshot, err := ReadSnapshotFile(path, -time.Second, nil); snapshot != nil || err != nil {
+		t.Errorf("Expected old snapshot to be ignored, but got %+v, %v", snapshot, err)
+	}
+}
+
+func Test_SnapshotFile_IsSealedWithKeyring(t *testing.T) {
+	dir, err := ioutil.TempDir("", "snapshot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "snapshot.json")
+	keyring := newTestKeyring(t, "snapshot")
+
+	room := &RoomSnapshot{Id: "Room:foo", Name: "foo", Type: "Room", Credentials: &DataRoomCredentials{PIN: "1234"}}
+	if err := WriteSnapshotFile(path, &Snapshot{Rooms: []*RoomSnapshot{room}}, keyring); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	data, _ := ioutil.ReadFile(path)
+	if strings.Contains(string(data), "1234") {
+		t.Errorf("Expected PIN to be sealed, but got %s", data)
+	}
+	snapshot, err := ReadSnapshotFile(path, time.Minute, keyring)
+	if err != nil || snapshot == nil || len(snapshot.Rooms) != 1 || snapshot.Rooms[0].Credentials.PIN != "1234" {
+		t.Fatalf("Expected snapshot with room PIN, but got %+v, %v", snapshot, err)
+	}
+
+	WriteSnapshotFile(path, &Snapshot{}, keyring)
+	if snapshot, err := ReadSnapshotFile(path, time.Minute, nil); snapshot != nil || err == nil {
+		t.Errorf("Expected sealed snapshot to fail without keyring, but got %+v, %v", snapshot, err)
+	}
+}
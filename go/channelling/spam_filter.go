@@ -0,0 +1,179 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package channelling
+
+import (
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	SpamActionThrottle = "throttle" // Messages of the session are rejected.
+	SpamActionMute     = "mute"     // Messages of the session are only echoed back to it.
+
+	SpamReasonRate   = "rate"   // Too many messages.
+	SpamReasonRepeat = "repeat" // Too many identical messages.
+	SpamReasonLinks  = "links"  // Too many links in a message.
+)
+
+var spamLinkRegexp = regexp.MustCompile(`(?i)(https?://|www\.)\S+`)
+
+// SpamVerdict is the penalty of a session which sent spam.
+type SpamVerdict struct {
+	Action  string
+	Reason  string
+	Until   time.Time
+	Started bool // The penalty was started by the checked message.
+}
+
+// SpamFilter detects sessions which flood chats with messages, repeat
+// the same message or post many links.
+type SpamFilter interface {
+	Check(sessionID, message string) *SpamVerdict
+}
+
+type spamMessage struct {
+	text string
+	time time.Time
+}
+
+type spamState struct {
+	messages   []*spamMessage // Messages within the window.
+	strikes    int
+	lastStrike time.Time
+	reason     string
+	throttled  time.Time
+	muted      time.Time
+}
+
+type spamFilter struct {
+	sync.Mutex
+	window      time.Duration
+	maxMessages int
+	maxRepeats  int
+	maxLinks    int
+	throttle    time.Duration
+	muteStrikes int
+	mute        time.Duration
+	sessions    map[string]*spamState
+	lastExpire  time.Time
+}
+
+// NewSpamFilter returns a SpamFilter with the thresholds of config, or
+// nil if spam detection is disabled. Thresholds which are not positive
+// are not checked.
+func NewSpamFilter(config *Config) SpamFilter {
+	if !config.SpamFilter {
+		return nil
+	}
+	return &spamFilter{
+		window:      config.SpamWindow,
+		maxMessages: config.SpamMaxMessages,
+		maxRepeats:  config.SpamMaxRepeats,
+		maxLinks:    config.SpamMaxLinks,
+		throttle:    config.SpamThrottle,
+		muteStrikes: config.SpamMuteStrikes,
+		mute:        config.SpamMute,
+		sessions:    make(map[string]*spamState),
+	}
+}
+
+// Check records message of sessionID and returns the penalty of the
+// session, or nil if the message is allowed.
+func (filter *spamFilter) Check(sessionID, message string) *SpamVerdict {
+	return filter.check(sessionID, message, time.Now())
+}
+
+func (filter *spamFilter) check(sessionID, message string, now time.Time) *SpamVerdict {
+	filter.Lock()
+	defer filter.Unlock()
+	filter.expire(now)
+	state, ok := filter.sessions[sessionID]
+	if !ok {
+		state = &spamState{}
+		filter.sessions[sessionID] = state
+	}
+	if now.Before(state.muted) {
+		return &SpamVerdict{Action: SpamActionMute, Reason: state.reason, Until: state.muted}
+	}
+	if now.Before(state.throttled) {
+		return &SpamVerdict{Action: SpamActionThrottle, Reason: state.reason, Until: state.throttled}
+	}
+
+	text := strings.ToLower(strings.TrimSpace(message))
+	messages := state.messages[:0]
+	repeats := 1
+	for _, previous := range state.messages {
+		if now.Sub(previous.time) < filter.window {
+			messages = append(messages, previous)
+			if previous.text == text {
+				repeats++
+			}
+		}
+	}
+	state.messages = append(messages, &spamMessage{text, now})
+
+	var reason string
+	switch {
+	case filter.maxMessages > 0 && len(state.messages) > filter.maxMessages:
+		reason = SpamReasonRate
+	case filter.maxRepeats > 0 && repeats > filter.maxRepeats:
+		reason = SpamReasonRepeat
+	case filter.maxLinks > 0 && len(spamLinkRegexp.FindAllStringIndex(message, filter.maxLinks+1)) > filter.maxLinks:
+		reason = SpamReasonLinks
+	default:
+		return nil
+	}
+
+	// Strikes are forgotten after a mute duration without spam.
+	if now.Sub(state.lastStrike) > filter.mute {
+		state.strikes = 0
+	}
+	state.strikes++
+	state.lastStrike = now
+	state.reason = reason
+	state.messages = nil
+	if filter.muteStrikes > 0 && state.strikes >= filter.muteStrikes {
+		state.muted = now.Add(filter.mute)
+		return &SpamVerdict{Action: SpamActionMute, Reason: reason, Until: state.muted, Started: true}
+	}
+	state.throttled = now.Add(filter.throttle)
+	return &SpamVerdict{Action: SpamActionThrottle, Reason: reason, Until: state.throttled, Started: true}
+}
+
+// expire removes the state of sessions without recent messages and
+// strikes. The state is kept across reconnects, so a penalty cannot be
+// evaded by reconnecting. The lock must be held.
+func (filter *spamFilter) expire(now time.Time) {
+	if now.Sub(filter.lastExpire) < time.Minute {
+		return
+	}
+	filter.lastExpire = now
+	for id, state := range filter.sessions {
+		idle := len(state.messages) == 0 || now.Sub(state.messages[len(state.messages)-1].time) >= filter.window
+		if idle && now.Sub(state.lastStrike) > filter.mute && now.After(state.muted) && now.After(state.throttled) {
+			delete(filter.sessions, id)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package channelling
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestSpamFilter() *spamFilter {
+	return NewSpamFilter(&Config{
+		SpamFilter:      true,
+		SpamWindow:      10 * time.Second,
+		SpamMaxMessages: 5,
+		SpamMaxRepeats:  2,
+		SpamMaxLinks:    2,
+		SpamThrottle:    30 * time.Second,
+		SpamMuteStrikes: 2,
+		SpamMute:        10 * time.Minute,
+	}).(*spamFilter)
+}
+
+func Test_SpamFilter_Disabled(t *testing.T) {
+	if filter := NewSpamFilter(&Config{}); filter != nil {
+		t.Error("Expected no spam filter when disabled")
+	}
+}
+
+func Test_SpamFilter_ThrottlesFloods(t *testing.T) {
+	filter := newTestSpamFilter()
+	now := time.Now()
+	for i := 0; i < 5; i++ {
+		if verdict := filter.check("a", strings.Repeat("a", i+1), now); verdict != nil {
+			t.Fatalf("Expected message %d to be allowed, but got %+v", i, verdict)
+		}
+	}
+	verdict := filter.check("a", "f", now)
+	if verdict == nil || verdict.Action != SpamActionThrottle || verdict.Reason != SpamReasonRate || !verdict.Started {
+		t.Fatalf("Expected flood to be throttled, but got %+v", verdict)
+	}
+	if verdict := filter.check("a", "g", now.Add(time.Second)); verdict == nil || verdict.Started {
+		t.Errorf("Expected ongoing throttle, but got %+v", verdict)
+	}
+	if verdict := filter.check("b", "a", now); verdict != nil {
+		t.Errorf("Expected other sessions to be allowed, but got %+v", verdict)
+	}
+	if verdict := filter.check("a", "h", now.Add(31*time.Second)); verdict != nil {
+		t.Errorf("Expected message after throttle to be allowed, but got %+v", verdict)
+	}
+}
+
+func Test_SpamFilter_DetectsRepeatsAndLinks(t *testing.T) {
+	filter := newTestSpamFilter()
+	now := time.Now()
+	filter.check("a", "Buy now", now)
+	filter.check("a", "buy now ", now)
+	if verdict := filter.check("a", "BUY NOW", now); verdict == nil || verdict.Reason != SpamReasonRepeat {
+		t.Errorf("Expected repeated message to be detected, but got %+v", verdict)
+	}
+
+	if verdict := filter.check("b", "see http://a.example and www.b.example", now); verdict != nil {
+		t.Errorf("Expected two links to be allowed, but got %+v", verdict)
+	}
+	if verdict := filter.check("b", "http://a.example https://b.example www.c.example", now); verdict == nil || verdict.Reason != SpamReasonLinks {
+		t.Errorf("Expected link spam to be detected, but got %+v", verdict)
+	}
+}
+
+func Test_SpamFilter_MutesRepeatedSpam(t *testing.T) {
+	filter := newTestSpamFilter()
+	now := time.Now()
+	links := "http://a.example http://b.example http://c.example"
+	if verdict := filter.check("a", links, now); verdict == nil || verdict.Action != SpamActionThrottle {
+		t.Fatalf("Expected first strike to throttle, but got %+v", verdict)
+	}
+	now = now.Add(time.Minute)
+	verdict := filter.check("a", links, now)
+	if verdict == nil || verdict.Action != SpamActionMute || !verdict.Started {
+		t.Fatalf("Expected second strike to mute, but got %+v", verdict)
+	}
+	if verdict := filter.check("a", "hello", now.Add(5*time.Minute)); verdict == nil || verdict.Action != SpamActionMute {
+		t.Errorf("Expected session to stay muted, but got %+v", verdict)
+	}
+	if verdict := filter.check("a", "hello", now.Add(11*time.Minute)); verdict != nil {
+		t.Errorf("Expected mute to end, but got %+v", verdict)
+	}
+}
@@ -22,21 +22,48 @@
 package channelling
 
 import (
+	"sync"
 	"sync/atomic"
+	"time"
 )
 
+// recentErrorsSize is the number of errors kept for RecentErrors.
+const recentErrorsSize = 200
+
 type HubStat struct {
-	Rooms                 int                     `json:"rooms"`
-	Connections           int                     `json:"connections"`
-	Sessions              int                     `json:"sessions"`
-	Users                 int                     `json:"users"`
-	Count                 uint64                  `json:"count"`
-	BroadcastChatMessages uint64                  `json:"broadcastchatmessages"`
-	UnicastChatMessages   uint64                  `json:"unicastchatmessages"`
-	IdsInRoom             map[string][]string     `json:"idsinroom,omitempty"`
-	SessionsById          map[string]*DataSession `json:"sessionsbyid,omitempty"`
-	UsersById             map[string]*DataUser    `json:"usersbyid,omitempty"`
-	ConnectionsByIdx      map[string]string       `json:"connectionsbyidx,omitempty"`
+	Rooms                 int                      `json:"rooms"`
+	Connections           int                      `json:"connections"`
+	Sessions              int                      `json:"sessions"`
+	Users                 int                      `json:"users"`
+	Count                 uint64                   `json:"count"`
+	BroadcastChatMessages uint64                   `json:"broadcastchatmessages"`
+	UnicastChatMessages   uint64                   `json:"unicastchatmessages"`
+	Messages              map[string]*MessageStat  `json:"messages,omitempty"`
+	Pipelines             int                      `json:"pipelines"`
+	PipelinesCleanup      *PipelineCleanupStat     `json:"pipelinescleanup,omitempty"`
+	Auth                  *AuthStat                `json:"auth,omitempty"`
+	IdsInRoom             map[string][]string      `json:"idsinroom,omitempty"`
+	SessionsById          map[string]*DataSession  `json:"sessionsbyid,omitempty"`
+	UsersById             map[string]*DataUser     `json:"usersbyid,omitempty"`
+	ConnectionsByIdx      map[string]string        `json:"connectionsbyidx,omitempty"`
+	PipelinesById         map[string]*PipelineStat `json:"pipelinesbyid,omitempty"`
+	Load                  *LoadStatus              `json:"load,omitempty"`
+	Panics                map[string]uint64        `json:"panics,omitempty"`
+}
+
+// MessageStat counts the incoming channelling messages of one type.
+type MessageStat struct {
+	Count  uint64 `json:"count"`
+	Errors uint64 `json:"errors"`
+}
+
+// RecentError is a failed incoming channelling message.
+type RecentError struct {
+	Time    time.Time `json:"time"`
+	Type    string    `json:"type"`
+	Code    string    `json:"code,omitempty"`
+	Message string    `json:"message"`
+	Session string    `json:"session,omitempty"`
 }
 
 type ConnectionCounter interface {
@@ -46,29 +73,78 @@ type ConnectionCounter interface {
 type StatsCounter interface {
 	CountBroadcastChat()
 	CountUnicastChat()
+	CountMessage(msgType string, failed bool)
+	RecordError(msgType, sessionID string, err error)
 }
 
 type StatsGenerator interface {
 	Stat(details bool) *HubStat
 }
 
+// ErrorLog provides the most recent errors, newest first.
+type ErrorLog interface {
+	RecentErrors() []*RecentError
+}
+
 type StatsManager interface {
 	ConnectionCounter
 	StatsCounter
 	StatsGenerator
+	ErrorLog
+	SetLoadShedder(LoadShedder)
+	SetPanicRecovery(PanicRecovery)
 }
 
 type statsManager struct {
 	ClientStats
 	RoomStats
 	UserStats
+	PipelineStats
+	AuthStats
+	loadShedder           LoadShedder
+	panicRecovery         PanicRecovery
 	connectionCount       uint64
 	broadcastChatMessages uint64
 	unicastChatMessages   uint64
+	messages              map[string]*MessageStat
+	messagesMutex         sync.Mutex
+	recentErrors          []*RecentError
+	recentErrorsNext      int
+}
+
+func NewStatsManager(clientStats ClientStats, roomStats RoomStats, userStats UserStats, pipelineStats PipelineStats, authStats AuthStats) StatsManager {
+	return &statsManager{
+		ClientStats:   clientStats,
+		RoomStats:     roomStats,
+		UserStats:     userStats,
+		PipelineStats: pipelineStats,
+		AuthStats:     authStats,
+		messages:      make(map[string]*MessageStat),
+	}
+}
+
+// SetLoadShedder includes the load level of shedder in the stats.
+func (stats *statsManager) SetLoadShedder(shedder LoadShedder) {
+	stats.loadShedder = shedder
+}
+
+// SetPanicRecovery includes the recovered panics in the stats.
+func (stats *statsManager) SetPanicRecovery(recovery PanicRecovery) {
+	stats.panicRecovery = recovery
+}
+
+func (stats *statsManager) panicInfo() map[string]uint64 {
+	if stats.panicRecovery == nil {
+		return nil
+	}
+	return stats.panicRecovery.Panics()
 }
 
-func NewStatsManager(clientStats ClientStats, roomStats RoomStats, userStats UserStats) StatsManager {
-	return &statsManager{clientStats, roomStats, userStats, 0, 0, 0}
+func (stats *statsManager) loadInfo() *LoadStatus {
+	if stats.loadShedder == nil {
+		return nil
+	}
+	return stats.loadShedder.LoadStatus()
 }
 
 func (stats *statsManager) CountConnection() uint64 {
@@ -83,22 +159,92 @@ func (stats *statsManager) CountUnicastChat() {
 	atomic.AddUint64(&stats.unicastChatMessages, 1)
 }
 
+// CountMessage counts an incoming message of msgType, and whether handling
+// it failed. Only call this for known message types.
+func (stats *statsManager) CountMessage(msgType string, failed bool) {
+	stats.messagesMutex.Lock()
+	defer stats.messagesMutex.Unlock()
+	stat, ok := stats.messages[msgType]
+	if !ok {
+		stat = &MessageStat{}
+		stats.messages[msgType] = stat
+	}
+	stat.Count++
+	if failed {
+		stat.Errors++
+	}
+}
+
+// RecordError keeps err of an incoming message of msgType from sessionID
+// for RecentErrors. Only the most recent errors are kept.
+func (stats *statsManager) RecordError(msgType, sessionID string, err error) {
+	recent := &RecentError{
+		Time:    time.Now(),
+		Type:    msgType,
+		Message: err.Error(),
+		Session: sessionID,
+	}
+	switch e := err.(type) {
+	case *DataError:
+		recent.Code, recent.Message = e.Code, e.Message
+	case *ValidationError:
+		recent.Code, recent.Message = e.Code, e.Message
+	}
+
+	stats.messagesMutex.Lock()
+	defer stats.messagesMutex.Unlock()
+	if len(stats.recentErrors) < recentErrorsSize {
+		stats.recentErrors = append(stats.recentErrors, recent)
+	} else {
+		stats.recentErrors[stats.recentErrorsNext] = recent
+	}
+	stats.recentErrorsNext = (stats.recentErrorsNext + 1) % recentErrorsSize
+}
+
+func (stats *statsManager) RecentErrors() []*RecentError {
+	stats.messagesMutex.Lock()
+	defer stats.messagesMutex.Unlock()
+	recentErrors := make([]*RecentError, 0, len(stats.recentErrors))
+	for i := 1; i <= len(stats.recentErrors); i++ {
+		recentErrors = append(recentErrors, stats.recentErrors[(stats.recentErrorsNext-i+recentErrorsSize)%recentErrorsSize])
+	}
+	return recentErrors
+}
+
+func (stats *statsManager) messageInfo() map[string]*MessageStat {
+	stats.messagesMutex.Lock()
+	defer stats.messagesMutex.Unlock()
+	messages := make(map[string]*MessageStat, len(stats.messages))
+	for msgType, stat := range stats.messages {
+		messages[msgType] = &MessageStat{stat.Count, stat.Errors}
+	}
+	return messages
+}
+
 func (stats *statsManager) Stat(details bool) *HubStat {
 	roomCount, roomSessionInfo := stats.RoomInfo(details)
 	clientCount, sessions, connections := stats.ClientInfo(details)
 	userCount, users := stats.UserInfo(details)
+	pipelineCount, pipelinesCleanup, pipelines := stats.PipelineInfo(details)
 
 	return &HubStat{
-		Rooms:       roomCount,
-		Connections: clientCount,
-		Sessions:    clientCount,
-		Users:       userCount,
-		Count:       atomic.LoadUint64(&stats.connectionCount),
+		Rooms:                 roomCount,
+		Connections:           clientCount,
+		Sessions:              clientCount,
+		Users:                 userCount,
+		Count:                 atomic.LoadUint64(&stats.connectionCount),
 		BroadcastChatMessages: atomic.LoadUint64(&stats.broadcastChatMessages),
 		UnicastChatMessages:   atomic.LoadUint64(&stats.unicastChatMessages),
+		Messages:              stats.messageInfo(),
+		Pipelines:             pipelineCount,
+		PipelinesCleanup:      pipelinesCleanup,
+		Auth:                  stats.AuthInfo(),
 		IdsInRoom:             roomSessionInfo,
 		SessionsById:          sessions,
 		UsersById:             users,
 		ConnectionsByIdx:      connections,
+		PipelinesById:         pipelines,
+		Load:                  stats.loadInfo(),
+		Panics:                stats.panicInfo(),
 	}
 }
@@ -0,0 +1,59 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package channelling
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func Test_StatsManager_KeepsRecentErrorsNewestFirst(t *testing.T) {
+	stats := &statsManager{messages: make(map[string]*MessageStat)}
+	if recent := stats.RecentErrors(); len(recent) != 0 {
+		t.Fatalf("Expected no errors, but got %v", recent)
+	}
+
+	stats.RecordError("Chat", "a", NewDataError("chat_throttled", "Too many chat messages"))
+	stats.RecordError("Hello", "b", errors.New("failed"))
+	recent := stats.RecentErrors()
+	if len(recent) != 2 {
+		t.Fatalf("Expected 2 errors, but got %d", len(recent))
+	}
+	if recent[0].Type != "Hello" || recent[0].Code != "" || recent[0].Message != "failed" || recent[0].Session != "b" {
+		t.Errorf("Unexpected newest error %+v", recent[0])
+	}
+	if recent[1].Type != "Chat" || recent[1].Code != "chat_throttled" || recent[1].Message != "Too many chat messages" {
+		t.Errorf("Unexpected oldest error %+v", recent[1])
+	}
+
+	for i := 0; i < recentErrorsSize+5; i++ {
+		stats.RecordError("Chat", fmt.Sprintf("%d", i), errors.New("failed"))
+	}
+	recent = stats.RecentErrors()
+	if len(recent) != recentErrorsSize {
+		t.Fatalf("Expected %d errors, but got %d", recentErrorsSize, len(recent))
+	}
+	if newest, oldest := recent[0].Session, recent[len(recent)-1].Session; newest != fmt.Sprintf("%d", recentErrorsSize+4) || oldest != "5" {
+		t.Errorf("Expected errors 5 to %d, but got %s to %s", recentErrorsSize+4, oldest, newest)
+	}
+}
@@ -0,0 +1,240 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package channelling
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/strukturag/spreed-webrtc/go/randomstring"
+)
+
+const (
+	StepUpActionEndRoom   = "endroom"
+	StepUpActionRecording = "recording"
+)
+
+const (
+	stepUpChallengeDuration = 2 * time.Minute
+	totpPeriod              = 30
+	totpDigits              = 6
+)
+
+// StepUpVerifier checks second factor codes of users.
+type StepUpVerifier interface {
+	StepUpMethod() string
+	VerifyStepUp(userid, code string) bool
+}
+
+type StepUpManager interface {
+	StepUpChallenge(session *Session) (*DataStepUp, error)
+	StepUpConfirm(session *Session, challenge, code string) (*DataStepUp, error)
+	RequireStepUp(session *Session, action string) error
+}
+
+type stepUpManager struct {
+	StepUpVerifier
+	authLimiter AuthLimiter
+	actions     map[string]bool
+	window      time.Duration
+}
+
+// NewStepUpManager returns a StepUpManager which requires a confirmation
+// through verifier for the configured actions. Without verifier, step-up
+// is disabled and all actions are allowed. Wrong codes are counted by user
+// with authLimiter, so users get locked out after too many of them.
+func NewStepUpManager(config *Config, verifier StepUpVerifier, authLimiter AuthLimiter) StepUpManager {
+	return &stepUpManager{
+		StepUpVerifier: verifier,
+		authLimiter:    authLimiter,
+		actions:        config.StepUpActions,
+		window:         config.StepUpWindow,
+	}
+}
+
+func (stepUp *stepUpManager) StepUpChallenge(session *Session) (*DataStepUp, error) {
+	if stepUp.StepUpVerifier == nil {
+		return nil, NewDataError("stepup_disabled", "Step-up authentication is not enabled")
+	}
+	userid := session.Userid()
+	if userid == "" {
+		return nil, NewDataError("stepup_requires_account", "Step-up authentication requires a user account")
+	}
+	if stepUp.authLimiter != nil {
+		if err := stepUp.authLimiter.UserAuthAllowed(userid); err != nil {
+			return nil, err
+		}
+	}
+
+	challenge := randomstring.NewRandomString(32)
+	session.mutex.Lock()
+	session.stepUpChallenge = challenge
+	session.stepUpChallengeExpires = time.Now().Add(stepUpChallengeDuration)
+	session.mutex.Unlock()
+
+	return &DataStepUp{
+		Type:      "StepUp",
+		Challenge: challenge,
+		Method:    stepUp.StepUpMethod(),
+	}, nil
+}
+
+func (stepUp *stepUpManager) StepUpConfirm(session *Session, challenge, code string) (*DataStepUp, error) {
+	if stepUp.StepUpVerifier == nil {
+		return nil, NewDataError("stepup_disabled", "Step-up authentication is not enabled")
+	}
+
+	userid := session.Userid()
+	now := time.Now()
+	session.mutex.Lock()
+	expected := session.stepUpChallenge
+	expired := now.After(session.stepUpChallengeExpires)
+	// Challenges can only be used once.
+	session.stepUpChallenge = ""
+	session.mutex.Unlock()
+
+	if userid == "" {
+		return nil, NewDataError("stepup_requires_account", "Step-up authentication requires a user account")
+	}
+	if expected == "" || expired || subtle.ConstantTimeCompare([]byte(expected), []byte(challenge)) != 1 {
+		return nil, NewDataError("stepup_invalid_challenge", "Unknown or expired step-up challenge")
+	}
+	if stepUp.authLimiter != nil {
+		// New challenges can be requested after every failure, so the
+		// guesses need to be limited by user.
+		if err := stepUp.authLimiter.UserAuthAllowed(userid); err != nil {
+			return nil, err
+		}
+	}
+	if !stepUp.VerifyStepUp(userid, code) {
+		log.Println("Step-up authentication failed", userid)
+		if stepUp.authLimiter != nil {
+			stepUp.authLimiter.UserAuthFailed(userid, "stepup_failed")
+		}
+		return nil, NewDataError("stepup_failed", "Step-up code is incorrect")
+	}
+	if stepUp.authLimiter != nil {
+		stepUp.authLimiter.UserAuthSucceeded(userid)
+	}
+
+	session.mutex.Lock()
+	session.stepUpConfirmed = now
+	session.mutex.Unlock()
+	log.Println("Step-up authentication success", userid)
+
+	return &DataStepUp{
+		Type:      "StepUp",
+		Confirmed: true,
+		Expires:   now.Add(stepUp.window).Unix(),
+	}, nil
+}
+
+// RequireStepUp returns an error unless action does not need step-up or
+// the session has confirmed its second factor recently.
+func (stepUp *stepUpManager) RequireStepUp(session *Session, action string) error {
+	if stepUp.StepUpVerifier == nil || !stepUp.actions[action] {
+		return nil
+	}
+
+	session.mutex.RLock()
+	confirmed := session.stepUpConfirmed
+	session.mutex.RUnlock()
+	if confirmed.IsZero() || time.Since(confirmed) > stepUp.window {
+		return NewDataError("stepup_required", fmt.Sprintf("Action %s requires step-up authentication", action))
+	}
+
+	return nil
+}
+
+type totpVerifier struct {
+	mutex   sync.Mutex
+	secrets map[string][]byte
+	used    map[string]int64
+}
+
+// NewTOTPVerifier creates a StepUpVerifier for time based one-time
+// passwords (RFC 6238) from base32 encoded secrets by userid.
+func NewTOTPVerifier(secrets map[string]string) StepUpVerifier {
+	verifier := &totpVerifier{
+		secrets: make(map[string][]byte),
+		used:    make(map[string]int64),
+	}
+	for userid, secret := range secrets {
+		secret = strings.ToUpper(strings.Replace(secret, " ", "", -1))
+		if missing := len(secret) % 8; missing != 0 {
+			secret += strings.Repeat("=", 8-missing)
+		}
+		key, err := base32.StdEncoding.DecodeString(secret)
+		if err != nil {
+			log.Printf("Ignoring invalid step-up secret for %s: %s\n", userid, err)
+			continue
+		}
+		verifier.secrets[userid] = key
+	}
+	return verifier
+}
+
+func (verifier *totpVerifier) StepUpMethod() string {
+	return "totp"
+}
+
+func (verifier *totpVerifier) VerifyStepUp(userid, code string) bool {
+	key, ok := verifier.secrets[userid]
+	if !ok || len(code) != totpDigits {
+		return false
+	}
+
+	counter := time.Now().Unix() / totpPeriod
+	verifier.mutex.Lock()
+	defer verifier.mutex.Unlock()
+	// Allow one period of clock skew in both directions.
+	for _, c := range []int64{counter - 1, counter, counter + 1} {
+		if c <= verifier.used[userid] {
+			// Do not accept codes again which were already used.
+			continue
+		}
+		if subtle.ConstantTimeCompare([]byte(totpCode(key, c)), []byte(code)) == 1 {
+			verifier.used[userid] = c
+			return true
+		}
+	}
+	return false
+}
+
+func totpCode(key []byte, counter int64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(counter))
+	m := hmac.New(sha1.New, key)
+	m.Write(msg[:])
+	sum := m.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%06d", value%1000000)
+}
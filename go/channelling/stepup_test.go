@@ -0,0 +1,92 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package channelling
+
+import (
+	"testing"
+	"time"
+)
+
+func Test_TOTPCode(t *testing.T) {
+	// Test vectors from RFC 6238 truncated to 6 digits.
+	key := []byte("12345678901234567890")
+	for counter, expected := range map[int64]string{
+		59 / 30:         "287082",
+		1111111109 / 30: "081804",
+		1234567890 / 30: "005924",
+	} {
+		if code := totpCode(key, counter); code != expected {
+			t.Errorf("Expected code %s for counter %d, but got %s", expected, counter, code)
+		}
+	}
+}
+
+func Test_StepUpManager_RequireStepUp(t *testing.T) {
+	config := &Config{StepUpActions: map[string]bool{StepUpActionEndRoom: true}}
+	session := &Session{userid: "user"}
+
+	disabled := NewStepUpManager(config, nil, nil)
+	if err := disabled.RequireStepUp(session, StepUpActionEndRoom); err != nil {
+		t.Errorf("Unexpected error %v with step-up disabled", err)
+	}
+
+	stepUp := NewStepUpManager(config, NewTOTPVerifier(map[string]string{"user": "JBSWY3DPEHPK3PXP"}), nil)
+	if err := stepUp.RequireStepUp(session, StepUpActionRecording); err != nil {
+		t.Errorf("Unexpected error %v for action without step-up", err)
+	}
+	assertDataError(t, stepUp.RequireStepUp(session, StepUpActionEndRoom), "stepup_required")
+
+	challenge, err := stepUp.StepUpChallenge(session)
+	if err != nil {
+		t.Fatalf("Unexpected error %v creating challenge", err)
+	}
+	_, err = stepUp.StepUpConfirm(session, challenge.Challenge, "000000x")
+	assertDataError(t, err, "stepup_failed")
+	_, err = stepUp.StepUpConfirm(session, challenge.Challenge, "000000")
+	assertDataError(t, err, "stepup_invalid_challenge")
+}
+
+func Test_StepUpManager_LocksOutWrongCodes(t *testing.T) {
+	config := &Config{
+		StepUpActions:       map[string]bool{StepUpActionEndRoom: true},
+		AuthLimitThreshold:  3,
+		AuthLimitLockout:    time.Minute,
+		AuthLimitMaxLockout: time.Hour,
+	}
+	session := &Session{userid: "user"}
+	stepUp := NewStepUpManager(config, NewTOTPVerifier(map[string]string{"user": "JBSWY3DPEHPK3PXP"}), NewAuthLimiter(config, nil))
+
+	for i := 0; i < 3; i++ {
+		challenge, err := stepUp.StepUpChallenge(session)
+		if err != nil {
+			t.Fatalf("Unexpected error %v creating challenge %d", err, i)
+		}
+		_, err = stepUp.StepUpConfirm(session, challenge.Challenge, "000000x")
+		assertDataError(t, err, "stepup_failed")
+	}
+
+	_, err := stepUp.StepUpChallenge(session)
+	assertDataError(t, err, "auth_locked")
+	if _, err := stepUp.StepUpChallenge(&Session{userid: "other"}); err != nil {
+		t.Errorf("Unexpected error %v for another user", err)
+	}
+}
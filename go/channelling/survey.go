@@ -0,0 +1,274 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package channelling
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/strukturag/spreed-webrtc/go/randomstring"
+)
+
+const (
+	// BusManagerSurvey is triggered with a SurveyResult for each response.
+	BusManagerSurvey = "survey"
+
+	// SurveyQuestionRating questions are answered with 1 to 5.
+	SurveyQuestionRating = "rating"
+	// SurveyQuestionText questions are answered with free text.
+	SurveyQuestionText = "text"
+
+	maxSurveyRating     = 5
+	maxSurveyTextAnswer = 1024
+	// Both parties of a call may send a Bye, only the first one starts a
+	// survey.
+	surveyByeWindow = 10 * time.Second
+)
+
+// SurveyQuestion is a question of the survey after calls.
+type SurveyQuestion struct {
+	Id   string
+	Type string
+	Text string
+}
+
+// ParseSurveyQuestion parses a question definition of the form
+// "<type> <text>" for the question id.
+func ParseSurveyQuestion(id, definition string) (*SurveyQuestion, error) {
+	fields := strings.SplitN(strings.TrimSpace(definition), " ", 2)
+	if len(fields) != 2 || strings.TrimSpace(fields[1]) == "" {
+		return nil, fmt.Errorf("Survey question %s needs a type and a text", id)
+	}
+	if fields[0] != SurveyQuestionRating && fields[0] != SurveyQuestionText {
+		return nil, fmt.Errorf("Unsupported type '%s' of survey question %s", fields[0], id)
+	}
+	return &SurveyQuestion{Id: id, Type: fields[0], Text: strings.TrimSpace(fields[1])}, nil
+}
+
+// SurveyResult is triggered on the bus for each response, so that call
+// detail records can attach it by the Call id.
+type SurveyResult struct {
+	Id      string // Id of the survey.
+	Call    string `json:",omitempty"` // Id of the pipeline of the call, if any.
+	Roomid  string
+	From    string // Session id of the respondent.
+	Userid  string `json:",omitempty"`
+	Peer    string // Session id of the other party of the call.
+	Answers map[string]string
+}
+
+// SurveyQuestionStat aggregates the answers to a question.
+type SurveyQuestionStat struct {
+	Id      string         `json:"id"`
+	Type    string         `json:"type"`
+	Answers int            `json:"answers"`
+	Average float64        `json:"average,omitempty"` // Average rating.
+	Ratings map[string]int `json:"ratings,omitempty"` // Map of rating -> number of answers.
+}
+
+// SurveyStats aggregates all responses since startup.
+type SurveyStats struct {
+	Sent      int                   `json:"sent"`
+	Responses int                   `json:"responses"`
+	Questions []*SurveyQuestionStat `json:"questions"`
+}
+
+// Surveys asks the participants of calls for feedback after the call ended.
+type Surveys interface {
+	Start(session *Session, peer, call string) *DataSurvey
+	Respond(session *Session, response *DataSurveyResponse) (*SurveyResult, error)
+	Stats() *SurveyStats
+}
+
+type pendingSurvey struct {
+	survey    *DataSurvey
+	call      string
+	roomid    string
+	sessions  map[string]string // Map of respondent session id -> peer session id.
+	expires   time.Time
+	responded map[string]bool
+}
+
+type surveys struct {
+	sync.Mutex
+	questions []*SurveyQuestion
+	timeout   time.Duration
+	pending   map[string]*pendingSurvey // Map of survey id -> survey.
+	pairs     map[string]time.Time      // Map of session pair -> start of its latest survey.
+	sent      int
+	responses int
+	stats     map[string]*SurveyQuestionStat
+	ratings   map[string]int // Map of question id -> sum of ratings.
+}
+
+// NewSurveys creates Surveys with questions, which accept responses until
+// timeout after the call ended.
+func NewSurveys(questions []*SurveyQuestion, timeout time.Duration) Surveys {
+	s := &surveys{
+		questions: questions,
+		timeout:   timeout,
+		pending:   make(map[string]*pendingSurvey),
+		pairs:     make(map[string]time.Time),
+		stats:     make(map[string]*SurveyQuestionStat),
+		ratings:   make(map[string]int),
+	}
+	for _, question := range questions {
+		s.stats[question.Id] = &SurveyQuestionStat{Id: question.Id, Type: question.Type}
+	}
+	return s
+}
+
+// Start creates the survey for the call of session with peer, or returns
+// nil if the peer just started a survey for the call.
+func (s *surveys) Start(session *Session, peer, call string) *DataSurvey {
+	pair := surveyPair(session.Id, peer)
+	now := time.Now()
+
+	s.Lock()
+	defer s.Unlock()
+	s.expire(now)
+	if started, ok := s.pairs[pair]; ok && now.Sub(started) < surveyByeWindow {
+		return nil
+	}
+	survey := &DataSurvey{
+		Type:      "Survey",
+		Id:        randomstring.NewRandomString(16),
+		Questions: s.questions,
+	}
+	s.pending[survey.Id] = &pendingSurvey{
+		survey:    survey,
+		call:      call,
+		roomid:    session.Roomid,
+		sessions:  map[string]string{session.Id: peer, peer: session.Id},
+		expires:   now.Add(s.timeout),
+		responded: make(map[string]bool),
+	}
+	s.pairs[pair] = now
+	s.sent += 2
+	return survey
+}
+
+func (s *surveys) Respond(session *Session, response *DataSurveyResponse) (*SurveyResult, error) {
+	s.Lock()
+	defer s.Unlock()
+	s.expire(time.Now())
+	pending, ok := s.pending[response.Id]
+	if !ok {
+		return nil, NewDataError("survey_unknown", "The survey is closed")
+	}
+	peer, ok := pending.sessions[session.Id]
+	if !ok {
+		return nil, NewDataError("survey_unknown", "The survey is closed")
+	}
+	if pending.responded[session.Id] {
+		return nil, NewDataError("survey_answered", "The survey was answered already")
+	}
+
+	answers := make(map[string]string)
+	for _, question := range s.questions {
+		answer, ok := response.Answers[question.Id]
+		if !ok || answer == "" {
+			continue
+		}
+		switch question.Type {
+		case SurveyQuestionRating:
+			if rating, err := strconv.Atoi(answer); err != nil || rating < 1 || rating > maxSurveyRating {
+				return nil, NewDataError("survey_invalid", fmt.Sprintf("Answer to %s must be a rating from 1 to %d", question.Id, maxSurveyRating))
+			}
+		case SurveyQuestionText:
+			if len(answer) > maxSurveyTextAnswer {
+				return nil, NewDataError("survey_invalid", fmt.Sprintf("Answer to %s is too long", question.Id))
+			}
+		}
+		answers[question.Id] = answer
+	}
+
+	pending.responded[session.Id] = true
+	s.responses++
+	for id, answer := range answers {
+		stat := s.stats[id]
+		stat.Answers++
+		if stat.Type == SurveyQuestionRating {
+			rating, _ := strconv.Atoi(answer)
+			if stat.Ratings == nil {
+				stat.Ratings = make(map[string]int)
+			}
+			stat.Ratings[answer]++
+			s.ratings[id] += rating
+			stat.Average = float64(s.ratings[id]) / float64(stat.Answers)
+		}
+	}
+	log.Printf("Survey %s answered by session %s\n", response.Id, session.Id)
+
+	return &SurveyResult{
+		Id:      response.Id,
+		Call:    pending.call,
+		Roomid:  pending.roomid,
+		From:    session.Id,
+		Userid:  session.Userid(),
+		Peer:    peer,
+		Answers: answers,
+	}, nil
+}
+
+func (s *surveys) Stats() *SurveyStats {
+	s.Lock()
+	defer s.Unlock()
+	stats := &SurveyStats{Sent: s.sent, Responses: s.responses}
+	for _, question := range s.questions {
+		stat := *s.stats[question.Id]
+		if stat.Ratings != nil {
+			stat.Ratings = make(map[string]int)
+			for rating, count := range s.stats[question.Id].Ratings {
+				stat.Ratings[rating] = count
+			}
+		}
+		stats.Questions = append(stats.Questions, &stat)
+	}
+	return stats
+}
+
+// expire removes the surveys which no longer accept responses. Call with
+// the lock held.
+func (s *surveys) expire(now time.Time) {
+	for id, pending := range s.pending {
+		if now.After(pending.expires) {
+			delete(s.pending, id)
+		}
+	}
+	for pair, started := range s.pairs {
+		if now.Sub(started) >= surveyByeWindow {
+			delete(s.pairs, pair)
+		}
+	}
+}
+
+func surveyPair(a, b string) string {
+	pair := []string{a, b}
+	sort.Strings(pair)
+	return strings.Join(pair, "|")
+}
@@ -0,0 +1,97 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package channelling
+
+import (
+	"testing"
+	"time"
+)
+
+func newTestSurveys() Surveys {
+	return NewSurveys([]*SurveyQuestion{
+		{Id: "quality", Type: SurveyQuestionRating, Text: "How was the call quality?"},
+		{Id: "comment", Type: SurveyQuestionText, Text: "Anything else?"},
+	}, time.Minute)
+}
+
+func Test_ParseSurveyQuestion(t *testing.T) {
+	question, err := ParseSurveyQuestion("quality", "rating  How was the call quality? ")
+	if err != nil || question.Type != SurveyQuestionRating || question.Text != "How was the call quality?" {
+		t.Errorf("Unexpected question %+v, %v", question, err)
+	}
+	for _, definition := range []string{"", "rating", "choice Which one?"} {
+		if _, err := ParseSurveyQuestion("q", definition); err == nil {
+			t.Errorf("Expected definition %q to be rejected", definition)
+		}
+	}
+}
+
+func Test_Surveys_StartsOneSurveyPerCall(t *testing.T) {
+	surveys := newTestSurveys()
+	a, b := &Session{Id: "a", Roomid: "room"}, &Session{Id: "b", Roomid: "room"}
+	survey := surveys.Start(a, "b", "pipe")
+	if survey == nil || survey.Id == "" || len(survey.Questions) != 2 {
+		t.Fatalf("Unexpected survey %+v", survey)
+	}
+	if again := surveys.Start(b, "a", "pipe"); again != nil {
+		t.Errorf("Expected the Bye of the peer to start no survey, got %+v", again)
+	}
+	if stats := surveys.Stats(); stats.Sent != 2 {
+		t.Errorf("Expected the survey to be sent to both parties, got %d", stats.Sent)
+	}
+}
+
+func Test_Surveys_CollectsResponses(t *testing.T) {
+	surveys := newTestSurveys()
+	a, b, c := &Session{Id: "a", Roomid: "room"}, &Session{Id: "b", Roomid: "room"}, &Session{Id: "c", Roomid: "room"}
+	survey := surveys.Start(a, "b", "pipe")
+
+	_, err := surveys.Respond(a, &DataSurveyResponse{Id: survey.Id, Answers: map[string]string{"quality": "6"}})
+	assertDataError(t, err, "survey_invalid")
+	_, err = surveys.Respond(c, &DataSurveyResponse{Id: survey.Id, Answers: map[string]string{"quality": "5"}})
+	assertDataError(t, err, "survey_unknown")
+
+	result, err := surveys.Respond(a, &DataSurveyResponse{Id: survey.Id, Answers: map[string]string{"quality": "5", "comment": "Fine", "unknown": "x"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Call != "pipe" || result.Peer != "b" || len(result.Answers) != 2 {
+		t.Errorf("Unexpected result %+v", result)
+	}
+	_, err = surveys.Respond(a, &DataSurveyResponse{Id: survey.Id, Answers: map[string]string{"quality": "1"}})
+	assertDataError(t, err, "survey_answered")
+	if _, err := surveys.Respond(b, &DataSurveyResponse{Id: survey.Id, Answers: map[string]string{"quality": "2"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	stats := surveys.Stats()
+	if stats.Responses != 2 || len(stats.Questions) != 2 {
+		t.Fatalf("Unexpected stats %+v", stats)
+	}
+	quality := stats.Questions[0]
+	if quality.Answers != 2 || quality.Average != 3.5 || quality.Ratings["5"] != 1 || quality.Ratings["2"] != 1 {
+		t.Errorf("Unexpected rating stats %+v", quality)
+	}
+	if comment := stats.Questions[1]; comment.Answers != 1 || comment.Ratings != nil {
+		t.Errorf("Unexpected text stats %+v", comment)
+	}
+}
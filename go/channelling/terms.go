@@ -0,0 +1,169 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package channelling
+
+import (
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+// TermsAcceptance records that a user or client accepted a version of the
+// terms.
+type TermsAcceptance struct {
+	Version  string    `json:"version"`
+	Userid   string    `json:"userid,omitempty"`
+	RemoteIP string    `json:"remote_ip,omitempty"`
+	Time     time.Time `json:"time"`
+}
+
+// Terms gates Hello on the acceptance of the configured terms version.
+type Terms interface {
+	RetentionStore
+	Check(session *Session, accepted string) error
+	Acceptances() []*TermsAcceptance
+	Acceptance(userid string) *TermsAcceptance
+	EraseUser(userid string) int
+}
+
+type terms struct {
+	sync.Mutex
+	version     string
+	acceptances map[string]*TermsAcceptance // Map of userid or remote IP -> latest acceptance.
+}
+
+// NewTerms returns the Terms for the configured version, or nil if no
+// terms are configured.
+func NewTerms(config *Config) Terms {
+	if config.TermsVersion == "" {
+		return nil
+	}
+	return &terms{
+		version:     config.TermsVersion,
+		acceptances: make(map[string]*TermsAcceptance),
+	}
+}
+
+// Check returns an error unless accepted is the current terms version or
+// the user of session accepted it before. Acceptances are recorded by
+// userid, or by remote IP for anonymous sessions. Anonymous sessions have
+// to send the accepted version with every Hello.
+func (terms *terms) Check(session *Session, accepted string) error {
+	userid := session.Userid()
+	key := userid
+	if key == "" {
+		key = "ip:" + session.RemoteIP
+	}
+
+	terms.Lock()
+	defer terms.Unlock()
+	if accepted == terms.version {
+		if acceptance, ok := terms.acceptances[key]; !ok || acceptance.Version != terms.version {
+			terms.acceptances[key] = &TermsAcceptance{terms.version, userid, session.RemoteIP, time.Now()}
+			log.Printf("Terms version %s accepted by session %s\n", terms.version, session.Id)
+		}
+		return nil
+	}
+	if userid != "" {
+		if acceptance, ok := terms.acceptances[key]; ok && acceptance.Version == terms.version {
+			return nil
+		}
+	}
+	return NewDataError("terms_required", "Terms must be accepted")
+}
+
+// Acceptances returns the latest acceptance of every user and remote IP,
+// oldest first.
+func (terms *terms) Acceptances() []*TermsAcceptance {
+	terms.Lock()
+	defer terms.Unlock()
+	acceptances := make([]*TermsAcceptance, 0, len(terms.acceptances))
+	for _, acceptance := range terms.acceptances {
+		copied := *acceptance
+		acceptances = append(acceptances, &copied)
+	}
+	sort.Sort(byTermsAcceptanceTime(acceptances))
+	return acceptances
+}
+
+// Acceptance returns the latest acceptance of userid, nil if the user did
+// not accept any terms.
+func (terms *terms) Acceptance(userid string) *TermsAcceptance {
+	if userid == "" {
+		return nil
+	}
+	terms.Lock()
+	defer terms.Unlock()
+	acceptance, ok := terms.acceptances[userid]
+	if !ok {
+		return nil
+	}
+	copied := *acceptance
+	return &copied
+}
+
+// EraseUser removes the acceptance of userid and returns the number of
+// removed acceptances.
+func (terms *terms) EraseUser(userid string) int {
+	if userid == "" {
+		return 0
+	}
+	terms.Lock()
+	defer terms.Unlock()
+	if _, ok := terms.acceptances[userid]; !ok {
+		return 0
+	}
+	delete(terms.acceptances, userid)
+	return 1
+}
+
+// ExpireBefore removes acceptances older than before and returns their
+// number. With dryRun, acceptances are only counted.
+func (terms *terms) ExpireBefore(before time.Time, dryRun bool) int {
+	terms.Lock()
+	defer terms.Unlock()
+	count := 0
+	for key, acceptance := range terms.acceptances {
+		if acceptance.Time.Before(before) {
+			if !dryRun {
+				delete(terms.acceptances, key)
+			}
+			count++
+		}
+	}
+	return count
+}
+
+type byTermsAcceptanceTime []*TermsAcceptance
+
+func (a byTermsAcceptanceTime) Len() int {
+	return len(a)
+}
+
+func (a byTermsAcceptanceTime) Swap(i, j int) {
+	a[i], a[j] = a[j], a[i]
+}
+
+func (a byTermsAcceptanceTime) Less(i, j int) bool {
+	return a[i].Time.Before(a[j].Time)
+}
@@ -0,0 +1,60 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package channelling
+
+import (
+	"testing"
+)
+
+func Test_Terms_RequiresCurrentVersion(t *testing.T) {
+	if NewTerms(&Config{}) != nil {
+		t.Fatal("Expected no terms without version")
+	}
+
+	terms := NewTerms(&Config{TermsVersion: "2"})
+	anonymous := &Session{Id: "a", RemoteIP: "192.0.2.1"}
+	if err := terms.Check(anonymous, ""); err == nil || err.(*DataError).Code != "terms_required" {
+		t.Errorf("Expected terms_required, but got %v", err)
+	}
+	if err := terms.Check(anonymous, "1"); err == nil {
+		t.Error("Expected outdated version to be rejected")
+	}
+	if err := terms.Check(anonymous, "2"); err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+	if err := terms.Check(anonymous, ""); err == nil {
+		t.Error("Expected anonymous sessions to send the accepted version")
+	}
+
+	user := &Session{Id: "b", userid: "alice", RemoteIP: "192.0.2.2"}
+	if err := terms.Check(user, "2"); err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+	if err := terms.Check(&Session{Id: "c", userid: "alice"}, ""); err != nil {
+		t.Errorf("Expected recorded acceptance of the user to be used, but got %v", err)
+	}
+
+	acceptances := terms.Acceptances()
+	if len(acceptances) != 2 || acceptances[0].RemoteIP != "192.0.2.1" || acceptances[1].Userid != "alice" {
+		t.Errorf("Unexpected acceptances %+v", acceptances)
+	}
+}
@@ -28,7 +28,11 @@ import (
 	"encoding/base64"
 	"fmt"
 	"log"
+	"strings"
+	"sync"
+	"time"
 
+	"github.com/strukturag/spreed-webrtc/go/idgen"
 	"github.com/strukturag/spreed-webrtc/go/randomstring"
 
 	"github.com/gorilla/securecookie"
@@ -49,35 +53,167 @@ type SessionEncoder interface {
 	EncodeSessionUserID(*Session) string
 }
 
+type SessionRevoker interface {
+	RotateSessionSecret(sessionSecret []byte, grace time.Duration)
+	RevokeSessionToken(id string)
+	RevokeUserid(userid string)
+	Revoked(st *SessionToken) bool
+}
+
 type Tickets interface {
 	SessionValidator
 	SessionEncoder
-	DecodeSessionToken(token string) (st *SessionToken)
+	SessionRevoker
+	DecodeSessionToken(token, fingerprint string) (st *SessionToken)
 	FakeSessionToken(userid string) *SessionToken
+	SetIDGenerator(generator idgen.Generator)
+	ApplyRevocation(revocation *SessionRevocation)
+	PublishRevocations(publish func(revocation *SessionRevocation))
+}
+
+// A SessionRevocation revokes a public session id, or all tokens which
+// were issued to a user up to Revoked.
+type SessionRevocation struct {
+	Node    string `json:",omitempty"` // Node which revoked.
+	Id      string `json:",omitempty"`
+	Userid  string `json:",omitempty"`
+	Revoked int64  `json:",omitempty"` // Unix time in nanoseconds.
 }
 
+// Length of the random part of session secrets.
+const sessionSidLength = 32
+
+const ticketsMaxAge = 86400 * 30 // 30 days
+
 type tickets struct {
-	*securecookie.SecureCookie
+	mutex            sync.RWMutex
+	codec            *rotatingCodec
+	revokedIds       map[string]time.Time // Not restored after a restart.
+	revokedUserids   map[string]time.Time // Not restored after a restart.
+	publish          func(*SessionRevocation)
 	realm            string
 	tokenName        string
 	encryptionSecret []byte
+	idGenerator      idgen.Generator
 }
 
 func NewTickets(sessionSecret, encryptionSecret []byte, realm string) Tickets {
 	tickets := &tickets{
-		nil,
-		realm,
-		fmt.Sprintf("token@%s", realm),
-		encryptionSecret,
+		revokedIds:       make(map[string]time.Time),
+		revokedUserids:   make(map[string]time.Time),
+		realm:            realm,
+		tokenName:        fmt.Sprintf("token@%s", realm),
+		encryptionSecret: encryptionSecret,
 	}
-	tickets.SecureCookie = securecookie.New(sessionSecret, encryptionSecret)
-	tickets.MaxAge(86400 * 30) // 30 days
-	tickets.HashFunc(sha256.New)
-	tickets.BlockFunc(aes.NewCipher)
+	tickets.codec = newRotatingCodec(sessionSecret, tickets.newCodec)
 
 	return tickets
 }
 
+func (tickets *tickets) newCodec(sessionSecret []byte) *securecookie.SecureCookie {
+	codec := securecookie.New(sessionSecret, tickets.encryptionSecret)
+	codec.MaxAge(ticketsMaxAge)
+	codec.HashFunc(sha256.New)
+	codec.BlockFunc(aes.NewCipher)
+	return codec
+}
+
+// RotateSessionSecret makes sessionSecret the secret for all new tokens
+// and session ids. Values created with the previous secret are accepted
+// until the grace duration has passed.
+func (tickets *tickets) RotateSessionSecret(sessionSecret []byte, grace time.Duration) {
+	valid := tickets.codec.Rotate(sessionSecret, grace)
+	log.Printf("Rotated session secret, %d previous secrets still valid\n", valid)
+}
+
+func (tickets *tickets) encode(name string, value interface{}) (string, error) {
+	return tickets.codec.Encode(name, value)
+}
+
+func (tickets *tickets) decode(name, value string, dst interface{}) error {
+	return tickets.codec.Decode(name, value, dst)
+}
+
+// RevokeSessionToken rejects all further tokens and validations for the
+// public session id. The entry is kept as long as a token could be valid.
+func (tickets *tickets) RevokeSessionToken(id string) {
+	tickets.revoke(&SessionRevocation{Id: id})
+	log.Println("Revoked session", id)
+}
+
+// RevokeUserid rejects all tokens which were issued to userid up to now.
+// Tokens issued after a new authentication stay valid.
+func (tickets *tickets) RevokeUserid(userid string) {
+	tickets.revoke(&SessionRevocation{Userid: userid, Revoked: time.Now().UnixNano()})
+	log.Println("Revoked sessions of user", userid)
+}
+
+func (tickets *tickets) revoke(revocation *SessionRevocation) {
+	tickets.ApplyRevocation(revocation)
+	tickets.mutex.RLock()
+	publish := tickets.publish
+	tickets.mutex.RUnlock()
+	if publish != nil {
+		publish(revocation)
+	}
+}
+
+// ApplyRevocation revokes like RevokeSessionToken and RevokeUserid, but
+// without publishing the revocation.
+func (tickets *tickets) ApplyRevocation(revocation *SessionRevocation) {
+	tickets.mutex.Lock()
+	defer tickets.mutex.Unlock()
+	tickets.expireRevoked()
+	if revocation.Id != "" {
+		tickets.revokedIds[revocation.Id] = time.Now().Add(ticketsMaxAge * time.Second)
+	}
+	if revocation.Userid != "" {
+		revoked := time.Unix(0, revocation.Revoked)
+		if previous, ok := tickets.revokedUserids[revocation.Userid]; !ok || revoked.After(previous) {
+			tickets.revokedUserids[revocation.Userid] = revoked
+		}
+	}
+}
+
+// PublishRevocations calls publish with all further revocations of this
+// node, so they can be applied on other nodes.
+func (tickets *tickets) PublishRevocations(publish func(revocation *SessionRevocation)) {
+	tickets.mutex.Lock()
+	tickets.publish = publish
+	tickets.mutex.Unlock()
+}
+
+func (tickets *tickets) expireRevoked() {
+	now := time.Now()
+	for id, expires := range tickets.revokedIds {
+		if now.After(expires) {
+			delete(tickets.revokedIds, id)
+		}
+	}
+	for userid, revoked := range tickets.revokedUserids {
+		if now.Sub(revoked) > ticketsMaxAge*time.Second {
+			delete(tickets.revokedUserids, userid)
+		}
+	}
+}
+
+// Revoked returns true when the session id of st has been revoked, or
+// when st was issued before its user has been revoked.
+func (tickets *tickets) Revoked(st *SessionToken) bool {
+	tickets.mutex.RLock()
+	defer tickets.mutex.RUnlock()
+
+	if _, ok := tickets.revokedIds[st.Id]; ok {
+		return true
+	}
+	if st.Userid != "" {
+		if revoked, ok := tickets.revokedUserids[st.Userid]; ok && st.Issued <= revoked.UnixNano() {
+			return true
+		}
+	}
+	return false
+}
+
 func (tickets *tickets) Realm() string {
 	return tickets.realm
 }
@@ -103,21 +239,28 @@ func (tickets *tickets) reverseSessionId(id string) string {
 	return reversedId
 }
 
-func (tickets *tickets) DecodeSessionToken(token string) (st *SessionToken) {
+// DecodeSessionToken returns the session token encoded in token, or a new
+// one if token is not valid. When fingerprint is not empty, tokens which
+// were bound to another client fingerprint are not valid.
+func (tickets *tickets) DecodeSessionToken(token, fingerprint string) (st *SessionToken) {
 	var err error
 	if token != "" {
 		st = &SessionToken{}
-		err = tickets.Decode(tickets.tokenName, token, st)
+		err = tickets.decode(tickets.tokenName, token, st)
 		if err != nil {
 			log.Println("Error while decoding session token", err)
+		} else if tickets.Revoked(st) {
+			log.Println("Rejected revoked session token", st.Id)
+			st = nil
+		} else if fingerprint != "" && st.Fp != fingerprint {
+			log.Println("Rejected session token of another client", st.Id)
+			st = nil
 		}
 	}
 
 	if st == nil || err != nil {
-		sid := randomstring.NewRandomString(32)
-		id, _ := tickets.Encode("id", sid)
-		id = tickets.reverseSessionId(id)
-		st = &SessionToken{Id: id, Sid: sid}
+		id, sid := tickets.newSessionId("")
+		st = &SessionToken{Id: id, Sid: sid, Fp: fingerprint}
 		if !silentOutput {
 			log.Println("Created new session id", id)
 		}
@@ -126,24 +269,58 @@ func (tickets *tickets) DecodeSessionToken(token string) (st *SessionToken) {
 }
 
 func (tickets *tickets) FakeSessionToken(userid string) (st *SessionToken) {
-	sid := fmt.Sprintf("fake-%s", randomstring.NewRandomString(27))
-	id, _ := tickets.Encode("id", sid)
-	id = tickets.reverseSessionId(id)
+	id, sid := tickets.newSessionId("fake-")
 	st = &SessionToken{Id: id, Sid: sid, Userid: userid}
 	log.Println("Created new fake session id", st.Id)
 	return
 }
 
+// SetIDGenerator makes session ids start with an identifier of generator,
+// e.g. to sort them by creation time. Nil keeps random session ids.
+func (tickets *tickets) SetIDGenerator(generator idgen.Generator) {
+	tickets.mutex.Lock()
+	tickets.idGenerator = generator
+	tickets.mutex.Unlock()
+}
+
+// newSessionId returns a new session id and its secret. The secret is
+// random, behind the identifier of the id generator if set. Ids are the
+// same identifier followed by the encoded secret.
+func (tickets *tickets) newSessionId(kind string) (id, sid string) {
+	tickets.mutex.RLock()
+	generator := tickets.idGenerator
+	tickets.mutex.RUnlock()
+	prefix := ""
+	if generator != nil {
+		prefix = generator()
+	}
+	sid = prefix + kind + randomstring.NewRandomString(sessionSidLength-len(kind))
+	id, _ = tickets.encode("id", sid)
+	return prefix + tickets.reverseSessionId(id), sid
+}
+
 func (tickets *tickets) ValidateSession(id, sid string) bool {
 	var decoded string
-	reversedId, err := reverseBase64String(id)
+	// Ids of generated secrets start with the identifier in front of the
+	// random part of the secret.
+	prefix := ""
+	if len(sid) > sessionSidLength {
+		prefix = sid[:len(sid)-sessionSidLength]
+	}
+	if !strings.HasPrefix(id, prefix) {
+		if !silentOutput {
+			log.Println("Session format error", id, sid)
+		}
+		return false
+	}
+	reversedId, err := reverseBase64String(id[len(prefix):])
 	if err != nil {
 		if !silentOutput {
 			log.Println("Session format error", err, id, sid)
 		}
 		return false
 	}
-	if err := tickets.Decode("id", reversedId, &decoded); err != nil {
+	if err := tickets.decode("id", reversedId, &decoded); err != nil {
 		if !silentOutput {
 			log.Println("Session validation error", err, reversedId, sid)
 		}
@@ -155,11 +332,19 @@ func (tickets *tickets) ValidateSession(id, sid string) bool {
 		}
 		return false
 	}
+	if tickets.Revoked(&SessionToken{Id: id}) {
+		if !silentOutput {
+			log.Println("Session validation for revoked session", id)
+		}
+		return false
+	}
 	return true
 }
 
 func (tickets *tickets) EncodeSessionToken(session *Session) (string, error) {
-	return tickets.Encode(tickets.tokenName, session.Token())
+	st := session.Token()
+	st.Issued = time.Now().UnixNano()
+	return tickets.encode(tickets.tokenName, st)
 }
 
 func (tickets *tickets) EncodeSessionUserID(session *Session) (suserid string) {
@@ -25,6 +25,9 @@ import (
 	"crypto/rand"
 	"encoding/base64"
 	"testing"
+	"time"
+
+	"github.com/strukturag/spreed-webrtc/go/idgen"
 )
 
 func getRandom(n int) ([]byte, error) {
@@ -82,7 +85,7 @@ func Test_Sessions(t *testing.T) {
 	tickets := NewTickets(sessionSecret, encryptionSecret, "test")
 	silentOutput = true
 	for i := 0; i < 1000; i++ {
-		st := tickets.DecodeSessionToken("")
+		st := tickets.DecodeSessionToken("", "")
 		if st == nil {
 			t.Error("Could not create session")
 			continue
@@ -95,3 +98,120 @@ func Test_Sessions(t *testing.T) {
 	}
 	silentOutput = false
 }
+
+func Test_SessionsWithIDGenerator(t *testing.T) {
+	sessionSecret, err := getRandom(64)
+	if err != nil {
+		t.Fatalf("Could not create session secret: %v", err)
+	}
+	encryptionSecret, err := getRandom(32)
+	if err != nil {
+		t.Fatalf("Could not create encryption secret: %v", err)
+	}
+
+	tickets := NewTickets(sessionSecret, encryptionSecret, "test")
+	generator, _ := idgen.New(idgen.SchemeULID)
+	tickets.SetIDGenerator(generator)
+	silentOutput = true
+	defer func() { silentOutput = false }()
+	var previous time.Time
+	for i := 0; i < 100; i++ {
+		st := tickets.DecodeSessionToken("", "")
+		if st == nil {
+			t.Fatal("Could not create session")
+		}
+		created, err := idgen.Time(st.Id[:26])
+		if err != nil {
+			t.Fatalf("Session id %s does not start with an ulid: %v", st.Id, err)
+		}
+		if created.Before(previous) {
+			t.Errorf("Session id %s sorts before previous session", st.Id)
+		}
+		previous = created
+		if !tickets.ValidateSession(st.Id, st.Sid) {
+			t.Errorf("Session is invalid: %v", st)
+		}
+		if tickets.ValidateSession(st.Id[26:], st.Sid) {
+			t.Errorf("Session without identifier is valid: %v", st)
+		}
+	}
+
+	fake := tickets.FakeSessionToken("user")
+	if !tickets.ValidateSession(fake.Id, fake.Sid) {
+		t.Errorf("Fake session is invalid: %v", fake)
+	}
+}
+
+func Test_SessionSecretRotation(t *testing.T) {
+	sessionSecret, _ := getRandom(64)
+	encryptionSecret, _ := getRandom(32)
+	tickets := NewTickets(sessionSecret, encryptionSecret, "test")
+	silentOutput = true
+	defer func() { silentOutput = false }()
+
+	st := tickets.DecodeSessionToken("", "")
+	newSecret, _ := getRandom(64)
+	tickets.RotateSessionSecret(newSecret, time.Hour)
+	if !tickets.ValidateSession(st.Id, st.Sid) {
+		t.Errorf("Session should be valid within grace period: %v", st)
+	}
+
+	otherSecret, _ := getRandom(64)
+	tickets.RotateSessionSecret(otherSecret, 0)
+	if tickets.ValidateSession(st.Id, st.Sid) {
+		t.Errorf("Session should be invalid without grace period: %v", st)
+	}
+
+	st = tickets.DecodeSessionToken("", "")
+	if !tickets.ValidateSession(st.Id, st.Sid) {
+		t.Errorf("Session created with rotated secret is invalid: %v", st)
+	}
+}
+
+func Test_SessionRevocation(t *testing.T) {
+	sessionSecret, _ := getRandom(64)
+	encryptionSecret, _ := getRandom(32)
+	tickets := NewTickets(sessionSecret, encryptionSecret, "test")
+	silentOutput = true
+	defer func() { silentOutput = false }()
+
+	st := tickets.DecodeSessionToken("", "")
+	tickets.RevokeSessionToken(st.Id)
+	if tickets.ValidateSession(st.Id, st.Sid) {
+		t.Errorf("Revoked session should be invalid: %v", st)
+	}
+
+	st = &SessionToken{Id: "id", Userid: "user", Issued: time.Now().Add(-time.Minute).UnixNano()}
+	tickets.RevokeUserid("user")
+	if !tickets.Revoked(st) {
+		t.Errorf("Token issued before user revocation should be revoked: %v", st)
+	}
+	st.Issued = time.Now().Add(time.Minute).UnixNano()
+	if tickets.Revoked(st) {
+		t.Errorf("Token issued after user revocation should not be revoked: %v", st)
+	}
+}
+
+func Test_SessionTokenFingerprintBinding(t *testing.T) {
+	sessionSecret, _ := getRandom(64)
+	encryptionSecret, _ := getRandom(32)
+	tickets := NewTickets(sessionSecret, encryptionSecret, "test")
+	silentOutput = true
+	defer func() { silentOutput = false }()
+
+	st := tickets.DecodeSessionToken("", "client-a")
+	if st.Fp != "client-a" {
+		t.Fatalf("Expected new token to be bound to the client, but got %v", st)
+	}
+	token, _ := tickets.EncodeSessionToken(&Session{Id: st.Id, Sid: st.Sid, fingerprint: st.Fp})
+
+	if decoded := tickets.DecodeSessionToken(token, "client-a"); decoded.Id != st.Id {
+		t.Errorf("Expected token to be valid for its client, but got %v", decoded)
+	}
+	if decoded := tickets.DecodeSessionToken(token, "client-b"); decoded.Id == st.Id || decoded.Fp != "client-b" {
+		t.Errorf("Expected new session for another client, but got %v", decoded)
+	}
+	if decoded := tickets.DecodeSessionToken(token, ""); decoded.Id != st.Id {
+		t.Errorf("Expected token to be valid without binding, but got %v", decoded)
+	}
+}
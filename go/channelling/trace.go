@@ -0,0 +1,230 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package channelling
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	TraceInbound  = "in"
+	TraceOutbound = "out"
+
+	// TraceRedacted replaces the values of redacted fields.
+	TraceRedacted = "[redacted]"
+)
+
+// DefaultTraceRedact are the fields whose values are redacted in traces
+// unless configured otherwise: media descriptions and candidates, chat
+// messages, credentials and user identities.
+var DefaultTraceRedact = []string{
+	"sdp", "candidate", "Message", "Token", "Credentials", "PIN", "Ua",
+	"Userid", "Suserid", "Turn", "Username", "Password",
+}
+
+// A TraceRecord is a signaling message of a traced session. Inbound
+// records hold the document as sent by the client, outbound records the
+// complete DataOutgoing.
+type TraceRecord struct {
+	Time      time.Time
+	Session   string
+	Direction string
+	Data      json.RawMessage
+}
+
+// A TraceWriter stores trace records.
+type TraceWriter interface {
+	WriteTrace(*TraceRecord) error
+}
+
+// Tracer records the signaling messages of sessions which are traced.
+type Tracer interface {
+	Tracing(session *Session) bool
+	Record(session *Session, direction string, data []byte)
+}
+
+// SessionTracer traces sessions which were selected by session id or
+// userid, e.g. by an administrator debugging a client.
+type SessionTracer struct {
+	writer   TraceWriter
+	redact   map[string]bool
+	mutex    sync.RWMutex
+	sessions map[string]bool
+	userids  map[string]bool
+}
+
+// NewSessionTracer creates a tracer which writes to writer and redacts the
+// values of the fields named in redact, at any depth.
+func NewSessionTracer(writer TraceWriter, redact []string) *SessionTracer {
+	tracer := &SessionTracer{
+		writer:   writer,
+		redact:   make(map[string]bool),
+		sessions: make(map[string]bool),
+		userids:  make(map[string]bool),
+	}
+	for _, field := range redact {
+		tracer.redact[field] = true
+	}
+	return tracer
+}
+
+// Start traces the session id, or all sessions of userid. Either can be
+// empty.
+func (tracer *SessionTracer) Start(id, userid string) {
+	tracer.mutex.Lock()
+	if id != "" {
+		tracer.sessions[id] = true
+	}
+	if userid != "" {
+		tracer.userids[userid] = true
+	}
+	tracer.mutex.Unlock()
+}
+
+// Stop ends tracing of the session id and of userid.
+func (tracer *SessionTracer) Stop(id, userid string) {
+	tracer.mutex.Lock()
+	delete(tracer.sessions, id)
+	delete(tracer.userids, userid)
+	tracer.mutex.Unlock()
+}
+
+// Traced returns the traced session ids and userids, sorted.
+func (tracer *SessionTracer) Traced() (sessions []string, userids []string) {
+	tracer.mutex.RLock()
+	defer tracer.mutex.RUnlock()
+	sessions = make([]string, 0, len(tracer.sessions))
+	for id := range tracer.sessions {
+		sessions = append(sessions, id)
+	}
+	userids = make([]string, 0, len(tracer.userids))
+	for userid := range tracer.userids {
+		userids = append(userids, userid)
+	}
+	sort.Strings(sessions)
+	sort.Strings(userids)
+	return
+}
+
+func (tracer *SessionTracer) Tracing(session *Session) bool {
+	tracer.mutex.RLock()
+	defer tracer.mutex.RUnlock()
+	if tracer.sessions[session.Id] {
+		return true
+	}
+	userid := session.Userid()
+	return userid != "" && tracer.userids[userid]
+}
+
+// Record writes the message data of session. Messages which are no JSON
+// documents are not recorded, as they cannot be redacted.
+func (tracer *SessionTracer) Record(session *Session, direction string, data []byte) {
+	var document interface{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&document); err != nil {
+		return
+	}
+	redacted, err := json.Marshal(tracer.redactValue(document))
+	if err != nil {
+		return
+	}
+	tracer.writer.WriteTrace(&TraceRecord{time.Now(), session.Id, direction, redacted})
+}
+
+func (tracer *SessionTracer) redactValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, field := range v {
+			if tracer.redact[key] && field != nil {
+				v[key] = TraceRedacted
+			} else {
+				v[key] = tracer.redactValue(field)
+			}
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = tracer.redactValue(item)
+		}
+	}
+	return value
+}
+
+type traceFile struct {
+	mutex sync.Mutex
+	file  *os.File
+}
+
+// NewTraceFile appends trace records as JSON lines to the file at path.
+func NewTraceFile(path string) (TraceWriter, error) {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &traceFile{file: file}, nil
+}
+
+func (trace *traceFile) WriteTrace(record *TraceRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	trace.mutex.Lock()
+	defer trace.mutex.Unlock()
+	_, err = trace.file.Write(append(data, '\n'))
+	return err
+}
+
+type busTrace struct {
+	bus     BusManager
+	subject string
+}
+
+// NewBusTrace publishes trace records to subject of bus.
+func NewBusTrace(bus BusManager, subject string) TraceWriter {
+	return &busTrace{bus, subject}
+}
+
+func (trace *busTrace) WriteTrace(record *TraceRecord) error {
+	return trace.bus.Publish(trace.subject, record)
+}
+
+// ReadTrace reads trace records written as JSON lines from data.
+func ReadTrace(data []byte) ([]*TraceRecord, error) {
+	var records []*TraceRecord
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	for {
+		record := &TraceRecord{}
+		if err := decoder.Decode(record); err == io.EOF {
+			return records, nil
+		} else if err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+}
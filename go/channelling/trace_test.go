@@ -0,0 +1,114 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package channelling
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type testTraceWriter struct {
+	records []*TraceRecord
+}
+
+func (writer *testTraceWriter) WriteTrace(record *TraceRecord) error {
+	writer.records = append(writer.records, record)
+	return nil
+}
+
+func Test_SessionTracer_TracesSelectedSessions(t *testing.T) {
+	tracer := NewSessionTracer(&testTraceWriter{}, nil)
+	a := &Session{Id: "a"}
+	b := &Session{Id: "b", userid: "user-b"}
+	c := &Session{Id: "c"}
+	tracer.Start("a", "")
+	tracer.Start("", "user-b")
+	if !tracer.Tracing(a) || !tracer.Tracing(b) || tracer.Tracing(c) {
+		t.Errorf("Expected a and b to be traced, but got %v %v %v", tracer.Tracing(a), tracer.Tracing(b), tracer.Tracing(c))
+	}
+	sessions, userids := tracer.Traced()
+	if len(sessions) != 1 || sessions[0] != "a" || len(userids) != 1 || userids[0] != "user-b" {
+		t.Errorf("Unexpected traced sessions %v and userids %v", sessions, userids)
+	}
+	tracer.Stop("a", "user-b")
+	if tracer.Tracing(a) || tracer.Tracing(b) {
+		t.Error("Expected tracing to be stopped")
+	}
+}
+
+func Test_SessionTracer_RedactsFields(t *testing.T) {
+	writer := &testTraceWriter{}
+	tracer := NewSessionTracer(writer, DefaultTraceRedact)
+	session := &Session{Id: "a"}
+	tracer.Record(session, TraceInbound, []byte(`{"Type":"Offer","Offer":{"To":"b","Offer":{"type":"offer","sdp":"v=0 secret"}},"Iid":"1"}`))
+	tracer.Record(session, TraceOutbound, []byte(`{"From":"b","Data":{"Type":"Chat","Chat":{"Message":"hi","Mid":"1"}},"A":"x"}`+"\n"))
+	tracer.Record(session, TraceInbound, []byte(`not json`))
+
+	if len(writer.records) != 2 {
+		t.Fatalf("Expected 2 records, but got %d", len(writer.records))
+	}
+	offer := string(writer.records[0].Data)
+	if strings.Contains(offer, "secret") || !strings.Contains(offer, `"type":"offer"`) || !strings.Contains(offer, `"Iid":"1"`) {
+		t.Errorf("Unexpected redacted offer %s", offer)
+	}
+	chat := string(writer.records[1].Data)
+	if strings.Contains(chat, `"hi"`) || !strings.Contains(chat, `"Mid":"1"`) {
+		t.Errorf("Unexpected redacted chat %s", chat)
+	}
+	if writer.records[1].Direction != TraceOutbound || writer.records[1].Session != "a" {
+		t.Errorf("Unexpected record %v", writer.records[1])
+	}
+}
+
+func Test_TraceFile_ReadTrace(t *testing.T) {
+	dir, err := ioutil.TempDir("", "trace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "trace.jsonl")
+	writer, err := NewTraceFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tracer := NewSessionTracer(writer, nil)
+	tracer.Record(&Session{Id: "a"}, TraceInbound, []byte(`{"Type":"Hello","Hello":{"Id":"room"}}`))
+	tracer.Record(&Session{Id: "a"}, TraceOutbound, []byte(`{"Data":{"Type":"Welcome"}}`))
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	records, err := ReadTrace(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 || records[0].Direction != TraceInbound || records[1].Direction != TraceOutbound {
+		t.Fatalf("Unexpected records %v", records)
+	}
+	if string(records[0].Data) != `{"Hello":{"Id":"room"},"Type":"Hello"}` {
+		t.Errorf("Unexpected data %s", records[0].Data)
+	}
+}
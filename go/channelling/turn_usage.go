@@ -0,0 +1,327 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package channelling
+
+import (
+	"bufio"
+	"log"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	turnUsagePollInterval = time.Second // Interval to check the TURN log for new lines.
+)
+
+// Usage lines of coturn, which report the traffic between a client and the
+// TURN server since the previous report. Peer usage lines are ignored, as
+// relayed data is already counted on the client side.
+var turnUsageLineRegexp = regexp.MustCompile(`session (\d+): usage: realm=<[^>]*>, username=<([^>]*)>, rp=(\d+), rb=(\d+), sp=(\d+), sb=(\d+)`)
+
+// TurnUsageEvent is traffic reported by the TURN server for an allocation.
+type TurnUsageEvent struct {
+	Session         string // Session id of the TURN server.
+	Username        string // TURN username as created by CreateTurnData.
+	ReceivedPackets int64
+	ReceivedBytes   int64
+	SentPackets     int64
+	SentBytes       int64
+}
+
+// ParseTurnUsageLine parses a usage line of the coturn log.
+func ParseTurnUsageLine(line string) (*TurnUsageEvent, bool) {
+	match := turnUsageLineRegexp.FindStringSubmatch(line)
+	if match == nil {
+		return nil, false
+	}
+	values := make([]int64, 4)
+	for i := range values {
+		value, err := strconv.ParseInt(match[3+i], 10, 64)
+		if err != nil {
+			return nil, false
+		}
+		values[i] = value
+	}
+	return &TurnUsageEvent{match[1], match[2], values[0], values[1], values[2], values[3]}, true
+}
+
+// TurnUsageStat is the TURN traffic of a session or a room. Received
+// counts data from clients to the TURN server, sent from the TURN server
+// to clients.
+type TurnUsageStat struct {
+	Id              string    `json:"id"`
+	Userid          string    `json:"userid,omitempty"`
+	Roomid          string    `json:"roomid,omitempty"`
+	ReceivedPackets int64     `json:"received_packets"`
+	ReceivedBytes   int64     `json:"received_bytes"`
+	SentPackets     int64     `json:"sent_packets"`
+	SentBytes       int64     `json:"sent_bytes"`
+	Updated         time.Time `json:"updated"`
+}
+
+func (stat *TurnUsageStat) add(event *TurnUsageEvent, now time.Time) {
+	stat.ReceivedPackets += event.ReceivedPackets
+	stat.ReceivedBytes += event.ReceivedBytes
+	stat.SentPackets += event.SentPackets
+	stat.SentBytes += event.SentBytes
+	stat.Updated = now
+}
+
+// TurnUsage correlates the traffic reported by the TURN server with the
+// sessions and rooms which used the TURN credentials.
+type TurnUsage interface {
+	RetentionStore
+	Track(session *Session, username string)
+	Ingest(event *TurnUsageEvent) bool
+	Tail(path string) error
+	Stop()
+	Sessions() []*TurnUsageStat
+	Rooms() []*TurnUsageStat
+	UserSessions(userid string) []*TurnUsageStat
+	EraseUser(userid string) int
+}
+
+type turnUsage struct {
+	sync.Mutex
+	sessionStore SessionStore
+	credentials  map[string]*TurnUsageStat // Map of hashed session id in the username -> session usage.
+	rooms        map[string]*TurnUsageStat
+	exit         chan bool
+}
+
+func NewTurnUsage(sessionStore SessionStore) TurnUsage {
+	return &turnUsage{
+		sessionStore: sessionStore,
+		credentials:  make(map[string]*TurnUsageStat),
+		rooms:        make(map[string]*TurnUsageStat),
+		exit:         make(chan bool),
+	}
+}
+
+// turnUsernameID returns the hashed session id of a TURN username, which
+// has the format expiration:id.
+func turnUsernameID(username string) string {
+	if pos := strings.Index(username, ":"); pos >= 0 {
+		return username[pos+1:]
+	}
+	return username
+}
+
+// Track remembers which session received TURN credentials.
+func (usage *turnUsage) Track(session *Session, username string) {
+	now := time.Now()
+	id := turnUsernameID(username)
+	usage.Lock()
+	defer usage.Unlock()
+	if stat, ok := usage.credentials[id]; ok {
+		stat.Roomid = session.Roomid
+		return
+	}
+	usage.credentials[id] = &TurnUsageStat{
+		Id:      session.Id,
+		Userid:  session.Userid(),
+		Roomid:  session.Roomid,
+		Updated: now,
+	}
+}
+
+// Ingest adds the traffic of an event to its session and the current room
+// of the session. Events for unknown credentials are ignored.
+func (usage *turnUsage) Ingest(event *TurnUsageEvent) bool {
+	now := time.Now()
+	usage.Lock()
+	defer usage.Unlock()
+	stat, ok := usage.credentials[turnUsernameID(event.Username)]
+	if !ok {
+		return false
+	}
+	if session, ok := usage.sessionStore.GetSession(stat.Id); ok {
+		stat.Roomid = session.Roomid
+	}
+	stat.add(event, now)
+	if stat.Roomid != "" {
+		room, ok := usage.rooms[stat.Roomid]
+		if !ok {
+			room = &TurnUsageStat{Id: stat.Roomid}
+			usage.rooms[stat.Roomid] = room
+		}
+		room.add(event, now)
+	}
+	return true
+}
+
+// ExpireBefore removes the usage of sessions and rooms which had no
+// traffic since before and returns the number of removed entries. With
+// dryRun, entries are only counted.
+func (usage *turnUsage) ExpireBefore(before time.Time, dryRun bool) int {
+	usage.Lock()
+	defer usage.Unlock()
+	count := 0
+	for id, stat := range usage.credentials {
+		if stat.Updated.Before(before) {
+			if !dryRun {
+				delete(usage.credentials, id)
+			}
+			count++
+		}
+	}
+	for id, stat := range usage.rooms {
+		if stat.Updated.Before(before) {
+			if !dryRun {
+				delete(usage.rooms, id)
+			}
+			count++
+		}
+	}
+	return count
+}
+
+// Tail follows the log file of the TURN server in the background and
+// ingests its usage lines. Rotated or truncated logs are reopened.
+func (usage *turnUsage) Tail(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	// Only new lines are ingested, older ones belong to unknown credentials.
+	offset, err := file.Seek(0, os.SEEK_END)
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	go func() {
+		ticker := time.NewTicker(turnUsagePollInterval)
+		defer ticker.Stop()
+		reader := bufio.NewReader(file)
+		var partial string
+		for {
+			select {
+			case <-usage.exit:
+				file.Close()
+				return
+			case <-ticker.C:
+			}
+			for {
+				line, err := reader.ReadString('\n')
+				offset += int64(len(line))
+				if err != nil {
+					partial += line
+					break
+				}
+				if event, ok := ParseTurnUsageLine(partial + line); ok {
+					usage.Ingest(event)
+				}
+				partial = ""
+			}
+			if reopened, ok := reopenTurnLog(path, file, offset); ok {
+				file.Close()
+				file = reopened
+				reader.Reset(file)
+				offset = 0
+				partial = ""
+			}
+		}
+	}()
+
+	return nil
+}
+
+// reopenTurnLog returns the log file at path, if it was rotated or
+// truncated since it was opened.
+func reopenTurnLog(path string, file *os.File, offset int64) (*os.File, bool) {
+	current, err := file.Stat()
+	if err != nil {
+		return nil, false
+	}
+	latest, err := os.Stat(path)
+	if err != nil || (os.SameFile(current, latest) && latest.Size() >= offset) {
+		return nil, false
+	}
+	reopened, err := os.Open(path)
+	if err != nil {
+		log.Println("Failed to reopen TURN log", err)
+		return nil, false
+	}
+	return reopened, true
+}
+
+func (usage *turnUsage) Stop() {
+	close(usage.exit)
+}
+
+func (usage *turnUsage) Sessions() []*TurnUsageStat {
+	usage.Lock()
+	defer usage.Unlock()
+	stats := make([]*TurnUsageStat, 0, len(usage.credentials))
+	for _, stat := range usage.credentials {
+		if stat.ReceivedPackets > 0 || stat.SentPackets > 0 {
+			copied := *stat
+			stats = append(stats, &copied)
+		}
+	}
+	return stats
+}
+
+func (usage *turnUsage) Rooms() []*TurnUsageStat {
+	usage.Lock()
+	defer usage.Unlock()
+	stats := make([]*TurnUsageStat, 0, len(usage.rooms))
+	for _, stat := range usage.rooms {
+		copied := *stat
+		stats = append(stats, &copied)
+	}
+	return stats
+}
+
+// UserSessions returns the usage of all sessions of userid.
+func (usage *turnUsage) UserSessions(userid string) []*TurnUsageStat {
+	usage.Lock()
+	defer usage.Unlock()
+	stats := make([]*TurnUsageStat, 0)
+	for _, stat := range usage.credentials {
+		if stat.Userid == userid {
+			copied := *stat
+			stats = append(stats, &copied)
+		}
+	}
+	return stats
+}
+
+// EraseUser removes the usage of all sessions of userid and returns the
+// number of removed entries. Room totals are kept.
+func (usage *turnUsage) EraseUser(userid string) int {
+	usage.Lock()
+	defer usage.Unlock()
+	count := 0
+	for id, stat := range usage.credentials {
+		if stat.Userid == userid {
+			delete(usage.credentials, id)
+			count++
+		}
+	}
+	return count
+}
@@ -0,0 +1,114 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package channelling
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const testTurnUsageLine = "1234: session 001000000000000001: usage: realm=<example.org>, username=<1500000000:aGFzaGVk>, rp=10, rb=1200, sp=8, sb=900\n"
+
+type testSessionStore map[string]*Session
+
+func (store testSessionStore) GetSession(id string) (*Session, bool) {
+	session, ok := store[id]
+	return session, ok
+}
+
+func Test_ParseTurnUsageLine(t *testing.T) {
+	event, ok := ParseTurnUsageLine(testTurnUsageLine)
+	if !ok {
+		t.Fatal("Expected usage line to be parsed")
+	}
+	if event.Session != "001000000000000001" || event.Username != "1500000000:aGFzaGVk" || event.ReceivedPackets != 10 || event.ReceivedBytes != 1200 || event.SentPackets != 8 || event.SentBytes != 900 {
+		t.Errorf("Unexpected event %+v", event)
+	}
+
+	if _, ok := ParseTurnUsageLine("session 001000000000000001: peer usage: realm=<example.org>, username=<1500000000:aGFzaGVk>, rp=1, rb=1, sp=1, sb=1"); ok {
+		t.Error("Expected peer usage to be ignored")
+	}
+}
+
+func Test_TurnUsage_CorrelatesSessionsAndRooms(t *testing.T) {
+	session := &Session{Id: "a", Roomid: "Room:lobby"}
+	usage := NewTurnUsage(testSessionStore{"a": session})
+	usage.Track(session, "1500000000:aGFzaGVk")
+
+	event, _ := ParseTurnUsageLine(testTurnUsageLine)
+	if !usage.Ingest(event) || !usage.Ingest(event) {
+		t.Fatal("Expected usage of known credentials to be ingested")
+	}
+	if usage.Ingest(&TurnUsageEvent{Username: "1500000000:b3RoZXI="}) {
+		t.Error("Expected usage of unknown credentials to be ignored")
+	}
+
+	sessions := usage.Sessions()
+	if len(sessions) != 1 || sessions[0].Id != "a" || sessions[0].ReceivedBytes != 2400 || sessions[0].SentBytes != 1800 {
+		t.Errorf("Unexpected session usage %+v", sessions)
+	}
+	rooms := usage.Rooms()
+	if len(rooms) != 1 || rooms[0].Id != "Room:lobby" || rooms[0].SentPackets != 16 {
+		t.Errorf("Unexpected room usage %+v", rooms)
+	}
+}
+
+func Test_TurnUsage_TailsNewLines(t *testing.T) {
+	dir, err := ioutil.TempDir("", "turnusage")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "turn.log")
+	if err := ioutil.WriteFile(path, []byte(testTurnUsageLine), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	session := &Session{Id: "a", Roomid: "Room:lobby"}
+	usage := NewTurnUsage(testSessionStore{"a": session})
+	usage.Track(session, "1500000000:aGFzaGVk")
+	if err := usage.Tail(path); err != nil {
+		t.Fatal(err)
+	}
+	defer usage.Stop()
+
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.WriteString(testTurnUsageLine)
+	file.Close()
+
+	for i := 0; i < 30; i++ {
+		if sessions := usage.Sessions(); len(sessions) == 1 {
+			if sessions[0].ReceivedBytes != 1200 {
+				t.Errorf("Expected only the new line to be ingested, but got %+v", sessions[0])
+			}
+			return
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	t.Error("Expected appended line to be ingested")
+}
@@ -23,4 +23,5 @@ package channelling
 
 type TurnDataCreator interface {
 	CreateTurnData(*Session) *DataTurn
+	SetTurnUsage(TurnUsage)
 }
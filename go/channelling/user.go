@@ -82,6 +82,19 @@ func (u *User) Data() *DataUser {
 	}
 }
 
+// Sessions returns the data of all sessions of the user.
+func (u *User) Sessions() []*DataSession {
+	u.mutex.RLock()
+	defer u.mutex.RUnlock()
+	sessions := make([]*DataSession, 0, len(u.sessionTable))
+	for _, session := range u.sessionTable {
+		sessions = append(sessions, session.Data())
+	}
+	sort.Sort(ByPrioAndStamp(sessions))
+
+	return sessions
+}
+
 func (u *User) SubscribeSessions(from *Session) []*DataSession {
 	sessions := make([]*DataSession, 0, len(u.sessionTable))
 	u.mutex.RLock()
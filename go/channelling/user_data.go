@@ -0,0 +1,204 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package channelling
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"sync"
+	"time"
+)
+
+const userDataMaxErasures = 1000 // Maximum number of kept erasure records.
+
+// UserRoomData is the data a room retains about a user.
+type UserRoomData struct {
+	Id    string
+	Owner bool                    `json:",omitempty"`
+	Log   []*RoomParticipantEvent `json:",omitempty"`
+}
+
+// UserDataExport is all data the server holds about a userid. Only the chat
+// of rooms with a chat index is stored, it is removed on erasure.
+type UserDataExport struct {
+	Userid    string
+	Exported  time.Time
+	Sessions  []*DataSession
+	Rooms     []*UserRoomData
+	TurnUsage []*TurnUsageStat `json:",omitempty"`
+	Favorites *DataFavorites   `json:",omitempty"`
+	Blocked   []string         `json:",omitempty"`
+	Terms     *TermsAcceptance `json:",omitempty"`
+}
+
+// UserDataErasure is the audit record of an erasure. The userid is only
+// kept as a SHA-256 hash, so erasures can be verified for a known userid
+// without the record itself identifying the user.
+type UserDataErasure struct {
+	Time      time.Time
+	Subject   string
+	Sessions  int // Connected sessions whose tokens were revoked.
+	Rooms     int // Rooms the user was removed from.
+	TurnUsage int // Removed TURN usage entries.
+	Chat      int `json:",omitempty"` // Removed chat index messages.
+	Favorites int `json:",omitempty"` // Removed favorites and recent entries.
+	Blocked   int `json:",omitempty"` // Removed blocklist entries of and about the user.
+	Terms     int `json:",omitempty"` // Removed terms acceptances.
+}
+
+type UserData interface {
+	RetentionStore
+	Export(userid string) *UserDataExport
+	Erase(userid string) *UserDataErasure
+	Erasures() []*UserDataErasure
+}
+
+type userData struct {
+	sync.Mutex
+	userStore UserStore
+	rooms     RoomManager
+	revoker   SessionRevoker
+	turnUsage TurnUsage
+	chatIndex ChatIndex
+	favorites Favorites
+	blocklist Blocklist
+	terms     Terms
+	erasures  []*UserDataErasure
+}
+
+// NewUserData creates a UserData for the given stores. turnUsage, chatIndex,
+// favorites, blocklist and terms may be nil if TURN usage is not tracked,
+// chat not indexed, favorites and blocklists not stored or no terms are
+// configured.
+func NewUserData(userStore UserStore, rooms RoomManager, revoker SessionRevoker, turnUsage TurnUsage, chatIndex ChatIndex, favorites Favorites, blocklist Blocklist, terms Terms) UserData {
+	return &userData{
+		userStore: userStore,
+		rooms:     rooms,
+		revoker:   revoker,
+		turnUsage: turnUsage,
+		chatIndex: chatIndex,
+		favorites: favorites,
+		blocklist: blocklist,
+		terms:     terms,
+	}
+}
+
+func (data *userData) Export(userid string) *UserDataExport {
+	export := &UserDataExport{
+		Userid:   userid,
+		Exported: time.Now(),
+		Sessions: []*DataSession{},
+		Rooms:    data.rooms.UserRooms(userid),
+	}
+	if user, ok := data.userStore.GetUser(userid); ok {
+		export.Sessions = user.Sessions()
+	}
+	if data.turnUsage != nil {
+		export.TurnUsage = data.turnUsage.UserSessions(userid)
+	}
+	if data.favorites != nil {
+		export.Favorites = data.favorites.Favorites(userid)
+	}
+	if data.blocklist != nil {
+		export.Blocked = data.blocklist.Blocked(userid)
+	}
+	if data.terms != nil {
+		export.Terms = data.terms.Acceptance(userid)
+	}
+	return export
+}
+
+// Erase revokes all session tokens of userid and removes or anonymizes the
+// data held about the user. Connected sessions stay connected until they
+// disconnect, but can not be resumed.
+func (data *userData) Erase(userid string) *UserDataErasure {
+	erasure := &UserDataErasure{
+		Time:    time.Now(),
+		Subject: UserDataSubject(userid),
+	}
+	if user, ok := data.userStore.GetUser(userid); ok {
+		erasure.Sessions = len(user.Sessions())
+	}
+	data.revoker.RevokeUserid(userid)
+	erasure.Rooms = data.rooms.EraseUser(userid)
+	if data.turnUsage != nil {
+		erasure.TurnUsage = data.turnUsage.EraseUser(userid)
+	}
+	if data.chatIndex != nil {
+		erasure.Chat = data.chatIndex.EraseUser(userid)
+	}
+	if data.favorites != nil {
+		erasure.Favorites = data.favorites.EraseUser(userid)
+	}
+	if data.blocklist != nil {
+		erasure.Blocked = data.blocklist.EraseUser(userid)
+	}
+	if data.terms != nil {
+		erasure.Terms = data.terms.EraseUser(userid)
+	}
+
+	data.Lock()
+	if len(data.erasures) >= userDataMaxErasures {
+		data.erasures = data.erasures[1:]
+	}
+	data.erasures = append(data.erasures, erasure)
+	data.Unlock()
+	log.Printf("Erased data of user %s: %d sessions, %d rooms, %d TURN usage entries, %d chat messages, %d favorites, %d blocklist entries, %d terms acceptances\n", erasure.Subject, erasure.Sessions, erasure.Rooms, erasure.TurnUsage, erasure.Chat, erasure.Favorites, erasure.Blocked, erasure.Terms)
+
+	copied := *erasure
+	return &copied
+}
+
+// Erasures returns the audit records of the latest erasures.
+func (data *userData) Erasures() []*UserDataErasure {
+	data.Lock()
+	defer data.Unlock()
+	erasures := make([]*UserDataErasure, len(data.erasures))
+	for i, erasure := range data.erasures {
+		copied := *erasure
+		erasures[i] = &copied
+	}
+	return erasures
+}
+
+// ExpireBefore removes erasure records older than before and returns
+// their number. With dryRun, records are only counted.
+func (data *userData) ExpireBefore(before time.Time, dryRun bool) int {
+	data.Lock()
+	defer data.Unlock()
+	count := 0
+	for count < len(data.erasures) && data.erasures[count].Time.Before(before) {
+		count++
+	}
+	if !dryRun {
+		data.erasures = data.erasures[count:]
+	}
+	return count
+}
+
+// UserDataSubject returns the hex encoded SHA-256 hash of userid as used in
+// erasure records.
+func UserDataSubject(userid string) string {
+	sum := sha256.Sum256([]byte(userid))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,141 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package channelling
+
+import (
+	"testing"
+	"time"
+)
+
+type testUserStore map[string]*User
+
+func (store testUserStore) GetUser(id string) (*User, bool) {
+	user, ok := store[id]
+	return user, ok
+}
+
+func (store testUserStore) Users() []*User {
+	users := make([]*User, 0, len(store))
+	for _, user := range store {
+		users = append(users, user)
+	}
+	return users
+}
+
+type testRevoker []string
+
+func (revoker *testRevoker) RotateSessionSecret(sessionSecret []byte, grace time.Duration) {}
+
+func (revoker *testRevoker) RevokeSessionToken(id string) {}
+
+func (revoker *testRevoker) RevokeUserid(userid string) {
+	*revoker = append(*revoker, userid)
+}
+
+func (revoker *testRevoker) Revoked(st *SessionToken) bool {
+	return false
+}
+
+func Test_UserData_ExportsAndErasesRoomData(t *testing.T) {
+	rooms, _ := NewTestRoomManager()
+	worker := NewTestRoomWorker()
+	rooms.(*roomManager).roomTable[testRoomID] = worker
+	worker.SetOwner("alice")
+	worker.Join(nil, &Session{Id: "a", userid: "alice"}, nil)
+	worker.Join(nil, &Session{Id: "b", userid: "bob"}, nil)
+
+	revoker := &testRevoker{}
+	data := NewUserData(testUserStore{}, rooms, revoker, nil, nil, nil, nil, nil)
+	export := data.Export("alice")
+	if len(export.Rooms) != 1 || !export.Rooms[0].Owner || len(export.Rooms[0].Log) != 1 {
+		t.Fatalf("Unexpected room data %+v", export.Rooms)
+	}
+
+	erasure := data.Erase("alice")
+	if erasure.Rooms != 1 || erasure.Subject != UserDataSubject("alice") || erasure.Subject == "alice" {
+		t.Errorf("Unexpected erasure %+v", erasure)
+	}
+	if len(*revoker) != 1 || (*revoker)[0] != "alice" {
+		t.Errorf("Expected tokens of alice to be revoked, but got %v", *revoker)
+	}
+	if rooms := data.Export("alice").Rooms; len(rooms) != 0 {
+		t.Errorf("Expected no room data after erasure, but got %+v", rooms)
+	}
+	if worker.GetOwner() != "" {
+		t.Errorf("Expected owner to be cleared, but got %s", worker.GetOwner())
+	}
+	if rooms := data.Export("bob").Rooms; len(rooms) != 1 {
+		t.Errorf("Expected data of other users to be kept, but got %+v", rooms)
+	}
+	if erasures := data.Erasures(); len(erasures) != 1 {
+		t.Errorf("Expected one erasure record, but got %d", len(erasures))
+	}
+}
+
+func Test_UserData_ExportsAndErasesBlocklists(t *testing.T) {
+	rooms, _ := NewTestRoomManager()
+	blocklist, _ := NewBlocklist("")
+	blocklist.Block("alice", "bob")
+	blocklist.Block("alice", "carol")
+	blocklist.Block("bob", "alice")
+	blocklist.Block("carol", "bob")
+
+	data := NewUserData(testUserStore{}, rooms, &testRevoker{}, nil, nil, nil, blocklist, nil)
+	if blocked := data.Export("alice").Blocked; len(blocked) != 2 || blocked[0] != "bob" || blocked[1] != "carol" {
+		t.Fatalf("Unexpected blocklist %v", blocked)
+	}
+
+	if erasure := data.Erase("alice"); erasure.Blocked != 3 {
+		t.Errorf("Expected 3 blocklist entries to be removed, but got %+v", erasure)
+	}
+	if blocked := data.Export("alice").Blocked; len(blocked) != 0 {
+		t.Errorf("Expected no blocklist after erasure, but got %v", blocked)
+	}
+	if blocklist.IsBlocked("bob", "alice") {
+		t.Error("Expected alice to be removed from the blocklists of other users")
+	}
+	if !blocklist.IsBlocked("carol", "bob") {
+		t.Error("Expected blocklists of other users to be kept")
+	}
+}
+
+func Test_UserData_ExportsAndErasesTermsAcceptances(t *testing.T) {
+	rooms, _ := NewTestRoomManager()
+	terms := NewTerms(&Config{TermsVersion: "2"})
+	terms.Check(&Session{Id: "a", userid: "alice", RemoteIP: "192.0.2.1"}, "2")
+	terms.Check(&Session{Id: "b", userid: "bob", RemoteIP: "192.0.2.2"}, "2")
+
+	data := NewUserData(testUserStore{}, rooms, &testRevoker{}, nil, nil, nil, nil, terms)
+	if acceptance := data.Export("alice").Terms; acceptance == nil || acceptance.Version != "2" || acceptance.RemoteIP != "192.0.2.1" {
+		t.Fatalf("Unexpected terms acceptance %+v", acceptance)
+	}
+
+	if erasure := data.Erase("alice"); erasure.Terms != 1 {
+		t.Errorf("Expected terms acceptance to be removed, but got %+v", erasure)
+	}
+	if acceptance := data.Export("alice").Terms; acceptance != nil {
+		t.Errorf("Expected no terms acceptance after erasure, but got %+v", acceptance)
+	}
+	if acceptances := terms.Acceptances(); len(acceptances) != 1 || acceptances[0].Userid != "bob" {
+		t.Errorf("Expected acceptances of other users to be kept, but got %+v", acceptances)
+	}
+}
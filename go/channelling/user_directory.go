@@ -0,0 +1,181 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package channelling
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Discoverability of users in the user directory.
+const (
+	DirectoryHidden = "hidden" // Never found.
+	DirectoryEmail  = "email"  // Only found by the hash of their email address.
+	DirectoryPublic = "public" // Found by name and by the hash of their email address.
+)
+
+const (
+	directoryMaxResults     = 20
+	directoryMinQueryLength = 2 // Shorter queries would list most users.
+)
+
+// DirectoryEmailHash returns the hex encoded SHA-256 hash of the lower case
+// email address, as searched for in the user directory.
+func DirectoryEmailHash(email string) string {
+	sum := sha256.Sum256([]byte(strings.ToLower(strings.TrimSpace(email))))
+	return hex.EncodeToString(sum[:])
+}
+
+// ValidDiscoverability returns true if discoverability is known.
+func ValidDiscoverability(discoverability string) bool {
+	switch discoverability {
+	case DirectoryHidden, DirectoryEmail, DirectoryPublic:
+		return true
+	}
+	return false
+}
+
+// UserDirectory finds connected users of the UserStore by display name or
+// email hash, respecting the discoverability each user chose.
+type UserDirectory interface {
+	SetDiscoverability(userid, discoverability string)
+	Discoverability(userid string) string
+	// Search returns at most limit users other than userid whose display
+	// name starts with query, or whose email address has emailHash.
+	Search(userid, query, emailHash string, limit int) ([]*DataDirectoryUser, error)
+}
+
+type userDirectory struct {
+	sync.RWMutex
+	users           UserStore
+	discoverability string            // Default for users without a setting.
+	settings        map[string]string // Map of userid -> discoverability.
+}
+
+// NewUserDirectory creates a UserDirectory of the users in users. Users
+// who did not choose their discoverability get discoverability.
+func NewUserDirectory(users UserStore, discoverability string) UserDirectory {
+	return &userDirectory{
+		users:           users,
+		discoverability: discoverability,
+		settings:        make(map[string]string),
+	}
+}
+
+func (directory *userDirectory) SetDiscoverability(userid, discoverability string) {
+	directory.Lock()
+	directory.settings[userid] = discoverability
+	directory.Unlock()
+}
+
+func (directory *userDirectory) Discoverability(userid string) string {
+	directory.RLock()
+	defer directory.RUnlock()
+	if discoverability, ok := directory.settings[userid]; ok {
+		return discoverability
+	}
+	return directory.discoverability
+}
+
+func (directory *userDirectory) Search(userid, query, emailHash string, limit int) ([]*DataDirectoryUser, error) {
+	query = strings.ToLower(strings.TrimSpace(query))
+	emailHash = strings.ToLower(emailHash)
+	if emailHash == "" && len([]rune(query)) < directoryMinQueryLength {
+		return nil, NewDataError("directory_query_too_short", "Search for at least 2 characters of a name")
+	}
+	if limit <= 0 || limit > directoryMaxResults {
+		limit = directoryMaxResults
+	}
+
+	results := []*DataDirectoryUser{}
+	for _, user := range directory.users.Users() {
+		if user.Id == userid {
+			continue
+		}
+		discoverability := directory.Discoverability(user.Id)
+		if discoverability == DirectoryHidden {
+			continue
+		}
+		sessions := user.Sessions()
+		if len(sessions) == 0 {
+			continue
+		}
+		name := DisplayName(sessions...)
+		switch {
+		case emailHash != "":
+			if !strings.Contains(user.Id, "@") || DirectoryEmailHash(user.Id) != emailHash {
+				continue
+			}
+		case discoverability != DirectoryPublic || !directoryNameMatches(name, query):
+			continue
+		}
+		results = append(results, &DataDirectoryUser{Userid: user.Id, Name: name, Sessions: sessions})
+	}
+
+	sort.Sort(directoryUsersByName(results))
+	if len(results) > limit {
+		results = results[:limit]
+	}
+	return results, nil
+}
+
+// DisplayName returns the display name in the status of the first of
+// sessions which has one.
+func DisplayName(sessions ...*DataSession) string {
+	for _, session := range sessions {
+		if status, ok := session.Status.(map[string]interface{}); ok {
+			if name, ok := status["displayName"].(string); ok && name != "" {
+				return name
+			}
+		}
+	}
+	return ""
+}
+
+// directoryNameMatches returns true if name or a word of it starts with
+// query.
+func directoryNameMatches(name, query string) bool {
+	name = strings.ToLower(name)
+	if strings.HasPrefix(name, query) {
+		return true
+	}
+	for _, word := range strings.Fields(name) {
+		if strings.HasPrefix(word, query) {
+			return true
+		}
+	}
+	return false
+}
+
+type directoryUsersByName []*DataDirectoryUser
+
+func (list directoryUsersByName) Len() int      { return len(list) }
+func (list directoryUsersByName) Swap(i, j int) { list[i], list[j] = list[j], list[i] }
+func (list directoryUsersByName) Less(i, j int) bool {
+	if list[i].Name != list[j].Name {
+		return list[i].Name < list[j].Name
+	}
+	return list[i].Userid < list[j].Userid
+}
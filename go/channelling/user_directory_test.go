@@ -0,0 +1,80 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package channelling
+
+import (
+	"testing"
+)
+
+func newTestDirectoryUser(store testUserStore, userid, name string) {
+	user := NewUser(userid)
+	user.AddSession(&Session{Id: userid + "-session", userid: userid, Status: map[string]interface{}{"displayName": name}})
+	store[userid] = user
+}
+
+func Test_UserDirectory_SearchRespectsDiscoverability(t *testing.T) {
+	store := testUserStore{}
+	newTestDirectoryUser(store, "alice@example.com", "Alice Smith")
+	newTestDirectoryUser(store, "bob@example.com", "Bob Allen")
+	newTestDirectoryUser(store, "carol@example.com", "Carol Alvarez")
+	directory := NewUserDirectory(store, DirectoryHidden)
+	directory.SetDiscoverability("alice@example.com", DirectoryPublic)
+	directory.SetDiscoverability("bob@example.com", DirectoryPublic)
+	directory.SetDiscoverability("carol@example.com", DirectoryEmail)
+
+	users, err := directory.Search("dave@example.com", "Al", "", 0)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if len(users) != 2 || users[0].Name != "Alice Smith" || users[1].Name != "Bob Allen" {
+		t.Errorf("Expected public users matching a name prefix, but got %+v", users)
+	}
+	if len(users[0].Sessions) != 1 {
+		t.Errorf("Expected sessions of found user, but got %+v", users[0].Sessions)
+	}
+
+	if users, _ := directory.Search("alice@example.com", "al", "", 0); len(users) != 1 || users[0].Userid != "bob@example.com" {
+		t.Errorf("Expected searching user to be excluded, but got %+v", users)
+	}
+
+	users, _ = directory.Search("dave@example.com", "", DirectoryEmailHash("Carol@Example.com "), 0)
+	if len(users) != 1 || users[0].Userid != "carol@example.com" {
+		t.Errorf("Expected user to be found by email hash, but got %+v", users)
+	}
+
+	directory.SetDiscoverability("carol@example.com", DirectoryHidden)
+	if users, _ := directory.Search("dave@example.com", "", DirectoryEmailHash("carol@example.com"), 0); len(users) != 0 {
+		t.Errorf("Expected hidden user not to be found, but got %+v", users)
+	}
+}
+
+func Test_UserDirectory_SearchRejectsShortQueries(t *testing.T) {
+	directory := NewUserDirectory(testUserStore{}, DirectoryPublic)
+	if _, err := directory.Search("", "a", "", 0); err == nil {
+		t.Error("Expected error for single character query")
+	} else if dataErr, ok := err.(*DataError); !ok || dataErr.Code != "directory_query_too_short" {
+		t.Errorf("Unexpected error %v", err)
+	}
+	if directory.Discoverability("alice") != DirectoryPublic {
+		t.Errorf("Expected default discoverability, but got %s", directory.Discoverability("alice"))
+	}
+}
@@ -23,4 +23,5 @@ package channelling
 
 type UserStore interface {
 	GetUser(id string) (user *User, ok bool)
+	Users() []*User
 }
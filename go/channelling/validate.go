@@ -0,0 +1,211 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package channelling
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// ValidationError is returned for incoming messages which do not match the
+// schema of their type. It is sent to clients as Error document and names
+// the offending field and rule.
+type ValidationError struct {
+	Type    string
+	Code    string
+	Message string
+	Field   string
+	Rule    string
+}
+
+func newValidationError(field, rule, message string) error {
+	return &ValidationError{"Error", "bad_request", field + " " + message, field, rule}
+}
+
+func (err *ValidationError) Error() string {
+	return err.Message
+}
+
+// A fieldValidator checks a single value at a field path.
+type fieldValidator func(field string, value reflect.Value) error
+
+// structValidator validates the tagged fields of a struct type and the
+// structs nested in it.
+type structValidator struct {
+	fields []validatedField
+}
+
+type validatedField struct {
+	index      int
+	name       string
+	validators []fieldValidator
+	nested     *structValidator
+}
+
+// incomingValidators are generated from the validate tags of the payload
+// types of DataIncoming, by message type.
+var incomingValidators = generateIncomingValidators()
+
+// ValidateIncoming checks the payload of msg against the validate tags of
+// its type. Messages without payload are not checked.
+func ValidateIncoming(msg *DataIncoming) error {
+	validator, ok := incomingValidators[msg.Type]
+	if !ok {
+		return nil
+	}
+	value := reflect.ValueOf(msg).Elem().FieldByName(msg.Type)
+	if value.IsNil() {
+		return nil
+	}
+	return validator.validate(msg.Type, value.Elem())
+}
+
+func generateIncomingValidators() map[string]*structValidator {
+	validators := make(map[string]*structValidator)
+	incomingType := reflect.TypeOf(DataIncoming{})
+	for i := 0; i < incomingType.NumField(); i++ {
+		field := incomingType.Field(i)
+		if field.Type.Kind() == reflect.Ptr && field.Type.Elem().Kind() == reflect.Struct {
+			if validator := generateStructValidator(field.Type.Elem()); validator != nil {
+				validators[field.Name] = validator
+			}
+		}
+	}
+	return validators
+}
+
+// generateStructValidator returns the validator for structType, or nil if
+// neither structType nor its nested structs have validate tags.
+func generateStructValidator(structType reflect.Type) *structValidator {
+	validator := &structValidator{}
+	for i := 0; i < structType.NumField(); i++ {
+		field := structType.Field(i)
+		if field.PkgPath != "" {
+			// Unexported.
+			continue
+		}
+		validated := validatedField{index: i, name: field.Name}
+		if tag := field.Tag.Get("validate"); tag != "" {
+			for _, rule := range strings.Split(tag, ",") {
+				validated.validators = append(validated.validators, generateFieldValidator(field, rule))
+			}
+		}
+		fieldType := field.Type
+		if fieldType.Kind() == reflect.Ptr {
+			fieldType = fieldType.Elem()
+		}
+		if fieldType.Kind() == reflect.Struct {
+			validated.nested = generateStructValidator(fieldType)
+		}
+		if len(validated.validators) > 0 || validated.nested != nil {
+			validator.fields = append(validator.fields, validated)
+		}
+	}
+	if len(validator.fields) == 0 {
+		return nil
+	}
+	return validator
+}
+
+// generateFieldValidator returns the validator for rule of field. Invalid
+// rules are programming errors and panic when the package is loaded.
+func generateFieldValidator(field reflect.StructField, rule string) fieldValidator {
+	name, arg := rule, ""
+	if pos := strings.Index(rule, "="); pos >= 0 {
+		name, arg = rule[:pos], rule[pos+1:]
+	}
+	kind := field.Type.Kind()
+	switch name {
+	case "required":
+		return func(path string, value reflect.Value) error {
+			if isEmptyValue(value) {
+				return newValidationError(path, name, "is required")
+			}
+			return nil
+		}
+	case "max":
+		max, err := strconv.Atoi(arg)
+		if err != nil || max < 0 || (kind != reflect.String && kind != reflect.Slice && kind != reflect.Map) {
+			break
+		}
+		return func(path string, value reflect.Value) error {
+			if value.Len() > max {
+				return newValidationError(path, rule, fmt.Sprintf("is too long (maximum %d)", max))
+			}
+			return nil
+		}
+	case "oneof":
+		values := strings.Fields(arg)
+		if len(values) == 0 || kind != reflect.String {
+			break
+		}
+		return func(path string, value reflect.Value) error {
+			if s := value.String(); s != "" {
+				for _, v := range values {
+					if s == v {
+						return nil
+					}
+				}
+				return newValidationError(path, rule, "must be one of "+strings.Join(values, ", "))
+			}
+			return nil
+		}
+	}
+	panic(fmt.Sprintf("invalid validate rule '%s' for field %s", rule, field.Name))
+}
+
+func (validator *structValidator) validate(path string, value reflect.Value) error {
+	for _, field := range validator.fields {
+		fieldValue := value.Field(field.index)
+		fieldPath := path + "." + field.name
+		for _, v := range field.validators {
+			if err := v(fieldPath, fieldValue); err != nil {
+				return err
+			}
+		}
+		if field.nested == nil {
+			continue
+		}
+		if fieldValue.Kind() == reflect.Ptr {
+			if fieldValue.IsNil() {
+				continue
+			}
+			fieldValue = fieldValue.Elem()
+		}
+		if err := field.nested.validate(fieldPath, fieldValue); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func isEmptyValue(value reflect.Value) bool {
+	switch value.Kind() {
+	case reflect.String, reflect.Slice, reflect.Map:
+		return value.Len() == 0
+	case reflect.Ptr, reflect.Interface:
+		return value.IsNil()
+	}
+	return false
+}
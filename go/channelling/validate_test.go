@@ -0,0 +1,86 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package channelling
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func assertValidationError(t *testing.T, err error, field, rule string) {
+	validationError, ok := err.(*ValidationError)
+	if !ok {
+		t.Fatalf("Expected a *ValidationError, but got %#v", err)
+	}
+	if validationError.Code != "bad_request" || validationError.Field != field || validationError.Rule != rule {
+		t.Errorf("Expected bad_request for %s with rule %s, but got %#v", field, rule, validationError)
+	}
+}
+
+func Test_ValidateIncoming_AcceptsValidMessages(t *testing.T) {
+	for _, msg := range []*DataIncoming{
+		{Type: "Self"},
+		{Type: "Hello"},
+		{Type: "Hello", Hello: &DataHello{Version: "1.0", Ua: "tests", Name: "room"}},
+		{Type: "Offer", Offer: &DataOffer{To: "a"}},
+		{Type: "Chat", Chat: &DataChat{Chat: &DataChatMessage{Message: "hi", Status: &DataChatStatus{Typing: "start"}}}},
+		{Type: "Sessions", Sessions: &DataSessions{Sessions: &DataSessionsRequest{Token: "t", Type: "session"}}},
+	} {
+		if err := ValidateIncoming(msg); err != nil {
+			t.Errorf("Expected %s message to be valid, but got %v", msg.Type, err)
+		}
+	}
+}
+
+func Test_ValidateIncoming_RequiresFields(t *testing.T) {
+	err := ValidateIncoming(&DataIncoming{Type: "Bye", Bye: &DataBye{}})
+	assertValidationError(t, err, "Bye.To", "required")
+}
+
+func Test_ValidateIncoming_LimitsLengths(t *testing.T) {
+	err := ValidateIncoming(&DataIncoming{Type: "Hello", Hello: &DataHello{Credentials: &DataRoomCredentials{PIN: strings.Repeat("1", 257)}}})
+	assertValidationError(t, err, "Hello.Credentials.PIN", "max=256")
+
+	err = ValidateIncoming(&DataIncoming{Type: "Chat", Chat: &DataChat{Chat: &DataChatMessage{Status: &DataChatStatus{SeenMids: make([]string, 1001)}}}})
+	assertValidationError(t, err, "Chat.Chat.Status.SeenMids", "max=1000")
+}
+
+func Test_ValidateIncoming_ChecksEnumValues(t *testing.T) {
+	err := ValidateIncoming(&DataIncoming{Type: "Chat", Chat: &DataChat{Chat: &DataChatMessage{Status: &DataChatStatus{Typing: "maybe"}}}})
+	assertValidationError(t, err, "Chat.Chat.Status.Typing", "oneof=start stop")
+
+	err = ValidateIncoming(&DataIncoming{Type: "Sessions", Sessions: &DataSessions{Sessions: &DataSessionsRequest{Token: "t", Type: "other"}}})
+	assertValidationError(t, err, "Sessions.Sessions.Type", "oneof=contact session")
+}
+
+func Test_GenerateStructValidator_PanicsOnInvalidRules(t *testing.T) {
+	type invalid struct {
+		Count int `validate:"max=1"`
+	}
+	defer func() {
+		if recover() == nil {
+			t.Error("Expected invalid rule to panic")
+		}
+	}()
+	generateStructValidator(reflect.TypeOf(invalid{}))
+}
@@ -0,0 +1,358 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+// Package client implements the Spreed WebRTC channeling API for Go
+// programs like bots, tests and integrations. It connects to the websocket
+// end point of a server, wraps the documents sent to the server and matches
+// replies to requests.
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/strukturag/spreed-webrtc/go/channelling"
+)
+
+// DefaultTimeout is the time to wait for replies to requests.
+const DefaultTimeout = 10 * time.Second
+
+var (
+	ErrClosed      = errors.New("client: connection closed")
+	ErrTimeout     = errors.New("client: request timed out")
+	ErrUnexpected  = errors.New("client: unexpected document")
+	ErrMissingSelf = errors.New("client: server did not send Self")
+)
+
+// A Transport sends and receives websocket messages, e.g. a
+// *websocket.Conn.
+type Transport interface {
+	ReadMessage() (messageType int, data []byte, err error)
+	WriteMessage(messageType int, data []byte) error
+	Close() error
+}
+
+// A Message is a document received from the server. Type is the type of
+// the document in Data.
+type Message struct {
+	Type string `json:"-"`
+	From string
+	To   string
+	Iid  string
+	A    string
+	Data json.RawMessage
+}
+
+// Decode decodes the document of msg into v.
+func (msg *Message) Decode(v interface{}) error {
+	return json.Unmarshal(msg.Data, v)
+}
+
+// Error returns the error of Error documents and nil for all others.
+func (msg *Message) Error() error {
+	if msg.Type != "Error" {
+		return nil
+	}
+	dataError := &channelling.DataError{}
+	if err := msg.Decode(dataError); err != nil {
+		return err
+	}
+	return dataError
+}
+
+// A Client is a connection to the channeling API of a server.
+type Client struct {
+	conn       Transport
+	self       *channelling.DataSelf
+	writeMutex sync.Mutex
+	mutex      sync.Mutex
+	iid        uint64
+	pending    map[string]chan *Message
+	messages   chan *Message
+	err        error
+	Timeout    time.Duration
+}
+
+// Dial connects to the websocket end point url of a server, e.g.
+// wss://example.com/ws, and waits for its Self document.
+func Dial(url string, header http.Header) (*Client, error) {
+	conn, _, err := websocket.DefaultDialer.Dial(url, header)
+	if err != nil {
+		return nil, err
+	}
+	return New(conn)
+}
+
+// New creates a Client on an established connection and waits for the
+// Self document of the server.
+func New(conn Transport) (*Client, error) {
+	msg, err := readMessage(conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	self := &channelling.DataSelf{}
+	if msg.Type != "Self" {
+		conn.Close()
+		if err := msg.Error(); err != nil {
+			return nil, err
+		}
+		return nil, ErrMissingSelf
+	}
+	if err := msg.Decode(self); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	c := &Client{
+		conn:     conn,
+		self:     self,
+		pending:  make(map[string]chan *Message),
+		messages: make(chan *Message, 100),
+		Timeout:  DefaultTimeout,
+	}
+	go c.readLoop()
+	return c, nil
+}
+
+// Self returns the Self document of the session of the client.
+func (c *Client) Self() *channelling.DataSelf {
+	return c.self
+}
+
+// Messages returns the documents received from the server which are no
+// replies to requests. It is closed when the connection closes. Receive
+// from it continuously, replies are not delivered while it is full.
+func (c *Client) Messages() <-chan *Message {
+	return c.messages
+}
+
+// Err returns the error which closed the connection.
+func (c *Client) Err() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.err
+}
+
+// Close closes the connection.
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// Send sends document of msgType to the server without waiting for a
+// reply. Errors are received as Error documents.
+func (c *Client) Send(msgType string, document interface{}) error {
+	return c.send(msgType, document, "")
+}
+
+// Request sends document of msgType to the server and returns its reply.
+// Error replies are returned as *channelling.DataError. Only use this for
+// types which are answered by the server, like Hello or Sessions.
+func (c *Client) Request(msgType string, document interface{}) (*Message, error) {
+	c.mutex.Lock()
+	if c.err != nil {
+		c.mutex.Unlock()
+		return nil, ErrClosed
+	}
+	c.iid++
+	iid := strconv.FormatUint(c.iid, 10)
+	reply := make(chan *Message, 1)
+	c.pending[iid] = reply
+	c.mutex.Unlock()
+	defer func() {
+		c.mutex.Lock()
+		delete(c.pending, iid)
+		c.mutex.Unlock()
+	}()
+
+	if err := c.send(msgType, document, iid); err != nil {
+		return nil, err
+	}
+	select {
+	case msg, ok := <-reply:
+		if !ok {
+			return nil, ErrClosed
+		}
+		if err := msg.Error(); err != nil {
+			return nil, err
+		}
+		return msg, nil
+	case <-time.After(c.Timeout):
+		return nil, ErrTimeout
+	}
+}
+
+// Hello sends the Hello document, which joins a room, and returns the
+// Welcome document of the room. Version defaults to the version of the
+// server, like the web client sends it.
+func (c *Client) Hello(hello *channelling.DataHello) (*channelling.DataWelcome, error) {
+	if hello.Version == "" {
+		hello.Version = c.self.Version
+	}
+	msg, err := c.Request("Hello", hello)
+	if err != nil {
+		return nil, err
+	}
+	if msg.Type != "Welcome" {
+		return nil, ErrUnexpected
+	}
+	welcome := &channelling.DataWelcome{}
+	if err := msg.Decode(welcome); err != nil {
+		return nil, err
+	}
+	return welcome, nil
+}
+
+// Join joins the room name of roomType, which is the default type if
+// empty. Credentials are only needed for rooms with a PIN.
+func (c *Client) Join(name, roomType string, credentials *channelling.DataRoomCredentials) (*channelling.DataWelcome, error) {
+	return c.Hello(&channelling.DataHello{
+		Ua:          "spreed-webrtc-client",
+		Name:        name,
+		Type:        roomType,
+		Credentials: credentials,
+	})
+}
+
+// Chat sends message to the session to, or to the room if to is empty.
+func (c *Client) Chat(to, message string) error {
+	return c.Send("Chat", &channelling.DataChat{
+		To:   to,
+		Type: "Chat",
+		Chat: &channelling.DataChatMessage{Message: message},
+	})
+}
+
+// Call sends an Offer with the session description offer to the session
+// to. Answers and candidates of the callee are received as messages.
+func (c *Client) Call(to string, offer map[string]interface{}) error {
+	return c.Send("Offer", &channelling.DataOffer{
+		Type:  "Offer",
+		To:    to,
+		Offer: offer,
+	})
+}
+
+// Answer answers an Offer of the session to.
+func (c *Client) Answer(to string, answer map[string]interface{}) error {
+	return c.Send("Answer", &channelling.DataAnswer{
+		Type:   "Answer",
+		To:     to,
+		Answer: answer,
+	})
+}
+
+// Candidate sends an ICE candidate to the session to.
+func (c *Client) Candidate(to string, candidate interface{}) error {
+	return c.Send("Candidate", &channelling.DataCandidate{
+		Type:      "Candidate",
+		To:        to,
+		Candidate: candidate,
+	})
+}
+
+// Bye ends the call with the session to.
+func (c *Client) Bye(to string, reason interface{}) error {
+	return c.Send("Bye", &channelling.DataBye{
+		Type: "Bye",
+		To:   to,
+		Bye:  reason,
+	})
+}
+
+func (c *Client) send(msgType string, document interface{}, iid string) error {
+	data, err := encodeIncoming(msgType, document, iid)
+	if err != nil {
+		return err
+	}
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+	return c.conn.WriteMessage(websocket.TextMessage, data)
+}
+
+func (c *Client) readLoop() {
+	var err error
+	for {
+		var msg *Message
+		if msg, err = readMessage(c.conn); err != nil {
+			break
+		}
+		c.mutex.Lock()
+		reply, ok := c.pending[msg.Iid]
+		c.mutex.Unlock()
+		if ok && msg.Iid != "" {
+			reply <- msg
+		} else {
+			c.messages <- msg
+		}
+	}
+
+	c.mutex.Lock()
+	c.err = err
+	for iid, reply := range c.pending {
+		close(reply)
+		delete(c.pending, iid)
+	}
+	c.mutex.Unlock()
+	close(c.messages)
+}
+
+// encodeIncoming wraps document in its own type, as the server expects.
+func encodeIncoming(msgType string, document interface{}, iid string) ([]byte, error) {
+	wrapper := map[string]interface{}{
+		"Type":  msgType,
+		msgType: document,
+	}
+	if iid != "" {
+		wrapper["Iid"] = iid
+	}
+	return json.Marshal(wrapper)
+}
+
+func readMessage(conn Transport) (*Message, error) {
+	_, data, err := conn.ReadMessage()
+	if err != nil {
+		return nil, err
+	}
+	msg := &Message{}
+	if err := json.Unmarshal(data, msg); err != nil {
+		return nil, err
+	}
+	msg.Type = documentType(msg.Data)
+	return msg, nil
+}
+
+// documentType returns the Type of a received document.
+func documentType(data json.RawMessage) string {
+	var document struct {
+		Type string
+	}
+	if len(data) > 0 {
+		json.Unmarshal(data, &document)
+	}
+	return document.Type
+}
@@ -0,0 +1,224 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package client
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/strukturag/spreed-webrtc/go/channelling"
+)
+
+// fakeTransport plays the server side of a connection.
+type fakeTransport struct {
+	incoming chan []byte
+	outgoing chan map[string]interface{}
+	closed   chan struct{}
+}
+
+func newFakeTransport() *fakeTransport {
+	return &fakeTransport{
+		incoming: make(chan []byte, 10),
+		outgoing: make(chan map[string]interface{}, 10),
+		closed:   make(chan struct{}),
+	}
+}
+
+func (fake *fakeTransport) ReadMessage() (int, []byte, error) {
+	select {
+	case data := <-fake.incoming:
+		return 1, data, nil
+	case <-fake.closed:
+		return 0, nil, io.EOF
+	}
+}
+
+func (fake *fakeTransport) WriteMessage(messageType int, data []byte) error {
+	var msg map[string]interface{}
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return err
+	}
+	fake.outgoing <- msg
+	return nil
+}
+
+func (fake *fakeTransport) Close() error {
+	select {
+	case <-fake.closed:
+	default:
+		close(fake.closed)
+	}
+	return nil
+}
+
+func (fake *fakeTransport) reply(iid string, data interface{}) {
+	b, _ := json.Marshal(&channelling.DataOutgoing{From: "server", Iid: iid, Data: data})
+	fake.incoming <- b
+}
+
+func newTestClient(t *testing.T) (*Client, *fakeTransport) {
+	fake := newFakeTransport()
+	fake.reply("", &channelling.DataSelf{Type: "Self", Id: "a", Version: "1.2.3"})
+	c, err := New(fake)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Timeout = time.Second
+	return c, fake
+}
+
+func Test_Client_RequiresSelf(t *testing.T) {
+	fake := newFakeTransport()
+	fake.reply("", &channelling.DataError{Type: "Error", Code: "session_invalid", Message: "Invalid session"})
+	if _, err := New(fake); err == nil || err.(*channelling.DataError).Code != "session_invalid" {
+		t.Errorf("Expected the error of the server, but got %v", err)
+	}
+}
+
+func Test_Client_HelloMatchesReplies(t *testing.T) {
+	c, fake := newTestClient(t)
+	defer c.Close()
+	if c.Self().Id != "a" {
+		t.Errorf("Unexpected Self %+v", c.Self())
+	}
+
+	go func() {
+		hello := <-fake.outgoing
+		fake.reply("", &channelling.DataChat{Type: "Chat", Chat: &channelling.DataChatMessage{Message: "unrelated"}})
+		document := hello["Hello"].(map[string]interface{})
+		if hello["Type"] != "Hello" || document["Name"] != "lobby" || document["Version"] != "1.2.3" {
+			t.Errorf("Unexpected Hello %v", hello)
+		}
+		fake.reply(hello["Iid"].(string), &channelling.DataWelcome{Type: "Welcome", Room: &channelling.DataRoom{Name: "lobby"}})
+	}()
+	welcome, err := c.Join("lobby", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if welcome.Room.Name != "lobby" {
+		t.Errorf("Unexpected Welcome %+v", welcome)
+	}
+
+	msg := <-c.Messages()
+	var chat channelling.DataChat
+	if err := msg.Decode(&chat); err != nil || msg.Type != "Chat" || chat.Chat.Message != "unrelated" {
+		t.Errorf("Unexpected message %+v (%v)", msg, err)
+	}
+}
+
+func Test_Client_RequestReturnsErrors(t *testing.T) {
+	c, fake := newTestClient(t)
+	defer c.Close()
+
+	go func() {
+		hello := <-fake.outgoing
+		fake.reply(hello["Iid"].(string), &channelling.DataError{Type: "Error", Code: "authorization_required", Message: "Room requires authorization"})
+	}()
+	if _, err := c.Join("locked", "", nil); err == nil || err.(*channelling.DataError).Code != "authorization_required" {
+		t.Errorf("Expected the error of the server, but got %v", err)
+	}
+}
+
+func Test_Client_ClosedConnectionFailsRequests(t *testing.T) {
+	c, fake := newTestClient(t)
+
+	go func() {
+		<-fake.outgoing
+		fake.Close()
+	}()
+	if _, err := c.Join("lobby", "", nil); err != ErrClosed {
+		t.Errorf("Expected ErrClosed, but got %v", err)
+	}
+	if _, ok := <-c.Messages(); ok {
+		t.Error("Expected messages to be closed")
+	}
+	if c.Err() != io.EOF {
+		t.Errorf("Expected the read error, but got %v", c.Err())
+	}
+}
+
+func Test_Client_SendsWrappedDocuments(t *testing.T) {
+	c, fake := newTestClient(t)
+	defer c.Close()
+
+	if err := c.Chat("b", "hi"); err != nil {
+		t.Fatal(err)
+	}
+	msg := <-fake.outgoing
+	chat := msg["Chat"].(map[string]interface{})
+	if msg["Type"] != "Chat" || msg["Iid"] != nil || chat["To"] != "b" || chat["Chat"].(map[string]interface{})["Message"] != "hi" {
+		t.Errorf("Unexpected Chat %v", msg)
+	}
+
+	if err := c.Call("b", map[string]interface{}{"type": "offer", "sdp": "v=0"}); err != nil {
+		t.Fatal(err)
+	}
+	msg = <-fake.outgoing
+	if msg["Type"] != "Offer" || msg["Offer"].(map[string]interface{})["To"] != "b" {
+		t.Errorf("Unexpected Offer %v", msg)
+	}
+}
+
+func Test_Pipelines_FeedAndSend(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/pipelines/call.a.b" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		switch r.Method {
+		case "GET":
+			if r.URL.Query().Get("since") != "1" {
+				t.Errorf("Unexpected query %s", r.URL.RawQuery)
+			}
+			w.Write([]byte(`{"Seq":1,"Msg":{"From":"a","Data":{"Type":"Chat"}}}` + "\n" + `{"Seq":2,"Msg":{"From":"b","Data":{"Type":"Bye"}}}` + "\n"))
+		case "POST":
+			var incoming channelling.DataIncoming
+			json.NewDecoder(r.Body).Decode(&incoming)
+			if incoming.Type != "Chat" || incoming.Chat == nil {
+				t.Errorf("Unexpected incoming %+v", incoming)
+			}
+			json.NewEncoder(w).Encode(&channelling.DataOutgoing{From: "a", Data: &channelling.DataError{Type: "Error", Code: "chat_rejected"}})
+		}
+	}))
+	defer server.Close()
+
+	pipelines := NewPipelines(server.URL+"/api/v1/", nil)
+	lines, err := pipelines.Feed("call.a.b", 1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lines) != 2 || lines[0].Seq != 1 || lines[1].Msg.From != "b" {
+		t.Errorf("Unexpected feed %+v", lines)
+	}
+
+	_, err = pipelines.Send("call.a.b", "Chat", &channelling.DataChat{Type: "Chat", Chat: &channelling.DataChatMessage{Message: "hi"}})
+	if dataError, ok := err.(*channelling.DataError); !ok || dataError.Code != "chat_rejected" {
+		t.Errorf("Expected the error of the server, but got %v", err)
+	}
+	if _, err := pipelines.Feed("unknown", 0, 0); err == nil {
+		t.Error("Expected an error for unknown pipelines")
+	}
+}
@@ -0,0 +1,117 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/strukturag/spreed-webrtc/go/channelling"
+)
+
+// Pipelines uses the pipelines REST API of a server to read the messages
+// sent through a pipeline and to send messages into it.
+type Pipelines struct {
+	baseURL string
+	client  *http.Client
+}
+
+// NewPipelines creates Pipelines for the REST API at baseURL, e.g.
+// https://example.com/api/v1.
+func NewPipelines(baseURL string, client *http.Client) *Pipelines {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &Pipelines{strings.TrimRight(baseURL, "/"), client}
+}
+
+// Feed returns up to limit messages of the pipeline id, starting with the
+// sequence number since. A limit of 0 returns all messages.
+func (pipelines *Pipelines) Feed(id string, since, limit int) ([]*channelling.PipelineFeedLine, error) {
+	query := url.Values{}
+	query.Set("since", strconv.Itoa(since))
+	query.Set("limit", strconv.Itoa(limit))
+	response, err := pipelines.client.Get(pipelines.url(id) + "?" + query.Encode())
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("client: pipeline feed failed with status %d", response.StatusCode)
+	}
+
+	var lines []*channelling.PipelineFeedLine
+	reader := bufio.NewReader(response.Body)
+	for {
+		data, err := reader.ReadBytes('\n')
+		if len(bytes.TrimSpace(data)) > 0 {
+			line := &channelling.PipelineFeedLine{}
+			if err := json.Unmarshal(data, line); err != nil {
+				return nil, err
+			}
+			lines = append(lines, line)
+		}
+		if err == io.EOF {
+			return lines, nil
+		} else if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// Send sends document of msgType into the pipeline id, as if the receiving
+// session of the pipeline sent it, and returns the reply.
+func (pipelines *Pipelines) Send(id, msgType string, document interface{}) (*Message, error) {
+	data, err := encodeIncoming(msgType, document, "")
+	if err != nil {
+		return nil, err
+	}
+	response, err := pipelines.client.Post(pipelines.url(id), "application/json", bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("client: pipeline send failed with status %d", response.StatusCode)
+	}
+
+	msg := &Message{}
+	if err := json.NewDecoder(response.Body).Decode(msg); err != nil {
+		return nil, err
+	}
+	msg.Type = documentType(msg.Data)
+	if err := msg.Error(); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+func (pipelines *Pipelines) url(id string) string {
+	return pipelines.baseURL + "/pipelines/" + strings.Replace(url.QueryEscape(id), "+", "%20", -1)
+}
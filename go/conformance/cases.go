@@ -0,0 +1,287 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package conformance
+
+import (
+	"fmt"
+
+	"github.com/strukturag/spreed-webrtc/go/channelling"
+	"github.com/strukturag/spreed-webrtc/go/client"
+)
+
+// Cases are the protocol flows in the order of the channeling API
+// documentation.
+var Cases = []*Case{
+	&Case{Name: "self", Description: "The server sends Self with the session of a new connection.", Run: testSelf},
+	&Case{Name: "hello", Description: "Hello joins a room and is answered with Welcome.", Run: testHello},
+	&Case{Name: "join", Description: "Sessions in a room receive Joined when another session joins.", Run: testJoin},
+	&Case{Name: "offer-answer", Description: "Offer, Answer and Candidate are delivered to the peer.", Run: testOfferAnswer},
+	&Case{Name: "conference", Description: "Conference is delivered to the listed sessions.", Run: testConference},
+	&Case{Name: "bye", Description: "Bye is delivered to the peer.", Run: testBye},
+	&Case{Name: "chat", Description: "Room and private chat messages are delivered and confirmed.", Run: testChat},
+	&Case{Name: "leave", Description: "Sessions in a room receive Left when another session disconnects.", Run: testLeave},
+}
+
+// Filter returns the cases whose names are in names, or all cases if names
+// is empty.
+func Filter(cases []*Case, names []string) ([]*Case, error) {
+	if len(names) == 0 {
+		return cases, nil
+	}
+	var filtered []*Case
+	for _, name := range names {
+		found := false
+		for _, c := range cases {
+			if c.Name == name {
+				filtered = append(filtered, c)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown case %s", name)
+		}
+	}
+	return filtered, nil
+}
+
+func from(id string) func(*client.Message) bool {
+	return func(msg *client.Message) bool {
+		return msg.From == id
+	}
+}
+
+func session(id string) func(*client.Message) bool {
+	return func(msg *client.Message) bool {
+		data := &channelling.DataSession{}
+		return msg.Decode(data) == nil && data.Id == id
+	}
+}
+
+func testSelf(env *Env) error {
+	c, err := env.Connect()
+	if err != nil {
+		return err
+	}
+	self := c.Self()
+	switch {
+	case self.Id == "":
+		return fmt.Errorf("Self has no Id")
+	case self.Sid == "":
+		return fmt.Errorf("Self has no Sid")
+	case self.Token == "":
+		return fmt.Errorf("Self has no Token")
+	case self.ApiVersion == 0:
+		return fmt.Errorf("Self has no ApiVersion")
+	}
+	return nil
+}
+
+func testHello(env *Env) error {
+	c, err := env.Connect()
+	if err != nil {
+		return err
+	}
+	welcome, err := c.Join(env.Room, "", nil)
+	if err != nil {
+		return fmt.Errorf("hello: %s", err)
+	}
+	if welcome.Room == nil || welcome.Room.Name != env.Room {
+		return fmt.Errorf("Welcome is for room %v instead of %s", welcome.Room, env.Room)
+	}
+	return nil
+}
+
+func testJoin(env *Env) error {
+	a, err := env.Join()
+	if err != nil {
+		return err
+	}
+	b, err := env.Join()
+	if err != nil {
+		return err
+	}
+	_, err = env.Expect(a, "Joined", session(b.Self().Id))
+	return err
+}
+
+func testOfferAnswer(env *Env) error {
+	a, err := env.Join()
+	if err != nil {
+		return err
+	}
+	b, err := env.Join()
+	if err != nil {
+		return err
+	}
+	aID, bID := a.Self().Id, b.Self().Id
+
+	if err := a.Call(bID, map[string]interface{}{"type": "offer", "sdp": "conformance-offer"}); err != nil {
+		return err
+	}
+	msg, err := env.Expect(b, "Offer", from(aID))
+	if err != nil {
+		return err
+	}
+	offer := &channelling.DataOffer{}
+	if err := msg.Decode(offer); err != nil {
+		return err
+	}
+	if offer.Offer["sdp"] != "conformance-offer" {
+		return fmt.Errorf("Offer has sdp %v", offer.Offer["sdp"])
+	}
+
+	if err := b.Answer(aID, map[string]interface{}{"type": "answer", "sdp": "conformance-answer"}); err != nil {
+		return err
+	}
+	msg, err = env.Expect(a, "Answer", from(bID))
+	if err != nil {
+		return err
+	}
+	answer := &channelling.DataAnswer{}
+	if err := msg.Decode(answer); err != nil {
+		return err
+	}
+	if answer.Answer["sdp"] != "conformance-answer" {
+		return fmt.Errorf("Answer has sdp %v", answer.Answer["sdp"])
+	}
+
+	if err := a.Candidate(bID, map[string]interface{}{"candidate": "conformance-candidate"}); err != nil {
+		return err
+	}
+	_, err = env.Expect(b, "Candidate", from(aID))
+	return err
+}
+
+func testConference(env *Env) error {
+	a, err := env.Join()
+	if err != nil {
+		return err
+	}
+	b, err := env.Join()
+	if err != nil {
+		return err
+	}
+	c, err := env.Join()
+	if err != nil {
+		return err
+	}
+	aID := a.Self().Id
+	conference := &channelling.DataConference{
+		Type:       "Conference",
+		Conference: []string{aID, b.Self().Id, c.Self().Id},
+	}
+	if err := a.Send("Conference", conference); err != nil {
+		return err
+	}
+	for _, peer := range []*client.Client{b, c} {
+		msg, err := env.Expect(peer, "Conference", from(aID))
+		if err != nil {
+			return err
+		}
+		received := &channelling.DataConference{}
+		if err := msg.Decode(received); err != nil {
+			return err
+		}
+		if len(received.Conference) != len(conference.Conference) {
+			return fmt.Errorf("Conference lists %v instead of %v", received.Conference, conference.Conference)
+		}
+	}
+	return nil
+}
+
+func testBye(env *Env) error {
+	a, err := env.Join()
+	if err != nil {
+		return err
+	}
+	b, err := env.Join()
+	if err != nil {
+		return err
+	}
+	if err := a.Bye(b.Self().Id, nil); err != nil {
+		return err
+	}
+	_, err = env.Expect(b, "Bye", from(a.Self().Id))
+	return err
+}
+
+func testChat(env *Env) error {
+	a, err := env.Join()
+	if err != nil {
+		return err
+	}
+	b, err := env.Join()
+	if err != nil {
+		return err
+	}
+	aID, bID := a.Self().Id, b.Self().Id
+	message := func(text string) func(*client.Message) bool {
+		return func(msg *client.Message) bool {
+			chat := &channelling.DataChat{}
+			return msg.From == aID && msg.Decode(chat) == nil && chat.Chat != nil && chat.Chat.Message == text
+		}
+	}
+
+	if err := a.Chat("", "conformance room chat"); err != nil {
+		return err
+	}
+	if _, err := env.Expect(b, "Chat", message("conformance room chat")); err != nil {
+		return fmt.Errorf("room chat: %s", err)
+	}
+
+	private := &channelling.DataChat{
+		To:   bID,
+		Type: "Chat",
+		Chat: &channelling.DataChatMessage{Message: "conformance private chat", Mid: "conformance"},
+	}
+	if err := a.Send("Chat", private); err != nil {
+		return err
+	}
+	if _, err := env.Expect(b, "Chat", message("conformance private chat")); err != nil {
+		return fmt.Errorf("private chat: %s", err)
+	}
+	_, err = env.Expect(a, "Chat", func(msg *client.Message) bool {
+		chat := &channelling.DataChat{}
+		return msg.Decode(chat) == nil && chat.Chat != nil && chat.Chat.Mid == "conformance" &&
+			chat.Chat.Status != nil && chat.Chat.Status.State == "sent"
+	})
+	if err != nil {
+		return fmt.Errorf("delivery confirmation: %s", err)
+	}
+	return nil
+}
+
+func testLeave(env *Env) error {
+	a, err := env.Join()
+	if err != nil {
+		return err
+	}
+	b, err := env.Join()
+	if err != nil {
+		return err
+	}
+	bID := b.Self().Id
+	b.Close()
+	_, err = env.Expect(a, "Left", session(bID))
+	return err
+}
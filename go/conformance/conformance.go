@@ -0,0 +1,146 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+// Package conformance drives a running server through the flows documented
+// in the channeling API (hello, join, offer/answer, conference, bye, chat)
+// and reports which of them behave as documented.
+package conformance
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/strukturag/spreed-webrtc/go/client"
+)
+
+// DefaultTimeout is the time to wait for every expected document.
+const DefaultTimeout = 5 * time.Second
+
+// A Dialer connects a new client to the server under test.
+type Dialer func() (*client.Client, error)
+
+// A Case is one protocol flow.
+type Case struct {
+	Name        string
+	Description string
+	Run         func(env *Env) error
+}
+
+// A Result is the outcome of a Case.
+type Result struct {
+	Name     string
+	Passed   bool
+	Err      error
+	Duration time.Duration
+}
+
+// Env provides the clients of a Case. Every Case runs in a room of its own.
+type Env struct {
+	Room    string
+	Timeout time.Duration
+	dial    Dialer
+	clients []*client.Client
+}
+
+// Connect connects a new client, which is closed when the Case ends.
+func (env *Env) Connect() (*client.Client, error) {
+	c, err := env.dial()
+	if err != nil {
+		return nil, fmt.Errorf("connect: %s", err)
+	}
+	c.Timeout = env.Timeout
+	env.clients = append(env.clients, c)
+	return c, nil
+}
+
+// Join connects a new client and joins the room of the Case.
+func (env *Env) Join() (*client.Client, error) {
+	c, err := env.Connect()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := c.Join(env.Room, "", nil); err != nil {
+		return nil, fmt.Errorf("join %s: %s", env.Room, err)
+	}
+	return c, nil
+}
+
+// Expect waits for a document of msgType received by c for which match
+// returns true, skipping all other documents. A nil match accepts any
+// document of msgType.
+func (env *Env) Expect(c *client.Client, msgType string, match func(*client.Message) bool) (*client.Message, error) {
+	timeout := time.After(env.Timeout)
+	for {
+		select {
+		case msg, ok := <-c.Messages():
+			if !ok {
+				return nil, fmt.Errorf("connection closed while waiting for %s", msgType)
+			}
+			if msg.Type == msgType && (match == nil || match(msg)) {
+				return msg, nil
+			}
+		case <-timeout:
+			return nil, fmt.Errorf("no %s received within %s", msgType, env.Timeout)
+		}
+	}
+}
+
+func (env *Env) close() {
+	for _, c := range env.clients {
+		c.Close()
+	}
+}
+
+// Run runs cases one after the other against the server of dial and calls
+// report, if not nil, with every result.
+func Run(dial Dialer, cases []*Case, timeout time.Duration, report func(*Result)) []*Result {
+	results := make([]*Result, 0, len(cases))
+	for _, c := range cases {
+		env := &Env{
+			Room:    fmt.Sprintf("conformance-%s-%d", c.Name, time.Now().UnixNano()),
+			Timeout: timeout,
+			dial:    dial,
+		}
+		started := time.Now()
+		err := runCase(c, env)
+		env.close()
+		result := &Result{
+			Name:     c.Name,
+			Passed:   err == nil,
+			Err:      err,
+			Duration: time.Since(started),
+		}
+		if report != nil {
+			report(result)
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+func runCase(c *Case, env *Env) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return c.Run(env)
+}
@@ -0,0 +1,158 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package conformance
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/strukturag/spreed-webrtc/go/channelling"
+	"github.com/strukturag/spreed-webrtc/go/client"
+)
+
+// fakeTransport sends the given documents and then blocks until closed.
+type fakeTransport struct {
+	incoming chan []byte
+	closed   chan struct{}
+}
+
+func newFakeTransport(documents ...interface{}) *fakeTransport {
+	fake := &fakeTransport{
+		incoming: make(chan []byte, len(documents)),
+		closed:   make(chan struct{}),
+	}
+	for _, document := range documents {
+		b, _ := json.Marshal(&channelling.DataOutgoing{From: "server", Data: document})
+		fake.incoming <- b
+	}
+	return fake
+}
+
+func (fake *fakeTransport) ReadMessage() (int, []byte, error) {
+	select {
+	case data := <-fake.incoming:
+		return 1, data, nil
+	case <-fake.closed:
+		return 0, nil, io.EOF
+	}
+}
+
+func (fake *fakeTransport) WriteMessage(messageType int, data []byte) error {
+	return nil
+}
+
+func (fake *fakeTransport) Close() error {
+	select {
+	case <-fake.closed:
+	default:
+		close(fake.closed)
+	}
+	return nil
+}
+
+func Test_Run_ReportsResults(t *testing.T) {
+	cases := []*Case{
+		&Case{Name: "pass", Run: func(env *Env) error { return nil }},
+		&Case{Name: "fail", Run: func(env *Env) error { return errors.New("failed") }},
+		&Case{Name: "panic", Run: func(env *Env) error { panic("boom") }},
+	}
+	var reported []string
+	results := Run(nil, cases, time.Second, func(result *Result) {
+		reported = append(reported, result.Name)
+	})
+	if len(results) != 3 || len(reported) != 3 {
+		t.Fatalf("Expected 3 results, but got %d (%d reported)", len(results), len(reported))
+	}
+	if !results[0].Passed || results[0].Err != nil {
+		t.Errorf("Expected pass to pass, but got %v", results[0].Err)
+	}
+	if results[1].Passed || results[1].Err == nil || results[1].Err.Error() != "failed" {
+		t.Errorf("Expected fail to fail, but got %v", results[1].Err)
+	}
+	if results[2].Passed || results[2].Err == nil {
+		t.Error("Expected panic to fail")
+	}
+}
+
+func Test_Run_UsesRoomPerCase(t *testing.T) {
+	var rooms []string
+	record := func(env *Env) error {
+		rooms = append(rooms, env.Room)
+		return nil
+	}
+	Run(nil, []*Case{&Case{Name: "a", Run: record}, &Case{Name: "b", Run: record}}, time.Second, nil)
+	if len(rooms) != 2 || rooms[0] == rooms[1] {
+		t.Errorf("Expected distinct rooms, but got %v", rooms)
+	}
+}
+
+func Test_Env_Expect(t *testing.T) {
+	fake := newFakeTransport(
+		&channelling.DataSelf{Type: "Self", Id: "a"},
+		&channelling.DataSession{Type: "Joined", Id: "c"},
+		&channelling.DataSession{Type: "Joined", Id: "b"},
+	)
+	cases := []*Case{&Case{Name: "expect", Run: func(env *Env) error {
+		c, err := env.Connect()
+		if err != nil {
+			return err
+		}
+		if _, err := env.Expect(c, "Joined", session("b")); err != nil {
+			return err
+		}
+		if _, err := env.Expect(c, "Left", nil); err == nil {
+			return errors.New("expected timeout")
+		}
+		return nil
+	}}}
+	dial := func() (*client.Client, error) {
+		return client.New(fake)
+	}
+	results := Run(dial, cases, 50*time.Millisecond, nil)
+	if !results[0].Passed {
+		t.Errorf("Expected expect to pass, but got %v", results[0].Err)
+	}
+	select {
+	case <-fake.closed:
+	default:
+		t.Error("Expected the client to be closed")
+	}
+}
+
+func Test_Filter(t *testing.T) {
+	cases, err := Filter(Cases, []string{"chat", "hello"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cases) != 2 || cases[0].Name != "chat" || cases[1].Name != "hello" {
+		t.Errorf("Unexpected cases %v", cases)
+	}
+	if _, err := Filter(Cases, []string{"unknown"}); err == nil {
+		t.Error("Expected an error for an unknown case")
+	}
+	if cases, _ := Filter(Cases, nil); len(cases) != len(Cases) {
+		t.Error("Expected all cases without names")
+	}
+}
@@ -0,0 +1,264 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+// Package envelope implements envelope encryption for secrets which are
+// stored at rest. Every value is encrypted with its own random data key,
+// which is wrapped with a master key. Master keys can be rotated by
+// rewrapping the data keys, without touching the encrypted values.
+package envelope
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Prefix marks sealed values.
+const Prefix = "env1:"
+
+const dataKeySize = 32
+
+var (
+	ErrNotSealed  = errors.New("envelope: value is not sealed")
+	ErrUnknownKey = errors.New("envelope: unknown master key")
+	ErrInvalid    = errors.New("envelope: invalid sealed value")
+)
+
+// A KeyWrapper wraps and unwraps data keys with a master key. Master keys
+// might be local or held by a key management service.
+type KeyWrapper interface {
+	KeyID() string
+	WrapKey(key []byte) ([]byte, error)
+	UnwrapKey(wrapped []byte) ([]byte, error)
+}
+
+type masterKey struct {
+	id   string
+	aead cipher.AEAD
+}
+
+// NewMasterKey returns a KeyWrapper using AES-GCM with a local key of 16,
+// 24 or 32 bytes.
+func NewMasterKey(id string, key []byte) (KeyWrapper, error) {
+	if id == "" || strings.Contains(id, ":") {
+		return nil, fmt.Errorf("envelope: invalid master key id '%s'", id)
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	return &masterKey{id, aead}, nil
+}
+
+func (mk *masterKey) KeyID() string {
+	return mk.id
+}
+
+func (mk *masterKey) WrapKey(key []byte) ([]byte, error) {
+	return seal(mk.aead, key, []byte(mk.id))
+}
+
+func (mk *masterKey) UnwrapKey(wrapped []byte) ([]byte, error) {
+	return open(mk.aead, wrapped, []byte(mk.id))
+}
+
+// A Keyring seals values with its current master key and opens values
+// sealed with any of its master keys.
+type Keyring struct {
+	current KeyWrapper
+	keys    map[string]KeyWrapper
+}
+
+// NewKeyring creates a Keyring with current as master key for new values
+// and previous keys which are only used to open existing values.
+func NewKeyring(current KeyWrapper, previous ...KeyWrapper) *Keyring {
+	keyring := &Keyring{
+		current: current,
+		keys:    map[string]KeyWrapper{current.KeyID(): current},
+	}
+	for _, key := range previous {
+		keyring.keys[key.KeyID()] = key
+	}
+	return keyring
+}
+
+// LoadKeyring reads master keys from a file with one "id hexkey" pair per
+// line. The first key is the current key. Empty lines and lines starting
+// with # are ignored.
+func LoadKeyring(fn string) (*Keyring, error) {
+	f, err := os.Open(fn)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var keys []KeyWrapper
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("envelope: invalid line in %s", fn)
+		}
+		secret, err := hex.DecodeString(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("envelope: key %s is not hex encoded", fields[0])
+		}
+		key, err := NewMasterKey(fields[0], secret)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("envelope: no keys in %s", fn)
+	}
+	return NewKeyring(keys[0], keys[1:]...), nil
+}
+
+// IsSealed returns true if value looks like a sealed value.
+func IsSealed(value string) bool {
+	return strings.HasPrefix(value, Prefix)
+}
+
+// Seal encrypts plaintext with a new data key wrapped by the current
+// master key.
+func (keyring *Keyring) Seal(plaintext []byte) (string, error) {
+	dataKey := make([]byte, dataKeySize)
+	if _, err := io.ReadFull(rand.Reader, dataKey); err != nil {
+		return "", err
+	}
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return "", err
+	}
+	ciphertext, err := seal(aead, plaintext, nil)
+	if err != nil {
+		return "", err
+	}
+	return keyring.wrap(dataKey, ciphertext)
+}
+
+// Open decrypts a value created by Seal.
+func (keyring *Keyring) Open(sealed string) ([]byte, error) {
+	dataKey, ciphertext, err := keyring.unwrap(sealed)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	return open(aead, ciphertext, nil)
+}
+
+// Rewrap wraps the data key of sealed with the current master key. The
+// encrypted value itself stays unchanged.
+func (keyring *Keyring) Rewrap(sealed string) (string, error) {
+	dataKey, ciphertext, err := keyring.unwrap(sealed)
+	if err != nil {
+		return "", err
+	}
+	return keyring.wrap(dataKey, ciphertext)
+}
+
+// NeedsRewrap returns true if sealed was not wrapped with the current
+// master key.
+func (keyring *Keyring) NeedsRewrap(sealed string) bool {
+	parts := strings.SplitN(strings.TrimPrefix(sealed, Prefix), ":", 2)
+	return parts[0] != keyring.current.KeyID()
+}
+
+func (keyring *Keyring) wrap(dataKey, ciphertext []byte) (string, error) {
+	wrapped, err := keyring.current.WrapKey(dataKey)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s%s:%s:%s", Prefix, keyring.current.KeyID(),
+		base64.RawURLEncoding.EncodeToString(wrapped),
+		base64.RawURLEncoding.EncodeToString(ciphertext)), nil
+}
+
+func (keyring *Keyring) unwrap(sealed string) (dataKey, ciphertext []byte, err error) {
+	if !IsSealed(sealed) {
+		return nil, nil, ErrNotSealed
+	}
+	parts := strings.Split(strings.TrimPrefix(sealed, Prefix), ":")
+	if len(parts) != 3 {
+		return nil, nil, ErrInvalid
+	}
+	key, ok := keyring.keys[parts[0]]
+	if !ok {
+		return nil, nil, ErrUnknownKey
+	}
+	wrapped, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, nil, ErrInvalid
+	}
+	if ciphertext, err = base64.RawURLEncoding.DecodeString(parts[2]); err != nil {
+		return nil, nil, ErrInvalid
+	}
+	if dataKey, err = key.UnwrapKey(wrapped); err != nil {
+		return nil, nil, err
+	}
+	return dataKey, ciphertext, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func seal(aead cipher.AEAD, plaintext, additional []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext, additional), nil
+}
+
+func open(aead cipher.AEAD, ciphertext, additional []byte) ([]byte, error) {
+	if len(ciphertext) < aead.NonceSize() {
+		return nil, ErrInvalid
+	}
+	plaintext, err := aead.Open(nil, ciphertext[:aead.NonceSize()], ciphertext[aead.NonceSize():], additional)
+	if err != nil {
+		return nil, ErrInvalid
+	}
+	return plaintext, nil
+}
@@ -0,0 +1,83 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package envelope
+
+import (
+	"bytes"
+	"testing"
+)
+
+func newTestKey(t *testing.T, id string) KeyWrapper {
+	key, err := NewMasterKey(id, bytes.Repeat([]byte(id[:1]), 32))
+	if err != nil {
+		t.Fatalf("Could not create master key: %v", err)
+	}
+	return key
+}
+
+func Test_SealOpen(t *testing.T) {
+	keyring := NewKeyring(newTestKey(t, "a"))
+	sealed, err := keyring.Seal([]byte("top secret"))
+	if err != nil {
+		t.Fatalf("Could not seal: %v", err)
+	}
+	if !IsSealed(sealed) {
+		t.Errorf("Sealed value %s has no prefix", sealed)
+	}
+
+	plaintext, err := keyring.Open(sealed)
+	if err != nil {
+		t.Fatalf("Could not open %s: %v", sealed, err)
+	}
+	if string(plaintext) != "top secret" {
+		t.Errorf("Opened value %s does not match", plaintext)
+	}
+
+	if _, err := keyring.Open(sealed[:len(sealed)-2]); err == nil {
+		t.Error("Opening a modified value should fail")
+	}
+	if _, err := NewKeyring(newTestKey(t, "b")).Open(sealed); err != ErrUnknownKey {
+		t.Errorf("Expected unknown key error, but got %v", err)
+	}
+}
+
+func Test_Rewrap(t *testing.T) {
+	old := NewKeyring(newTestKey(t, "a"))
+	sealed, _ := old.Seal([]byte("top secret"))
+
+	rotated := NewKeyring(newTestKey(t, "b"), newTestKey(t, "a"))
+	if !rotated.NeedsRewrap(sealed) {
+		t.Fatalf("Value %s should need rewrap", sealed)
+	}
+	rewrapped, err := rotated.Rewrap(sealed)
+	if err != nil {
+		t.Fatalf("Could not rewrap: %v", err)
+	}
+	if rotated.NeedsRewrap(rewrapped) {
+		t.Errorf("Rewrapped value %s should use the current key", rewrapped)
+	}
+
+	plaintext, err := NewKeyring(newTestKey(t, "b")).Open(rewrapped)
+	if err != nil || string(plaintext) != "top secret" {
+		t.Errorf("Could not open rewrapped value without old key: %v", err)
+	}
+}
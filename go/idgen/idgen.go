@@ -0,0 +1,146 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+// Package idgen creates identifiers which sort by their creation time, so
+// logs, call records and database indexes are time-ordered. The random
+// part makes identifiers created on different nodes in the same
+// millisecond collision resistant.
+package idgen
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"time"
+)
+
+const (
+	// SchemeRandom keeps the random identifiers of the server.
+	SchemeRandom = "random"
+	// SchemeULID creates ULIDs, 26 characters of Crockford's base32 with a
+	// 48 bit millisecond timestamp and 80 random bits.
+	SchemeULID = "ulid"
+	// SchemeUUIDv7 creates version 7 UUIDs with a 48 bit millisecond
+	// timestamp and 74 random bits.
+	SchemeUUIDv7 = "uuidv7"
+)
+
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// A Generator returns a new identifier on every call.
+type Generator func() string
+
+// New returns the generator for scheme. It returns nil for SchemeRandom and
+// the empty scheme, callers then keep their random identifiers.
+func New(scheme string) (Generator, error) {
+	switch scheme {
+	case "", SchemeRandom:
+		return nil, nil
+	case SchemeULID:
+		return func() string { return NewULID(time.Now()) }, nil
+	case SchemeUUIDv7:
+		return func() string { return NewUUIDv7(time.Now()) }, nil
+	}
+	return nil, fmt.Errorf("unknown id scheme %s", scheme)
+}
+
+// NewULID returns a ULID for t.
+func NewULID(t time.Time) string {
+	var b [16]byte
+	putMillis(b[:6], t)
+	readRandom(b[6:])
+
+	// 128 bits are encoded as 26 characters of 5 bits, the first
+	// character holds the 3 most significant bits.
+	var out [26]byte
+	bits, n := uint(0), uint(2)
+	for i, j := 0, 0; j < len(out); {
+		if n < 5 && i < len(b) {
+			bits = bits<<8 | uint(b[i])
+			i++
+			n += 8
+		}
+		n -= 5
+		out[j] = crockford[(bits>>n)&31]
+		j++
+	}
+	return string(out[:])
+}
+
+// NewUUIDv7 returns a version 7 UUID for t.
+func NewUUIDv7(t time.Time) string {
+	var b [16]byte
+	putMillis(b[:6], t)
+	readRandom(b[6:])
+	b[6] = 0x70 | b[6]&0x0f // Version 7.
+	b[8] = 0x80 | b[8]&0x3f // RFC 4122 variant.
+	s := hex.EncodeToString(b[:])
+	return s[0:8] + "-" + s[8:12] + "-" + s[12:16] + "-" + s[16:20] + "-" + s[20:32]
+}
+
+// Time returns the creation time of a ULID or version 7 UUID.
+func Time(id string) (time.Time, error) {
+	var millis uint64
+	switch len(id) {
+	case 26:
+		for i := 0; i < 10; i++ {
+			v := indexCrockford(id[i])
+			if v < 0 {
+				return time.Time{}, fmt.Errorf("invalid ulid %s", id)
+			}
+			millis = millis<<5 | uint64(v)
+		}
+	case 36:
+		b, err := hex.DecodeString(id[0:8] + id[9:13])
+		if err != nil || id[14] != '7' {
+			return time.Time{}, fmt.Errorf("invalid uuidv7 %s", id)
+		}
+		for _, c := range b {
+			millis = millis<<8 | uint64(c)
+		}
+	default:
+		return time.Time{}, fmt.Errorf("invalid id %s", id)
+	}
+	return time.Unix(int64(millis/1000), int64(millis%1000)*int64(time.Millisecond)), nil
+}
+
+func putMillis(b []byte, t time.Time) {
+	millis := uint64(t.UnixNano() / int64(time.Millisecond))
+	for i := len(b) - 1; i >= 0; i-- {
+		b[i] = byte(millis)
+		millis >>= 8
+	}
+}
+
+func readRandom(b []byte) {
+	if _, err := rand.Read(b); err != nil {
+		panic("idgen: failed to read random bytes: " + err.Error())
+	}
+}
+
+func indexCrockford(c byte) int {
+	for i := 0; i < len(crockford); i++ {
+		if crockford[i] == c {
+			return i
+		}
+	}
+	return -1
+}
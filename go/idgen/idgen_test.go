@@ -0,0 +1,83 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package idgen
+
+import (
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_NewULID_EncodesTime(t *testing.T) {
+	created := time.Unix(0, 1469918176385*int64(time.Millisecond))
+	id := NewULID(created)
+	if len(id) != 26 || !strings.HasPrefix(id, "01ARYZ6S41") {
+		t.Errorf("Unexpected ulid %s", id)
+	}
+	parsed, err := Time(id)
+	if err != nil || !parsed.Equal(created) {
+		t.Errorf("Expected time %s, but got %s (%v)", created, parsed, err)
+	}
+}
+
+func Test_NewUUIDv7_EncodesTime(t *testing.T) {
+	created := time.Unix(0, 1469918176385*int64(time.Millisecond))
+	id := NewUUIDv7(created)
+	if len(id) != 36 || !strings.HasPrefix(id, "01563df3-6481-7") || strings.IndexByte("89ab", id[19]) == -1 {
+		t.Errorf("Unexpected uuid %s", id)
+	}
+	parsed, err := Time(id)
+	if err != nil || !parsed.Equal(created) {
+		t.Errorf("Expected time %s, but got %s (%v)", created, parsed, err)
+	}
+}
+
+func Test_Generators_SortByTime(t *testing.T) {
+	for _, scheme := range []string{SchemeULID, SchemeUUIDv7} {
+		var ids []string
+		now := time.Now()
+		for i := 0; i < 10; i++ {
+			id := NewULID(now.Add(time.Duration(i) * time.Millisecond))
+			if scheme == SchemeUUIDv7 {
+				id = NewUUIDv7(now.Add(time.Duration(i) * time.Millisecond))
+			}
+			ids = append(ids, id)
+		}
+		if !sort.StringsAreSorted(ids) {
+			t.Errorf("Expected %s ids to sort by time, but got %v", scheme, ids)
+		}
+	}
+}
+
+func Test_New(t *testing.T) {
+	if generator, err := New(SchemeRandom); generator != nil || err != nil {
+		t.Error("Expected no generator for the random scheme")
+	}
+	generator, err := New(SchemeULID)
+	if err != nil || generator == nil || generator() == generator() {
+		t.Error("Expected distinct ulids")
+	}
+	if _, err := New("unknown"); err == nil {
+		t.Error("Expected an error for an unknown scheme")
+	}
+}
@@ -0,0 +1,168 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package objectstore
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const diskSignatureKeyName = "objectstore"
+
+// Disk is a Store which keeps objects as files below a directory. It
+// serves its signed URLs itself as http.Handler.
+type Disk struct {
+	dir     string
+	baseURL string
+	secret  []byte
+}
+
+// NewDisk creates a Disk store in dir. Signed URLs start with baseURL, where
+// the Disk must be mounted as handler. Their signatures are created with a
+// key derived from secret, so the secret can be shared with other purposes.
+func NewDisk(dir, baseURL string, secret []byte) (*Disk, error) {
+	if dir == "" {
+		return nil, fmt.Errorf("No directory configured")
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(diskSignatureKeyName))
+	return &Disk{dir, strings.TrimRight(baseURL, "/"), mac.Sum(nil)}, nil
+}
+
+func (store *Disk) path(key string) (string, error) {
+	cleaned := filepath.Clean("/" + key)
+	if key == "" || cleaned != "/"+key {
+		return "", fmt.Errorf("Invalid object key %s", key)
+	}
+	return filepath.Join(store.dir, filepath.FromSlash(cleaned)), nil
+}
+
+// Put writes data to a temporary file which then replaces the object, so
+// readers never see partial objects. Content types are not kept, they are
+// detected from the data when serving.
+func (store *Disk) Put(key, contentType string, data []byte) error {
+	path, err := store.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(path), ".tmp")
+	if err != nil {
+		return err
+	}
+	if _, err = tmp.Write(data); err == nil {
+		err = tmp.Close()
+	} else {
+		tmp.Close()
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
+
+func (store *Disk) Get(key string) ([]byte, error) {
+	path, err := store.path(key)
+	if err != nil {
+		return nil, err
+	}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	return data, err
+}
+
+func (store *Disk) Delete(key string) error {
+	path, err := store.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (store *Disk) SignedURL(key string, expires time.Duration) (string, error) {
+	if store.baseURL == "" {
+		return "", ErrSignedURLsNotSupported
+	}
+	if _, err := store.path(key); err != nil {
+		return "", err
+	}
+	expiry := strconv.FormatInt(time.Now().Add(expires).Unix(), 10)
+	query := url.Values{
+		"expires":   {expiry},
+		"signature": {store.signature(key, expiry)},
+	}
+	return store.baseURL + (&url.URL{Path: "/" + key}).String() + "?" + query.Encode(), nil
+}
+
+func (store *Disk) signature(key, expiry string) string {
+	mac := hmac.New(sha256.New, store.secret)
+	mac.Write([]byte(key + "\n" + expiry))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// ServeHTTP serves objects of signed URLs. The request path is the object
+// key, prefixes in front of it must be stripped.
+func (store *Disk) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	key := strings.TrimPrefix(r.URL.Path, "/")
+	query := r.URL.Query()
+	expiry := query.Get("expires")
+	seconds, err := strconv.ParseInt(expiry, 10, 64)
+	if err != nil || !hmac.Equal([]byte(query.Get("signature")), []byte(store.signature(key, expiry))) {
+		http.Error(w, "Invalid signature", http.StatusForbidden)
+		return
+	}
+	if time.Now().Unix() > seconds {
+		http.Error(w, "Expired", http.StatusForbidden)
+		return
+	}
+	data, err := store.Get(key)
+	if err != nil {
+		http.Error(w, "Unknown object", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Cache-Control", "private, max-age="+strconv.FormatInt(seconds-time.Now().Unix(), 10))
+	http.ServeContent(w, r, key, time.Time{}, bytes.NewReader(data))
+}
@@ -0,0 +1,88 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+// Package objectstore keeps objects like uploaded images, relayed files and
+// exports in memory, on local disk or in an S3 compatible storage, and
+// creates signed URLs to download them directly.
+package objectstore
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrNotFound is returned for keys without object.
+	ErrNotFound = errors.New("object not found")
+	// ErrSignedURLsNotSupported is returned by stores which cannot be
+	// downloaded from directly.
+	ErrSignedURLsNotSupported = errors.New("signed urls are not supported")
+)
+
+// Store keeps objects by key. Keys are slash separated paths.
+type Store interface {
+	Put(key, contentType string, data []byte) error
+	Get(key string) ([]byte, error)
+	Delete(key string) error
+	// SignedURL returns a URL which allows to download the object of key
+	// without further authentication until expires has passed.
+	SignedURL(key string, expires time.Duration) (string, error)
+}
+
+type memory struct {
+	sync.RWMutex
+	objects map[string][]byte
+}
+
+// NewMemory creates a Store which keeps objects in memory. It does not
+// create signed URLs.
+func NewMemory() Store {
+	return &memory{objects: make(map[string][]byte)}
+}
+
+func (store *memory) Put(key, contentType string, data []byte) error {
+	store.Lock()
+	store.objects[key] = data
+	store.Unlock()
+	return nil
+}
+
+func (store *memory) Get(key string) ([]byte, error) {
+	store.RLock()
+	data, ok := store.objects[key]
+	store.RUnlock()
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return data, nil
+}
+
+func (store *memory) Delete(key string) error {
+	store.Lock()
+	delete(store.objects, key)
+	store.Unlock()
+	return nil
+}
+
+func (store *memory) SignedURL(key string, expires time.Duration) (string, error) {
+	return "", ErrSignedURLsNotSupported
+}
@@ -0,0 +1,119 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package objectstore
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_Memory(t *testing.T) {
+	store := NewMemory()
+	if err := store.Put("a/b", "text/plain", []byte("data")); err != nil {
+		t.Fatalf("Failed to put: %v", err)
+	}
+	if data, err := store.Get("a/b"); err != nil || string(data) != "data" {
+		t.Errorf("Unexpected data %q: %v", data, err)
+	}
+	store.Delete("a/b")
+	if _, err := store.Get("a/b"); err != ErrNotFound {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+	if _, err := store.SignedURL("a/b", time.Minute); err != ErrSignedURLsNotSupported {
+		t.Errorf("Expected ErrSignedURLsNotSupported, got %v", err)
+	}
+}
+
+func Test_Disk(t *testing.T) {
+	dir, err := ioutil.TempDir("", "objectstore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	server := httptest.NewServer(nil)
+	defer server.Close()
+	store, err := NewDisk(dir, server.URL+"/objects", []byte("secret"))
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	server.Config.Handler = http.StripPrefix("/objects", store)
+
+	for _, key := range []string{"", "/a", "a/../../b", "a//b"} {
+		if err := store.Put(key, "", []byte("data")); err == nil {
+			t.Errorf("Invalid key %q accepted", key)
+		}
+	}
+	if err := store.Put("exports/room.csv", "text/csv", []byte("a,b\n")); err != nil {
+		t.Fatalf("Failed to put: %v", err)
+	}
+	if data, err := store.Get("exports/room.csv"); err != nil || string(data) != "a,b\n" {
+		t.Errorf("Unexpected data %q: %v", data, err)
+	}
+
+	signed, err := store.SignedURL("exports/room.csv", time.Minute)
+	if err != nil {
+		t.Fatalf("Failed to sign: %v", err)
+	}
+	parsed, _ := url.Parse(signed)
+	expiry := parsed.Query().Get("expires")
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write([]byte("exports/room.csv\n" + expiry))
+	rawSigned := strings.Replace(signed, parsed.Query().Get("signature"), hex.EncodeToString(mac.Sum(nil)), 1)
+	for _, check := range []struct {
+		url    string
+		status int
+	}{
+		{signed, http.StatusOK},
+		{strings.Replace(signed, "room.csv", "other.csv", 1), http.StatusForbidden},
+		{strings.Replace(signed, "expires=", "expires=1", 1), http.StatusForbidden},
+		{rawSigned, http.StatusForbidden},
+	} {
+		response, err := http.Get(check.url)
+		if err != nil {
+			t.Fatalf("Failed to get: %v", err)
+		}
+		body, _ := ioutil.ReadAll(response.Body)
+		response.Body.Close()
+		if response.StatusCode != check.status {
+			t.Errorf("Expected status %d for %s, got %d", check.status, check.url, response.StatusCode)
+		} else if check.status == http.StatusOK && string(body) != "a,b\n" {
+			t.Errorf("Unexpected body %q", body)
+		}
+	}
+
+	if err := store.Delete("exports/room.csv"); err != nil {
+		t.Errorf("Failed to delete: %v", err)
+	}
+	if _, err := store.Get("exports/room.csv"); err != ErrNotFound {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+}
@@ -0,0 +1,236 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package objectstore
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const s3MaxExpires = 7 * 24 * time.Hour
+
+type s3 struct {
+	endpoint  *url.URL
+	region    string
+	bucket    string
+	prefix    string
+	accessKey string
+	secretKey string
+	client    *http.Client
+}
+
+// NewS3 creates a Store which keeps objects below prefix in bucket of an
+// S3 compatible storage like AWS S3 or MinIO at endpoint, e.g.
+// https://s3.eu-central-1.amazonaws.com. Buckets are addressed in the path,
+// requests and signed URLs are signed with AWS signature version 4.
+func NewS3(endpoint, region, bucket, prefix, accessKey, secretKey string, timeout time.Duration) (Store, error) {
+	u, err := url.Parse(strings.TrimRight(endpoint, "/"))
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" || u.Host == "" {
+		return nil, fmt.Errorf("Invalid S3 endpoint %s", endpoint)
+	}
+	if bucket == "" {
+		return nil, fmt.Errorf("No S3 bucket configured")
+	}
+	return &s3{
+		endpoint:  u,
+		region:    region,
+		bucket:    bucket,
+		prefix:    prefix,
+		accessKey: accessKey,
+		secretKey: secretKey,
+		client:    &http.Client{Timeout: timeout},
+	}, nil
+}
+
+func (store *s3) Put(key, contentType string, data []byte) error {
+	response, err := store.do("PUT", key, contentType, data)
+	if err != nil {
+		return err
+	}
+	response.Body.Close()
+	return nil
+}
+
+func (store *s3) Get(key string) ([]byte, error) {
+	response, err := store.do("GET", key, "", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	return ioutil.ReadAll(response.Body)
+}
+
+func (store *s3) Delete(key string) error {
+	response, err := store.do("DELETE", key, "", nil)
+	if err != nil {
+		return err
+	}
+	response.Body.Close()
+	return nil
+}
+
+// SignedURL creates a presigned GET URL. S3 accepts them for at most seven
+// days.
+func (store *s3) SignedURL(key string, expires time.Duration) (string, error) {
+	if expires > s3MaxExpires {
+		expires = s3MaxExpires
+	}
+	return store.presign(store.path(key), expires, time.Now().UTC()), nil
+}
+
+func (store *s3) path(key string) string {
+	return store.endpoint.Path + "/" + store.bucket + "/" + store.prefix + key
+}
+
+func (store *s3) do(method, key, contentType string, data []byte) (*http.Response, error) {
+	path := store.path(key)
+	request, err := http.NewRequest(method, store.endpoint.Scheme+"://"+store.endpoint.Host, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	request.URL.Path = path
+	if contentType != "" {
+		request.Header.Set("Content-Type", contentType)
+	}
+	store.sign(request, path, data, time.Now().UTC())
+
+	response, err := store.client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode == http.StatusNotFound {
+		response.Body.Close()
+		return nil, ErrNotFound
+	}
+	if response.StatusCode/100 != 2 {
+		response.Body.Close()
+		return nil, fmt.Errorf("S3 %s %s failed: %s", method, key, response.Status)
+	}
+	return response, nil
+}
+
+// sign adds the headers of AWS signature version 4 to request.
+func (store *s3) sign(request *http.Request, path string, data []byte, now time.Time) {
+	payloadHash := sha256Hex(data)
+	amzDate := now.Format("20060102T150405Z")
+	request.Header.Set("X-Amz-Date", amzDate)
+	request.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	signedHeaders := "host;x-amz-content-sha256;x-amz-date"
+	canonicalHeaders := "host:" + request.URL.Host + "\nx-amz-content-sha256:" + payloadHash + "\nx-amz-date:" + amzDate + "\n"
+	scope, signature := store.signature(request.Method, path, "", canonicalHeaders, signedHeaders, payloadHash, amzDate)
+	request.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s", store.accessKey, scope, signedHeaders, signature))
+}
+
+// presign returns a GET URL of path which is signed in its query.
+func (store *s3) presign(path string, expires time.Duration, now time.Time) string {
+	amzDate := now.Format("20060102T150405Z")
+	query := url.Values{
+		"X-Amz-Algorithm":     {"AWS4-HMAC-SHA256"},
+		"X-Amz-Credential":    {store.accessKey + "/" + store.scope(amzDate)},
+		"X-Amz-Date":          {amzDate},
+		"X-Amz-Expires":       {strconv.Itoa(int(expires.Seconds()))},
+		"X-Amz-SignedHeaders": {"host"},
+	}
+	canonicalQuery := s3CanonicalQuery(query)
+	_, signature := store.signature("GET", path, canonicalQuery, "host:"+store.endpoint.Host+"\n", "host", "UNSIGNED-PAYLOAD", amzDate)
+	return store.endpoint.Scheme + "://" + store.endpoint.Host + s3EscapePath(path) + "?" + canonicalQuery + "&X-Amz-Signature=" + signature
+}
+
+func (store *s3) scope(amzDate string) string {
+	return amzDate[:8] + "/" + store.region + "/s3/aws4_request"
+}
+
+// signature returns the credential scope and the signature of a request.
+func (store *s3) signature(method, path, canonicalQuery, canonicalHeaders, signedHeaders, payloadHash, amzDate string) (string, string) {
+	canonicalRequest := strings.Join([]string{
+		method,
+		s3EscapePath(path),
+		canonicalQuery,
+		canonicalHeaders,
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	scope := store.scope(amzDate)
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonicalRequest))
+
+	key := []byte("AWS4" + store.secretKey)
+	for _, part := range []string{amzDate[:8], store.region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	return scope, hex.EncodeToString(hmacSHA256(key, stringToSign))
+}
+
+func s3CanonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	parts := make([]string, 0, len(keys))
+	for _, key := range keys {
+		parts = append(parts, s3Escape(key, false)+"="+s3Escape(query.Get(key), false))
+	}
+	return strings.Join(parts, "&")
+}
+
+// s3EscapePath escapes all but the unreserved characters of path segments.
+func s3EscapePath(path string) string {
+	return s3Escape(path, true)
+}
+
+func s3Escape(s string, path bool) string {
+	var buf bytes.Buffer
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' || c == '-' || c == '_' || c == '.' || c == '~' || path && c == '/' {
+			buf.WriteByte(c)
+		} else {
+			fmt.Fprintf(&buf, "%%%02X", c)
+		}
+	}
+	return buf.String()
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
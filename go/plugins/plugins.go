@@ -0,0 +1,476 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+// Package plugins implements external server plugins. A plugin is a
+// separate binary which is started by the server and talks JSON-RPC over
+// its standard input and output. Plugins can provide user authentication,
+// check incoming channelling messages and room joins, add fields to the
+// messages sent to sessions and receive server events. See Serve for the
+// plugin side.
+package plugins
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/rpc"
+	"net/rpc/jsonrpc"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Capabilities a plugin can announce in its Info.
+const (
+	CapabilityAuth       = "auth"
+	CapabilityMessages   = "messages"
+	CapabilityRooms      = "rooms"
+	CapabilityEvents     = "events"
+	CapabilityPolicy     = "policy"
+	CapabilityExtras     = "extras"
+	CapabilityChatFilter = "chatfilter"
+	CapabilityScreening  = "screening"
+)
+
+// ProtocolVersion is the plugin protocol version. Plugins announcing a
+// different version are refused.
+const ProtocolVersion = 1
+
+const serviceName = "Plugin"
+
+// ErrTimeout is returned when a plugin did not answer in time.
+var ErrTimeout = errors.New("plugin timeout")
+
+// Info describes a plugin.
+type Info struct {
+	Name         string
+	Protocol     int
+	Capabilities []string
+}
+
+// AuthRequest asks an auth provider to validate user credentials.
+type AuthRequest struct {
+	UseridCombo string
+	Secret      string
+	RemoteAddr  string
+}
+
+// AuthReply carries the authenticated user id. An empty Userid means the
+// plugin does not know the credentials.
+type AuthReply struct {
+	Userid string
+}
+
+// MessageRequest describes an incoming channelling message.
+type MessageRequest struct {
+	Type   string
+	From   string
+	Userid string
+	Roomid string
+	Data   interface{}
+}
+
+// RoomRequest describes a room join.
+type RoomRequest struct {
+	Roomid        string
+	Name          string
+	Type          string
+	From          string
+	Userid        string
+	Authenticated bool
+}
+
+// PolicyRequest asks a policy engine whether Action is allowed. Input holds
+// the session and room context, see the server documentation for its
+// format. Policy engines stand in for in-process evaluation of WASM policy
+// modules, which the server does not support.
+type PolicyRequest struct {
+	Action string
+	Input  interface{}
+}
+
+// ExtrasRequest asks an extras provider for additional fields of the Self
+// or Welcome message sent to a session.
+type ExtrasRequest struct {
+	Message       string
+	From          string
+	Userid        string
+	Roomid        string
+	Authenticated bool
+}
+
+// ExtrasReply carries the additional fields.
+type ExtrasReply struct {
+	Extras map[string]interface{}
+}
+
+// ChatFilterRequest asks a chat filter to check a chat message before it
+// is relayed. To is empty for room chat.
+type ChatFilterRequest struct {
+	From    string
+	Userid  string
+	Roomid  string
+	To      string
+	Message string
+}
+
+// ChatFilterReply is the reply of chat filters. Message replaces the chat
+// message if not empty, e.g. to mask words. Flagged messages are relayed,
+// but reported to the moderators of the room.
+type ChatFilterReply struct {
+	Message string
+	Reject  bool
+	Flag    bool
+	Reason  string
+}
+
+// CallScreeningRequest describes a call before the offer reaches the
+// callee. Time is the Unix time of the call, e.g. for business hours.
+type CallScreeningRequest struct {
+	From       string
+	Userid     string
+	Name       string
+	Roomid     string
+	To         string
+	ToUserid   string
+	ToName     string
+	ToPresence string
+	Time       int64
+	Occupancy  int
+	RemoteAddr string
+}
+
+// CallScreeningReply is the reply of call screeners. Action is allow,
+// reject or redirect, an empty Action allows the call. Redirect is the
+// session id, or RedirectUser the user with a session in the room, which
+// receives redirected calls instead. Message is shown to rejected callers.
+type CallScreeningReply struct {
+	Action       string
+	Reason       string
+	Message      string
+	Redirect     string
+	RedirectUser string
+}
+
+// Decision is the reply of message hooks and room policies.
+type Decision struct {
+	Reject bool
+	Reason string
+}
+
+// Event is a server event sent to event sinks.
+type Event struct {
+	Name string
+	From string
+	To   string
+	Data interface{}
+}
+
+// Empty is used for calls without arguments or reply.
+type Empty struct{}
+
+// A Client is a connection to a single plugin.
+type Client struct {
+	info    *Info
+	rpc     *rpc.Client
+	cmd     *exec.Cmd
+	timeout time.Duration
+}
+
+// NewClient creates a Client talking to a plugin over conn and reads the
+// plugin Info.
+func NewClient(conn io.ReadWriteCloser, timeout time.Duration) (*Client, error) {
+	client := &Client{
+		rpc:     jsonrpc.NewClient(conn),
+		timeout: timeout,
+	}
+	info := &Info{}
+	if err := client.call("Info", &Empty{}, info); err != nil {
+		client.rpc.Close()
+		return nil, err
+	}
+	if info.Protocol != ProtocolVersion {
+		client.rpc.Close()
+		return nil, fmt.Errorf("plugin %s uses unsupported protocol %d", info.Name, info.Protocol)
+	}
+	client.info = info
+	return client, nil
+}
+
+type stdioConn struct {
+	io.ReadCloser
+	io.WriteCloser
+}
+
+func (conn *stdioConn) Close() error {
+	conn.WriteCloser.Close()
+	return conn.ReadCloser.Close()
+}
+
+// Start runs the plugin binary at path and connects to it. The plugin's
+// standard error is passed through to the server log.
+func Start(path string, timeout time.Duration, args ...string) (*Client, error) {
+	cmd := exec.Command(path, args...)
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err = cmd.Start(); err != nil {
+		return nil, err
+	}
+	client, err := NewClient(&stdioConn{stdout, stdin}, timeout)
+	if err != nil {
+		cmd.Process.Kill()
+		cmd.Wait()
+		return nil, fmt.Errorf("plugin %s: %s", filepath.Base(path), err)
+	}
+	client.cmd = cmd
+	return client, nil
+}
+
+func (client *Client) call(method string, args interface{}, reply interface{}) error {
+	call := client.rpc.Go(serviceName+"."+method, args, reply, make(chan *rpc.Call, 1))
+	if client.timeout <= 0 {
+		<-call.Done
+		return call.Error
+	}
+	timer := time.NewTimer(client.timeout)
+	defer timer.Stop()
+	select {
+	case <-call.Done:
+		return call.Error
+	case <-timer.C:
+		return ErrTimeout
+	}
+}
+
+// Info returns the plugin Info.
+func (client *Client) Info() *Info {
+	return client.info
+}
+
+// Has returns true if the plugin announced capability.
+func (client *Client) Has(capability string) bool {
+	for _, c := range client.info.Capabilities {
+		if c == capability {
+			return true
+		}
+	}
+	return false
+}
+
+// Close disconnects from the plugin and stops its process.
+func (client *Client) Close() error {
+	err := client.rpc.Close()
+	if client.cmd != nil {
+		client.cmd.Process.Kill()
+		client.cmd.Wait()
+	}
+	return err
+}
+
+// A Host manages a set of plugins and dispatches calls to the ones with
+// the matching capability.
+type Host struct {
+	sync.RWMutex
+	clients []*Client
+}
+
+// NewHost creates an empty Host.
+func NewHost() *Host {
+	return &Host{}
+}
+
+// Add adds a connected plugin.
+func (host *Host) Add(client *Client) {
+	host.Lock()
+	host.clients = append(host.clients, client)
+	host.Unlock()
+	log.Printf("Loaded plugin %s (%v)\n", client.info.Name, client.info.Capabilities)
+}
+
+// Has returns true if any plugin announced capability.
+func (host *Host) Has(capability string) bool {
+	host.RLock()
+	defer host.RUnlock()
+	for _, client := range host.clients {
+		if client.Has(capability) {
+			return true
+		}
+	}
+	return false
+}
+
+func (host *Host) with(capability string) []*Client {
+	host.RLock()
+	defer host.RUnlock()
+	clients := []*Client{}
+	for _, client := range host.clients {
+		if client.Has(capability) {
+			clients = append(clients, client)
+		}
+	}
+	return clients
+}
+
+// Authenticate asks all auth providers in turn and returns the first user
+// id found. Errors of a provider are logged and the next one is asked.
+func (host *Host) Authenticate(request *AuthRequest) (string, error) {
+	for _, client := range host.with(CapabilityAuth) {
+		reply := &AuthReply{}
+		if err := client.call("Authenticate", request, reply); err != nil {
+			log.Printf("Plugin %s failed to authenticate: %s\n", client.info.Name, err)
+			continue
+		}
+		if reply.Userid != "" {
+			return reply.Userid, nil
+		}
+	}
+	return "", errors.New("invalid credentials")
+}
+
+// decide asks all plugins with capability and returns the first rejection.
+// Plugins which fail to answer reject, so a broken plugin cannot be used
+// to bypass its policy.
+func (host *Host) decide(capability, method string, request interface{}) *Decision {
+	for _, client := range host.with(capability) {
+		decision := &Decision{}
+		if err := client.call(method, request, decision); err != nil {
+			log.Printf("Plugin %s failed in %s: %s\n", client.info.Name, method, err)
+			return &Decision{Reject: true, Reason: "plugin_error"}
+		}
+		if decision.Reject {
+			return decision
+		}
+	}
+	return &Decision{}
+}
+
+// CheckMessage asks all message hooks whether the message is allowed.
+func (host *Host) CheckMessage(request *MessageRequest) *Decision {
+	return host.decide(CapabilityMessages, "CheckMessage", request)
+}
+
+// CheckRoom asks all room policies whether the room join is allowed.
+func (host *Host) CheckRoom(request *RoomRequest) *Decision {
+	return host.decide(CapabilityRooms, "CheckRoom", request)
+}
+
+// Authorize asks all policy engines whether the action is allowed.
+func (host *Host) Authorize(request *PolicyRequest) *Decision {
+	return host.decide(CapabilityPolicy, "Authorize", request)
+}
+
+// Extras asks all extras providers and merges their fields. Fields of
+// earlier plugins take precedence. Errors of a provider are logged and its
+// fields are skipped.
+func (host *Host) Extras(request *ExtrasRequest) map[string]interface{} {
+	var extras map[string]interface{}
+	for _, client := range host.with(CapabilityExtras) {
+		reply := &ExtrasReply{}
+		if err := client.call("Extras", request, reply); err != nil {
+			log.Printf("Plugin %s failed in Extras: %s\n", client.info.Name, err)
+			continue
+		}
+		for key, value := range reply.Extras {
+			if extras == nil {
+				extras = make(map[string]interface{})
+			}
+			if _, ok := extras[key]; !ok {
+				extras[key] = value
+			}
+		}
+	}
+	return extras
+}
+
+// FilterChat passes the chat message through all chat filters. Each filter
+// receives the message as changed by earlier filters, the first rejection
+// wins. Plugins which fail to answer reject the message.
+func (host *Host) FilterChat(request *ChatFilterRequest) *ChatFilterReply {
+	result := &ChatFilterReply{}
+	filtered := *request
+	for _, client := range host.with(CapabilityChatFilter) {
+		reply := &ChatFilterReply{}
+		if err := client.call("FilterChat", &filtered, reply); err != nil {
+			log.Printf("Plugin %s failed in FilterChat: %s\n", client.info.Name, err)
+			return &ChatFilterReply{Reject: true, Reason: "plugin_error"}
+		}
+		if reply.Reject {
+			return reply
+		}
+		if reply.Message != "" {
+			filtered.Message = reply.Message
+			result.Message = reply.Message
+		}
+		if reply.Flag && !result.Flag {
+			result.Flag = true
+			result.Reason = reply.Reason
+		}
+	}
+	return result
+}
+
+// ScreenCall asks all call screeners about a call, the first reply which
+// does not allow the call wins. Plugins which fail to answer reject the
+// call.
+func (host *Host) ScreenCall(request *CallScreeningRequest) *CallScreeningReply {
+	for _, client := range host.with(CapabilityScreening) {
+		reply := &CallScreeningReply{}
+		if err := client.call("ScreenCall", request, reply); err != nil {
+			log.Printf("Plugin %s failed in ScreenCall: %s\n", client.info.Name, err)
+			return &CallScreeningReply{Action: "reject", Reason: "plugin_error"}
+		}
+		if reply.Action != "" && reply.Action != "allow" {
+			return reply
+		}
+	}
+	return &CallScreeningReply{Action: "allow"}
+}
+
+// Event sends event to all event sinks without waiting for them.
+func (host *Host) Event(event *Event) {
+	for _, client := range host.with(CapabilityEvents) {
+		go func(client *Client) {
+			if err := client.call("Event", event, &Empty{}); err != nil {
+				log.Printf("Plugin %s failed to receive event %s: %s\n", client.info.Name, event.Name, err)
+			}
+		}(client)
+	}
+}
+
+// Close closes all plugins.
+func (host *Host) Close() {
+	host.Lock()
+	defer host.Unlock()
+	for _, client := range host.clients {
+		client.Close()
+	}
+	host.clients = nil
+}
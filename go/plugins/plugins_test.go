@@ -0,0 +1,179 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package plugins
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testPlugin struct {
+	events chan *Event
+}
+
+func (plugin *testPlugin) Authenticate(request *AuthRequest) (string, error) {
+	if request.Secret == "letmein" {
+		return request.UseridCombo, nil
+	}
+	return "", nil
+}
+
+func (plugin *testPlugin) CheckRoom(request *RoomRequest) (*Decision, error) {
+	if request.Name == "closed" {
+		return &Decision{Reject: true, Reason: "room_closed"}, nil
+	}
+	return nil, nil
+}
+
+func (plugin *testPlugin) Authorize(request *PolicyRequest) (*Decision, error) {
+	if input, ok := request.Input.(map[string]interface{}); ok && input["Userid"] == "admin" {
+		return nil, nil
+	}
+	return &Decision{Reject: true, Reason: "admins only"}, nil
+}
+
+func (plugin *testPlugin) Extras(request *ExtrasRequest) (map[string]interface{}, error) {
+	if request.Message == "Welcome" {
+		return map[string]interface{}{"banner": "Welcome to " + request.Roomid}, nil
+	}
+	return nil, nil
+}
+
+func (plugin *testPlugin) FilterChat(request *ChatFilterRequest) (*ChatFilterReply, error) {
+	switch {
+	case strings.Contains(request.Message, "spam"):
+		return &ChatFilterReply{Reject: true, Reason: "spam"}, nil
+	case strings.Contains(request.Message, "darn"):
+		return &ChatFilterReply{Message: strings.Replace(request.Message, "darn", "****", -1), Flag: true, Reason: "profanity"}, nil
+	}
+	return nil, nil
+}
+
+func (plugin *testPlugin) ScreenCall(request *CallScreeningRequest) (*CallScreeningReply, error) {
+	switch request.Userid {
+	case "blocked":
+		return &CallScreeningReply{Action: "reject", Reason: "blocklist"}, nil
+	case "support":
+		return &CallScreeningReply{Action: "redirect", Redirect: "agent"}, nil
+	}
+	return nil, nil
+}
+
+func (plugin *testPlugin) Event(event *Event) error {
+	plugin.events <- event
+	return nil
+}
+
+func newTestHost(t *testing.T) (*Host, *testPlugin) {
+	plugin := &testPlugin{make(chan *Event, 1)}
+	serverConn, clientConn := net.Pipe()
+	go ServeConn("test", plugin, serverConn)
+	client, err := NewClient(clientConn, time.Second)
+	if err != nil {
+		t.Fatalf("Could not connect to plugin: %v", err)
+	}
+	host := NewHost()
+	host.Add(client)
+	return host, plugin
+}
+
+func Test_HostCapabilities(t *testing.T) {
+	host, _ := newTestHost(t)
+	defer host.Close()
+
+	for _, capability := range []string{CapabilityAuth, CapabilityRooms, CapabilityEvents, CapabilityPolicy, CapabilityExtras, CapabilityChatFilter, CapabilityScreening} {
+		if !host.Has(capability) {
+			t.Errorf("Expected capability %s", capability)
+		}
+	}
+	if host.Has(CapabilityMessages) {
+		t.Error("Plugin should not have the messages capability")
+	}
+	if decision := host.CheckMessage(&MessageRequest{Type: "Chat"}); decision.Reject {
+		t.Error("Messages should pass without message hooks")
+	}
+}
+
+func Test_HostCalls(t *testing.T) {
+	host, plugin := newTestHost(t)
+	defer host.Close()
+
+	if userid, err := host.Authenticate(&AuthRequest{UseridCombo: "alice", Secret: "letmein"}); err != nil || userid != "alice" {
+		t.Errorf("Expected alice, but got %s (%v)", userid, err)
+	}
+	if _, err := host.Authenticate(&AuthRequest{UseridCombo: "alice", Secret: "wrong"}); err == nil {
+		t.Error("Invalid credentials should fail")
+	}
+
+	if decision := host.CheckRoom(&RoomRequest{Name: "open"}); decision.Reject {
+		t.Errorf("Room should be allowed, but got %s", decision.Reason)
+	}
+	if decision := host.CheckRoom(&RoomRequest{Name: "closed"}); !decision.Reject || decision.Reason != "room_closed" {
+		t.Errorf("Room should be rejected, but got %+v", decision)
+	}
+
+	if decision := host.Authorize(&PolicyRequest{Action: "record", Input: map[string]string{"Userid": "admin"}}); decision.Reject {
+		t.Errorf("Action should be allowed, but got %s", decision.Reason)
+	}
+	if decision := host.Authorize(&PolicyRequest{Action: "record", Input: map[string]string{"Userid": "bob"}}); !decision.Reject || decision.Reason != "admins only" {
+		t.Errorf("Action should be rejected, but got %+v", decision)
+	}
+
+	if extras := host.Extras(&ExtrasRequest{Message: "Welcome", Roomid: "Room:lobby"}); extras["banner"] != "Welcome to Room:lobby" {
+		t.Errorf("Unexpected extras %+v", extras)
+	}
+	if extras := host.Extras(&ExtrasRequest{Message: "Self"}); len(extras) != 0 {
+		t.Errorf("Expected no extras, but got %+v", extras)
+	}
+
+	if reply := host.FilterChat(&ChatFilterRequest{Message: "hello"}); reply.Reject || reply.Flag || reply.Message != "" {
+		t.Errorf("Expected message to pass, but got %+v", reply)
+	}
+	if reply := host.FilterChat(&ChatFilterRequest{Message: "darn it"}); reply.Reject || !reply.Flag || reply.Message != "**** it" || reply.Reason != "profanity" {
+		t.Errorf("Expected message to be masked and flagged, but got %+v", reply)
+	}
+	if reply := host.FilterChat(&ChatFilterRequest{Message: "buy spam"}); !reply.Reject || reply.Reason != "spam" {
+		t.Errorf("Expected message to be rejected, but got %+v", reply)
+	}
+
+	if reply := host.ScreenCall(&CallScreeningRequest{Userid: "alice"}); reply.Action != "allow" {
+		t.Errorf("Expected call to be allowed, but got %+v", reply)
+	}
+	if reply := host.ScreenCall(&CallScreeningRequest{Userid: "blocked"}); reply.Action != "reject" || reply.Reason != "blocklist" {
+		t.Errorf("Expected call to be rejected, but got %+v", reply)
+	}
+	if reply := host.ScreenCall(&CallScreeningRequest{Userid: "support"}); reply.Action != "redirect" || reply.Redirect != "agent" {
+		t.Errorf("Expected call to be redirected, but got %+v", reply)
+	}
+
+	host.Event(&Event{Name: "connect", From: "session"})
+	select {
+	case event := <-plugin.events:
+		if event.Name != "connect" || event.From != "session" {
+			t.Errorf("Unexpected event %+v", event)
+		}
+	case <-time.After(time.Second):
+		t.Error("Event was not delivered")
+	}
+}
@@ -0,0 +1,226 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package plugins
+
+import (
+	"errors"
+	"io"
+	"net/rpc"
+	"net/rpc/jsonrpc"
+	"os"
+)
+
+// An AuthProvider validates user credentials. It returns the user id, or an
+// empty string if the credentials are unknown.
+type AuthProvider interface {
+	Authenticate(request *AuthRequest) (string, error)
+}
+
+// A MessageHook checks incoming channelling messages.
+type MessageHook interface {
+	CheckMessage(request *MessageRequest) (*Decision, error)
+}
+
+// A RoomPolicy checks room joins.
+type RoomPolicy interface {
+	CheckRoom(request *RoomRequest) (*Decision, error)
+}
+
+// A PolicyEngine makes authorization decisions, e.g. by evaluating a
+// compiled policy module against the request input.
+type PolicyEngine interface {
+	Authorize(request *PolicyRequest) (*Decision, error)
+}
+
+// An ExtrasProvider adds fields to the Self and Welcome messages sent to
+// sessions.
+type ExtrasProvider interface {
+	Extras(request *ExtrasRequest) (map[string]interface{}, error)
+}
+
+// A ChatFilter checks chat messages before they are relayed and can mask,
+// reject or flag them.
+type ChatFilter interface {
+	FilterChat(request *ChatFilterRequest) (*ChatFilterReply, error)
+}
+
+// A CallScreener decides whether calls are allowed, rejected or redirected
+// to another session, e.g. for blocklists and business hours.
+type CallScreener interface {
+	ScreenCall(request *CallScreeningRequest) (*CallScreeningReply, error)
+}
+
+// An EventSink receives server events.
+type EventSink interface {
+	Event(event *Event) error
+}
+
+var errNotSupported = errors.New("not supported by plugin")
+
+// Service is the RPC service exported by plugins. It is exported for
+// net/rpc only, plugins use Serve.
+type Service struct {
+	name string
+	impl interface{}
+}
+
+func (service *Service) Info(args *Empty, reply *Info) error {
+	reply.Name = service.name
+	reply.Protocol = ProtocolVersion
+	reply.Capabilities = []string{}
+	if _, ok := service.impl.(AuthProvider); ok {
+		reply.Capabilities = append(reply.Capabilities, CapabilityAuth)
+	}
+	if _, ok := service.impl.(MessageHook); ok {
+		reply.Capabilities = append(reply.Capabilities, CapabilityMessages)
+	}
+	if _, ok := service.impl.(RoomPolicy); ok {
+		reply.Capabilities = append(reply.Capabilities, CapabilityRooms)
+	}
+	if _, ok := service.impl.(EventSink); ok {
+		reply.Capabilities = append(reply.Capabilities, CapabilityEvents)
+	}
+	if _, ok := service.impl.(PolicyEngine); ok {
+		reply.Capabilities = append(reply.Capabilities, CapabilityPolicy)
+	}
+	if _, ok := service.impl.(ExtrasProvider); ok {
+		reply.Capabilities = append(reply.Capabilities, CapabilityExtras)
+	}
+	if _, ok := service.impl.(ChatFilter); ok {
+		reply.Capabilities = append(reply.Capabilities, CapabilityChatFilter)
+	}
+	if _, ok := service.impl.(CallScreener); ok {
+		reply.Capabilities = append(reply.Capabilities, CapabilityScreening)
+	}
+	return nil
+}
+
+func (service *Service) Authenticate(args *AuthRequest, reply *AuthReply) (err error) {
+	provider, ok := service.impl.(AuthProvider)
+	if !ok {
+		return errNotSupported
+	}
+	reply.Userid, err = provider.Authenticate(args)
+	return
+}
+
+func (service *Service) CheckMessage(args *MessageRequest, reply *Decision) error {
+	hook, ok := service.impl.(MessageHook)
+	if !ok {
+		return errNotSupported
+	}
+	decision, err := hook.CheckMessage(args)
+	if err == nil && decision != nil {
+		*reply = *decision
+	}
+	return err
+}
+
+func (service *Service) CheckRoom(args *RoomRequest, reply *Decision) error {
+	policy, ok := service.impl.(RoomPolicy)
+	if !ok {
+		return errNotSupported
+	}
+	decision, err := policy.CheckRoom(args)
+	if err == nil && decision != nil {
+		*reply = *decision
+	}
+	return err
+}
+
+func (service *Service) Authorize(args *PolicyRequest, reply *Decision) error {
+	engine, ok := service.impl.(PolicyEngine)
+	if !ok {
+		return errNotSupported
+	}
+	decision, err := engine.Authorize(args)
+	if err == nil && decision != nil {
+		*reply = *decision
+	}
+	return err
+}
+
+func (service *Service) Extras(args *ExtrasRequest, reply *ExtrasReply) (err error) {
+	provider, ok := service.impl.(ExtrasProvider)
+	if !ok {
+		return errNotSupported
+	}
+	reply.Extras, err = provider.Extras(args)
+	return
+}
+
+func (service *Service) FilterChat(args *ChatFilterRequest, reply *ChatFilterReply) error {
+	filter, ok := service.impl.(ChatFilter)
+	if !ok {
+		return errNotSupported
+	}
+	filtered, err := filter.FilterChat(args)
+	if err == nil && filtered != nil {
+		*reply = *filtered
+	}
+	return err
+}
+
+func (service *Service) ScreenCall(args *CallScreeningRequest, reply *CallScreeningReply) error {
+	screener, ok := service.impl.(CallScreener)
+	if !ok {
+		return errNotSupported
+	}
+	screened, err := screener.ScreenCall(args)
+	if err == nil && screened != nil {
+		*reply = *screened
+	}
+	return err
+}
+
+func (service *Service) Event(args *Event, reply *Empty) error {
+	sink, ok := service.impl.(EventSink)
+	if !ok {
+		return errNotSupported
+	}
+	return sink.Event(args)
+}
+
+// ServeConn serves the plugin impl on conn until it is closed. impl
+// implements one or more of AuthProvider, MessageHook, RoomPolicy,
+// PolicyEngine, ExtrasProvider, ChatFilter, CallScreener and EventSink.
+func ServeConn(name string, impl interface{}, conn io.ReadWriteCloser) error {
+	server := rpc.NewServer()
+	if err := server.RegisterName(serviceName, &Service{name, impl}); err != nil {
+		return err
+	}
+	server.ServeCodec(jsonrpc.NewServerCodec(conn))
+	return nil
+}
+
+type stdio struct{}
+
+func (stdio) Read(p []byte) (int, error)  { return os.Stdin.Read(p) }
+func (stdio) Write(p []byte) (int, error) { return os.Stdout.Write(p) }
+func (stdio) Close() error                { return os.Stdin.Close() }
+
+// Serve is called by the main function of a plugin binary and serves impl
+// to the server over standard input and output. Plugins must not write
+// anything else to standard output, use standard error for logging.
+func Serve(name string, impl interface{}) error {
+	return ServeConn(name, impl, stdio{})
+}
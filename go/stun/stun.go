@@ -0,0 +1,160 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+// Package stun implements a minimal STUN server (RFC 5389) which answers
+// binding requests over UDP, so clients can discover their public address
+// without an external STUN or TURN server.
+package stun
+
+import (
+	"encoding/binary"
+	"errors"
+	"log"
+	"net"
+)
+
+const (
+	headerLength = 20
+	magicCookie  = 0x2112A442
+
+	bindingRequest  = 0x0001
+	bindingResponse = 0x0101
+
+	attributeMappedAddress    = 0x0001
+	attributeXorMappedAddress = 0x0020
+	attributeSoftware         = 0x8022
+
+	familyIPv4 = 0x01
+	familyIPv6 = 0x02
+
+	software = "spreed-webrtc"
+)
+
+var errNotBindingRequest = errors.New("not a STUN binding request")
+
+// Server answers STUN binding requests on an UDP socket.
+type Server struct {
+	conn *net.UDPConn
+}
+
+// Listen creates a Server listening on the given UDP address.
+func Listen(addr string) (*Server, error) {
+	udpAddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.ListenUDP("udp", udpAddr)
+	if err != nil {
+		return nil, err
+	}
+	return &Server{conn}, nil
+}
+
+// Addr returns the local address of the server.
+func (s *Server) Addr() net.Addr {
+	return s.conn.LocalAddr()
+}
+
+// Serve answers requests until the server is closed.
+func (s *Server) Serve() error {
+	buf := make([]byte, 1500)
+	for {
+		n, addr, err := s.conn.ReadFromUDP(buf)
+		if err != nil {
+			if opErr, ok := err.(*net.OpError); ok && opErr.Temporary() {
+				continue
+			}
+			return err
+		}
+		response, err := BindingResponse(buf[:n], addr)
+		if err != nil {
+			// Silently ignore everything else, as required for STUN.
+			continue
+		}
+		if _, err := s.conn.WriteToUDP(response, addr); err != nil {
+			log.Println("Failed to send STUN response", err)
+		}
+	}
+}
+
+// Close stops the server.
+func (s *Server) Close() error {
+	return s.conn.Close()
+}
+
+// BindingResponse returns the success response to a binding request,
+// carrying the address the request was received from.
+func BindingResponse(request []byte, addr *net.UDPAddr) ([]byte, error) {
+	if len(request) < headerLength ||
+		binary.BigEndian.Uint16(request[0:2]) != bindingRequest ||
+		binary.BigEndian.Uint32(request[4:8]) != magicCookie ||
+		int(binary.BigEndian.Uint16(request[2:4])) != len(request)-headerLength {
+		return nil, errNotBindingRequest
+	}
+	transactionID := request[8:20]
+
+	ip := addr.IP.To4()
+	family := byte(familyIPv4)
+	if ip == nil {
+		ip = addr.IP.To16()
+		family = familyIPv6
+	}
+
+	// MAPPED-ADDRESS for clients which predate RFC 5389.
+	mapped := make([]byte, 4+len(ip))
+	mapped[1] = family
+	binary.BigEndian.PutUint16(mapped[2:4], uint16(addr.Port))
+	copy(mapped[4:], ip)
+
+	// XOR-MAPPED-ADDRESS, xored with the magic cookie and transaction ID.
+	key := make([]byte, 16)
+	binary.BigEndian.PutUint32(key[0:4], magicCookie)
+	copy(key[4:], transactionID)
+	xorMapped := make([]byte, 4+len(ip))
+	xorMapped[1] = family
+	binary.BigEndian.PutUint16(xorMapped[2:4], uint16(addr.Port)^uint16(magicCookie>>16))
+	for i := range ip {
+		xorMapped[4+i] = ip[i] ^ key[i]
+	}
+
+	response := make([]byte, headerLength, headerLength+64)
+	binary.BigEndian.PutUint16(response[0:2], bindingResponse)
+	binary.BigEndian.PutUint32(response[4:8], magicCookie)
+	copy(response[8:20], transactionID)
+	response = appendAttribute(response, attributeXorMappedAddress, xorMapped)
+	response = appendAttribute(response, attributeMappedAddress, mapped)
+	response = appendAttribute(response, attributeSoftware, []byte(software))
+	binary.BigEndian.PutUint16(response[2:4], uint16(len(response)-headerLength))
+	return response, nil
+}
+
+func appendAttribute(message []byte, attribute uint16, value []byte) []byte {
+	header := make([]byte, 4)
+	binary.BigEndian.PutUint16(header[0:2], attribute)
+	binary.BigEndian.PutUint16(header[2:4], uint16(len(value)))
+	message = append(message, header...)
+	message = append(message, value...)
+	// Attributes are padded to a multiple of 4 bytes.
+	for len(message)%4 != 0 {
+		message = append(message, 0)
+	}
+	return message
+}
@@ -0,0 +1,97 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package stun
+
+import (
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+)
+
+func newTestRequest() []byte {
+	request := make([]byte, headerLength)
+	binary.BigEndian.PutUint16(request[0:2], bindingRequest)
+	binary.BigEndian.PutUint32(request[4:8], magicCookie)
+	copy(request[8:20], "transaction1")
+	return request
+}
+
+func Test_BindingResponse_XorsMappedAddress(t *testing.T) {
+	addr := &net.UDPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 54321}
+	response, err := BindingResponse(newTestRequest(), addr)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if binary.BigEndian.Uint16(response[0:2]) != bindingResponse || string(response[8:20]) != "transaction1" {
+		t.Fatalf("Unexpected response header %x", response[:20])
+	}
+	if int(binary.BigEndian.Uint16(response[2:4])) != len(response)-headerLength {
+		t.Errorf("Wrong message length in %x", response[:4])
+	}
+
+	attribute := response[headerLength:]
+	if binary.BigEndian.Uint16(attribute[0:2]) != attributeXorMappedAddress {
+		t.Fatalf("Expected XOR-MAPPED-ADDRESS first, but got %x", attribute[0:2])
+	}
+	port := binary.BigEndian.Uint16(attribute[6:8]) ^ uint16(magicCookie>>16)
+	ip := make(net.IP, 4)
+	binary.BigEndian.PutUint32(ip, binary.BigEndian.Uint32(attribute[8:12])^magicCookie)
+	if int(port) != addr.Port || !ip.Equal(addr.IP) {
+		t.Errorf("Expected %s, but got %s:%d", addr, ip, port)
+	}
+}
+
+func Test_BindingResponse_IgnoresOtherMessages(t *testing.T) {
+	request := newTestRequest()
+	binary.BigEndian.PutUint32(request[4:8], 0)
+	if _, err := BindingResponse(request, &net.UDPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 1}); err == nil {
+		t.Error("Expected request without magic cookie to be ignored")
+	}
+}
+
+func Test_Server_AnswersBindingRequests(t *testing.T) {
+	server, err := Listen("127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Could not listen: %v", err)
+	}
+	defer server.Close()
+	go server.Serve()
+
+	conn, err := net.DialUDP("udp", nil, server.Addr().(*net.UDPAddr))
+	if err != nil {
+		t.Fatalf("Could not connect: %v", err)
+	}
+	defer conn.Close()
+	if _, err := conn.Write(newTestRequest()); err != nil {
+		t.Fatalf("Could not send request: %v", err)
+	}
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	buf := make([]byte, 1500)
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatalf("No response: %v", err)
+	}
+	if binary.BigEndian.Uint16(buf[0:2]) != bindingResponse || n <= headerLength {
+		t.Errorf("Unexpected response %x", buf[:n])
+	}
+}
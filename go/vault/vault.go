@@ -0,0 +1,359 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+// Package vault reads secrets from a HashiCorp Vault compatible key
+// management service and keeps their leases and the client token renewed.
+package vault
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Prefix marks configuration values which reference a secret.
+const Prefix = "vault:"
+
+var (
+	ErrInvalidReference = errors.New("vault: invalid secret reference")
+	ErrNoField          = errors.New("vault: secret has no such field")
+)
+
+// A Secret is the response of the service to a read.
+type Secret struct {
+	LeaseID       string
+	LeaseDuration time.Duration
+	Renewable     bool
+	Data          map[string]interface{}
+}
+
+// Field returns the string value of the field name of the secret.
+func (secret *Secret) Field(name string) (string, bool) {
+	value, ok := secret.Data[name].(string)
+	return value, ok
+}
+
+type secretResponse struct {
+	LeaseID       string                 `json:"lease_id"`
+	LeaseDuration int                    `json:"lease_duration"`
+	Renewable     bool                   `json:"renewable"`
+	Data          map[string]interface{} `json:"data"`
+	Auth          *struct {
+		LeaseDuration int  `json:"lease_duration"`
+		Renewable     bool `json:"renewable"`
+	} `json:"auth"`
+	Errors []string `json:"errors"`
+}
+
+// A Client talks to the HTTP API of the service with a token.
+type Client struct {
+	address string
+	token   string
+	client  *http.Client
+}
+
+// NewClient creates a Client for the service at address, e.g.
+// https://vault.example.com:8200.
+func NewClient(address, token string, timeout time.Duration) *Client {
+	return &Client{
+		address: strings.TrimRight(address, "/"),
+		token:   token,
+		client:  &http.Client{Timeout: timeout},
+	}
+}
+
+// Read returns the secret at path. Secrets of the key/value engine version
+// 2 are unwrapped, so their fields are found in Data either way.
+func (c *Client) Read(path string) (*Secret, error) {
+	response, err := c.do("GET", path, nil)
+	if err != nil {
+		return nil, err
+	}
+	secret := &Secret{
+		LeaseID:       response.LeaseID,
+		LeaseDuration: time.Duration(response.LeaseDuration) * time.Second,
+		Renewable:     response.Renewable,
+		Data:          response.Data,
+	}
+	if data, ok := secret.Data["data"].(map[string]interface{}); ok {
+		if _, ok := secret.Data["metadata"]; ok {
+			secret.Data = data
+		}
+	}
+	return secret, nil
+}
+
+// Renew extends the lease of secret and updates its LeaseDuration.
+func (c *Client) Renew(secret *Secret) error {
+	response, err := c.do("PUT", "sys/leases/renew", map[string]string{"lease_id": secret.LeaseID})
+	if err != nil {
+		return err
+	}
+	secret.LeaseDuration = time.Duration(response.LeaseDuration) * time.Second
+	return nil
+}
+
+// RenewToken extends the lease of the token of the client and returns its
+// new duration. Tokens without lease return 0.
+func (c *Client) RenewToken() (time.Duration, error) {
+	response, err := c.do("POST", "auth/token/renew-self", map[string]string{})
+	if err != nil {
+		return 0, err
+	}
+	if response.Auth == nil || !response.Auth.Renewable {
+		return 0, nil
+	}
+	return time.Duration(response.Auth.LeaseDuration) * time.Second, nil
+}
+
+// TokenRenewable returns true if the token of the client has a renewable
+// lease.
+func (c *Client) TokenRenewable() (bool, error) {
+	response, err := c.do("GET", "auth/token/lookup-self", nil)
+	if err != nil {
+		return false, err
+	}
+	renewable, _ := response.Data["renewable"].(bool)
+	return renewable, nil
+}
+
+func (c *Client) do(method, path string, body interface{}) (*secretResponse, error) {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(data)
+	}
+	request, err := http.NewRequest(method, fmt.Sprintf("%s/v1/%s", c.address, strings.TrimLeft(path, "/")), reader)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("X-Vault-Token", c.token)
+	if body != nil {
+		request.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := c.client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	response := &secretResponse{}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(response); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("vault: invalid response for %s: %s", path, err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("vault: %s %s failed with status %d %s", method, path, resp.StatusCode, strings.Join(response.Errors, ", "))
+	}
+	return response, nil
+}
+
+// ParseReference splits a configuration value of the form
+// vault:path#field into path and field.
+func ParseReference(value string) (path, field string, err error) {
+	if !strings.HasPrefix(value, Prefix) {
+		return "", "", ErrInvalidReference
+	}
+	reference := value[len(Prefix):]
+	idx := strings.LastIndex(reference, "#")
+	if idx <= 0 || idx == len(reference)-1 {
+		return "", "", ErrInvalidReference
+	}
+	return reference[:idx], reference[idx+1:], nil
+}
+
+type watchedSecret struct {
+	secret   *Secret
+	fetched  time.Time
+	watchers map[string][]func(string)
+}
+
+// A Watcher caches the secrets read through it. It renews their leases and
+// the client token, and reads them again when their lease can no longer be
+// renewed or the refresh interval passed, to pick up rotated values.
+type Watcher struct {
+	sync.Mutex
+	client  *Client
+	refresh time.Duration
+	secrets map[string]*watchedSecret
+	stop    chan struct{}
+}
+
+// NewWatcher creates a Watcher which reads unleased secrets again every
+// refresh interval.
+func NewWatcher(client *Client, refresh time.Duration) *Watcher {
+	return &Watcher{
+		client:  client,
+		refresh: refresh,
+		secrets: make(map[string]*watchedSecret),
+	}
+}
+
+// Get returns the field of the secret at path.
+func (w *Watcher) Get(path, field string) (string, error) {
+	w.Lock()
+	defer w.Unlock()
+	watched, ok := w.secrets[path]
+	if !ok {
+		secret, err := w.client.Read(path)
+		if err != nil {
+			return "", err
+		}
+		watched = &watchedSecret{secret, time.Now(), make(map[string][]func(string))}
+		w.secrets[path] = watched
+	}
+	value, ok := watched.secret.Field(field)
+	if !ok {
+		return "", ErrNoField
+	}
+	return value, nil
+}
+
+// OnChange registers fn to be called with the new value when the field of
+// the secret at path was rotated.
+func (w *Watcher) OnChange(path, field string, fn func(string)) {
+	w.Lock()
+	defer w.Unlock()
+	if watched, ok := w.secrets[path]; ok {
+		watched.watchers[field] = append(watched.watchers[field], fn)
+	}
+}
+
+// Start renews leases and refreshes secrets every interval until Stop is
+// called.
+func (w *Watcher) Start(interval time.Duration) {
+	w.Lock()
+	if w.stop != nil {
+		w.Unlock()
+		return
+	}
+	w.stop = make(chan struct{})
+	stop := w.stop
+	w.Unlock()
+
+	// Tokens without lease, like root tokens, cannot be renewed.
+	renewToken, err := w.client.TokenRenewable()
+	if err != nil {
+		log.Printf("Failed to look up vault token: %s\n", err)
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case now := <-ticker.C:
+				w.renew(now, interval, renewToken)
+			}
+		}
+	}()
+}
+
+// Stop ends the renewals of Start.
+func (w *Watcher) Stop() {
+	w.Lock()
+	defer w.Unlock()
+	if w.stop != nil {
+		close(w.stop)
+		w.stop = nil
+	}
+}
+
+func (w *Watcher) renew(now time.Time, interval time.Duration, renewToken bool) {
+	if renewToken {
+		if _, err := w.client.RenewToken(); err != nil {
+			log.Printf("Failed to renew vault token: %s\n", err)
+		}
+	}
+
+	w.Lock()
+	paths := make([]string, 0, len(w.secrets))
+	for path := range w.secrets {
+		paths = append(paths, path)
+	}
+	w.Unlock()
+
+	for _, path := range paths {
+		w.Lock()
+		watched := w.secrets[path]
+		secret := watched.secret
+		w.Unlock()
+
+		if secret.LeaseID != "" {
+			// Renew leases which would expire before the next interval,
+			// and read the secret again when that is no longer possible.
+			if now.Add(2 * interval).Before(watched.fetched.Add(secret.LeaseDuration)) {
+				continue
+			}
+			if secret.Renewable {
+				renewed := *secret
+				if err := w.client.Renew(&renewed); err == nil && renewed.LeaseDuration > 2*interval {
+					w.Lock()
+					watched.secret, watched.fetched = &renewed, now
+					w.Unlock()
+					continue
+				}
+			}
+		} else if now.Before(watched.fetched.Add(w.refresh)) {
+			continue
+		}
+
+		fresh, err := w.client.Read(path)
+		if err != nil {
+			log.Printf("Failed to refresh vault secret %s: %s\n", path, err)
+			continue
+		}
+		w.update(watched, fresh, now)
+	}
+}
+
+func (w *Watcher) update(watched *watchedSecret, fresh *Secret, now time.Time) {
+	var calls []func()
+	w.Lock()
+	for field, watchers := range watched.watchers {
+		old, _ := watched.secret.Field(field)
+		value, ok := fresh.Field(field)
+		if !ok || value == old {
+			continue
+		}
+		for _, fn := range watchers {
+			fn, value := fn, value
+			calls = append(calls, func() { fn(value) })
+		}
+	}
+	watched.secret, watched.fetched = fresh, now
+	w.Unlock()
+
+	for _, call := range calls {
+		call()
+	}
+}
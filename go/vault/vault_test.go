@@ -0,0 +1,173 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package vault
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+type testService struct {
+	sync.Mutex
+	secrets map[string]map[string]interface{}
+	renewed []string
+}
+
+func (service *testService) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	service.Lock()
+	defer service.Unlock()
+	if r.Header.Get("X-Vault-Token") != "token" {
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(map[string]interface{}{"errors": []string{"permission denied"}})
+		return
+	}
+	switch r.URL.Path {
+	case "/v1/sys/leases/renew":
+		var body map[string]string
+		json.NewDecoder(r.Body).Decode(&body)
+		service.renewed = append(service.renewed, body["lease_id"])
+		json.NewEncoder(w).Encode(map[string]interface{}{"lease_id": body["lease_id"], "lease_duration": 3600, "renewable": true})
+	default:
+		secret, ok := service.secrets[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]interface{}{"errors": []string{}})
+			return
+		}
+		json.NewEncoder(w).Encode(secret)
+	}
+}
+
+func (service *testService) set(path string, secret map[string]interface{}) {
+	service.Lock()
+	defer service.Unlock()
+	service.secrets[path] = secret
+}
+
+func newTestService() (*testService, *httptest.Server) {
+	service := &testService{secrets: make(map[string]map[string]interface{})}
+	return service, httptest.NewServer(service)
+}
+
+func kv2(value string) map[string]interface{} {
+	return map[string]interface{}{
+		"data": map[string]interface{}{
+			"data":     map[string]interface{}{"turnSecret": value},
+			"metadata": map[string]interface{}{"version": 1},
+		},
+	}
+}
+
+func Test_ParseReference(t *testing.T) {
+	path, field, err := ParseReference("vault:secret/data/spreed#turnSecret")
+	if err != nil || path != "secret/data/spreed" || field != "turnSecret" {
+		t.Errorf("Unexpected reference %q %q %v", path, field, err)
+	}
+	for _, value := range []string{"secret/data/spreed#turnSecret", "vault:secret/data/spreed", "vault:#field", "vault:path#"} {
+		if _, _, err := ParseReference(value); err != ErrInvalidReference {
+			t.Errorf("Expected %q to be invalid, but got %v", value, err)
+		}
+	}
+}
+
+func Test_Client_ReadsKeyValueSecrets(t *testing.T) {
+	service, server := newTestService()
+	defer server.Close()
+	service.set("/v1/secret/data/spreed", kv2("a"))
+	service.set("/v1/secret/spreed", map[string]interface{}{"data": map[string]interface{}{"turnSecret": "b"}})
+
+	client := NewClient(server.URL+"/", "token", time.Second)
+	for path, expected := range map[string]string{"secret/data/spreed": "a", "secret/spreed": "b"} {
+		secret, err := client.Read(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if value, ok := secret.Field("turnSecret"); !ok || value != expected {
+			t.Errorf("Expected %q from %s, but got %q", expected, path, value)
+		}
+	}
+
+	if _, err := NewClient(server.URL, "wrong", time.Second).Read("secret/spreed"); err == nil {
+		t.Error("Expected an error with an invalid token")
+	}
+}
+
+func Test_Watcher_NotifiesRotatedSecrets(t *testing.T) {
+	service, server := newTestService()
+	defer server.Close()
+	service.set("/v1/secret/data/spreed", kv2("a"))
+
+	watcher := NewWatcher(NewClient(server.URL, "token", time.Second), time.Hour)
+	if value, err := watcher.Get("secret/data/spreed", "turnSecret"); err != nil || value != "a" {
+		t.Fatalf("Expected the secret, but got %q (%v)", value, err)
+	}
+	if _, err := watcher.Get("secret/data/spreed", "unknown"); err != ErrNoField {
+		t.Errorf("Expected ErrNoField, but got %v", err)
+	}
+	var rotated []string
+	watcher.OnChange("secret/data/spreed", "turnSecret", func(value string) {
+		rotated = append(rotated, value)
+	})
+
+	service.set("/v1/secret/data/spreed", kv2("b"))
+	now := time.Now()
+	watcher.renew(now.Add(time.Minute), time.Minute, false)
+	if len(rotated) != 0 {
+		t.Errorf("Expected no refresh before the refresh interval, but got %v", rotated)
+	}
+	watcher.renew(now.Add(2*time.Hour), time.Minute, false)
+	if len(rotated) != 1 || rotated[0] != "b" {
+		t.Errorf("Expected the rotated secret, but got %v", rotated)
+	}
+	if value, _ := watcher.Get("secret/data/spreed", "turnSecret"); value != "b" {
+		t.Errorf("Expected the rotated secret, but got %q", value)
+	}
+}
+
+func Test_Watcher_RenewsLeases(t *testing.T) {
+	service, server := newTestService()
+	defer server.Close()
+	service.set("/v1/database/creds/spreed", map[string]interface{}{
+		"lease_id":       "database/creds/spreed/1",
+		"lease_duration": 300,
+		"renewable":      true,
+		"data":           map[string]interface{}{"password": "a"},
+	})
+
+	watcher := NewWatcher(NewClient(server.URL, "token", time.Second), time.Hour)
+	if _, err := watcher.Get("database/creds/spreed", "password"); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	watcher.renew(now.Add(time.Minute), time.Minute, false)
+	if len(service.renewed) != 0 {
+		t.Errorf("Expected no renewal while the lease is valid, but got %v", service.renewed)
+	}
+	watcher.renew(now.Add(4*time.Minute), time.Minute, false)
+	if len(service.renewed) != 1 || service.renewed[0] != "database/creds/spreed/1" {
+		t.Errorf("Expected the lease to be renewed, but got %v", service.renewed)
+	}
+}
@@ -0,0 +1,199 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+// Command spreed-bot is a headless participant for manual testing and demos.
+// It joins a room, answers calls and responds to chat messages.
+//
+// Calls are answered with a prerecorded answer (-answer) or by an external
+// media helper (-media). The helper is started for every call and talks
+// JSON lines with the bot: it receives the documents of the caller on stdin
+// as received, first the Offer document {"Type":"Offer","Offer":{...}} and
+// then any Candidate documents {"Type":"Candidate","Candidate":{...}}. It
+// writes {"Type":"Answer","Answer":{...}} followed by its own candidates in
+// the same format to stdout. The helper is killed when the call ends.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/strukturag/spreed-webrtc/go/channelling"
+	"github.com/strukturag/spreed-webrtc/go/client"
+)
+
+type bot struct {
+	client *client.Client
+	name   string
+	reply  string
+	answer map[string]interface{}
+	media  []string
+	calls  map[string]*mediaHelper
+}
+
+func main() {
+	url := flag.String("url", "ws://localhost:8080/ws", "Websocket end point of the server.")
+	room := flag.String("room", "", "Name of the room to join, empty for the default room.")
+	roomType := flag.String("type", "", "Type of the room, empty for the default type.")
+	pin := flag.String("pin", "", "PIN of the room.")
+	name := flag.String("name", "Bot", "Display name of the bot.")
+	reply := flag.String("reply", "", "Reply to chat messages with this text instead of echoing them.")
+	answerPath := flag.String("answer", "", "File with a prerecorded answer (JSON session description) to answer calls with.")
+	media := flag.String("media", "", "Command of a media helper to answer calls with, see the package documentation.")
+	flag.Parse()
+
+	b := &bot{
+		name:  *name,
+		reply: *reply,
+		media: strings.Fields(*media),
+		calls: make(map[string]*mediaHelper),
+	}
+	if *answerPath != "" {
+		data, err := ioutil.ReadFile(*answerPath)
+		if err == nil {
+			err = json.Unmarshal(data, &b.answer)
+		}
+		if err != nil {
+			log.Fatalf("Failed to read answer %s: %s", *answerPath, err)
+		}
+	}
+
+	c, err := client.Dial(*url, nil)
+	if err != nil {
+		log.Fatalf("Failed to connect to %s: %s", *url, err)
+	}
+	b.client = c
+	log.Printf("Connected as session %s\n", c.Self().Id)
+
+	var credentials *channelling.DataRoomCredentials
+	if *pin != "" {
+		credentials = &channelling.DataRoomCredentials{PIN: *pin}
+	}
+	welcome, err := c.Join(*room, *roomType, credentials)
+	if err != nil {
+		log.Fatalf("Failed to join room %q: %s", *room, err)
+	}
+	log.Printf("Joined room %q with %d sessions\n", welcome.Room.Name, len(welcome.Users))
+	if err := c.Send("Status", &channelling.DataStatus{Type: "Status", Status: map[string]interface{}{"displayName": b.name}}); err != nil {
+		log.Println("Failed to set display name", err)
+	}
+
+	interrupted := make(chan bool, 1)
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		interrupted <- true
+		c.Close()
+	}()
+
+	for msg := range c.Messages() {
+		b.handle(msg)
+	}
+	for from := range b.calls {
+		b.hangup(from)
+	}
+	select {
+	case <-interrupted:
+	default:
+		fmt.Fprintln(os.Stderr, "Connection closed:", c.Err())
+		os.Exit(1)
+	}
+}
+
+func (b *bot) handle(msg *client.Message) {
+	if msg.From == b.client.Self().Id {
+		return
+	}
+	switch msg.Type {
+	case "Chat":
+		chat := &channelling.DataChat{}
+		if err := msg.Decode(chat); err != nil || chat.Chat == nil || chat.Chat.Status != nil || chat.Chat.Message == "" {
+			return
+		}
+		b.respond(msg.From, chat)
+	case "Offer":
+		b.answerCall(msg.From, msg.Data)
+	case "Candidate":
+		if helper, ok := b.calls[msg.From]; ok {
+			helper.write(msg.Data)
+		}
+	case "Bye":
+		b.hangup(msg.From)
+	case "Error":
+		log.Println("Received error", msg.Error())
+	}
+}
+
+// respond echoes chat messages or replies with the configured text, in
+// the room or privately like the message was sent.
+func (b *bot) respond(from string, chat *channelling.DataChat) {
+	to := ""
+	if chat.To != "" {
+		to = from
+	}
+	text := b.reply
+	if text == "" {
+		text = "You said: " + chat.Chat.Message
+	}
+	if err := b.client.Chat(to, text); err != nil {
+		log.Println("Failed to send chat", err)
+	}
+}
+
+func (b *bot) answerCall(from string, offer json.RawMessage) {
+	b.hangup(from)
+	switch {
+	case len(b.media) > 0:
+		helper, err := startMediaHelper(b.media, from, b.client)
+		if err != nil {
+			log.Printf("Failed to start media helper for call with %s: %s\n", from, err)
+			b.client.Bye(from, nil)
+			return
+		}
+		b.calls[from] = helper
+		helper.write(offer)
+		log.Printf("Answering call with %s through media helper\n", from)
+	case b.answer != nil:
+		if err := b.client.Answer(from, b.answer); err != nil {
+			log.Println("Failed to answer call", err)
+			return
+		}
+		log.Printf("Answered call with %s with prerecorded answer\n", from)
+	default:
+		log.Printf("Rejecting call with %s, no -answer or -media\n", from)
+		b.client.Bye(from, map[string]string{"Reason": "reject"})
+	}
+}
+
+func (b *bot) hangup(from string) {
+	if helper, ok := b.calls[from]; ok {
+		helper.stop()
+		delete(b.calls, from)
+		log.Printf("Call with %s ended\n", from)
+	}
+}
@@ -0,0 +1,104 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"sync"
+
+	"github.com/strukturag/spreed-webrtc/go/client"
+)
+
+// mediaHelper is an external process which handles the media of a call.
+type mediaHelper struct {
+	sync.Mutex
+	cmd   *exec.Cmd
+	stdin io.WriteCloser
+}
+
+type mediaHelperLine struct {
+	Type      string
+	Answer    map[string]interface{}
+	Candidate interface{}
+}
+
+// startMediaHelper starts command for a call with the session to and sends
+// its answer and candidates through c.
+func startMediaHelper(command []string, to string, c *client.Client) (*mediaHelper, error) {
+	cmd := exec.Command(command[0], command[1:]...)
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	go func() {
+		scanner := bufio.NewScanner(stdout)
+		for scanner.Scan() {
+			line := &mediaHelperLine{}
+			if err := json.Unmarshal(scanner.Bytes(), line); err != nil {
+				log.Println("Invalid media helper output", err)
+				continue
+			}
+			switch line.Type {
+			case "Answer":
+				err = c.Answer(to, line.Answer)
+			case "Candidate":
+				err = c.Candidate(to, line.Candidate)
+			}
+			if err != nil {
+				log.Println("Failed to send media helper output", err)
+			}
+		}
+		cmd.Wait()
+	}()
+
+	return &mediaHelper{cmd: cmd, stdin: stdin}, nil
+}
+
+// write sends a JSON document as line to the helper.
+func (helper *mediaHelper) write(data []byte) {
+	helper.Lock()
+	defer helper.Unlock()
+	if _, err := helper.stdin.Write(append(data, '\n')); err != nil {
+		log.Println("Failed to write to media helper", err)
+	}
+}
+
+func (helper *mediaHelper) stop() {
+	helper.Lock()
+	defer helper.Unlock()
+	helper.stdin.Close()
+	helper.cmd.Process.Kill()
+}
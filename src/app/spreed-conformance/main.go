@@ -0,0 +1,78 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+// Command spreed-conformance drives a running server through the protocol
+// flows of the channeling API and reports which of them pass. It can be
+// used to validate servers and, as the reference, third party clients
+// against the documentation. The exit status is 1 if any flow failed.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/strukturag/spreed-webrtc/go/client"
+	"github.com/strukturag/spreed-webrtc/go/conformance"
+)
+
+func main() {
+	url := flag.String("url", "ws://localhost:8080/ws", "Websocket end point of the server.")
+	run := flag.String("run", "", "Comma separated names of the flows to run, empty for all.")
+	timeout := flag.Duration("timeout", conformance.DefaultTimeout, "Time to wait for every expected document.")
+	list := flag.Bool("list", false, "List the flows and exit.")
+	flag.Parse()
+
+	if *list {
+		for _, c := range conformance.Cases {
+			fmt.Printf("%-14s %s\n", c.Name, c.Description)
+		}
+		return
+	}
+
+	var names []string
+	if *run != "" {
+		names = strings.Split(*run, ",")
+	}
+	cases, err := conformance.Filter(conformance.Cases, names)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	dial := func() (*client.Client, error) {
+		return client.Dial(*url, nil)
+	}
+	failed := 0
+	conformance.Run(dial, cases, *timeout, func(result *conformance.Result) {
+		if result.Passed {
+			fmt.Printf("PASS %-14s (%s)\n", result.Name, result.Duration)
+		} else {
+			failed++
+			fmt.Printf("FAIL %-14s (%s): %s\n", result.Name, result.Duration, result.Err)
+		}
+	})
+	fmt.Printf("%d of %d passed\n", len(cases)-failed, len(cases))
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,175 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+// Command spreed-replay re-injects a signaling trace recorded by the server
+// (see traceFile in server.conf.in) against a test server. Every traced
+// session is replayed by a connection of its own, which sends the recorded
+// inbound documents with their original timing. Ids of traced sessions in
+// To fields are replaced with the ids of their replaying connections, and
+// redacted fields are left out. Documents received during the replay are
+// logged.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/strukturag/spreed-webrtc/go/channelling"
+	"github.com/strukturag/spreed-webrtc/go/client"
+)
+
+func main() {
+	url := flag.String("url", "ws://localhost:8080/ws", "Websocket end point of the test server.")
+	tracePath := flag.String("trace", "", "Trace file to replay.")
+	session := flag.String("session", "", "Replay only this traced session.")
+	room := flag.String("room", "", "Join this room instead of the recorded ones.")
+	speed := flag.Float64("speed", 1, "Replay speed factor, 0 sends all documents without delay.")
+	verbose := flag.Bool("v", false, "Log all received documents, not only errors.")
+	flag.Parse()
+	if *tracePath == "" {
+		log.Fatalln("No -trace given")
+	}
+
+	data, err := ioutil.ReadFile(*tracePath)
+	if err != nil {
+		log.Fatalf("Failed to read trace: %s", err)
+	}
+	records, err := channelling.ReadTrace(data)
+	if err != nil {
+		log.Fatalf("Failed to parse trace: %s", err)
+	}
+
+	var inbound []*channelling.TraceRecord
+	ids := make(map[string]string)
+	for _, record := range records {
+		if record.Direction != channelling.TraceInbound || (*session != "" && record.Session != *session) {
+			continue
+		}
+		inbound = append(inbound, record)
+		ids[record.Session] = ""
+	}
+	if len(inbound) == 0 {
+		log.Fatalln("No inbound documents to replay")
+	}
+	sort.Stable(byTime(inbound))
+
+	clients := make(map[string]*client.Client)
+	var wg sync.WaitGroup
+	for traced := range ids {
+		c, err := client.Dial(*url, nil)
+		if err != nil {
+			log.Fatalf("Failed to connect for session %s: %s", traced, err)
+		}
+		defer c.Close()
+		clients[traced] = c
+		ids[traced] = c.Self().Id
+		log.Printf("Replaying session %s as %s\n", traced, c.Self().Id)
+		wg.Add(1)
+		go func(traced string, c *client.Client) {
+			defer wg.Done()
+			for msg := range c.Messages() {
+				if err := msg.Error(); err != nil {
+					log.Printf("%s received error: %s\n", traced, err)
+				} else if *verbose {
+					log.Printf("%s received %s from %s\n", traced, msg.Type, msg.From)
+				}
+			}
+		}(traced, c)
+	}
+
+	started := time.Now()
+	for _, record := range inbound {
+		if *speed > 0 {
+			offset := time.Duration(float64(record.Time.Sub(inbound[0].Time)) / *speed)
+			time.Sleep(offset - time.Since(started))
+		}
+		msgType, document, err := rewrite(record.Data, ids, *room)
+		if err != nil {
+			log.Printf("Skipping document of %s: %s\n", record.Session, err)
+			continue
+		}
+		if err := clients[record.Session].Send(msgType, document); err != nil {
+			log.Printf("Failed to send %s of %s: %s\n", msgType, record.Session, err)
+			continue
+		}
+		log.Printf("%s sent %s\n", record.Session, msgType)
+	}
+
+	// Wait for the last replies before disconnecting.
+	time.Sleep(time.Second)
+	for _, c := range clients {
+		c.Close()
+	}
+	wg.Wait()
+}
+
+// rewrite returns the type and document of an inbound trace record,
+// without redacted fields and with the ids of traced sessions in To
+// replaced. Hello documents join room instead, if not empty.
+func rewrite(data json.RawMessage, ids map[string]string, room string) (string, map[string]interface{}, error) {
+	var incoming map[string]interface{}
+	if err := json.Unmarshal(data, &incoming); err != nil {
+		return "", nil, err
+	}
+	msgType, _ := incoming["Type"].(string)
+	document, ok := incoming[msgType].(map[string]interface{})
+	if !ok {
+		return "", nil, fmt.Errorf("no document of type %q", msgType)
+	}
+	removeRedacted(document)
+	if to, ok := document["To"].(string); ok && ids[to] != "" {
+		document["To"] = ids[to]
+	}
+	if msgType == "Hello" && room != "" {
+		document["Id"] = room
+		document["Name"] = room
+	}
+	return msgType, document, nil
+}
+
+func removeRedacted(value interface{}) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, field := range v {
+			if field == channelling.TraceRedacted {
+				delete(v, key)
+			} else {
+				removeRedacted(field)
+			}
+		}
+	case []interface{}:
+		for _, item := range v {
+			removeRedacted(item)
+		}
+	}
+}
+
+type byTime []*channelling.TraceRecord
+
+func (records byTime) Len() int           { return len(records) }
+func (records byTime) Swap(i, j int)      { records[i], records[j] = records[j], records[i] }
+func (records byTime) Less(i, j int) bool { return records[i].Time.Before(records[j].Time) }
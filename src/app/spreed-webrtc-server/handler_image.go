@@ -22,8 +22,11 @@
 package main
 
 import (
+	"bytes"
+	"log"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/strukturag/spreed-webrtc/go/channelling"
@@ -40,8 +43,16 @@ func makeImageHandler(buddyImages channelling.ImageCache, expires time.Duration)
 			return
 		}
 
-		w.Header().Set("Content-Type", image.MimeType())
-		w.Header().Set("ETag", image.LastChangeID())
+		size := 0
+		for _, flag := range strings.Split(vars["flags"], ",") {
+			if strings.HasPrefix(flag, "s") {
+				size, _ = strconv.Atoi(flag[1:])
+			}
+		}
+		variant := image.Variant(size)
+
+		w.Header().Set("Content-Type", variant.MimeType)
+		w.Header().Set("ETag", variant.ETag)
 		age := time.Now().Sub(image.LastChange())
 		if age >= time.Second {
 			w.Header().Set("Age", strconv.Itoa(int(age.Seconds())))
@@ -50,7 +61,18 @@ func makeImageHandler(buddyImages channelling.ImageCache, expires time.Duration)
 			w.Header().Set("Expires", time.Now().Add(expires).Format(time.RFC1123))
 			w.Header().Set("Cache-Control", "public, no-transform, max-age="+strconv.Itoa(int(expires.Seconds())))
 		}
+		if r.Header.Get("If-None-Match") == variant.ETag {
+			// Do not read the image from the store for revalidations.
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
 
-		http.ServeContent(w, r, "", image.LastChange(), image.Reader())
+		data, err := buddyImages.Read(variant)
+		if err != nil {
+			log.Println("Failed to read buddy image", err)
+			http.Error(w, "Failed to read image", http.StatusBadGateway)
+			return
+		}
+		http.ServeContent(w, r, "", image.LastChange(), bytes.NewReader(data))
 	}
 }
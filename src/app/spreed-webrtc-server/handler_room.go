@@ -42,16 +42,7 @@ func handleRoomView(room string, w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Expires", "-1")
 	w.Header().Set("Cache-Control", "private, max-age=0")
 
-	csp := false
-
-	if config.ContentSecurityPolicy != "" {
-		w.Header().Set("Content-Security-Policy", config.ContentSecurityPolicy)
-		csp = true
-	}
-	if config.ContentSecurityPolicyReportOnly != "" {
-		w.Header().Set("Content-Security-Policy-Report-Only", config.ContentSecurityPolicyReportOnly)
-		csp = true
-	}
+	csp := setContentSecurityPolicy(w, r)
 
 	scheme := "http"
 
@@ -68,6 +59,9 @@ func handleRoomView(room string, w http.ResponseWriter, r *http.Request) {
 	if len(langs) == 0 {
 		langs = append(langs, "en")
 	}
+	lang := selectLanguage(langs, supportedLanguages)
+	w.Header().Set("Content-Language", lang)
+	w.Header().Add("Vary", "Accept-Language")
 
 	// Prepare context to deliver to HTML..
 	context := &channelling.Context{
@@ -78,6 +72,7 @@ func handleRoomView(room string, w http.ResponseWriter, r *http.Request) {
 		Ssl:        ssl,
 		Csp:        csp,
 		Languages:  langs,
+		Lang:       lang,
 		Room:       room,
 		S:          config.S,
 		ExtraDHead: templatesExtraDHead,
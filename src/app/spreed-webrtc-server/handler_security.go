@@ -0,0 +1,125 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// Recommended policy for the web client, used when the configured policy is
+// "default".
+const defaultContentSecurityPolicy = "default-src 'self'; frame-src 'self' blob:; style-src 'self' 'unsafe-inline'; img-src 'self' data: blob:; connect-src 'self' {ws} blob:; font-src 'self' data: blob:; media-src 'self' blob:"
+
+const maxCSPReportSize = 16 * 1024
+
+func requestIsSecure(r *http.Request) bool {
+	if proto := r.Header.Get("X-Forwarded-Proto"); proto != "" {
+		return proto == "https"
+	}
+	return r.TLS != nil
+}
+
+// makeSecurityHeadersHandler adds the configured security headers which
+// apply to all responses.
+func makeSecurityHeadersHandler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header := w.Header()
+		header.Set("X-Content-Type-Options", "nosniff")
+		if config.ReferrerPolicy != "" {
+			header.Set("Referrer-Policy", config.ReferrerPolicy)
+		}
+		if config.StrictTransportSecurity != "" && requestIsSecure(r) {
+			header.Set("Strict-Transport-Security", config.StrictTransportSecurity)
+		}
+		switch config.FrameAncestors {
+		case "":
+		case "'self'":
+			header.Set("X-Frame-Options", "SAMEORIGIN")
+		case "'none'":
+			header.Set("X-Frame-Options", "DENY")
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// buildContentSecurityPolicy expands policy for request r. The {ws}
+// placeholder is replaced with the WebSocket URL of this server, and the
+// frame-ancestors and report-uri directives are added when configured.
+func buildContentSecurityPolicy(policy string, r *http.Request) string {
+	if policy == "default" {
+		policy = defaultContentSecurityPolicy
+	}
+	if policy == "" && config.FrameAncestors == "" {
+		return ""
+	}
+
+	scheme := "ws"
+	if requestIsSecure(r) {
+		scheme = "wss"
+	}
+	directives := []string{}
+	if policy != "" {
+		directives = append(directives, strings.TrimSuffix(strings.TrimSpace(policy), ";"))
+	}
+	if config.FrameAncestors != "" {
+		directives = append(directives, "frame-ancestors "+config.FrameAncestors)
+	}
+	if config.ContentSecurityPolicyReport {
+		directives = append(directives, fmt.Sprintf("report-uri %sapi/v1/csp-report", config.B))
+	}
+	return strings.Replace(strings.Join(directives, "; "), "{ws}", fmt.Sprintf("%s://%s%sws", scheme, r.Host, config.B), -1)
+}
+
+// setContentSecurityPolicy sets the configured CSP headers for HTML pages
+// and returns true if any was set.
+func setContentSecurityPolicy(w http.ResponseWriter, r *http.Request) bool {
+	csp := false
+	if policy := buildContentSecurityPolicy(config.ContentSecurityPolicy, r); policy != "" {
+		w.Header().Set("Content-Security-Policy", policy)
+		csp = true
+	}
+	if config.ContentSecurityPolicyReportOnly != "" {
+		w.Header().Set("Content-Security-Policy-Report-Only", buildContentSecurityPolicy(config.ContentSecurityPolicyReportOnly, r))
+		csp = true
+	}
+	return csp
+}
+
+// cspReportHandler logs CSP violation reports sent by browsers.
+func cspReportHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	report, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxCSPReportSize))
+	if err != nil {
+		w.WriteHeader(http.StatusRequestEntityTooLarge)
+		return
+	}
+	log.Printf("CSP violation report from %s: %s\n", r.RemoteAddr, strings.TrimSpace(string(report)))
+	w.WriteHeader(http.StatusNoContent)
+}
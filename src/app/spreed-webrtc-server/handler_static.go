@@ -0,0 +1,161 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// Languages with a translation bundle in static/translation, set on
+// startup. English is built into the client.
+var supportedLanguages = []string{"en"}
+
+var precompressedEncodings = []struct {
+	encoding  string
+	extension string
+}{
+	{"br", ".br"},
+	{"gzip", ".gz"},
+}
+
+// fingerprintStatic returns a short hash over the names and contents of all
+// files in folder. It is used to make the static URL prefix change only
+// when the assets change.
+func fingerprintStatic(folder string) (string, error) {
+	h := sha256.New()
+	err := filepath.Walk(folder, func(name string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(folder, name)
+		if err != nil {
+			return err
+		}
+		f, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		io.WriteString(h, filepath.ToSlash(rel))
+		h.Write([]byte{0})
+		_, err = io.Copy(h, f)
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)[:8]), nil
+}
+
+// loadSupportedLanguages returns the languages for which a translation
+// bundle exists in folder.
+func loadSupportedLanguages(folder string) []string {
+	langs := []string{"en"}
+	matches, _ := filepath.Glob(filepath.Join(folder, "messages-*.json"))
+	sort.Strings(matches)
+	for _, match := range matches {
+		lang := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(match), "messages-"), ".json")
+		if lang != "en" {
+			langs = append(langs, lang)
+		}
+	}
+	return langs
+}
+
+func acceptsEncoding(r *http.Request, encoding string) bool {
+	for _, value := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		value = strings.TrimSpace(value)
+		if idx := strings.IndexByte(value, ';'); idx != -1 {
+			if strings.Replace(value[idx:], " ", "", -1) == ";q=0" {
+				continue
+			}
+			value = value[:idx]
+		}
+		if value == encoding {
+			return true
+		}
+	}
+	return false
+}
+
+// makePrecompressedHandler serves pre-compressed variants of static files
+// (file.br or file.gz next to the file) to clients which accept them. All
+// other requests are passed on to h.
+func makePrecompressedHandler(folder string, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := mux.Vars(r)["path"]
+		versioned := strings.HasPrefix(name, "ver=")
+		if versioned {
+			if idx := strings.IndexByte(name, '/'); idx != -1 {
+				name = name[idx+1:]
+			}
+		}
+		name = path.Clean("/" + name)
+
+		for _, variant := range precompressedEncodings {
+			if !acceptsEncoding(r, variant.encoding) {
+				continue
+			}
+			f, err := os.Open(filepath.Join(folder, filepath.FromSlash(name)+variant.extension))
+			if err != nil {
+				continue
+			}
+			info, err := f.Stat()
+			if err != nil || !info.Mode().IsRegular() {
+				f.Close()
+				continue
+			}
+			defer f.Close()
+
+			header := w.Header()
+			contentType := mime.TypeByExtension(path.Ext(name))
+			if contentType == "" {
+				contentType = "application/octet-stream"
+			}
+			header.Set("Content-Type", contentType)
+			header.Set("Content-Encoding", variant.encoding)
+			header.Add("Vary", "Accept-Encoding")
+			if versioned {
+				header.Set("Cache-Control", "public, max-age=31536000")
+			}
+			http.ServeContent(w, r, name, info.ModTime(), f)
+			return
+		}
+
+		w.Header().Add("Vary", "Accept-Encoding")
+		h.ServeHTTP(w, r)
+	})
+}
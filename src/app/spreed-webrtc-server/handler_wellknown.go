@@ -46,8 +46,11 @@ func wellKnownHandler(w http.ResponseWriter, r *http.Request) {
 		Host:   r.Host,
 		Path:   strings.TrimSuffix(config.B, "/"),
 	}
+	endpoint := url.String()
+	url.Path += "/.well-known/openapi.json"
 	doc := &map[string]string{
-		"spreed-webrtc_endpoint": url.String(),
+		"spreed-webrtc_endpoint": endpoint,
+		"spreed-webrtc_openapi":  url.String(),
 	}
 	data, err := json.MarshalIndent(doc, "", "  ")
 	if err != nil {
@@ -53,7 +53,7 @@ var (
 	}
 )
 
-func makeWSHandler(connectionCounter channelling.ConnectionCounter, sessionManager channelling.SessionManager, codec channelling.Codec, channellingAPI channelling.ChannellingAPI, users *server.Users) http.HandlerFunc {
+func makeWSHandler(config *channelling.Config, connectionCounter channelling.ConnectionCounter, sessionManager channelling.SessionManager, codec channelling.Codec, channellingAPI channelling.ChannellingAPI, users *server.Users, affinity channelling.Affinity, tracer *channelling.SessionTracer, networkSimulator *channelling.NetworkSimulator, messageCatalogs *channelling.MessageCatalogs, loadShedder channelling.LoadShedder, panicRecovery channelling.PanicRecovery) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		// Validate incoming request.
 		if r.Method != "GET" {
@@ -61,18 +61,23 @@ func makeWSHandler(connectionCounter channelling.ConnectionCounter, sessionManag
 			return
 		}
 
-		// Upgrade to Websocket mode.
-		ws, err := upgrader.Upgrade(w, r, nil)
-		if _, ok := err.(websocket.HandshakeError); ok {
-			return
-		} else if err != nil {
-			log.Println(err)
-			return
+		// Tell load balancers which node serves this connection.
+		var header http.Header
+		if affinity != nil {
+			checkAffinity(config, affinity, r)
+			cookie := &http.Cookie{
+				Name:     config.AffinityCookie,
+				Value:    affinity.Token(),
+				Path:     config.B,
+				HttpOnly: true,
+				Secure:   r.TLS != nil,
+			}
+			header = http.Header{"Set-Cookie": {cookie.String()}}
 		}
 
 		r.ParseForm()
 		token := r.FormValue("t")
-		st := sessionManager.DecodeSessionToken(token)
+		st := sessionManager.DecodeSessionToken(token, server.ClientFingerprint(config, r))
 
 		var userid string
 		if users != nil {
@@ -82,13 +87,68 @@ func makeWSHandler(connectionCounter channelling.ConnectionCounter, sessionManag
 			}
 		}
 
+		// Refuse new anonymous connections when shedding load.
+		if loadShedder != nil && !loadShedder.AllowConnection(userid != "") {
+			w.Header().Set("Retry-After", "30")
+			http.Error(w, "Server overloaded", http.StatusServiceUnavailable)
+			return
+		}
+
+		// Upgrade to Websocket mode.
+		ws, err := upgrader.Upgrade(w, r, header)
+		if _, ok := err.(websocket.HandshakeError); ok {
+			return
+		} else if err != nil {
+			log.Println(err)
+			return
+		}
+
 		// Create a new connection instance.
 		session := sessionManager.CreateSession(st, userid)
+		session.RemoteIP = server.RemoteIP(config, r)
+		if config.PrivacyMode || r.FormValue("p") == "1" {
+			session.SetPrivate(true)
+		}
 		client := channelling.NewClient(codec, channellingAPI, session)
+		if tracer != nil {
+			client.Tracer = tracer
+		}
+		client.Network = networkSimulator
+		client.Catalogs = messageCatalogs
 		conn := channelling.NewConnection(connectionCounter.CountConnection(), ws, client)
 
-		// Start pumps (readPump blocks).
-		go conn.WritePump()
+		// Start pumps (readPump blocks). A panic closes the connection.
+		sessionID := session.Id
+		if session.Private() {
+			sessionID = ""
+		}
+		go func() {
+			defer panicRecovery.Recover("writepump", sessionID, conn.Close)
+			conn.WritePump()
+		}()
+		defer panicRecovery.Recover("readpump", sessionID, func() {
+			conn.Close()
+			client.OnDisconnect()
+		})
 		conn.ReadPump()
 	}
 }
+
+// checkAffinity logs reconnects which were routed to a different node than
+// the one named in their affinity token.
+func checkAffinity(config *channelling.Config, affinity channelling.Affinity, r *http.Request) {
+	token := r.URL.Query().Get("a")
+	if token == "" {
+		if cookie, err := r.Cookie(config.AffinityCookie); err == nil {
+			token = cookie.Value
+		}
+	}
+	if token == "" {
+		return
+	}
+	if node, ok := affinity.VerifyAffinityToken(token); !ok {
+		log.Println("Ignoring invalid affinity token")
+	} else if node != affinity.Node() {
+		log.Printf("Reconnect for node %s was routed to node %s\n", node, affinity.Node())
+	}
+}
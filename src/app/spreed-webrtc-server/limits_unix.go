@@ -0,0 +1,57 @@
+// +build !windows
+
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package main
+
+import (
+	"log"
+	"syscall"
+
+	"github.com/strukturag/phoenix"
+)
+
+// setMaxOpenFiles logs the maximum number of open files and raises it to
+// maxfd of the [http] section if set.
+func setMaxOpenFiles(runtime phoenix.Runtime) {
+	// Get current number of max open files.
+	var rLimit syscall.Rlimit
+	err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &rLimit)
+	if err != nil {
+		log.Println("Error getting max numer of open files", err)
+	} else {
+		log.Printf("Max open files are %d\n", rLimit.Max)
+	}
+
+	// Try to increase number of file open files. This only works as root.
+	maxfd, err := runtime.GetInt("http", "maxfd")
+	if err == nil {
+		rLimit.Max = rlimitType(maxfd)
+		rLimit.Cur = rlimitType(maxfd)
+		err = syscall.Setrlimit(syscall.RLIMIT_NOFILE, &rLimit)
+		if err != nil {
+			log.Println("Error setting max open files", err)
+		} else {
+			log.Printf("Set max open files successfully to %d\n", rlimitType(maxfd))
+		}
+	}
+}
@@ -32,18 +32,21 @@ import (
 	"net/http"
 	_ "net/http/pprof"
 	"os"
-	"path"
 	"path/filepath"
 	goruntime "runtime"
 	"sort"
 	"strings"
-	"syscall"
+	"sync/atomic"
 	"time"
 
 	"github.com/strukturag/spreed-webrtc/go/channelling"
 	"github.com/strukturag/spreed-webrtc/go/channelling/api"
 	"github.com/strukturag/spreed-webrtc/go/channelling/server"
+	"github.com/strukturag/spreed-webrtc/go/idgen"
 	"github.com/strukturag/spreed-webrtc/go/natsconnection"
+	"github.com/strukturag/spreed-webrtc/go/objectstore"
+	"github.com/strukturag/spreed-webrtc/go/plugins"
+	"github.com/strukturag/spreed-webrtc/go/stun"
 
 	"github.com/gorilla/mux"
 	"github.com/strukturag/httputils"
@@ -59,7 +62,20 @@ var templatesExtraDHead template.HTML
 var templatesExtraDBody template.HTML
 var config *channelling.Config
 
-func runner(runtime phoenix.Runtime) error {
+// runner runs the server with runtime. It returns after shutting down when
+// runtime stopped. When running as service, closing stop stops runtime.
+func runner(runtime phoenix.Runtime, stop <-chan bool) error {
+	started := time.Now()
+	runtime, err := newSecretsRuntime(runtime)
+	if err != nil {
+		return err
+	}
+	keyring := secretsKeyring(runtime)
+	runtime, err = newVaultRuntime(runtime)
+	if err != nil {
+		return err
+	}
+
 	log.SetFlags(log.LstdFlags | log.Lmicroseconds)
 
 	rootFolder, err := runtime.GetString("http", "root")
@@ -75,7 +91,7 @@ func runner(runtime phoenix.Runtime) error {
 		return fmt.Errorf("Configured root '%s' is not a directory.", rootFolder)
 	}
 
-	if !httputils.HasFilePath(path.Join(rootFolder, "static", "css", "main.min.css")) {
+	if !httputils.HasFilePath(filepath.Join(rootFolder, "static", "css", "main.min.css")) {
 		return fmt.Errorf("Unable to find client. Path correct and compiled css?")
 	}
 
@@ -97,6 +113,46 @@ func runner(runtime phoenix.Runtime) error {
 		pipelinesEnabled = false
 	}
 
+	roomLinksEnabled, err := runtime.GetBool("app", "roomLinks")
+	if err != nil {
+		roomLinksEnabled = false
+	}
+	roomLinksMaxTTL, err := runtime.GetInt("app", "roomLinksMaxTTL")
+	if err != nil || roomLinksMaxTTL <= 0 {
+		roomLinksMaxTTL = 86400
+	}
+
+	adminEnabled, err := runtime.GetBool("admin", "enabled")
+	if err != nil {
+		adminEnabled = false
+	}
+	adminSecret, _ := runtime.GetString("admin", "secret")
+	if adminEnabled && len(adminSecret) < 16 {
+		return fmt.Errorf("Length of admin secret must be at least 16 bytes.")
+	}
+	adminRotationGrace, err := runtime.GetInt("admin", "rotationGrace")
+	if err != nil {
+		adminRotationGrace = 86400
+	}
+	var adminTokens []*server.AdminToken
+	if options, _ := runtime.GetOptions("admin-tokens"); adminEnabled && len(options) > 0 {
+		for _, name := range options {
+			secret, _ := runtime.GetString("admin-tokens", name)
+			if len(secret) < 16 {
+				return fmt.Errorf("Length of admin token %s must be at least 16 bytes.", name)
+			}
+			role := server.AdminRoleViewer
+			if value, _ := runtime.GetString("admin-roles", name); value != "" {
+				role = value
+			}
+			if !server.IsAdminRole(role) {
+				return fmt.Errorf("Unknown role %s of admin token %s.", role, name)
+			}
+			adminTokens = append(adminTokens, &server.AdminToken{Name: name, Role: role, Secret: secret})
+		}
+		log.Printf("Loaded %d admin tokens\n", len(adminTokens))
+	}
+
 	var sessionSecret []byte
 	sessionSecretString, err := runtime.GetString("app", "sessionSecret")
 	if err != nil {
@@ -147,7 +203,7 @@ func runner(runtime phoenix.Runtime) error {
 	// Create token provider.
 	tokenFile, err := runtime.GetString("app", "tokenFile")
 	if err == nil {
-		if !httputils.HasFilePath(path.Clean(tokenFile)) {
+		if !httputils.HasFilePath(filepath.Clean(tokenFile)) {
 			return fmt.Errorf("Unable to find token file at %s", tokenFile)
 		}
 	}
@@ -179,12 +235,26 @@ func runner(runtime phoenix.Runtime) error {
 		return err
 	}
 
+	// Derive the static URL version from the asset contents if enabled, so
+	// client caches stay valid until the assets change.
+	if fingerprint, _ := runtime.GetBool("app", "fingerprint"); fingerprint {
+		ver, err := fingerprintStatic(filepath.Join(rootFolder, "static"))
+		if err != nil {
+			return fmt.Errorf("Failed to fingerprint static assets: %s", err)
+		}
+		config.Ver = ver
+		config.S = fmt.Sprintf("static/ver=%s", ver)
+		log.Printf("Using static assets fingerprint %s\n", ver)
+	}
+
+	supportedLanguages = loadSupportedLanguages(filepath.Join(rootFolder, "static", "translation"))
+
 	// Load templates.
 	templates = template.New("")
 	templates.Delims("<%", "%>")
 
 	// Load html templates folder
-	err = filepath.Walk(path.Join(rootFolder, "html"), func(path string, info os.FileInfo, err error) error {
+	err = filepath.Walk(filepath.Join(rootFolder, "html"), func(path string, info os.FileInfo, err error) error {
 		if err == nil {
 			if strings.HasSuffix(path, ".html") {
 				_, err = templates.ParseFiles(path)
@@ -205,7 +275,7 @@ func runner(runtime phoenix.Runtime) error {
 		if !httputils.HasDirPath(extraFolder) {
 			return fmt.Errorf("Configured extra '%s' is not a directory.", extraFolder)
 		}
-		templates, err = templates.ParseGlob(path.Join(extraFolder, "*.html"))
+		templates, err = templates.ParseGlob(filepath.Join(extraFolder, "*.html"))
 		if err != nil {
 			return fmt.Errorf("Failed to load extra templates: %s", err)
 		}
@@ -225,47 +295,52 @@ func runner(runtime phoenix.Runtime) error {
 	}
 
 	// Define incoming channeling API limit it byte. Larger messages will be discarded.
-	incomingCodecLimit := 1024 * 1024 // 1MB
+	incomingCodecLimit, err := runtime.GetInt("app", "maxMessageSize")
+	if err != nil || incomingCodecLimit <= 0 {
+		incomingCodecLimit = 1024 * 1024 // 1MB
+	}
+	messageLimits := make(map[string]int)
+	for messageType, limit := range channelling.DefaultMessageLimits {
+		messageLimits[messageType] = limit
+	}
+	if options, _ := runtime.GetOptions("messagelimits"); len(options) > 0 {
+		for _, messageType := range options {
+			if limit, err := runtime.GetInt("messagelimits", messageType); err == nil && limit > 0 {
+				messageLimits[messageType] = limit
+			} else {
+				delete(messageLimits, messageType)
+			}
+		}
+	}
 
 	// Create realm string from config.
 	computedRealm := fmt.Sprintf("%s.%s", serverRealm, config.Token)
 
-	// Set number of go routines if it is 1
-	if goruntime.GOMAXPROCS(0) == 1 {
+	// Size the runtime to the CPU and memory limits of the container.
+	var resourceLimits *channelling.ResourceLimits
+	if containerLimits, err := runtime.GetBool("app", "containerLimits"); err != nil || containerLimits {
+		resourceLimits = channelling.DetectResourceLimits()
+		resourceLimits.Apply()
+		if resourceLimits.Source != channelling.ResourceLimitsHost {
+			log.Printf("Using GOMAXPROCS %d and GC percent %d for the %s limits of %.2f CPU's and %d MiB memory (0 is unlimited)\n", resourceLimits.GOMAXPROCS, resourceLimits.GCPercent, resourceLimits.Source, resourceLimits.CPUs, resourceLimits.Memory/1024/1024)
+		}
+	} else if goruntime.GOMAXPROCS(0) == 1 {
+		// Set number of go routines if it is 1
 		nCPU := goruntime.NumCPU()
 		goruntime.GOMAXPROCS(nCPU)
 		log.Printf("Using the number of CPU's (%d) as GOMAXPROCS\n", nCPU)
 	}
 
-	// Get current number of max open files.
-	var rLimit syscall.Rlimit
-	err = syscall.Getrlimit(syscall.RLIMIT_NOFILE, &rLimit)
-	if err != nil {
-		log.Println("Error getting max numer of open files", err)
-	} else {
-		log.Printf("Max open files are %d\n", rLimit.Max)
-	}
-
-	// Try to increase number of file open files. This only works as root.
-	maxfd, err := runtime.GetInt("http", "maxfd")
-	if err == nil {
-		rLimit.Max = rlimitType(maxfd)
-		rLimit.Cur = rlimitType(maxfd)
-		err = syscall.Setrlimit(syscall.RLIMIT_NOFILE, &rLimit)
-		if err != nil {
-			log.Println("Error setting max open files", err)
-		} else {
-			log.Printf("Set max open files successfully to %d\n", rlimitType(maxfd))
-		}
-	}
+	setMaxOpenFiles(runtime)
 
 	// Create router.
 	router := mux.NewRouter()
 	r := router.PathPrefix(config.B).Subrouter().StrictSlash(true)
+	handler := makeSecurityHeadersHandler(r)
 
 	// HTTP listener support.
 	if _, err = runtime.GetString("http", "listen"); err == nil {
-		runtime.DefaultHTTPHandler(r)
+		runtime.DefaultHTTPHandler(handler)
 	}
 
 	// Native HTTPS listener support.
@@ -278,54 +353,514 @@ func runner(runtime phoenix.Runtime) error {
 		// Explicitly set random to use.
 		tlsConfig.Rand = rand.Reader
 		log.Println("Native TLS configuration intialized")
-		runtime.DefaultHTTPSHandler(r)
+		runtime.DefaultHTTPSHandler(handler)
+	}
+
+	// Unix socket and systemd socket activation support.
+	if err = startListeners(runtime, handler); err != nil {
+		return err
 	}
 
 	// Prepare services.
 	apiConsumer := channelling.NewChannellingAPIConsumer()
-	buddyImages := channelling.NewImageCache()
-	codec := channelling.NewCodec(incomingCodecLimit)
-	roomManager := channelling.NewRoomManager(config, codec)
+	objectStore, objectHandler, err := loadObjectStore(runtime, sessionSecret)
+	if err != nil {
+		return err
+	}
+	objectExpires, err := runtime.GetInt("objectstore", "expires")
+	if err != nil || objectExpires <= 0 {
+		objectExpires = 3600
+	}
+	buddyImages, err := loadBuddyImages(runtime, objectStore)
+	if err != nil {
+		return err
+	}
+	codec := channelling.NewCodec(incomingCodecLimit, messageLimits)
+	var stepUpVerifier channelling.StepUpVerifier
+	if stepUpEnabled, _ := runtime.GetBool("stepup", "enabled"); stepUpEnabled {
+		secrets := make(map[string]string)
+		if options, _ := runtime.GetOptions("stepup-totp"); len(options) > 0 {
+			for _, userid := range options {
+				secrets[userid], _ = runtime.GetString("stepup-totp", userid)
+			}
+		}
+		stepUpVerifier = channelling.NewTOTPVerifier(secrets)
+		log.Printf("Step-up authentication is enabled for %d users\n", len(secrets))
+	}
+	pluginHost, err := loadPlugins(runtime)
+	if err != nil {
+		return err
+	}
+	if pluginHost != nil {
+		defer pluginHost.Close()
+	}
+	var roomLinks channelling.RoomLinks
+	if roomLinksEnabled {
+		roomLinks = channelling.NewRoomLinks(sessionSecret, time.Duration(roomLinksMaxTTL)*time.Second)
+		log.Println("Room links are enabled!")
+	}
+	roomManager := channelling.NewRoomManager(config, codec, roomLinks)
 	hub := channelling.NewHub(config, sessionSecret, encryptionSecret, turnSecret, codec)
 	tickets := channelling.NewTickets(sessionSecret, encryptionSecret, computedRealm)
+	idScheme, _ := runtime.GetString("app", "idScheme")
+	idGenerator, err := idgen.New(idScheme)
+	if err != nil {
+		return fmt.Errorf("Invalid idScheme: %s", err)
+	}
+	if idGenerator != nil {
+		tickets.SetIDGenerator(idGenerator)
+		log.Printf("Using %s identifiers\n", idScheme)
+	}
 	sessionManager := channelling.NewSessionManager(config, tickets, hub, roomManager, roomManager, buddyImages, sessionSecret)
-	statsManager := channelling.NewStatsManager(hub, roomManager, sessionManager)
 	busManager := channelling.NewBusManager(apiConsumer, natsClientId, natsChannellingTrigger, natsChannellingTriggerSubject)
-	pipelineManager := channelling.NewPipelineManager(busManager, sessionManager, sessionManager, sessionManager)
+	busEncryption, err := loadBusEncryption(runtime, hub)
+	if err != nil {
+		return err
+	}
+	if busEncryption != nil {
+		busManager.SetEncryption(busEncryption)
+		roomManager.SetBusEncryption(busEncryption)
+	}
+	var extensionsChain []channelling.Extensions
+	var hooks channelling.Hooks
+	if hooksScript, _ := runtime.GetString("app", "hooksScript"); hooksScript != "" {
+		if hooks, err = channelling.LoadHooksScript(hooksScript); err != nil {
+			return fmt.Errorf("Failed to load hooks script: %s", err)
+		}
+		defer hooks.Close()
+		extensionsChain = append(extensionsChain, hooks)
+		log.Printf("Loaded hooks script %s\n", hooksScript)
+	}
+	if pluginHost != nil {
+		extensionsChain = append(extensionsChain, channelling.NewPluginExtensions(pluginHost))
+		busManager = channelling.NewExtensionsBusManager(busManager, pluginHost)
+	}
+	if joinWebhook, _ := runtime.GetString("app", "joinWebhook"); joinWebhook != "" {
+		joinWebhookSecret, _ := runtime.GetString("app", "joinWebhookSecret")
+		joinWebhookTimeout, err := runtime.GetInt("app", "joinWebhookTimeout")
+		if err != nil || joinWebhookTimeout <= 0 {
+			joinWebhookTimeout = 5
+		}
+		joinWebhookFailOpen, _ := runtime.GetBool("app", "joinWebhookFailOpen")
+		extensionsChain = append(extensionsChain, channelling.NewJoinWebhook(joinWebhook, []byte(joinWebhookSecret), time.Duration(joinWebhookTimeout)*time.Second, joinWebhookFailOpen))
+		log.Printf("Room joins are authorized by %s\n", joinWebhook)
+	}
+	var extensions channelling.Extensions
+	if len(extensionsChain) > 0 {
+		extensions = channelling.ChainExtensions(extensionsChain...)
+	}
+	var callScreeners []channelling.CallScreener
+	if callRouting, _ := runtime.GetString("app", "callRouting"); callRouting != "" {
+		location := time.Local
+		if timezone, _ := runtime.GetString("app", "callRoutingTimezone"); timezone != "" {
+			if location, err = time.LoadLocation(timezone); err != nil {
+				return fmt.Errorf("Invalid call routing timezone: %s", err)
+			}
+		}
+		rules, err := channelling.LoadCallRoutingRules(callRouting, location)
+		if err != nil {
+			return fmt.Errorf("Failed to load call routing rules: %s", err)
+		}
+		callScreeners = append(callScreeners, rules)
+		log.Printf("Loaded call routing rules %s\n", callRouting)
+	}
+	if hooks != nil {
+		callScreeners = append(callScreeners, hooks)
+	}
+	if callScreeningWebhook, _ := runtime.GetString("app", "callScreeningWebhook"); callScreeningWebhook != "" {
+		callScreeningWebhookSecret, _ := runtime.GetString("app", "callScreeningWebhookSecret")
+		callScreeningWebhookTimeout, err := runtime.GetInt("app", "callScreeningWebhookTimeout")
+		if err != nil || callScreeningWebhookTimeout <= 0 {
+			callScreeningWebhookTimeout = 5
+		}
+		callScreeningWebhookFailOpen, _ := runtime.GetBool("app", "callScreeningWebhookFailOpen")
+		callScreeners = append(callScreeners, channelling.NewCallScreeningWebhook(callScreeningWebhook, []byte(callScreeningWebhookSecret), time.Duration(callScreeningWebhookTimeout)*time.Second, callScreeningWebhookFailOpen))
+		log.Printf("Calls are screened by %s\n", callScreeningWebhook)
+	}
+	if pluginHost != nil && pluginHost.Has(plugins.CapabilityScreening) {
+		callScreeners = append(callScreeners, channelling.NewPluginCallScreener(pluginHost))
+	}
+	var callScreener channelling.CallScreener
+	if len(callScreeners) > 0 {
+		callScreener = channelling.ChainCallScreeners(callScreeners...)
+	}
+	pipelineManager := channelling.NewPipelineManager(config, busManager, sessionManager, sessionManager, sessionManager)
+	authLimiter := channelling.NewAuthLimiter(config, busManager)
+	stepUpManager := channelling.NewStepUpManager(config, stepUpVerifier, authLimiter)
+	statsManager := channelling.NewStatsManager(hub, roomManager, sessionManager, pipelineManager, authLimiter)
+
+	// Recover panics of connections and handlers, optionally reported to Sentry.
+	var panicReporter channelling.PanicReporter
+	if sentryDSN, _ := runtime.GetString("app", "sentryDSN"); sentryDSN != "" {
+		if panicReporter, err = channelling.NewSentryReporter(sentryDSN, version, 10*time.Second); err != nil {
+			return fmt.Errorf("Invalid Sentry DSN: %s", err)
+		}
+		log.Println("Panics are reported to Sentry")
+	}
+	panicRecovery := channelling.NewPanicRecovery(panicReporter)
+	statsManager.SetPanicRecovery(panicRecovery)
+
+	// Load shedding when short of memory.
+	var loadShedder channelling.LoadShedder
+	shedAnonymous, _ := runtime.GetInt("app", "memoryShedAnonymous")
+	shedRooms, _ := runtime.GetInt("app", "memoryShedRooms")
+	shedCalls, _ := runtime.GetInt("app", "memoryShedCalls")
+	shedContainer, _ := runtime.GetBool("app", "memoryShedContainer")
+	if shedContainer && shedAnonymous <= 0 && shedRooms <= 0 && shedCalls <= 0 && resourceLimits != nil && resourceLimits.Memory > 0 {
+		anonymous, rooms, calls := resourceLimits.MemoryThresholds()
+		shedAnonymous, shedRooms, shedCalls = int(anonymous/1024/1024), int(rooms/1024/1024), int(calls/1024/1024)
+	}
+	if shedAnonymous > 0 || shedRooms > 0 || shedCalls > 0 {
+		memoryCheckInterval, err := runtime.GetInt("app", "memoryCheckInterval")
+		if err != nil || memoryCheckInterval <= 0 {
+			memoryCheckInterval = 5
+		}
+		loadShedder = channelling.NewLoadShedder(uint64(shedAnonymous)*1024*1024, uint64(shedRooms)*1024*1024, uint64(shedCalls)*1024*1024, time.Duration(memoryCheckInterval)*time.Second)
+		defer loadShedder.Stop()
+		roomManager.SetLoadShedder(loadShedder)
+		statsManager.SetLoadShedder(loadShedder)
+		log.Printf("Load shedding is enabled (anonymous connections at %d MiB, rooms at %d MiB, calls at %d MiB heap)\n", shedAnonymous, shedRooms, shedCalls)
+	}
 	if err := roomManager.SetBusManager(busManager); err != nil {
 		return err
 	}
 
 	// Create API.
-	channellingAPI := api.New(config, roomManager, tickets, sessionManager, statsManager, hub, hub, hub, busManager, pipelineManager)
+	var affinity channelling.Affinity
+	if config.AffinityNode != "" {
+		affinity, err = channelling.NewAffinity(config.AffinityNode, sessionSecret)
+		if err != nil {
+			return err
+		}
+		log.Printf("Session affinity is enabled for node %s\n", config.AffinityNode)
+	}
+	blocklist, err := channelling.NewBlocklist(config.BlocklistFile)
+	if err != nil {
+		return fmt.Errorf("Failed to load blocklists: %s", err)
+	}
+	hub.SetBlocklist(blocklist)
+	roomManager.SetBlocklist(blocklist)
+	favorites, err := channelling.NewFavorites(config.FavoritesFile)
+	if err != nil {
+		return fmt.Errorf("Failed to load favorites: %s", err)
+	}
+	var broadcastScheduler *channelling.BroadcastScheduler
+	broadcastWorkers, _ := runtime.GetInt("app", "broadcastWorkers")
+	if value, _ := runtime.GetString("app", "broadcastWorkers"); value == "auto" {
+		if resourceLimits != nil {
+			broadcastWorkers = resourceLimits.Workers()
+		} else {
+			broadcastWorkers = 2 * goruntime.GOMAXPROCS(0)
+		}
+	}
+	if broadcastWorkers > 0 {
+		broadcastQuantum, _ := runtime.GetInt("app", "broadcastQuantum")
+		broadcastScheduler = channelling.NewBroadcastScheduler(broadcastWorkers, broadcastQuantum)
+		defer broadcastScheduler.Stop()
+		roomManager.SetBroadcastScheduler(broadcastScheduler)
+		log.Printf("Room broadcasts are scheduled fairly with %d workers\n", broadcastWorkers)
+	}
+	terms := channelling.NewTerms(config)
+	announcements, err := channelling.NewAnnouncementScheduler(hub, config.AnnouncementsFile, config.Motd)
+	if err != nil {
+		return fmt.Errorf("Failed to load scheduled announcements: %s", err)
+	}
+	announcements.Start()
+	defer announcements.Stop()
+	var chatFilters []channelling.ChatFilter
+	if config.ChatFilterWordList != "" {
+		wordList, err := channelling.LoadWordListChatFilter(config.ChatFilterWordList, config.ChatFilterAction)
+		if err != nil {
+			return fmt.Errorf("Failed to load chat filter word list: %s", err)
+		}
+		chatFilters = append(chatFilters, wordList)
+		log.Printf("Chat messages are filtered with %s (%s)\n", config.ChatFilterWordList, config.ChatFilterAction)
+	}
+	if hooks != nil {
+		chatFilters = append(chatFilters, hooks)
+	}
+	if pluginHost != nil && pluginHost.Has(plugins.CapabilityChatFilter) {
+		chatFilters = append(chatFilters, channelling.NewPluginChatFilter(pluginHost))
+	}
+	var chatFilter channelling.ChatFilter
+	if len(chatFilters) > 0 {
+		chatFilter = channelling.ChainChatFilters(chatFilters...)
+	}
+	var blobScanner channelling.BlobScanner
+	if blobScannerURL, _ := runtime.GetString("app", "blobScanner"); blobScannerURL != "" {
+		blobScannerSecret, _ := runtime.GetString("app", "blobScannerSecret")
+		blobScannerTimeout, err := runtime.GetInt("app", "blobScannerTimeout")
+		if err != nil || blobScannerTimeout <= 0 {
+			blobScannerTimeout = 30
+		}
+		blobScannerFailOpen, _ := runtime.GetBool("app", "blobScannerFailOpen")
+		blobScanner, err = channelling.NewBlobScanner(blobScannerURL, []byte(blobScannerSecret), time.Duration(blobScannerTimeout)*time.Second, blobScannerFailOpen)
+		if err != nil {
+			return fmt.Errorf("Failed to create blob scanner: %s", err)
+		}
+		log.Printf("Relayed blobs are scanned by %s\n", blobScannerURL)
+	}
+	// Signaling traces of selected sessions.
+	var tracer *channelling.SessionTracer
+	traceFile, _ := runtime.GetString("app", "traceFile")
+	traceSubject, _ := runtime.GetString("app", "traceSubject")
+	if traceFile != "" || traceSubject != "" {
+		traceRedact := channelling.DefaultTraceRedact
+		if value, _ := runtime.GetString("app", "traceRedact"); value == "none" {
+			traceRedact = nil
+		} else if value != "" {
+			traceRedact = strings.Fields(value)
+		}
+		var traceWriter channelling.TraceWriter
+		if traceSubject != "" {
+			traceWriter = channelling.NewBusTrace(busManager, traceSubject)
+			log.Printf("Signaling traces are published to %s\n", traceSubject)
+		} else {
+			traceWriter, err = channelling.NewTraceFile(traceFile)
+			if err != nil {
+				return fmt.Errorf("Failed to open trace file: %s", err)
+			}
+			log.Printf("Signaling traces are written to %s\n", traceFile)
+		}
+		tracer = channelling.NewSessionTracer(traceWriter, traceRedact)
+	}
+	// Simulated network conditions for testing clients.
+	var networkSimulator *channelling.NetworkSimulator
+	if enabled, _ := runtime.GetBool("app", "networkSimulator"); enabled {
+		networkDelay, _ := runtime.GetInt("app", "networkDelay")
+		networkJitter, _ := runtime.GetInt("app", "networkJitter")
+		networkDrop, _ := runtime.GetInt("app", "networkDrop")
+		if networkDelay < 0 || networkJitter < 0 || networkDrop < 0 || networkDrop > 100 {
+			return fmt.Errorf("Invalid simulated network conditions.")
+		}
+		var defaults *channelling.NetworkConditions
+		if networkDelay > 0 || networkJitter > 0 || networkDrop > 0 {
+			defaults = &channelling.NetworkConditions{
+				Delay:  time.Duration(networkDelay) * time.Millisecond,
+				Jitter: time.Duration(networkJitter) * time.Millisecond,
+				Drop:   float64(networkDrop) / 100,
+			}
+		}
+		networkSimulator = channelling.NewNetworkSimulator(defaults)
+		log.Println("Network simulator is enabled, do not use this in production!")
+	}
+	// Translations of server-generated messages.
+	var messageCatalogs *channelling.MessageCatalogs
+	if messageCatalogsPath, _ := runtime.GetString("app", "messageCatalogs"); messageCatalogsPath != "" {
+		defaultLocale, err := runtime.GetString("app", "defaultLocale")
+		if err != nil || defaultLocale == "" {
+			defaultLocale = "en"
+		}
+		messageCatalogs, err = channelling.LoadMessageCatalogs(messageCatalogsPath, defaultLocale)
+		if err != nil {
+			return fmt.Errorf("Failed to load message catalogs: %s", err)
+		}
+		hub.SetMessageCatalogs(messageCatalogs)
+		log.Printf("Loaded message catalogs for %d locales from %s\n", messageCatalogs.Len(), messageCatalogsPath)
+	}
+	blobRelay := channelling.NewBlobRelay(config)
+	if relayBlobs, _ := runtime.GetBool("objectstore", "blobs"); relayBlobs {
+		if objectStore == nil {
+			return fmt.Errorf("Storing blobs needs an object store")
+		}
+		blobRelay.SetObjectStore(objectStore, time.Duration(objectExpires)*time.Second)
+	}
+	dialOut := loadDialOut(runtime, busManager, natsChannellingTrigger)
+	var roomSearcher channelling.RoomSearcher
+	if config.RoomSearchEnabled {
+		roomSearcher = roomManager
+	}
+	var userDirectory channelling.UserDirectory
+	if directoryEnabled, _ := runtime.GetBool("directory", "enabled"); directoryEnabled {
+		discoverability, _ := runtime.GetString("directory", "discoverability")
+		if discoverability == "" {
+			discoverability = channelling.DirectoryHidden
+		}
+		if !channelling.ValidDiscoverability(discoverability) {
+			return fmt.Errorf("Invalid directory discoverability: %s", discoverability)
+		}
+		userDirectory = channelling.NewUserDirectory(sessionManager, discoverability)
+		log.Printf("User directory is enabled, users are %s by default\n", discoverability)
+	}
+	chatIndex, err := loadChatIndex(runtime)
+	if err != nil {
+		return err
+	}
+	surveys, err := loadSurveys(runtime)
+	if err != nil {
+		return err
+	}
+	channellingAPI := api.New(config, api.Dependencies{
+		RoomStatusManager: roomManager,
+		SessionEncoder:    tickets,
+		SessionManager:    sessionManager,
+		StatsCounter:      statsManager,
+		ContactManager:    hub,
+		TurnDataCreator:   hub,
+		Unicaster:         hub,
+		BusManager:        busManager,
+		PipelineManager:   pipelineManager,
+		RoomLinks:         roomLinks,
+		StepUpManager:     stepUpManager,
+		AuthLimiter:       authLimiter,
+		Extensions:        extensions,
+		BlobRelay:         blobRelay,
+		Affinity:          affinity,
+		Terms:             terms,
+		Announcements:     announcements,
+		Blocklist:         blocklist,
+		SpamFilter:        channelling.NewSpamFilter(config),
+		ChatFilter:        chatFilter,
+		BlobScanner:       blobScanner,
+		LoadShedder:       loadShedder,
+		DialOut:           dialOut,
+		CallScreener:      callScreener,
+		Surveys:           surveys,
+		ChatIndex:         chatIndex,
+		RoomSearcher:      roomSearcher,
+		UserDirectory:     userDirectory,
+		Favorites:         favorites,
+		PanicRecovery:     panicRecovery,
+	})
 	apiConsumer.SetChannellingAPI(channellingAPI)
 
+	// Built-in STUN server support.
+	if config.StunListen != "" {
+		stunServer, err := stun.Listen(config.StunListen)
+		if err != nil {
+			return fmt.Errorf("Failed to start STUN server: %s", err)
+		}
+		defer stunServer.Close()
+		log.Printf("Starting STUN server on %s\n", stunServer.Addr())
+		go stunServer.Serve()
+	}
+
+	// TURN usage reporting support.
+	var turnUsage channelling.TurnUsage
+	if config.TurnUsageLog != "" {
+		turnUsage = channelling.NewTurnUsage(hub)
+		if err := turnUsage.Tail(config.TurnUsageLog); err != nil {
+			return fmt.Errorf("Failed to read TURN usage log: %s", err)
+		}
+		defer turnUsage.Stop()
+		hub.SetTurnUsage(turnUsage)
+		log.Printf("Reading TURN usage from %s\n", config.TurnUsageLog)
+	}
+
 	// Start bus.
 	busManager.Start()
 
+	// Join cluster.
+	clusterNode := config.AffinityNode
+	if clusterNode == "" {
+		clusterNode = natsClientId
+	}
+	if clusterNode == "" {
+		clusterNode, _ = os.Hostname()
+	}
+	cluster := channelling.NewCluster(config, clusterNode, busManager, statsManager)
+	if err := cluster.Start(); err != nil {
+		return err
+	}
+	defer cluster.Stop()
+	if len(config.BusBridgeVersions) > 0 {
+		busBridge := channelling.NewBusBridge(busManager, cluster, config.BusBridgeVersions)
+		if err := busBridge.Start(); err != nil {
+			return err
+		}
+		defer busBridge.Stop()
+		log.Printf("Bridging bus protocol versions %v\n", config.BusBridgeVersions)
+	}
+	userPresence := channelling.NewUserPresence(cluster, busManager)
+	if err := userPresence.Start(); err != nil {
+		return err
+	}
+	defer userPresence.Stop()
+	sessionManager.SetUserPresence(userPresence)
+	revocations := channelling.NewSessionRevocations(cluster, busManager, tickets)
+	if err := revocations.Start(); err != nil {
+		return err
+	}
+	defer revocations.Stop()
+
+	// Retention of stored data.
+	userData := channelling.NewUserData(sessionManager, roomManager, tickets, turnUsage, chatIndex, favorites, blocklist, terms)
+	retention := channelling.NewRetentionJanitor(config)
+	retention.Register(channelling.RetentionParticipants, roomManager)
+	retention.Register(channelling.RetentionErasures, userData)
+	if turnUsage != nil {
+		retention.Register(channelling.RetentionTurnUsage, turnUsage)
+	}
+	if terms != nil {
+		retention.Register(channelling.RetentionTerms, terms)
+	}
+	if chatIndex != nil {
+		if backend, _ := runtime.GetString("chatindex", "backend"); backend == channelling.ChatIndexElasticsearch {
+			// All nodes share the index, expire it once on the leader.
+			retention.Register(channelling.RetentionChatIndex, channelling.NewLeaderRetentionStore(cluster, chatIndex))
+		} else {
+			retention.Register(channelling.RetentionChatIndex, chatIndex)
+		}
+	}
+	retention.Start()
+	defer retention.Stop()
+
+	// Restore state of the previous server and hand it over on shutdown.
+	if config.SnapshotFile != "" {
+		if snapshot, err := channelling.ReadSnapshotFile(config.SnapshotFile, config.SnapshotMaxAge, keyring); err != nil {
+			log.Println("Failed to read snapshot", err)
+		} else if snapshot != nil {
+			roomManager.RestoreRooms(snapshot.Rooms)
+			pipelineManager.RestoreSessions(snapshot.Sessions)
+			log.Printf("Restored %d rooms and %d sessions from snapshot\n", len(snapshot.Rooms), len(snapshot.Sessions))
+		}
+		defer func() {
+			snapshot := &channelling.Snapshot{
+				Rooms:    roomManager.SnapshotRooms(),
+				Sessions: pipelineManager.SnapshotSessions(),
+			}
+			if err := channelling.WriteSnapshotFile(config.SnapshotFile, snapshot, keyring); err != nil {
+				log.Println("Failed to write snapshot", err)
+			} else {
+				log.Printf("Wrote snapshot with %d rooms and %d sessions\n", len(snapshot.Rooms), len(snapshot.Sessions))
+			}
+		}()
+	}
+
 	// Add handlers.
 	r.HandleFunc("/", httputils.MakeGzipHandler(mainHandler))
 	r.Handle("/static/img/buddy/{flags}/{imageid}/{idx:.*}", http.StripPrefix(config.B, makeImageHandler(buddyImages, time.Duration(24)*time.Hour)))
-	r.Handle("/static/{path:.*}", http.StripPrefix(config.B, httputils.FileStaticServer(http.Dir(rootFolder))))
-	r.Handle("/robots.txt", http.StripPrefix(config.B, http.FileServer(http.Dir(path.Join(rootFolder, "static")))))
-	r.Handle("/favicon.ico", http.StripPrefix(config.B, http.FileServer(http.Dir(path.Join(rootFolder, "static", "img")))))
+	r.Handle("/static/{path:.*}", makePrecompressedHandler(filepath.Join(rootFolder, "static"), http.StripPrefix(config.B, httputils.FileStaticServer(http.Dir(rootFolder)))))
+	r.Handle("/robots.txt", http.StripPrefix(config.B, http.FileServer(http.Dir(filepath.Join(rootFolder, "static")))))
+	r.Handle("/favicon.ico", http.StripPrefix(config.B, http.FileServer(http.Dir(filepath.Join(rootFolder, "static", "img")))))
+	if objectHandler != nil {
+		r.PathPrefix("/objects/").Handler(http.StripPrefix(config.B+"objects", objectHandler))
+	}
 	r.HandleFunc("/.well-known/spreed-configuration", wellKnownHandler)
+	if config.ContentSecurityPolicyReport {
+		r.HandleFunc("/api/v1/csp-report", cspReportHandler)
+	}
 
 	// Sandbox handler.
 	r.HandleFunc("/sandbox/{origin_scheme}/{origin_host}/{sandbox}.html", httputils.MakeGzipHandler(sandboxHandler))
 
 	// Add RESTful API end points.
-	rest := sloth.NewAPI()
+	openAPI := server.NewOpenAPI("Spreed WebRTC", version, strings.TrimSuffix(config.B, "/")+"/api/v1")
+	r.Handle("/.well-known/openapi.json", openAPI)
+	rest := &documentedAPI{sloth.NewAPI(), openAPI}
 	rest.SetMux(r.PathPrefix("/api/v1/").Subrouter())
-	rest.AddResource(&server.Rooms{}, "/rooms")
+	rest.AddResource(&server.Rooms{idGenerator}, "/rooms")
+	if config.RoomSearchEnabled {
+		rest.AddResource(&server.RoomSearch{roomManager}, "/rooms/search")
+	}
 	rest.AddResource(config, "/config")
 	rest.AddResourceWithWrapper(&server.Tokens{tokenProvider}, httputils.MakeGzipHandler, "/tokens")
 
 	var users *server.Users
 	if config.UsersEnabled {
 		// Create Users handler.
-		users = server.NewUsers(hub, tickets, sessionManager, config.UsersMode, serverRealm, runtime)
-		rest.AddResource(&server.Sessions{tickets, hub, users}, "/sessions/{id}/")
+		users = server.NewUsers(hub, tickets, sessionManager, config.UsersMode, serverRealm, runtime, pluginHost)
+		rest.AddResource(&server.Sessions{tickets, hub, users, authLimiter, config}, "/sessions/{id}/")
 		if config.UsersAllowRegistration {
 			rest.AddResource(users, "/users")
 		}
@@ -339,10 +874,67 @@ func runner(runtime phoenix.Runtime) error {
 		rest.AddResource(&server.Pipelines{pipelineManager, channellingAPI}, "/pipelines/{id}")
 		log.Println("Pipelines API is enabled!")
 	}
+	if adminEnabled {
+		currentAdminSecret := &atomic.Value{}
+		currentAdminSecret.Store(adminSecret)
+		if vaultRuntime, ok := runtime.(*vaultRuntime); ok {
+			vaultRuntime.OnRotate("admin", "secret", func(secret string) {
+				if len(secret) >= 16 {
+					currentAdminSecret.Store(secret)
+				}
+			})
+		}
+		adminAuthorizer := server.NewAdminTokens(func() string {
+			return currentAdminSecret.Load().(string)
+		}, adminTokens)
+		adminAuth := adminAuthorizer.Handler(server.AdminRoleAdmin)
+		dashboardAuth := adminAuthorizer.Handler(server.AdminRoleViewer)
+		rest.AddResourceWithWrapper(&server.AdminDashboardRooms{roomManager, roomManager}, dashboardAuth, "/admin/dashboard/rooms")
+		rest.AddResourceWithWrapper(&server.AdminDashboardSessions{hub, hub}, dashboardAuth, "/admin/dashboard/sessions")
+		rest.AddResourceWithWrapper(&server.AdminDashboardErrors{statsManager}, dashboardAuth, "/admin/dashboard/errors")
+		if loadShedder != nil {
+			rest.AddResourceWithWrapper(&server.AdminLoad{loadShedder}, dashboardAuth, "/admin/dashboard/load")
+		}
+		if broadcastScheduler != nil {
+			rest.AddResourceWithWrapper(&server.AdminDashboardBroadcasts{broadcastScheduler}, dashboardAuth, "/admin/dashboard/broadcasts")
+		}
+		rest.AddResourceWithWrapper(&server.AdminDashboardServer{statsManager, version, started, resourceLimits}, dashboardAuth, "/admin/dashboard/server")
+		rest.AddResourceWithWrapper(&server.AdminPipelines{pipelineManager}, adminAuth, "/admin/pipelines", "/admin/pipelines/{id}")
+		if roomLinks != nil {
+			rest.AddResourceWithWrapper(&server.AdminRoomLinks{roomLinks, config}, adminAuth, "/admin/roomlinks")
+		}
+		rest.AddResourceWithWrapper(&server.AdminCluster{cluster}, adminAuth, "/admin/cluster")
+		rest.AddResourceWithWrapper(&server.AdminMigrate{channelling.NewSessionMigrator(hub, hub, tickets)}, adminAuth, "/admin/migrate")
+		rest.AddResourceWithWrapper(&server.AdminSessions{hub}, adminAuth, "/admin/sessions")
+		rest.AddResourceWithWrapper(&server.AdminScreenShare{roomManager, roomManager}, adminAuth, "/admin/rooms/{name}/screenshare")
+		rest.AddResourceWithWrapper(&server.AdminRooms{roomManager, objectStore, time.Duration(objectExpires) * time.Second}, adminAuth, "/admin/rooms/{name}/export")
+		rest.AddResourceWithWrapper(&server.AdminAnnouncements{hub, roomManager}, adminAuth, "/admin/announcements")
+		rest.AddResourceWithWrapper(&server.AdminScheduledAnnouncements{announcements, roomManager}, adminAuth, "/admin/announcements/scheduled", "/admin/announcements/scheduled/{id}")
+		if turnUsage != nil {
+			rest.AddResourceWithWrapper(&server.AdminTurnUsage{turnUsage}, adminAuth, "/admin/turn")
+		}
+		rest.AddResourceWithWrapper(&server.AdminUserData{userData}, adminAuth, "/admin/userdata/{userid}")
+		rest.AddResourceWithWrapper(&server.AdminErasures{userData}, adminAuth, "/admin/erasures")
+		rest.AddResourceWithWrapper(&server.AdminRetention{retention}, adminAuth, "/admin/retention")
+		if terms != nil {
+			rest.AddResourceWithWrapper(&server.AdminTerms{terms}, adminAuth, "/admin/terms")
+		}
+		if surveys != nil {
+			rest.AddResourceWithWrapper(&server.AdminSurveys{surveys}, adminAuth, "/admin/surveys")
+		}
+		if tracer != nil {
+			rest.AddResourceWithWrapper(&server.AdminTraces{tracer}, adminAuth, "/admin/traces")
+		}
+		if networkSimulator != nil {
+			rest.AddResourceWithWrapper(&server.AdminNetwork{networkSimulator, roomManager}, adminAuth, "/admin/network")
+		}
+		rest.AddResourceWithWrapper(&server.AdminTickets{tickets, roomLinks, time.Duration(adminRotationGrace) * time.Second}, adminAuth, "/admin/tickets/{action}")
+		log.Println("Admin API is enabled!")
+	}
 
 	// Add extra/static support if configured and exists.
 	if extraFolder != "" {
-		extraFolderStatic, _ := filepath.Abs(path.Join(extraFolder, "static"))
+		extraFolderStatic, _ := filepath.Abs(filepath.Join(extraFolder, "static"))
 		if _, err = os.Stat(extraFolderStatic); err == nil {
 			r.Handle("/extra/static/{path:.*}", http.StripPrefix(fmt.Sprintf("%sextra", config.B), httputils.FileStaticServer(http.Dir(extraFolder))))
 			log.Printf("Added URL handler /extra/static/... for static files in %s/...\n", extraFolderStatic)
@@ -357,7 +949,7 @@ func runner(runtime phoenix.Runtime) error {
 	}
 
 	// Finally add websocket handler.
-	r.Handle("/ws", makeWSHandler(statsManager, sessionManager, codec, channellingAPI, users))
+	r.Handle("/ws", makeWSHandler(config, statsManager, sessionManager, codec, channellingAPI, users, affinity, tracer, networkSimulator, messageCatalogs, loadShedder, panicRecovery))
 
 	// Simple room handler.
 	r.HandleFunc("/{room}", httputils.MakeGzipHandler(roomHandler))
@@ -366,7 +958,183 @@ func runner(runtime phoenix.Runtime) error {
 	rooms := r.PathPrefix("/").Methods("GET").Subrouter()
 	rooms.HandleFunc("/{room:.*}", httputils.MakeGzipHandler(roomHandler))
 
-	return runtime.Start()
+	if vaultRuntime, ok := runtime.(*vaultRuntime); ok {
+		vaultRuntime.OnRotate("app", "turnSecret", func(secret string) {
+			hub.SetTurnSecret([]byte(secret))
+		})
+		vaultRuntime.OnRotate("app", "sessionSecret", func(secret string) {
+			rotated, err := hex.DecodeString(secret)
+			if err != nil {
+				rotated = []byte(secret)
+			}
+			if len(rotated) < 32 {
+				log.Println("Ignoring rotated sessionSecret, its length must be at least 32 bytes")
+				return
+			}
+			grace := time.Duration(adminRotationGrace) * time.Second
+			tickets.RotateSessionSecret(rotated, grace)
+			if roomLinks != nil {
+				roomLinks.RotateSessionSecret(rotated, grace)
+			}
+		})
+		vaultRuntime.StartRenewal()
+	}
+
+	if stop == nil {
+		return runtime.Start()
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- runtime.Start()
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-stop:
+		// Stop the listeners and wait for the runtime to return, so no
+		// connections are accepted during the deferred shutdown.
+		log.Println("Stopping server")
+		runtime.Stop()
+		return <-done
+	}
+}
+
+// loadObjectStore creates the object store of the [objectstore] section,
+// nil if none is configured. Disk stores are returned as handler, too, to
+// serve their signed URLs.
+func loadObjectStore(runtime phoenix.Runtime, secret []byte) (objectstore.Store, http.Handler, error) {
+	switch backend, _ := runtime.GetString("objectstore", "backend"); backend {
+	case "":
+		return nil, nil, nil
+	case "disk":
+		directory, _ := runtime.GetString("objectstore", "directory")
+		baseURL, _ := runtime.GetString("objectstore", "url")
+		disk, err := objectstore.NewDisk(directory, baseURL, secret)
+		if err != nil {
+			return nil, nil, fmt.Errorf("Invalid object store: %s", err)
+		}
+		log.Printf("Storing objects in %s\n", directory)
+		return disk, disk, nil
+	case "s3":
+		endpoint, _ := runtime.GetString("objectstore", "s3Endpoint")
+		region, _ := runtime.GetString("objectstore", "s3Region")
+		bucket, _ := runtime.GetString("objectstore", "s3Bucket")
+		prefix, _ := runtime.GetString("objectstore", "s3Prefix")
+		accessKey, _ := runtime.GetString("objectstore", "s3AccessKey")
+		secretKey, _ := runtime.GetString("objectstore", "s3SecretKey")
+		timeout, err := runtime.GetInt("objectstore", "s3Timeout")
+		if err != nil || timeout <= 0 {
+			timeout = 10
+		}
+		store, err := objectstore.NewS3(endpoint, region, bucket, prefix, accessKey, secretKey, time.Duration(timeout)*time.Second)
+		if err != nil {
+			return nil, nil, fmt.Errorf("Invalid object store: %s", err)
+		}
+		log.Printf("Storing objects in S3 bucket %s\n", bucket)
+		return store, nil, nil
+	default:
+		return nil, nil, fmt.Errorf("Unknown object store backend: %s", backend)
+	}
+}
+
+func loadBuddyImages(runtime phoenix.Runtime, store objectstore.Store) (channelling.ImageCache, error) {
+	switch kind, _ := runtime.GetString("buddyimages", "store"); kind {
+	case "", "memory":
+		return channelling.NewImageCache(nil), nil
+	case "objectstore":
+		if store == nil {
+			return nil, fmt.Errorf("Buddy images need an object store")
+		}
+		return channelling.NewImageCache(store), nil
+	default:
+		return nil, fmt.Errorf("Unknown buddy images store: %s", kind)
+	}
+}
+
+// loadDialOut returns the dial-out to phone numbers or nil if no number
+// prefixes are allowed.
+func loadDialOut(runtime phoenix.Runtime, busManager channelling.BusManager, useNats bool) channelling.DialOut {
+	allowlists := make(map[string][]string)
+	if allow, _ := runtime.GetString("dialout", "allow"); allow != "" {
+		allowlists[""] = strings.Fields(allow)
+	}
+	if options, _ := runtime.GetOptions("dialout-allow"); len(options) > 0 {
+		for _, prefix := range options {
+			allow, _ := runtime.GetString("dialout-allow", prefix)
+			allowlists[prefix] = strings.Fields(allow)
+		}
+	}
+	if len(allowlists) == 0 {
+		return nil
+	}
+	if !useNats {
+		log.Println("Dial-out needs the NATS channelling trigger, disabled")
+		return nil
+	}
+	timeout, err := runtime.GetInt("dialout", "timeout")
+	if err != nil || timeout <= 0 {
+		timeout = 10
+	}
+	dialOut := channelling.NewDialOut(busManager, allowlists, time.Duration(timeout)*time.Second)
+	if quota, _ := runtime.GetInt("dialout", "quota"); quota > 0 {
+		quotaWindow, err := runtime.GetInt("dialout", "quotaWindow")
+		if err != nil || quotaWindow <= 0 {
+			quotaWindow = 3600
+		}
+		dialOut.SetLimiter(channelling.NewDialOutQuota(quota, time.Duration(quotaWindow)*time.Second))
+	}
+	log.Printf("Dial-out is enabled for %d allowlists\n", len(allowlists))
+	return dialOut
+}
+
+func loadChatIndex(runtime phoenix.Runtime) (channelling.ChatIndex, error) {
+	backend, _ := runtime.GetString("chatindex", "backend")
+	switch backend {
+	case "":
+		return nil, nil
+	case channelling.ChatIndexMemory:
+		maxEntries, err := runtime.GetInt("chatindex", "maxEntries")
+		if err != nil || maxEntries < 0 {
+			maxEntries = 10000
+		}
+		log.Printf("Indexing chat in memory, keeping %d messages per room\n", maxEntries)
+		return channelling.NewMemoryChatIndex(maxEntries), nil
+	case channelling.ChatIndexElasticsearch:
+		url, _ := runtime.GetString("chatindex", "url")
+		if url == "" {
+			return nil, fmt.Errorf("Chat index backend elasticsearch needs an url")
+		}
+		timeout, err := runtime.GetInt("chatindex", "timeout")
+		if err != nil || timeout <= 0 {
+			timeout = 5
+		}
+		log.Printf("Indexing chat in Elasticsearch at %s\n", url)
+		return channelling.NewElasticsearchChatIndex(url, time.Duration(timeout)*time.Second), nil
+	default:
+		return nil, fmt.Errorf("Unsupported chat index backend '%s'", backend)
+	}
+}
+
+func loadSurveys(runtime phoenix.Runtime) (channelling.Surveys, error) {
+	ids, _ := runtime.GetString("survey", "questions")
+	if ids == "" {
+		return nil, nil
+	}
+	var questions []*channelling.SurveyQuestion
+	for _, id := range strings.Fields(ids) {
+		definition, _ := runtime.GetString("survey", id)
+		question, err := channelling.ParseSurveyQuestion(id, definition)
+		if err != nil {
+			return nil, err
+		}
+		questions = append(questions, question)
+	}
+	timeout, err := runtime.GetInt("survey", "timeout")
+	if err != nil || timeout <= 0 {
+		timeout = 600
+	}
+	log.Printf("Asking %d survey questions after calls\n", len(questions))
+	return channelling.NewSurveys(questions, time.Duration(timeout)*time.Second), nil
 }
 
 func loadExtraD(extraDFolder string) error {
@@ -403,8 +1171,8 @@ func loadExtraD(extraDFolder string) error {
 		context.S = fmt.Sprintf("extra.d/%s/%s", config.S, extra)
 		extraDTemplates := template.New("")
 		extraDTemplates.Delims("<%", "%>")
-		extraBase := path.Join(extraDFolder, extra)
-		extraDTemplates.ParseFiles(path.Join(extraBase, "head.html"), path.Join(extraBase, "body.html"))
+		extraBase := filepath.Join(extraDFolder, extra)
+		extraDTemplates.ParseFiles(filepath.Join(extraBase, "head.html"), filepath.Join(extraBase, "body.html"))
 		if headTemplate := extraDTemplates.Lookup("head.html"); headTemplate != nil {
 			if err := headTemplate.Execute(&headBuf, context); err != nil {
 				log.Println("Failed to parse extra.d template", extraBase, "head.html", err)
@@ -433,6 +1201,11 @@ func boot() error {
 	memprofile := flag.String("memprofile", "", "Write memory profile to this file.")
 	cpuprofile := flag.String("cpuprofile", "", "Write cpu profile to file.")
 	showHelp := flag.Bool("h", false, "Show this usage information and exit.")
+	keyringPath := flag.String("keyring", "", "Secrets keyring file for -seal and -rewrap.")
+	generateKey := flag.String("genkey", "", "Generate a keyring line with the given key id and exit.")
+	sealSecretFlag := flag.Bool("seal", false, "Seal a secret read from stdin for the configuration file and exit.")
+	rewrapPath := flag.String("rewrap", "", "Rewrap sealed secrets in the given configuration file with the current keyring key, print the result and exit.")
+	serviceName := flag.String("service", "", "Run as Windows service with this name, logging to the event log unless -l is given.")
 	flag.Parse()
 
 	if *showHelp {
@@ -441,16 +1214,31 @@ func boot() error {
 	} else if *showVersion {
 		fmt.Printf("Version %s\n", version)
 		return nil
+	} else if *generateKey != "" {
+		return reportToolError(generateMasterKey(os.Stdout, *generateKey))
+	} else if *sealSecretFlag {
+		return reportToolError(sealSecret(*keyringPath, os.Stdin, os.Stdout))
+	} else if *rewrapPath != "" {
+		return reportToolError(rewrapConfig(*keyringPath, *rewrapPath, os.Stdout))
 	}
 
-	return phoenix.NewServer("server", version).
+	server := phoenix.NewServer("server", version).
 		DefaultConfig(defaultConfigPath).
 		Config(configPath).
 		OverrideConfig(overrideConfigPath).
 		Log(logPath).
 		CpuProfile(cpuprofile).
-		MemProfile(memprofile).
-		Run(runner)
+		MemProfile(memprofile)
+	if *serviceName != "" {
+		return runService(*serviceName, *logPath == "", func(stop <-chan bool) error {
+			return server.Run(func(runtime phoenix.Runtime) error {
+				return runner(runtime, stop)
+			})
+		})
+	}
+	return server.Run(func(runtime phoenix.Runtime) error {
+		return runner(runtime, nil)
+	})
 }
 
 func main() {
@@ -0,0 +1,57 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package main
+
+import (
+	"log"
+	"strings"
+	"time"
+
+	"github.com/strukturag/phoenix"
+	"github.com/strukturag/spreed-webrtc/go/plugins"
+)
+
+// loadPlugins starts the plugin binaries configured in the plugins
+// section. Returns nil if no plugins are configured.
+func loadPlugins(runtime phoenix.Runtime) (*plugins.Host, error) {
+	paths, err := runtime.GetString("plugins", "paths")
+	if err != nil || strings.TrimSpace(paths) == "" {
+		return nil, nil
+	}
+	timeout, err := runtime.GetInt("plugins", "timeout")
+	if err != nil || timeout <= 0 {
+		timeout = 2
+	}
+
+	host := plugins.NewHost()
+	for _, path := range strings.Fields(paths) {
+		client, err := plugins.Start(path, time.Duration(timeout)*time.Second)
+		if err != nil {
+			host.Close()
+			return nil, err
+		}
+		host.Add(client)
+	}
+	log.Printf("Plugins enabled with %ds timeout\n", timeout)
+
+	return host, nil
+}
@@ -0,0 +1,53 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package main
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/strukturag/spreed-webrtc/go/channelling/server"
+
+	"github.com/strukturag/sloth"
+)
+
+// documentedAPI adds resources to the REST API and describes them in the
+// OpenAPI document at the same time. Admin resources require a bearer
+// token.
+type documentedAPI struct {
+	*sloth.API
+	spec *server.OpenAPI
+}
+
+func (api *documentedAPI) AddResource(resource interface{}, paths ...string) {
+	api.API.AddResource(resource, paths...)
+	api.spec.AddResource(resource, isAdminPath(paths), paths...)
+}
+
+func (api *documentedAPI) AddResourceWithWrapper(resource interface{}, wrapper func(handler http.HandlerFunc) http.HandlerFunc, paths ...string) {
+	api.API.AddResourceWithWrapper(resource, wrapper, paths...)
+	api.spec.AddResource(resource, isAdminPath(paths), paths...)
+}
+
+func isAdminPath(paths []string) bool {
+	return len(paths) > 0 && strings.HasPrefix(paths[0], "/admin/")
+}
@@ -0,0 +1,345 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package main
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/strukturag/spreed-webrtc/go/channelling"
+	"github.com/strukturag/spreed-webrtc/go/envelope"
+	"github.com/strukturag/spreed-webrtc/go/vault"
+
+	"github.com/strukturag/phoenix"
+)
+
+const keyringEnvironment = "SPREED_WEBRTC_KEYRING"
+
+// secretsRuntime transparently opens sealed configuration values, so
+// secrets can be stored encrypted in the configuration file.
+type secretsRuntime struct {
+	phoenix.Runtime
+	keyring *envelope.Keyring
+}
+
+func newSecretsRuntime(runtime phoenix.Runtime) (phoenix.Runtime, error) {
+	fn := os.Getenv(keyringEnvironment)
+	if fn == "" {
+		fn, _ = runtime.GetString("secrets", "keyring")
+	}
+	if fn == "" {
+		return runtime, nil
+	}
+
+	keyring, err := envelope.LoadKeyring(fn)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to load secrets keyring: %s", err)
+	}
+	log.Printf("Using secrets keyring from %s\n", fn)
+	return &secretsRuntime{runtime, keyring}, nil
+}
+
+// secretsKeyring returns the keyring of runtime, nil if no keyring is
+// configured. It also seals state the server writes to disk.
+func secretsKeyring(runtime phoenix.Runtime) *envelope.Keyring {
+	if secrets, ok := runtime.(*secretsRuntime); ok {
+		return secrets.keyring
+	}
+	return nil
+}
+
+func (runtime *secretsRuntime) GetString(section string, option string) (string, error) {
+	value, err := runtime.Runtime.GetString(section, option)
+	if err != nil || !envelope.IsSealed(value) {
+		return value, err
+	}
+	if runtime.keyring.NeedsRewrap(value) {
+		log.Printf("Secret %s.%s uses an old master key, rewrap it with -rewrap\n", section, option)
+	}
+	plaintext, err := runtime.keyring.Open(value)
+	if err != nil {
+		log.Printf("Failed to open secret %s.%s: %s\n", section, option, err)
+		return "", err
+	}
+	return string(plaintext), nil
+}
+
+func (runtime *secretsRuntime) GetStringDefault(section string, option string, dflt string) string {
+	value, err := runtime.GetString(section, option)
+	if err != nil {
+		return dflt
+	}
+	return value
+}
+
+// loadBusEncryption returns the encryption for payloads published to NATS
+// or nil if no payload keyrings are configured.
+func loadBusEncryption(runtime phoenix.Runtime, sessions channelling.SessionStore) (*channelling.BusEncryption, error) {
+	var fallback *envelope.Keyring
+	if fn, _ := runtime.GetString("nats", "payloadKeyring"); fn != "" {
+		keyring, err := envelope.LoadKeyring(fn)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to load NATS payload keyring: %s", err)
+		}
+		fallback = keyring
+	}
+	tenants := make(map[string]*envelope.Keyring)
+	if options, _ := runtime.GetOptions("nats-payloadkeys"); len(options) > 0 {
+		for _, prefix := range options {
+			fn, _ := runtime.GetString("nats-payloadkeys", prefix)
+			keyring, err := envelope.LoadKeyring(fn)
+			if err != nil {
+				return nil, fmt.Errorf("Failed to load NATS payload keyring for %s: %s", prefix, err)
+			}
+			tenants[prefix] = keyring
+		}
+	}
+	if fallback == nil && len(tenants) == 0 {
+		return nil, nil
+	}
+	log.Printf("Encrypting NATS payloads (%d tenant keyrings, default keyring %t)\n", len(tenants), fallback != nil)
+	return channelling.NewBusEncryption(sessions, fallback, tenants), nil
+}
+
+const (
+	vaultAddressEnvironment = "VAULT_ADDR"
+	vaultTokenEnvironment   = "VAULT_TOKEN"
+)
+
+// vaultRuntime reads configuration values of the form vault:path#field
+// from a key management service, so secrets do not need to be stored in
+// the configuration file at all.
+type vaultRuntime struct {
+	phoenix.Runtime
+	sync.Mutex
+	watcher  *vault.Watcher
+	interval time.Duration
+	rotating map[string]bool
+}
+
+func newVaultRuntime(runtime phoenix.Runtime) (phoenix.Runtime, error) {
+	address := os.Getenv(vaultAddressEnvironment)
+	if address == "" {
+		address, _ = runtime.GetString("vault", "address")
+	}
+	if address == "" {
+		return runtime, nil
+	}
+
+	token := os.Getenv(vaultTokenEnvironment)
+	if token == "" {
+		if fn, _ := runtime.GetString("vault", "tokenFile"); fn != "" {
+			data, err := ioutil.ReadFile(fn)
+			if err != nil {
+				return nil, fmt.Errorf("Failed to read vault token: %s", err)
+			}
+			token = strings.TrimSpace(string(data))
+		}
+	}
+	if token == "" {
+		token, _ = runtime.GetString("vault", "token")
+	}
+	if token == "" {
+		return nil, fmt.Errorf("No vault token, set tokenFile or token in the [vault] section or %s", vaultTokenEnvironment)
+	}
+
+	timeout, err := runtime.GetInt("vault", "timeout")
+	if err != nil || timeout <= 0 {
+		timeout = 10
+	}
+	refresh, err := runtime.GetInt("vault", "refresh")
+	if err != nil || refresh <= 0 {
+		refresh = 300
+	}
+	interval, err := runtime.GetInt("vault", "renewInterval")
+	if err != nil || interval <= 0 {
+		interval = 60
+	}
+	client := vault.NewClient(address, token, time.Duration(timeout)*time.Second)
+	log.Printf("Reading secrets from vault at %s\n", address)
+	return &vaultRuntime{
+		Runtime:  runtime,
+		watcher:  vault.NewWatcher(client, time.Duration(refresh)*time.Second),
+		interval: time.Duration(interval) * time.Second,
+		rotating: make(map[string]bool),
+	}, nil
+}
+
+func (runtime *vaultRuntime) GetString(section string, option string) (string, error) {
+	value, err := runtime.Runtime.GetString(section, option)
+	if err != nil || !strings.HasPrefix(value, vault.Prefix) {
+		return value, err
+	}
+	path, field, err := vault.ParseReference(value)
+	if err != nil {
+		log.Printf("Invalid vault reference in %s.%s: %s\n", section, option, err)
+		return "", err
+	}
+	value, err = runtime.watcher.Get(path, field)
+	if err != nil {
+		log.Printf("Failed to read secret %s.%s from vault: %s\n", section, option, err)
+		return "", err
+	}
+
+	key := section + "." + option
+	runtime.Lock()
+	if _, ok := runtime.rotating[key]; !ok {
+		runtime.rotating[key] = false
+		runtime.watcher.OnChange(path, field, func(string) {
+			runtime.Lock()
+			rotating := runtime.rotating[key]
+			runtime.Unlock()
+			if !rotating {
+				log.Printf("Secret %s was rotated in vault, restart the server to use it\n", key)
+			}
+		})
+	}
+	runtime.Unlock()
+	return value, nil
+}
+
+func (runtime *vaultRuntime) GetStringDefault(section string, option string, dflt string) string {
+	value, err := runtime.GetString(section, option)
+	if err != nil {
+		return dflt
+	}
+	return value
+}
+
+// OnRotate registers fn to be called with the new value when the secret
+// read for section.option was rotated in vault.
+func (runtime *vaultRuntime) OnRotate(section string, option string, fn func(string)) {
+	value, err := runtime.Runtime.GetString(section, option)
+	if err != nil {
+		return
+	}
+	path, field, err := vault.ParseReference(value)
+	if err != nil {
+		return
+	}
+	runtime.Lock()
+	runtime.rotating[section+"."+option] = true
+	runtime.Unlock()
+	runtime.watcher.OnChange(path, field, func(value string) {
+		log.Printf("Secret %s.%s was rotated in vault\n", section, option)
+		fn(value)
+	})
+}
+
+// StartRenewal keeps the vault token and the leases of the secrets renewed and
+// picks up rotated secrets.
+func (runtime *vaultRuntime) StartRenewal() {
+	runtime.watcher.Start(runtime.interval)
+}
+
+func loadToolKeyring(fn string) (*envelope.Keyring, error) {
+	if fn == "" {
+		fn = os.Getenv(keyringEnvironment)
+	}
+	if fn == "" {
+		return nil, fmt.Errorf("No keyring, use -keyring or set %s", keyringEnvironment)
+	}
+	return envelope.LoadKeyring(fn)
+}
+
+// generateMasterKey prints a new keyring line for id.
+func generateMasterKey(w io.Writer, id string) error {
+	key := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return err
+	}
+	if _, err := envelope.NewMasterKey(id, key); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(w, "%s %s\n", id, hex.EncodeToString(key))
+	return err
+}
+
+// sealSecret seals the first line read from r.
+func sealSecret(keyringFn string, r io.Reader, w io.Writer) error {
+	keyring, err := loadToolKeyring(keyringFn)
+	if err != nil {
+		return err
+	}
+	line, err := bufio.NewReader(r).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return err
+	}
+	sealed, err := keyring.Seal([]byte(strings.TrimRight(line, "\r\n")))
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(w, sealed)
+	return err
+}
+
+var sealedValuePattern = regexp.MustCompile(regexp.QuoteMeta(envelope.Prefix) + `[A-Za-z0-9_\-:]+`)
+
+// rewrapConfig writes the configuration file fn to w, with all sealed
+// values rewrapped with the current master key of the keyring.
+func rewrapConfig(keyringFn, fn string, w io.Writer) error {
+	keyring, err := loadToolKeyring(keyringFn)
+	if err != nil {
+		return err
+	}
+	data, err := ioutil.ReadFile(fn)
+	if err != nil {
+		return err
+	}
+
+	count := 0
+	data = sealedValuePattern.ReplaceAllFunc(data, func(sealed []byte) []byte {
+		if err != nil || !keyring.NeedsRewrap(string(sealed)) {
+			return sealed
+		}
+		var rewrapped string
+		if rewrapped, err = keyring.Rewrap(string(sealed)); err != nil {
+			return sealed
+		}
+		count++
+		return []byte(rewrapped)
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "Rewrapped %d secrets.\n", count)
+	_, err = w.Write(data)
+	return err
+}
+
+func reportToolError(err error) error {
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+	}
+	return err
+}
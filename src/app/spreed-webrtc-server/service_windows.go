@@ -0,0 +1,279 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+var (
+	advapi32                          = syscall.NewLazyDLL("advapi32.dll")
+	procStartServiceCtrlDispatcherW   = advapi32.NewProc("StartServiceCtrlDispatcherW")
+	procRegisterServiceCtrlHandlerExW = advapi32.NewProc("RegisterServiceCtrlHandlerExW")
+	procSetServiceStatus              = advapi32.NewProc("SetServiceStatus")
+	procRegisterEventSourceW          = advapi32.NewProc("RegisterEventSourceW")
+	procDeregisterEventSource         = advapi32.NewProc("DeregisterEventSource")
+	procReportEventW                  = advapi32.NewProc("ReportEventW")
+)
+
+const (
+	serviceWin32OwnProcess = 0x10
+
+	serviceStopped      = 1
+	serviceStartPending = 2
+	serviceStopPending  = 3
+	serviceRunning      = 4
+
+	serviceAcceptStop     = 0x1
+	serviceAcceptShutdown = 0x4
+
+	serviceControlStop        = 1
+	serviceControlInterrogate = 4
+	serviceControlShutdown    = 5
+
+	errorCallNotImplemented   = 120
+	errorServiceSpecificError = 1066
+
+	serviceWaitHint          = 10000 // Milliseconds to wait for pending states.
+	serviceSpecificRunFailed = 1     // Service specific exit code if the server failed.
+
+	eventlogErrorType       = 0x1
+	eventlogInformationType = 0x4
+	serviceEventID          = 1
+)
+
+type serviceTableEntry struct {
+	name *uint16
+	proc uintptr
+}
+
+type serviceStatus struct {
+	serviceType             uint32
+	currentState            uint32
+	controlsAccepted        uint32
+	win32ExitCode           uint32
+	serviceSpecificExitCode uint32
+	checkPoint              uint32
+	waitHint                uint32
+}
+
+// windowsService runs the server as Windows service. The service control
+// manager calls serviceMain and serviceHandler on threads of its own, so
+// they find the service in currentService.
+type windowsService struct {
+	sync.Mutex
+	name     string
+	run      func(stop <-chan bool) error
+	eventLog *eventLog
+	handle   uintptr
+	status   serviceStatus
+	stop     chan bool
+	stopOnce sync.Once
+	err      error
+}
+
+var currentService *windowsService
+
+// runService runs run as the Windows service name until it returns. When
+// the service control manager stops the service, stop is closed and run
+// has to shut down and return. With logToEventLog, the log is written to
+// the Windows event log with name as source.
+func runService(name string, logToEventLog bool, run func(stop <-chan bool) error) error {
+	eventLog, err := openEventLog(name)
+	if err != nil {
+		return fmt.Errorf("Failed to open event log: %s", err)
+	}
+	defer eventLog.Close()
+	if logToEventLog {
+		log.SetFlags(0)
+		log.SetOutput(eventLog)
+	}
+
+	namePtr, err := syscall.UTF16PtrFromString(name)
+	if err != nil {
+		return err
+	}
+	currentService = &windowsService{
+		name:     name,
+		run:      run,
+		eventLog: eventLog,
+		stop:     make(chan bool),
+	}
+	table := []serviceTableEntry{
+		{namePtr, syscall.NewCallback(serviceMain)},
+		{nil, 0},
+	}
+	// Blocks until the service stopped.
+	if r, _, err := procStartServiceCtrlDispatcherW.Call(uintptr(unsafe.Pointer(&table[0]))); r == 0 {
+		return fmt.Errorf("Failed to connect to the service control manager: %s", err)
+	}
+	return currentService.err
+}
+
+func serviceMain(argc, argv uintptr) uintptr {
+	service := currentService
+	namePtr, _ := syscall.UTF16PtrFromString(service.name)
+	handle, _, err := procRegisterServiceCtrlHandlerExW.Call(uintptr(unsafe.Pointer(namePtr)), syscall.NewCallback(serviceHandler), 0)
+	if handle == 0 {
+		service.err = fmt.Errorf("Failed to register service control handler: %s", err)
+		return 0
+	}
+	service.handle = handle
+	service.setState(serviceStartPending)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- service.run(service.stop)
+	}()
+	service.setState(serviceRunning)
+
+	select {
+	case err = <-done:
+	case <-service.stop:
+		err = service.waitStopped(done)
+		log.Println("Service stopped")
+	}
+	if err != nil {
+		service.err = err
+		service.eventLog.Report(eventlogErrorType, fmt.Sprintf("Service failed: %s", err))
+		service.Lock()
+		service.status.win32ExitCode = errorServiceSpecificError
+		service.status.serviceSpecificExitCode = serviceSpecificRunFailed
+		service.Unlock()
+	}
+	// The process exits once the dispatcher returns, so only report the
+	// service as stopped after run returned.
+	service.setState(serviceStopped)
+	return 0
+}
+
+// waitStopped waits for run to return after the service was asked to stop
+// and keeps telling the service control manager that stopping progresses.
+func (service *windowsService) waitStopped(done <-chan error) error {
+	ticker := time.NewTicker(serviceWaitHint / 2 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		select {
+		case err := <-done:
+			return err
+		case <-ticker.C:
+			service.Lock()
+			service.status.checkPoint++
+			service.report()
+			service.Unlock()
+		}
+	}
+}
+
+func serviceHandler(control, eventType, eventData, context uintptr) uintptr {
+	service := currentService
+	switch control {
+	case serviceControlStop, serviceControlShutdown:
+		service.setState(serviceStopPending)
+		service.stopOnce.Do(func() {
+			close(service.stop)
+		})
+	case serviceControlInterrogate:
+		service.Lock()
+		service.report()
+		service.Unlock()
+	default:
+		return errorCallNotImplemented
+	}
+	return 0
+}
+
+// setState reports state to the service control manager.
+func (service *windowsService) setState(state uint32) {
+	service.Lock()
+	defer service.Unlock()
+	status := &service.status
+	status.serviceType = serviceWin32OwnProcess
+	status.currentState = state
+	status.controlsAccepted = 0
+	status.checkPoint = 0
+	status.waitHint = 0
+	switch state {
+	case serviceRunning:
+		status.controlsAccepted = serviceAcceptStop | serviceAcceptShutdown
+	case serviceStartPending, serviceStopPending:
+		status.checkPoint = 1
+		status.waitHint = serviceWaitHint
+	}
+	service.report()
+}
+
+// report sends the status. The lock must be held.
+func (service *windowsService) report() {
+	if r, _, err := procSetServiceStatus.Call(service.handle, uintptr(unsafe.Pointer(&service.status))); r == 0 {
+		service.eventLog.Report(eventlogErrorType, fmt.Sprintf("Failed to set service status: %s", err))
+	}
+}
+
+// eventLog writes log lines to the Windows event log.
+type eventLog struct {
+	handle uintptr
+}
+
+func openEventLog(source string) (*eventLog, error) {
+	sourcePtr, err := syscall.UTF16PtrFromString(source)
+	if err != nil {
+		return nil, err
+	}
+	handle, _, err := procRegisterEventSourceW.Call(0, uintptr(unsafe.Pointer(sourcePtr)))
+	if handle == 0 {
+		return nil, err
+	}
+	return &eventLog{handle}, nil
+}
+
+// Write reports p as information event.
+func (l *eventLog) Write(p []byte) (int, error) {
+	if err := l.Report(eventlogInformationType, string(p)); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Report writes message as event of eventType.
+func (l *eventLog) Report(eventType uint16, message string) error {
+	message = strings.Replace(strings.TrimRight(message, "\r\n"), "\x00", "", -1)
+	messagePtr, err := syscall.UTF16PtrFromString(message)
+	if err != nil {
+		return err
+	}
+	if r, _, err := procReportEventW.Call(l.handle, uintptr(eventType), 0, serviceEventID, 0, 1, 0, uintptr(unsafe.Pointer(&messagePtr)), 0); r == 0 {
+		return err
+	}
+	return nil
+}
+
+func (l *eventLog) Close() error {
+	procDeregisterEventSource.Call(l.handle)
+	return nil
+}
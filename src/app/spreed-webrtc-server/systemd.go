@@ -0,0 +1,165 @@
+// +build !windows
+
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/strukturag/phoenix"
+)
+
+// listenFdsStart is the first file descriptor passed by systemd socket
+// activation.
+const listenFdsStart = 3
+
+// startListeners serves handler on the Unix domain socket of the [http]
+// section and on the sockets passed by systemd socket activation, besides
+// the listeners of runtime. The service manager is notified when the server
+// is ready and when it stops.
+func startListeners(runtime phoenix.Runtime, handler http.Handler) error {
+	listeners, err := systemdListeners()
+	if err != nil {
+		return err
+	}
+	if path, _ := runtime.GetString("http", "listenUnix"); path != "" {
+		mode, err := strconv.ParseUint(runtime.GetStringDefault("http", "listenUnixMode", "0660"), 8, 32)
+		if err != nil {
+			return fmt.Errorf("Invalid listenUnixMode: %s", err)
+		}
+		listener, err := unixListener(path, os.FileMode(mode))
+		if err != nil {
+			return fmt.Errorf("Failed to listen on Unix socket: %s", err)
+		}
+		listeners = append(listeners, listener)
+	}
+
+	readTimeout := time.Duration(runtime.GetIntDefault("http", "readtimeout", 10)) * time.Second
+	writeTimeout := time.Duration(runtime.GetIntDefault("http", "writetimeout", 10)) * time.Second
+	var stopping int32
+	runtime.OnStart(func(runtime phoenix.Runtime) {
+		for _, listener := range listeners {
+			server := &http.Server{
+				Handler:      handler,
+				ReadTimeout:  readTimeout,
+				WriteTimeout: writeTimeout,
+			}
+			go func(listener net.Listener) {
+				log.Printf("Starting HTTP server on %s\n", listener.Addr())
+				if err := server.Serve(listener); err != nil && atomic.LoadInt32(&stopping) == 0 {
+					log.Printf("HTTP server on %s failed: %s\n", listener.Addr(), err)
+				}
+			}(listener)
+		}
+		if err := sdNotify("READY=1"); err != nil {
+			log.Println("Failed to notify service manager", err)
+		}
+	})
+	runtime.OnStop(func(runtime phoenix.Runtime) {
+		atomic.StoreInt32(&stopping, 1)
+		sdNotify("STOPPING=1")
+		for _, listener := range listeners {
+			listener.Close()
+		}
+	})
+	return nil
+}
+
+// systemdListeners returns the sockets passed by systemd socket activation,
+// none if the process was not started that way. The environment variables
+// are removed, so child processes do not pick up the sockets.
+func systemdListeners() ([]net.Listener, error) {
+	defer os.Unsetenv("LISTEN_PID")
+	defer os.Unsetenv("LISTEN_FDS")
+	defer os.Unsetenv("LISTEN_FDNAMES")
+
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return nil, nil
+	}
+	count, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || count <= 0 {
+		return nil, nil
+	}
+
+	listeners := make([]net.Listener, 0, count)
+	for fd := listenFdsStart; fd < listenFdsStart+count; fd++ {
+		syscall.CloseOnExec(fd)
+		file := os.NewFile(uintptr(fd), fmt.Sprintf("listen-fd-%d", fd))
+		listener, err := net.FileListener(file)
+		// The listener has its own copy of the descriptor.
+		file.Close()
+		if err != nil {
+			return nil, fmt.Errorf("Socket %d passed by systemd is no stream socket: %s", fd, err)
+		}
+		listeners = append(listeners, listener)
+	}
+	log.Printf("Received %d sockets from systemd\n", count)
+	return listeners, nil
+}
+
+// unixListener listens on the Unix domain socket path with the permissions
+// mode. A socket file left behind by a previous run is removed.
+func unixListener(path string, mode os.FileMode) (net.Listener, error) {
+	if info, err := os.Lstat(path); err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("%s exists and is no socket", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, mode); err != nil {
+		listener.Close()
+		return nil, err
+	}
+	return listener, nil
+}
+
+// sdNotify sends state to the service manager, if it asked for
+// notifications with NOTIFY_SOCKET.
+func sdNotify(state string) error {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return nil
+	}
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, err = conn.Write([]byte(state))
+	return err
+}
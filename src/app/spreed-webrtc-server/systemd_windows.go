@@ -0,0 +1,38 @@
+/*
+ * Spreed WebRTC.
+ * Copyright (C) 2013-2015 struktur AG
+ *
+ * This file is part of Spreed WebRTC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package main
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/strukturag/phoenix"
+)
+
+// startListeners only warns about a configured Unix domain socket, Windows
+// has no Unix domain sockets and no systemd.
+func startListeners(runtime phoenix.Runtime, handler http.Handler) error {
+	if path, _ := runtime.GetString("http", "listenUnix"); path != "" {
+		log.Println("Ignoring listenUnix, Unix sockets are not supported on Windows")
+	}
+	return nil
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"fmt"
 	"net/http"
+	"strings"
 
 	"github.com/gorilla/mux"
 
@@ -19,6 +20,25 @@ func getRequestLanguages(r *http.Request, supportedLanguages []string) []string
 	return langs
 }
 
+// Helper to select the first of langs which is supported, either directly
+// or by its primary language. Returns "en" if none is supported.
+func selectLanguage(langs []string, supportedLanguages []string) string {
+	supported := make(map[string]bool)
+	for _, lang := range supportedLanguages {
+		supported[lang] = true
+	}
+	for _, lang := range langs {
+		lang = strings.ToLower(lang)
+		if supported[lang] {
+			return lang
+		}
+		if idx := strings.IndexByte(lang, '-'); idx != -1 && supported[lang[:idx]] {
+			return lang[:idx]
+		}
+	}
+	return "en"
+}
+
 func rewriteExtraDUrl(h http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		vars := mux.Vars(r)
@@ -344,6 +344,87 @@ define(['jquery', 'underscore', 'bigscreen', 'moment', 'sjcl', 'modernizr', 'web
 			mediaStream.webrtc.setAudioMute(cameraMute);
 		});
 
+		mediaStream.api.e.on("received.mute", function(event, data, from) {
+			// Mute requests are only relayed by the server for moderators.
+			if (!data.Audio && !data.Video) {
+				return;
+			}
+			safeApply($scope, function(scope) {
+				if (data.Audio) {
+					scope.microphoneMute = true;
+				}
+				if (data.Video) {
+					scope.cameraMute = true;
+				}
+			});
+			toastr.info(moment().format("lll"), translation._("You have been muted by a moderator."));
+		});
+
+		mediaStream.api.e.on("received.follow", function(event, data, from) {
+			// Follow requests are only relayed by the server for moderators.
+			if (!data.Url || from === mediaStream.api.id) {
+				return;
+			}
+			alertify.dialog.confirm(translation._("The moderator asks you to open %s. Open it now?", data.Url), function() {
+				$window.open(data.Url, "_blank");
+			});
+		});
+
+		mediaStream.api.e.on("received.announcement", function(event, data) {
+			var notice = toastr[data.Level] ? toastr[data.Level] : toastr.info;
+			notice(data.Message, translation._("Announcement") + " " + moment().format("lll"), {
+				timeOut: 0,
+				extendedTimeOut: 0,
+				closeButton: true
+			});
+		});
+
+		mediaStream.api.e.on("received.spam", function(event, data) {
+			// Only sent to moderators of the current room.
+			var name = data.Userid ? data.Userid : data.Id;
+			var message;
+			if (data.Action === "mute") {
+				message = translation._("%s sent spam and is muted.", name);
+			} else {
+				message = translation._("%s sent spam and is throttled.", name);
+			}
+			toastr.warning(moment().format("lll"), message);
+		});
+
+		mediaStream.api.e.on("received.chatthrottled", function(event, data) {
+			toastr.warning(moment().format("lll"), translation._("You are sending too many chat messages. Please wait a moment."));
+		});
+
+		mediaStream.api.e.on("received.chatflag", function(event, data) {
+			// Only sent to moderators of the current room.
+			var name = data.Userid ? data.Userid : data.Id;
+			var message = translation._("A chat message of %s was flagged.", name);
+			if (data.Message) {
+				message = message + " " + data.Message;
+			}
+			toastr.warning(moment().format("lll"), message);
+		});
+
+		mediaStream.api.e.on("received.chatrejected", function(event, data) {
+			toastr.warning(moment().format("lll"), translation._("Your chat message was rejected by the content filter."));
+		});
+
+		mediaStream.api.e.on("received.recording", function(event, data, from) {
+			if (!data.Active) {
+				toastr.info(moment().format("lll"), translation._("The recording of this room has stopped."));
+				return;
+			}
+			if (from === mediaStream.api.id) {
+				// Starting the recording implies consent.
+				return;
+			}
+			alertify.dialog.confirm(translation._("This room is being recorded. Do you consent to the recording?"), function() {
+				mediaStream.api.sendRecordingConsent(true);
+			}, function() {
+				mediaStream.api.sendRecordingConsent(false);
+			});
+		});
+
 		$scope.$watch("peer", function(c, o) {
 			// Watch for peer and disable some sounds while there is a peer.
 			if (c && !o) {
@@ -362,6 +443,11 @@ define(['jquery', 'underscore', 'bigscreen', 'moment', 'sjcl', 'modernizr', 'web
 		var ttlTimeout;
 		var reloadDialog = false;
 
+		mediaStream.api.e.on("received.turn", function(event, data) {
+			constraints.turn(data);
+			$scope.refreshWebrtcSettings();
+		});
+
 		mediaStream.api.e.on("received.self", function(event, data) {
 
 			$timeout.cancel(ttlTimeout);
@@ -737,7 +823,7 @@ define(['jquery', 'underscore', 'bigscreen', 'moment', 'sjcl', 'modernizr', 'web
 			});
 		});
 
-		mediaStream.webrtc.e.on("bye", function(event, reason, from) {
+		mediaStream.webrtc.e.on("bye", function(event, reason, from, to, to2, message) {
 			//console.log("received bye", pickupTimeout, reason);
 			switch (reason) {
 				case "busy":
@@ -761,6 +847,10 @@ define(['jquery', 'underscore', 'bigscreen', 'moment', 'sjcl', 'modernizr', 'web
 						from: from
 					});
 					break;
+				case "closed":
+					console.log("Call was not routed to the user", reason, from);
+					alertify.dialog.alert(_.escape(message));
+					break;
 				case "error":
 					console.log("User cannot accept call because of error");
 					alertify.dialog.alert(translation._("Oops") + "<br/>" + translation._("User hung up because of error."));
@@ -328,6 +328,19 @@ define(['jquery', 'underscore', 'text!partials/presentation.html', 'bigscreen'],
 				return upload;
 			};
 
+			mediaStream.api.e.on("received.follow", function(event, data, from) {
+				if (!data.Slide || from === mediaStream.api.id) {
+					return;
+				}
+				$scope.$apply(function(scope) {
+					if (!scope.presentationLoaded) {
+						scope.pendingPageRequest = data.Slide;
+					} else if (data.Slide <= scope.maxPageNumber) {
+						scope.currentPageNumber = data.Slide;
+					}
+				});
+			});
+
 			mediaStream.api.e.on("received.presentation", function(event, id, from, data, p2p) {
 				if (!p2p) {
 					console.warn("Received presentation info without p2p. This should not happen!");
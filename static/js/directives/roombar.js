@@ -23,7 +23,7 @@
 define(['underscore', 'angular', 'text!partials/roombar.html'], function(_, angular, template) {
 
 	// roomBar
-	return ["$window", "rooms", "$timeout", "safeApply", function($window, rooms, $timeout, safeApply) {
+	return ["$window", "rooms", "$timeout", "safeApply", "mediaStream", function($window, rooms, $timeout, safeApply, mediaStream) {
 
 		var link = function($scope, $element) {
 
@@ -32,6 +32,40 @@ define(['underscore', 'angular', 'text!partials/roombar.html'], function(_, angu
 				$scope.newRoomName = "";
 			};
 
+			var timerEnds = null;
+			var timerTimeout = null;
+			var updateTimer = function() {
+				timerTimeout = null;
+				var remaining = timerEnds ? Math.ceil((timerEnds - new Date().getTime()) / 1000) : 0;
+				if (remaining <= 0) {
+					timerEnds = null;
+					$scope.timerRemaining = null;
+					return;
+				}
+				var seconds = remaining % 60;
+				$scope.timerRemaining = Math.floor(remaining / 60) + ":" + (seconds < 10 ? "0" : "") + seconds;
+				timerTimeout = $timeout(updateTimer, 1000);
+			};
+			var clearTimer = function() {
+				if (timerTimeout) {
+					$timeout.cancel(timerTimeout);
+				}
+				timerEnds = null;
+				updateTimer();
+			};
+
+			mediaStream.api.e.on("received.timer", function(event, data) {
+				safeApply($scope, function(scope) {
+					clearTimer();
+					if (data.Duration) {
+						// Convert to local time, the server time may be off.
+						timerEnds = data.Ends - (data.Now - new Date().getTime());
+						scope.timerLabel = data.Label || "";
+						updateTimer();
+					}
+				});
+			});
+
 			$scope.save = function() {
 				if ($scope.roombarform.$invalid) {
 					return;
@@ -62,7 +96,10 @@ define(['underscore', 'angular', 'text!partials/roombar.html'], function(_, angu
 			});
 
 			$scope.$on("room.left", function() {
-				safeApply($scope, clearRoomName);
+				safeApply($scope, function() {
+					clearRoomName();
+					clearTimer();
+				});
 			});
 
 			$scope.$watch("newRoomName", function(name) {
@@ -29,6 +29,7 @@ define(['jquery', 'underscore', 'ua-parser'], function($, _, uaparser) {
 		this.session = {};
 		this.connector = connector;
 		this.iids= 0;
+		this.termsAccepted = null;
 
 		this.e = $({});
 
@@ -47,6 +48,8 @@ define(['jquery', 'underscore', 'ua-parser'], function($, _, uaparser) {
 
 		// Heartbeat support.
 		this.last_receive = null;
+		this.rtt = null;
+		this.serverTimeOffset = 0;
 		this.last_receive_overdue = false;
 
 	};
@@ -155,9 +158,24 @@ define(['jquery', 'underscore', 'ua-parser'], function($, _, uaparser) {
 				if (data.Token) {
 					this.connector.token = data.Token;
 				}
+				this.connector.affinity = data.Affinity || null;
 				this.id = data.Id;
 				this.sid = data.Sid;
 				this.e.triggerHandler("received.self", [data]);
+				this.e.triggerHandler("received.extras", [data.Extras || {}, "Self"]);
+				break;
+			case "Volatile":
+				this.e.triggerHandler("received.volatile", [data, d.From]);
+				break;
+			case "BandwidthCap":
+				this.e.triggerHandler("received.bandwidthcap", [data, d.From]);
+				break;
+			case "Migrate":
+				console.log("Migrating to", data.Url, data.Reason);
+				this.connector.migrate(data.Url, data.Token);
+				break;
+			case "IceRestart":
+				this.e.triggerHandler("received.icerestart", [data.To, data, data.Type, d.To, d.From]);
 				break;
 			case "Offer":
 				//console.log("Offer received", data.To, data.Offer);
@@ -179,6 +197,33 @@ define(['jquery', 'underscore', 'ua-parser'], function($, _, uaparser) {
 				console.log("Bye received", data.To, data.Bye);
 				this.e.triggerHandler("received.bye", [data.To, data.Bye, data.Type, d.To, d.From]);
 				break;
+			case "CallScreening":
+				this.e.triggerHandler("received.callscreening", [data]);
+				break;
+			case "Queue":
+				this.e.triggerHandler("received.queue", [data]);
+				break;
+			case "QueueAgent":
+				this.e.triggerHandler("received.queueagent", [data]);
+				break;
+			case "Survey":
+				this.e.triggerHandler("received.survey", [data.Id, data.Questions, d.From]);
+				break;
+			case "MonitorEvent":
+				this.e.triggerHandler("received.monitorevent", [data.From, data.To, data.Event]);
+				break;
+			case "Whisper":
+				this.e.triggerHandler("received.whisper", [d.From, data.Message]);
+				break;
+			case "AgentState":
+				this.e.triggerHandler("received.agentstate", [data.Id, data.State]);
+				break;
+			case "AccessibilityEvent":
+				this.e.triggerHandler("received.accessibility", [d.From, data]);
+				break;
+			case "Dtmf":
+				this.e.triggerHandler("received.dtmf", [data.To, data.Tones, data.Duration, d.From]);
+				break;
 			case "Joined":
 			case "Left":
 				//console.log("User action received", dataType, data);
@@ -207,13 +252,71 @@ define(['jquery', 'underscore', 'ua-parser'], function($, _, uaparser) {
 			case "YouTubeVideo":
 				this.e.triggerHandler("received.youtubevideo", [d.To, d.From, data.YouTubeVideo, d.p2p]);
 				break;
+			case "Blob":
+				this.e.triggerHandler("received.blob", [d.From, data.Id, data.Mime, data.Data]);
+				break;
+			case "BlobStatus":
+				this.e.triggerHandler("received.blobstatus", [d.From, data.Id, data.Status, data.Reason]);
+				break;
+			case "Warning":
+				console.warn("Warning received", data.Code, data.Message);
+				this.e.triggerHandler("received.warning", [data]);
+				break;
 			case "Alive":
-				// Do nothing.
 				//console.log("Alive response received.");
+				if (data.Alive && data.Time) {
+					var now = new Date().getTime();
+					this.rtt = now - data.Alive;
+					this.serverTimeOffset = data.Time - Math.round((data.Alive + now) / 2);
+				}
 				break;
 			case "Room":
 				this.e.triggerHandler("received.room", [data]);
 				break;
+			case "EndRoom":
+				this.e.triggerHandler("received.endroom", [data]);
+				break;
+			case "Mute":
+				this.e.triggerHandler("received.mute", [data, d.From]);
+				break;
+			case "Permissions":
+				this.e.triggerHandler("received.permissions", [data, d.From]);
+				break;
+			case "Follow":
+				this.e.triggerHandler("received.follow", [data, d.From]);
+				break;
+			case "Timer":
+				this.e.triggerHandler("received.timer", [data, d.From]);
+				break;
+			case "Recording":
+				this.e.triggerHandler("received.recording", [data, d.From]);
+				break;
+			case "RecordingConsent":
+				this.e.triggerHandler("received.recordingconsent", [data.Id, data.Consent]);
+				break;
+			case "Ejected":
+				this.e.triggerHandler("received.ejected", [data]);
+				break;
+			case "Announcement":
+				this.e.triggerHandler("received.announcement", [data]);
+				break;
+			case "Spam":
+				this.e.triggerHandler("received.spam", [data]);
+				break;
+			case "ChatFlag":
+				this.e.triggerHandler("received.chatflag", [data]);
+				break;
+			case "Error":
+				if (data.Code === "chat_throttled") {
+					this.e.triggerHandler("received.chatthrottled", [data]);
+					break;
+				}
+				if (data.Code === "chat_rejected") {
+					this.e.triggerHandler("received.chatrejected", [data]);
+					break;
+				}
+				console.log("Error received:", data.Code, data.Message);
+				break;
 			default:
 				console.log("Unhandled type received:", dataType, data);
 				break;
@@ -232,7 +335,7 @@ define(['jquery', 'underscore', 'ua-parser'], function($, _, uaparser) {
 
 	};
 
-	Api.prototype.sendHello = function(name, pin, success, fault) {
+	Api.prototype.sendHello = function(name, pin, link, template, success, fault) {
 		var data = {
 			Version: this.version,
 			Ua: this.userAgent,
@@ -240,10 +343,26 @@ define(['jquery', 'underscore', 'ua-parser'], function($, _, uaparser) {
 			Type: "" // Selects the default room type.
 		};
 
-		if (pin) {
+		if (template) {
+			data.Template = template;
+		}
+
+		if (this.termsAccepted) {
+			data.Terms = this.termsAccepted;
+		}
+
+		var locale = document.documentElement.lang || window.navigator.language;
+		if (locale) {
+			data.Locale = locale;
+		}
+
+		if (pin || link) {
 			data.Credentials = {
-				PIN: pin
+				PIN: pin || ""
 			};
+			if (link) {
+				data.Credentials.Link = link;
+			}
 		}
 
 		var that = this;
@@ -254,6 +373,27 @@ define(['jquery', 'underscore', 'ua-parser'], function($, _, uaparser) {
 				}
 				that.e.triggerHandler("received.room", [data.Room]);
 				that.e.triggerHandler("received.users", [data.Users]);
+				if (data.Mute) {
+					that.e.triggerHandler("received.mute", [data.Mute, null]);
+				}
+				if (data.Permissions) {
+					that.e.triggerHandler("received.permissions", [data.Permissions, null]);
+				}
+				if (data.Follow) {
+					that.e.triggerHandler("received.follow", [data.Follow, null]);
+				}
+				if (data.Timer) {
+					that.e.triggerHandler("received.timer", [data.Timer, null]);
+				}
+				if (data.Recording) {
+					that.e.triggerHandler("received.recording", [data.Recording, null]);
+				}
+				_.each(data.Volatile, function(volatile) {
+					that.e.triggerHandler("received.volatile", [volatile, volatile.From]);
+				});
+				// Always trigger, to lift caps of a previous room.
+				that.e.triggerHandler("received.bandwidthcap", [data.Bandwidth || {Type: "BandwidthCap", Video: 0}, null]);
+				that.e.triggerHandler("received.extras", [data.Extras || {}, "Welcome"]);
 			} else {
 				if (fault) {
 					fault(data);
@@ -365,6 +505,247 @@ define(['jquery', 'underscore', 'ua-parser'], function($, _, uaparser) {
 
 	};
 
+	Api.prototype.sendDtmf = function(to, tones, duration) {
+
+		var data = {
+			To: to,
+			Type: "Dtmf",
+			Tones: tones
+		}
+		if (duration) {
+			data.Duration = duration;
+		}
+
+		return this.send("Dtmf", data);
+
+	};
+
+	Api.prototype.sendQueueAgent = function(state) {
+
+		var data = {
+			Type: "QueueAgent",
+			State: state
+		}
+
+		return this.send("QueueAgent", data);
+
+	};
+
+	Api.prototype.sendMonitor = function(agent, to, active) {
+
+		var data = {
+			Type: "Monitor",
+			Session: agent,
+			To: to,
+			Active: !!active
+		}
+
+		return this.send("Monitor", data);
+
+	};
+
+	Api.prototype.sendWhisper = function(to, message) {
+
+		var data = {
+			Type: "Whisper",
+			To: to,
+			Message: message
+		}
+
+		return this.send("Whisper", data);
+
+	};
+
+	Api.prototype.sendFields = function(fields) {
+
+		var data = {
+			Type: "Fields",
+			Fields: fields
+		}
+
+		return this.send("Fields", data);
+
+	};
+
+	Api.prototype.sendRoomSearch = function(query, sort, limit, success, fault) {
+
+		var data = {
+			Type: "RoomSearch",
+			Query: query || ""
+		}
+		if (sort) {
+			data.Sort = sort;
+		}
+		if (limit) {
+			data.Limit = limit;
+		}
+
+		this.request("RoomSearch", data, function(event) {
+			if (event.Type === "RoomSearchResult") {
+				if (success) {
+					success(event.Rooms);
+				}
+			} else if (fault) {
+				fault(event);
+			}
+		});
+
+	};
+
+	Api.prototype.sendDirectory = function(discoverability, success, fault) {
+
+		var data = {
+			Type: "Directory",
+			Discoverability: discoverability
+		}
+
+		this.request("Directory", data, function(event) {
+			if (event.Type === "Directory") {
+				if (success) {
+					success(event.Discoverability);
+				}
+			} else if (fault) {
+				fault(event);
+			}
+		});
+
+	};
+
+	Api.prototype.sendDirectorySearch = function(query, emailHash, limit, success, fault) {
+
+		var data = {
+			Type: "DirectorySearch"
+		}
+		if (query) {
+			data.Query = query;
+		}
+		if (emailHash) {
+			data.EmailHash = emailHash;
+		}
+		if (limit) {
+			data.Limit = limit;
+		}
+
+		this.request("DirectorySearch", data, function(event) {
+			if (event.Type === "DirectorySearchResult") {
+				if (success) {
+					success(event.Users);
+				}
+			} else if (fault) {
+				fault(event);
+			}
+		});
+
+	};
+
+	Api.prototype.sendChatSearch = function(query, limit, success, fault) {
+
+		var data = {
+			Type: "ChatSearch",
+			Query: query
+		}
+		if (limit) {
+			data.Limit = limit;
+		}
+
+		this.request("ChatSearch", data, function(event) {
+			if (event.Type === "ChatSearchResult") {
+				if (success) {
+					success(event.Results);
+				}
+			} else if (fault) {
+				fault(event);
+			}
+		});
+
+	};
+
+	Api.prototype.sendAccessibility = function(kinds, success, fault) {
+
+		var data = {
+			Type: "Accessibility",
+			Subscribe: kinds || []
+		}
+
+		this.request("Accessibility", data, function(event) {
+			if (event.Type === "Accessibility") {
+				if (success) {
+					success(event.Subscribe);
+				}
+			} else if (fault) {
+				fault(event);
+			}
+		});
+
+	};
+
+	Api.prototype.sendAccessibilityEvent = function(kind, text, language, final) {
+
+		var data = {
+			Type: "AccessibilityEvent",
+			Kind: kind,
+			Text: text,
+			Language: language || "",
+			Final: !!final
+		}
+
+		return this.send("AccessibilityEvent", data);
+
+	};
+
+	Api.prototype.sendSurveyResponse = function(id, answers) {
+
+		var data = {
+			Type: "SurveyResponse",
+			Id: id,
+			Answers: answers
+		}
+
+		return this.send("SurveyResponse", data);
+
+	};
+
+	Api.prototype.requestIceRestart = function(to, reason, cb) {
+
+		var data = {
+			Type: "IceRestart",
+			To: to,
+			Reason: reason
+		}
+
+		var onResponse = function(event, type, data) {
+			if (type === "IceRestart" && cb) {
+				cb(data);
+			}
+		};
+		this.request("IceRestart", data, onResponse, true);
+
+	};
+
+	Api.prototype.requestNetworkChange = function(network, peers, cb) {
+
+		var data = {
+			Type: "NetworkChange",
+			Network: network,
+			Peers: peers
+		}
+
+		var onResponse = _.bind(function(event, type, data) {
+			if (type !== "NetworkChanged") {
+				return;
+			}
+			// Fresh TURN credentials for the new network.
+			if (data.Turn) {
+				this.e.triggerHandler("received.turn", [data.Turn]);
+			}
+			if (cb) {
+				cb(data);
+			}
+		}, this);
+		this.request("NetworkChange", data, onResponse, true);
+
+	};
+
 	Api.prototype.sendChat = function(to, message, status, mid) {
 
 		var data = {
@@ -448,10 +829,104 @@ define(['jquery', 'underscore', 'ua-parser'], function($, _, uaparser) {
 			Type: "Alive",
 			Alive: timestamp
 		}
+		if (this.rtt) {
+			// Report the round trip time of the previous Alive.
+			data.Rtt = this.rtt;
+		}
 
 		return this.send("Alive", data);
 	};
 
+	// Send base64 encoded data to session id in chunks, the server
+	// reassembles them.
+	Api.prototype.sendBlob = function(id, transferId, mime, data) {
+
+		var chunkSize = 16384; // Multiple of 4 to keep base64 chunks valid.
+		var total = Math.max(1, Math.ceil(data.length / chunkSize));
+		for (var i = 0; i < total; i++) {
+			this.send("BlobChunk", {
+				Type: "BlobChunk",
+				To: id,
+				Id: transferId,
+				Index: i,
+				Total: total,
+				Mime: mime || "",
+				Data: data.substr(i * chunkSize, chunkSize)
+			});
+		}
+
+	};
+
+	Api.prototype.sendRecordingConsent = function(consent) {
+
+		var data = {
+			Type: "RecordingConsent",
+			Consent: !!consent
+		}
+
+		return this.send("RecordingConsent", data);
+	};
+
+	Api.prototype.sendVolatile = function(key, value) {
+
+		var data = {
+			Type: "Volatile",
+			Key: key,
+			Data: value
+		}
+
+		// Not queued, outdated values are useless after reconnecting.
+		return this.send("Volatile", data, true);
+	};
+
+	Api.prototype.sendBandwidth = function(send, receive) {
+
+		var data = {
+			Type: "Bandwidth",
+			Send: send,
+			Receive: receive
+		}
+
+		// Not queued, estimates are outdated after reconnecting.
+		return this.send("Bandwidth", data, true);
+	};
+
+	Api.prototype.requestPermissions = function(permissions, cb) {
+
+		var data = _.extend({}, permissions, {
+			Type: "Permissions"
+		});
+
+		return this.request("Permissions", data, cb);
+
+	};
+
+	Api.prototype.requestBlock = function(userid, block, cb) {
+
+		var data = {
+			Type: "Block",
+			Userid: userid || "",
+			Block: !!block
+		}
+
+		return this.request("Block", data, cb);
+
+	};
+
+	Api.prototype.requestFavorites = function(favorite, pin, cb) {
+
+		var data = {
+			Type: "Favorites"
+		}
+		if (favorite) {
+			data.Favorite = favorite;
+			data.Pin = !!pin;
+		}
+
+		return this.request("Favorites", data, cb);
+
+	};
+
 	Api.prototype.sendSessions = function(token, type, cb) {
 
 		var data = {
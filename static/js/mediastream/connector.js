@@ -34,6 +34,8 @@ define(['jquery', 'underscore'], function($, _) {
 		this.disabled = false;
 
 		this.token = null;
+		this.affinity = null;
+		this.privacy = false;
 		this.queue = [];
 	};
 
@@ -52,10 +54,22 @@ define(['jquery', 'underscore'], function($, _) {
 		this.error = false;
 		this.e.triggerHandler("connecting", [url]);
 		this.url = url;
+		var params = [];
 		if (this.token) {
-			url += ("?t=" + this.token);
+			params.push("t=" + this.token);
 			//console.log("Reusing existing token", this.token);
 		}
+		if (this.affinity) {
+			// Allows load balancers to route us back to our node.
+			params.push("a=" + encodeURIComponent(this.affinity));
+		}
+		if (this.privacy) {
+			// Leaves our session out of events and statistics.
+			params.push("p=1");
+		}
+		if (params.length) {
+			url += ("?" + params.join("&"));
+		}
 
 		var that = this;
 
@@ -134,6 +148,16 @@ define(['jquery', 'underscore'], function($, _) {
 
 	};
 
+	Connector.prototype.migrate = function(url, token) {
+
+		// Reconnect to another server, keeping our session.
+		this.token = token;
+		this.affinity = null;
+		this.url = url;
+		this.reconnect();
+
+	};
+
 	Connector.prototype.forgetAndReconnect = function() {
 
 		this.token = null;
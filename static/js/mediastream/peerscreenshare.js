@@ -83,6 +83,19 @@ define(['jquery', 'underscore', 'mediastream/peercall', 'mediastream/tokens'], f
 			minWidth: 1,
 			minHeight: 1
 		}, webrtc.settings.screensharing.mediaConstraints.video.mandatory, options);
+		// Rooms can limit screen sharing.
+		var limits = webrtc.currentroom && webrtc.currentroom.ScreenShare;
+		if (limits) {
+			if (limits.MaxWidth) {
+				mandatoryVideoConstraints.maxWidth = Math.min(mandatoryVideoConstraints.maxWidth, limits.MaxWidth);
+			}
+			if (limits.MaxHeight) {
+				mandatoryVideoConstraints.maxHeight = Math.min(mandatoryVideoConstraints.maxHeight, limits.MaxHeight);
+			}
+			if (limits.MaxFrameRate) {
+				mandatoryVideoConstraints.maxFrameRate = Math.min(mandatoryVideoConstraints.maxFrameRate || limits.MaxFrameRate, limits.MaxFrameRate);
+			}
+		}
 		var mediaConstraints = $.extend(true, {}, webrtc.settings.screensharing.mediaConstraints, {
 			audio: false
 		});
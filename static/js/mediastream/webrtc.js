@@ -157,8 +157,29 @@ function($, _, PeerCall, PeerConference, PeerXfer, PeerScreenshare, UserMedia, u
 
 		};
 
-		this.api.e.bind("received.offer received.candidate received.answer received.bye received.conference", _.bind(this.processReceived, this));
+		this.api.e.bind("received.offer received.candidate received.answer received.bye received.conference received.icerestart", _.bind(this.processReceived, this));
 		this.api.e.bind("received.room", _.bind(this.receivedRoom, this));
+		this.api.e.bind("received.endroom", _.bind(function() {
+			this.doHangup("endroom");
+		}, this));
+		this.api.e.bind("received.callscreening", _.bind(this.receivedCallScreening, this));
+		this.api.e.bind("received.queue", _.bind(function(event, data) {
+			this.e.triggerHandler("queue", [data.Position, data.Length, data.Agent]);
+		}, this));
+		this.api.e.bind("received.queueagent", _.bind(this.receivedQueueAgent, this));
+		this.api.e.bind("received.bandwidthcap", _.bind(function(event, data) {
+			this.setVideoSendBitrate(data.Video);
+		}, this));
+
+		// Tell the server when the network changes, to restart ICE of calls.
+		var onNetworkChange = _.debounce(_.bind(this.networkChanged, this), 1000);
+		$(window).on("online", onNetworkChange);
+		if (window.navigator.connection && window.navigator.connection.addEventListener) {
+			window.navigator.connection.addEventListener("change", onNetworkChange);
+		}
+
+		// Report bandwidth estimates so the server can cap video in stressed rooms.
+		window.setInterval(_.bind(this.reportBandwidth, this), 10000);
 	};
 
 	WebRTC.prototype.receivedRoom = function(event, room) {
@@ -191,6 +212,12 @@ function($, _, PeerCall, PeerConference, PeerXfer, PeerScreenshare, UserMedia, u
 		}
 		console.log("Joined room", room, this.api.id);
 		this.currentroom = room;
+		// Room templates can require relayed connections.
+		if (room && room.Turn === "relay") {
+			this.settings.pcConfig.iceTransportPolicy = "relay";
+		} else {
+			delete this.settings.pcConfig.iceTransportPolicy;
+		}
 		_.defer(_.bind(function() {
 			this.maybeStartLocalVideo();
 		}, this), 100);
@@ -383,6 +410,44 @@ function($, _, PeerCall, PeerConference, PeerXfer, PeerScreenshare, UserMedia, u
 		this.e.triggerHandler("bye", [data.Reason, from, to, to2]);
 	};
 
+	WebRTC.prototype.receivedCallScreening = function(event, data) {
+		console.log("Call screened.", data.To, data.Action, data.Reason);
+		// The callee never received the offer, so hang up without Bye.
+		this.doHangup("receivedbye", data.To);
+		if (data.Action === "redirect" && data.Redirect) {
+			this.doCall(data.Redirect);
+			return;
+		}
+		if (data.Message) {
+			this.e.triggerHandler("bye", ["closed", data.To, data.To, null, data.Message]);
+		} else {
+			this.e.triggerHandler("bye", ["reject", data.To, data.To]);
+		}
+	};
+
+	WebRTC.prototype.receivedQueueAgent = function(event, data) {
+		if (!data.Caller) {
+			return;
+		}
+		// The server handed a waiting caller to us, we are on the call
+		// until it ends and wrap-up passed.
+		console.log("Taking queued call.", data.Caller);
+		this.doCall(data.Caller);
+	};
+
+	WebRTC.prototype._processIceRestart = function(to, data, type, to2, from) {
+		var call = this.conference.getCall(from);
+		if (!call) {
+			console.warn("Received IceRestart for unknown id -> ignore.", from);
+			return;
+		}
+
+		console.log("IceRestart process.", data.Reason, data.Offer);
+		if (data.Offer) {
+			this.restartIce(call);
+		}
+	};
+
 	WebRTC.prototype._processConference = function(to, data, type, to2, from) {
 		var ids = this.conference.getCallIds();
 		if (!ids.length && !this.isConferenceRoom()) {
@@ -441,6 +506,9 @@ function($, _, PeerCall, PeerConference, PeerXfer, PeerScreenshare, UserMedia, u
 			case "Conference":
 				this._processConference(to, data, type, to2, from);
 				break;
+			case "IceRestart":
+				this._processIceRestart(to, data, type, to2, from);
+				break;
 			default:
 				console.log("Unhandled message type", type, data);
 				break;
@@ -485,8 +553,11 @@ function($, _, PeerCall, PeerConference, PeerXfer, PeerScreenshare, UserMedia, u
 		call.e.on("connectionStateChange", _.bind(function(event, state, currentcall) {
 			switch (state) {
 			case "disconnected":
+				this.conference.markDisconnected(currentcall.id);
+				break;
 			case "failed":
 				this.conference.markDisconnected(currentcall.id);
+				this.requestIceRestart(currentcall, "ice_failed");
 				break;
 			}
 		}, this));
@@ -865,6 +936,61 @@ function($, _, PeerCall, PeerConference, PeerXfer, PeerScreenshare, UserMedia, u
 
 	};
 
+	WebRTC.prototype.networkChanged = function() {
+
+		var connection = window.navigator.connection;
+		var network = connection && connection.type ? connection.type : "";
+		var peers = _.filter(this.conference.getCallIds(), _.bind(function(id) {
+			var call = this.conference.getCall(id);
+			return call && call.peerconnection;
+		}, this));
+		console.log("Network changed", network, peers);
+		this.api.requestNetworkChange(network, peers, _.bind(function(data) {
+			_.each(data.IceRestart, _.bind(function(iceRestart) {
+				var call = this.conference.getCall(iceRestart.To);
+				if (call && iceRestart.Offer) {
+					this.restartIce(call);
+				}
+			}, this));
+		}, this));
+
+	};
+
+	WebRTC.prototype.requestIceRestart = function(currentcall, reason) {
+
+		if (!currentcall.peerconnection) {
+			return;
+		}
+		// The server decides which side sends the offer, to avoid glare.
+		this.api.requestIceRestart(currentcall.id, reason, _.bind(function(data) {
+			if (data.Offer) {
+				this.restartIce(currentcall);
+			}
+		}, this));
+
+	};
+
+	WebRTC.prototype.restartIce = function(currentcall) {
+
+		if (!currentcall.peerconnection || !currentcall.peerconnection.pc) {
+			return;
+		}
+		console.log("Restarting ICE", currentcall.id);
+		var pc = currentcall.peerconnection.pc;
+		if (pc.setConfiguration) {
+			// Use current TURN credentials for new allocations.
+			try {
+				pc.setConfiguration(this.settings.pcConfig);
+			} catch(e) {
+				console.warn("Failed to update peer connection configuration", e);
+			}
+		}
+		currentcall.offerOptions.iceRestart = true;
+		this.sendOfferWhenNegotiationNeeded(currentcall);
+		delete currentcall.offerOptions.iceRestart;
+
+	};
+
 	WebRTC.prototype.onConnectionStateChange = function(iceConnectionState, currentcall) {
 		// Defer this to allow native event handlers to complete before running more stuff.
 		_.defer(_.bind(function() {
@@ -900,6 +1026,92 @@ function($, _, PeerCall, PeerConference, PeerXfer, PeerScreenshare, UserMedia, u
 
 	};
 
+	WebRTC.prototype.setVideoSendBitrate = function(bitrate) {
+
+		// Applies to new negotiations, and to running calls where the
+		// browser supports changing sender parameters.
+		if (bitrate) {
+			this.settings.sdpParams.videoSendBitrate = String(bitrate);
+		} else {
+			delete this.settings.sdpParams.videoSendBitrate;
+		}
+		_.each(this.conference.getCalls(), function(call) {
+			if (!call.sdpParams) {
+				return;
+			}
+			if (bitrate) {
+				call.sdpParams.videoSendBitrate = String(bitrate);
+			} else {
+				delete call.sdpParams.videoSendBitrate;
+			}
+			var pc = call.peerconnection && call.peerconnection.pc;
+			if (!pc || !pc.getSenders) {
+				return;
+			}
+			_.each(pc.getSenders(), function(sender) {
+				if (!sender.track || sender.track.kind !== "video" || !sender.getParameters) {
+					return;
+				}
+				var parameters = sender.getParameters();
+				_.each(parameters.encodings || [], function(encoding) {
+					if (bitrate) {
+						encoding.maxBitrate = bitrate * 1000;
+					} else {
+						delete encoding.maxBitrate;
+					}
+				});
+				sender.setParameters(parameters).catch(function(err) {
+					console.warn("Failed to set video send bitrate", err);
+				});
+			});
+		});
+
+	};
+
+	WebRTC.prototype.reportBandwidth = function() {
+
+		var calls = _.filter(this.conference.getCalls(), function(call) {
+			var pc = call.peerconnection && call.peerconnection.pc;
+			return pc && pc.getStats;
+		});
+		if (!calls.length) {
+			return;
+		}
+
+		// Sum the estimates of the active candidate pairs of all calls.
+		var send = 0;
+		var receive = 0;
+		var pending = calls.length;
+		var done = _.bind(function() {
+			pending -= 1;
+			if (pending === 0 && (send || receive)) {
+				this.api.sendBandwidth(Math.round(send / 1000), Math.round(receive / 1000));
+			}
+		}, this);
+		_.each(calls, function(call) {
+			var promise;
+			try {
+				promise = call.peerconnection.pc.getStats();
+			} catch(e) {
+				// Legacy callback based API.
+			}
+			if (!promise || !promise.then) {
+				done();
+				return;
+			}
+			promise.then(function(stats) {
+				stats.forEach(function(report) {
+					if (report.type === "candidate-pair" && report.nominated && report.state === "succeeded") {
+						send += report.availableOutgoingBitrate || 0;
+						receive += report.availableIncomingBitrate || 0;
+					}
+				});
+				done();
+			}, done);
+		});
+
+	};
+
 	return WebRTC;
 
 });
@@ -406,12 +406,15 @@ define(['jquery', 'angular', 'underscore', 'modernizr', 'avltree', 'text!partial
 		Buddylist.prototype.updateDisplay = function(id, scope, data, queueName) {
 
 			//console.log("updateDisplay", data, scope);
+			var display = scope.display;
+			// Stale sessions are probably reconnecting.
+			display.stale = data.Liveness === "stale";
+
 			var status = data.Status;
 			if (!status) {
 				return;
 			}
 
-			var display = scope.display;
 			var contact = scope.contact && scope.contact.Status;
 			// Update display name.
 			var displayName = display.displayName;
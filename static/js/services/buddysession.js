@@ -139,6 +139,9 @@ define(["underscore"], function(_) {
 				if (data.Status) {
 					sessionData.Status = data.Status;
 				}
+				if (data.Liveness) {
+					sessionData.Liveness = data.Liveness;
+				}
 			}
 
 			if (id === this.Id) {
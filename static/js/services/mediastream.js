@@ -44,6 +44,9 @@ define([
 		// Create encryption key from server token and browser name.
 		var secureKey = sjcl.codec.base64.fromBits(sjcl.hash.sha256.hash(context.Cfg.Token + uaparser().browser.name));
 
+		// Request privacy mode for browsers which ask not to be tracked.
+		connector.privacy = $window.navigator.doNotTrack === "1" || $window.doNotTrack === "1";
+
 		// Apply configuration details.
 		webrtc.settings.renegotiation = context.Cfg.Renegotiation && true;
 		if (webrtc.settings.renegotiation && $window.webrtcDetectedBrowser !== "chrome") {
@@ -26,18 +26,25 @@ define([
 	'underscore'
 ], function(angular, $, _) {
 
-	return ["$window", "$location", "$timeout", "$q", "$route", "$rootScope", "$http", "globalContext", "safeApply", "connector", "api", "restURL", "roompin", "appData", "alertify", "translation", "mediaStream", function($window, $location, $timeout, $q, $route, $rootScope, $http, globalContext, safeApply, connector, api, restURL, roompin, appData, alertify, translation, mediaStream) {
+	return ["$window", "$location", "$timeout", "$q", "$route", "$rootScope", "$http", "globalContext", "safeApply", "connector", "api", "restURL", "roompin", "appData", "alertify", "translation", "mediaStream", "localStorage", function($window, $location, $timeout, $q, $route, $rootScope, $http, globalContext, safeApply, connector, api, restURL, roompin, appData, alertify, translation, mediaStream, localStorage) {
 
 		var body = $("body");
 
 		var url = restURL.api("rooms");
 		var requestedRoomName = "";
+		var requestedRoomLink = null;
+		var requestedRoomTemplate = null;
 		var priorRoomName = null;
 		var helloedRoomName = null;
 		var currentRoom = null;
 		var randomRoom = null;
 		var canJoinRooms = !mediaStream.config.AuthorizeRoomJoin;
 		var canCreateRooms = canJoinRooms ? !mediaStream.config.AuthorizeRoomCreation : false;
+		var termsVersion = mediaStream.config.TermsVersion;
+
+		if (termsVersion && localStorage.getItem("mediastream-terms") === termsVersion) {
+			api.termsAccepted = termsVersion;
+		}
 
 		var rooms;
 		var joinFailed;
@@ -68,6 +75,53 @@ define([
 				roompin.clear(requestedRoomName);
 				joinRequestedRoom();
 				break;
+			case "invalid_room_link":
+			case "room_link_expired":
+				console.log("Room link is not valid", error.Code);
+				requestedRoomLink = null;
+				alertify.dialog.notify("", translation._("The room link is invalid or has expired."));
+				rooms.joinPriorOrDefault(true);
+				break;
+			case "auth_locked":
+				console.log("Room join locked", error.Message);
+				alertify.dialog.notify("", translation._("Too many failed attempts. Please try again later."));
+				rooms.joinPriorOrDefault(true);
+				break;
+			case "room_locked":
+				console.log("Room is locked");
+				alertify.dialog.notify("", translation._("This room is locked."));
+				rooms.joinPriorOrDefault(true);
+				break;
+			case "invalid_room_name":
+			case "room_name_reserved":
+				console.log("Room name not allowed", error.Code);
+				alertify.dialog.notify("", translation._("This room name is not allowed. Please choose another name."));
+				rooms.joinPriorOrDefault(true);
+				break;
+			case "room_full":
+				console.log("Room is full");
+				alertify.dialog.notify("", translation._("This room is full."));
+				rooms.joinPriorOrDefault(true);
+				break;
+			case "unknown_room_template":
+				console.log("Room template does not exist");
+				requestedRoomTemplate = null;
+				joinRequestedRoom();
+				break;
+			case "terms_required":
+				var terms = mediaStream.config.TermsText || translation._("Please accept the terms of use to continue.");
+				if (mediaStream.config.TermsURL) {
+					terms += " " + mediaStream.config.TermsURL;
+				}
+				alertify.dialog.confirm(terms, function() {
+					localStorage.setItem("mediastream-terms", termsVersion);
+					api.termsAccepted = termsVersion;
+					joinRequestedRoom();
+				}, function() {
+					console.log("Terms not accepted");
+					alertify.dialog.notify("", translation._("You have to accept the terms of use to join rooms."));
+				});
+				break;
 			case "room_join_requires_account":
 				console.log("Room join requires a logged in user.");
 				alertify.dialog.notify("", translation._("Please sign in to create rooms."));
@@ -95,7 +149,7 @@ define([
 						}
 					});
 					console.log("Joining room", [requestedRoomName]);
-					api.sendHello(requestedRoomName, roompin.get(requestedRoomName), function(room) {
+					api.sendHello(requestedRoomName, roompin.get(requestedRoomName), requestedRoomLink, requestedRoomTemplate, function(room) {
 						setCurrentRoom(room);
 					}, function(error) {
 						joinFailed(error);
@@ -147,6 +201,18 @@ define([
 			applyRoomUpdate(room);
 		});
 
+		api.e.on("received.endroom", function(event, data) {
+			alertify.dialog.notify("", translation._("The room has been ended."));
+			rooms.joinDefault(true);
+		});
+
+		api.e.on("received.ejected", function(event, data) {
+			if (data.Reason === "recording_consent") {
+				alertify.dialog.notify("", translation._("You have left the room because you did not consent to the recording."));
+			}
+			rooms.joinDefault(true);
+		});
+
 		appData.e.on("authorizing", function(event, value) {
 			if (!value) {
 				// NOTE(lcooper): This will have been skipped earlier, so try again.
@@ -173,6 +239,10 @@ define([
 				roomName = "";
 			}
 			requestedRoomName = roomName;
+			// Signed room links are passed as link query parameter.
+			requestedRoomLink = $location.search().link || null;
+			// New rooms can select a room template with the template query parameter.
+			requestedRoomTemplate = $location.search().template || null;
 			if (connector.connected) {
 				_.defer(joinRequestedRoom);
 			} else {